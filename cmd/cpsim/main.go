@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/omec-project/upf-epc/pfcpiface"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	upfAddr       = flag.String("upf", "127.0.0.1", "N4 address of the UPF, with an optional port")
+	nodeID        = flag.String("node-id", "", "IP address sent as Node ID, the local address toward the UPF by default")
+	n3Address     = flag.String("n3", "198.18.0.1", "N3 address of the UPF")
+	gnbAddress    = flag.String("gnb", "198.18.0.10", "gNB address the downlink is tunneled to")
+	uePool        = flag.String("ue-pool", "17.0.0.0/16", "IPv4 CIDR of the UE addresses")
+	sessions      = flag.Int("sessions", 100, "number of sessions")
+	rate          = flag.Int("rate", 0, "requests per second of each procedure, unlimited if 0")
+	concurrency   = flag.Int("concurrency", 1, "number of requests in flight")
+	modifications = flag.Int("modifications", 1, "number of modifications of each session")
+	timeout       = flag.Duration("timeout", 5*time.Second, "time to wait for each response")
+	logLevel      = flag.String("log-level", "info", "log level")
+)
+
+func main() {
+	flag.Parse()
+
+	level, err := log.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatalln("Invalid log level:", err)
+	}
+
+	log.SetLevel(level)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := pfcpiface.RunCPSim(ctx, pfcpiface.CPSimConf{
+		UPFAddr:       *upfAddr,
+		NodeID:        *nodeID,
+		N3Address:     *n3Address,
+		GNBAddress:    *gnbAddress,
+		UEPool:        *uePool,
+		Sessions:      *sessions,
+		Rate:          *rate,
+		Concurrency:   *concurrency,
+		Modifications: *modifications,
+		Timeout:       *timeout,
+	})
+
+	if err != nil && report.Establishment.Requests == 0 {
+		log.Fatalln("cpsim failed:", err)
+	}
+
+	fmt.Print(report)
+
+	if err != nil {
+		log.Fatalln("cpsim failed:", err)
+	}
+}
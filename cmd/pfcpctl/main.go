@@ -0,0 +1,331 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+// pfcpctl administers a running pfcpiface through its HTTP admin API.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	addr    = flag.String("addr", "http://127.0.0.1:8080", "URL of the HTTP port of the UPF")
+	timeout = flag.Duration("timeout", 10*time.Second, "time to wait for each response")
+	raw     = flag.Bool("json", false, "print the responses as JSON")
+)
+
+const usage = `Usage: pfcpctl [flags] <command> [args]
+
+Commands:
+  sessions [node ID]     list the sessions, optionally of one CP node
+  associations           show the association with each CP node
+  drain [start|cancel]   show, start or cancel draining
+  log-level [level]      show or change the log level
+  config                 dump the config in use
+  self-test              check that the datapath forwards
+
+Flags:
+`
+
+// client calls the admin API of a UPF.
+type client struct {
+	addr string
+	http *http.Client
+	out  io.Writer
+	raw  bool
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := &client{
+		addr: strings.TrimSuffix(*addr, "/"),
+		http: &http.Client{Timeout: *timeout},
+		out:  os.Stdout,
+		raw:  *raw,
+	}
+
+	if err := c.run(flag.Arg(0), flag.Args()[1:]); err != nil {
+		log.Fatalln("pfcpctl failed:", err)
+	}
+}
+
+// run runs command with args.
+func (c *client) run(command string, args []string) error {
+	switch command {
+	case "sessions":
+		path := "/v1/sessions"
+		if len(args) > 0 {
+			path += "?node=" + url.QueryEscape(args[0])
+		}
+
+		return c.sessions(path)
+	case "associations":
+		return c.associations()
+	case "drain":
+		return c.drain(args)
+	case "log-level":
+		return c.logLevel(args)
+	case "config":
+		var conf json.RawMessage
+		if err := c.do(http.MethodGet, "/v1/config", nil, &conf); err != nil {
+			return err
+		}
+
+		return c.printJSON(conf)
+	case "self-test":
+		return c.selfTest()
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// do sends a request with body, if any, encoded as JSON, and decodes the response
+// into resp, if any. Responses other than 2xx are returned as errors.
+func (c *client) do(method, path string, body, resp interface{}) error {
+	var reqBody io.Reader
+
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.addr+path, reqBody)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s: %s", method, path, res.Status, strings.TrimSpace(string(b)))
+	}
+
+	if resp == nil || len(b) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(b, resp)
+}
+
+func (c *client) printJSON(v interface{}) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
+
+type session struct {
+	NodeID     string    `json:"node_id"`
+	LocalSEID  uint64    `json:"local_seid"`
+	RemoteSEID uint64    `json:"remote_seid"`
+	UEIPs      []string  `json:"ue_ips"`
+	PDRs       int       `json:"pdrs"`
+	FARs       int       `json:"fars"`
+	QERs       int       `json:"qers"`
+	URRs       int       `json:"urrs"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (c *client) sessions(path string) error {
+	var sessions []session
+	if err := c.do(http.MethodGet, path, nil, &sessions); err != nil {
+		return err
+	}
+
+	if c.raw {
+		return c.printJSON(sessions)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE ID\tLOCAL SEID\tREMOTE SEID\tUE IP\tPDRS\tFARS\tQERS\tURRS\tAGE")
+
+	for _, s := range sessions {
+		fmt.Fprintf(w, "%s\t%#x\t%#x\t%s\t%d\t%d\t%d\t%d\t%s\n", s.NodeID, s.LocalSEID, s.RemoteSEID,
+			strings.Join(s.UEIPs, ","), s.PDRs, s.FARs, s.QERs, s.URRs, age(s.CreatedAt))
+	}
+
+	return w.Flush()
+}
+
+type association struct {
+	NodeID            string    `json:"node_id"`
+	Up                bool      `json:"up"`
+	Since             time.Time `json:"since"`
+	RecoveryTimeStamp time.Time `json:"recovery_time_stamp"`
+	Restarts          uint64    `json:"restarts"`
+	Sessions          int       `json:"sessions"`
+}
+
+func (c *client) associations() error {
+	var associations []association
+	if err := c.do(http.MethodGet, "/v1/associations", nil, &associations); err != nil {
+		return err
+	}
+
+	if c.raw {
+		return c.printJSON(associations)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE ID\tSTATE\tFOR\tSESSIONS\tRESTARTS\tRECOVERY TIME STAMP")
+
+	for _, a := range associations {
+		state := "down"
+		if a.Up {
+			state = "up"
+		}
+
+		recovery := "-"
+		if !a.RecoveryTimeStamp.IsZero() {
+			recovery = a.RecoveryTimeStamp.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n", a.NodeID, state, age(a.Since), a.Sessions, a.Restarts, recovery)
+	}
+
+	return w.Flush()
+}
+
+type drainStatus struct {
+	Draining bool `json:"draining"`
+	Sessions int  `json:"sessions"`
+}
+
+func (c *client) drain(args []string) error {
+	method := http.MethodGet
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "start":
+			method = http.MethodPost
+		case "cancel":
+			method = http.MethodDelete
+		default:
+			return fmt.Errorf("unknown drain action %q, expected start or cancel", args[0])
+		}
+	}
+
+	var status drainStatus
+	if err := c.do(method, "/v1/drain", nil, &status); err != nil {
+		return err
+	}
+
+	if c.raw {
+		return c.printJSON(status)
+	}
+
+	state := "not draining"
+	if status.Draining {
+		state = "draining"
+	}
+
+	_, err := fmt.Fprintf(c.out, "%s, %d sessions\n", state, status.Sessions)
+
+	return err
+}
+
+// logLevel prints the log level, or changes it by applying the config in use with
+// the new level. The other settings are sent back as received.
+func (c *client) logLevel(args []string) error {
+	var conf map[string]json.RawMessage
+	if err := c.do(http.MethodGet, "/v1/config", nil, &conf); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		var level string
+		if err := json.Unmarshal(conf["log_level"], &level); err != nil {
+			return err
+		}
+
+		_, err := fmt.Fprintln(c.out, level)
+
+		return err
+	}
+
+	level, err := json.Marshal(args[0])
+	if err != nil {
+		return err
+	}
+
+	conf["log_level"] = level
+
+	if err := c.do(http.MethodPut, "/v1/config", conf, nil); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(c.out, args[0])
+
+	return err
+}
+
+type selfTestResult struct {
+	Passed   bool    `json:"passed"`
+	Packets  uint64  `json:"packets"`
+	Duration float64 `json:"duration_seconds"`
+	Error    string  `json:"error,omitempty"`
+}
+
+func (c *client) selfTest() error {
+	var result selfTestResult
+	if err := c.do(http.MethodPost, "/v1/self-test", nil, &result); err != nil {
+		return err
+	}
+
+	if c.raw {
+		return c.printJSON(result)
+	}
+
+	_, err := fmt.Fprintf(c.out, "passed, %d packets counted in %.2fs\n", result.Packets, result.Duration)
+
+	return err
+}
+
+// age returns the time elapsed since t, rounded to the second.
+func age(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return time.Since(t).Round(time.Second).String()
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, handler http.Handler) (*client, *bytes.Buffer) {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	out := &bytes.Buffer{}
+
+	return &client{addr: srv.URL, http: srv.Client(), out: out}, out
+}
+
+func TestClient_sessions(t *testing.T) {
+	c, out := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/sessions", r.URL.Path)
+		require.Equal(t, "smf1", r.URL.Query().Get("node"))
+		io.WriteString(w, `[{"node_id":"smf1","local_seid":1,"remote_seid":16,"ue_ips":["10.250.0.1"],"pdrs":2}]`)
+	}))
+
+	require.NoError(t, c.run("sessions", []string{"smf1"}))
+	require.Contains(t, out.String(), "LOCAL SEID")
+	require.Regexp(t, `smf1\s+0x1\s+0x10\s+10.250.0.1\s+2`, out.String())
+}
+
+func TestClient_drain(t *testing.T) {
+	var method string
+
+	c, out := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		io.WriteString(w, `{"draining":true,"sessions":3}`)
+	}))
+
+	require.NoError(t, c.run("drain", []string{"start"}))
+	require.Equal(t, http.MethodPost, method)
+	require.Equal(t, "draining, 3 sessions\n", out.String())
+
+	require.NoError(t, c.run("drain", []string{"cancel"}))
+	require.Equal(t, http.MethodDelete, method)
+
+	require.Error(t, c.run("drain", []string{"stop"}))
+}
+
+func TestClient_logLevel(t *testing.T) {
+	conf := map[string]interface{}{"log_level": "info", "mode": "sim"}
+
+	c, out := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/config", r.URL.Path)
+
+		if r.Method == http.MethodPut {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&conf))
+			io.WriteString(w, `{"restart_required":[]}`)
+
+			return
+		}
+
+		require.NoError(t, json.NewEncoder(w).Encode(conf))
+	}))
+
+	require.NoError(t, c.run("log-level", []string{"debug"}))
+	require.Equal(t, map[string]interface{}{"log_level": "debug", "mode": "sim"}, conf, "rest of the config kept")
+
+	out.Reset()
+	require.NoError(t, c.run("log-level", nil))
+	require.Equal(t, "debug\n", out.String())
+}
+
+func TestClient_errors(t *testing.T) {
+	c, _ := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "self-test already running", http.StatusConflict)
+	}))
+
+	err := c.run("self-test", nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "self-test already running")
+
+	require.Error(t, c.run("unknown", nil))
+}
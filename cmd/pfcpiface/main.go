@@ -5,15 +5,20 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/omec-project/upf-epc/pfcpiface"
 	log "github.com/sirupsen/logrus"
 )
 
 var (
-	configPath = flag.String("config", "upf.json", "path to upf config")
+	configPath   = flag.String("config", "upf.json", "path to upf config")
+	validateOnly = flag.Bool("validate", false, "validate the upf config, print all its problems and exit")
 )
 
 func init() {
@@ -32,6 +37,18 @@ func main() {
 
 	// Read and parse json startup file.
 	conf, err := pfcpiface.LoadConfigFile(*configPath)
+
+	if *validateOnly {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Config %s is not valid:\n%v\n", *configPath, err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Config", *configPath, "is valid")
+
+		return
+	}
+
 	if err != nil {
 		log.Fatalln("Error reading conf file:", err)
 	}
@@ -40,8 +57,31 @@ func main() {
 
 	log.Infof("%+v", conf)
 
-	pfcpi := pfcpiface.NewPFCPIface(conf)
+	pfcpi, err := pfcpiface.NewPFCPIface(conf)
+	if err != nil {
+		log.Fatalln("Error creating PFCP agent:", err)
+	}
+
+	pfcpi.SetConfigPath(*configPath)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			log.Infoln("SIGHUP received, reloading config")
+
+			if err := pfcpi.ReloadConfigFile(); err != nil {
+				log.Errorln(err)
+			}
+		}
+	}()
 
 	// blocking
-	pfcpi.Run()
+	if err := pfcpi.Run(ctx); err != nil {
+		log.Fatalln("PFCP agent failed:", err)
+	}
 }
@@ -47,13 +47,20 @@ class Parser:
         self.enable_ntf = False
         self.notify_sockaddr = "/tmp/notifycp"
         self.endmarker_sockaddr = "/tmp/pfcpport"
+        self.enable_error_indication = False
+        self.errorind_sockaddr = "/tmp/errorind"
         self.enable_slice_metering = False
+        self.dscp_codepoints = []
         self.measure_flow = False
         self.table_size_pdr_lookup = 0
         self.table_size_flow_measure = 0
         self.table_size_app_qer_lookup = 0
         self.table_size_session_qer_lookup = 0
         self.table_size_far_lookup = 0
+        self.far_duplication = None
+        self.local_switching = None
+        self.neighbor_proxy = False
+        self.gtpu_endpoints = {'access': [], 'core': []}
 
     def parse(self, ifaces):
         # Maximum number of flows to manage ip4 frags for re-assembly
@@ -156,6 +163,13 @@ class Parser:
         except KeyError:
             print("No slice rate limit! Disabling meter.")
 
+        # Transport level marking
+        try:
+            self.dscp_codepoints = sorted(
+                set(m["dscp"] for m in self.conf["qfi_dscp_config"]))
+        except KeyError:
+            print("No QFI to DSCP map! Disabling DSCP marking.")
+
         # UnixPort Paths
         try:
             self.notify_sockaddr = self.conf["notify_sockaddr"]
@@ -169,6 +183,19 @@ class Parser:
         except KeyError:
             print('Can\'t parse unix socket paths for end marker! Setting it to default values ({})'.format(
                 "/tmp/pfcpport"))
+
+        # GTP-U Error Indication
+        try:
+            self.enable_error_indication = bool(self.conf["enable_error_indication"])
+        except KeyError:
+            print("No error indication flag! Disabling GTP-U Error Indication handling.")
+
+        # UnixPort Paths
+        try:
+            self.errorind_sockaddr = self.conf["errorind_sockaddr"]
+        except KeyError:
+            print('Can\'t parse unix socket paths for error indication! Setting it to default values ({})'.format(
+                "/tmp/errorind"))
         # Network Token Function
         try:
             self.enable_ntf = bool(self.conf['enable_ntf'])
@@ -181,6 +208,34 @@ class Parser:
         except KeyError:
             print('Flow measurement function disabled')
 
+        # FAR duplication
+        try:
+            if self.conf["far_duplication"]["enable"]:
+                self.far_duplication = self.conf["far_duplication"]
+        except KeyError:
+            print("No FAR duplication! Disabling mirroring.")
+
+        # Local switching between the UEs of 5G VN groups
+        try:
+            if self.conf["local_switching"]["enable"]:
+                self.local_switching = self.conf["local_switching"]
+        except KeyError:
+            print("No local switching! Hairpinning UE-to-UE traffic via N6.")
+
+        # ARP proxy for the UE addresses on the core interface
+        try:
+            self.neighbor_proxy = bool(self.conf["neighbor_proxy"]["enable"])
+        except KeyError:
+            print("No neighbor proxy! Routing the UE addresses to the UPF statically.")
+
+        # GTP-U endpoints of the network instances with an IP of their own
+        try:
+            for ni in self.conf["network_instances"]:
+                if "ip" in ni and ni["interface"] in self.gtpu_endpoints:
+                    self.gtpu_endpoints[ni["interface"]].append(ni["ip"])
+        except KeyError:
+            pass
+
         # Table sizes
         try:
             self.table_size_pdr_lookup = self.conf["table_sizes"]["pdrLookup"]
@@ -22,6 +22,11 @@ except ImportError:
 MAX_RETRIES = 5
 SLEEP_S = 2
 
+# Neighbor states (include/uapi/linux/neighbour.h)
+NUD_INCOMPLETE = 0x01
+NUD_STALE = 0x04
+NUD_FAILED = 0x20
+
 
 class NeighborEntry:
     def __init__(self):
@@ -32,6 +37,7 @@ class NeighborEntry:
         self.route_count = 0
         self.gate_idx = 0
         self.macstr = None
+        self.update_module = None
 
     def __str__(self):
         return ('{neigh: %s, iface: %s, ip-range: %s/%s}' %
@@ -43,7 +49,11 @@ def mac2hex(mac):
 
 
 def send_ping(neighbor_ip):
-    send(IP(dst=neighbor_ip) / ICMP())
+    if isinstance(ipaddress.ip_address(neighbor_ip), ipaddress.IPv6Address):
+        # Triggers neighbor discovery
+        send(IPv6(dst=neighbor_ip) / ICMPv6EchoRequest())
+    else:
+        send(IP(dst=neighbor_ip) / ICMP())
 
 
 def send_arp(neighbor_ip, src_mac, iface):
@@ -205,6 +215,7 @@ def link_route_module(server, gateway_mac, item):
 
         # Set the mac str
         item.macstr = gateway_mac_str
+        item.update_module = update_module
 
         # Increment global gate count number
         modgatecnt[route_module] += 1
@@ -216,6 +227,7 @@ def link_route_module(server, gateway_mac, item):
 
     # Finally increment route count
     neighborcache[item.neighbor_ip].route_count += 1
+    routecache[(item.iface, item.iprange, int(prefix_len))] = item.neighbor_ip
 
 
 def del_route_entry(server, item):
@@ -251,13 +263,14 @@ def del_route_entry(server, item):
 
         print('Route entry {}/{} deleted from {}'.format(
             iprange, prefix_len, route_module))
+        routecache.pop((item.iface, iprange, int(prefix_len)), None)
 
         # Decrementing route count for the registered neighbor
         neighbor_exists.route_count -= 1
 
         # If route count is 0, then delete the whole module
         if neighbor_exists.route_count == 0:
-            update_module = route_module + 'DstMAC' + neighbor_exists.macstr
+            update_module = neighbor_exists.update_module
             # Pause bess first
             bess.pause_all()
             for i in range(MAX_RETRIES):
@@ -291,6 +304,41 @@ def del_route_entry(server, item):
         print('Neighbor {} does not exist'.format(item.neighbor_ip))
 
 
+def update_neighbor_mac(server, neighbor, gateway_mac):
+    # Rewrite the destination MAC set by the Update module of the neighbor,
+    # e.g. after its address moved to another gateway
+    update_module = neighbor.update_module
+    print('Updating destination MAC of {} to {:X}'.format(
+        update_module, gateway_mac))
+
+    # Pause bess first
+    bess.pause_all()
+    for _ in range(MAX_RETRIES):
+        try:
+            server.run_module_command(update_module, 'clear',
+                                      'UpdateCommandClearArg', {})
+            server.run_module_command(update_module, 'add', 'UpdateArg', {
+                'fields': [{
+                    'offset': 0,
+                    'size': 6,
+                    'value': gateway_mac
+                }]
+            })
+        except:
+            print('Error updating module {}. Retrying in {}sec...'.format(
+                update_module, SLEEP_S))
+            time.sleep(SLEEP_S)
+        else:
+            bess.resume_all()
+            break
+    else:
+        bess.resume_all()
+        print('Module {} update failure.'.format(update_module))
+        return
+
+    neighbor.macstr = '{:X}'.format(gateway_mac)
+
+
 def probe_addr(item, src_mac):
     # Store entry if entry does not exist in ARP cache
     arpcache[item.neighbor_ip] = item
@@ -345,6 +393,21 @@ def parse_new_route(msg):
         del item
         return
 
+    # A route replaced with another gateway, e.g. on failover, is moved to it
+    key = (item.iface, item.iprange, int(item.prefix_len))
+    old_neighbor_ip = routecache.get(key)
+    if old_neighbor_ip == item.neighbor_ip:
+        return
+    if old_neighbor_ip:
+        old_item = NeighborEntry()
+        old_item.iface = item.iface
+        old_item.iprange = item.iprange
+        old_item.prefix_len = item.prefix_len
+        old_item.neighbor_ip = old_neighbor_ip
+        print('Route {}/{} moved from {} to {}'.format(
+            item.iprange, item.prefix_len, old_neighbor_ip, item.neighbor_ip))
+        del_route_entry(bess, old_item)
+
     # if mac is 0, send ARP request
     if gateway_mac == 0:
         print('Adding entry {} in arp probe table. Neighbor: {}'.format(item.iface,item.neighbor_ip))
@@ -358,6 +421,8 @@ def parse_new_route(msg):
 
 
 def parse_new_neighbor(msg):
+    neighbor_ip = None
+    gateway_mac = None
     for att in msg['attrs']:
         if 'NDA_DST' in att:
             # ('NDA_DST', neighbor_ip)
@@ -366,6 +431,19 @@ def parse_new_neighbor(msg):
             # ('NDA_LLADDR', neighbor_mac)
             gateway_mac = att[1]
 
+    neighbor = neighborcache.get(neighbor_ip)
+    if neighbor:
+        if msg['state'] & (NUD_FAILED | NUD_STALE) or not gateway_mac:
+            # Resolve the neighbor again, its new entry is handled here
+            print('Neighbor {} is unreachable, probing it'.format(neighbor_ip))
+            send_ping(neighbor_ip)
+        elif mac2hex(gateway_mac) != int(neighbor.macstr, 16):
+            update_neighbor_mac(bess, neighbor, mac2hex(gateway_mac))
+        return
+
+    if not gateway_mac or msg['state'] & (NUD_INCOMPLETE | NUD_FAILED):
+        return
+
     item = arpcache.get(neighbor_ip)
     if item:
         print('Linking module {}Routes with {}Merge (Dest MAC: {})'.format(
@@ -378,6 +456,17 @@ def parse_new_neighbor(msg):
         del arpcache[neighbor_ip]
 
 
+def parse_del_neighbor(msg):
+    for att in msg['attrs']:
+        if 'NDA_DST' in att:
+            # ('NDA_DST', neighbor_ip)
+            neighbor = neighborcache.get(att[1])
+            if neighbor:
+                # Keep the routes through the neighbor until it is resolved again
+                print('Neighbor {} deleted, probing it'.format(att[1]))
+                send_ping(att[1])
+
+
 def parse_del_route(msg):
     item = NeighborEntry()
     for att in msg['attrs']:
@@ -419,6 +508,9 @@ def netlink_event_listener(ipdb, netlink_message, action):
     if action == 'RTM_NEWNEIGH':
         parse_new_neighbor(msg)
 
+    if action == 'RTM_DELNEIGH':
+        parse_del_neighbor(msg)
+
     if action == 'RTM_DELROUTE':
         parse_del_route(msg)
 
@@ -465,6 +557,7 @@ def reconfigure(number, frame):
         item = modgatecnt.get(modname)
         del item
     modgatecnt.clear()
+    routecache.clear()
     bootstrap_routes()
     signal.pause()
 
@@ -476,13 +569,15 @@ def cleanup(number, frame):
 
 
 def main():
-    global arpcache, neighborcache, modgatecnt, ipdb, event_callback, bess, ipr
+    global arpcache, neighborcache, modgatecnt, routecache, ipdb, event_callback, bess, ipr
     # for holding unresolved ARP queries
     arpcache = {}
     # for holding list of registered neighbors
     neighborcache = {}
     # for holding gate count per route module
     modgatecnt = {}
+    # for holding the neighbor of each programmed route
+    routecache = {}
     # for interacting with kernel
     ipdb = IPDB()
     ipr = IPRoute()
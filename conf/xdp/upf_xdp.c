@@ -0,0 +1,544 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+/*
+ * XDP datapath of the UPF. The program is attached to both the access and the
+ * core interface. It decapsulates uplink GTP-U packets and encapsulates downlink
+ * packets according to the PDRs, FARs and QERs installed by the PFCP agent in
+ * the maps below, which are pinned under /sys/fs/bpf/upf.
+ *
+ * The ARP requests for the UE addresses in the neighbor_proxy map received on
+ * the core interface are answered with its MAC address.
+ *
+ * The layout of the map keys and values is shared with pfcpiface/xdp.go.
+ * Addresses, TEIDs and ports are in network byte order, other fields in host
+ * byte order.
+ */
+
+#include <linux/bpf.h>
+#include <linux/if_arp.h>
+#include <linux/if_ether.h>
+#include <linux/in.h>
+#include <linux/ip.h>
+#include <linux/udp.h>
+#include <bpf/bpf_endian.h>
+#include <bpf/bpf_helpers.h>
+
+#define GTPU_PORT 2152
+#define GTPU_MSG_GPDU 255
+#define GTPU_FLAGS_MASK 0x07
+#define GTPU_FLAG_E 0x04
+#define GTPU_VERSION_PT 0x30
+
+#define FAR_DROP 0
+#define FAR_FORWARD 1
+#define FAR_BUFFER 2
+
+#define MAX_QERS 2
+#define MAX_MAP_ENTRIES 65536
+#define NSEC_PER_SEC 1000000000ULL
+
+struct gtpuhdr {
+	__u8 flags;
+	__u8 type;
+	__be16 length;
+	__be32 teid;
+} __attribute__((packed));
+
+struct pdr_ul_key {
+	__be32 tunnel_dst;
+	__be32 teid;
+};
+
+struct pdr_dl_key {
+	__be32 ue_addr;
+};
+
+struct pdr_info {
+	__u64 fseid;
+	__u32 pdr_id;
+	__u32 far_id;
+	__u32 qer_ids[MAX_QERS];
+};
+
+struct far_key {
+	__u64 fseid;
+	__u32 far_id;
+	__u32 pad;
+};
+
+struct far_info {
+	__u8 action;
+	__u8 encap;
+	__be16 tunnel_port;
+	__be32 tunnel_src;
+	__be32 tunnel_dst;
+	__be32 teid;
+};
+
+struct qer_key {
+	__u64 fseid;
+	__u32 qer_id;
+	__u32 pad;
+};
+
+/* Token bucket of one direction of a QER. rate is in bytes/s, 0 if unmetered. */
+struct bucket {
+	__u8 gate_closed;
+	__u8 pad[7];
+	__u64 rate;
+	__u64 burst;
+	__u64 tokens;
+	__u64 last_ns;
+};
+
+struct qer_info {
+	struct bpf_spin_lock lock;
+	__u32 pad;
+	struct bucket ul;
+	struct bucket dl;
+};
+
+struct counter_key {
+	__u64 fseid;
+	__u32 pdr_id;
+	__u32 pad;
+};
+
+struct counter {
+	__u64 packets;
+	__u64 bytes;
+};
+
+/* ARP request for an IPv4 address over Ethernet. */
+struct arp_ipv4 {
+	struct arphdr hdr;
+	__u8 sha[ETH_ALEN];
+	__be32 sip;
+	__u8 tha[ETH_ALEN];
+	__be32 tip;
+} __attribute__((packed));
+
+struct neighbor_key {
+	__be32 ue_addr;
+};
+
+/* Core interface answering the ARP requests for the UE address, and its MAC. */
+struct neighbor_info {
+	__u32 ifindex;
+	__u8 mac[ETH_ALEN];
+	__u16 pad;
+};
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, MAX_MAP_ENTRIES);
+	__type(key, struct pdr_ul_key);
+	__type(value, struct pdr_info);
+	__uint(pinning, LIBBPF_PIN_BY_NAME);
+} pdrs_ul SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, MAX_MAP_ENTRIES);
+	__type(key, struct pdr_dl_key);
+	__type(value, struct pdr_info);
+	__uint(pinning, LIBBPF_PIN_BY_NAME);
+} pdrs_dl SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, MAX_MAP_ENTRIES);
+	__type(key, struct far_key);
+	__type(value, struct far_info);
+	__uint(pinning, LIBBPF_PIN_BY_NAME);
+} fars SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, MAX_MAP_ENTRIES);
+	__type(key, struct qer_key);
+	__type(value, struct qer_info);
+	__uint(pinning, LIBBPF_PIN_BY_NAME);
+} qers SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, MAX_MAP_ENTRIES);
+	__type(key, struct counter_key);
+	__type(value, struct counter);
+	__uint(pinning, LIBBPF_PIN_BY_NAME);
+} pdr_counters SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, MAX_MAP_ENTRIES);
+	__type(key, struct neighbor_key);
+	__type(value, struct neighbor_info);
+	__uint(pinning, LIBBPF_PIN_BY_NAME);
+} neighbor_proxy SEC(".maps");
+
+static __always_inline __u16 csum_fold(__u32 csum)
+{
+	csum = (csum & 0xffff) + (csum >> 16);
+	csum = (csum & 0xffff) + (csum >> 16);
+	return (__u16)~csum;
+}
+
+static __always_inline void ipv4_csum(struct iphdr *iph)
+{
+	__u32 csum = 0;
+	__u16 *p = (__u16 *)iph;
+
+	iph->check = 0;
+#pragma unroll
+	for (int i = 0; i < (int)sizeof(*iph) >> 1; i++)
+		csum += *p++;
+
+	iph->check = csum_fold(csum);
+}
+
+/* Returns 0 if the packet conforms to the bucket, -1 if it must be dropped. */
+static __always_inline int bucket_consume(struct bucket *b, __u64 len, __u64 now)
+{
+	__u64 elapsed;
+
+	if (b->gate_closed)
+		return -1;
+
+	if (!b->rate)
+		return 0;
+
+	elapsed = now - b->last_ns;
+	b->last_ns = now;
+	if (elapsed >= NSEC_PER_SEC)
+		b->tokens = b->burst;
+	else
+		b->tokens += elapsed * b->rate / NSEC_PER_SEC;
+
+	if (b->tokens > b->burst)
+		b->tokens = b->burst;
+
+	if (b->tokens < len)
+		return -1;
+
+	b->tokens -= len;
+	return 0;
+}
+
+static __always_inline int apply_qers(struct pdr_info *pdr, __u64 len, int uplink)
+{
+	__u64 now = bpf_ktime_get_ns();
+
+#pragma unroll
+	for (int i = 0; i < MAX_QERS; i++) {
+		struct qer_key key = {.fseid = pdr->fseid, .qer_id = pdr->qer_ids[i]};
+		struct qer_info *qer;
+		int ret;
+
+		if (!pdr->qer_ids[i])
+			continue;
+
+		qer = bpf_map_lookup_elem(&qers, &key);
+		if (!qer)
+			continue;
+
+		bpf_spin_lock(&qer->lock);
+		ret = bucket_consume(uplink ? &qer->ul : &qer->dl, len, now);
+		bpf_spin_unlock(&qer->lock);
+
+		if (ret)
+			return -1;
+	}
+
+	return 0;
+}
+
+static __always_inline void count(struct pdr_info *pdr, __u64 len)
+{
+	struct counter_key key = {.fseid = pdr->fseid, .pdr_id = pdr->pdr_id};
+	struct counter *ctr, init = {};
+
+	ctr = bpf_map_lookup_elem(&pdr_counters, &key);
+	if (!ctr) {
+		bpf_map_update_elem(&pdr_counters, &key, &init, BPF_NOEXIST);
+		ctr = bpf_map_lookup_elem(&pdr_counters, &key);
+		if (!ctr)
+			return;
+	}
+
+	__sync_fetch_and_add(&ctr->packets, 1);
+	__sync_fetch_and_add(&ctr->bytes, len);
+}
+
+/* Routes the IPv4 packet at the start of the frame and sends it out. */
+static __always_inline int redirect(struct xdp_md *ctx)
+{
+	void *data = (void *)(long)ctx->data;
+	void *data_end = (void *)(long)ctx->data_end;
+	struct ethhdr *eth = data;
+	struct iphdr *iph = data + sizeof(*eth);
+	struct bpf_fib_lookup fib = {};
+	int rc;
+
+	if ((void *)(iph + 1) > data_end)
+		return XDP_DROP;
+
+	fib.family = 2; /* AF_INET */
+	fib.tos = iph->tos;
+	fib.l4_protocol = iph->protocol;
+	fib.tot_len = bpf_ntohs(iph->tot_len);
+	fib.ipv4_src = iph->saddr;
+	fib.ipv4_dst = iph->daddr;
+	fib.ifindex = ctx->ingress_ifindex;
+
+	rc = bpf_fib_lookup(ctx, &fib, sizeof(fib), 0);
+	if (rc != BPF_FIB_LKUP_RET_SUCCESS)
+		/* Let the kernel resolve the neighbour, or route it. */
+		return XDP_PASS;
+
+	__builtin_memcpy(eth->h_dest, fib.dmac, ETH_ALEN);
+	__builtin_memcpy(eth->h_source, fib.smac, ETH_ALEN);
+	eth->h_proto = bpf_htons(ETH_P_IP);
+
+	return bpf_redirect(fib.ifindex, 0);
+}
+
+/* Returns the length of the GTP-U header, including its extension headers. */
+static __always_inline int gtpu_hdr_len(struct gtpuhdr *gtpu, void *data_end)
+{
+	__u8 *p, next;
+	int len = sizeof(*gtpu);
+
+	if (!(gtpu->flags & GTPU_FLAGS_MASK))
+		return len;
+
+	len += 4;
+	p = (__u8 *)gtpu + len;
+	if ((void *)p > data_end)
+		return -1;
+
+	if (!(gtpu->flags & GTPU_FLAG_E))
+		return len;
+
+	next = *(p - 1);
+
+#pragma unroll
+	for (int i = 0; i < 2 && next; i++) {
+		__u8 ext_len;
+
+		if ((void *)(p + 1) > data_end)
+			return -1;
+
+		ext_len = *p * 4;
+		if (!ext_len || (void *)(p + ext_len) > data_end)
+			return -1;
+
+		next = *(p + ext_len - 1);
+		p += ext_len;
+		len += ext_len;
+	}
+
+	return next ? -1 : len;
+}
+
+static __always_inline int handle_uplink(struct xdp_md *ctx, struct iphdr *iph,
+					 struct gtpuhdr *gtpu)
+{
+	void *data, *data_end = (void *)(long)ctx->data_end;
+	struct pdr_ul_key key = {.tunnel_dst = iph->daddr, .teid = gtpu->teid};
+	struct pdr_info *pdr;
+	struct far_key fkey = {};
+	struct far_info *far;
+	struct ethhdr eth;
+	int hlen;
+	__u64 len;
+
+	pdr = bpf_map_lookup_elem(&pdrs_ul, &key);
+	if (!pdr)
+		return XDP_PASS;
+
+	fkey.fseid = pdr->fseid;
+	fkey.far_id = pdr->far_id;
+	far = bpf_map_lookup_elem(&fars, &fkey);
+	if (!far || far->action != FAR_FORWARD)
+		return XDP_DROP;
+
+	hlen = gtpu_hdr_len(gtpu, data_end);
+	if (hlen < 0)
+		return XDP_DROP;
+
+	len = (__u64)(ctx->data_end - ctx->data);
+
+	if (apply_qers(pdr, len, 1))
+		return XDP_DROP;
+
+	count(pdr, len);
+
+	/* Strip the outer IPv4, UDP and GTP-U headers, keeping the Ethernet header. */
+	data = (void *)(long)ctx->data;
+	if (data + sizeof(eth) > data_end)
+		return XDP_DROP;
+
+	__builtin_memcpy(&eth, data, sizeof(eth));
+	if (bpf_xdp_adjust_head(ctx, (int)(sizeof(*iph) + sizeof(struct udphdr)) + hlen))
+		return XDP_DROP;
+
+	data = (void *)(long)ctx->data;
+	if (data + sizeof(eth) > (void *)(long)ctx->data_end)
+		return XDP_DROP;
+
+	__builtin_memcpy(data, &eth, sizeof(eth));
+
+	return redirect(ctx);
+}
+
+static __always_inline int handle_downlink(struct xdp_md *ctx, struct iphdr *iph)
+{
+	struct pdr_dl_key key = {.ue_addr = iph->daddr};
+	struct pdr_info *pdr;
+	struct far_key fkey = {};
+	struct far_info *far;
+	void *data, *data_end;
+	struct ethhdr *eth;
+	struct iphdr *outer;
+	struct udphdr *udp;
+	struct gtpuhdr *gtpu;
+	__u16 inner_len;
+	__u64 len;
+
+	pdr = bpf_map_lookup_elem(&pdrs_dl, &key);
+	if (!pdr)
+		return XDP_PASS;
+
+	fkey.fseid = pdr->fseid;
+	fkey.far_id = pdr->far_id;
+	far = bpf_map_lookup_elem(&fars, &fkey);
+	if (!far || far->action != FAR_FORWARD || !far->encap)
+		return XDP_DROP;
+
+	inner_len = bpf_ntohs(iph->tot_len);
+	len = (__u64)(ctx->data_end - ctx->data);
+
+	if (apply_qers(pdr, len, 0))
+		return XDP_DROP;
+
+	count(pdr, len);
+
+	if (bpf_xdp_adjust_head(ctx, -(int)(sizeof(*outer) + sizeof(*udp) + sizeof(*gtpu))))
+		return XDP_DROP;
+
+	data = (void *)(long)ctx->data;
+	data_end = (void *)(long)ctx->data_end;
+	eth = data;
+	outer = data + sizeof(*eth);
+	udp = (void *)(outer + 1);
+	gtpu = (void *)(udp + 1);
+
+	if ((void *)(gtpu + 1) > data_end)
+		return XDP_DROP;
+
+	outer->version = 4;
+	outer->ihl = sizeof(*outer) >> 2;
+	outer->tos = 0;
+	outer->tot_len = bpf_htons(inner_len + sizeof(*outer) + sizeof(*udp) + sizeof(*gtpu));
+	outer->id = 0;
+	outer->frag_off = 0;
+	outer->ttl = 64;
+	outer->protocol = IPPROTO_UDP;
+	outer->saddr = far->tunnel_src;
+	outer->daddr = far->tunnel_dst;
+	ipv4_csum(outer);
+
+	udp->source = bpf_htons(GTPU_PORT);
+	udp->dest = far->tunnel_port ? far->tunnel_port : bpf_htons(GTPU_PORT);
+	udp->len = bpf_htons(inner_len + sizeof(*udp) + sizeof(*gtpu));
+	udp->check = 0;
+
+	gtpu->flags = GTPU_VERSION_PT;
+	gtpu->type = GTPU_MSG_GPDU;
+	gtpu->length = bpf_htons(inner_len);
+	gtpu->teid = far->teid;
+
+	return redirect(ctx);
+}
+
+/* Answers the ARP requests for the proxied UE addresses received on the core interface. */
+static __always_inline int handle_arp(struct xdp_md *ctx, struct ethhdr *eth)
+{
+	void *data_end = (void *)(long)ctx->data_end;
+	struct arp_ipv4 *arp = (void *)(eth + 1);
+	struct neighbor_info *n;
+	struct neighbor_key key;
+
+	if ((void *)(arp + 1) > data_end)
+		return XDP_PASS;
+
+	if (arp->hdr.ar_hrd != bpf_htons(ARPHRD_ETHER) ||
+	    arp->hdr.ar_pro != bpf_htons(ETH_P_IP) ||
+	    arp->hdr.ar_hln != ETH_ALEN || arp->hdr.ar_pln != 4 ||
+	    arp->hdr.ar_op != bpf_htons(ARPOP_REQUEST))
+		return XDP_PASS;
+
+	key.ue_addr = arp->tip;
+	n = bpf_map_lookup_elem(&neighbor_proxy, &key);
+	if (!n || n->ifindex != ctx->ingress_ifindex)
+		return XDP_PASS;
+
+	arp->hdr.ar_op = bpf_htons(ARPOP_REPLY);
+	__builtin_memcpy(arp->tha, arp->sha, ETH_ALEN);
+	arp->tip = arp->sip;
+	__builtin_memcpy(arp->sha, n->mac, ETH_ALEN);
+	arp->sip = key.ue_addr;
+
+	__builtin_memcpy(eth->h_dest, eth->h_source, ETH_ALEN);
+	__builtin_memcpy(eth->h_source, n->mac, ETH_ALEN);
+
+	return XDP_TX;
+}
+
+SEC("xdp")
+int upf_xdp(struct xdp_md *ctx)
+{
+	void *data = (void *)(long)ctx->data;
+	void *data_end = (void *)(long)ctx->data_end;
+	struct ethhdr *eth = data;
+	struct iphdr *iph;
+	struct udphdr *udp;
+	struct gtpuhdr *gtpu;
+
+	if ((void *)(eth + 1) > data_end)
+		return XDP_PASS;
+
+	if (eth->h_proto == bpf_htons(ETH_P_ARP))
+		return handle_arp(ctx, eth);
+
+	if (eth->h_proto != bpf_htons(ETH_P_IP))
+		return XDP_PASS;
+
+	iph = (void *)(eth + 1);
+	if ((void *)(iph + 1) > data_end || iph->ihl != 5)
+		return XDP_PASS;
+
+	if (iph->protocol == IPPROTO_UDP) {
+		udp = (void *)(iph + 1);
+		if ((void *)(udp + 1) > data_end)
+			return XDP_PASS;
+
+		if (udp->dest == bpf_htons(GTPU_PORT)) {
+			gtpu = (void *)(udp + 1);
+			if ((void *)(gtpu + 1) > data_end)
+				return XDP_PASS;
+
+			/* Echo, Error Indication and End Marker go to the kernel stack. */
+			if (gtpu->type != GTPU_MSG_GPDU)
+				return XDP_PASS;
+
+			return handle_uplink(ctx, iph, gtpu);
+		}
+	}
+
+	return handle_downlink(ctx, iph);
+}
+
+char _license[] SEC("license") = "Dual BSD/GPL";
@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sessionSummary is a session as listed by GET /v1/sessions.
+type sessionSummary struct {
+	NodeID     string    `json:"node_id"`
+	LocalSEID  uint64    `json:"local_seid"`
+	RemoteSEID uint64    `json:"remote_seid"`
+	UEIPs      []string  `json:"ue_ips"`
+	PDRs       int       `json:"pdrs"`
+	FARs       int       `json:"fars"`
+	QERs       int       `json:"qers"`
+	URRs       int       `json:"urrs"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func newSessionSummary(nodeID string, s PFCPSession) sessionSummary {
+	summary := sessionSummary{
+		NodeID:     nodeID,
+		LocalSEID:  s.localSEID,
+		RemoteSEID: s.remoteSEID,
+		UEIPs:      make([]string, 0),
+		PDRs:       len(s.pdrs),
+		FARs:       len(s.fars),
+		QERs:       len(s.qers),
+		URRs:       len(s.urrs),
+	}
+
+	if s.metrics != nil {
+		summary.CreatedAt = s.metrics.CreatedAt
+	}
+
+	seen := make(map[uint32]bool)
+
+	for _, p := range s.pdrs {
+		if p.ueAddress == 0 || seen[p.ueAddress] {
+			continue
+		}
+
+		seen[p.ueAddress] = true
+
+		summary.UEIPs = append(summary.UEIPs, int2ip(p.ueAddress).String())
+	}
+
+	return summary
+}
+
+// sessionsHandler lists the sessions of all the CP nodes, or of one:
+//
+//	GET /v1/sessions[?node=<node ID>]
+type sessionsHandler struct {
+	node *PFCPNode
+}
+
+func (h *sessionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	nodeID := r.URL.Query().Get("node")
+	sessions := make([]sessionSummary, 0)
+
+	h.node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+		if nodeID != "" && pConn.nodeID.remote != nodeID {
+			return true
+		}
+
+		for _, s := range pConn.store.GetAllSessions() {
+			sessions = append(sessions, newSessionSummary(pConn.nodeID.remote, s))
+		}
+
+		return true
+	})
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LocalSEID < sessions[j].LocalSEID })
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(sessions); err != nil {
+		log.Errorln("Failed to encode sessions:", err)
+	}
+}
+
+// associationStatus is the association with a CP node as reported by
+// GET /v1/associations.
+type associationStatus struct {
+	NodeID string    `json:"node_id"`
+	Up     bool      `json:"up"`
+	Since  time.Time `json:"since"`
+	// RecoveryTimeStamp is the last Recovery Time Stamp advertised by the CP node.
+	RecoveryTimeStamp time.Time `json:"recovery_time_stamp"`
+	Restarts          uint64    `json:"restarts"`
+	Sessions          int       `json:"sessions"`
+}
+
+// associationsHandler reports the association with each CP node:
+//
+//	GET /v1/associations
+type associationsHandler struct {
+	node *PFCPNode
+}
+
+func (h *associationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessions := make(map[string]int)
+
+	h.node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+		sessions[pConn.nodeID.remote] += len(pConn.store.GetAllSessions())
+
+		return true
+	})
+
+	associations := make([]associationStatus, 0)
+
+	for peer, s := range h.node.upf.associations.snapshot() {
+		associations = append(associations, associationStatus{
+			NodeID:            peer,
+			Up:                s.up,
+			Since:             s.since,
+			RecoveryTimeStamp: s.recoveryTS,
+			Restarts:          s.restarts,
+			Sessions:          sessions[peer],
+		})
+	}
+
+	sort.Slice(associations, func(i, j int) bool { return associations[i].NodeID < associations[j].NodeID })
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(associations); err != nil {
+		log.Errorln("Failed to encode associations:", err)
+	}
+}
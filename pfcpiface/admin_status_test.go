@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/omec-project/upf-epc/pfcpiface/metrics"
+)
+
+func newAdminStatusNode(t *testing.T) *PFCPNode {
+	u := &upf{associations: newAssociationStats()}
+	node := &PFCPNode{upf: u}
+
+	for i, peer := range []string{"smf1", "smf2"} {
+		pConn := &PFCPConn{store: NewInMemoryStore(), nodeID: nodeID{remote: peer}}
+
+		seid := uint64(i + 1)
+		session := PFCPSession{
+			localSEID:  seid,
+			remoteSEID: seid * 10,
+			metrics:    metrics.NewSession(peer),
+			PacketForwardingRules: PacketForwardingRules{
+				pdrs: []pdr{
+					{fseID: seid, pdrID: 1, ueAddress: ip2int(net.IPv4(10, 250, 0, byte(seid)))},
+					{fseID: seid, pdrID: 2, ueAddress: ip2int(net.IPv4(10, 250, 0, byte(seid)))},
+				},
+				fars: []far{{fseID: seid, farID: 1}},
+			},
+		}
+		require.NoError(t, pConn.store.PutSession(session, nil, false, 0))
+
+		node.pConns.Store(peer, pConn)
+		u.associations.up(peer, time.Unix(1000, 0))
+	}
+
+	u.associations.down("smf2")
+
+	return node
+}
+
+func TestSessionsHandler(t *testing.T) {
+	handler := &sessionsHandler{node: newAdminStatusNode(t)}
+
+	list := func(target string) []sessionSummary {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var sessions []sessionSummary
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&sessions))
+
+		return sessions
+	}
+
+	sessions := list("/v1/sessions")
+	require.Len(t, sessions, 2)
+	require.Equal(t, "smf1", sessions[0].NodeID)
+	require.Equal(t, uint64(10), sessions[0].RemoteSEID)
+	require.Equal(t, []string{"10.250.0.1"}, sessions[0].UEIPs)
+	require.Equal(t, 2, sessions[0].PDRs)
+	require.Equal(t, 1, sessions[0].FARs)
+	require.False(t, sessions[0].CreatedAt.IsZero())
+
+	sessions = list("/v1/sessions?node=smf2")
+	require.Len(t, sessions, 1)
+	require.Equal(t, uint64(2), sessions[0].LocalSEID)
+
+	require.Empty(t, list("/v1/sessions?node=smf3"))
+}
+
+func TestAssociationsHandler(t *testing.T) {
+	handler := &associationsHandler{node: newAdminStatusNode(t)}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/associations", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var associations []associationStatus
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&associations))
+	require.Len(t, associations, 2)
+
+	require.Equal(t, "smf1", associations[0].NodeID)
+	require.True(t, associations[0].Up)
+	require.Equal(t, 1, associations[0].Sessions)
+	require.True(t, associations[0].RecoveryTimeStamp.Equal(time.Unix(1000, 0)))
+
+	require.Equal(t, "smf2", associations[1].NodeID)
+	require.False(t, associations[1].Up)
+}
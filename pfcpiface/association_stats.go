@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"sync"
+	"time"
+)
+
+// associationStats tracks the state of the association with each CP node, by node
+// ID, across the connections to it, for the association gauges.
+type associationStats struct {
+	mu    sync.Mutex
+	peers map[string]*associationState
+}
+
+type associationState struct {
+	up    bool
+	since time.Time
+	// recoveryTS is the last Recovery Time Stamp advertised by the CP node.
+	recoveryTS time.Time
+	// restarts counts the newer Recovery Time Stamps advertised.
+	restarts uint64
+}
+
+func newAssociationStats() *associationStats {
+	return &associationStats{peers: make(map[string]*associationState)}
+}
+
+func (a *associationStats) state(peer string) *associationState {
+	s, ok := a.peers[peer]
+	if !ok {
+		s = &associationState{}
+		a.peers[peer] = s
+	}
+
+	return s
+}
+
+// up records the association set up with peer, which advertised ts.
+func (a *associationStats) up(peer string, ts time.Time) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s := a.state(peer)
+	if !s.up {
+		s.up, s.since = true, time.Now()
+	}
+
+	s.observe(ts)
+}
+
+// down records the association with peer released or lost.
+func (a *associationStats) down(peer string) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if s, ok := a.peers[peer]; ok {
+		s.up, s.since = false, time.Now()
+	}
+}
+
+// recovery records the Recovery Time Stamp ts advertised by peer.
+func (a *associationStats) recovery(peer string, ts time.Time) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.state(peer).observe(ts)
+}
+
+// observe counts a restart if ts is newer than the Recovery Time Stamp known.
+func (s *associationState) observe(ts time.Time) {
+	if !s.recoveryTS.IsZero() && ts.After(s.recoveryTS) {
+		s.restarts++
+	}
+
+	if ts.After(s.recoveryTS) {
+		s.recoveryTS = ts
+	}
+}
+
+// snapshot returns a copy of the state of each CP node.
+func (a *associationStats) snapshot() map[string]associationState {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	peers := make(map[string]associationState, len(a.peers))
+	for peer, s := range a.peers {
+		peers[peer] = *s
+	}
+
+	return peers
+}
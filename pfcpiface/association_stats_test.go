@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_associationStats(t *testing.T) {
+	a := newAssociationStats()
+	ts := time.Unix(1700000000, 0)
+
+	a.up("smf1", ts)
+	a.recovery("smf1", ts)
+	a.down("smf1")
+	a.up("smf1", ts.Add(time.Minute))
+	a.recovery("smf1", ts.Add(time.Hour))
+	a.recovery("smf1", ts.Add(time.Hour))
+	a.up("smf2", ts)
+	a.down("smf2")
+	a.down("smf3")
+
+	peers := a.snapshot()
+	require.Len(t, peers, 2, "peers never associated are not tracked")
+
+	require.True(t, peers["smf1"].up)
+	require.Equal(t, ts.Add(time.Hour), peers["smf1"].recoveryTS)
+	require.Equal(t, uint64(2), peers["smf1"].restarts)
+
+	require.False(t, peers["smf2"].up)
+	require.Zero(t, peers["smf2"].restarts)
+
+	var disabled *associationStats
+	disabled.up("smf1", ts)
+	require.Nil(t, disabled.snapshot())
+}
+
+func TestPfcpNodeCollector_associationStats(t *testing.T) {
+	u := &upf{associations: newAssociationStats()}
+	u.associations.up("smf1", time.Unix(1700000000, 0))
+	u.associations.up("smf2", time.Unix(1700000000, 0))
+	u.associations.down("smf2")
+
+	ch := make(chan prometheus.Metric, 10)
+	NewPFCPNodeCollector(&PFCPNode{upf: u}).associationStats(ch)
+	close(ch)
+
+	values := make(map[string]map[string]float64)
+
+	for m := range ch {
+		var metric dto.Metric
+		require.NoError(t, m.Write(&metric))
+
+		name := m.Desc().String()
+		peer := metric.GetLabel()[0].GetValue()
+
+		if values[peer] == nil {
+			values[peer] = make(map[string]float64)
+		}
+
+		values[peer][name] = metric.GetGauge().GetValue() + metric.GetCounter().GetValue()
+	}
+
+	require.Len(t, values, 2)
+	require.Len(t, values["smf1"], 4)
+
+	col := NewPFCPNodeCollector(&PFCPNode{upf: u})
+	require.Equal(t, 1.0, values["smf1"][col.associationUp.String()])
+	require.Equal(t, 0.0, values["smf2"][col.associationUp.String()])
+	require.Equal(t, 0.0, values["smf2"][col.associationUptime.String()])
+	require.Equal(t, 1700000000.0, values["smf2"][col.peerRecoveryTS.String()])
+}
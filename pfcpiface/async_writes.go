@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+const (
+	// asyncWriteFailureReport asks the CP node to release a session whose rules
+	// could not be written, with a Session Report Request.
+	asyncWriteFailureReport = "report"
+	// asyncWriteFailureTeardown also removes the session locally before reporting it.
+	asyncWriteFailureTeardown = "teardown"
+
+	asyncWriteQueueSize = 1024
+)
+
+// datapathWrite is a write of the rules of a session to the datapath.
+type datapathWrite struct {
+	fseid   uint64
+	method  upfMsgType
+	all     PacketForwardingRules
+	updated PacketForwardingRules
+	// batch writes the rules with sendSessionRules instead of SendMsgToUPF.
+	batch bool
+	// inPlace first tries to update the FARs and QERs of updated alone, see
+	// updatableInPlace.
+	inPlace bool
+	// onSuccess runs once the rules are written, e.g. to send end markers.
+	onSuccess func()
+}
+
+func (w datapathWrite) send(u *upf) uint8 {
+	if w.inPlace {
+		err := u.updateRulesInPlace(w.all, w.updated)
+		if err == nil {
+			return ie.CauseRequestAccepted
+		}
+
+		if !errors.Is(err, errUnsupported) {
+			log.Errorln("Failed to update rules in place:", err)
+			return ie.CauseRequestRejected
+		}
+	}
+
+	if w.batch {
+		return u.sendSessionRules(w.method, w.all, w.updated)
+	}
+
+	return u.SendMsgToUPF(w.method, w.all, w.updated)
+}
+
+// clone copies the rules, so that the session can be modified while a write is queued.
+func (r PacketForwardingRules) clone() PacketForwardingRules {
+	return PacketForwardingRules{
+		pdrs: append([]pdr(nil), r.pdrs...),
+		fars: append([]far(nil), r.fars...),
+		qers: append([]qer(nil), r.qers...),
+		urrs: append([]urr(nil), r.urrs...),
+		bars: append([]bar(nil), r.bars...),
+	}
+}
+
+// datapathWriter writes the rules of the sessions of a PFCP connection in the
+// background, in the order the writes were queued.
+type datapathWriter struct {
+	pConn *PFCPConn
+	queue chan datapathWrite
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func newDatapathWriter(pConn *PFCPConn) *datapathWriter {
+	return &datapathWriter{
+		pConn: pConn,
+		queue: make(chan datapathWrite, asyncWriteQueueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+func (w *datapathWriter) run() {
+	defer close(w.done)
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case op := <-w.queue:
+			if cause := op.send(w.pConn.upf); cause != ie.CauseRequestAccepted {
+				w.pConn.handleAsyncWriteFailure(op)
+				continue
+			}
+
+			if op.onSuccess != nil {
+				op.onSuccess()
+			}
+		}
+	}
+}
+
+// enqueue queues op, blocking while the queue is full. It returns false once the
+// writer is closed.
+func (w *datapathWriter) enqueue(op datapathWrite) bool {
+	select {
+	case <-w.stop:
+		return false
+	case w.queue <- op:
+		return true
+	}
+}
+
+// close stops the writer once the write in progress, if any, completes. Queued
+// writes are dropped.
+func (w *datapathWriter) close() {
+	close(w.stop)
+	<-w.done
+}
+
+// writeRules writes the rules of a session to the datapath. With asynchronous writes
+// enabled, the write is queued behind the previous ones of the connection and accepted
+// right away, failures being handled by handleAsyncWriteFailure.
+func (pConn *PFCPConn) writeRules(op datapathWrite) uint8 {
+	if pConn.writer == nil {
+		cause := op.send(pConn.upf)
+		if cause == ie.CauseRequestAccepted && op.onSuccess != nil {
+			op.onSuccess()
+		}
+
+		return cause
+	}
+
+	op.all = op.all.clone()
+	op.updated = op.updated.clone()
+
+	if !pConn.writer.enqueue(op) {
+		return ie.CauseRequestRejected
+	}
+
+	return ie.CauseRequestAccepted
+}
+
+// handleAsyncWriteFailure reacts to a write that failed after the PFCP request was
+// accepted: the CP node is asked to release the session, which is also removed
+// locally with the teardown action.
+func (pConn *PFCPConn) handleAsyncWriteFailure(op datapathWrite) {
+	upf := pConn.upf
+
+	logger := log.WithFields(log.Fields{
+		"F-SEID":  op.fseid,
+		"method":  op.method,
+		"CP node": pConn.nodeID.remote,
+	})
+
+	session, ok := pConn.store.GetSession(op.fseid)
+	if !ok {
+		logger.Error("Failed to write rules of a removed session to datapath")
+		return
+	}
+
+	logger.Error("Failed to write rules of an accepted session to datapath")
+
+	if upf.asyncWriteFailure == asyncWriteFailureTeardown {
+		if cause := upf.SendMsgToUPF(upfMsgTypeDel, session.PacketForwardingRules, PacketForwardingRules{}); cause == ie.CauseRequestRejected {
+			logger.Error("Failed to delete rules of the session from datapath")
+		}
+
+		if upf.ipam != nil {
+			if err := releaseAllocatedIPs(upf.ipam, &session); err != nil {
+				logger.Warnln("Failed to release UE IP of session:", err)
+			}
+		}
+
+		pConn.RemoveSession(session)
+	}
+
+	pConn.sendReleaseRequestReport(session)
+}
+
+// sendReleaseRequestReport asks the CP node to release the session, with a Session
+// Report Request of type UPIR.
+func (pConn *PFCPConn) sendReleaseRequestReport(session PFCPSession) {
+	srreq := message.NewSessionReportRequest(0, /* MO?? <-- what's this */
+		0,                            /* FO <-- what's this? */
+		session.remoteSEID,           /* seid */
+		pConn.getSeqNum(),            /* seq # */
+		0,                            /* priority */
+		ie.NewReportType(1, 0, 0, 0), /*upir, erir, usar, dldr int*/
+	)
+
+	log.WithFields(log.Fields{
+		"F-SEID": session.localSEID,
+	}).Info("Requesting CP node to release session")
+
+	pConn.SendPFCPMsg(srreq)
+}
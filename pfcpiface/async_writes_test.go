@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omec-project/upf-epc/pfcpiface/metrics"
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+type asyncWriteDatapath struct {
+	datapath
+	mu       sync.Mutex
+	rejected uint64
+	writes   []upfMsgType
+	pdrs     [][]pdr
+}
+
+func (d *asyncWriteDatapath) WriteSessionBatch(method upfMsgType, all, updated PacketForwardingRules) error {
+	return ErrUnsupported("batched rules", "test")
+}
+
+func (d *asyncWriteDatapath) SendMsgToUPF(method upfMsgType, all, updated PacketForwardingRules) uint8 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.writes = append(d.writes, method)
+	d.pdrs = append(d.pdrs, updated.pdrs)
+
+	if method != upfMsgTypeDel && all.pdrs[0].fseID == d.rejected {
+		return ie.CauseRequestRejected
+	}
+
+	return ie.CauseRequestAccepted
+}
+
+func (d *asyncWriteDatapath) written() []upfMsgType {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]upfMsgType(nil), d.writes...)
+}
+
+type asyncWriteMetrics struct {
+	metrics.InstrumentPFCP
+}
+
+func (m *asyncWriteMetrics) SaveMessages(msg *metrics.Message) {}
+
+func (m *asyncWriteMetrics) SaveSessions(sess *metrics.Session) {}
+
+// newAsyncWriteConn returns a connection with asynchronous writes towards a CP node
+// listening on the returned socket.
+func newAsyncWriteConn(t *testing.T, u *upf) (*PFCPConn, *net.UDPConn) {
+	cp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { cp.Close() })
+
+	conn, err := net.Dial("udp", cp.LocalAddr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	u.asyncWrites = true
+	u.usageWheel = newTimerWheel()
+
+	pConn := &PFCPConn{
+		Conn:           conn,
+		upf:            u,
+		store:          NewInMemoryStore(),
+		usage:          newUsageTracker(),
+		ddn:            newDDNThrottle(),
+		teids:          newTEIDIndex(),
+		InstrumentPFCP: &asyncWriteMetrics{},
+	}
+	pConn.writer = newDatapathWriter(pConn)
+
+	go pConn.writer.run()
+	t.Cleanup(pConn.writer.close)
+
+	return pConn, cp
+}
+
+func TestPFCPConn_writeRules(t *testing.T) {
+	t.Run("synchronous without writer", func(t *testing.T) {
+		dp := &asyncWriteDatapath{rejected: 1}
+		pConn := &PFCPConn{upf: &upf{datapath: dp}}
+
+		cause := pConn.writeRules(datapathWrite{
+			fseid:  1,
+			method: upfMsgTypeAdd,
+			all:    PacketForwardingRules{pdrs: []pdr{{fseID: 1}}},
+			batch:  true,
+		})
+		require.Equal(t, ie.CauseRequestRejected, cause)
+		require.Equal(t, []upfMsgType{upfMsgTypeAdd}, dp.written())
+	})
+
+	t.Run("queued writes keep their order and rules", func(t *testing.T) {
+		dp := &asyncWriteDatapath{}
+		pConn, _ := newAsyncWriteConn(t, &upf{datapath: dp})
+
+		rules := PacketForwardingRules{pdrs: []pdr{{fseID: 1, pdrID: 1}}}
+		succeeded := make(chan struct{})
+
+		for _, method := range []upfMsgType{upfMsgTypeAdd, upfMsgTypeMod} {
+			op := datapathWrite{fseid: 1, method: method, all: rules, updated: rules, batch: true}
+			if method == upfMsgTypeMod {
+				op.onSuccess = func() { close(succeeded) }
+			}
+
+			require.Equal(t, ie.CauseRequestAccepted, pConn.writeRules(op))
+		}
+
+		// modifying the session must not change the queued rules
+		rules.pdrs[0].pdrID = 2
+
+		<-succeeded
+		require.Equal(t, []upfMsgType{upfMsgTypeAdd, upfMsgTypeMod}, dp.written())
+		require.Equal(t, uint32(1), dp.pdrs[1][0].pdrID)
+	})
+
+	for _, action := range []string{asyncWriteFailureReport, asyncWriteFailureTeardown} {
+		action := action
+
+		t.Run("failure with "+action+" action", func(t *testing.T) {
+			dp := &asyncWriteDatapath{rejected: 1}
+			pConn, cp := newAsyncWriteConn(t, &upf{datapath: dp, asyncWriteFailure: action})
+
+			session := PFCPSession{
+				localSEID:             1,
+				remoteSEID:            10,
+				metrics:               metrics.NewSession(""),
+				PacketForwardingRules: PacketForwardingRules{pdrs: []pdr{{fseID: 1, pdrID: 1}}},
+			}
+			require.NoError(t, pConn.store.PutSession(session, pConn, false, 0))
+
+			cause := pConn.writeRules(datapathWrite{
+				fseid:   1,
+				method:  upfMsgTypeAdd,
+				all:     session.PacketForwardingRules,
+				updated: session.PacketForwardingRules,
+				batch:   true,
+			})
+			require.Equal(t, ie.CauseRequestAccepted, cause)
+
+			require.NoError(t, cp.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+			buf := make([]byte, 1500)
+			n, err := cp.Read(buf)
+			require.NoError(t, err)
+
+			msg, err := message.Parse(buf[:n])
+			require.NoError(t, err)
+
+			srreq, ok := msg.(*message.SessionReportRequest)
+			require.True(t, ok)
+			require.Equal(t, uint64(10), srreq.SEID())
+			require.True(t, srreq.ReportType.HasUPIR())
+
+			_, stored := pConn.store.GetSession(1)
+
+			if action == asyncWriteFailureTeardown {
+				require.False(t, stored)
+				require.Equal(t, []upfMsgType{upfMsgTypeAdd, upfMsgTypeDel}, dp.written())
+			} else {
+				require.True(t, stored)
+				require.Equal(t, []upfMsgType{upfMsgTypeAdd}, dp.written())
+			}
+		})
+	}
+}
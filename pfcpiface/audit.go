@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// rulesAuditor periodically compares the PDRs of the stored sessions with the PDRs
+// installed in the datapath. Drift is only repaired once seen by two consecutive
+// audits, so that rules being written while the datapath is read are left alone.
+type rulesAuditor struct {
+	interval time.Duration
+
+	mu sync.Mutex
+	// suspects are the PDRs out of sync at the previous audit.
+	suspects map[pdrCounterKey]struct{}
+	missing  int
+	stale    int
+}
+
+func newRulesAuditor(interval time.Duration) *rulesAuditor {
+	return &rulesAuditor{
+		interval: interval,
+		suspects: make(map[pdrCounterKey]struct{}),
+	}
+}
+
+// outOfSync returns the number of missing and stale PDRs found by the last audit.
+func (a *rulesAuditor) outOfSync() (missing, stale int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.missing, a.stale
+}
+
+// confirm records the PDRs out of sync at this audit and returns those that already
+// were at the previous one.
+func (a *rulesAuditor) confirm(missing, stale map[pdrCounterKey]struct{}) (confirmedMissing, confirmedStale []pdrCounterKey) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	suspects := make(map[pdrCounterKey]struct{}, len(missing)+len(stale))
+
+	for k := range missing {
+		suspects[k] = struct{}{}
+
+		if _, ok := a.suspects[k]; ok {
+			confirmedMissing = append(confirmedMissing, k)
+		}
+	}
+
+	for k := range stale {
+		suspects[k] = struct{}{}
+
+		if _, ok := a.suspects[k]; ok {
+			confirmedStale = append(confirmedStale, k)
+		}
+	}
+
+	a.suspects = suspects
+	a.missing, a.stale = len(missing), len(stale)
+
+	return confirmedMissing, confirmedStale
+}
+
+// auditOwner is a stored session, with the connection it belongs to.
+type auditOwner struct {
+	pConn   *PFCPConn
+	session PFCPSession
+}
+
+// auditResult counts the PDRs out of sync and the repairs of an audit.
+type auditResult struct {
+	expected int
+	missing  int
+	stale    int
+	repaired int
+}
+
+// auditDatapath compares the PDRs of the stored sessions with those installed in the
+// datapath, rewrites the sessions with missing PDRs and deletes stale PDRs.
+func (node *PFCPNode) auditDatapath() auditResult {
+	var result auditResult
+
+	upf := node.upf
+	auditor := upf.auditor
+
+	if !upf.isConnected() {
+		log.Debugln("Datapath not connected, skipping rules audit")
+		return result
+	}
+
+	var expected []pdr
+
+	owners := make(map[pdrCounterKey]auditOwner)
+
+	node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+
+		for _, session := range pConn.store.GetAllSessions() {
+			for _, p := range session.pdrs {
+				owners[pdrCounterKey{fseID: p.fseID, pdrID: p.pdrID}] = auditOwner{pConn, session}
+				expected = append(expected, p)
+			}
+		}
+
+		return true
+	})
+
+	result.expected = len(expected)
+
+	installed, err := upf.ReadInstalledPDRs(expected)
+	if err != nil {
+		if errors.Is(err, errUnsupported) {
+			log.Debugln("Skipping rules audit:", err)
+		} else {
+			log.Errorln("Failed to read installed PDRs from datapath:", err)
+		}
+
+		return result
+	}
+
+	missing := make(map[pdrCounterKey]struct{})
+
+	for k := range owners {
+		if _, ok := installed[k]; !ok {
+			missing[k] = struct{}{}
+		}
+	}
+
+	stale := make(map[pdrCounterKey]struct{})
+
+	for k := range installed {
+		if _, ok := owners[k]; !ok {
+			stale[k] = struct{}{}
+		}
+	}
+
+	result.missing, result.stale = len(missing), len(stale)
+
+	confirmedMissing, confirmedStale := auditor.confirm(missing, stale)
+
+	// A session is rewritten once, whatever the number of its missing PDRs.
+	rewritten := make(map[uint64]struct{})
+
+	for _, k := range confirmedMissing {
+		owner := owners[k]
+		if _, ok := rewritten[owner.session.localSEID]; ok {
+			continue
+		}
+
+		rewritten[owner.session.localSEID] = struct{}{}
+
+		if node.rewriteSession(owner) {
+			result.repaired++
+		}
+	}
+
+	if len(confirmedStale) > 0 {
+		if err := upf.DeleteInstalledPDRs(confirmedStale); err != nil {
+			log.Errorln("Failed to delete", len(confirmedStale), "stale PDRs from datapath:", err)
+		} else {
+			result.repaired += len(confirmedStale)
+		}
+	}
+
+	logger := log.WithFields(log.Fields{
+		"expected": result.expected,
+		"missing":  result.missing,
+		"stale":    result.stale,
+		"repaired": result.repaired,
+	})
+
+	if result.missing != 0 || result.stale != 0 {
+		logger.Warn("Datapath rules out of sync with sessions")
+	} else {
+		logger.Debug("Datapath rules in sync with sessions")
+	}
+
+	return result
+}
+
+// rewriteSession deletes the rules of a session from the datapath and writes them again.
+func (node *PFCPNode) rewriteSession(owner auditOwner) bool {
+	pConn, session := owner.pConn, owner.session
+
+	logger := log.WithFields(log.Fields{
+		"F-SEID":  session.localSEID,
+		"CP node": pConn.nodeID.remote,
+	})
+	logger.Warn("Rewriting session with PDRs missing from datapath")
+
+	// The deletion fails for the missing rules, only the write must succeed.
+	pConn.writeRules(datapathWrite{
+		fseid:  session.localSEID,
+		method: upfMsgTypeDel,
+		all:    session.PacketForwardingRules,
+	})
+
+	cause := pConn.writeRules(datapathWrite{
+		fseid:   session.localSEID,
+		method:  upfMsgTypeAdd,
+		all:     session.PacketForwardingRules,
+		updated: session.PacketForwardingRules,
+		batch:   true,
+	})
+	if cause != ie.CauseRequestAccepted {
+		logger.Error("Failed to rewrite session into datapath")
+		return false
+	}
+
+	return true
+}
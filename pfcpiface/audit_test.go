@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func TestPFCPNode_auditDatapath(t *testing.T) {
+	f := &fakeDatapath{}
+	f.SetUpfInfo(&upf{}, &Conf{})
+
+	u := &upf{datapath: f, auditor: newRulesAuditor(time.Minute)}
+	node := &PFCPNode{upf: u}
+
+	store := NewInMemoryStore()
+	node.pConns.Store("198.18.0.1:8805", &PFCPConn{store: store, upf: u})
+
+	var sessions []PFCPSession
+
+	for _, fseid := range []uint64{1, 2} {
+		rules := PacketForwardingRules{
+			pdrs: []pdr{{srcIface: access, fseID: fseid, pdrID: 1}, {srcIface: core, fseID: fseid, pdrID: 2}},
+		}
+		session := PFCPSession{localSEID: fseid, PacketForwardingRules: rules}
+		sessions = append(sessions, session)
+
+		require.NoError(t, store.PutSession(session, nil, false, 0))
+		require.Equal(t, uint8(ie.CauseRequestAccepted), f.SendMsgToUPF(upfMsgTypeAdd, rules, rules))
+	}
+
+	t.Run("in sync", func(t *testing.T) {
+		require.Equal(t, auditResult{expected: 4}, node.auditDatapath())
+
+		missing, stale := u.auditor.outOfSync()
+		require.Zero(t, missing)
+		require.Zero(t, stale)
+	})
+
+	// Drift: a PDR of session 1 is lost, session 2 is removed from the store only.
+	require.Equal(t, uint8(ie.CauseRequestAccepted), f.SendMsgToUPF(upfMsgTypeDel,
+		PacketForwardingRules{pdrs: sessions[0].pdrs[:1]}, PacketForwardingRules{}))
+	require.NoError(t, store.DeleteSession(2, nil))
+
+	t.Run("drift is repaired once confirmed", func(t *testing.T) {
+		require.Equal(t, auditResult{expected: 2, missing: 1, stale: 2}, node.auditDatapath())
+
+		missing, stale := u.auditor.outOfSync()
+		require.Equal(t, 1, missing)
+		require.Equal(t, 2, stale)
+
+		require.Equal(t, auditResult{expected: 2, missing: 1, stale: 2, repaired: 3}, node.auditDatapath())
+		require.Len(t, f.state().PDRs, 2)
+
+		require.Equal(t, auditResult{expected: 2}, node.auditDatapath())
+	})
+
+	t.Run("transient drift is not repaired", func(t *testing.T) {
+		require.Equal(t, uint8(ie.CauseRequestAccepted), f.SendMsgToUPF(upfMsgTypeAdd,
+			sessions[1].PacketForwardingRules, sessions[1].PacketForwardingRules))
+		require.Equal(t, auditResult{expected: 2, stale: 2}, node.auditDatapath())
+
+		require.NoError(t, store.PutSession(sessions[1], nil, false, 0))
+		require.Equal(t, auditResult{expected: 4}, node.auditDatapath())
+		require.Len(t, f.state().PDRs, 4)
+	})
+
+	t.Run("skipped while disconnected", func(t *testing.T) {
+		node := &PFCPNode{upf: &upf{datapath: &fakeDatapath{}, auditor: newRulesAuditor(time.Minute)}}
+		require.Equal(t, auditResult{}, node.auditDatapath())
+	})
+}
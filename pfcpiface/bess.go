@@ -10,6 +10,7 @@ import (
 	"math"
 	"net"
 	"strconv"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc/connectivity"
@@ -31,21 +32,32 @@ const (
 	SockAddr = "/tmp/notifycp"
 	// PfcpAddr : Unix Socket path to send end marker packet.
 	PfcpAddr = "/tmp/pfcpport"
+	// ErrorIndAddr : Unix Socket path to read GTP-U Error Indications from.
+	ErrorIndAddr = "/tmp/errorind"
 	// AppQerLookup: Application Qos table Name.
 	AppQerLookup = "appQERLookup"
 	// SessQerLookup: Session Qos table Name.
 	SessQerLookup = "sessionQERLookup"
+	// FARDuplication: table of the FARs mirroring their traffic.
+	FARDuplication = "farDuplication"
 	// PreQosFlowMeasure: Pre QoS measurement module name.
 	PreQosFlowMeasure = "preQosFlowMeasure"
 	// PostDlQosFlowMeasure: Post QoS measurement downlink module name.
 	PostDlQosFlowMeasure = "postDLQosFlowMeasure"
 	// PostUlQosFlowMeasure: Post QoS measurement uplink module name.
 	PostUlQosFlowMeasure = "postULQosFlowMeasure"
+	// maxNotifyPacketSize is the largest notification read from BESS: F-SEID plus a jumbo frame.
+	maxNotifyPacketSize = 8 + 9216
 	// far-action specific values.
 	farForwardD = 0x0
 	farForwardU = 0x1
 	farDrop     = 0x2
 	farNotify   = 0x4
+	// farLocalSwitch sends the uplink traffic back to the downlink pipeline.
+	farLocalSwitch = 0x5
+	// Gates of farDuplication replicating the packets, to gtpuEncap or the mirror port.
+	farDupGTPUGate = 0x1
+	farDupRawGate  = 0x2
 	// Bit Rates.
 	KB = 1000
 	MB = 1000000
@@ -62,6 +74,7 @@ const (
 const (
 	// Internal gates for Slice meter.
 	sliceMeterGateMeter   uint64 = 0
+	sliceMeterGateRed     uint64 = 3
 	sliceMeterGateUnmeter uint64 = 6
 )
 
@@ -76,8 +89,22 @@ type bess struct {
 	conn             *grpc.ClientConn
 	endMarkerSocket  net.Conn
 	notifyBessSocket net.Conn
+	errorIndSocket   net.Conn
 	endMarkerChan    chan []byte
 	qciQosMap        map[uint8]*QosConfigVal
+	dlBuffer         *downlinkBuffer
+	// timeout bounds each gRPC call to BESS.
+	timeout   time.Duration
+	connState *bessConnState
+	// meteredSlice is the slice the slice meter is set for.
+	meteredSlice     string
+	meteredSliceLock sync.Mutex
+	// duplication mirrors the traffic of the FARs with the DUPL action, nil unless
+	// enabled, in which case the pipeline has a farDuplication table.
+	duplication *duplicator
+	// neighborProxy has the coreNeighborProxy module answer the ARP requests for the UE
+	// addresses, nil unless enabled.
+	neighborProxy *neighborProxy
 }
 
 func (b *bess) IsConnected(AccessIP *net.IP) bool {
@@ -96,21 +123,27 @@ func (b *bess) SendEndMarkers(endMarkerList *[][]byte) error {
 	return nil
 }
 
+// AddSliceInfo configures the slice meter. BESS meters the traffic of all slices with
+// a single slice meter, set by the last slice added.
 func (b *bess) AddSliceInfo(sliceInfo *SliceInfo) error {
+	b.meteredSliceLock.Lock()
+	b.meteredSlice = sliceInfo.name
+	b.meteredSliceLock.Unlock()
+
 	var sliceMeterConfig SliceMeterConfig
 	sliceMeterConfig.N6RateBps = sliceInfo.uplinkMbr
 	sliceMeterConfig.N3RateBps = sliceInfo.downlinkMbr
 	sliceMeterConfig.N6BurstBytes = sliceInfo.ulBurstBytes
 	sliceMeterConfig.N3BurstBytes = sliceInfo.dlBurstBytes
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
 
 	done := make(chan bool)
 
 	b.addSliceMeter(ctx, done, sliceMeterConfig)
 
-	rc := b.GRPCJoin(1, Timeout, done)
+	rc := b.GRPCJoin(1, b.timeout, done)
 
 	if !rc {
 		log.Errorln("Unable to make GRPC calls")
@@ -119,6 +152,32 @@ func (b *bess) AddSliceInfo(sliceInfo *SliceInfo) error {
 	return nil
 }
 
+// RemoveSliceInfo stops metering the traffic with the slice meter, if set for the slice.
+func (b *bess) RemoveSliceInfo(sliceInfo *SliceInfo) error {
+	b.meteredSliceLock.Lock()
+	if b.meteredSlice != sliceInfo.name {
+		// The meter is set for another slice.
+		b.meteredSliceLock.Unlock()
+		return nil
+	}
+
+	b.meteredSlice = ""
+	b.meteredSliceLock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	done := make(chan bool)
+
+	b.addSliceMeter(ctx, done, SliceMeterConfig{})
+
+	if !b.GRPCJoin(1, b.timeout, done) {
+		return ErrOperationFailedWithReason("removeSliceInfo", "unable to make GRPC calls")
+	}
+
+	return nil
+}
+
 func (b *bess) SendMsgToUPF(
 	method upfMsgType, rules PacketForwardingRules, updated PacketForwardingRules) uint8 {
 	// create context
@@ -134,12 +193,18 @@ func (b *bess) SendMsgToUPF(
 		qers = updated.qers
 	}
 
+	// The subnets behind the UEs are matched by copies of their PDRs.
+	pdrs = withFramedRoutes(pdrs)
+
+	b.updateDownlinkBuffers(method, fars, rules.bars)
+	b.proxyNeighbors(method, pdrs)
+
 	calls := len(pdrs) + len(fars) + len(qers)
 	if calls == 0 {
 		return cause
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
 
 	done := make(chan bool)
@@ -183,7 +248,7 @@ func (b *bess) SendMsgToUPF(
 		}
 	}
 
-	rc := b.GRPCJoin(calls, Timeout, done)
+	rc := b.GRPCJoin(calls, b.timeout, done)
 	if !rc {
 		log.Println("Unable to make GRPC calls")
 	}
@@ -191,6 +256,133 @@ func (b *bess) SendMsgToUPF(
 	return cause
 }
 
+func (b *bess) WriteSessionBatch(method upfMsgType, all PacketForwardingRules, updated PacketForwardingRules) error {
+	return ErrUnsupported("batched rules", "bess")
+}
+
+// UpdateQERRates rewrites the meter entries of q, leaving the PDRs alone.
+func (b *bess) UpdateQERRates(q qer, all PacketForwardingRules) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	done := make(chan bool)
+
+	b.addQER(ctx, done, q)
+
+	if !b.GRPCJoin(1, b.timeout, done) {
+		return ErrOperationFailedWithReason("UpdateQERRates", "unable to make GRPC calls")
+	}
+
+	return nil
+}
+
+// UpdateFARTunnel rewrites the FAR entry of f, leaving the PDRs alone.
+func (b *bess) UpdateFARTunnel(f far, all PacketForwardingRules) error {
+	b.updateDownlinkBuffers(upfMsgTypeMod, []far{f}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	done := make(chan bool)
+
+	b.addFAR(ctx, done, f)
+
+	if !b.GRPCJoin(1, b.timeout, done) {
+		return ErrOperationFailedWithReason("UpdateFARTunnel", "unable to make GRPC calls")
+	}
+
+	return nil
+}
+
+// updateDownlinkBuffers starts, flushes or drops the downlink buffers of the sessions
+// whose FARs have been installed, updated or removed, and applies the buffering limits
+// of their BARs.
+func (b *bess) updateDownlinkBuffers(method upfMsgType, fars []far, bars []bar) {
+	if b.dlBuffer == nil {
+		return
+	}
+
+	for _, bar := range bars {
+		if method == upfMsgTypeDel {
+			b.dlBuffer.setPacketLimit(bar.fseID, 0)
+		} else {
+			b.dlBuffer.setPacketLimit(bar.fseID, uint32(bar.suggestedPktCount))
+		}
+	}
+
+	for _, f := range fars {
+		switch {
+		case method == upfMsgTypeDel || f.Drops():
+			if n := b.dlBuffer.discard(f.fseID, f.farID); n > 0 {
+				log.Infoln("Dropped", n, "buffered packets of F-SEID", f.fseID)
+			}
+		case f.Buffers():
+			b.dlBuffer.start(f.fseID, f.farID)
+		case f.Forwards():
+			b.flushDownlinkBuffer(f)
+		}
+	}
+}
+
+// proxyNeighbors has the coreNeighborProxy module of the pipeline answer the ARP requests
+// for the UE addresses of the downlink PDRs installed. ArpResponder cannot remove its
+// entries, so the address of a removed PDR keeps resolving to the UPF, which drops the
+// traffic to it for lack of PDR.
+func (b *bess) proxyNeighbors(method upfMsgType, pdrs []pdr) {
+	if b.neighborProxy == nil || method == upfMsgTypeDel {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	for _, ip := range b.neighborProxy.addresses(pdrs) {
+		arg := &pb.ArpResponderArg{Ip: int2ip(ip).String(), MacAddr: b.neighborProxy.mac.String()}
+
+		any, err := anypb.New(arg)
+		if err != nil {
+			log.Errorf("Error marshalling the rule %v: %v", arg, err)
+			continue
+		}
+
+		resp, err := b.client.ModuleCommand(ctx, &pb.CommandRequest{
+			Name: "coreNeighborProxy",
+			Cmd:  "add",
+			Arg:  any,
+		})
+		if err != nil || resp.GetError() != nil {
+			log.Errorf("coreNeighborProxy add failed with resp: %v, err: %v\n", resp, err)
+		}
+	}
+}
+
+// flushDownlinkBuffer sends the packets buffered for f through the tunnel of f, using the
+// same datapath port as end markers.
+func (b *bess) flushDownlinkBuffer(f far) {
+	packets := b.dlBuffer.release(f.fseID, f.farID)
+	if len(packets) == 0 {
+		return
+	}
+
+	if b.endMarkerSocket == nil {
+		log.Warnln("End marker socket not available, dropping", len(packets),
+			"buffered packets of F-SEID", f.fseID)
+		return
+	}
+
+	for _, pkt := range packets {
+		out, err := encapsulateBuffered(f, pkt)
+		if err != nil {
+			log.Errorln("Failed to encapsulate buffered packet:", err)
+			continue
+		}
+
+		b.endMarkerChan <- out
+	}
+
+	log.Debugln("Flushed", len(packets), "buffered packets of F-SEID", f.fseID)
+}
+
 func (b *bess) Exit() {
 	log.Println("Exit function Bess")
 	b.conn.Close()
@@ -251,6 +443,8 @@ func (b *bess) getPortStats(ifname string) *pb.GetPortStatsResponse {
 }
 
 func (b *bess) PortStats(uc *upfCollector, ch chan<- prometheus.Metric) {
+	b.connectionStats(uc, ch)
+
 	portstats := func(ifaceLabel, ifaceName string) {
 		packets := func(packets uint64, direction string) {
 			p := prometheus.MustNewConstMetric(
@@ -419,6 +613,181 @@ func (b *bess) readFlowMeasurement(
 	return
 }
 
+// ReadPDRCounters reads the post-QoS counters of pdrs. Both halves of the double buffered
+// flow measurement tables are read without clearing them, so that SessionStats is not
+// disturbed; counters cleared by SessionStats show up as resets.
+func (b *bess) ReadPDRCounters(pdrs []pdr) (map[pdrCounterKey]pdrCounters, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	counters := make(map[pdrCounterKey]pdrCounters, len(pdrs))
+	for _, p := range pdrs {
+		counters[pdrCounterKey{fseID: p.fseID, pdrID: p.pdrID}] = pdrCounters{}
+	}
+
+	for _, module := range []string{PostUlQosFlowMeasure, PostDlQosFlowMeasure} {
+		for _, flag := range []uint64{0, 1} {
+			stats, err := b.readFlowMeasurement(ctx, module, flag, false, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, v := range stats.Statistics {
+				key := pdrCounterKey{fseID: v.Fseid, pdrID: uint32(v.Pdr)}
+
+				c, ok := counters[key]
+				if !ok {
+					continue
+				}
+
+				c.packets += v.TotalPackets
+				c.bytes += v.TotalBytes
+				counters[key] = c
+			}
+		}
+	}
+
+	return counters, nil
+}
+
+// readPDRRules returns the rules of the PDR lookup table.
+func (b *bess) readPDRRules(ctx context.Context) ([]*pb.WildcardMatchCommandAddArg, error) {
+	any, err := anypb.New(&pb.EmptyArg{})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.client.ModuleCommand(ctx, &pb.CommandRequest{
+		Name: "pdrLookup",
+		Cmd:  "get_runtime_config",
+		Arg:  any,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.GetError() != nil {
+		return nil, ErrOperationFailedWithReason("read pdrLookup rules", resp.GetError().Errmsg)
+	}
+
+	var config pb.WildcardMatchConfig
+	if err = resp.Data.UnmarshalTo(&config); err != nil {
+		return nil, err
+	}
+
+	return config.Rules, nil
+}
+
+// pdrRuleKey returns the PDR of a rule added by addPDR, from its pdr-id and fseid values.
+func pdrRuleKey(rule *pb.WildcardMatchCommandAddArg) (pdrCounterKey, bool) {
+	if len(rule.Valuesv) < 2 {
+		return pdrCounterKey{}, false
+	}
+
+	return pdrCounterKey{
+		fseID: rule.Valuesv[1].GetValueInt(),
+		pdrID: uint32(rule.Valuesv[0].GetValueInt()),
+	}, true
+}
+
+// ReadSliceMeterCounters reads the traffic seen by the output gates of the slice meter,
+// tracked by the pipeline. Both directions go through the same meter, which only
+// counts for the slice it is set for.
+func (b *bess) ReadSliceMeterCounters(sliceInfo *SliceInfo) (map[string]sliceMeterCounters, error) {
+	b.meteredSliceLock.Lock()
+	metered := b.meteredSlice
+	b.meteredSliceLock.Unlock()
+
+	if metered != sliceInfo.name {
+		return nil, ErrNotFoundWithParam("slice meter", "slice", sliceInfo.name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	res, err := b.client.GetModuleInfo(ctx, &pb.GetModuleInfoRequest{Name: "sliceMeter"})
+	if err != nil {
+		return nil, err
+	}
+
+	if res.GetError().GetCode() != 0 {
+		return nil, ErrOperationFailedWithReason("read slice meter", res.GetError().GetErrmsg())
+	}
+
+	var counters sliceMeterCounters
+
+	for _, ogate := range res.GetOgates() {
+		if ogate.GetOgate() == sliceMeterGateRed {
+			counters.droppedPackets += ogate.GetPkts()
+			counters.droppedBytes += ogate.GetBytes()
+
+			continue
+		}
+
+		counters.bytes += ogate.GetBytes()
+	}
+
+	return map[string]sliceMeterCounters{sliceDirectionBoth: counters}, nil
+}
+
+// ReadInstalledPDRs reads the rules of the PDR lookup table. A PDR with port ranges
+// is installed as several rules.
+func (b *bess) ReadInstalledPDRs(expected []pdr) (map[pdrCounterKey]struct{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	rules, err := b.readPDRRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	installed := make(map[pdrCounterKey]struct{}, len(rules))
+
+	for _, rule := range rules {
+		if key, ok := pdrRuleKey(rule); ok {
+			installed[key] = struct{}{}
+		}
+	}
+
+	return installed, nil
+}
+
+// DeleteInstalledPDRs deletes all the rules of the PDR lookup table installed for keys.
+func (b *bess) DeleteInstalledPDRs(keys []pdrCounterKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	rules, err := b.readPDRRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	deleted := make(map[pdrCounterKey]struct{}, len(keys))
+	for _, k := range keys {
+		deleted[k] = struct{}{}
+	}
+
+	for _, rule := range rules {
+		key, ok := pdrRuleKey(rule)
+		if !ok {
+			continue
+		}
+
+		if _, ok := deleted[key]; !ok {
+			continue
+		}
+
+		any, err := anypb.New(&pb.WildcardMatchCommandDeleteArg{Values: rule.Values, Masks: rule.Masks})
+		if err != nil {
+			return err
+		}
+
+		b.processPDR(ctx, any, upfMsgTypeDel)
+	}
+
+	return nil
+}
+
 func (b *bess) SessionStats(pc *PfcpNodeCollector, ch chan<- prometheus.Metric) (err error) {
 	// Clearing table data with large tables is slow, let's wait for a little longer since this is
 	// non-blocking for the dataplane anyway.
@@ -578,45 +947,52 @@ func (b *bess) endMarkerSendLoop(endMarkerChan chan []byte) {
 	}
 }
 
-func (b *bess) notifyListen(reportNotifyChan chan<- uint64) {
-	notifier := NewDownlinkDataNotifier(reportNotifyChan, 20*time.Second)
+func (b *bess) notifyListen(reports *reportPipeline) {
+	buf := make([]byte, maxNotifyPacketSize)
 
 	for {
-		buf := make([]byte, 512)
-
-		_, err := b.notifyBessSocket.Read(buf)
+		n, err := b.notifyBessSocket.Read(buf)
 		if err != nil {
 			return
 		}
 
+		if n < 8 {
+			continue
+		}
+
+		// Notifications carry the F-SEID followed by the original packet.
 		d := buf[0:8]
 		fseid := binary.LittleEndian.Uint64(d)
 
-		notifier.Notify(fseid)
+		if b.dlBuffer != nil {
+			b.dlBuffer.enqueue(fseid, buf[8:n])
+		}
+
+		// Reports are throttled per session by the PFCP connection.
+		reports.notify(fseid)
 	}
 }
 
-func (b *bess) readQciQosMap(conf *Conf) {
-	b.qciQosMap = make(map[uint8]*QosConfigVal)
+// errorIndListen reads the GTP-U Error Indications punted by the datapath.
+func (b *bess) errorIndListen(errorIndChan chan<- gtpuErrorIndication) {
+	buf := make([]byte, maxNotifyPacketSize)
 
-	for _, qosVal := range conf.QciQosConfig {
-		qosConfigVal := &QosConfigVal{
-			cbs:              qosVal.CBS,
-			ebs:              qosVal.EBS,
-			pbs:              qosVal.PBS,
-			burstDurationMs:  qosVal.BurstDurationMs,
-			schedulePriority: qosVal.SchedulingPriority,
+	for {
+		n, err := b.errorIndSocket.Read(buf)
+		if err != nil {
+			return
 		}
-		b.qciQosMap[qosVal.QCI] = qosConfigVal
-	}
 
-	if _, ok := b.qciQosMap[0]; !ok {
-		b.qciQosMap[0] = &QosConfigVal{
-			cbs:              DefaultBurstSize,
-			ebs:              DefaultBurstSize,
-			pbs:              DefaultBurstSize,
-			burstDurationMs:  10,
-			schedulePriority: 7,
+		ind, err := parseErrorIndicationFrame(buf[:n])
+		if err != nil {
+			log.Warnln("Ignoring malformed GTP-U Error Indication:", err)
+			continue
+		}
+
+		select {
+		case errorIndChan <- ind:
+		default:
+			log.Warnln("Dropping", ind, ": queue full")
 		}
 	}
 }
@@ -625,7 +1001,7 @@ func (b *bess) readQciQosMap(conf *Conf) {
 // It doesn't clear sliceMeter, because slice config is dynamically provided via REST API
 // and there is no guarantee that the config will be pushed again after pfcp-agent's restart.
 func (b *bess) clearState() {
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
 
 	log.Debug("Clearing all the state in BESS")
@@ -650,6 +1026,10 @@ func (b *bess) clearState() {
 
 	b.processFAR(ctx, anyExactClear, upfMsgTypeClear)
 
+	if b.duplication != nil {
+		b.processFARDuplication(ctx, anyExactClear, upfMsgTypeClear)
+	}
+
 	clearQoSCmd := &pb.QosCommandClearArg{}
 
 	anyQoSClear, err := anypb.New(clearQoSCmd)
@@ -667,28 +1047,87 @@ func (b *bess) clearState() {
 	}
 }
 
+// watchConnection clears the rules in BESS and requests a resync each time the
+// channel to BESS is ready again after a failure, e.g. once bessd has restarted.
+// Transitions through idle do not trigger a resync as BESS keeps its rules.
+func (b *bess) watchConnection(resync chan<- struct{}) {
+	state := b.conn.GetState()
+	lost := false
+
+	for b.conn.WaitForStateChange(context.Background(), state) {
+		state = b.conn.GetState()
+		b.connState.record(state)
+
+		switch state {
+		case connectivity.TransientFailure:
+			if !lost {
+				log.Warnln("Lost connection to BESS")
+			}
+
+			lost = true
+		case connectivity.Ready:
+			if !lost {
+				continue
+			}
+
+			log.Infoln("Reconnected to BESS, resynchronizing sessions")
+
+			lost = false
+
+			b.clearState()
+			requestResync(resync)
+		case connectivity.Shutdown:
+			return
+		}
+	}
+}
+
 // setUpfInfo is only called at pfcp-agent's startup
 // it clears all the state in BESS
-func (b *bess) SetUpfInfo(u *upf, conf *Conf) {
+func (b *bess) SetUpfInfo(u *upf, conf *Conf) error {
 	var err error
 
 	log.Println("SetUpfInfo bess")
 
-	b.readQciQosMap(conf)
+	b.qciQosMap = newQciQosMap(conf.QciQosConfig)
 	// get bess grpc client
 	log.Println("bessIP ", *bessIP)
 
 	b.endMarkerChan = make(chan []byte, 1024)
+	b.dlBuffer = newDownlinkBuffer(conf.DLBufferPacketCount, conf.DLBufferSize)
+	b.duplication = u.duplication
 
-	b.conn, err = grpc.Dial(*bessIP, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	b.neighborProxy, err = newNeighborProxy(conf)
 	if err != nil {
-		log.Fatalln("did not connect:", err)
+		return err
 	}
 
+	b.timeout = Timeout
+	if conf.BESSIface.CallTimeout != "" {
+		b.timeout, err = time.ParseDuration(conf.BESSIface.CallTimeout)
+		if err != nil {
+			return ErrInvalidArgumentWithReason("bess.call_timeout", conf.BESSIface.CallTimeout, err.Error())
+		}
+	}
+
+	opts, err := bessDialOptions(conf.BESSIface)
+	if err != nil {
+		return err
+	}
+
+	b.conn, err = grpc.Dial(*bessIP, append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))...)
+	if err != nil {
+		return ErrOperationFailedWithReason("BESS gRPC dial", err.Error())
+	}
+
+	b.connState = newBESSConnState(b.conn.GetState())
+
 	b.client = pb.NewBESSControlClient(b.conn)
 
 	b.clearState()
 
+	go b.watchConnection(u.resyncChan)
+
 	if conf.EnableNotifyBess {
 		notifySockAddr := conf.NotifySockAddr
 		if notifySockAddr == "" {
@@ -698,10 +1137,10 @@ func (b *bess) SetUpfInfo(u *upf, conf *Conf) {
 		b.notifyBessSocket, err = net.Dial("unixpacket", notifySockAddr)
 		if err != nil {
 			log.Println("dial error:", err)
-			return
+			return nil
 		}
 
-		go b.notifyListen(u.reportNotifyChan)
+		go b.notifyListen(u.reports)
 	}
 
 	if conf.EnableEndMarker {
@@ -713,7 +1152,7 @@ func (b *bess) SetUpfInfo(u *upf, conf *Conf) {
 		b.endMarkerSocket, err = net.Dial("unixpacket", pfcpCommAddr)
 		if err != nil {
 			log.Println("dial error:", err)
-			return
+			return nil
 		}
 
 		log.Println("Starting end marker loop")
@@ -721,20 +1160,63 @@ func (b *bess) SetUpfInfo(u *upf, conf *Conf) {
 		go b.endMarkerSendLoop(b.endMarkerChan)
 	}
 
+	if conf.EnableErrorIndication {
+		errorIndAddr := conf.ErrorIndSockAddr
+		if errorIndAddr == "" {
+			errorIndAddr = ErrorIndAddr
+		}
+
+		b.errorIndSocket, err = net.Dial("unixpacket", errorIndAddr)
+		if err != nil {
+			log.Println("dial error:", err)
+			return nil
+		}
+
+		go b.errorIndListen(u.errorIndChan)
+	}
+
 	if (conf.SliceMeterConfig.N6RateBps > 0) ||
 		(conf.SliceMeterConfig.N3RateBps > 0) {
-		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 		defer cancel()
 
 		done := make(chan bool)
 
 		b.addSliceMeter(ctx, done, conf.SliceMeterConfig)
 
-		rc := b.GRPCJoin(1, Timeout, done)
+		rc := b.GRPCJoin(1, b.timeout, done)
+		if !rc {
+			log.Errorln("Unable to make GRPC calls")
+		}
+
+		b.meteredSliceLock.Lock()
+		b.meteredSlice = configSliceName
+		b.meteredSliceLock.Unlock()
+
+		u.slicesLock.Lock()
+		if u.slices == nil {
+			u.slices = make(map[string]*SliceInfo)
+		}
+
+		u.slices[configSliceName] = configSliceInfo(conf.SliceMeterConfig)
+		u.slicesLock.Unlock()
+	}
+
+	if len(conf.QfiDscpConfig) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+		defer cancel()
+
+		done := make(chan bool)
+
+		b.addDSCPMarking(ctx, done, conf.QfiDscpConfig)
+
+		rc := b.GRPCJoin(1, b.timeout, done)
 		if !rc {
 			log.Errorln("Unable to make GRPC calls")
 		}
 	}
+
+	return nil
 }
 
 func (b *bess) processPDR(ctx context.Context, any *anypb.Any, method upfMsgType) {
@@ -782,37 +1264,7 @@ func (b *bess) addPDR(ctx context.Context, done chan<- bool, p pdr) {
 		log.Tracef("PDR rules %+v", portRules)
 
 		for _, r := range portRules {
-			f := &pb.WildcardMatchCommandAddArg{
-				Gate:     uint64(p.needDecap),
-				Priority: int64(math.MaxUint32 - p.precedence),
-				Values: []*pb.FieldData{
-					intEnc(uint64(p.srcIface)),        /* src_iface */
-					intEnc(uint64(p.tunnelIP4Dst)),    /* tunnel_ipv4_dst */
-					intEnc(uint64(p.tunnelTEID)),      /* enb_teid */
-					intEnc(uint64(p.appFilter.srcIP)), /* ueaddr ip*/
-					intEnc(uint64(p.appFilter.dstIP)), /* inet ip */
-					intEnc(uint64(r.srcPort)),         /* ue port */
-					intEnc(uint64(r.dstPort)),         /* inet port */
-					intEnc(uint64(p.appFilter.proto)), /* proto id */
-				},
-				Masks: []*pb.FieldData{
-					intEnc(uint64(p.srcIfaceMask)),        /* src_iface-mask */
-					intEnc(uint64(p.tunnelIP4DstMask)),    /* tunnel_ipv4_dst-mask */
-					intEnc(uint64(p.tunnelTEIDMask)),      /* enb_teid-mask */
-					intEnc(uint64(p.appFilter.srcIPMask)), /* ueaddr ip-mask */
-					intEnc(uint64(p.appFilter.dstIPMask)), /* inet ip-mask */
-					intEnc(uint64(r.srcMask)),             /* ue port-mask */
-					intEnc(uint64(r.dstMask)),             /* inet port-mask */
-					intEnc(uint64(p.appFilter.protoMask)), /* proto id-mask */
-				},
-				Valuesv: []*pb.FieldData{
-					intEnc(uint64(p.pdrID)), /* pdr-id */
-					intEnc(p.fseID),         /* fseid */
-					intEnc(uint64(p.ctrID)), /* ctr_id */
-					intEnc(uint64(qerID)),   /* qer_id */
-					intEnc(uint64(p.farID)), /* far_id */
-				},
-			}
+			f := pdrLookupRule(p, qerID, r)
 
 			any, err = anypb.New(f)
 			if err != nil {
@@ -826,6 +1278,43 @@ func (b *bess) addPDR(ctx context.Context, done chan<- bool, p pdr) {
 	}()
 }
 
+// pdrLookupRule returns the pdrLookup rule of p for one of its port range rules.
+func pdrLookupRule(p pdr, qerID uint32, r portRangeTernaryCartesianProduct) *pb.WildcardMatchCommandAddArg {
+	return &pb.WildcardMatchCommandAddArg{
+		Gate:     uint64(p.needDecap),
+		Priority: int64(math.MaxUint32 - p.precedence),
+		Values: []*pb.FieldData{
+			intEnc(uint64(p.srcIface)),        /* src_iface */
+			intEnc(uint64(p.tunnelIP4Dst)),    /* tunnel_ipv4_dst */
+			intEnc(uint64(p.tunnelTEID)),      /* enb_teid */
+			intEnc(uint64(p.appFilter.srcIP)), /* ueaddr ip*/
+			intEnc(uint64(p.appFilter.dstIP)), /* inet ip */
+			intEnc(uint64(r.srcPort)),         /* ue port */
+			intEnc(uint64(r.dstPort)),         /* inet port */
+			intEnc(uint64(p.appFilter.proto)), /* proto id */
+			intEnc(uint64(p.qfi)),             /* pdu_qfi */
+		},
+		Masks: []*pb.FieldData{
+			intEnc(uint64(p.srcIfaceMask)),        /* src_iface-mask */
+			intEnc(uint64(p.tunnelIP4DstMask)),    /* tunnel_ipv4_dst-mask */
+			intEnc(uint64(p.tunnelTEIDMask)),      /* enb_teid-mask */
+			intEnc(uint64(p.appFilter.srcIPMask)), /* ueaddr ip-mask */
+			intEnc(uint64(p.appFilter.dstIPMask)), /* inet ip-mask */
+			intEnc(uint64(r.srcMask)),             /* ue port-mask */
+			intEnc(uint64(r.dstMask)),             /* inet port-mask */
+			intEnc(uint64(p.appFilter.protoMask)), /* proto id-mask */
+			intEnc(uint64(p.qfiMask)),             /* pdu_qfi-mask */
+		},
+		Valuesv: []*pb.FieldData{
+			intEnc(uint64(p.pdrID)), /* pdr-id */
+			intEnc(p.fseID),         /* fseid */
+			intEnc(uint64(p.ctrID)), /* ctr_id */
+			intEnc(uint64(qerID)),   /* qer_id */
+			intEnc(uint64(p.farID)), /* far_id */
+		},
+	}
+}
+
 func (b *bess) delPDR(ctx context.Context, done chan<- bool, p pdr) {
 	go func() {
 		var (
@@ -851,6 +1340,7 @@ func (b *bess) delPDR(ctx context.Context, done chan<- bool, p pdr) {
 					intEnc(uint64(r.srcPort)),         /* ue port */
 					intEnc(uint64(r.dstPort)),         /* inet port */
 					intEnc(uint64(p.appFilter.proto)), /* proto id */
+					intEnc(uint64(p.qfi)),             /* pdu_qfi */
 				},
 				Masks: []*pb.FieldData{
 					intEnc(uint64(p.srcIfaceMask)),        /* src_iface-mask */
@@ -861,6 +1351,7 @@ func (b *bess) delPDR(ctx context.Context, done chan<- bool, p pdr) {
 					intEnc(uint64(r.srcMask)),             /* ue port-mask */
 					intEnc(uint64(r.dstMask)),             /* inet port-mask */
 					intEnc(uint64(p.appFilter.protoMask)), /* proto id-mask */
+					intEnc(uint64(p.qfiMask)),             /* pdu_qfi-mask */
 				},
 			}
 
@@ -887,24 +1378,16 @@ func (b *bess) addQER(ctx context.Context, done chan<- bool, qer qer) {
 		srcIface = access
 
 		// Lookup QCI from QFI, else try default QCI.
-		qosVal, ok := b.qciQosMap[qer.qfi]
-		if !ok {
-			log.Debug("No config for qfi/qci : ", qer.qfi, ". Using default burst size.")
-
-			qosVal = b.qciQosMap[0]
-		}
+		qosVal := qosConfigOf(b.qciQosMap, qer.qfi)
 
-		cbs = maxUint64(calcBurstSizeFromRate(qer.ulGbr, uint64(qosVal.burstDurationMs)), uint64(qosVal.cbs))
-		ebs = maxUint64(calcBurstSizeFromRate(qer.ulMbr, uint64(qosVal.burstDurationMs)), uint64(qosVal.ebs))
-		pbs = maxUint64(calcBurstSizeFromRate(qer.ulMbr, uint64(qosVal.burstDurationMs)), uint64(qosVal.ebs))
+		m := newQERMeter(qer.ulMbr, qer.ulGbr, qosVal)
+		cbs, pbs, ebs = m.cbs, m.pbs, m.ebs
 
 		if qer.ulStatus != ie.GateStatusOpen {
 			gate = qerGateStatusDrop
 		} else if qer.ulMbr != 0 || qer.ulGbr != 0 {
-			/* MBR/GBR is received in Kilobits/sec.
-			   CIR/PIR is sent in bytes */
-			cir = maxUint64(((qer.ulGbr * 1000) / 8), 1)
-			pir = maxUint64(((qer.ulMbr * 1000) / 8), cir)
+			cir = maxUint64(m.cir, 1)
+			pir = maxUint64(m.pir, cir)
 			gate = qerGateMeter
 		} else {
 			gate = qerGateUnmeter
@@ -919,25 +1402,14 @@ func (b *bess) addQER(ctx context.Context, done chan<- bool, qer qer) {
 		// Downlink QER
 		srcIface = core
 
-		// Lookup QCI from QFI, else try default QCI.
-		qosVal, ok = b.qciQosMap[qer.qfi]
-		if !ok {
-			log.Debug("No config for qfi/qci : ", qer.qfi, ". Using default burst size.")
-
-			qosVal = b.qciQosMap[0]
-		}
-
-		cbs = maxUint64(calcBurstSizeFromRate(qer.dlGbr, uint64(qosVal.burstDurationMs)), uint64(qosVal.cbs))
-		ebs = maxUint64(calcBurstSizeFromRate(qer.dlMbr, uint64(qosVal.burstDurationMs)), uint64(qosVal.ebs))
-		pbs = maxUint64(calcBurstSizeFromRate(qer.dlMbr, uint64(qosVal.burstDurationMs)), uint64(qosVal.ebs))
+		m = newQERMeter(qer.dlMbr, qer.dlGbr, qosVal)
+		cbs, pbs, ebs = m.cbs, m.pbs, m.ebs
 
 		if qer.dlStatus != ie.GateStatusOpen {
 			gate = qerGateStatusDrop
 		} else if qer.dlMbr != 0 || qer.dlGbr != 0 {
-			/* MBR/GBR is received in Kilobits/sec.
-			   CIR/PIR is sent in bytes */
-			cir = maxUint64(((qer.dlGbr * 1000) / 8), 1)
-			pir = maxUint64(((qer.dlMbr * 1000) / 8), cir)
+			cir = maxUint64(m.cir, 1)
+			pir = maxUint64(m.pir, cir)
 			gate = qerGateMeter
 		} else {
 			gate = qerGateUnmeter
@@ -1068,7 +1540,84 @@ func (b *bess) processFAR(ctx context.Context, any *anypb.Any, method upfMsgType
 	}
 }
 
+// processFARDuplication adds, deletes or clears the entries of farDuplication.
+func (b *bess) processFARDuplication(ctx context.Context, any *anypb.Any, method upfMsgType) {
+	methods := [...]string{"add", "add", "delete", "clear"}
+
+	resp, err := b.client.ModuleCommand(ctx, &pb.CommandRequest{
+		Name: FARDuplication,
+		Cmd:  methods[method],
+		Arg:  any,
+	})
+
+	log.Traceln("farDuplication resp : ", resp)
+
+	// Deleting the entry of a FAR that did not duplicate its traffic fails harmlessly.
+	if err != nil || (resp.GetError() != nil && method != upfMsgTypeDel) {
+		log.Errorf("farDuplication method failed with resp: %v, err: %v\n", resp, err)
+	}
+}
+
+// updateFARDuplication adds the farDuplication entry of far if it duplicates its
+// traffic, and deletes it otherwise. The copies leave toward the core interface, as
+// forwarded uplink traffic, the originals being processed by farLookup.
+func (b *bess) updateFARDuplication(ctx context.Context, far far, method upfMsgType) {
+	if b.duplication == nil {
+		return
+	}
+
+	var (
+		any *anypb.Any
+		err error
+	)
+
+	fields := []*pb.FieldData{
+		intEnc(uint64(far.farID)), /* far_id */
+		intEnc(far.fseID),         /* fseid */
+	}
+
+	if method == upfMsgTypeDel || !far.Duplicates() {
+		any, err = anypb.New(&pb.ExactMatchCommandDeleteArg{Fields: fields})
+		if err != nil {
+			log.Println("Error marshalling the rule", far, err)
+			return
+		}
+
+		b.processFARDuplication(ctx, any, upfMsgTypeDel)
+
+		return
+	}
+
+	gate, tunnelType := uint64(farDupGTPUGate), uint64(1)
+	if b.duplication.raw {
+		gate, tunnelType = farDupRawGate, 0
+	}
+
+	any, err = anypb.New(&pb.ExactMatchCommandAddArg{
+		Gate:   gate,
+		Fields: fields,
+		Values: []*pb.FieldData{
+			intEnc(uint64(farForwardU)),          /* action */
+			intEnc(tunnelType),                   /* tunnel_out_type */
+			intEnc(uint64(far.dup.tunnelIP4Src)), /* core ip */
+			intEnc(uint64(far.dup.tunnelIP4Dst)), /* mediation endpoint ip */
+			intEnc(uint64(far.dup.tunnelTEID)),   /* mediation teid */
+			intEnc(uint64(tunnelGTPUPort)),       /* udp gtpu port */
+		},
+	})
+	if err != nil {
+		log.Println("Error marshalling the rule", far, err)
+		return
+	}
+
+	b.processFARDuplication(ctx, any, upfMsgTypeAdd)
+}
+
 func (b *bess) setActionValue(f far) uint8 {
+	if f.SwitchesLocally() {
+		return farLocalSwitch
+	}
+
 	if (f.applyAction & ActionForward) != 0 {
 		if f.dstIntf == ie.DstInterfaceAccess {
 			return farForwardD
@@ -1095,19 +1644,35 @@ func (b *bess) addFAR(ctx context.Context, done chan<- bool, far far) {
 		)
 
 		action := b.setActionValue(far)
+		tunnel := far
+
+		// Redirected or enriched uplink traffic is encapsulated toward the redirect
+		// server or the enrichment proxy.
+		if far.Redirects() {
+			tunnel.tunnelIP4Src, tunnel.tunnelIP4Dst = far.redirect.tunnelIP4Src, far.redirect.tunnelIP4Dst
+		} else if far.Enriches() {
+			tunnel.tunnelIP4Src, tunnel.tunnelIP4Dst = far.enrichment.tunnelIP4Src, far.enrichment.tunnelIP4Dst
+		}
+
+		if far.Redirects() || far.Enriches() {
+			tunnel.tunnelType = 1
+			tunnel.tunnelTEID = far.farID
+			tunnel.tunnelPort = tunnelGTPUPort
+		}
+
 		f := &pb.ExactMatchCommandAddArg{
-			Gate: uint64(far.tunnelType),
+			Gate: uint64(tunnel.tunnelType),
 			Fields: []*pb.FieldData{
 				intEnc(uint64(far.farID)), /* far_id */
 				intEnc(far.fseID),         /* fseid */
 			},
 			Values: []*pb.FieldData{
-				intEnc(uint64(action)),           /* action */
-				intEnc(uint64(far.tunnelType)),   /* tunnel_out_type */
-				intEnc(uint64(far.tunnelIP4Src)), /* access-ip */
-				intEnc(uint64(far.tunnelIP4Dst)), /* enb ip */
-				intEnc(uint64(far.tunnelTEID)),   /* enb teid */
-				intEnc(uint64(far.tunnelPort)),   /* udp gtpu port */
+				intEnc(uint64(action)),              /* action */
+				intEnc(uint64(tunnel.tunnelType)),   /* tunnel_out_type */
+				intEnc(uint64(tunnel.tunnelIP4Src)), /* access-ip */
+				intEnc(uint64(tunnel.tunnelIP4Dst)), /* enb ip */
+				intEnc(uint64(tunnel.tunnelTEID)),   /* enb teid */
+				intEnc(uint64(tunnel.tunnelPort)),   /* udp gtpu port */
 			},
 		}
 
@@ -1118,6 +1683,7 @@ func (b *bess) addFAR(ctx context.Context, done chan<- bool, far far) {
 		}
 
 		b.processFAR(ctx, any, upfMsgTypeAdd)
+		b.updateFARDuplication(ctx, far, upfMsgTypeAdd)
 		done <- true
 	}()
 }
@@ -1143,6 +1709,38 @@ func (b *bess) delFAR(ctx context.Context, done chan<- bool, far far) {
 		}
 
 		b.processFAR(ctx, any, upfMsgTypeDel)
+		b.updateFARDuplication(ctx, far, upfMsgTypeDel)
+		done <- true
+	}()
+}
+
+// addDSCPMarking maps each QFI to the gate of dscpMarking that sets its DSCP on the
+// outer IP header of encapsulated packets.
+func (b *bess) addDSCPMarking(ctx context.Context, done chan<- bool, dscpConfig []QfiDscpConfig) {
+	go func() {
+		for _, m := range dscpConfig {
+			f := &pb.ExactMatchCommandAddArg{
+				Gate: uint64(m.DSCP),
+				Fields: []*pb.FieldData{
+					intEnc(uint64(m.QFI)), /* qfi */
+				},
+			}
+
+			any, err := anypb.New(f)
+			if err != nil {
+				log.Errorln("Error marshalling the rule", f, err)
+				return
+			}
+
+			resp, err := b.client.ModuleCommand(ctx, &pb.CommandRequest{
+				Name: "dscpMarking",
+				Cmd:  "add",
+				Arg:  any,
+			})
+			if err != nil || resp.GetError() != nil {
+				log.Errorf("dscpMarking method failed with resp: %v, err: %v\n", resp, err)
+			}
+		}
 		done <- true
 	}()
 }
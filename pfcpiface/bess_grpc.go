@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/keepalive"
+)
+
+// bessDialOptions returns the gRPC options of the connection to BESS. Keepalive pings
+// detect a BESS that stopped answering on a connection left open.
+func bessDialOptions(conf BESSInfo) ([]grpc.DialOption, error) {
+	var opts []grpc.DialOption
+
+	if conf.KeepaliveTime != "" {
+		params := keepalive.ClientParameters{PermitWithoutStream: true}
+
+		var err error
+
+		params.Time, err = time.ParseDuration(conf.KeepaliveTime)
+		if err != nil {
+			return nil, ErrInvalidArgumentWithReason("bess.keepalive_time", conf.KeepaliveTime, "invalid duration")
+		}
+
+		if conf.KeepaliveTimeout != "" {
+			params.Timeout, err = time.ParseDuration(conf.KeepaliveTimeout)
+			if err != nil {
+				return nil, ErrInvalidArgumentWithReason("bess.keepalive_timeout", conf.KeepaliveTimeout, "invalid duration")
+			}
+		}
+
+		opts = append(opts, grpc.WithKeepaliveParams(params))
+	}
+
+	var callOpts []grpc.CallOption
+
+	if conf.MaxRecvMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(conf.MaxRecvMsgSize))
+	}
+
+	if conf.MaxSendMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallSendMsgSize(conf.MaxSendMsgSize))
+	}
+
+	if len(callOpts) > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	}
+
+	return opts, nil
+}
+
+// bessConnState tracks the state of the gRPC connection to BESS, exposed as metrics.
+type bessConnState struct {
+	mu      sync.Mutex
+	state   connectivity.State
+	changes map[connectivity.State]uint64
+}
+
+func newBESSConnState(state connectivity.State) *bessConnState {
+	return &bessConnState{
+		state:   state,
+		changes: make(map[connectivity.State]uint64),
+	}
+}
+
+func (s *bessConnState) record(state connectivity.State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"from": s.state,
+		"to":   state,
+	}).Info("BESS connection state changed")
+
+	s.state = state
+	s.changes[state]++
+}
+
+// bessConnStates are the connection states reported as metrics, Shutdown excluded.
+var bessConnStates = []connectivity.State{
+	connectivity.Idle,
+	connectivity.Connecting,
+	connectivity.Ready,
+	connectivity.TransientFailure,
+}
+
+func (b *bess) connectionStats(uc *upfCollector, ch chan<- prometheus.Metric) {
+	if b.connState == nil {
+		return
+	}
+
+	b.connState.mu.Lock()
+	defer b.connState.mu.Unlock()
+
+	for _, state := range bessConnStates {
+		current := 0.0
+		if state == b.connState.state {
+			current = 1
+		}
+
+		ch <- prometheus.MustNewConstMetric(uc.bessConnState, prometheus.GaugeValue, current, state.String())
+		ch <- prometheus.MustNewConstMetric(uc.bessConnChanges, prometheus.CounterValue,
+			float64(b.connState.changes[state]), state.String())
+	}
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/connectivity"
+)
+
+func Test_bessDialOptions(t *testing.T) {
+	opts, err := bessDialOptions(BESSInfo{})
+	require.NoError(t, err)
+	require.Empty(t, opts)
+
+	opts, err = bessDialOptions(BESSInfo{
+		KeepaliveTime:    "30s",
+		KeepaliveTimeout: "10s",
+		MaxRecvMsgSize:   16 << 20,
+	})
+	require.NoError(t, err)
+	require.Len(t, opts, 2)
+
+	_, err = bessDialOptions(BESSInfo{KeepaliveTime: "30s", KeepaliveTimeout: "often"})
+	require.Error(t, err)
+}
+
+func Test_bessConnState_record(t *testing.T) {
+	s := newBESSConnState(connectivity.Idle)
+
+	s.record(connectivity.Connecting)
+	s.record(connectivity.Ready)
+	s.record(connectivity.TransientFailure)
+	s.record(connectivity.Connecting)
+
+	require.Equal(t, connectivity.Connecting, s.state)
+	require.Equal(t, map[connectivity.State]uint64{
+		connectivity.Connecting:       2,
+		connectivity.Ready:            1,
+		connectivity.TransientFailure: 1,
+	}, s.changes)
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// bpfMap is a BPF map pinned to the BPF filesystem by the program loader.
+type bpfMap struct {
+	fd   int
+	path string
+}
+
+type bpfObjGetAttr struct {
+	pathname  unsafe.Pointer
+	bpfFD     uint32
+	fileFlags uint32
+}
+
+type bpfMapElemAttr struct {
+	mapFD uint32
+	_     uint32
+	key   unsafe.Pointer
+	value unsafe.Pointer
+	flags uint64
+}
+
+func bpfSyscall(cmd int, attr unsafe.Pointer, size uintptr) (uintptr, error) {
+	r, _, errno := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
+	if errno != 0 {
+		return r, errno
+	}
+
+	return r, nil
+}
+
+func openPinnedMap(path string) (*bpfMap, error) {
+	pathname, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	attr := bpfObjGetAttr{pathname: unsafe.Pointer(pathname)}
+
+	fd, err := bpfSyscall(unix.BPF_OBJ_GET, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err != nil {
+		return nil, ErrOperationFailedWithReason("open BPF map "+path, err.Error())
+	}
+
+	return &bpfMap{fd: int(fd), path: path}, nil
+}
+
+func (m *bpfMap) elemOp(cmd int, key, value []byte, flags uint64) error {
+	attr := bpfMapElemAttr{
+		mapFD: uint32(m.fd),
+		key:   unsafe.Pointer(&key[0]),
+		flags: flags,
+	}
+
+	if value != nil {
+		attr.value = unsafe.Pointer(&value[0])
+	}
+
+	_, err := bpfSyscall(cmd, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+
+	return err
+}
+
+// update creates or replaces the entry of key.
+func (m *bpfMap) update(key, value []byte) error {
+	if err := m.elemOp(unix.BPF_MAP_UPDATE_ELEM, key, value, unix.BPF_ANY); err != nil {
+		return ErrOperationFailedWithReason("update "+m.path, err.Error())
+	}
+
+	return nil
+}
+
+// lookup copies the entry of key into value. Returns false if there is no such entry.
+func (m *bpfMap) lookup(key, value []byte) (bool, error) {
+	err := m.elemOp(unix.BPF_MAP_LOOKUP_ELEM, key, value, 0)
+	if errors.Is(err, unix.ENOENT) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, ErrOperationFailedWithReason("lookup "+m.path, err.Error())
+	}
+
+	return true, nil
+}
+
+// delete removes the entry of key, if any.
+func (m *bpfMap) delete(key []byte) error {
+	err := m.elemOp(unix.BPF_MAP_DELETE_ELEM, key, nil, 0)
+	if err != nil && !errors.Is(err, unix.ENOENT) {
+		return ErrOperationFailedWithReason("delete "+m.path, err.Error())
+	}
+
+	return nil
+}
+
+func (m *bpfMap) close() error {
+	return unix.Close(m.fd)
+}
@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+//go:build !linux
+// +build !linux
+
+package pfcpiface
+
+import "runtime"
+
+// bpfMap is a BPF map pinned to the BPF filesystem by the program loader.
+type bpfMap struct{}
+
+func openPinnedMap(path string) (*bpfMap, error) {
+	return nil, ErrUnsupported("BPF maps on", runtime.GOOS)
+}
+
+func (m *bpfMap) update(key, value []byte) error {
+	return ErrUnsupported("BPF maps on", runtime.GOOS)
+}
+
+func (m *bpfMap) lookup(key, value []byte) (bool, error) {
+	return false, ErrUnsupported("BPF maps on", runtime.GOOS)
+}
+
+func (m *bpfMap) delete(key []byte) error {
+	return ErrUnsupported("BPF maps on", runtime.GOOS)
+}
+
+func (m *bpfMap) close() error {
+	return nil
+}
@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// gtpuMessageTypeGPDU is the GTP-U message type of encapsulated user data.
+	gtpuMessageTypeGPDU = 255
+)
+
+type packetQueue struct {
+	farID   uint32
+	packets [][]byte
+	bytes   uint32
+	dropped uint64
+}
+
+// downlinkBuffer holds the downlink packets of sessions whose FAR asks to buffer
+// (e.g. while the UE is idle) until the FAR is updated to forward or drop them.
+type downlinkBuffer struct {
+	mu         sync.Mutex
+	maxPackets uint32
+	maxBytes   uint32
+	// queues stores one queue per F-SEID, present only while the session buffers.
+	queues map[uint64]*packetQueue
+	// limits stores the packet count suggested by the CP for a session, if any.
+	limits map[uint64]uint32
+}
+
+func newDownlinkBuffer(maxPackets, maxBytes uint32) *downlinkBuffer {
+	return &downlinkBuffer{
+		maxPackets: maxPackets,
+		maxBytes:   maxBytes,
+		queues:     make(map[uint64]*packetQueue),
+		limits:     make(map[uint64]uint32),
+	}
+}
+
+// setPacketLimit applies the Suggested Buffering Packets Count of the session. The
+// configured maximum still applies; zero restores the configured maximum.
+func (b *downlinkBuffer) setPacketLimit(fseid uint64, count uint32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if count == 0 || count > b.maxPackets {
+		delete(b.limits, fseid)
+		return
+	}
+
+	b.limits[fseid] = count
+}
+
+// start begins buffering the downlink packets of the session for FAR farID.
+func (b *downlinkBuffer) start(fseid uint64, farID uint32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if q, ok := b.queues[fseid]; ok {
+		q.farID = farID
+		return
+	}
+
+	b.queues[fseid] = &packetQueue{farID: farID}
+}
+
+// enqueue stores a copy of pkt if the session is buffering and the buffer is not full.
+// Returns true if the packet was stored.
+func (b *downlinkBuffer) enqueue(fseid uint64, pkt []byte) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[fseid]
+	if !ok {
+		return false
+	}
+
+	maxPackets := b.maxPackets
+	if limit, ok := b.limits[fseid]; ok {
+		maxPackets = limit
+	}
+
+	if uint32(len(q.packets)) >= maxPackets || q.bytes+uint32(len(pkt)) > b.maxBytes {
+		q.dropped++
+		return false
+	}
+
+	q.packets = append(q.packets, append([]byte{}, pkt...))
+	q.bytes += uint32(len(pkt))
+
+	return true
+}
+
+// release stops buffering for FAR farID of the session and returns the buffered packets.
+func (b *downlinkBuffer) release(fseid uint64, farID uint32) [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[fseid]
+	if !ok || q.farID != farID {
+		return nil
+	}
+
+	delete(b.queues, fseid)
+
+	return q.packets
+}
+
+// discard stops buffering for FAR farID of the session and drops the buffered packets.
+// Returns the number of packets dropped, including those that did not fit in the buffer.
+func (b *downlinkBuffer) discard(fseid uint64, farID uint32) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[fseid]
+	if !ok || q.farID != farID {
+		return 0
+	}
+
+	delete(b.queues, fseid)
+
+	return uint64(len(q.packets)) + q.dropped
+}
+
+// encapsulateBuffered wraps the inner packet of a buffered Ethernet frame in a GTP-U
+// tunnel towards the access peer of f.
+func encapsulateBuffered(f far, frame []byte) ([]byte, error) {
+	pkt := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.NoCopy)
+
+	eth, ok := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	if !ok {
+		return nil, ErrInvalidArgumentWithReason("buffered packet", len(frame), "not an Ethernet frame")
+	}
+
+	options := gopacket.SerializeOptions{
+		ComputeChecksums: true,
+		FixLengths:       true,
+	}
+	buffer := gopacket.NewSerializeBuffer()
+	ipLayer := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		SrcIP:    int2ip(f.tunnelIP4Src),
+		DstIP:    int2ip(f.tunnelIP4Dst),
+		Protocol: layers.IPProtocolUDP,
+	}
+	ethernetLayer := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0xFF, 0xAA, 0xFA, 0xAA, 0xFF, 0xAA},
+		DstMAC:       net.HardwareAddr{0xBD, 0xBD, 0xBD, 0xBD, 0xBD, 0xBD},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	udpLayer := &layers.UDP{
+		SrcPort: layers.UDPPort(tunnelGTPUPort),
+		DstPort: layers.UDPPort(f.tunnelPort),
+	}
+
+	if err := udpLayer.SetNetworkLayerForChecksum(ipLayer); err != nil {
+		return nil, err
+	}
+
+	gtpLayer := &layers.GTPv1U{
+		Version:      1,
+		MessageType:  gtpuMessageTypeGPDU,
+		ProtocolType: f.tunnelType,
+		TEID:         f.tunnelTEID,
+	}
+
+	err := gopacket.SerializeLayers(buffer, options,
+		ethernetLayer,
+		ipLayer,
+		udpLayer,
+		gtpLayer,
+		gopacket.Payload(eth.Payload),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
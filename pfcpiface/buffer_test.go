@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_downlinkBuffer(t *testing.T) {
+	const (
+		fseid = uint64(1)
+		farID = uint32(2)
+	)
+
+	t.Run("not buffering", func(t *testing.T) {
+		b := newDownlinkBuffer(2, 100)
+
+		require.False(t, b.enqueue(fseid, []byte{1}))
+		require.Nil(t, b.release(fseid, farID))
+	})
+
+	t.Run("release returns buffered packets", func(t *testing.T) {
+		b := newDownlinkBuffer(2, 100)
+		b.start(fseid, farID)
+
+		require.True(t, b.enqueue(fseid, []byte{1}))
+		require.True(t, b.enqueue(fseid, []byte{2}))
+		require.False(t, b.enqueue(fseid, []byte{3}), "packet count limit")
+
+		require.Nil(t, b.release(fseid, farID+1), "other FAR of the session")
+		require.Equal(t, [][]byte{{1}, {2}}, b.release(fseid, farID))
+		require.False(t, b.enqueue(fseid, []byte{4}), "buffering stopped")
+	})
+
+	t.Run("suggested packet count", func(t *testing.T) {
+		b := newDownlinkBuffer(10, 100)
+		b.setPacketLimit(fseid, 1)
+		b.start(fseid, farID)
+
+		require.True(t, b.enqueue(fseid, []byte{1}))
+		require.False(t, b.enqueue(fseid, []byte{2}))
+
+		b.setPacketLimit(fseid, 0)
+		require.True(t, b.enqueue(fseid, []byte{2}), "configured maximum restored")
+	})
+
+	t.Run("discard counts dropped packets", func(t *testing.T) {
+		b := newDownlinkBuffer(10, 4)
+		b.start(fseid, farID)
+
+		require.True(t, b.enqueue(fseid, []byte{1, 2, 3}))
+		require.False(t, b.enqueue(fseid, []byte{4, 5}), "size limit")
+
+		require.Equal(t, uint64(2), b.discard(fseid, farID))
+		require.Equal(t, uint64(0), b.discard(fseid, farID))
+	})
+}
+
+func Test_encapsulateBuffered(t *testing.T) {
+	f := far{
+		tunnelType:   1,
+		tunnelIP4Src: ip2int(net.ParseIP("198.18.0.1")),
+		tunnelIP4Dst: ip2int(net.ParseIP("198.18.0.2")),
+		tunnelTEID:   0x1234,
+		tunnelPort:   tunnelGTPUPort,
+	}
+
+	inner := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(inner, gopacket.SerializeOptions{FixLengths: true},
+		&layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{1, 2, 3, 4, 5, 6},
+			DstMAC:       net.HardwareAddr{6, 5, 4, 3, 2, 1},
+			EthernetType: layers.EthernetTypeIPv4,
+		},
+		&layers.IPv4{
+			Version:  4,
+			TTL:      64,
+			SrcIP:    net.ParseIP("10.0.0.1"),
+			DstIP:    net.ParseIP("10.250.0.1"),
+			Protocol: layers.IPProtocolUDP,
+		},
+		gopacket.Payload([]byte("data")),
+	)
+	require.NoError(t, err)
+
+	out, err := encapsulateBuffered(f, inner.Bytes())
+	require.NoError(t, err)
+
+	pkt := gopacket.NewPacket(out, layers.LayerTypeEthernet, gopacket.Default)
+
+	gtp, ok := pkt.Layer(layers.LayerTypeGTPv1U).(*layers.GTPv1U)
+	require.True(t, ok)
+	require.Equal(t, f.tunnelTEID, gtp.TEID)
+	require.Equal(t, uint8(gtpuMessageTypeGPDU), gtp.MessageType)
+
+	outer, ok := pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	require.True(t, ok)
+	require.True(t, outer.DstIP.Equal(net.ParseIP("198.18.0.2")))
+}
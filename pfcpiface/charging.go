@@ -0,0 +1,263 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	chargingFormatJSON = "json"
+	chargingFormatCSV  = "csv"
+	// chargingKafkaContentType is that of the records posted to a Kafka REST proxy.
+	chargingKafkaContentType = "application/vnd.kafka.json.v2+json"
+)
+
+// Types of the charging records.
+const (
+	chargingRecordInterim = "interim"
+	chargingRecordFinal   = "final"
+)
+
+var chargingCSVHeader = []string{
+	"record_type", "node_id", "peer", "seid", "ue_ip", "sequence", "start_time", "end_time",
+	"duration_seconds", "ul_bytes", "dl_bytes", "ul_packets", "dl_packets",
+}
+
+// chargingRecord is the usage of a session between two records, for offline billing.
+type chargingRecord struct {
+	RecordType string    `json:"record_type"`
+	NodeID     string    `json:"node_id"`
+	Peer       string    `json:"peer"`
+	SEID       uint64    `json:"seid"`
+	UEIP       string    `json:"ue_ip,omitempty"`
+	Sequence   uint32    `json:"sequence"`
+	Start      time.Time `json:"start_time"`
+	End        time.Time `json:"end_time"`
+	Duration   uint64    `json:"duration_seconds"`
+	ULBytes    uint64    `json:"ul_bytes"`
+	DLBytes    uint64    `json:"dl_bytes"`
+	ULPackets  uint64    `json:"ul_packets"`
+	DLPackets  uint64    `json:"dl_packets"`
+}
+
+func (r chargingRecord) csvFields() []string {
+	return []string{
+		r.RecordType, r.NodeID, r.Peer, strconv.FormatUint(r.SEID, 10), r.UEIP,
+		strconv.FormatUint(uint64(r.Sequence), 10), r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339),
+		strconv.FormatUint(r.Duration, 10), strconv.FormatUint(r.ULBytes, 10), strconv.FormatUint(r.DLBytes, 10),
+		strconv.FormatUint(r.ULPackets, 10), strconv.FormatUint(r.DLPackets, 10),
+	}
+}
+
+// chargingExporter writes the charging records to a rotated file and/or posts them
+// to an HTTP endpoint in the background, so that PFCP handling never waits for them.
+// Records are dropped while the queue is full.
+type chargingExporter struct {
+	nodeID string
+
+	file *rotatingFile
+	csv  bool
+
+	url       string
+	kafkaREST bool
+	poster    *webhookNotifier
+
+	// rollover is the period of the interim records, 0 for none.
+	rollover time.Duration
+
+	queue chan chargingRecord
+}
+
+func newChargingExporter(conf ChargingInfo, nodeID string) (*chargingExporter, error) {
+	c := &chargingExporter{
+		nodeID:    nodeID,
+		csv:       conf.Format == chargingFormatCSV,
+		url:       conf.URL,
+		kafkaREST: conf.KafkaREST,
+		queue:     make(chan chargingRecord, conf.QueueSize),
+	}
+
+	if conf.RolloverInterval != "" {
+		c.rollover = validDuration(conf.RolloverInterval)
+	}
+
+	if conf.Path != "" {
+		f, err := newRotatingFile(conf.Path, int64(conf.MaxSizeMB)<<20, conf.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+
+		c.file = f
+	}
+
+	if conf.URL != "" {
+		c.poster = &webhookNotifier{
+			client:        &http.Client{Timeout: validDuration(conf.Timeout)},
+			maxRetries:    webhookMaxRetriesDefault,
+			retryInterval: webhookRetryIntervalDefault,
+		}
+	}
+
+	return c, nil
+}
+
+// export queues r. Nothing is exported by a nil exporter.
+func (c *chargingExporter) export(r chargingRecord) {
+	if c == nil {
+		return
+	}
+
+	r.NodeID = c.nodeID
+
+	select {
+	case c.queue <- r:
+	default:
+		log.Warnln("Charging record queue full, dropping record of session", r.SEID)
+	}
+}
+
+// rolloverInterval returns the period of the interim records, 0 if there are none.
+func (c *chargingExporter) rolloverInterval() time.Duration {
+	if c == nil {
+		return 0
+	}
+
+	return c.rollover
+}
+
+// close closes the file of an exporter that is not run. Nothing is closed for a nil
+// exporter.
+func (c *chargingExporter) close() {
+	if c == nil || c.file == nil {
+		return
+	}
+
+	c.file.Close()
+}
+
+// run writes and posts the queued records until ctx is done.
+func (c *chargingExporter) run(ctx context.Context) {
+	defer func() {
+		if c.file != nil {
+			c.file.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case r := <-c.queue:
+			if c.file != nil {
+				if err := c.write(r); err != nil {
+					log.Errorln("Failed to write charging record:", err)
+				}
+			}
+
+			if c.poster != nil {
+				if err := c.post(ctx, r); err != nil {
+					log.Errorln("Failed to post charging record:", err)
+				}
+			}
+		}
+	}
+}
+
+func (c *chargingExporter) write(r chargingRecord) error {
+	var line []byte
+
+	if c.csv {
+		line = csvLine(r.csvFields())
+		// Each file starts with the header, as do those rotated by this record.
+		if c.file.size == 0 || c.file.size+int64(len(line)) > c.file.maxSize {
+			line = append(csvLine(chargingCSVHeader), line...)
+		}
+	} else {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+
+		line = append(b, '\n')
+	}
+
+	_, err := c.file.Write(line)
+
+	return err
+}
+
+func csvLine(fields []string) []byte {
+	var buf bytes.Buffer
+
+	w := csv.NewWriter(&buf)
+	_ = w.Write(fields)
+	w.Flush()
+
+	return buf.Bytes()
+}
+
+func (c *chargingExporter) post(ctx context.Context, r chargingRecord) error {
+	var (
+		body []byte
+		err  error
+	)
+
+	contentType := "application/json"
+
+	if c.kafkaREST {
+		type kafkaRecord struct {
+			Value chargingRecord `json:"value"`
+		}
+
+		contentType = chargingKafkaContentType
+		body, err = json.Marshal(struct {
+			Records []kafkaRecord `json:"records"`
+		}{Records: []kafkaRecord{{Value: r}}})
+	} else {
+		body, err = json.Marshal(r)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return c.poster.post(ctx, c.url, contentType, body)
+}
+
+// exportChargingRecord exports the usage of session since its last charging record,
+// if that started at least minAge ago.
+func (pConn *PFCPConn) exportChargingRecord(session PFCPSession, recordType string, now time.Time, minAge time.Duration) {
+	if pConn.upf.charging == nil {
+		return
+	}
+
+	usage, ok := pConn.usage.takeCharging(session.localSEID, now, minAge)
+	if !ok {
+		return
+	}
+
+	pConn.upf.charging.export(chargingRecord{
+		RecordType: recordType,
+		Peer:       pConn.nodeID.remote,
+		SEID:       session.localSEID,
+		UEIP:       sessionUEIP(session),
+		Sequence:   usage.seqNum,
+		Start:      usage.start,
+		End:        now,
+		Duration:   uint64(now.Sub(usage.start).Seconds()),
+		ULBytes:    usage.ulBytes,
+		DLBytes:    usage.dlBytes,
+		ULPackets:  usage.ulPackets,
+		DLPackets:  usage.dlPackets,
+	})
+}
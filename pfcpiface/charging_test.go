@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_usageTracker_takeCharging(t *testing.T) {
+	const seid = uint64(1)
+
+	session := PFCPSession{
+		localSEID: seid,
+		PacketForwardingRules: PacketForwardingRules{
+			pdrs: []pdr{
+				{pdrID: 1, fseID: seid, srcIface: access, urrIDList: []uint32{10}},
+				{pdrID: 2, fseID: seid, srcIface: core, urrIDList: []uint32{10, 20}},
+			},
+			urrs: []urr{{urrID: 10}, {urrID: 20}},
+		},
+	}
+
+	counters := func(ul, dl uint64) map[pdrCounterKey]pdrCounters {
+		return map[pdrCounterKey]pdrCounters{
+			{fseID: seid, pdrID: 1}: {packets: ul / 100, bytes: ul},
+			{fseID: seid, pdrID: 2}: {packets: dl / 100, bytes: dl},
+		}
+	}
+
+	tracker := newUsageTracker()
+	start := time.Now()
+
+	tracker.thresholdReports(session, counters(300, 600), start)
+
+	_, ok := tracker.takeCharging(seid, start.Add(time.Second), time.Minute)
+	require.False(t, ok, "no record is due before the rollover interval")
+
+	usage, ok := tracker.takeCharging(seid, start.Add(time.Minute), time.Minute)
+	require.True(t, ok)
+	require.Equal(t, uint64(300), usage.ulBytes)
+	require.Equal(t, uint64(600), usage.dlBytes, "traffic counted by several URRs is charged once")
+	require.Zero(t, usage.seqNum)
+
+	tracker.finalReports(session, counters(400, 1000), start.Add(90*time.Second))
+
+	usage, ok = tracker.takeCharging(seid, start.Add(90*time.Second), 0)
+	require.True(t, ok)
+	require.Equal(t, uint64(100), usage.ulBytes)
+	require.Equal(t, uint64(400), usage.dlBytes)
+	require.Equal(t, uint32(1), usage.seqNum)
+	require.Equal(t, start.Add(time.Minute), usage.start)
+}
+
+func Test_chargingExporter(t *testing.T) {
+	record := chargingRecord{
+		RecordType: chargingRecordFinal,
+		Peer:       "smf1",
+		SEID:       5,
+		UEIP:       "10.250.0.1",
+		Start:      time.Unix(1700000000, 0).UTC(),
+		End:        time.Unix(1700000060, 0).UTC(),
+		Duration:   60,
+		ULBytes:    300,
+		DLBytes:    600,
+	}
+
+	export := func(t *testing.T, conf ChargingInfo) {
+		c, err := newChargingExporter(conf, "upf1")
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+
+		go func() {
+			c.run(ctx)
+			close(done)
+		}()
+
+		c.export(record)
+		c.export(record)
+
+		require.Eventually(t, func() bool { return len(c.queue) == 0 }, time.Second, 10*time.Millisecond)
+		cancel()
+		<-done
+	}
+
+	t.Run("JSON lines", func(t *testing.T) {
+		path := t.TempDir() + "/cdr.json"
+		export(t, ChargingInfo{Path: path, Format: chargingFormatJSON, MaxSizeMB: 1, QueueSize: 8})
+
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		require.Len(t, lines, 2)
+
+		var got chargingRecord
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+		require.Equal(t, "upf1", got.NodeID)
+		require.Equal(t, uint64(600), got.DLBytes)
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		path := t.TempDir() + "/cdr.csv"
+		export(t, ChargingInfo{Path: path, Format: chargingFormatCSV, MaxSizeMB: 1, QueueSize: 8})
+
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		require.Len(t, lines, 3, "a header and a line per record")
+		require.Equal(t, strings.Join(chargingCSVHeader, ","), lines[0])
+		require.Equal(t, "final,upf1,smf1,5,10.250.0.1,0,2023-11-14T22:13:20Z,2023-11-14T22:14:20Z,60,300,600,0,0", lines[1])
+	})
+
+	t.Run("Kafka REST proxy", func(t *testing.T) {
+		bodies := make(chan map[string][]map[string]chargingRecord, 2)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, chargingKafkaContentType, r.Header.Get("Content-Type"))
+
+			var body map[string][]map[string]chargingRecord
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			bodies <- body
+		}))
+		defer srv.Close()
+
+		export(t, ChargingInfo{URL: srv.URL, KafkaREST: true, Timeout: "1s", QueueSize: 8})
+
+		body := <-bodies
+		require.Equal(t, uint64(5), body["records"][0]["value"].SEID)
+	})
+}
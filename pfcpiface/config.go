@@ -7,7 +7,14 @@ import (
 	"github.com/omec-project/upf-epc/internal/p4constants"
 	log "github.com/sirupsen/logrus"
 
+	"gopkg.in/yaml.v3"
+
+	"math"
 	"net"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"encoding/json"
@@ -21,32 +28,101 @@ const (
 	respTimeoutDefault   = 2 * time.Second
 	hbIntervalDefault    = 5 * time.Second
 	readTimeoutDefault   = 15 * time.Second
+	adaptiveHBMaxFactor  = 4
+
+	hbFailureGracePeriodDefault = time.Minute
+
+	dlBufferPacketCountDefault = 64
+	dlBufferSizeDefault        = 256 * 1024
+	gtpuEchoIntervalDefault    = 10 * time.Second
+	gtpuEchoMaxRetriesDefault  = 3
+	endMarkerCountDefault      = 1
+
+	datapathBESS = "bess"
+	datapathXDP  = "xdp"
+	datapathGTP  = "gtp"
+	datapathFake = "fake"
+
+	// rolePSA terminates N6, roleIUPF also relays traffic to other UPFs over N9, e.g.
+	// as an uplink classifier.
+	rolePSA  = "psa"
+	roleIUPF = "i-upf"
+
+	maxQFI  = 0x3f
+	maxDSCP = 0x3f
 )
 
 // Conf : Json conf struct.
 type Conf struct {
-	Mode              string           `json:"mode"`
-	AccessIface       IfaceType        `json:"access"`
-	CoreIface         IfaceType        `json:"core"`
-	CPIface           CPIfaceInfo      `json:"cpiface"`
-	P4rtcIface        P4rtcInfo        `json:"p4rtciface"`
-	EnableP4rt        bool             `json:"enable_p4rt"`
-	EnableFlowMeasure bool             `json:"measure_flow"`
-	SimInfo           SimModeInfo      `json:"sim"`
-	ConnTimeout       uint32           `json:"conn_timeout"` // TODO(max): unused, remove
-	ReadTimeout       uint32           `json:"read_timeout"` // TODO(max): convert to duration string
-	EnableNotifyBess  bool             `json:"enable_notify_bess"`
-	EnableEndMarker   bool             `json:"enable_end_marker"`
-	NotifySockAddr    string           `json:"notify_sockaddr"`
-	EndMarkerSockAddr string           `json:"endmarker_sockaddr"`
-	LogLevel          log.Level        `json:"log_level"`
-	QciQosConfig      []QciQosConfig   `json:"qci_qos_config"`
-	SliceMeterConfig  SliceMeterConfig `json:"slice_rate_limit_config"`
-	MaxReqRetries     uint8            `json:"max_req_retries"`
-	RespTimeout       string           `json:"resp_timeout"`
-	EnableHBTimer     bool             `json:"enable_hbTimer"`
-	HeartBeatInterval string           `json:"heart_beat_interval"`
-	Ueransim          bool             `json:"ueransim"`
+	Mode        string    `json:"mode"`
+	AccessIface IfaceType `json:"access"`
+	CoreIface   IfaceType `json:"core"`
+	// NetworkInstances map the Network Instances of the PDIs and FARs to local interfaces.
+	NetworkInstances      []NetworkInstanceInfo `json:"network_instances"`
+	CPIface               CPIfaceInfo           `json:"cpiface"`
+	P4rtcIface            P4rtcInfo             `json:"p4rtciface"`
+	EnableP4rt            bool                  `json:"enable_p4rt"`
+	Datapath              string                `json:"datapath"`
+	Role                  string                `json:"role"`
+	XDPIface              XDPInfo               `json:"xdp"`
+	GTPIface              GTPInfo               `json:"gtp"`
+	BESSIface             BESSInfo              `json:"bess"`
+	EnableFlowMeasure     bool                  `json:"measure_flow"`
+	SimInfo               SimModeInfo           `json:"sim"`
+	ConnTimeout           uint32                `json:"conn_timeout"` // TODO(max): unused, remove
+	ReadTimeout           uint32                `json:"read_timeout"` // TODO(max): convert to duration string
+	EnableNotifyBess      bool                  `json:"enable_notify_bess"`
+	EnableEndMarker       bool                  `json:"enable_end_marker"`
+	NotifySockAddr        string                `json:"notify_sockaddr"`
+	EndMarkerSockAddr     string                `json:"endmarker_sockaddr"`
+	EndMarkerCount        uint8                 `json:"end_marker_count"`
+	EndMarkerInterval     string                `json:"end_marker_interval"`
+	EnableErrorIndication bool                  `json:"enable_error_indication"`
+	ErrorIndSockAddr      string                `json:"errorind_sockaddr"`
+	LogLevel              log.Level             `json:"log_level"`
+	QciQosConfig          []QciQosConfig        `json:"qci_qos_config"`
+	QfiDscpConfig         []QfiDscpConfig       `json:"qfi_dscp_config"`
+	SliceMeterConfig      SliceMeterConfig      `json:"slice_rate_limit_config"`
+	MaxReqRetries         uint8                 `json:"max_req_retries"`
+	RespTimeout           string                `json:"resp_timeout"`
+	EnableHBTimer         bool                  `json:"enable_hbTimer"`
+	HeartBeatInterval     string                `json:"heart_beat_interval"`
+	AdaptiveHeartbeat     AdaptiveHBInfo        `json:"adaptive_heartbeat"`
+	RetransmissionBackoff BackoffInfo           `json:"retransmission_backoff"`
+	HBFailureAction       string                `json:"heartbeat_failure_action"`
+	HBFailureGracePeriod  string                `json:"heartbeat_failure_grace_period"`
+	Ueransim              bool                  `json:"ueransim"`
+	GracefulReleasePeriod string                `json:"graceful_release_period"`
+	DLBufferPacketCount   uint32                `json:"dl_buffer_packet_count"`
+	DLBufferSize          uint32                `json:"dl_buffer_size"`
+	DDNBatchWindow        string                `json:"ddn_batch_window"`
+	EnableGtpuPathMonitor bool                  `json:"enable_gtpu_path_monitoring"`
+	GtpuEchoInterval      string                `json:"gtpu_echo_interval"`
+	GtpuEchoMaxRetries    uint8                 `json:"gtpu_echo_max_retries"`
+	EnableAsyncWrites     bool                  `json:"enable_async_datapath_writes"`
+	AsyncWriteFailure     string                `json:"async_write_failure_action"`
+	RulesAuditInterval    string                `json:"rules_audit_interval"`
+	PFCPRateLimit         PFCPRateLimitInfo     `json:"pfcp_rate_limit"`
+	PFCPWorkers           uint16                `json:"pfcp_workers"`
+	PFCPTraceSize         uint16                `json:"pfcp_trace_size"`
+	MaxSessions           uint32                `json:"max_sessions"`
+	AuditLog              AuditLogInfo          `json:"audit_log"`
+	Webhooks              WebhookInfo           `json:"webhooks"`
+	Charging              ChargingInfo          `json:"charging"`
+	FlowExport            FlowExportInfo        `json:"flow_export"`
+	Metrics               MetricsInfo           `json:"metrics"`
+	MetricsPush           MetricsPushInfo       `json:"metrics_push"`
+	FARDuplication        FARDuplicationInfo    `json:"far_duplication"`
+	LocalSwitching        LocalSwitchingInfo    `json:"local_switching"`
+	NeighborProxy         NeighborProxyInfo     `json:"neighbor_proxy"`
+	FARRedirect           FARRedirectInfo       `json:"far_redirect"`
+	HeaderEnrichment      HeaderEnrichmentInfo  `json:"header_enrichment"`
+	SessionEvents         SessionEventsInfo     `json:"session_events"`
+	HA                    HAInfo                `json:"ha"`
+	LeaderElection        LeaderElectionInfo    `json:"leader_election"`
+	LoadControl           LoadControlInfo       `json:"load_control"`
+	OverloadControl       OverloadControlInfo   `json:"overload_control"`
+	SessionGC             SessionGCInfo         `json:"session_gc"`
 }
 
 // QciQosConfig : Qos configured attributes.
@@ -59,6 +135,12 @@ type QciQosConfig struct {
 	SchedulingPriority uint32 `json:"priority"`
 }
 
+// QfiDscpConfig : DSCP codepoint marked on the outer IP header of GTP-U packets of a QFI.
+type QfiDscpConfig struct {
+	QFI  uint8 `json:"qfi"`
+	DSCP uint8 `json:"dscp"`
+}
+
 type SliceMeterConfig struct {
 	N6RateBps    uint64 `json:"n6_bps"`
 	N6BurstBytes uint64 `json:"n6_burst_bytes"`
@@ -66,27 +148,370 @@ type SliceMeterConfig struct {
 	N3BurstBytes uint64 `json:"n3_burst_bytes"`
 }
 
+// PFCPRateLimitInfo : rate limit of the session related requests of each CP node.
+type PFCPRateLimitInfo struct {
+	// Rate is in requests per second, no limit if zero.
+	Rate   float64 `json:"rate"`
+	Burst  uint32  `json:"burst"`
+	Action string  `json:"action"`
+}
+
+// HAInfo : active-standby replication of the sessions.
+type HAInfo struct {
+	// Role is active or standby, no replication if empty.
+	Role string `json:"role"`
+	// ActiveURL is the HTTP endpoint of the active instance, replicated by a standby.
+	ActiveURL       string `json:"active_url"`
+	FailoverTimeout string `json:"failover_timeout"`
+}
+
+// LoadControlInfo : load reported to the CP nodes in the Load Control Information IE.
+type LoadControlInfo struct {
+	Enable bool `json:"enable"`
+	// MaxSessions is the session count of a full load, the session count is not part
+	// of the load if zero.
+	MaxSessions uint32 `json:"max_sessions"`
+	Interval    string `json:"interval"`
+}
+
+// OverloadControlInfo : throttling of the requests of the CP nodes while overloaded,
+// asked for in the Overload Control Information IE.
+type OverloadControlInfo struct {
+	Enable bool `json:"enable"`
+	// Threshold is the load metric entering overload, ClearThreshold the one leaving it.
+	Threshold      uint8 `json:"threshold"`
+	ClearThreshold uint8 `json:"clear_threshold"`
+	// Reduction is the percentage of requests the CP nodes are asked to throttle.
+	Reduction uint8  `json:"reduction"`
+	Period    string `json:"period"`
+}
+
+// SessionGCInfo : removal of the sessions whose association is gone.
+type SessionGCInfo struct {
+	Enable bool `json:"enable"`
+	// GracePeriod is how long the association must be gone for its sessions to be removed.
+	GracePeriod string `json:"grace_period"`
+	Interval    string `json:"interval"`
+}
+
+// LeaderElectionInfo : Kubernetes Lease based election of the replica serving N4.
+type LeaderElectionInfo struct {
+	Enable bool `json:"enable"`
+	// Namespace of the Lease, the namespace of the pod if empty.
+	Namespace string `json:"namespace"`
+	LeaseName string `json:"lease_name"`
+	// Identity of the replica in the Lease, the hostname if empty.
+	Identity string `json:"identity"`
+	// ReplicationURL is the HTTP endpoint the followers replicate the sessions from
+	// while this replica leads, derived from the local IP and HTTP port if empty.
+	ReplicationURL string `json:"replication_url"`
+	// APIServer is the URL of the Kubernetes API server, the in-cluster one if empty.
+	APIServer     string `json:"api_server"`
+	LeaseDuration string `json:"lease_duration"`
+	RenewDeadline string `json:"renew_deadline"`
+	RetryPeriod   string `json:"retry_period"`
+}
+
+// AdaptiveHBInfo : bounds of the response timeout and heartbeat interval adapted to
+// the round-trip time measured to each CP node.
+type AdaptiveHBInfo struct {
+	Enabled        bool   `json:"enabled"`
+	MinRespTimeout string `json:"min_resp_timeout"`
+	MaxRespTimeout string `json:"max_resp_timeout"`
+	MinInterval    string `json:"min_interval"`
+	MaxInterval    string `json:"max_interval"`
+}
+
+// BackoffInfo : backoff of the response timeout between the retransmissions of the
+// requests sent to the CP nodes.
+type BackoffInfo struct {
+	// Strategy is fixed, exponential or exponential_jitter.
+	Strategy   string `json:"strategy"`
+	MaxTimeout string `json:"max_timeout"`
+}
+
+// AuditLogInfo : Session audit log settings.
+type AuditLogInfo struct {
+	Enable bool `json:"enable"`
+	// Path is the file the events are appended to, rotated once larger than MaxSizeMB.
+	Path       string `json:"path"`
+	MaxSizeMB  int    `json:"max_size_mb"`
+	MaxBackups int    `json:"max_backups"`
+	// Syslog is the syslog server the events are sent to, e.g. udp://198.18.0.10:514,
+	// or local for the syslog of the host.
+	Syslog string `json:"syslog"`
+}
+
+// WebhookInfo : Webhooks notified of the association and session events.
+type WebhookInfo struct {
+	URLs []string `json:"urls"`
+	// Events are those posted, all of them if empty.
+	Events        []string `json:"events"`
+	Timeout       string   `json:"timeout"`
+	MaxRetries    int      `json:"max_retries"`
+	RetryInterval string   `json:"retry_interval"`
+	QueueSize     int      `json:"queue_size"`
+}
+
+// ChargingInfo : Export of charging records of the usage measured by the URRs.
+type ChargingInfo struct {
+	Enable bool `json:"enable"`
+	// Path is the file the records are appended to, as JSON lines or CSV after Format,
+	// rotated once larger than MaxSizeMB.
+	Path       string `json:"path"`
+	Format     string `json:"format"`
+	MaxSizeMB  int    `json:"max_size_mb"`
+	MaxBackups int    `json:"max_backups"`
+	// URL is the HTTP endpoint the records are posted to as JSON, in the format of the
+	// Kafka REST proxy if KafkaREST is set.
+	URL       string `json:"url"`
+	KafkaREST bool   `json:"kafka_rest"`
+	Timeout   string `json:"timeout"`
+	QueueSize int    `json:"queue_size"`
+	// RolloverInterval is the period of the interim records of each session, only
+	// written on deletion if unset.
+	RolloverInterval string `json:"rollover_interval"`
+}
+
+// FlowExportInfo : Export of the traffic of each PDR to an IPFIX collector.
+type FlowExportInfo struct {
+	Enable bool `json:"enable"`
+	// Collector is the UDP address of the collector, as host:port.
+	Collector           string `json:"collector"`
+	Interval            string `json:"interval"`
+	ObservationDomainID uint32 `json:"observation_domain_id"`
+	// EnterpriseNumber is the Private Enterprise Number of the QFI element.
+	EnterpriseNumber uint32 `json:"enterprise_number"`
+}
+
+// LocalSwitchingInfo : Switching of the traffic between the UEs of a 5G VN group within
+// the UPF, instead of hairpinning it via N6.
+type LocalSwitchingInfo struct {
+	Enable bool `json:"enable"`
+	// Groups are switched by UE subnet, besides the FARs forwarding to 5G VN internal.
+	Groups []VNGroupInfo `json:"groups"`
+}
+
+// VNGroupInfo : 5G VN group of the UEs of the subnets.
+type VNGroupInfo struct {
+	Name      string   `json:"name"`
+	UESubnets []string `json:"ue_subnets"`
+}
+
+// NeighborProxyInfo : Answering of the ARP requests for the UE addresses on the core
+// interface, so that the routers of N6 resolve them to the UPF without static routes.
+type NeighborProxyInfo struct {
+	Enable bool `json:"enable"`
+	// Pools are the IPv4 subnets whose UE addresses are proxied, the UE IP pools if empty.
+	Pools []string `json:"pools"`
+}
+
+// MetricsInfo : Naming, labels and collectors of the exported metrics.
+type MetricsInfo struct {
+	// Namespace prefixes the names of all the metrics, followed by an underscore.
+	Namespace string `json:"namespace"`
+	// Labels are attached to all the metrics, e.g. the site or the UPF ID.
+	Labels map[string]string `json:"labels"`
+	// DisabledCollectors are the collectors not run on scrapes, to save their cost or
+	// their cardinality.
+	DisabledCollectors []string `json:"disabled_collectors"`
+}
+
+// MetricsPushInfo : Periodic push of the metrics to a Prometheus Pushgateway.
+type MetricsPushInfo struct {
+	Enable bool `json:"enable"`
+	// URL is the base URL of the Pushgateway.
+	URL      string `json:"url"`
+	Job      string `json:"job"`
+	Interval string `json:"interval"`
+	// Grouping are the labels of the group of the UPF, besides the job.
+	Grouping map[string]string `json:"grouping"`
+	// DeleteOnStop deletes the group on shutdown rather than pushing it a last time.
+	DeleteOnStop bool `json:"delete_on_stop"`
+}
+
+// FARDuplicationInfo : Mirroring of the traffic of the FARs with Duplicating
+// Parameters, e.g. to a lawful intercept mediation function.
+type FARDuplicationInfo struct {
+	Enable bool `json:"enable"`
+	// Mode is gtpu to tunnel the copies to Endpoint, with the TEID of the Duplicating
+	// Parameters, or raw to send them unmodified out of IfName (BESS) or Port (UP4).
+	Mode     string `json:"mode"`
+	Endpoint string `json:"endpoint"`
+	IfName   string `json:"ifname"`
+	Port     uint32 `json:"port"`
+}
+
+// FARRedirectInfo : Redirection of the uplink traffic of the FARs with Redirect
+// Information, e.g. to a captive portal.
+type FARRedirectInfo struct {
+	Enable bool `json:"enable"`
+	// Gateway is the IPv4 address the traffic redirected to an IPv6 address, URL or SIP
+	// URI is tunneled to. Unset, such redirections are rejected.
+	Gateway string `json:"gateway"`
+}
+
+// HeaderEnrichmentInfo : Insertion of headers into the uplink HTTP requests of the
+// FARs with Header Enrichment or an enriching Forwarding Policy.
+type HeaderEnrichmentInfo struct {
+	Enable bool `json:"enable"`
+	// Proxy is the IPv4 address of the enrichment proxy the traffic is tunneled to.
+	Proxy string `json:"proxy"`
+	// Policies are the headers inserted, by name, for each Forwarding Policy Identifier.
+	Policies map[string]map[string]string `json:"policies"`
+}
+
+// SessionEventsInfo : gRPC feed of the session lifecycle and usage events.
+type SessionEventsInfo struct {
+	Enable bool `json:"enable"`
+	// Address is the TCP address of the gRPC server, as [host]:port.
+	Address   string `json:"address"`
+	QueueSize int    `json:"queue_size"`
+}
+
 // SimModeInfo : Sim mode attributes.
 type SimModeInfo struct {
+	// Profile is a JSON or YAML file of sim attributes, overriding those of the config.
+	Profile     string `json:"profile"`
 	MaxSessions uint32 `json:"max_sessions"`
-	StartUEIP   net.IP `json:"start_ue_ip"`
-	StartENBIP  net.IP `json:"start_enb_ip"`
-	StartAUPFIP net.IP `json:"start_aupf_ip"`
-	N6AppIP     net.IP `json:"n6_app_ip"`
-	N9AppIP     net.IP `json:"n9_app_ip"`
-	StartN3TEID string `json:"start_n3_teid"`
-	StartN9TEID string `json:"start_n9_teid"`
+	// SessionsPerSecond paces the creation and deletion of sessions, unlimited if 0.
+	SessionsPerSecond uint32 `json:"sessions_per_second"`
+	StartUEIP         net.IP `json:"start_ue_ip"`
+	// UEIPRanges are the IPv4 CIDRs the UE addresses are taken from, in order,
+	// instead of the addresses following StartUEIP.
+	UEIPRanges  []string `json:"ue_ip_ranges"`
+	StartENBIP  net.IP   `json:"start_enb_ip"`
+	NumGNBs     uint32   `json:"num_gnbs"`
+	StartAUPFIP net.IP   `json:"start_aupf_ip"`
+	N6AppIP     net.IP   `json:"n6_app_ip"`
+	N9AppIP     net.IP   `json:"n9_app_ip"`
+	StartN3TEID string   `json:"start_n3_teid"`
+	StartN9TEID string   `json:"start_n9_teid"`
+	// Interfaces are the core interfaces, n6 and/or n9, with rules in each session.
+	Interfaces []string `json:"interfaces"`
 }
 
 // CPIfaceInfo : CPIface interface settings.
 type CPIfaceInfo struct {
-	Peers           []string `json:"peers"`
-	UseFQDN         bool     `json:"use_fqdn"`
-	NodeID          string   `json:"hostname"`
-	HTTPPort        string   `json:"http_port"`
-	Dnn             string   `json:"dnn"`
-	EnableUeIPAlloc bool     `json:"enable_ue_ip_alloc"`
-	UEIPPool        string   `json:"ue_ip_pool"`
+	Peers           []PeerInfo `json:"peers"`
+	UseFQDN         bool       `json:"use_fqdn"`
+	NodeID          string     `json:"hostname"`
+	HTTPPort        string     `json:"http_port"`
+	Dnn             string     `json:"dnn"`
+	EnableUeIPAlloc bool       `json:"enable_ue_ip_alloc"`
+	UEIPPool        string     `json:"ue_ip_pool"`
+	UEIPv6Pool      string     `json:"ue_ipv6_pool"`
+	UEIPAllocFile   string     `json:"ue_ip_alloc_file"`
+	UEIPLeaseTTL    string     `json:"ue_ip_lease_ttl"`
+	// UEIPPools are the pools of DNNs not served by UEIPPool.
+	UEIPPools []UEIPPoolInfo `json:"ue_ip_pools"`
+	// DNNs are the Data Networks served, any if empty. The Network Instance of each PDI
+	// must be that of one of them.
+	DNNs []DNNInfo `json:"dnns"`
+	// IPAM is the external IPAM allocating UE IPs instead of the local pools.
+	IPAM IPAMInfo `json:"ipam"`
+	// PFCPBindIP and PFCPPort are the local N4 address, all addresses if no IP is set.
+	PFCPBindIP string `json:"pfcp_bind_ip"`
+	PFCPPort   string `json:"pfcp_port"`
+	// AllowedPeers are the CP nodes allowed to set up an association, all if empty.
+	AllowedPeers []string `json:"allowed_peers"`
+	// NodeIP is advertised to the CP nodes in the Node ID and F-SEIDs instead of the
+	// local N4 address, e.g. the address of a PFCP load balancer in front of the UPF.
+	NodeIP string `json:"node_ip"`
+	// EnableFTUP has the UPF allocate the F-TEIDs of the PDIs with the CHOOSE flag,
+	// from the TEID range of their CP node.
+	EnableFTUP    bool            `json:"enable_ftup"`
+	TEIDRanges    []TEIDRangeInfo `json:"teid_ranges"`
+	TEIDAllocFile string          `json:"teid_alloc_file"`
+	// RecoveryStateFile persists the Recovery Time Stamp and the associated CP nodes,
+	// to signal a restart to them.
+	RecoveryStateFile string `json:"recovery_state_file"`
+}
+
+// PeerInfo : CP node the UPF connects to, with overrides of the PFCP timers of its
+// connection, e.g. for a remote SMF. A peer without overrides is given as its address.
+type PeerInfo struct {
+	Address           string `json:"address"`
+	RespTimeout       string `json:"resp_timeout,omitempty"`
+	MaxReqRetries     uint8  `json:"max_req_retries,omitempty"`
+	HeartBeatInterval string `json:"heart_beat_interval,omitempty"`
+}
+
+// UnmarshalJSON decodes a peer from its address or from an object.
+func (p *PeerInfo) UnmarshalJSON(b []byte) error {
+	var address string
+	if err := json.Unmarshal(b, &address); err == nil {
+		*p = PeerInfo{Address: address}
+		return nil
+	}
+
+	type peerInfo PeerInfo
+
+	return json.Unmarshal(b, (*peerInfo)(p))
+}
+
+// peerAddresses returns the addresses of peers.
+func peerAddresses(peers []PeerInfo) []string {
+	addresses := make([]string, 0, len(peers))
+	for _, p := range peers {
+		addresses = append(addresses, p.Address)
+	}
+
+	return addresses
+}
+
+// TEIDRangeInfo : TEIDs allocated to the PDIs of a CP node, by node ID, or of any
+// other CP node if no peer is set.
+type TEIDRangeInfo struct {
+	Peer  string `json:"peer"`
+	Start uint32 `json:"start"`
+	End   uint32 `json:"end"`
+}
+
+// IPAMInfo : external IPAM settings.
+type IPAMInfo struct {
+	URL     string `json:"url"`
+	Timeout string `json:"timeout"`
+}
+
+// UEIPPoolInfo : UE IP pool serving the sessions of a DNN, optionally bound to a slice.
+type UEIPPoolInfo struct {
+	Dnn      string `json:"dnn"`
+	Pool     string `json:"ue_ip_pool"`
+	IPv6Pool string `json:"ue_ipv6_pool"`
+	Slice    string `json:"slice"`
+}
+
+// DNNInfo : Data Network served by the UPF, with its own UE IP pools and slice.
+type DNNInfo struct {
+	Dnn string `json:"dnn"`
+	// NetworkInstance is sent by the CP nodes in the PDIs of the DNN, the DNN if empty.
+	NetworkInstance string `json:"network_instance"`
+	Pool            string `json:"ue_ip_pool"`
+	IPv6Pool        string `json:"ue_ipv6_pool"`
+	Slice           string `json:"slice"`
+}
+
+// networkInstance returns the Network Instance of the DNN.
+func (d DNNInfo) networkInstance() string {
+	if d.NetworkInstance != "" {
+		return d.NetworkInstance
+	}
+
+	return d.Dnn
+}
+
+// ueIPPools returns the pools of UEIPPools and those of the DNNs.
+func (c CPIfaceInfo) ueIPPools() []UEIPPoolInfo {
+	pools := append([]UEIPPoolInfo{}, c.UEIPPools...)
+
+	for _, d := range c.DNNs {
+		if d.Pool != "" {
+			pools = append(pools, UEIPPoolInfo{Dnn: d.Dnn, Pool: d.Pool, IPv6Pool: d.IPv6Pool, Slice: d.Slice})
+		}
+	}
+
+	return pools
 }
 
 // IfaceType : Gateway interface struct.
@@ -94,6 +519,39 @@ type IfaceType struct {
 	IfName string `json:"ifname"`
 }
 
+// NetworkInstanceInfo : local interface of a PFCP Network Instance.
+type NetworkInstanceInfo struct {
+	NetworkInstance string `json:"network_instance"`
+	// Interface is access or core, the side of the UPF the interface is on.
+	Interface string `json:"interface"`
+	// IfName and IP are the interface, or VRF, and its IP, read from IfName if unset.
+	IfName string `json:"ifname"`
+	IP     string `json:"ip"`
+	// PeerSubnets are the IPv4 subnets of the tunnel peers reached by the interface, e.g.
+	// the gNBs of a site, whose tunnels are sourced from its IP whatever their Network
+	// Instance.
+	PeerSubnets []string `json:"peer_subnets"`
+}
+
+// XDPInfo : eBPF/XDP datapath settings.
+type XDPInfo struct {
+	PinPath string `json:"pin_path"`
+}
+
+// GTPInfo : Linux kernel GTP datapath settings.
+type GTPInfo struct {
+	IfName string `json:"ifname"`
+}
+
+// BESSInfo : gRPC settings of the connection to BESS.
+type BESSInfo struct {
+	CallTimeout      string `json:"call_timeout"`
+	KeepaliveTime    string `json:"keepalive_time"`
+	KeepaliveTimeout string `json:"keepalive_timeout"`
+	MaxRecvMsgSize   int    `json:"max_recv_msg_size"`
+	MaxSendMsgSize   int    `json:"max_send_msg_size"`
+}
+
 // P4rtcInfo : P4 runtime interface settings.
 type P4rtcInfo struct {
 	SliceID             uint8           `json:"slice_id"`
@@ -102,114 +560,1163 @@ type P4rtcInfo struct {
 	P4rtcPort           string          `json:"p4rtc_port"`
 	QFIToTC             map[uint8]uint8 `json:"qfi_tc_mapping"`
 	DefaultTC           uint8           `json:"default_tc"`
+	DefaultQFI          uint8           `json:"default_qfi"`
 	ClearStateOnRestart bool            `json:"clear_state_on_restart"`
+	TLS                 P4rtcTLSInfo    `json:"tls"`
+	ElectionID          uint64          `json:"election_id"`
+	RoleID              uint64          `json:"role_id"`
 }
 
-// validateConf checks that the given config reaches a baseline of correctness.
-func validateConf(conf Conf) error {
-	if conf.EnableP4rt {
-		_, _, err := net.ParseCIDR(conf.P4rtcIface.AccessIP)
-		if err != nil {
-			return ErrInvalidArgumentWithReason("conf.P4rtcIface.AccessIP", conf.P4rtcIface.AccessIP, err.Error())
+// P4rtcTLSInfo : TLS settings of the P4Runtime channel.
+type P4rtcTLSInfo struct {
+	Enabled    bool   `json:"enabled"`
+	CACert     string `json:"ca_cert"`
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+	ServerName string `json:"server_name"`
+}
+
+// confErrors are all the problems found in a config.
+type confErrors []error
+
+func (e *confErrors) add(err error) {
+	*e = append(*e, err)
+}
+
+func (e confErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+func (e confErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+func (e confErrors) Unwrap() []error {
+	return e
+}
+
+// validIfaceName reports whether name can name a Linux network interface.
+func validIfaceName(name string) bool {
+	if len(name) >= 16 || name == "." || name == ".." {
+		return false
+	}
+
+	return !strings.ContainsAny(name, "/: \t\n")
+}
+
+// setDurationDefault sets the duration setting s to d if unset.
+func setDurationDefault(s *string, d time.Duration) {
+	if *s == "" {
+		*s = d.String()
+	}
+}
+
+// validDuration parses a duration checked by validateConf, zero if unset.
+func validDuration(s string) time.Duration {
+	d, _ := time.ParseDuration(s)
+	return d
+}
+
+// validateIPAM checks the external IPAM settings, which replace the local UE IP pools
+// but for the UP4 routes to ue_ip_pool.
+func validateIPAM(conf Conf, errs *confErrors) {
+	ipam := conf.CPIface.IPAM
+	if ipam.URL == "" {
+		return
+	}
+
+	u, err := url.Parse(ipam.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.add(ErrInvalidArgumentWithReason("conf.CPIface.IPAM.URL", ipam.URL, "invalid HTTP URL"))
+	}
+
+	if ipam.Timeout != "" {
+		if d, err := time.ParseDuration(ipam.Timeout); err != nil || d <= 0 {
+			errs.add(ErrInvalidArgumentWithReason("conf.CPIface.IPAM.Timeout", ipam.Timeout, "invalid duration"))
 		}
+	}
 
-		_, _, err = net.ParseCIDR(conf.CPIface.UEIPPool)
-		if err != nil {
-			return ErrInvalidArgumentWithReason("conf.UEIPPool", conf.CPIface.UEIPPool, err.Error())
+	if len(conf.CPIface.ueIPPools()) > 0 || conf.CPIface.UEIPv6Pool != "" || conf.CPIface.UEIPAllocFile != "" ||
+		conf.CPIface.UEIPLeaseTTL != "" {
+		errs.add(ErrInvalidArgumentWithReason("conf.CPIface.IPAM", ipam.URL,
+			"ue_ip_pools, the pools of dnns, ue_ipv6_pool, ue_ip_alloc_file and ue_ip_lease_ttl are managed by the external IPAM"))
+	}
+
+}
+
+// validateAdaptiveHB checks that the bounds of the adaptive timers are ordered durations.
+func validateSim(s SimModeInfo, errs *confErrors) {
+	var size uint64
+
+	for _, r := range s.UEIPRanges {
+		_, ipNet, err := net.ParseCIDR(r)
+		if err != nil || ipNet.IP.To4() == nil {
+			errs.add(ErrInvalidArgumentWithReason("conf.SimInfo.UEIPRanges", r, "invalid IPv4 CIDR"))
+			continue
 		}
 
-		if conf.Mode != "" {
-			return ErrInvalidArgumentWithReason("conf.Mode", conf.Mode, "mode must not be set for UP4")
+		ones, bits := ipNet.Mask.Size()
+		size += 1 << uint(bits-ones)
+	}
+
+	if len(s.UEIPRanges) > 0 && size < uint64(s.MaxSessions) {
+		errs.add(ErrInvalidArgumentWithReason("conf.SimInfo.UEIPRanges", s.UEIPRanges,
+			"ranges are smaller than max_sessions"))
+	}
+
+	for _, iface := range s.Interfaces {
+		if iface != simIfaceN6 && iface != simIfaceN9 {
+			errs.add(ErrInvalidArgumentWithReason("conf.SimInfo.Interfaces", iface, "invalid interface"))
 		}
-	} else {
-		// Mode is only relevant in a BESS deployment.
-		validModes := map[string]struct{}{
-			"af_xdp":    {},
-			"af_packet": {},
-			"cndp":      {},
-			"dpdk":      {},
-			"sim":       {},
+	}
+}
+
+// validateDNNs checks that the DNNs and their Network Instances are unique, their
+// pools being checked with ue_ip_pools.
+func validateDNNs(dnns []DNNInfo, errs *confErrors) {
+	names := make(map[string]struct{}, len(dnns))
+	instances := make(map[string]struct{}, len(dnns))
+
+	for _, d := range dnns {
+		if d.Dnn == "" {
+			errs.add(ErrInvalidArgumentWithReason("conf.CPIface.DNNs", d, "DNN must be set"))
+			continue
 		}
-		if _, ok := validModes[conf.Mode]; !ok {
-			return ErrInvalidArgumentWithReason("conf.Mode", conf.Mode, "invalid mode")
+
+		if _, ok := names[d.Dnn]; ok {
+			errs.add(ErrInvalidArgumentWithReason("conf.CPIface.DNNs", d.Dnn, "duplicate DNN"))
+		}
+
+		if _, ok := instances[d.networkInstance()]; ok {
+			errs.add(ErrInvalidArgumentWithReason("conf.CPIface.DNNs", d.networkInstance(), "duplicate network instance"))
 		}
+
+		names[d.Dnn] = struct{}{}
+		instances[d.networkInstance()] = struct{}{}
 	}
+}
 
-	if conf.CPIface.EnableUeIPAlloc {
-		_, _, err := net.ParseCIDR(conf.CPIface.UEIPPool)
-		if err != nil {
-			return ErrInvalidArgumentWithReason("conf.UEIPPool", conf.CPIface.UEIPPool, err.Error())
+func validateNetworkInstances(nis []NetworkInstanceInfo, errs *confErrors) {
+	names := make(map[string]struct{}, len(nis))
+
+	for _, ni := range nis {
+		if ni.NetworkInstance == "" {
+			errs.add(ErrInvalidArgumentWithReason("conf.NetworkInstances", ni, "network instance must be set"))
+			continue
+		}
+
+		if _, ok := names[ni.NetworkInstance]; ok {
+			errs.add(ErrInvalidArgumentWithReason("conf.NetworkInstances", ni.NetworkInstance, "duplicate network instance"))
+		}
+
+		names[ni.NetworkInstance] = struct{}{}
+
+		if ni.Interface != niInterfaceAccess && ni.Interface != niInterfaceCore {
+			errs.add(ErrInvalidArgumentWithReason("conf.NetworkInstances.Interface", ni.Interface, "must be access or core"))
+		}
+
+		if ni.IP != "" && net.ParseIP(ni.IP).To4() == nil {
+			errs.add(ErrInvalidArgumentWithReason("conf.NetworkInstances.IP", ni.IP, "invalid IPv4 address"))
+		}
+
+		for _, subnet := range ni.PeerSubnets {
+			if ip, _, err := net.ParseCIDR(subnet); err != nil || ip.To4() == nil {
+				errs.add(ErrInvalidArgumentWithReason("conf.NetworkInstances.PeerSubnets", subnet, "must be an IPv4 CIDR"))
+			}
 		}
 	}
+}
 
-	for _, peer := range conf.CPIface.Peers {
-		ip := net.ParseIP(peer)
-		if ip == nil {
-			return ErrInvalidArgumentWithReason("conf.CPIface.Peers", peer, "invalid IP")
+func validateFTUP(c CPIfaceInfo, errs *confErrors) {
+	if !c.EnableFTUP {
+		if len(c.TEIDRanges) > 0 || c.TEIDAllocFile != "" {
+			errs.add(ErrInvalidArgumentWithReason("conf.CPIface.TEIDRanges", c.TEIDRanges, "enable_ftup must be set"))
 		}
+
+		return
 	}
 
-	if _, err := time.ParseDuration(conf.RespTimeout); err != nil {
-		return ErrInvalidArgumentWithReason("conf.RespTimeout", conf.RespTimeout, "invalid duration")
+	peers := make(map[string]struct{}, len(c.TEIDRanges))
+
+	for i, r := range c.TEIDRanges {
+		if r.Start == 0 || r.End < r.Start {
+			errs.add(ErrInvalidArgumentWithReason("conf.CPIface.TEIDRanges", r, "invalid range"))
+			continue
+		}
+
+		if _, ok := peers[r.Peer]; ok {
+			errs.add(ErrInvalidArgumentWithReason("conf.CPIface.TEIDRanges", r.Peer, "duplicate peer"))
+		}
+
+		peers[r.Peer] = struct{}{}
+
+		for _, other := range c.TEIDRanges[:i] {
+			if r.Start <= other.End && other.Start <= r.End {
+				errs.add(ErrInvalidArgumentWithReason("conf.CPIface.TEIDRanges", r, "overlaps another range"))
+			}
+		}
 	}
+}
 
-	if conf.ReadTimeout == 0 {
-		return ErrInvalidArgumentWithReason("conf.ReadTimeout", conf.ReadTimeout, "invalid duration")
+func validateAuditLog(a AuditLogInfo, errs *confErrors) {
+	if !a.Enable {
+		return
 	}
 
-	if conf.MaxReqRetries == 0 {
-		return ErrInvalidArgumentWithReason("conf.MaxReqRetries", conf.MaxReqRetries, "invalid number of retries")
+	if a.Path == "" && a.Syslog == "" {
+		errs.add(ErrInvalidArgumentWithReason("conf.AuditLog", a, "path or syslog must be set"))
 	}
 
-	if conf.EnableHBTimer {
-		if _, err := time.ParseDuration(conf.HeartBeatInterval); err != nil {
-			return err
+	if a.MaxSizeMB < 0 || a.MaxBackups < 0 {
+		errs.add(ErrInvalidArgumentWithReason("conf.AuditLog", a, "size and backups must not be negative"))
+	}
+
+	if a.Syslog != "" && a.Syslog != auditLogSyslogLocal {
+		u, err := url.Parse(a.Syslog)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			errs.add(ErrInvalidArgumentWithReason("conf.AuditLog.Syslog", a.Syslog, "invalid syslog address"))
+		}
+	}
+}
+
+func validateWebhooks(w WebhookInfo, errs *confErrors) {
+	for _, u := range w.URLs {
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			errs.add(ErrInvalidArgumentWithReason("conf.Webhooks.URLs", u, "invalid HTTP URL"))
+		}
+	}
+
+	for _, e := range w.Events {
+		known := false
+
+		for _, k := range webhookEvents {
+			known = known || e == k
+		}
+
+		if !known {
+			errs.add(ErrInvalidArgumentWithReason("conf.Webhooks.Events", e, "unknown event"))
 		}
 	}
 
-	return nil
+	for name, d := range map[string]string{"conf.Webhooks.Timeout": w.Timeout, "conf.Webhooks.RetryInterval": w.RetryInterval} {
+		if d == "" {
+			continue
+		}
+
+		if v, err := time.ParseDuration(d); err != nil || v <= 0 {
+			errs.add(ErrInvalidArgumentWithReason(name, d, "invalid duration"))
+		}
+	}
+
+	if w.MaxRetries < 0 || w.QueueSize < 0 {
+		errs.add(ErrInvalidArgumentWithReason("conf.Webhooks", w, "retries and queue size must not be negative"))
+	}
 }
 
-// LoadConfigFile : parse json file and populate corresponding struct.
-func LoadConfigFile(filepath string) (Conf, error) {
-	// Open up file.
-	jsonFile, err := os.Open(filepath)
-	if err != nil {
-		return Conf{}, err
+func validateCharging(c ChargingInfo, errs *confErrors) {
+	if !c.Enable {
+		return
 	}
-	defer jsonFile.Close()
 
-	// Read our file into memory.
-	byteValue, err := io.ReadAll(jsonFile)
-	if err != nil {
-		return Conf{}, err
+	if c.Path == "" && c.URL == "" {
+		errs.add(ErrInvalidArgumentWithReason("conf.Charging", c, "path or url must be set"))
 	}
 
-	var conf Conf
-	conf.LogLevel = log.InfoLevel
-	conf.P4rtcIface.DefaultTC = uint8(p4constants.EnumTrafficClassElastic)
+	if c.Format != chargingFormatJSON && c.Format != chargingFormatCSV {
+		errs.add(ErrInvalidArgumentWithReason("conf.Charging.Format", c.Format, "must be json or csv"))
+	}
 
-	err = json.Unmarshal(byteValue, &conf)
-	if err != nil {
-		return Conf{}, err
+	if c.URL != "" {
+		if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			errs.add(ErrInvalidArgumentWithReason("conf.Charging.URL", c.URL, "invalid HTTP URL"))
+		}
 	}
 
-	// Set defaults, when missing.
-	if conf.RespTimeout == "" {
-		conf.RespTimeout = respTimeoutDefault.String()
+	for name, d := range map[string]string{"conf.Charging.Timeout": c.Timeout, "conf.Charging.RolloverInterval": c.RolloverInterval} {
+		if d == "" {
+			continue
+		}
+
+		if v, err := time.ParseDuration(d); err != nil || v <= 0 {
+			errs.add(ErrInvalidArgumentWithReason(name, d, "invalid duration"))
+		}
 	}
 
-	if conf.ReadTimeout == 0 {
-		conf.ReadTimeout = uint32(readTimeoutDefault.Seconds())
+	if c.MaxSizeMB < 0 || c.MaxBackups < 0 || c.QueueSize < 0 {
+		errs.add(ErrInvalidArgumentWithReason("conf.Charging", c, "size, backups and queue size must not be negative"))
 	}
+}
 
-	if conf.MaxReqRetries == 0 {
-		conf.MaxReqRetries = maxReqRetriesDefault
+func validateFlowExport(f FlowExportInfo, errs *confErrors) {
+	if !f.Enable {
+		return
 	}
 
-	if conf.EnableHBTimer {
-		if conf.HeartBeatInterval == "" {
-			conf.HeartBeatInterval = hbIntervalDefault.String()
+	if _, port, err := net.SplitHostPort(f.Collector); err != nil || port == "" {
+		errs.add(ErrInvalidArgumentWithReason("conf.FlowExport.Collector", f.Collector, "must be host:port"))
+	}
+
+	if d, err := time.ParseDuration(f.Interval); err != nil || d <= 0 {
+		errs.add(ErrInvalidArgumentWithReason("conf.FlowExport.Interval", f.Interval, "invalid duration"))
+	}
+}
+
+func validateMetricsPush(m MetricsPushInfo, errs *confErrors) {
+	if !m.Enable {
+		return
+	}
+
+	if parsed, err := url.Parse(m.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		errs.add(ErrInvalidArgumentWithReason("conf.MetricsPush.URL", m.URL, "invalid HTTP URL"))
+	}
+
+	if d, err := time.ParseDuration(m.Interval); err != nil || d <= 0 {
+		errs.add(ErrInvalidArgumentWithReason("conf.MetricsPush.Interval", m.Interval, "invalid duration"))
+	}
+
+	for name := range m.Grouping {
+		if name == "" || name == "job" {
+			errs.add(ErrInvalidArgumentWithReason("conf.MetricsPush.Grouping", name, "invalid label name"))
+		}
+	}
+}
+
+func validateFARDuplication(conf Conf, errs *confErrors) {
+	d := conf.FARDuplication
+	if !d.Enable {
+		return
+	}
+
+	switch {
+	case conf.EnableP4rt:
+		if d.Mode != duplicationModeRaw || d.Port == 0 {
+			errs.add(ErrInvalidArgumentWithReason("conf.FARDuplication", d, "UP4 only mirrors in raw mode, to a port"))
+		}
+	case conf.Datapath != "" && conf.Datapath != datapathBESS && conf.Datapath != datapathFake:
+		errs.add(ErrInvalidArgumentWithReason("conf.FARDuplication", d, "not supported by the "+conf.Datapath+" datapath"))
+	case d.Mode == duplicationModeGTPU:
+		if ip := net.ParseIP(d.Endpoint); ip == nil || ip.To4() == nil {
+			errs.add(ErrInvalidArgumentWithReason("conf.FARDuplication.Endpoint", d.Endpoint, "must be an IPv4 address"))
+		}
+	case d.Mode == duplicationModeRaw:
+		if d.IfName == "" {
+			errs.add(ErrInvalidArgumentWithReason("conf.FARDuplication.IfName", d.IfName, "must be set in raw mode"))
+		}
+	default:
+		errs.add(ErrInvalidArgumentWithReason("conf.FARDuplication.Mode", d.Mode, "must be gtpu or raw"))
+	}
+}
+
+func validatePeer(peer PeerInfo, errs *confErrors) {
+	if net.ParseIP(peer.Address) == nil {
+		errs.add(ErrInvalidArgumentWithReason("conf.CPIface.Peers", peer.Address, "invalid IP"))
+	}
+
+	for _, d := range []struct {
+		name, value string
+	}{
+		{"RespTimeout", peer.RespTimeout},
+		{"HeartBeatInterval", peer.HeartBeatInterval},
+	} {
+		if d.value == "" {
+			continue
+		}
+
+		if v, err := time.ParseDuration(d.value); err != nil || v <= 0 {
+			errs.add(ErrInvalidArgumentWithReason("conf.CPIface.Peers."+d.name, d.value, "invalid duration"))
+		}
+	}
+}
+
+func validateFARRedirect(conf Conf, errs *confErrors) {
+	r := conf.FARRedirect
+	if !r.Enable {
+		return
+	}
+
+	if conf.EnableP4rt || (conf.Datapath != "" && conf.Datapath != datapathBESS && conf.Datapath != datapathFake) {
+		errs.add(ErrInvalidArgumentWithReason("conf.FARRedirect", r, "only supported by the BESS datapath"))
+	}
+
+	if r.Gateway != "" {
+		if ip := net.ParseIP(r.Gateway); ip == nil || ip.To4() == nil {
+			errs.add(ErrInvalidArgumentWithReason("conf.FARRedirect.Gateway", r.Gateway, "must be an IPv4 address"))
+		}
+	}
+}
+
+func validateHeaderEnrichment(conf Conf, errs *confErrors) {
+	e := conf.HeaderEnrichment
+	if !e.Enable {
+		return
+	}
+
+	if conf.EnableP4rt || (conf.Datapath != "" && conf.Datapath != datapathBESS && conf.Datapath != datapathFake) {
+		errs.add(ErrInvalidArgumentWithReason("conf.HeaderEnrichment", e, "only supported by the BESS datapath"))
+	}
+
+	if ip := net.ParseIP(e.Proxy); ip == nil || ip.To4() == nil {
+		errs.add(ErrInvalidArgumentWithReason("conf.HeaderEnrichment.Proxy", e.Proxy, "must be an IPv4 address"))
+	}
+
+	for id, headers := range e.Policies {
+		if len(id) > 255 {
+			errs.add(ErrInvalidArgumentWithReason("conf.HeaderEnrichment.Policies", id, "longer than 255 octets"))
+		}
+
+		for name := range headers {
+			if name == "" || strings.ContainsAny(name, ": \t\r\n") {
+				errs.add(ErrInvalidArgumentWithReason("conf.HeaderEnrichment.Policies", name, "not a valid header name"))
+			}
+		}
+	}
+}
+
+func validateSessionEvents(e SessionEventsInfo, errs *confErrors) {
+	if !e.Enable {
+		return
+	}
+
+	if _, port, err := net.SplitHostPort(e.Address); err != nil || port == "" {
+		errs.add(ErrInvalidArgumentWithReason("conf.SessionEvents.Address", e.Address, "must be [host]:port"))
+	}
+
+	if e.QueueSize < 0 {
+		errs.add(ErrInvalidArgumentWithReason("conf.SessionEvents.QueueSize", e.QueueSize, "must not be negative"))
+	}
+}
+
+func validateAdaptiveHB(hb AdaptiveHBInfo, errs *confErrors) {
+	for _, bounds := range []struct{ name, min, max string }{
+		{"conf.AdaptiveHeartbeat.RespTimeout", hb.MinRespTimeout, hb.MaxRespTimeout},
+		{"conf.AdaptiveHeartbeat.Interval", hb.MinInterval, hb.MaxInterval},
+	} {
+		min, err := time.ParseDuration(bounds.min)
+		if err != nil || min <= 0 {
+			errs.add(ErrInvalidArgumentWithReason(bounds.name, bounds.min, "invalid minimum duration"))
+			continue
+		}
+
+		max, err := time.ParseDuration(bounds.max)
+		if err != nil || max < min {
+			errs.add(ErrInvalidArgumentWithReason(bounds.name, bounds.max, "invalid maximum duration"))
+		}
+	}
+}
+
+// validateBackoff checks the strategy and bound of the retransmission backoff.
+func validateBackoff(b BackoffInfo, errs *confErrors) {
+	switch b.Strategy {
+	case "", backoffFixed, backoffExponential, backoffExponentialJitter:
+	default:
+		errs.add(ErrInvalidArgumentWithReason("conf.RetransmissionBackoff.Strategy", b.Strategy,
+			"must be fixed, exponential or exponential_jitter"))
+	}
+
+	if b.MaxTimeout == "" {
+		return
+	}
+
+	if d, err := time.ParseDuration(b.MaxTimeout); err != nil || d <= 0 {
+		errs.add(ErrInvalidArgumentWithReason("conf.RetransmissionBackoff.MaxTimeout", b.MaxTimeout, "invalid duration"))
+	}
+}
+
+// validateHA checks the active-standby settings.
+func validateHA(conf Conf, errs *confErrors) {
+	ha := conf.HA
+
+	switch ha.Role {
+	case "":
+		return
+	case haRoleActive, haRoleStandby:
+	default:
+		errs.add(ErrInvalidArgumentWithReason("conf.HA.Role", ha.Role, "invalid role"))
+		return
+	}
+
+	if conf.EnableP4rt {
+		errs.add(ErrInvalidArgumentWithReason("conf.HA.Role", ha.Role,
+			"not supported by UP4, which allocates counter indexes from the switch"))
+	}
+
+	if ha.Role == haRoleStandby {
+		u, err := url.Parse(ha.ActiveURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.add(ErrInvalidArgumentWithReason("conf.HA.ActiveURL", ha.ActiveURL, "invalid HTTP URL"))
+		}
+	}
+
+	if ha.FailoverTimeout != "" {
+		if d, err := time.ParseDuration(ha.FailoverTimeout); err != nil || d <= 0 {
+			errs.add(ErrInvalidArgumentWithReason("conf.HA.FailoverTimeout", ha.FailoverTimeout, "invalid duration"))
+		}
+	}
+}
+
+// validateOverloadControl checks the overload thresholds and throttling.
+func validateOverloadControl(conf Conf, errs *confErrors) {
+	oc := conf.OverloadControl
+	if !oc.Enable {
+		return
+	}
+
+	if oc.Threshold == 0 || oc.Threshold > 100 {
+		errs.add(ErrInvalidArgumentWithReason("conf.OverloadControl.Threshold", oc.Threshold, "must be in 1-100"))
+	}
+
+	if oc.ClearThreshold > oc.Threshold {
+		errs.add(ErrInvalidArgumentWithReason("conf.OverloadControl.ClearThreshold", oc.ClearThreshold,
+			"must not exceed the threshold"))
+	}
+
+	if oc.Reduction == 0 || oc.Reduction > 100 {
+		errs.add(ErrInvalidArgumentWithReason("conf.OverloadControl.Reduction", oc.Reduction, "must be in 1-100"))
+	}
+
+	// The Timer IE counts in steps of 2 seconds.
+	if d, err := time.ParseDuration(oc.Period); err != nil || d < 2*time.Second {
+		errs.add(ErrInvalidArgumentWithReason("conf.OverloadControl.Period", oc.Period, "must be at least 2s"))
+	}
+}
+
+// validateLeaderElection checks the leader election settings.
+func validateLeaderElection(conf Conf, errs *confErrors) {
+	le := conf.LeaderElection
+	if !le.Enable {
+		return
+	}
+
+	if conf.HA.Role != "" {
+		errs.add(ErrInvalidArgumentWithReason("conf.LeaderElection.Enable", le.Enable,
+			"exclusive with the active-standby roles"))
+	}
+
+	if conf.EnableP4rt {
+		errs.add(ErrInvalidArgumentWithReason("conf.LeaderElection.Enable", le.Enable,
+			"not supported by UP4, which allocates counter indexes from the switch"))
+	}
+
+	for _, u := range []struct{ name, url string }{
+		{"conf.LeaderElection.ReplicationURL", le.ReplicationURL},
+		{"conf.LeaderElection.APIServer", le.APIServer},
+	} {
+		if u.url == "" {
+			continue
+		}
+
+		parsed, err := url.Parse(u.url)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs.add(ErrInvalidArgumentWithReason(u.name, u.url, "invalid HTTP URL"))
+		}
+	}
+
+	leaseDuration, errLease := time.ParseDuration(le.LeaseDuration)
+	renewDeadline, errRenew := time.ParseDuration(le.RenewDeadline)
+	retryPeriod, errRetry := time.ParseDuration(le.RetryPeriod)
+
+	switch {
+	case errLease != nil || leaseDuration < time.Second:
+		errs.add(ErrInvalidArgumentWithReason("conf.LeaderElection.LeaseDuration", le.LeaseDuration, "invalid duration"))
+	case errRenew != nil || renewDeadline <= 0 || renewDeadline >= leaseDuration:
+		errs.add(ErrInvalidArgumentWithReason("conf.LeaderElection.RenewDeadline", le.RenewDeadline,
+			"must be positive and shorter than the lease duration"))
+	case errRetry != nil || retryPeriod <= 0 || retryPeriod >= renewDeadline:
+		errs.add(ErrInvalidArgumentWithReason("conf.LeaderElection.RetryPeriod", le.RetryPeriod,
+			"must be positive and shorter than the renew deadline"))
+	}
+}
+
+// validateConf checks that the given config reaches a baseline of correctness.
+func validateConf(conf Conf) error {
+	var errs confErrors
+
+	if conf.EnableP4rt {
+		_, _, err := net.ParseCIDR(conf.P4rtcIface.AccessIP)
+		if err != nil {
+			errs.add(ErrInvalidArgumentWithReason("conf.P4rtcIface.AccessIP", conf.P4rtcIface.AccessIP, err.Error()))
+		}
+
+		_, _, err = net.ParseCIDR(conf.CPIface.UEIPPool)
+		if err != nil {
+			errs.add(ErrInvalidArgumentWithReason("conf.UEIPPool", conf.CPIface.UEIPPool, err.Error()))
+		}
+
+		if conf.Mode != "" {
+			errs.add(ErrInvalidArgumentWithReason("conf.Mode", conf.Mode, "mode must not be set for UP4"))
+		}
+
+		if tlsConf := conf.P4rtcIface.TLS; (tlsConf.ClientCert == "") != (tlsConf.ClientKey == "") {
+			errs.add(ErrInvalidArgumentWithReason("conf.P4rtcIface.TLS", tlsConf.ClientCert,
+				"client certificate and key must be set together"))
+		}
+
+		if conf.Datapath != "" {
+			errs.add(ErrInvalidArgumentWithReason("conf.Datapath", conf.Datapath, "datapath must not be set for UP4"))
+		}
+
+		if conf.AccessIface.IfName != "" || conf.CoreIface.IfName != "" {
+			errs.add(ErrInvalidArgumentWithReason("conf.AccessIface", conf.AccessIface.IfName,
+				"access and core interfaces must not be set for UP4, the fabric terminates them"))
+		}
+	} else if conf.Datapath == datapathXDP {
+		if len(conf.QfiDscpConfig) > 0 {
+			errs.add(ErrInvalidArgumentWithReason("conf.QfiDscpConfig", conf.QfiDscpConfig,
+				"DSCP marking is not supported by the XDP datapath"))
+		}
+	} else if conf.Datapath == datapathGTP {
+		if len(conf.QfiDscpConfig) > 0 {
+			errs.add(ErrInvalidArgumentWithReason("conf.QfiDscpConfig", conf.QfiDscpConfig,
+				"DSCP marking is not supported by the kernel GTP datapath"))
+		}
+
+		if conf.EnableGtpuPathMonitor {
+			errs.add(ErrInvalidArgumentWithReason("conf.EnableGtpuPathMonitor", conf.EnableGtpuPathMonitor,
+				"the GTP-U port is held by the gtp link of the kernel GTP datapath"))
+		}
+	} else if conf.Datapath != datapathFake { // the fake datapath accepts any BESS settings
+		if conf.Datapath != "" && conf.Datapath != datapathBESS {
+			errs.add(ErrInvalidArgumentWithReason("conf.Datapath", conf.Datapath, "invalid datapath"))
+		}
+
+		if _, err := bessDialOptions(conf.BESSIface); err != nil {
+			errs.add(err)
+		}
+
+		if conf.BESSIface.CallTimeout != "" {
+			if d, err := time.ParseDuration(conf.BESSIface.CallTimeout); err != nil || d <= 0 {
+				errs.add(ErrInvalidArgumentWithReason("conf.BESSIface.CallTimeout", conf.BESSIface.CallTimeout, "invalid duration"))
+			}
+		}
+
+		if conf.BESSIface.MaxRecvMsgSize < 0 || conf.BESSIface.MaxSendMsgSize < 0 {
+			errs.add(ErrInvalidArgumentWithReason("conf.BESSIface", conf.BESSIface, "message sizes must not be negative"))
+		}
+
+		// Mode is only relevant in a BESS deployment.
+		validModes := map[string]struct{}{
+			"af_xdp":    {},
+			"af_packet": {},
+			"cndp":      {},
+			"dpdk":      {},
+			"sim":       {},
+		}
+		if _, ok := validModes[conf.Mode]; !ok {
+			errs.add(ErrInvalidArgumentWithReason("conf.Mode", conf.Mode, "invalid mode"))
+		}
+	}
+
+	for _, iface := range []struct{ name, ifname string }{
+		{"conf.AccessIface.IfName", conf.AccessIface.IfName},
+		{"conf.CoreIface.IfName", conf.CoreIface.IfName},
+		{"conf.GTPIface.IfName", conf.GTPIface.IfName},
+	} {
+		if iface.ifname != "" && !validIfaceName(iface.ifname) {
+			errs.add(ErrInvalidArgumentWithReason(iface.name, iface.ifname, "invalid interface name"))
+		}
+	}
+
+	// TODO: mark the DSCP on UP4 once its P4 program has a table to program it, the
+	// pipeline of conf/p4 only clears the DSCP of the outer IPv4 header.
+	if len(conf.QfiDscpConfig) > 0 && conf.EnableP4rt {
+		errs.add(ErrInvalidArgumentWithReason("conf.QfiDscpConfig", conf.QfiDscpConfig,
+			"DSCP marking is not supported yet by UP4, its P4 program has no DSCP table"))
+	}
+
+	for _, m := range conf.QfiDscpConfig {
+		if m.QFI > maxQFI {
+			errs.add(ErrInvalidArgumentWithReason("conf.QfiDscpConfig.QFI", m.QFI, "invalid QFI"))
+		}
+
+		if m.DSCP > maxDSCP {
+			errs.add(ErrInvalidArgumentWithReason("conf.QfiDscpConfig.DSCP", m.DSCP, "invalid DSCP"))
+		}
+	}
+
+	if conf.EnableAsyncWrites {
+		if conf.EnableP4rt {
+			errs.add(ErrInvalidArgumentWithReason("conf.EnableAsyncWrites", conf.EnableAsyncWrites,
+				"asynchronous writes are not supported by UP4, which keeps counter indexes in the rules of the session"))
+		}
+
+		if conf.AsyncWriteFailure != asyncWriteFailureReport && conf.AsyncWriteFailure != asyncWriteFailureTeardown {
+			errs.add(ErrInvalidArgumentWithReason("conf.AsyncWriteFailure", conf.AsyncWriteFailure, "invalid action"))
+		}
+	}
+
+	if rl := conf.PFCPRateLimit; rl.Rate < 0 {
+		errs.add(ErrInvalidArgumentWithReason("conf.PFCPRateLimit.Rate", rl.Rate, "invalid rate"))
+	} else if rl.Rate > 0 && rl.Action != rateLimitActionDrop && rl.Action != rateLimitActionReject {
+		errs.add(ErrInvalidArgumentWithReason("conf.PFCPRateLimit.Action", rl.Action, "invalid action"))
+	}
+
+	validateIPAM(conf, &errs)
+	validateSim(conf.SimInfo, &errs)
+	validateAuditLog(conf.AuditLog, &errs)
+	validateWebhooks(conf.Webhooks, &errs)
+	validateCharging(conf.Charging, &errs)
+	validateFlowExport(conf.FlowExport, &errs)
+	validateMetrics(conf.Metrics, &errs)
+	validateMetricsPush(conf.MetricsPush, &errs)
+	validateFARDuplication(conf, &errs)
+	validateLocalSwitching(conf, &errs)
+	validateNeighborProxy(conf, &errs)
+	validateFARRedirect(conf, &errs)
+	validateHeaderEnrichment(conf, &errs)
+	validateSessionEvents(conf.SessionEvents, &errs)
+	validateHA(conf, &errs)
+	validateLeaderElection(conf, &errs)
+
+	if conf.CPIface.EnableUeIPAlloc && conf.CPIface.IPAM.URL == "" &&
+		(conf.CPIface.UEIPPool != "" || len(conf.CPIface.ueIPPools()) == 0) {
+		_, _, err := net.ParseCIDR(conf.CPIface.UEIPPool)
+		if err != nil {
+			errs.add(ErrInvalidArgumentWithReason("conf.UEIPPool", conf.CPIface.UEIPPool, err.Error()))
+		}
+	}
+
+	validateDNNs(conf.CPIface.DNNs, &errs)
+	validateNetworkInstances(conf.NetworkInstances, &errs)
+	validateFTUP(conf.CPIface, &errs)
+
+	dnns := make(map[string]struct{}, len(conf.CPIface.UEIPPools))
+
+	for _, pool := range conf.CPIface.ueIPPools() {
+		if conf.EnableP4rt {
+			errs.add(ErrInvalidArgumentWithReason("conf.CPIface.UEIPPools", conf.CPIface.UEIPPools, "not supported by UP4"))
+		}
+
+		if pool.Dnn == "" {
+			errs.add(ErrInvalidArgumentWithReason("conf.CPIface.UEIPPools", pool, "DNN must be set"))
+		}
+
+		if _, ok := dnns[pool.Dnn]; ok {
+			errs.add(ErrInvalidArgumentWithReason("conf.CPIface.UEIPPools", pool.Dnn, "duplicate DNN"))
+		}
+
+		dnns[pool.Dnn] = struct{}{}
+
+		if _, _, err := net.ParseCIDR(pool.Pool); err != nil {
+			errs.add(ErrInvalidArgumentWithReason("conf.CPIface.UEIPPools", pool.Pool, err.Error()))
+		}
+
+		if pool.IPv6Pool != "" {
+			if _, err := NewIPv6Pool(pool.IPv6Pool); err != nil {
+				errs.add(err)
+			}
+		}
+	}
+
+	if conf.CPIface.UEIPv6Pool != "" {
+		if conf.EnableP4rt {
+			errs.add(ErrInvalidArgumentWithReason("conf.CPIface.UEIPv6Pool", conf.CPIface.UEIPv6Pool, "not supported by UP4"))
+		}
+
+		if _, err := NewIPv6Pool(conf.CPIface.UEIPv6Pool); err != nil {
+			errs.add(err)
+		}
+	}
+
+	for _, peer := range conf.CPIface.Peers {
+		validatePeer(peer, &errs)
+	}
+
+	for _, entry := range conf.CPIface.AllowedPeers {
+		if !validPeerACLEntry(entry) {
+			errs.add(ErrInvalidArgumentWithReason("conf.CPIface.AllowedPeers", entry, "invalid IP, CIDR or host name"))
+		}
+	}
+
+	if conf.CPIface.PFCPBindIP != "" && net.ParseIP(conf.CPIface.PFCPBindIP) == nil {
+		errs.add(ErrInvalidArgumentWithReason("conf.CPIface.PFCPBindIP", conf.CPIface.PFCPBindIP, "invalid IP"))
+	}
+
+	if port, err := strconv.ParseUint(conf.CPIface.PFCPPort, 10, 16); err != nil || port == 0 {
+		errs.add(ErrInvalidArgumentWithReason("conf.CPIface.PFCPPort", conf.CPIface.PFCPPort, "invalid UDP port"))
+	}
+
+	if conf.CPIface.NodeIP != "" && net.ParseIP(conf.CPIface.NodeIP) == nil {
+		errs.add(ErrInvalidArgumentWithReason("conf.CPIface.NodeIP", conf.CPIface.NodeIP, "invalid IP"))
+	}
+
+	if _, err := time.ParseDuration(conf.RespTimeout); err != nil {
+		errs.add(ErrInvalidArgumentWithReason("conf.RespTimeout", conf.RespTimeout, "invalid duration"))
+	}
+
+	if conf.ReadTimeout == 0 {
+		errs.add(ErrInvalidArgumentWithReason("conf.ReadTimeout", conf.ReadTimeout, "invalid duration"))
+	}
+
+	if conf.MaxReqRetries == 0 {
+		errs.add(ErrInvalidArgumentWithReason("conf.MaxReqRetries", conf.MaxReqRetries, "invalid number of retries"))
+	}
+
+	if conf.EnableHBTimer {
+		if d, err := time.ParseDuration(conf.HeartBeatInterval); err != nil || d <= 0 {
+			errs.add(ErrInvalidArgumentWithReason("conf.HeartBeatInterval", conf.HeartBeatInterval, "invalid duration"))
+		}
+	}
+
+	if hb := conf.AdaptiveHeartbeat; hb.Enabled {
+		validateAdaptiveHB(hb, &errs)
+	}
+
+	validateBackoff(conf.RetransmissionBackoff, &errs)
+
+	switch conf.Role {
+	case rolePSA:
+	case roleIUPF:
+		if !conf.EnableP4rt && (conf.Datapath == datapathXDP || conf.Datapath == datapathGTP) {
+			errs.add(ErrInvalidArgumentWithReason("conf.Role", conf.Role, "N9 tunnels are not supported by the "+conf.Datapath+" datapath"))
+		}
+	default:
+		errs.add(ErrInvalidArgumentWithReason("conf.Role", conf.Role, "invalid role"))
+	}
+
+	switch conf.HBFailureAction {
+	case hbFailurePurge, hbFailureAlarm:
+	case hbFailureKeep:
+		if d, err := time.ParseDuration(conf.HBFailureGracePeriod); err != nil || d <= 0 {
+			errs.add(ErrInvalidArgumentWithReason("conf.HBFailureGracePeriod", conf.HBFailureGracePeriod, "invalid duration"))
+		}
+	default:
+		errs.add(ErrInvalidArgumentWithReason("conf.HBFailureAction", conf.HBFailureAction, "invalid action"))
+	}
+
+	if conf.EnableGtpuPathMonitor {
+		if d, err := time.ParseDuration(conf.GtpuEchoInterval); err != nil || d <= 0 {
+			errs.add(ErrInvalidArgumentWithReason("conf.GtpuEchoInterval", conf.GtpuEchoInterval, "invalid duration"))
+		}
+	}
+
+	if conf.EndMarkerInterval != "" {
+		if _, err := time.ParseDuration(conf.EndMarkerInterval); err != nil {
+			errs.add(ErrInvalidArgumentWithReason("conf.EndMarkerInterval", conf.EndMarkerInterval, "invalid duration"))
+		}
+	}
+
+	if conf.CPIface.UEIPLeaseTTL != "" {
+		if d, err := time.ParseDuration(conf.CPIface.UEIPLeaseTTL); err != nil || d <= 0 {
+			errs.add(ErrInvalidArgumentWithReason("conf.CPIface.UEIPLeaseTTL", conf.CPIface.UEIPLeaseTTL, "invalid duration"))
+		}
+	}
+
+	if lc := conf.LoadControl; lc.Enable || conf.OverloadControl.Enable {
+		if d, err := time.ParseDuration(lc.Interval); err != nil || d <= 0 {
+			errs.add(ErrInvalidArgumentWithReason("conf.LoadControl.Interval", lc.Interval, "invalid duration"))
+		}
+	}
+
+	validateOverloadControl(conf, &errs)
+
+	if gc := conf.SessionGC; gc.Enable {
+		for _, d := range []struct{ name, value string }{
+			{"conf.SessionGC.GracePeriod", gc.GracePeriod},
+			{"conf.SessionGC.Interval", gc.Interval},
+		} {
+			if v, err := time.ParseDuration(d.value); err != nil || v <= 0 {
+				errs.add(ErrInvalidArgumentWithReason(d.name, d.value, "invalid duration"))
+			}
+		}
+	}
+
+	if conf.RulesAuditInterval != "" {
+		if d, err := time.ParseDuration(conf.RulesAuditInterval); err != nil || d <= 0 {
+			errs.add(ErrInvalidArgumentWithReason("conf.RulesAuditInterval", conf.RulesAuditInterval, "invalid duration"))
+		}
+	}
+
+	if conf.GracefulReleasePeriod != "" {
+		if _, err := time.ParseDuration(conf.GracefulReleasePeriod); err != nil {
+			errs.add(ErrInvalidArgumentWithReason("conf.GracefulReleasePeriod", conf.GracefulReleasePeriod, "invalid duration"))
+		}
+	}
+
+	if conf.DDNBatchWindow != "" {
+		if d, err := time.ParseDuration(conf.DDNBatchWindow); err != nil || d < 0 {
+			errs.add(ErrInvalidArgumentWithReason("conf.DDNBatchWindow", conf.DDNBatchWindow, "invalid duration"))
+		}
+	}
+
+	return errs.err()
+}
+
+// LoadConfigFile : parse json or yaml file and populate corresponding struct.
+// Files with a .yaml or .yml extension are read as YAML, any other as JSON.
+func LoadConfigFile(path string) (Conf, error) {
+	// Open up file.
+	confFile, err := os.Open(path)
+	if err != nil {
+		return Conf{}, err
+	}
+	defer confFile.Close()
+
+	// Read our file into memory.
+	byteValue, err := io.ReadAll(confFile)
+	if err != nil {
+		return Conf{}, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		byteValue, err = yamlToJSON(byteValue)
+		if err != nil {
+			return Conf{}, err
+		}
+	}
+
+	return parseConf(byteValue)
+}
+
+// yamlToJSON converts a YAML config to JSON, so that both share the json tags of Conf.
+func yamlToJSON(byteValue []byte) ([]byte, error) {
+	var doc interface{}
+
+	if err := yaml.Unmarshal(byteValue, &doc); err != nil {
+		return nil, err
+	}
+
+	// An empty document is an empty config.
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+
+	return json.Marshal(doc)
+}
+
+// parseConf parses a JSON config, applies the environment overrides, sets the defaults
+// of missing settings and validates it.
+func parseConf(byteValue []byte) (Conf, error) {
+	var conf Conf
+	conf.LogLevel = log.InfoLevel
+	conf.P4rtcIface.DefaultTC = uint8(p4constants.EnumTrafficClassElastic)
+	conf.P4rtcIface.DefaultQFI = DefaultQFI
+
+	err := json.Unmarshal(byteValue, &conf)
+	if err != nil {
+		return Conf{}, err
+	}
+
+	err = applyEnvOverrides(&conf)
+	if err != nil {
+		return Conf{}, err
+	}
+
+	if conf.SimInfo.Profile != "" {
+		err = loadSimProfile(&conf.SimInfo)
+		if err != nil {
+			return Conf{}, err
+		}
+	}
+
+	// Set defaults, when missing.
+	if conf.RespTimeout == "" {
+		conf.RespTimeout = respTimeoutDefault.String()
+	}
+
+	if conf.ReadTimeout == 0 {
+		conf.ReadTimeout = uint32(readTimeoutDefault.Seconds())
+	}
+
+	if conf.MaxReqRetries == 0 {
+		conf.MaxReqRetries = maxReqRetriesDefault
+	}
+
+	if conf.CPIface.PFCPPort == "" {
+		conf.CPIface.PFCPPort = PFCPPort
+	}
+
+	if conf.EnableHBTimer {
+		if conf.HeartBeatInterval == "" {
+			conf.HeartBeatInterval = hbIntervalDefault.String()
+		}
+	}
+
+	if conf.Role == "" {
+		conf.Role = rolePSA
+	}
+
+	if conf.HBFailureAction == "" {
+		conf.HBFailureAction = hbFailurePurge
+	}
+
+	if conf.HBFailureAction == hbFailureKeep && conf.HBFailureGracePeriod == "" {
+		conf.HBFailureGracePeriod = hbFailureGracePeriodDefault.String()
+	}
+
+	// Adaptive response timeouts keep doubling on each retransmission by default.
+	if conf.RetransmissionBackoff.Strategy == "" {
+		conf.RetransmissionBackoff.Strategy = backoffFixed
+
+		if conf.AdaptiveHeartbeat.Enabled {
+			conf.RetransmissionBackoff.Strategy = backoffExponential
+		}
+	}
+
+	// Adaptive timers only grow from the configured ones by default.
+	if hb := &conf.AdaptiveHeartbeat; hb.Enabled {
+		respTimeout, _ := time.ParseDuration(conf.RespTimeout)
+		hbInterval, _ := time.ParseDuration(conf.HeartBeatInterval)
+
+		if hbInterval == 0 {
+			hbInterval = hbIntervalDefault
+		}
+
+		setDurationDefault(&hb.MinRespTimeout, respTimeout)
+		setDurationDefault(&hb.MaxRespTimeout, adaptiveHBMaxFactor*respTimeout)
+		setDurationDefault(&hb.MinInterval, hbInterval)
+		setDurationDefault(&hb.MaxInterval, adaptiveHBMaxFactor*hbInterval)
+	}
+
+	if lc := &conf.LoadControl; lc.Enable || conf.OverloadControl.Enable {
+		setDurationDefault(&lc.Interval, loadControlIntervalDefault)
+
+		if lc.MaxSessions == 0 {
+			lc.MaxSessions = conf.MaxSessions
+		}
+	}
+
+	if gc := &conf.SessionGC; gc.Enable {
+		setDurationDefault(&gc.GracePeriod, sessionGCGracePeriodDefault)
+		setDurationDefault(&gc.Interval, sessionGCIntervalDefault)
+	}
+
+	if oc := &conf.OverloadControl; oc.Enable {
+		if oc.Threshold == 0 {
+			oc.Threshold = overloadThresholdDefault
+		}
+
+		if oc.ClearThreshold == 0 {
+			oc.ClearThreshold = overloadClearThresholdDefault
+			if oc.ClearThreshold > oc.Threshold {
+				oc.ClearThreshold = oc.Threshold
+			}
+		}
+
+		if oc.Reduction == 0 {
+			oc.Reduction = overloadReductionDefault
+		}
+
+		setDurationDefault(&oc.Period, overloadPeriodDefault)
+	}
+
+	if a := &conf.AuditLog; a.Enable {
+		if a.MaxSizeMB == 0 {
+			a.MaxSizeMB = auditLogMaxSizeMBDefault
+		}
+
+		if a.MaxBackups == 0 {
+			a.MaxBackups = auditLogMaxBackupsDefault
+		}
+	}
+
+	if w := &conf.Webhooks; len(w.URLs) > 0 {
+		setDurationDefault(&w.Timeout, webhookTimeoutDefault)
+		setDurationDefault(&w.RetryInterval, webhookRetryIntervalDefault)
+
+		if w.MaxRetries == 0 {
+			w.MaxRetries = webhookMaxRetriesDefault
+		}
+
+		if w.QueueSize == 0 {
+			w.QueueSize = webhookQueueSizeDefault
+		}
+	}
+
+	if c := &conf.Charging; c.Enable {
+		if c.Format == "" {
+			c.Format = chargingFormatJSON
+		}
+
+		if c.MaxSizeMB == 0 {
+			c.MaxSizeMB = auditLogMaxSizeMBDefault
+		}
+
+		if c.MaxBackups == 0 {
+			c.MaxBackups = auditLogMaxBackupsDefault
+		}
+
+		setDurationDefault(&c.Timeout, webhookTimeoutDefault)
+
+		if c.QueueSize == 0 {
+			c.QueueSize = webhookQueueSizeDefault
+		}
+	}
+
+	if f := &conf.FlowExport; f.Enable {
+		setDurationDefault(&f.Interval, flowExportIntervalDefault)
+	}
+
+	if m := &conf.MetricsPush; m.Enable {
+		if m.Job == "" {
+			m.Job = metricsPushJobDefault
+		}
+
+		setDurationDefault(&m.Interval, metricsPushIntervalDefault)
+	}
+
+	if d := &conf.FARDuplication; d.Enable && d.Mode == "" {
+		d.Mode = duplicationModeGTPU
+	}
+
+	if e := &conf.SessionEvents; e.Enable {
+		if e.Address == "" {
+			e.Address = sessionEventsAddressDefault
+		}
+
+		if e.QueueSize == 0 {
+			e.QueueSize = sessionEventsQueueSizeDefault
+		}
+	}
+
+	if le := &conf.LeaderElection; le.Enable {
+		setDurationDefault(&le.LeaseDuration, leaseDurationDefault)
+		setDurationDefault(&le.RenewDeadline, leaseRenewDeadlineDefault)
+		setDurationDefault(&le.RetryPeriod, leaseRetryPeriodDefault)
+	}
+
+	if conf.DLBufferPacketCount == 0 {
+		conf.DLBufferPacketCount = dlBufferPacketCountDefault
+	}
+
+	if conf.DLBufferSize == 0 {
+		conf.DLBufferSize = dlBufferSizeDefault
+	}
+
+	if conf.EnableEndMarker && conf.EndMarkerCount == 0 {
+		conf.EndMarkerCount = endMarkerCountDefault
+	}
+
+	if conf.EnableAsyncWrites && conf.AsyncWriteFailure == "" {
+		conf.AsyncWriteFailure = asyncWriteFailureReport
+	}
+
+	if conf.PFCPRateLimit.Rate > 0 {
+		if conf.PFCPRateLimit.Burst == 0 {
+			conf.PFCPRateLimit.Burst = uint32(math.Ceil(conf.PFCPRateLimit.Rate))
+		}
+
+		if conf.PFCPRateLimit.Action == "" {
+			conf.PFCPRateLimit.Action = rateLimitActionDrop
+		}
+	}
+
+	if conf.EnableGtpuPathMonitor {
+		if conf.GtpuEchoInterval == "" {
+			conf.GtpuEchoInterval = gtpuEchoIntervalDefault.String()
+		}
+
+		if conf.GtpuEchoMaxRetries == 0 {
+			conf.GtpuEchoMaxRetries = gtpuEchoMaxRetriesDefault
 		}
 	}
 
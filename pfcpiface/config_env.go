@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// confEnvPrefix prefixes the environment variables overriding config settings.
+const confEnvPrefix = "UPF"
+
+// confEnvName returns the environment variable overriding a setting, named after the
+// json keys leading to it, e.g. UPF_CPIFACE_HTTP_PORT for cpiface.http_port.
+func confEnvName(keys []string) string {
+	return strings.ToUpper(strings.Join(append([]string{confEnvPrefix}, keys...), "_"))
+}
+
+// applyEnvOverrides sets the settings of conf found in the environment. Strings are
+// taken as is, others are parsed as their JSON value, e.g. UPF_CPIFACE_PEERS='["smf"]'.
+// Nested settings are overridden one by one, not as a whole.
+func applyEnvOverrides(conf *Conf) error {
+	var errs confErrors
+
+	overrideFromEnv(reflect.ValueOf(conf).Elem(), nil, &errs)
+
+	return errs.err()
+}
+
+func overrideFromEnv(v reflect.Value, keys []string, errs *confErrors) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+
+		field := v.Field(i)
+		fieldKeys := append(append([]string{}, keys...), key)
+
+		_, isText := field.Addr().Interface().(encoding.TextUnmarshaler)
+		if field.Kind() == reflect.Struct && !isText {
+			overrideFromEnv(field, fieldKeys, errs)
+			continue
+		}
+
+		name := confEnvName(fieldKeys)
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		if err := setFromEnv(field, value); err != nil {
+			errs.add(ErrInvalidArgumentWithReason(name, value, err.Error()))
+			continue
+		}
+
+		log.Infoln("Config", strings.Join(fieldKeys, "."), "overridden by", name)
+	}
+}
+
+func setFromEnv(field reflect.Value, value string) error {
+	ptr := field.Addr().Interface()
+
+	if u, ok := ptr.(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	if field.Kind() == reflect.String {
+		field.SetString(value)
+		return nil
+	}
+
+	// Decode into a fresh value, so that a bad value leaves the setting untouched.
+	decoded := reflect.New(field.Type())
+	if err := json.Unmarshal([]byte(value), decoded.Interface()); err != nil {
+		return err
+	}
+
+	field.Set(decoded.Elem())
+
+	return nil
+}
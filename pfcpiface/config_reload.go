@@ -0,0 +1,430 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// pfcpTimers are the timeouts and retries of the PFCP connections, reloaded at runtime.
+type pfcpTimers struct {
+	readTimeout   time.Duration
+	respTimeout   time.Duration
+	hbInterval    time.Duration
+	maxReqRetries uint8
+	// backoff is the strategy of the response timeouts of the retransmissions, bounded
+	// by maxRespTimeout, or by the adaptive timers if adaptive.
+	backoff        string
+	maxRespTimeout time.Duration
+	// adaptive bounds the timers adapted to the RTT of each peer, nil if not adaptive.
+	adaptive *adaptiveTimers
+	// peers are the timers of the peers overriding them, by address.
+	peers map[string]pfcpTimers
+}
+
+func newPFCPTimers(conf *Conf) (pfcpTimers, error) {
+	timers := pfcpTimers{
+		readTimeout:    time.Second * time.Duration(conf.ReadTimeout),
+		maxReqRetries:  conf.MaxReqRetries,
+		backoff:        conf.RetransmissionBackoff.Strategy,
+		maxRespTimeout: validDuration(conf.RetransmissionBackoff.MaxTimeout),
+	}
+
+	var err error
+
+	timers.respTimeout, err = time.ParseDuration(conf.RespTimeout)
+	if err != nil {
+		return timers, ErrInvalidArgumentWithReason("resp_timeout", conf.RespTimeout, "invalid duration")
+	}
+
+	if conf.EnableHBTimer && conf.HeartBeatInterval != "" {
+		timers.hbInterval, err = time.ParseDuration(conf.HeartBeatInterval)
+		if err != nil {
+			return timers, ErrInvalidArgumentWithReason("heart_beat_interval", conf.HeartBeatInterval, "invalid duration")
+		}
+	}
+
+	if hb := conf.AdaptiveHeartbeat; hb.Enabled {
+		timers.adaptive = &adaptiveTimers{
+			minRespTimeout: validDuration(hb.MinRespTimeout),
+			maxRespTimeout: validDuration(hb.MaxRespTimeout),
+			minHBInterval:  validDuration(hb.MinInterval),
+			maxHBInterval:  validDuration(hb.MaxInterval),
+		}
+	}
+
+	for _, peer := range conf.CPIface.Peers {
+		if peer.RespTimeout == "" && peer.MaxReqRetries == 0 && peer.HeartBeatInterval == "" {
+			continue
+		}
+
+		if timers.peers == nil {
+			timers.peers = make(map[string]pfcpTimers)
+		}
+
+		timers.peers[net.ParseIP(peer.Address).String()] = timers.withOverrides(peer)
+	}
+
+	return timers, nil
+}
+
+// withOverrides returns the timers overridden by those of peer. The heartbeat interval
+// is only overridden if heartbeats are enabled.
+func (t pfcpTimers) withOverrides(peer PeerInfo) pfcpTimers {
+	t.peers = nil
+
+	if d, err := time.ParseDuration(peer.RespTimeout); err == nil && d > 0 {
+		t.respTimeout = d
+	}
+
+	if peer.MaxReqRetries > 0 {
+		t.maxReqRetries = peer.MaxReqRetries
+	}
+
+	if d, err := time.ParseDuration(peer.HeartBeatInterval); err == nil && d > 0 && t.hbInterval > 0 {
+		t.hbInterval = d
+	}
+
+	return t
+}
+
+// forPeer returns the timers of the connection to addr.
+func (t pfcpTimers) forPeer(addr net.Addr) pfcpTimers {
+	if len(t.peers) == 0 || addr == nil {
+		return t
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+
+	if peer, ok := t.peers[net.ParseIP(host).String()]; ok {
+		return peer
+	}
+
+	return t
+}
+
+func (u *upf) getPFCPTimers() pfcpTimers {
+	u.reloadLock.RLock()
+	defer u.reloadLock.RUnlock()
+
+	return u.timers
+}
+
+// timers returns the PFCP timers of the connection, overridden for its peer.
+func (pConn *PFCPConn) timers() pfcpTimers {
+	return pConn.upf.getPFCPTimers().forPeer(pConn.RemoteAddr())
+}
+
+func (u *upf) getPeers() []string {
+	u.reloadLock.RLock()
+	defer u.reloadLock.RUnlock()
+
+	return u.peers
+}
+
+// SetConfigPath sets the config file reloaded by ReloadConfigFile.
+func (p *PFCPIface) SetConfigPath(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.confPath = path
+}
+
+// ReloadConfigFile applies the settings of the config file that can change at runtime,
+// e.g. on SIGHUP.
+func (p *PFCPIface) ReloadConfigFile() error {
+	p.mu.Lock()
+	path := p.confPath
+	p.mu.Unlock()
+
+	conf, err := LoadConfigFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to reload config %s: %w", path, err)
+	}
+
+	restartRequired, err := p.reloadConf(conf)
+	if err != nil {
+		return fmt.Errorf("failed to reload config %s: %w", path, err)
+	}
+
+	log.WithField("restart required", restartRequired).Infoln("Reloaded config", path)
+
+	return nil
+}
+
+// reloadConf applies the settings of conf that can change at runtime: log level, PFCP
+// timers, peers, allowed peers, slice meter and UE IP pools. New peers are connected
+// to, removed peers are asked to release their association, the other subsystems are
+// left alone. The changed settings needing a restart are returned.
+func (p *PFCPIface) reloadConf(conf Conf) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	u := p.upf
+	applied := p.conf
+
+	// Pools are reloaded first, they may refuse to give up allocated IPs.
+	if u.ippools != nil && !conf.EnableP4rt && conf.CPIface.IPAM.URL == "" && !poolsEqual(applied.CPIface, conf.CPIface) {
+		// DNNs are only applied on restart, their pools are kept.
+		pools := conf.CPIface
+		pools.DNNs = applied.CPIface.DNNs
+
+		if err := u.ippools.reload(conf.CPIface.UEIPPool, conf.CPIface.UEIPv6Pool, pools.ueIPPools()); err != nil {
+			return nil, err
+		}
+
+		log.Infoln("Reloaded UE IP pools:", u.ippools)
+
+		if changed := changedPools(applied.CPIface, pools); len(changed) > 0 && p.node != nil {
+			go p.node.AdvertiseUEIPPools(changed)
+		}
+
+		applied.CPIface.UEIPPool = conf.CPIface.UEIPPool
+		applied.CPIface.UEIPv6Pool = conf.CPIface.UEIPv6Pool
+		applied.CPIface.UEIPPools = conf.CPIface.UEIPPools
+	}
+
+	applied.ReadTimeout = conf.ReadTimeout
+	applied.RespTimeout = conf.RespTimeout
+	applied.MaxReqRetries = conf.MaxReqRetries
+	applied.HeartBeatInterval = conf.HeartBeatInterval
+	applied.AdaptiveHeartbeat = conf.AdaptiveHeartbeat
+	applied.RetransmissionBackoff = conf.RetransmissionBackoff
+
+	added := addedPeers(peerAddresses(applied.CPIface.Peers), peerAddresses(conf.CPIface.Peers))
+	removed := addedPeers(peerAddresses(conf.CPIface.Peers), peerAddresses(applied.CPIface.Peers))
+	applied.CPIface.Peers = conf.CPIface.Peers
+
+	// Heartbeats are only started for new connections.
+	timers, err := newPFCPTimers(&applied)
+	if err != nil {
+		return nil, err
+	}
+
+	applied.CPIface.AllowedPeers = conf.CPIface.AllowedPeers
+
+	u.reloadLock.Lock()
+	u.timers = timers
+	u.peers = peerAddresses(conf.CPIface.Peers)
+	u.peerACL = newPeerACL(conf.CPIface.AllowedPeers)
+	u.reloadLock.Unlock()
+
+	if len(added) > 0 && p.node != nil {
+		go p.node.tryConnectToN4Peers(p.node.LocalAddr().String(), added)
+	}
+
+	if len(removed) > 0 && p.node != nil {
+		go p.node.releasePeers(removed)
+	}
+
+	if _, ok := p.fp.(*UP4); !ok && applied.SliceMeterConfig != conf.SliceMeterConfig {
+		if err := u.reloadConfigSlice(conf.SliceMeterConfig); err != nil {
+			log.Errorln("Failed to reload slice meter:", err)
+		} else {
+			applied.SliceMeterConfig = conf.SliceMeterConfig
+		}
+	}
+
+	if applied.LogLevel != conf.LogLevel {
+		log.SetLevel(conf.LogLevel)
+		applied.LogLevel = conf.LogLevel
+	}
+
+	p.conf = applied
+
+	return changedSettings("", reflect.ValueOf(applied), reflect.ValueOf(conf)), nil
+}
+
+// configSliceName is the slice metered with slice_rate_limit_config.
+const configSliceName = "slice_rate_limit_config"
+
+func configSliceInfo(meter SliceMeterConfig) *SliceInfo {
+	return &SliceInfo{
+		name:         configSliceName,
+		uplinkMbr:    meter.N6RateBps,
+		downlinkMbr:  meter.N3RateBps,
+		ulBurstBytes: meter.N6BurstBytes,
+		dlBurstBytes: meter.N3BurstBytes,
+	}
+}
+
+// reloadConfigSlice sets the slice of slice_rate_limit_config, removed if it has no rate.
+// The slices managed through the REST API are kept metered, the reload is rejected
+// while there are any.
+func (u *upf) reloadConfigSlice(meter SliceMeterConfig) error {
+	for _, sliceInfo := range u.getSliceInfos() {
+		if sliceInfo.name != configSliceName {
+			return ErrInvalidOperation("reload of slice_rate_limit_config while slice " + sliceInfo.name + " is configured")
+		}
+	}
+
+	if meter.N6RateBps == 0 && meter.N3RateBps == 0 {
+		if u.getSliceInfo(configSliceName) == nil {
+			return nil
+		}
+
+		return u.removeSliceInfo(configSliceName)
+	}
+
+	return u.addSliceInfo(configSliceInfo(meter))
+}
+
+func poolsEqual(a, b CPIfaceInfo) bool {
+	return a.UEIPPool == b.UEIPPool && a.UEIPv6Pool == b.UEIPv6Pool && reflect.DeepEqual(a.UEIPPools, b.UEIPPools)
+}
+
+// changedPools returns the DNNs of the UE IP pools of b added or changed from a, sorted.
+// The default pool is that of DNN "".
+func changedPools(a, b CPIfaceInfo) []string {
+	subnets := func(c CPIfaceInfo) map[string][2]string {
+		pools := map[string][2]string{"": {c.UEIPPool, c.UEIPv6Pool}}
+		for _, pool := range c.ueIPPools() {
+			pools[pool.Dnn] = [2]string{pool.Pool, pool.IPv6Pool}
+		}
+
+		return pools
+	}
+
+	old := subnets(a)
+
+	var changed []string
+
+	for dnn, pool := range subnets(b) {
+		if pool != [2]string{} && old[dnn] != pool {
+			changed = append(changed, dnn)
+		}
+	}
+
+	sort.Strings(changed)
+
+	return changed
+}
+
+func addedPeers(old, peers []string) []string {
+	known := make(map[string]struct{}, len(old))
+	for _, peer := range old {
+		known[peer] = struct{}{}
+	}
+
+	var added []string
+
+	for _, peer := range peers {
+		if _, ok := known[peer]; !ok {
+			added = append(added, peer)
+		}
+	}
+
+	return added
+}
+
+// changedSettings returns the JSON names of the settings that differ between the
+// configs a and b, nested settings being prefixed with the name of their parent.
+func changedSettings(prefix string, a, b reflect.Value) []string {
+	var changed []string
+
+	t := a.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath != "" || name == "" || name == "-" {
+			continue
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			changed = append(changed, changedSettings(prefix+name+".", a.Field(i), b.Field(i))...)
+			continue
+		}
+
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changed = append(changed, prefix+name)
+		}
+	}
+
+	return changed
+}
+
+// confHandler reloads the config at runtime:
+//
+//	GET /v1/config  returns the config in use
+//	PUT /v1/config  applies a config, in the format of the config file
+type confHandler struct {
+	iface *PFCPIface
+}
+
+// confReloadResponse is the body of the responses to PUT /v1/config.
+type confReloadResponse struct {
+	RestartRequired []string `json:"restart_required"`
+}
+
+func (h *confHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.iface.mu.Lock()
+		conf := h.iface.conf
+		h.iface.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(conf); err != nil {
+			log.Errorln("Failed to encode config:", err)
+		}
+	case http.MethodPut:
+		h.reload(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *confHandler) reload(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	conf, err := parseConf(body)
+	if err != nil {
+		http.Error(w, "invalid config: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	restartRequired, err := h.iface.reloadConf(conf)
+
+	switch {
+	case errors.Is(err, errInvalidOperation):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.WithField("restart required", restartRequired).Infoln("Reloaded config")
+
+	if restartRequired == nil {
+		restartRequired = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(confReloadResponse{RestartRequired: restartRequired}); err != nil {
+		log.Errorln("Failed to encode config reload response:", err)
+	}
+}
@@ -0,0 +1,248 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func TestPFCPIface_reloadConf(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+
+	s := `{"mode": "dpdk", "resp_timeout": "2s", "cpiface": {"enable_ue_ip_alloc": true, "ue_ip_pool": "10.0.0.0/24"}}`
+	conf, err := parseConf([]byte(s))
+	require.NoError(t, err)
+
+	pools, err := NewIPPools(conf.CPIface.UEIPPool, "", nil)
+	require.NoError(t, err)
+
+	u := &upf{ippools: pools}
+	u.timers, err = newPFCPTimers(&conf)
+	require.NoError(t, err)
+
+	iface := &PFCPIface{conf: conf, upf: u, fp: &fakeDatapath{}}
+	h := &confHandler{iface: iface}
+
+	put := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/v1/config", strings.NewReader(body)))
+
+		return rec
+	}
+
+	_, err = pools.LookupOrAllocIP("", 1)
+	require.NoError(t, err)
+
+	t.Run("runtime settings are applied", func(t *testing.T) {
+		rec := put(`{"mode": "af_packet", "resp_timeout": "5s", "log_level": "debug", "cpiface": {
+			"enable_ue_ip_alloc": true, "ue_ip_pool": "10.0.0.0/24", "hostname": "upf1",
+			"ue_ip_pools": [{"dnn": "ims", "ue_ip_pool": "10.1.0.0/24"}]}}`)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var resp confReloadResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Equal(t, []string{"mode", "cpiface.hostname"}, resp.RestartRequired)
+
+		require.Equal(t, 5*time.Second, u.getPFCPTimers().respTimeout)
+		require.Equal(t, log.DebugLevel, log.GetLevel())
+
+		ip, err := pools.LookupOrAllocIP("ims", 2)
+		require.NoError(t, err)
+		require.Equal(t, "10.1.0.1", ip.String())
+
+		// The default pool kept its allocations.
+		ip, err = pools.LookupOrAllocIP("", 1)
+		require.NoError(t, err)
+		require.Equal(t, "10.0.0.1", ip.String())
+	})
+
+	t.Run("pools in use are not replaced", func(t *testing.T) {
+		rec := put(`{"mode": "dpdk", "cpiface": {"enable_ue_ip_alloc": true, "ue_ip_pool": "10.2.0.0/24"}}`)
+		require.Equal(t, http.StatusConflict, rec.Code)
+
+		ip, err := pools.LookupOrAllocIP("ims", 2)
+		require.NoError(t, err)
+		require.Equal(t, "10.1.0.1", ip.String())
+	})
+
+	t.Run("invalid config is rejected", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, put(`{"mode": "dpdk", "resp_timeout": "soon"}`).Code)
+		require.Equal(t, http.StatusBadRequest, put(`{`).Code)
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/config", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var applied Conf
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &applied))
+	require.Equal(t, "dpdk", applied.Mode, "settings needing a restart are not applied")
+	require.Equal(t, "5s", applied.RespTimeout)
+}
+
+func Test_addedPeers(t *testing.T) {
+	require.Equal(t, []string{"10.0.0.3"}, addedPeers([]string{"10.0.0.1", "10.0.0.2"}, []string{"10.0.0.2", "10.0.0.3"}))
+	require.Empty(t, addedPeers([]string{"10.0.0.1"}, nil))
+}
+
+func Test_pfcpTimers_forPeer(t *testing.T) {
+	conf, err := parseConf([]byte(`{"mode": "dpdk", "resp_timeout": "2s", "max_req_retries": 5,
+		"enable_hbTimer": true, "heart_beat_interval": "5s", "cpiface": {"peers": [
+			"198.18.0.1",
+			{"address": "203.0.113.9", "resp_timeout": "8s", "max_req_retries": 2, "heart_beat_interval": "30s"}]}}`))
+	require.NoError(t, err)
+	require.Equal(t, []PeerInfo{
+		{Address: "198.18.0.1"},
+		{Address: "203.0.113.9", RespTimeout: "8s", MaxReqRetries: 2, HeartBeatInterval: "30s"},
+	}, conf.CPIface.Peers)
+
+	timers, err := newPFCPTimers(&conf)
+	require.NoError(t, err)
+
+	colocated := timers.forPeer(&net.UDPAddr{IP: net.ParseIP("198.18.0.1"), Port: 8805})
+	require.Equal(t, 2*time.Second, colocated.respTimeout)
+	require.Equal(t, uint8(5), colocated.maxReqRetries)
+	require.Equal(t, 5*time.Second, colocated.hbInterval)
+
+	roaming := timers.forPeer(&net.UDPAddr{IP: net.ParseIP("203.0.113.9"), Port: 8805})
+	require.Equal(t, 8*time.Second, roaming.respTimeout)
+	require.Equal(t, uint8(2), roaming.maxReqRetries)
+	require.Equal(t, 30*time.Second, roaming.hbInterval)
+
+	_, err = parseConf([]byte(`{"mode": "dpdk", "cpiface": {"peers": [{"address": "203.0.113.9", "resp_timeout": "soon"}]}}`))
+	require.Error(t, err)
+}
+
+func TestPFCPIface_reloadConf_slices(t *testing.T) {
+	applied, err := parseConf([]byte(`{"mode": "dpdk"}`))
+	require.NoError(t, err)
+
+	conf, err := parseConf([]byte(`{"mode": "dpdk", "slice_rate_limit_config": {"n6_bps": 1000, "n3_bps": 2000}}`))
+	require.NoError(t, err)
+
+	f := &fakeDatapath{}
+	u := &upf{datapath: f}
+	iface := &PFCPIface{conf: applied, upf: u, fp: f}
+
+	reload := func(conf Conf) []string {
+		restartRequired, err := iface.reloadConf(conf)
+		require.NoError(t, err)
+
+		return restartRequired
+	}
+
+	require.Empty(t, reload(conf))
+	require.Equal(t, uint64(1000), u.getSliceInfo(configSliceName).uplinkMbr)
+
+	apiSlice := &SliceInfo{name: "internet", uplinkMbr: 5000, downlinkMbr: 5000}
+	require.NoError(t, u.addSliceInfo(apiSlice))
+
+	t.Run("slices of the API are kept metered", func(t *testing.T) {
+		updated := conf
+		updated.SliceMeterConfig.N6RateBps = 3000
+
+		require.Equal(t, []string{"slice_rate_limit_config.n6_bps"}, reload(updated))
+		require.Equal(t, uint64(1000), u.getSliceInfo(configSliceName).uplinkMbr)
+		require.Equal(t, apiSlice, u.getSliceInfo("internet"))
+		require.Equal(t, "AddSliceInfo", f.ops[len(f.ops)-1].Method, "the meter of the API slice is kept")
+	})
+
+	require.NoError(t, u.removeSliceInfo("internet"))
+
+	t.Run("slice is removed without rates", func(t *testing.T) {
+		updated := conf
+		updated.SliceMeterConfig = SliceMeterConfig{}
+
+		require.Empty(t, reload(updated))
+		require.Nil(t, u.getSliceInfo(configSliceName))
+		require.Empty(t, u.getSliceInfos())
+	})
+}
+
+func TestPFCPIface_reloadConf_removedPeers(t *testing.T) {
+	conf, err := parseConf([]byte(`{"mode": "dpdk", "cpiface": {"peers": ["127.0.0.1", "127.0.0.2"]}}`))
+	require.NoError(t, err)
+
+	u := &upf{gracefulReleasePeriod: 30 * time.Second}
+	u.timers, err = newPFCPTimers(&conf)
+	require.NoError(t, err)
+
+	node := &PFCPNode{upf: u}
+	kept := newTestAssociation(t, node, "127.0.0.1", ie.CauseRequestAccepted)
+	removed := newTestAssociation(t, node, "127.0.0.2", ie.CauseRequestAccepted)
+
+	iface := &PFCPIface{conf: conf, upf: u, node: node, fp: &fakeDatapath{}}
+
+	updated := conf
+	updated.CPIface.Peers = conf.CPIface.Peers[:1]
+
+	_, err = iface.reloadConf(updated)
+	require.NoError(t, err)
+	require.Equal(t, []string{"127.0.0.1"}, u.getPeers())
+
+	req := receiveAssociationUpdate(removed, time.Second)
+	require.NotNil(t, req, "removed peer is asked to release the association")
+	require.NotNil(t, req.PFCPAssociationReleaseRequest)
+	require.NotNil(t, req.GracefulReleasePeriod)
+
+	require.Nil(t, receiveAssociationUpdate(kept, 100*time.Millisecond))
+}
+
+func Test_changedPools(t *testing.T) {
+	a := CPIfaceInfo{UEIPPool: "10.0.0.0/24", UEIPPools: []UEIPPoolInfo{{Dnn: "ims", Pool: "10.1.0.0/24"}}}
+	b := CPIfaceInfo{UEIPPool: "10.0.0.0/24", UEIPPools: []UEIPPoolInfo{
+		{Dnn: "ims", Pool: "10.1.0.0/24", IPv6Pool: "2001:db8::/64"},
+		{Dnn: "internet", Pool: "10.2.0.0/24"},
+	}}
+
+	require.Equal(t, []string{"ims", "internet"}, changedPools(a, b))
+	require.Empty(t, changedPools(b, CPIfaceInfo{UEIPPool: b.UEIPPool, UEIPPools: b.UEIPPools[:1]}),
+		"removed pools are not advertised")
+	require.Equal(t, []string{""}, changedPools(a, CPIfaceInfo{UEIPPool: "10.3.0.0/24", UEIPPools: a.UEIPPools}))
+}
+
+func TestPFCPIface_reloadConf_advertisesPools(t *testing.T) {
+	conf, err := parseConf([]byte(`{"mode": "dpdk", "cpiface": {"enable_ue_ip_alloc": true, "ue_ip_pool": "10.0.0.0/24"}}`))
+	require.NoError(t, err)
+
+	pools, err := NewIPPools(conf.CPIface.UEIPPool, "", nil)
+	require.NoError(t, err)
+
+	u := &upf{ippools: pools}
+	u.timers, err = newPFCPTimers(&conf)
+	require.NoError(t, err)
+
+	node := &PFCPNode{upf: u}
+	requests := newTestAssociation(t, node, "127.0.0.1", ie.CauseRequestAccepted)
+
+	iface := &PFCPIface{conf: conf, upf: u, node: node, fp: &fakeDatapath{}}
+
+	updated := conf
+	updated.CPIface.UEIPPools = []UEIPPoolInfo{{Dnn: "ims", Pool: "10.1.0.0/24"}}
+
+	_, err = iface.reloadConf(updated)
+	require.NoError(t, err)
+
+	req := receiveAssociationUpdate(requests, time.Second)
+	require.NotNil(t, req, "the new pool is advertised")
+	require.Len(t, req.UEIPAddressPoolInformation, 1)
+
+	id, err := req.UEIPAddressPoolInformation[0].UEIPAddressPoolIdentityString()
+	require.NoError(t, err)
+	require.Equal(t, "ims", id)
+
+	_, err = iface.reloadConf(updated)
+	require.NoError(t, err)
+	require.Nil(t, receiveAssociationUpdate(requests, 100*time.Millisecond), "unchanged pools are not advertised")
+}
@@ -4,8 +4,10 @@
 package pfcpiface
 
 import (
+	"errors"
 	"io/fs"
 	"os"
+	"strings"
 	"testing"
 
 	log "github.com/sirupsen/logrus"
@@ -81,6 +83,864 @@ func TestLoadConfigFile(t *testing.T) {
 		require.Equal(t, conf.LogLevel, log.InfoLevel)
 	})
 
+	t.Run("QFI to DSCP map is validated", func(t *testing.T) {
+		s := `{
+			"mode": "dpdk",
+			"qfi_dscp_config": [{"qfi": 1, "dscp": 46}, {"qfi": 9, "dscp": 64}]
+		}`
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(s, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.Error(t, err)
+	})
+
+	t.Run("XDP datapath does not need a BESS mode", func(t *testing.T) {
+		s := `{
+			"datapath": "xdp"
+		}`
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(s, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+	})
+
+	t.Run("kernel GTP datapath does not need a BESS mode", func(t *testing.T) {
+		s := `{
+			"datapath": "gtp"
+		}`
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(s, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+	})
+
+	t.Run("kernel GTP datapath rejects GTP-U path monitoring", func(t *testing.T) {
+		s := `{
+			"datapath": "gtp",
+			"enable_gtpu_path_monitoring": true
+		}`
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(s, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.ErrorIs(t, err, errInvalidArgument)
+	})
+
+	t.Run("fake datapath accepts any BESS mode", func(t *testing.T) {
+		s := `{
+			"datapath": "fake"
+		}`
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(s, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+	})
+
+	t.Run("asynchronous writes are validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "enable_async_datapath_writes": true, "async_write_failure_action": "retry"}`,
+			`{"enable_p4rt": true, "p4rtciface": {"access_ip": "198.18.0.1/32"}, "cpiface": {"ue_ip_pool": "10.250.0.0/16"},
+				"enable_async_datapath_writes": true}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "enable_async_datapath_writes": true}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, asyncWriteFailureReport, conf.AsyncWriteFailure)
+	})
+
+	t.Run("P4Runtime client certificate needs its key", func(t *testing.T) {
+		s := `{
+			"enable_p4rt": true,
+			"cpiface": {"ue_ip_pool": "10.250.0.0/16"},
+			"p4rtciface": {
+				"access_ip": "198.18.0.1/32",
+				"election_id": 10,
+				"tls": {"enabled": true, "client_cert": "/etc/upf/cert.pem"}
+			}
+		}`
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(s, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.Error(t, err)
+
+		s = strings.Replace(s, `"client_cert": "/etc/upf/cert.pem"`,
+			`"client_cert": "/etc/upf/cert.pem", "client_key": "/etc/upf/key.pem"`, 1)
+		mustWriteStringToDisk(s, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, uint64(10), conf.P4rtcIface.ElectionID)
+	})
+
+	t.Run("rules audit interval is validated", func(t *testing.T) {
+		s := `{
+			"mode": "dpdk",
+			"rules_audit_interval": "0s"
+		}`
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(s, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.Error(t, err)
+	})
+
+	t.Run("BESS gRPC settings are validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "bess": {"call_timeout": "0s"}}`,
+			`{"mode": "dpdk", "bess": {"keepalive_time": "soon"}}`,
+			`{"mode": "dpdk", "bess": {"max_recv_msg_size": -1}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+	})
+
+	t.Run("PFCP rate limit is validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "pfcp_rate_limit": {"rate": -1}}`,
+			`{"mode": "dpdk", "pfcp_rate_limit": {"rate": 100, "action": "ignore"}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "pfcp_rate_limit": {"rate": 2.5}}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, PFCPRateLimitInfo{Rate: 2.5, Burst: 3, Action: rateLimitActionDrop}, conf.PFCPRateLimit)
+	})
+
+	t.Run("adaptive heartbeat bounds are validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "adaptive_heartbeat": {"enabled": true, "min_resp_timeout": "0s"}}`,
+			`{"mode": "dpdk", "adaptive_heartbeat": {"enabled": true, "min_interval": "10s", "max_interval": "5s"}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "enable_hbTimer": true, "adaptive_heartbeat": {"enabled": true}}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, AdaptiveHBInfo{
+			Enabled:        true,
+			MinRespTimeout: "2s",
+			MaxRespTimeout: "8s",
+			MinInterval:    "5s",
+			MaxInterval:    "20s",
+		}, conf.AdaptiveHeartbeat)
+	})
+
+	t.Run("retransmission backoff is validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "retransmission_backoff": {"strategy": "linear"}}`,
+			`{"mode": "dpdk", "retransmission_backoff": {"strategy": "exponential", "max_timeout": "0s"}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk"}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, backoffFixed, conf.RetransmissionBackoff.Strategy)
+
+		mustWriteStringToDisk(`{"mode": "dpdk", "adaptive_heartbeat": {"enabled": true}}`, confPath)
+
+		conf, err = LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, backoffExponential, conf.RetransmissionBackoff.Strategy)
+	})
+
+	t.Run("heartbeat failure action is validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "heartbeat_failure_action": "ignore"}`,
+			`{"mode": "dpdk", "heartbeat_failure_action": "keep", "heartbeat_failure_grace_period": "0s"}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "heartbeat_failure_action": "keep"}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, "1m0s", conf.HBFailureGracePeriod)
+	})
+
+	t.Run("HA settings are validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "ha": {"role": "primary"}}`,
+			`{"mode": "dpdk", "ha": {"role": "standby"}}`,
+			`{"mode": "dpdk", "ha": {"role": "standby", "active_url": "http://upf-0:8080", "failover_timeout": "soon"}}`,
+			`{"enable_p4rt": true, "p4rtciface": {"access_ip": "198.18.0.1/32"}, "cpiface": {"ue_ip_pool": "10.250.0.0/16"},
+				"ha": {"role": "active"}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "ha": {"role": "standby", "active_url": "http://upf-0:8080"}}`, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+	})
+
+	t.Run("load control interval is validated", func(t *testing.T) {
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "load_control": {"enable": true, "interval": "0s"}}`, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.Error(t, err)
+
+		mustWriteStringToDisk(`{"mode": "dpdk", "load_control": {"enable": true}}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, "5s", conf.LoadControl.Interval)
+	})
+
+	t.Run("session GC settings are validated", func(t *testing.T) {
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "session_gc": {"enable": true, "grace_period": "-1m"}}`, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.Error(t, err)
+
+		mustWriteStringToDisk(`{"mode": "dpdk", "session_gc": {"enable": true}}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, "5m0s", conf.SessionGC.GracePeriod)
+		require.Equal(t, "30s", conf.SessionGC.Interval)
+	})
+
+	t.Run("overload control settings are validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "overload_control": {"enable": true, "threshold": 120}}`,
+			`{"mode": "dpdk", "overload_control": {"enable": true, "threshold": 70, "clear_threshold": 75}}`,
+			`{"mode": "dpdk", "overload_control": {"enable": true, "reduction": 101}}`,
+			`{"mode": "dpdk", "overload_control": {"enable": true, "period": "1s"}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "overload_control": {"enable": true, "threshold": 70}}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, OverloadControlInfo{Enable: true, Threshold: 70, ClearThreshold: 70, Reduction: 50, Period: "30s"},
+			conf.OverloadControl)
+		require.Equal(t, "5s", conf.LoadControl.Interval)
+	})
+
+	t.Run("leader election settings are validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "leader_election": {"enable": true, "lease_duration": "5s"}}`,
+			`{"mode": "dpdk", "leader_election": {"enable": true, "retry_period": "1m"}}`,
+			`{"mode": "dpdk", "leader_election": {"enable": true, "replication_url": "upf-0:8080"}}`,
+			`{"mode": "dpdk", "leader_election": {"enable": true},
+				"ha": {"role": "standby", "active_url": "http://upf-0:8080"}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "leader_election": {"enable": true}}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, "15s", conf.LeaderElection.LeaseDuration)
+	})
+
+	t.Run("UE IP pools of DNNs are validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "cpiface": {"ue_ip_pools": [{"ue_ip_pool": "10.1.0.0/16"}]}}`,
+			`{"mode": "dpdk", "cpiface": {"ue_ip_pools": [{"dnn": "internet", "ue_ip_pool": "10.1.0.0"}]}}`,
+			`{"mode": "dpdk", "cpiface": {"ue_ip_pools": [{"dnn": "internet", "ue_ip_pool": "10.1.0.0/16"},
+				{"dnn": "internet", "ue_ip_pool": "10.2.0.0/16"}]}}`,
+			`{"mode": "dpdk", "cpiface": {"ue_ipv6_pool": "10.1.0.0/16"}}`,
+			`{"mode": "dpdk", "cpiface": {"ue_ip_pools": [{"dnn": "internet", "ue_ip_pool": "10.1.0.0/16",
+				"ue_ipv6_pool": "2001:db8::/96"}]}}`,
+			`{"mode": "dpdk", "cpiface": {"enable_ue_ip_alloc": true, "ue_ip_pool": "10.1.0.0/16", "ue_ip_lease_ttl": "-1m"}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		s := `{"mode": "dpdk", "cpiface": {"enable_ue_ip_alloc": true,
+			"ue_ip_pools": [{"dnn": "internet", "ue_ip_pool": "10.1.0.0/16", "slice": "slice1"}]}}`
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(s, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, "slice1", conf.CPIface.UEIPPools[0].Slice)
+	})
+
+	t.Run("external IPAM replaces the local UE IP pools", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "cpiface": {"enable_ue_ip_alloc": true, "ipam": {"url": "ipam:8080"}}}`,
+			`{"mode": "dpdk", "cpiface": {"enable_ue_ip_alloc": true, "ipam": {"url": "http://ipam:8080", "timeout": "0s"}}}`,
+			`{"mode": "dpdk", "cpiface": {"enable_ue_ip_alloc": true, "ipam": {"url": "http://ipam:8080"},
+				"ue_ip_alloc_file": "/var/lib/upf/ue_ip_allocs"}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		s := `{"mode": "dpdk", "cpiface": {"enable_ue_ip_alloc": true, "ipam": {"url": "http://ipam:8080"}}}`
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(s, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+	})
+
+	t.Run("PFCP bind address, node IP and allowed peers are validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "cpiface": {"pfcp_bind_ip": "upf"}}`,
+			`{"mode": "dpdk", "cpiface": {"pfcp_port": "0"}}`,
+			`{"mode": "dpdk", "cpiface": {"pfcp_port": "88050"}}`,
+			`{"mode": "dpdk", "cpiface": {"node_ip": "198.18.0.300"}}`,
+			`{"mode": "dpdk", "cpiface": {"allowed_peers": ["198.18.0.0/33"]}}`,
+			`{"mode": "dpdk", "cpiface": {"allowed_peers": ["smf:8805"]}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk"}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, PFCPPort, conf.CPIface.PFCPPort)
+
+		mustWriteStringToDisk(`{"mode": "dpdk", "cpiface": {"pfcp_bind_ip": "198.18.0.1", "pfcp_port": "8807",
+			"node_ip": "198.18.0.10", "allowed_peers": ["198.18.0.0/24", "2001:db8::1", "smf.5gc"]}}`, confPath)
+
+		conf, err = LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, "8807", conf.CPIface.PFCPPort)
+	})
+
+	t.Run("all problems are reported at once", func(t *testing.T) {
+		s := `{
+			"mode": "dpdk",
+			"access": {"ifname": "access/0"},
+			"resp_timeout": "soon",
+			"enable_gtpu_path_monitoring": true,
+			"gtpu_echo_interval": "0s"
+		}`
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(s, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.Error(t, err)
+
+		var errs confErrors
+		require.True(t, errors.As(err, &errs))
+		require.Len(t, errs, 3)
+		require.Len(t, strings.Split(err.Error(), "\n"), 3)
+	})
+
+	t.Run("UP4 does not use the datapath and interface settings", func(t *testing.T) {
+		for _, s := range []string{
+			`{"enable_p4rt": true, "datapath": "bess", "p4rtciface": {"access_ip": "198.18.0.1/32"},
+				"cpiface": {"ue_ip_pool": "10.250.0.0/16"}}`,
+			`{"enable_p4rt": true, "access": {"ifname": "access"}, "p4rtciface": {"access_ip": "198.18.0.1/32"},
+				"cpiface": {"ue_ip_pool": "10.250.0.0/16"}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+	})
+
+	t.Run("YAML config is detected by extension", func(t *testing.T) {
+		s := `
+mode: dpdk
+log_level: debug
+access:
+  ifname: access
+cpiface:
+  dnn: internet
+  http_port: "8080"
+  ue_ip_pools:
+    - dnn: internet
+      ue_ip_pool: 10.1.0.0/16
+qfi_dscp_config:
+  - qfi: 9
+    dscp: 46
+`
+		for _, name := range []string{"conf.yaml", "conf.yml"} {
+			confPath := t.TempDir() + "/" + name
+			mustWriteStringToDisk(s, confPath)
+
+			conf, err := LoadConfigFile(confPath)
+			require.NoError(t, err)
+			require.Equal(t, log.DebugLevel, conf.LogLevel)
+			require.Equal(t, "access", conf.AccessIface.IfName)
+			require.Equal(t, "10.1.0.0/16", conf.CPIface.UEIPPools[0].Pool)
+			require.Equal(t, uint8(46), conf.QfiDscpConfig[0].DSCP)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(s, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.Error(t, err)
+	})
+
+	t.Run("environment overrides the config file", func(t *testing.T) {
+		env := map[string]string{
+			"UPF_CPIFACE_HTTP_PORT":       "8081",
+			"UPF_P4RTCIFACE_P4RTC_SERVER": "onos",
+			"UPF_P4RTCIFACE_TLS_ENABLED":  "false",
+			"UPF_CPIFACE_PEERS":           `["198.18.0.1", "198.18.0.2"]`,
+			"UPF_LOG_LEVEL":               "debug",
+			"UPF_MAX_REQ_RETRIES":         "3",
+		}
+		for k, v := range env {
+			require.NoError(t, os.Setenv(k, v))
+			defer os.Unsetenv(k)
+		}
+
+		s := `{"mode": "dpdk", "max_req_retries": 7, "cpiface": {"http_port": "8080"}}`
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(s, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, "8081", conf.CPIface.HTTPPort)
+		require.Equal(t, "onos", conf.P4rtcIface.P4rtcServer)
+		require.Equal(t, []PeerInfo{{Address: "198.18.0.1"}, {Address: "198.18.0.2"}}, conf.CPIface.Peers)
+		require.Equal(t, log.DebugLevel, conf.LogLevel)
+		require.Equal(t, uint8(3), conf.MaxReqRetries)
+
+		require.NoError(t, os.Setenv("UPF_MAX_REQ_RETRIES", "many"))
+
+		_, err = LoadConfigFile(confPath)
+		require.Error(t, err)
+	})
+
+	t.Run("sim profile file overrides the sim settings", func(t *testing.T) {
+		dir := t.TempDir()
+		mustWriteStringToDisk(`
+max_sessions: 1000
+sessions_per_second: 200
+ue_ip_ranges: ["10.250.0.0/24", "10.251.0.0/24"]
+interfaces: ["n9"]
+`, dir+"/profile.yaml")
+
+		s := `{"mode": "dpdk", "sim": {"profile": "` + dir + `/profile.yaml", "max_sessions": 10, "num_gnbs": 4}}`
+		confPath := dir + "/conf.json"
+		mustWriteStringToDisk(s, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.Error(t, err, "UE IP ranges are too small")
+
+		mustWriteStringToDisk(strings.Replace(s, `"max_sessions": 10`, `"max_sessions": 10, "interfaces": ["n7"]`, 1), confPath)
+		mustWriteStringToDisk(`{"max_sessions": 500, "ue_ip_ranges": ["10.250.0.0/24", "10.251.0.0/24"]}`, dir+"/profile.yaml")
+
+		_, err = LoadConfigFile(confPath)
+		require.Error(t, err, "invalid interface")
+
+		mustWriteStringToDisk(s, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, uint32(500), conf.SimInfo.MaxSessions)
+		require.Equal(t, uint32(4), conf.SimInfo.NumGNBs)
+		require.Equal(t, dir+"/profile.yaml", conf.SimInfo.Profile)
+	})
+
+	t.Run("audit log needs a destination", func(t *testing.T) {
+		confPath := t.TempDir() + "/conf.json"
+
+		for s, valid := range map[string]bool{
+			`{"mode": "dpdk", "audit_log": {"enable": true}}`:                                     false,
+			`{"mode": "dpdk", "audit_log": {"enable": true, "syslog": "198.18.0.10:514"}}`:        false,
+			`{"mode": "dpdk", "audit_log": {"enable": true, "path": "a.log", "max_backups": -1}}`: false,
+			`{"mode": "dpdk", "audit_log": {"enable": true, "syslog": "udp://198.18.0.10:514"}}`:  true,
+			`{"mode": "dpdk", "audit_log": {"enable": true, "path": "/var/log/upf/audit.log"}}`:   true,
+		} {
+			mustWriteStringToDisk(s, confPath)
+
+			conf, err := LoadConfigFile(confPath)
+			if !valid {
+				require.Error(t, err, s)
+				continue
+			}
+
+			require.NoError(t, err, s)
+			require.Equal(t, auditLogMaxSizeMBDefault, conf.AuditLog.MaxSizeMB)
+			require.Equal(t, auditLogMaxBackupsDefault, conf.AuditLog.MaxBackups)
+		}
+	})
+
+	t.Run("DNNs are validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "cpiface": {"dnns": [{"network_instance": "internet"}]}}`,
+			`{"mode": "dpdk", "cpiface": {"dnns": [{"dnn": "internet"}, {"dnn": "ims", "network_instance": "internet"}]}}`,
+			`{"mode": "dpdk", "cpiface": {"enable_ue_ip_alloc": true, "ue_ip_pools": [{"dnn": "ims", "ue_ip_pool": "10.2.0.0/24"}],
+				"dnns": [{"dnn": "ims", "ue_ip_pool": "10.3.0.0/24"}]}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "cpiface": {"enable_ue_ip_alloc": true, "dnns": [
+			{"dnn": "internet", "ue_ip_pool": "10.1.0.0/24"},
+			{"dnn": "ims", "network_instance": "ims.mnc001.mcc001.gprs", "ue_ip_pool": "10.2.0.0/24", "slice": "voice"}]}}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err, "no ue_ip_pool is needed with the pools of the DNNs")
+		require.Equal(t, []UEIPPoolInfo{
+			{Dnn: "internet", Pool: "10.1.0.0/24"},
+			{Dnn: "ims", Pool: "10.2.0.0/24", Slice: "voice"},
+		}, conf.CPIface.ueIPPools())
+	})
+
+	t.Run("network instances are validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "network_instances": [{"interface": "core"}]}`,
+			`{"mode": "dpdk", "network_instances": [{"network_instance": "n9", "interface": "n9"}]}`,
+			`{"mode": "dpdk", "network_instances": [{"network_instance": "n9", "interface": "core", "ip": "2001:db8::1"}]}`,
+			`{"mode": "dpdk", "network_instances": [{"network_instance": "n9", "interface": "core"},
+				{"network_instance": "n9", "interface": "access"}]}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "network_instances": [
+			{"network_instance": "access", "interface": "access"},
+			{"network_instance": "n6-edge", "interface": "core", "ifname": "vrf-edge", "ip": "198.19.1.1"}]}`, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+	})
+
+	t.Run("TEID ranges are validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "cpiface": {"teid_ranges": [{"start": 1, "end": 100}]}}`,
+			`{"mode": "dpdk", "cpiface": {"enable_ftup": true, "teid_ranges": [{"start": 0, "end": 100}]}}`,
+			`{"mode": "dpdk", "cpiface": {"enable_ftup": true, "teid_ranges": [{"start": 100, "end": 1}]}}`,
+			`{"mode": "dpdk", "cpiface": {"enable_ftup": true, "teid_ranges": [{"peer": "smf1", "start": 1, "end": 100},
+				{"peer": "smf2", "start": 100, "end": 200}]}}`,
+			`{"mode": "dpdk", "cpiface": {"enable_ftup": true, "teid_ranges": [{"peer": "smf1", "start": 1, "end": 100},
+				{"peer": "smf1", "start": 101, "end": 200}]}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "cpiface": {"enable_ftup": true, "teid_alloc_file": "/var/lib/upf/teids",
+			"teid_ranges": [{"peer": "smf1", "start": 1, "end": 100}, {"start": 101, "end": 200}]}}`, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+	})
+
+	t.Run("role is validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "role": "upf"}`,
+			`{"mode": "dpdk", "datapath": "xdp", "role": "i-upf"}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk"}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, rolePSA, conf.Role)
+	})
+
+	t.Run("webhooks are validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "webhooks": {"urls": ["198.18.0.10/events"]}}`,
+			`{"mode": "dpdk", "webhooks": {"urls": ["http://198.18.0.10/events"], "events": ["session_modified"]}}`,
+			`{"mode": "dpdk", "webhooks": {"urls": ["http://198.18.0.10/events"], "retry_interval": "0s"}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "webhooks": {"urls": ["http://198.18.0.10/events"]}}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, WebhookInfo{
+			URLs:          []string{"http://198.18.0.10/events"},
+			Timeout:       "2s",
+			MaxRetries:    3,
+			RetryInterval: "1s",
+			QueueSize:     1024,
+		}, conf.Webhooks)
+	})
+
+	t.Run("charging export is validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "charging": {"enable": true}}`,
+			`{"mode": "dpdk", "charging": {"enable": true, "path": "/tmp/cdr", "format": "xml"}}`,
+			`{"mode": "dpdk", "charging": {"enable": true, "url": "kafka:8082/topics/cdr"}}`,
+			`{"mode": "dpdk", "charging": {"enable": true, "path": "/tmp/cdr", "rollover_interval": "0s"}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "charging": {"enable": true, "path": "/tmp/cdr"}}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, ChargingInfo{
+			Enable:     true,
+			Path:       "/tmp/cdr",
+			Format:     chargingFormatJSON,
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+			Timeout:    "2s",
+			QueueSize:  1024,
+		}, conf.Charging)
+	})
+
+	t.Run("flow export is validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "flow_export": {"enable": true}}`,
+			`{"mode": "dpdk", "flow_export": {"enable": true, "collector": "198.18.0.20"}}`,
+			`{"mode": "dpdk", "flow_export": {"enable": true, "collector": "198.18.0.20:4739", "interval": "0s"}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "flow_export": {"enable": true, "collector": "198.18.0.20:4739"}}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, "10s", conf.FlowExport.Interval)
+	})
+
+	t.Run("metrics are validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "metrics": {"namespace": "edge-1"}}`,
+			`{"mode": "dpdk", "metrics": {"labels": {"upf-id": "1"}}}`,
+			`{"mode": "dpdk", "metrics": {"labels": {"__name__": "x"}}}`,
+			`{"mode": "dpdk", "metrics": {"disabled_collectors": ["sessions"]}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "metrics": {"namespace": "edge", "labels": {"upf_id": "1"}, "disabled_collectors": ["session", "store"]}}`, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+	})
+
+	t.Run("metrics push is validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "metrics_push": {"enable": true}}`,
+			`{"mode": "dpdk", "metrics_push": {"enable": true, "url": "pushgateway:9091"}}`,
+			`{"mode": "dpdk", "metrics_push": {"enable": true, "url": "http://pushgateway:9091", "interval": "0s"}}`,
+			`{"mode": "dpdk", "metrics_push": {"enable": true, "url": "http://pushgateway:9091", "grouping": {"job": "x"}}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "metrics_push": {"enable": true, "url": "http://pushgateway:9091"}}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, metricsPushJobDefault, conf.MetricsPush.Job)
+		require.Equal(t, "15s", conf.MetricsPush.Interval)
+	})
+
+	t.Run("session events feed is validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "session_events": {"enable": true, "address": "8808"}}`,
+			`{"mode": "dpdk", "session_events": {"enable": true, "queue_size": -1}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "session_events": {"enable": true}}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, ":8808", conf.SessionEvents.Address)
+		require.Equal(t, 4096, conf.SessionEvents.QueueSize)
+	})
+
+	t.Run("FAR duplication is validated", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "far_duplication": {"enable": true}}`,
+			`{"mode": "dpdk", "far_duplication": {"enable": true, "mode": "raw"}}`,
+			`{"mode": "dpdk", "far_duplication": {"enable": true, "mode": "gre", "endpoint": "198.18.0.10"}}`,
+			`{"mode": "dpdk", "datapath": "xdp", "xdp": {"access_ifname": "eth0", "core_ifname": "eth1"}, "far_duplication": {"enable": true, "endpoint": "198.18.0.10"}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "far_duplication": {"enable": true, "endpoint": "198.18.0.10"}}`, confPath)
+
+		conf, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+		require.Equal(t, duplicationModeGTPU, conf.FARDuplication.Mode)
+	})
+
+	t.Run("FAR redirection", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "far_redirect": {"enable": true, "gateway": "2001:db8::1"}}`,
+			`{"mode": "dpdk", "enable_p4rt": true, "far_redirect": {"enable": true}}`,
+			`{"mode": "dpdk", "datapath": "gtp", "far_redirect": {"enable": true}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "far_redirect": {"enable": true, "gateway": "198.18.0.41"}}`, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+	})
+
+	t.Run("header enrichment", func(t *testing.T) {
+		for _, s := range []string{
+			`{"mode": "dpdk", "header_enrichment": {"enable": true}}`,
+			`{"mode": "dpdk", "enable_p4rt": true, "header_enrichment": {"enable": true, "proxy": "198.18.0.50"}}`,
+			`{"mode": "dpdk", "header_enrichment": {"enable": true, "proxy": "198.18.0.50", "policies": {"he": {"X-A: b": "c"}}}}`,
+		} {
+			confPath := t.TempDir() + "/conf.json"
+			mustWriteStringToDisk(s, confPath)
+
+			_, err := LoadConfigFile(confPath)
+			require.Error(t, err, s)
+		}
+
+		confPath := t.TempDir() + "/conf.json"
+		mustWriteStringToDisk(`{"mode": "dpdk", "header_enrichment": {"enable": true, "proxy": "198.18.0.50", "policies": {"he": {"X-Partner": "acme"}}}}`, confPath)
+
+		_, err := LoadConfigFile(confPath)
+		require.NoError(t, err)
+	})
+
 	t.Run("all sample configs must be valid", func(t *testing.T) {
 		paths := []string{
 			"../conf/upf.json",
@@ -32,10 +32,28 @@ type sequenceNumber struct {
 }
 
 type recoveryTS struct {
-	local  time.Time
+	local time.Time
+	// mu guards remote, updated by the heartbeats and the association messages.
+	mu     sync.Mutex
 	remote time.Time
 }
 
+// getRemote returns the recovery timestamp of the peer, zero if not known yet.
+func (t *recoveryTS) getRemote() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.remote
+}
+
+// setRemote records the recovery timestamp of the peer.
+func (t *recoveryTS) setRemote(ts time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.remote = ts
+}
+
 type nodeID struct {
 	localIE *ie.IE
 	local   string
@@ -54,13 +72,39 @@ type PFCPConn struct {
 	appPFDs    map[string]appPFD
 
 	store SessionsStore
+	usage *usageTracker
+	qos   *qosMonitor
+	ddn   *ddnThrottle
+	teids *teidIndex
+	// writer queues the datapath writes when asynchronous writes are enabled.
+	writer *datapathWriter
+	// limiter limits the rate of session related requests, nil if unlimited.
+	limiter *tokenBucket
+	// responses answer the retransmitted session requests.
+	responses *responseCache
+	// workers handle the session related messages, nil if handled as they are read.
+	workers *pfcpWorkers
+	// recv queues the received messages behind the heartbeats, nil if handled as they
+	// are read.
+	recv *pfcpRecvQueue
+	// trace keeps the last messages exchanged with the peer, nil if not traced.
+	trace *pfcpTrace
+	// inactivity detects the sessions idle for their User Plane Inactivity Timer.
+	inactivity *inactivityTracker
+	// rtt adapts the response timeout and heartbeat interval to the peer.
+	rtt rttEstimator
+	// assocLoss records the loss of the association owning the sessions.
+	assocLoss associationLoss
 
 	nodeID nodeID
-	upf    *upf
+	// cpFeatures are the CP Function Features of the CP node.
+	cpFeatures uint8
+	upf        *upf
 	// channel to signal PFCPNode on exit
 	done             chan<- string
 	shutdown         chan struct{}
 	gwIp             string
+	sentIpsLock      sync.Mutex
 	sentIpsToRouters map[uint32]struct{}
 	metrics.InstrumentPFCP
 
@@ -80,11 +124,16 @@ func (pConn *PFCPConn) startHeartBeatMonitor() {
 	hbCtx, hbCancel := context.WithCancel(pConn.ctx)
 	pConn.hbCtxCancel = hbCancel
 
+	interval := pConn.rtt.hbInterval(pConn.timers())
+
 	log.WithFields(log.Fields{
-		"interval": pConn.upf.hbInterval,
+		"interval": interval,
 	}).Infoln("Starting Heartbeat timer")
 
-	heartBeatExpiryTimer := time.NewTicker(pConn.upf.hbInterval)
+	heartBeatExpiryTimer := time.NewTicker(interval)
+	failure := &hbFailure{pConn: pConn}
+
+	defer failure.stop()
 
 	for {
 		select {
@@ -92,17 +141,47 @@ func (pConn *PFCPConn) startHeartBeatMonitor() {
 			log.Infoln("Cancel HeartBeat Timer", pConn.RemoteAddr().String())
 			heartBeatExpiryTimer.Stop()
 
+			return
+		case <-failure.expired():
+			log.Warnln("CP node", pConn.RemoteAddr(), "did not recover within the grace period, purging its sessions")
+			heartBeatExpiryTimer.Stop()
+			failure.stop()
+			pConn.Shutdown()
+
 			return
 		case <-pConn.hbReset:
-			heartBeatExpiryTimer.Reset(pConn.upf.hbInterval)
+			failure.recover()
+
+			interval = pConn.rtt.hbInterval(pConn.timers())
+			heartBeatExpiryTimer.Reset(interval)
 		case <-heartBeatExpiryTimer.C:
 			log.Traceln("HeartBeat Interval Timer Expired", pConn.RemoteAddr().String())
 
 			r := pConn.getHeartBeatRequest()
 
-			if _, timeout := pConn.sendPFCPRequestMessage(r); timeout {
+			reply, timeout := pConn.sendPFCPRequestMessage(r)
+			if timeout && failure.fail() {
 				heartBeatExpiryTimer.Stop()
 				pConn.Shutdown()
+
+				return
+			} else if reply != nil {
+				failure.recover()
+
+				if err := pConn.handleHeartbeatResponse(reply); err != nil {
+					log.Errorln("Handling of Heartbeat Response failed", pConn.RemoteAddr(), err)
+				}
+			}
+
+			if next := pConn.rtt.hbInterval(pConn.timers()); next != interval {
+				log.WithFields(log.Fields{
+					"peer":     pConn.RemoteAddr(),
+					"rtt":      pConn.rtt.smoothed(),
+					"interval": next,
+				}).Debugln("Heartbeat interval adapted")
+
+				interval = next
+				heartBeatExpiryTimer.Reset(interval)
 			}
 		}
 	}
@@ -116,10 +195,6 @@ func (node *PFCPNode) NewPFCPConn(lAddr, rAddr string, buf []byte) *PFCPConn {
 		log.Errorln("dial socket failed", err)
 	}
 
-	ts := recoveryTS{
-		local: time.Now(),
-	}
-
 	// TODO: Get SEID range from PFCPNode for this PFCPConn
 	log.Infoln("Created PFCPConn from:", conn.LocalAddr(), "to:", conn.RemoteAddr())
 
@@ -128,10 +203,15 @@ func (node *PFCPNode) NewPFCPConn(lAddr, rAddr string, buf []byte) *PFCPConn {
 	var p = &PFCPConn{
 		ctx:              node.ctx,
 		Conn:             conn,
-		ts:               ts,
+		ts:               recoveryTS{local: node.upf.recoveryTS},
 		rng:              rng,
 		maxRetries:       100,
-		store:            NewInMemoryStore(),
+		store:            newInstrumentedStore(NewInMemoryStore(), storeBackendMemory, node.metrics),
+		usage:            newUsageTracker(),
+		qos:              newQoSMonitor(),
+		inactivity:       newInactivityTracker(),
+		ddn:              newDDNThrottle(),
+		teids:            newTEIDIndex(),
 		upf:              node.upf,
 		done:             node.pConnDone,
 		shutdown:         make(chan struct{}),
@@ -144,6 +224,35 @@ func (node *PFCPNode) NewPFCPConn(lAddr, rAddr string, buf []byte) *PFCPConn {
 
 	p.setLocalNodeID(node.upf.NodeID)
 
+	p.responses = newResponseCache(node.upf.getPFCPTimers().forPeer(conn.RemoteAddr()))
+
+	if rl := node.upf.pfcpRateLimit; rl.Rate > 0 {
+		p.limiter = newTokenBucket(rl.Rate, rl.Burst)
+	}
+
+	if node.upf.asyncWrites {
+		p.writer = newDatapathWriter(p)
+		go p.writer.run()
+	}
+
+	if node.upf.pfcpWorkers > 0 {
+		p.workers = newPFCPWorkers(node.upf.pfcpWorkers, p.processPFCPMsg)
+		p.workers.run()
+	}
+
+	p.recv = newPFCPRecvQueue(p.handlePFCPMsg)
+
+	if node.upf.pfcpTraceSize > 0 {
+		p.trace = newPFCPTrace(node.upf.pfcpTraceSize)
+	}
+
+	if node.replication != nil {
+		node.replication.watch(p)
+	}
+
+	node.upf.sessionEvents.watch(p)
+	node.upf.sessionLimit.watch(p)
+
 	if buf != nil {
 		// TODO: Check if the first msg is Association Setup Request
 		p.HandlePFCPMsg(buf)
@@ -153,6 +262,7 @@ func (node *PFCPNode) NewPFCPConn(lAddr, rAddr string, buf []byte) *PFCPConn {
 	node.pConns.Store(rAddr, p)
 
 	go p.Serve()
+	go p.usageReportLoop()
 
 	return p
 }
@@ -170,7 +280,7 @@ func (pConn *PFCPConn) setLocalNodeID(id string) {
 
 	// NodeID provided is not an IP, use local address
 	if nodeIP == nil {
-		nodeIP = pConn.LocalAddr().(*net.UDPAddr).IP
+		nodeIP = pConn.localIP()
 	}
 
 	pConn.nodeID.local = nodeIP.String()
@@ -183,14 +293,28 @@ func (pConn *PFCPConn) setLocalNodeID(id string) {
 	}
 }
 
+// localIP returns the IP advertised to the peer, the local address of the connection
+// unless another node IP is set.
+func (pConn *PFCPConn) localIP() net.IP {
+	if pConn.upf.nodeIP != nil {
+		return pConn.upf.nodeIP
+	}
+
+	return pConn.LocalAddr().(*net.UDPAddr).IP
+}
+
 // Serve serves forever a single PFCP peer.
 func (pConn *PFCPConn) Serve() {
+	if pConn.recv != nil {
+		go pConn.recv.run()
+	}
+
 	connTimeout := make(chan struct{}, 1)
 	go func(connTimeout chan struct{}) {
-		recvBuf := make([]byte, 65507) // Maximum UDP payload size
+		recvBuf := make([]byte, maxPFCPMsgSize)
 
 		for {
-			err := pConn.SetReadDeadline(time.Now().Add(pConn.upf.readTimeout))
+			err := pConn.SetReadDeadline(time.Now().Add(pConn.timers().readTimeout))
 			if err != nil {
 				log.Errorf("failed to set read timeout: %v", err)
 			}
@@ -198,6 +322,10 @@ func (pConn *PFCPConn) Serve() {
 			n, err := pConn.Read(recvBuf)
 			if err != nil {
 				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					if pConn.upf.toleratesReadTimeout() {
+						continue
+					}
+
 					log.Infof("Read timeout for connection %v<->%v, is the SMF still alive?",
 						pConn.LocalAddr(), pConn.RemoteAddr())
 					connTimeout <- struct{}{}
@@ -212,8 +340,14 @@ func (pConn *PFCPConn) Serve() {
 				continue
 			}
 
-			buf := append([]byte{}, recvBuf[:n]...)
-			pConn.HandlePFCPMsg(buf)
+			buf := getPFCPBuf(n)
+			copy(*buf, recvBuf[:n])
+
+			if pConn.recv != nil {
+				pConn.recv.receive(*buf, buf)
+			} else {
+				pConn.handlePFCPMsg(*buf, buf)
+			}
 		}
 	}(connTimeout)
 
@@ -243,10 +377,25 @@ func (pConn *PFCPConn) Shutdown() {
 		pConn.hbCtxCancel = nil
 	}
 
+	// Queued writes are dropped, the sessions being removed anyway.
+	if pConn.writer != nil {
+		pConn.writer.close()
+	}
+
+	if pConn.workers != nil {
+		pConn.workers.close()
+	}
+
+	if pConn.recv != nil {
+		pConn.recv.close()
+	}
+
 	// Cleanup all sessions in this conn
-	for _, sess := range pConn.store.GetAllSessions() {
-		pConn.upf.SendMsgToUPF(upfMsgTypeDel, sess.PacketForwardingRules, PacketForwardingRules{})
-		pConn.RemoveSession(sess)
+	purged := pConn.purgeSessions()
+
+	if pConn.nodeID.remote != "" {
+		pConn.upf.associations.down(pConn.nodeID.remote)
+		pConn.notifyWebhooks(webhookEvent{Event: webhookAssociationDown, Sessions: purged})
 	}
 
 	rAddr := pConn.RemoteAddr().String()
@@ -261,6 +410,94 @@ func (pConn *PFCPConn) Shutdown() {
 	log.Infoln("Shutdown complete for", rAddr)
 }
 
+// purgeSessions removes all sessions of this connection from the datapath and the store.
+// Returns the number of sessions removed.
+func (pConn *PFCPConn) purgeSessions() int {
+	return pConn.removeSessions("purged", nil)
+}
+
+// removeSessions removes the sessions of this connection selected by match, all of them
+// if nil, audited with reason. Returns the number of sessions removed.
+func (pConn *PFCPConn) removeSessions(reason string, match func(PFCPSession) bool) int {
+	removed := 0
+
+	for _, sess := range pConn.store.GetAllSessions() {
+		if match != nil && !match(sess) {
+			continue
+		}
+
+		removed++
+
+		pConn.upf.SendMsgToUPF(upfMsgTypeDel, sess.PacketForwardingRules, PacketForwardingRules{})
+
+		if pConn.upf.ipam != nil {
+			if err := releaseAllocatedIPs(pConn.upf.ipam, &sess); err != nil {
+				log.Warnln("Failed to release UE IP of session", sess.localSEID, err)
+			}
+		}
+
+		pConn.RemoveSession(sess)
+
+		pConn.upf.auditLog.record(sessionAuditEvent{
+			Time:      time.Now(),
+			Peer:      pConn.nodeID.remote,
+			SEID:      sess.localSEID,
+			UEIP:      sessionUEIP(sess),
+			Operation: auditOpDelete,
+			Reason:    reason,
+		})
+	}
+
+	return removed
+}
+
+// inOrder calls fn once the messages received before are handled, e.g. to purge the
+// sessions after them when handling a heartbeat, received ahead of the queued messages.
+func (pConn *PFCPConn) inOrder(fn func()) {
+	run := func() {
+		if pConn.workers != nil {
+			pConn.workers.wait()
+		}
+
+		fn()
+	}
+
+	if pConn.recv != nil {
+		pConn.recv.do(run)
+		return
+	}
+
+	run()
+}
+
+// updateRemoteRecoveryTS records the recovery timestamp advertised by the peer.
+// If the peer advertises a newer timestamp than the one already known, the peer has
+// restarted and lost its state, so all its sessions are purged.
+func (pConn *PFCPConn) updateRemoteRecoveryTS(ts time.Time) {
+	pConn.ts.mu.Lock()
+
+	old := pConn.ts.remote
+	if !old.IsZero() && !ts.After(old) {
+		pConn.ts.mu.Unlock()
+		return
+	}
+
+	pConn.ts.remote = ts
+	pConn.ts.mu.Unlock()
+
+	if old.IsZero() {
+		return
+	}
+
+	if pConn.nodeID.remote != "" {
+		pConn.upf.associations.recovery(pConn.nodeID.remote, ts)
+	}
+
+	n := pConn.purgeSessions()
+	log.Warnln("Peer", pConn.RemoteAddr(), "restarted with recovery timestamp:", ts,
+		"older:", old, "purged", n, "sessions")
+}
+
 func (pConn *PFCPConn) getSeqNum() uint32 {
 	pConn.seqNum.mux.Lock()
 	defer pConn.seqNum.mux.Unlock()
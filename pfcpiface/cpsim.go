@@ -0,0 +1,455 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/omec-project/pfcpsim/pkg/pfcpsim/session"
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+const (
+	cpsimTimeoutDefault     = 5 * time.Second
+	cpsimConcurrencyDefault = 1
+)
+
+// CPSimConf configures the control-plane simulator, a minimal SMF associating with a
+// UPF over N4 and establishing, modifying then deleting sessions against it.
+type CPSimConf struct {
+	// UPFAddr is the N4 address of the UPF, with an optional port.
+	UPFAddr string
+	// NodeID is the IP address of the simulator, sent as its Node ID and F-SEID.
+	NodeID string
+	// N3Address is the N3 address of the UPF, the F-TEID of the uplink PDRs.
+	N3Address string
+	// GNBAddress is the gNB address the downlink traffic is tunneled to.
+	GNBAddress string
+	// UEPool is the IPv4 CIDR the UE addresses are taken from.
+	UEPool   string
+	Sessions int
+	// Rate is the number of requests per second of each procedure, unlimited if 0.
+	Rate int
+	// Concurrency is the number of requests in flight.
+	Concurrency int
+	// Modifications is the number of Session Modification Requests sent per session.
+	Modifications int
+	Timeout       time.Duration
+}
+
+// CPSimLatency is the latency of the requests of a PFCP procedure.
+type CPSimLatency struct {
+	Requests int
+	Failed   int
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+}
+
+// CPSimReport is the outcome of a run of the control-plane simulator.
+type CPSimReport struct {
+	Establishment CPSimLatency
+	Modification  CPSimLatency
+	Deletion      CPSimLatency
+}
+
+func (r CPSimReport) String() string {
+	s := fmt.Sprintf("%-14s %8s %8s %12s %12s %12s %12s\n", "procedure", "requests", "failed", "p50", "p90", "p99", "max")
+
+	for _, p := range []struct {
+		name string
+		l    CPSimLatency
+	}{
+		{"establishment", r.Establishment},
+		{"modification", r.Modification},
+		{"deletion", r.Deletion},
+	} {
+		s += fmt.Sprintf("%-14s %8d %8d %12v %12v %12v %12v\n", p.name, p.l.Requests, p.l.Failed,
+			p.l.P50, p.l.P90, p.l.P99, p.l.Max)
+	}
+
+	return s
+}
+
+// newCPSimLatency returns the percentiles of the latencies of the successful requests.
+func newCPSimLatency(latencies []time.Duration, failed int) CPSimLatency {
+	l := CPSimLatency{Requests: len(latencies) + failed, Failed: failed}
+	if len(latencies) == 0 {
+		return l
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	percentile := func(p float64) time.Duration {
+		return latencies[int(math.Ceil(p*float64(len(latencies))))-1]
+	}
+
+	l.P50, l.P90, l.P99 = percentile(0.5), percentile(0.9), percentile(0.99)
+	l.Max = latencies[len(latencies)-1]
+
+	return l
+}
+
+// cpsimClient sends PFCP requests to the UPF and matches their responses by sequence
+// number, so that several requests can be in flight.
+type cpsimClient struct {
+	conn    *net.UDPConn
+	nodeID  net.IP
+	timeout time.Duration
+	seq     uint32
+
+	mu      sync.Mutex
+	pending map[uint32]chan message.Message
+}
+
+func newCPSimClient(conf CPSimConf) (*cpsimClient, error) {
+	addr := conf.UPFAddr
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, PFCPPort)
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeID := net.ParseIP(conf.NodeID)
+	if nodeID == nil {
+		nodeID = conn.LocalAddr().(*net.UDPAddr).IP
+	}
+
+	c := &cpsimClient{
+		conn:    conn,
+		nodeID:  nodeID,
+		timeout: conf.Timeout,
+		pending: make(map[uint32]chan message.Message),
+	}
+
+	go c.recv()
+
+	return c, nil
+}
+
+func (c *cpsimClient) nextSeq() uint32 {
+	return atomic.AddUint32(&c.seq, 1)
+}
+
+// recv delivers the responses to the pending requests and answers the requests of
+// the UPF, until the connection is closed.
+func (c *cpsimClient) recv() {
+	buf := make([]byte, maxPFCPMsgSize)
+
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return
+		}
+
+		// The parsed message refers to its buffer, which is reused by the next read.
+		msg, err := message.Parse(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			log.Warnln("cpsim: ignoring malformed message:", err)
+			continue
+		}
+
+		var reply message.Message
+
+		switch req := msg.(type) {
+		case *message.HeartbeatRequest:
+			reply = message.NewHeartbeatResponse(req.Sequence(), ie.NewRecoveryTimeStamp(time.Now()))
+		case *message.SessionReportRequest:
+			reply = message.NewSessionReportResponse(0, 0, req.SEID(), req.Sequence(), 0,
+				ie.NewCause(ie.CauseRequestAccepted))
+		default:
+			c.mu.Lock()
+			ch, ok := c.pending[msg.Sequence()]
+			delete(c.pending, msg.Sequence())
+			c.mu.Unlock()
+
+			if ok {
+				ch <- msg
+			}
+
+			continue
+		}
+
+		if err := c.send(reply); err != nil {
+			log.Warnln("cpsim: failed to answer", msg.MessageTypeName(), err)
+		}
+	}
+}
+
+func (c *cpsimClient) send(msg message.Message) error {
+	b := make([]byte, msg.MarshalLen())
+	if err := msg.MarshalTo(b); err != nil {
+		return err
+	}
+
+	_, err := c.conn.Write(b)
+
+	return err
+}
+
+// request sends req and returns its response, or an error if the UPF does not
+// answer within the timeout or rejects it.
+func (c *cpsimClient) request(req message.Message) (message.Message, error) {
+	ch := make(chan message.Message, 1)
+
+	c.mu.Lock()
+	c.pending[req.Sequence()] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, req.Sequence())
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(req); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, checkCPSimCause(resp)
+	case <-time.After(c.timeout):
+		return nil, ErrOperationFailedWithReason(req.MessageTypeName(), "no response")
+	}
+}
+
+// checkCPSimCause returns an error unless the UPF accepted the request of resp.
+func checkCPSimCause(resp message.Message) error {
+	var causeIE *ie.IE
+
+	switch r := resp.(type) {
+	case *message.AssociationSetupResponse:
+		causeIE = r.Cause
+	case *message.AssociationReleaseResponse:
+		causeIE = r.Cause
+	case *message.SessionEstablishmentResponse:
+		causeIE = r.Cause
+	case *message.SessionModificationResponse:
+		causeIE = r.Cause
+	case *message.SessionDeletionResponse:
+		causeIE = r.Cause
+	default:
+		return ErrUnsupported("response", resp.MessageTypeName())
+	}
+
+	if causeIE == nil {
+		return ErrOperationFailedWithReason(resp.MessageTypeName(), "missing cause")
+	}
+
+	cause, err := causeIE.Cause()
+	if err != nil {
+		return err
+	}
+
+	if cause != ie.CauseRequestAccepted {
+		return ErrOperationFailedWithParam(resp.MessageTypeName(), "cause", cause)
+	}
+
+	return nil
+}
+
+func (c *cpsimClient) close() {
+	c.conn.Close()
+}
+
+// cpsimSession is a session established by the simulator.
+type cpsimSession struct {
+	localSEID uint64
+	peerSEID  uint64
+	teid      uint32
+}
+
+// RunCPSim associates with the UPF, establishes, modifies then deletes the sessions
+// of conf and reports the latency of each procedure.
+func RunCPSim(ctx context.Context, conf CPSimConf) (CPSimReport, error) {
+	var report CPSimReport
+
+	if conf.Timeout == 0 {
+		conf.Timeout = cpsimTimeoutDefault
+	}
+
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = cpsimConcurrencyDefault
+	}
+
+	_, pool, err := net.ParseCIDR(conf.UEPool)
+	if err != nil || pool.IP.To4() == nil {
+		return report, ErrInvalidArgumentWithReason("UE pool", conf.UEPool, "invalid IPv4 CIDR")
+	}
+
+	if ones, bits := pool.Mask.Size(); conf.Sessions > 1<<uint(bits-ones) {
+		return report, ErrInvalidArgumentWithReason("UE pool", conf.UEPool, "smaller than the number of sessions")
+	}
+
+	c, err := newCPSimClient(conf)
+	if err != nil {
+		return report, err
+	}
+	defer c.close()
+
+	_, err = c.request(message.NewAssociationSetupRequest(c.nextSeq(),
+		ie.NewNodeID(c.nodeID.String(), "", ""),
+		ie.NewRecoveryTimeStamp(time.Now()),
+	))
+	if err != nil {
+		return report, ErrOperationFailedWithReason("association setup", err.Error())
+	}
+
+	sessions := make([]*cpsimSession, conf.Sessions)
+	ueBase := ip2int(pool.IP)
+
+	report.Establishment = runCPSimProcedure(ctx, conf, func(i int) error {
+		sess := &cpsimSession{localSEID: uint64(i + 1), teid: uint32(i + 1)}
+
+		req := message.NewSessionEstablishmentRequest(0, 0, 0, c.nextSeq(), 0,
+			ie.NewNodeID(c.nodeID.String(), "", ""),
+			ie.NewFSEID(sess.localSEID, c.nodeID, nil),
+			ie.NewPDNType(ie.PDNTypeIPv4),
+		)
+		req.CreatePDR = []*ie.IE{
+			session.NewPDRBuilder().MarkAsUplink().WithMethod(session.Create).WithID(1).
+				WithTEID(sess.teid).WithN3Address(conf.N3Address).WithFARID(1).AddQERID(1).BuildPDR(),
+			session.NewPDRBuilder().MarkAsDownlink().WithMethod(session.Create).WithID(2).
+				WithUEAddress(int2ip(ueBase + uint32(i)).String()).WithFARID(2).AddQERID(1).BuildPDR(),
+		}
+		req.CreateFAR = []*ie.IE{
+			session.NewFARBuilder().WithMethod(session.Create).WithID(1).
+				WithDstInterface(ie.DstInterfaceCore).WithAction(session.ActionForward).BuildFAR(),
+			// The downlink is only forwarded once the gNB tunnel is known, by the modification.
+			session.NewFARBuilder().WithMethod(session.Create).WithID(2).
+				WithDstInterface(ie.DstInterfaceAccess).WithAction(session.ActionDrop).BuildFAR(),
+		}
+		req.CreateQER = []*ie.IE{
+			session.NewQERBuilder().WithMethod(session.Create).WithID(1).
+				WithUplinkMBR(500000).WithDownlinkMBR(500000).Build(),
+		}
+
+		resp, err := c.request(req)
+		if err != nil {
+			return err
+		}
+
+		seres, ok := resp.(*message.SessionEstablishmentResponse)
+		if !ok || seres.UPFSEID == nil {
+			return ErrOperationFailedWithReason(resp.MessageTypeName(), "missing UP F-SEID")
+		}
+
+		fseid, err := seres.UPFSEID.FSEID()
+		if err != nil {
+			return err
+		}
+
+		sess.peerSEID = fseid.SEID
+		sessions[i] = sess
+
+		return nil
+	}, conf.Sessions)
+
+	report.Modification = runCPSimProcedure(ctx, conf, func(i int) error {
+		sess := sessions[i/conf.Modifications]
+		if sess == nil {
+			return ErrNotFound("session")
+		}
+
+		req := message.NewSessionModificationRequest(0, 0, sess.peerSEID, c.nextSeq(), 0)
+		req.UpdateFAR = []*ie.IE{
+			session.NewFARBuilder().WithMethod(session.Update).WithID(2).
+				WithDstInterface(ie.DstInterfaceAccess).WithAction(session.ActionForward).
+				WithTEID(sess.teid).WithDownlinkIP(conf.GNBAddress).BuildFAR(),
+		}
+
+		_, err := c.request(req)
+
+		return err
+	}, conf.Sessions*conf.Modifications)
+
+	report.Deletion = runCPSimProcedure(ctx, conf, func(i int) error {
+		sess := sessions[i]
+		if sess == nil {
+			return ErrNotFound("session")
+		}
+
+		_, err := c.request(message.NewSessionDeletionRequest(0, 0, sess.peerSEID, c.nextSeq(), 0,
+			ie.NewFSEID(sess.localSEID, c.nodeID, nil)))
+
+		return err
+	}, conf.Sessions)
+
+	_, err = c.request(message.NewAssociationReleaseRequest(c.nextSeq(), ie.NewNodeID(c.nodeID.String(), "", "")))
+	if err != nil {
+		log.Warnln("cpsim: association release failed:", err)
+	}
+
+	return report, ctx.Err()
+}
+
+// runCPSimProcedure calls send for the n requests of a procedure, paced by the rate
+// and with up to the concurrency of conf in flight, and returns their latency.
+func runCPSimProcedure(ctx context.Context, conf CPSimConf, send func(i int) error, n int) CPSimLatency {
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		failed    int
+		wg        sync.WaitGroup
+	)
+
+	requests := make(chan int)
+
+	for w := 0; w < conf.Concurrency; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range requests {
+				start := time.Now()
+				err := send(i)
+				latency := time.Since(start)
+
+				mu.Lock()
+				if err != nil {
+					log.Debugln("cpsim: request failed:", err)
+					failed++
+				} else {
+					latencies = append(latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	start := time.Now()
+
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		if conf.Rate > 0 {
+			time.Sleep(time.Until(start.Add(time.Duration(i) * time.Second / time.Duration(conf.Rate))))
+		}
+
+		requests <- i
+	}
+
+	close(requests)
+	wg.Wait()
+
+	return newCPSimLatency(latencies, failed)
+}
@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+// fakeCPSimUPF accepts all the requests of the simulator, rejecting the
+// modifications of the sessions in reject.
+func fakeCPSimUPF(t *testing.T, reject map[uint64]bool) net.Addr {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	accepted := ie.NewCause(ie.CauseRequestAccepted)
+
+	go func() {
+		buf := make([]byte, maxPFCPMsgSize)
+
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			msg, err := message.Parse(buf[:n])
+			if err != nil {
+				continue
+			}
+
+			var reply message.Message
+
+			switch req := msg.(type) {
+			case *message.AssociationSetupRequest:
+				reply = message.NewAssociationSetupResponse(req.Sequence(), accepted)
+			case *message.AssociationReleaseRequest:
+				reply = message.NewAssociationReleaseResponse(req.Sequence(), ie.NewNodeID("127.0.0.1", "", ""), accepted)
+			case *message.SessionEstablishmentRequest:
+				fseid, _ := req.CPFSEID.FSEID()
+				reply = message.NewSessionEstablishmentResponse(0, 0, fseid.SEID, req.Sequence(), 0, accepted,
+					ie.NewFSEID(fseid.SEID+100, net.ParseIP("127.0.0.1"), nil))
+			case *message.SessionModificationRequest:
+				cause := accepted
+				if reject[req.SEID()-100] {
+					cause = ie.NewCause(ie.CauseSessionContextNotFound)
+				}
+
+				reply = message.NewSessionModificationResponse(0, 0, req.SEID()-100, req.Sequence(), 0, cause)
+			case *message.SessionDeletionRequest:
+				reply = message.NewSessionDeletionResponse(0, 0, req.SEID()-100, req.Sequence(), 0, accepted)
+			default:
+				continue
+			}
+
+			b := make([]byte, reply.MarshalLen())
+			if reply.MarshalTo(b) == nil {
+				_, _ = conn.WriteTo(b, addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr()
+}
+
+func TestRunCPSim(t *testing.T) {
+	addr := fakeCPSimUPF(t, map[uint64]bool{3: true})
+
+	report, err := RunCPSim(context.Background(), CPSimConf{
+		UPFAddr:       addr.String(),
+		NodeID:        "127.0.0.1",
+		N3Address:     "198.18.0.1",
+		GNBAddress:    "198.18.0.10",
+		UEPool:        "17.0.0.0/24",
+		Sessions:      10,
+		Concurrency:   4,
+		Modifications: 2,
+		Timeout:       time.Second,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, 10, report.Establishment.Requests)
+	require.Zero(t, report.Establishment.Failed)
+	require.Equal(t, 20, report.Modification.Requests)
+	require.Equal(t, 2, report.Modification.Failed)
+	require.Equal(t, 10, report.Deletion.Requests)
+	require.Zero(t, report.Deletion.Failed)
+	require.LessOrEqual(t, report.Establishment.P50, report.Establishment.Max)
+
+	t.Run("UE pool must hold the sessions", func(t *testing.T) {
+		_, err := RunCPSim(context.Background(), CPSimConf{UPFAddr: addr.String(), UEPool: "17.0.0.0/30", Sessions: 10})
+		require.Error(t, err)
+	})
+}
+
+func Test_newCPSimLatency(t *testing.T) {
+	var latencies []time.Duration
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	l := newCPSimLatency(latencies, 3)
+	require.Equal(t, CPSimLatency{
+		Requests: 103,
+		Failed:   3,
+		P50:      50 * time.Millisecond,
+		P90:      90 * time.Millisecond,
+		P99:      99 * time.Millisecond,
+		Max:      100 * time.Millisecond,
+	}, l)
+
+	require.Equal(t, CPSimLatency{Requests: 1, Failed: 1}, newCPSimLatency(nil, 1))
+}
@@ -36,9 +36,11 @@ type datapath interface {
 	/* Close any pending sessions */
 	Exit()
 	/* setup internal parameters and channel with datapath */
-	SetUpfInfo(u *upf, conf *Conf)
-	/* set up slice info */
+	SetUpfInfo(u *upf, conf *Conf) error
+	/* set up slice info, replacing the slice of the same name */
 	AddSliceInfo(sliceInfo *SliceInfo) error
+	/* remove slice info added by AddSliceInfo */
+	RemoveSliceInfo(sliceInfo *SliceInfo) error
 	/* write endMarker to datapath */
 	SendEndMarkers(endMarkerList *[][]byte) error
 	/* write pdr/far/qer to datapath */
@@ -46,6 +48,20 @@ type datapath interface {
 	// "new" PacketForwardingRules are only used for update messages to UPF.
 	// TODO: we should have better CRUD API, with a single function per message type.
 	SendMsgToUPF(method upfMsgType, all PacketForwardingRules, new PacketForwardingRules) uint8
+	/* write added or modified rules of a session in one request, ErrUnsupported if the datapath cannot batch them */
+	WriteSessionBatch(method upfMsgType, all PacketForwardingRules, new PacketForwardingRules) error
+	/* update only the bit rates of an installed QER of the session of all, ErrUnsupported if the datapath cannot */
+	UpdateQERRates(q qer, all PacketForwardingRules) error
+	/* update only the action and tunnel of an installed FAR of the session of all, ErrUnsupported if the datapath cannot */
+	UpdateFARTunnel(f far, all PacketForwardingRules) error
+	/* read cumulative traffic counters of pdrs from datapath */
+	ReadPDRCounters(pdrs []pdr) (map[pdrCounterKey]pdrCounters, error)
+	/* read the traffic admitted and dropped by the meter of a slice, keyed by direction */
+	ReadSliceMeterCounters(sliceInfo *SliceInfo) (map[string]sliceMeterCounters, error)
+	/* read back the PDRs installed in datapath, the expected pdrs help datapaths that do not keep their IDs */
+	ReadInstalledPDRs(expected []pdr) (map[pdrCounterKey]struct{}, error)
+	/* delete installed PDRs read back by ReadInstalledPDRs */
+	DeleteInstalledPDRs(keys []pdrCounterKey) error
 	/* check of communication channel to datapath is setup */
 	IsConnected(AccessIP *net.IP) bool
 	SummaryLatencyJitter(uc *upfCollector, ch chan<- prometheus.Metric)
@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// datapathP4 is the backend label of the P4Runtime datapath, enabled by enable_p4rt.
+const datapathP4 = "p4"
+
+// datapathBackend returns the backend label of the datapath of conf.
+func datapathBackend(conf *Conf) string {
+	switch {
+	case conf.EnableP4rt:
+		return datapathP4
+	case conf.Datapath == "":
+		return datapathBESS
+	default:
+		return conf.Datapath
+	}
+}
+
+// datapathMetrics are the latency and the errors of the datapath calls, by backend and
+// operation, collected by the upfCollector.
+type datapathMetrics struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+func newDatapathMetrics() *datapathMetrics {
+	return &datapathMetrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "upf_datapath_operation_duration_seconds",
+			Help:    "The latency of the calls to the datapath",
+			Buckets: []float64{1e-5, 1e-4, 5e-4, 1e-3, 5e-3, 1e-2, 5e-2, 1e-1, 5e-1, 1, 5},
+		}, []string{"backend", "operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "upf_datapath_operation_errors_total",
+			Help: "Counter for failed calls to the datapath",
+		}, []string{"backend", "operation"}),
+	}
+}
+
+func (m *datapathMetrics) describe(ch chan<- *prometheus.Desc) {
+	if m == nil {
+		return
+	}
+
+	m.duration.Describe(ch)
+	m.errors.Describe(ch)
+}
+
+func (m *datapathMetrics) collect(ch chan<- prometheus.Metric) {
+	if m == nil {
+		return
+	}
+
+	m.duration.Collect(ch)
+	m.errors.Collect(ch)
+}
+
+// instrumentedDatapath records the latency and the errors of the rule, counter and
+// slice operations of a datapath, to spot a slow BESS module or P4Runtime switch.
+// Operations a datapath does not support are not recorded.
+type instrumentedDatapath struct {
+	datapath
+	backend string
+	metrics *datapathMetrics
+}
+
+func newInstrumentedDatapath(dp datapath, backend string, m *datapathMetrics) *instrumentedDatapath {
+	return &instrumentedDatapath{
+		datapath: dp,
+		backend:  backend,
+		metrics:  m,
+	}
+}
+
+func (d *instrumentedDatapath) observe(op string, start time.Time, err error) {
+	if errors.Is(err, errUnsupported) {
+		return
+	}
+
+	d.metrics.duration.WithLabelValues(d.backend, op).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		d.metrics.errors.WithLabelValues(d.backend, op).Inc()
+	}
+}
+
+func (d *instrumentedDatapath) SendMsgToUPF(method upfMsgType, all, updated PacketForwardingRules) uint8 {
+	start := time.Now()
+	cause := d.datapath.SendMsgToUPF(method, all, updated)
+
+	var err error
+	if cause != ie.CauseRequestAccepted {
+		err = ErrOperationFailedWithParam("send rules", "cause", cause)
+	}
+
+	d.observe(method.String(), start, err)
+
+	return cause
+}
+
+func (d *instrumentedDatapath) WriteSessionBatch(method upfMsgType, all, updated PacketForwardingRules) error {
+	start := time.Now()
+	err := d.datapath.WriteSessionBatch(method, all, updated)
+	d.observe("batch_"+method.String(), start, err)
+
+	return err
+}
+
+func (d *instrumentedDatapath) UpdateQERRates(q qer, all PacketForwardingRules) error {
+	start := time.Now()
+	err := d.datapath.UpdateQERRates(q, all)
+	d.observe("update_qer", start, err)
+
+	return err
+}
+
+func (d *instrumentedDatapath) UpdateFARTunnel(f far, all PacketForwardingRules) error {
+	start := time.Now()
+	err := d.datapath.UpdateFARTunnel(f, all)
+	d.observe("update_far", start, err)
+
+	return err
+}
+
+func (d *instrumentedDatapath) ReadPDRCounters(pdrs []pdr) (map[pdrCounterKey]pdrCounters, error) {
+	start := time.Now()
+	counters, err := d.datapath.ReadPDRCounters(pdrs)
+	d.observe("read_counters", start, err)
+
+	return counters, err
+}
+
+func (d *instrumentedDatapath) AddSliceInfo(sliceInfo *SliceInfo) error {
+	start := time.Now()
+	err := d.datapath.AddSliceInfo(sliceInfo)
+	d.observe("add_slice", start, err)
+
+	return err
+}
+
+func (d *instrumentedDatapath) RemoveSliceInfo(sliceInfo *SliceInfo) error {
+	start := time.Now()
+	err := d.datapath.RemoveSliceInfo(sliceInfo)
+	d.observe("remove_slice", start, err)
+
+	return err
+}
+
+func (d *instrumentedDatapath) SendEndMarkers(endMarkerList *[][]byte) error {
+	start := time.Now()
+	err := d.datapath.SendEndMarkers(endMarkerList)
+	d.observe("end_markers", start, err)
+
+	return err
+}
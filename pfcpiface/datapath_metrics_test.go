@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_datapathBackend(t *testing.T) {
+	require.Equal(t, datapathBESS, datapathBackend(&Conf{}))
+	require.Equal(t, datapathXDP, datapathBackend(&Conf{Datapath: datapathXDP}))
+	require.Equal(t, datapathP4, datapathBackend(&Conf{EnableP4rt: true}))
+}
+
+func TestInstrumentedDatapath(t *testing.T) {
+	m := newDatapathMetrics()
+	u := &upf{
+		datapath:        newInstrumentedDatapath(&resyncDatapath{rejected: 2}, datapathBESS, m),
+		datapathMetrics: m,
+	}
+
+	rules := func(fseid uint64) PacketForwardingRules {
+		return PacketForwardingRules{pdrs: []pdr{{fseID: fseid, pdrID: 1}}}
+	}
+
+	// The batch is unsupported, the rules are sent one by one.
+	u.sendSessionRules(upfMsgTypeAdd, rules(1), rules(1))
+	u.sendSessionRules(upfMsgTypeAdd, rules(2), rules(2))
+	u.sendSessionRules(upfMsgTypeDel, rules(1), PacketForwardingRules{})
+
+	ch := make(chan prometheus.Metric, 10)
+	m.collect(ch)
+	close(ch)
+
+	observed := make(map[string]uint64)
+	failed := make(map[string]float64)
+
+	for metric := range ch {
+		var dtoMetric dto.Metric
+		require.NoError(t, metric.Write(&dtoMetric))
+
+		labels := make(map[string]string)
+		for _, l := range dtoMetric.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+
+		require.Equal(t, datapathBESS, labels["backend"])
+
+		if h := dtoMetric.GetHistogram(); h != nil {
+			observed[labels["operation"]] = h.GetSampleCount()
+		} else {
+			failed[labels["operation"]] = dtoMetric.GetCounter().GetValue()
+		}
+	}
+
+	require.Equal(t, map[string]uint64{"add": 2, "delete": 1}, observed, "unsupported batches not recorded")
+	require.Equal(t, map[string]float64{"add": 1}, failed)
+}
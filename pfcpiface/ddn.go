@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"sync"
+	"time"
+)
+
+// ddnRetryInterval is the minimum time between two Downlink Data Reports of a session
+// that the CP has not reacted to with a Session Modification.
+const ddnRetryInterval = 20 * time.Second
+
+// Reasons for suppressing a Downlink Data Report, used as metric label.
+const (
+	ddnSuppressedPending   = "pending"
+	ddnSuppressedThrottled = "throttled"
+	// ddnSuppressedBatched are the notifications batched into the pending report, with
+	// ddn_batch_window set.
+	ddnSuppressedBatched = "batched"
+)
+
+type ddnState struct {
+	// pending is set while a report is delayed or in flight.
+	pending bool
+	// timer sends the delayed report, nil if not delayed.
+	timer *time.Timer
+	last  time.Time
+}
+
+// ddnThrottle rate limits Downlink Data Reports per session, so that a burst of
+// downlink packets towards an idle UE does not turn into a storm of reports.
+type ddnThrottle struct {
+	mu       sync.Mutex
+	sessions map[uint64]*ddnState
+}
+
+func newDDNThrottle() *ddnThrottle {
+	return &ddnThrottle{
+		sessions: make(map[uint64]*ddnState),
+	}
+}
+
+// admit returns true if a report for the session may be sent, and marks it pending.
+// Otherwise, returns the reason the report is suppressed.
+func (t *ddnThrottle) admit(seid uint64, now time.Time) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sessions[seid]
+	if !ok {
+		s = &ddnState{}
+		t.sessions[seid] = s
+	}
+
+	if s.pending {
+		return ddnSuppressedPending, false
+	}
+
+	if !s.last.IsZero() && now.Sub(s.last) < ddnRetryInterval {
+		return ddnSuppressedThrottled, false
+	}
+
+	s.pending = true
+
+	return "", true
+}
+
+// delay calls send after d to send the pending report of the session, unless the
+// session is reset before.
+func (t *ddnThrottle) delay(seid uint64, d time.Duration, send func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, ok := t.sessions[seid]; ok && s.pending {
+		s.timer = time.AfterFunc(d, send)
+	}
+}
+
+// sent records that the pending report of the session has been sent.
+func (t *ddnThrottle) sent(seid uint64, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, ok := t.sessions[seid]; ok {
+		s.pending = false
+		s.timer = nil
+		s.last = now
+	}
+}
+
+// reset forgets the reports of the session, e.g. after the CP modified or deleted it.
+// The delayed report is not sent.
+func (t *ddnThrottle) reset(seid uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, ok := t.sessions[seid]; ok && s.timer != nil {
+		s.timer.Stop()
+	}
+
+	delete(t.sessions, seid)
+}
+
+// notifyingDownlinkPDRs returns the IDs of the downlink PDRs of the session whose FAR
+// buffers and notifies, and the longest notification delay of their BARs.
+func (s *PFCPSession) notifyingDownlinkPDRs() ([]uint32, time.Duration) {
+	var (
+		pdrIDs      []uint32
+		notifyDelay time.Duration
+	)
+
+	for _, p := range s.pdrs {
+		if p.srcIface != core {
+			continue
+		}
+
+		for _, f := range s.fars {
+			if f.farID != p.farID || f.applyAction&ActionNotify == 0 {
+				continue
+			}
+
+			pdrIDs = append(pdrIDs, p.pdrID)
+
+			for _, b := range s.bars {
+				if b.barID == f.barID && b.notifyDelay > notifyDelay {
+					notifyDelay = b.notifyDelay
+				}
+			}
+		}
+	}
+
+	return pdrIDs, notifyDelay
+}
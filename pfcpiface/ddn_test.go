@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/message"
+
+	"github.com/omec-project/upf-epc/pfcpiface/metrics"
+)
+
+type ddnMetrics struct {
+	metrics.InstrumentPFCP
+	suppressed map[string]int
+}
+
+func (m *ddnMetrics) SaveMessages(msg *metrics.Message) {}
+
+func (m *ddnMetrics) SaveSuppressedDDN(nodeID, reason string) {
+	m.suppressed[reason]++
+}
+
+func Test_ddnThrottle(t *testing.T) {
+	const seid = uint64(1)
+
+	now := time.Now()
+	th := newDDNThrottle()
+
+	_, ok := th.admit(seid, now)
+	require.True(t, ok)
+
+	reason, ok := th.admit(seid, now)
+	require.False(t, ok)
+	require.Equal(t, ddnSuppressedPending, reason)
+
+	th.sent(seid, now)
+
+	reason, ok = th.admit(seid, now.Add(time.Second))
+	require.False(t, ok)
+	require.Equal(t, ddnSuppressedThrottled, reason)
+
+	_, ok = th.admit(seid, now.Add(ddnRetryInterval))
+	require.True(t, ok)
+
+	th.sent(seid, now.Add(ddnRetryInterval))
+	th.reset(seid)
+
+	_, ok = th.admit(seid, now.Add(ddnRetryInterval+time.Second))
+	require.True(t, ok, "session modified by the CP")
+
+	t.Run("reset stops the delayed report", func(t *testing.T) {
+		sent := make(chan struct{}, 1)
+
+		th.delay(seid, 50*time.Millisecond, func() { sent <- struct{}{} })
+		th.reset(seid)
+
+		select {
+		case <-sent:
+			t.Fatal("delayed report sent after reset")
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+}
+
+func TestPFCPSession_notifyingDownlinkPDRs(t *testing.T) {
+	s := PFCPSession{
+		PacketForwardingRules: PacketForwardingRules{
+			pdrs: []pdr{
+				{pdrID: 1, srcIface: access, farID: 1},
+				{pdrID: 2, srcIface: core, farID: 2},
+				{pdrID: 3, srcIface: core, farID: 3},
+				{pdrID: 4, srcIface: core, farID: 4},
+			},
+			fars: []far{
+				{farID: 1, applyAction: ActionForward},
+				{farID: 2, applyAction: ActionBuffer | ActionNotify, barID: 1},
+				{farID: 3, applyAction: ActionForward},
+				{farID: 4, applyAction: ActionBuffer | ActionNotify, barID: 2},
+			},
+			bars: []bar{
+				{barID: 1, notifyDelay: time.Second},
+				{barID: 2, notifyDelay: 2 * time.Second},
+			},
+		},
+	}
+
+	pdrIDs, notifyDelay := s.notifyingDownlinkPDRs()
+	require.Equal(t, []uint32{2, 4}, pdrIDs)
+	require.Equal(t, 2*time.Second, notifyDelay)
+}
+
+func TestPFCPConn_handleDigestReportBatches(t *testing.T) {
+	cp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { cp.Close() })
+
+	conn, err := net.Dial("udp", cp.LocalAddr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	m := &ddnMetrics{suppressed: make(map[string]int)}
+	pConn := &PFCPConn{
+		Conn:           conn,
+		upf:            &upf{ddnBatchWindow: 50 * time.Millisecond},
+		store:          NewInMemoryStore(),
+		ddn:            newDDNThrottle(),
+		InstrumentPFCP: m,
+		nodeID:         nodeID{remote: "smf"},
+	}
+
+	session := PFCPSession{
+		localSEID:  1,
+		remoteSEID: 10,
+		metrics:    metrics.NewSession("smf"),
+		PacketForwardingRules: PacketForwardingRules{
+			pdrs: []pdr{
+				{fseID: 1, pdrID: 2, srcIface: core, farID: 2},
+				{fseID: 1, pdrID: 3, srcIface: core, farID: 2},
+			},
+			fars: []far{{fseID: 1, farID: 2, applyAction: ActionBuffer | ActionNotify}},
+		},
+	}
+	require.NoError(t, pConn.store.PutSession(session, nil, false, 0))
+
+	for i := 0; i < 3; i++ {
+		pConn.handleDigestReport(1)
+	}
+
+	require.Equal(t, 2, m.suppressed[ddnSuppressedBatched])
+
+	buf := make([]byte, 1500)
+
+	require.NoError(t, cp.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := cp.Read(buf)
+	require.NoError(t, err)
+
+	msg, err := message.Parse(buf[:n])
+	require.NoError(t, err)
+
+	srreq, ok := msg.(*message.SessionReportRequest)
+	require.True(t, ok)
+	require.Equal(t, uint64(10), srreq.SEID())
+
+	ies, err := srreq.DownlinkDataReport.DownlinkDataReport()
+	require.NoError(t, err)
+
+	var pdrIDs []uint16
+
+	for _, i := range ies {
+		id, err := i.PDRID()
+		require.NoError(t, err)
+
+		pdrIDs = append(pdrIDs, id)
+	}
+
+	require.Equal(t, []uint16{2, 3}, pdrIDs)
+
+	// Only one report is sent for the batch.
+	require.NoError(t, cp.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, err = cp.Read(buf)
+	require.Error(t, err)
+}
@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errUnknownNetworkInstance = errors.New("unknown network instance")
+
+// dnnTable maps the Network Instances of the configured DNNs to their DNN. A nil
+// table serves any DNN, named by the Network Instance.
+type dnnTable map[string]string
+
+func newDNNTable(dnns []DNNInfo) dnnTable {
+	if len(dnns) == 0 {
+		return nil
+	}
+
+	t := make(dnnTable, len(dnns))
+	for _, d := range dnns {
+		t[d.networkInstance()] = d.Dnn
+	}
+
+	return t
+}
+
+func (t dnnTable) has(networkInstance string) bool {
+	_, ok := t[networkInstance]
+	return ok
+}
+
+// lookup returns the DNN of networkInstance, empty if no Network Instance was sent.
+func (t dnnTable) lookup(networkInstance string) (string, error) {
+	if t == nil || networkInstance == "" {
+		return networkInstance, nil
+	}
+
+	dnn, ok := t[networkInstance]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", errUnknownNetworkInstance, networkInstance)
+	}
+
+	return dnn, nil
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func (u *upf) isDraining() bool {
+	return atomic.LoadInt32(&u.draining) == 1
+}
+
+// setDraining sets the draining state, returning whether it changed.
+func (u *upf) setDraining(draining bool) bool {
+	var from, to int32 = 1, 0
+	if draining {
+		from, to = 0, 1
+	}
+
+	return atomic.CompareAndSwapInt32(&u.draining, from, to)
+}
+
+// drainStatus is the draining state reported to the orchestration, which waits for
+// the sessions to reach zero before terminating the instance.
+type drainStatus struct {
+	Draining bool `json:"draining"`
+	Sessions int  `json:"sessions"`
+}
+
+// drainHandler drains the instance ahead of a scale-down:
+//
+//	GET    /v1/drain  reports the draining state and remaining session count
+//	POST   /v1/drain  rejects new sessions and tells the load balancers to stop
+//	                  sending new ones, existing sessions are kept until released
+//	DELETE /v1/drain  accepts new sessions again and re-registers with the load balancers
+type drainHandler struct {
+	node *PFCPNode
+}
+
+func (h *drainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	upf := h.node.upf
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if upf.setDraining(true) {
+			log.Infoln("Draining,", h.node.sessionCount(), "sessions left")
+
+			go h.node.DrainFromlb(enterlb)
+			go h.node.DrainFromlb(exitlb)
+		}
+	case http.MethodDelete:
+		if upf.setDraining(false) {
+			log.Infoln("Draining cancelled, accepting new sessions")
+
+			go h.node.RegisterTolb(enterlb)
+			go h.node.RegisterTolb(exitlb)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	status := drainStatus{Draining: upf.isDraining(), Sessions: h.node.sessionCount()}
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Errorln("Failed to encode drain status:", err)
+	}
+}
+
+// DrainFromlb tells a load balancer to stop steering new sessions to this instance.
+// The load balancer may not support draining, so it is only retried a few times.
+func (node *PFCPNode) DrainFromlb(lb lbtype) {
+	var requestURL string
+
+	switch lb {
+	case enterlb:
+		requestURL = "http://enterlb:8080/drain"
+	case exitlb:
+		requestURL = "http://exitlb:8080/drain"
+	}
+
+	body, _ := json.Marshal(RegisterReq{
+		GwIP:        node.gwIP,
+		CoreMac:     node.coreMac,
+		AccessMac:   node.accessMac,
+		Hostname:    node.hostname,
+		MaxSessions: node.upf.sessionLimit.max,
+		Endpoints:   node.upf.gtpuEndpoints(),
+	})
+
+	client := http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	for retries := uint8(0); retries < node.upf.getPFCPTimers().maxReqRetries; retries++ {
+		req, err := http.NewRequest(http.MethodPost, requestURL, bytes.NewReader(body))
+		if err != nil {
+			log.Errorln("Failed to create drain request:", err)
+			return
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+
+			if resp.StatusCode < http.StatusMultipleChoices {
+				return
+			}
+
+			err = errFailed
+		}
+
+		log.Warnln("Failed to notify", requestURL, "of draining:", err)
+		time.Sleep(time.Second)
+	}
+}
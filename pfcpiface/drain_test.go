@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+func Test_drainHandler(t *testing.T) {
+	node := &PFCPNode{upf: &upf{}}
+	pConn := &PFCPConn{store: NewInMemoryStore(), upf: node.upf}
+	require.NoError(t, pConn.store.PutSession(PFCPSession{localSEID: 1}, nil, false, 0))
+	node.pConns.Store("198.18.0.2:8805", pConn)
+
+	handler := &drainHandler{node: node}
+
+	status := func(method string) drainStatus {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, "/v1/drain", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var s drainStatus
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&s))
+
+		return s
+	}
+
+	require.Equal(t, drainStatus{Sessions: 1}, status(http.MethodGet))
+	require.Equal(t, drainStatus{Draining: true, Sessions: 1}, status(http.MethodPost))
+	require.Equal(t, drainStatus{Draining: true, Sessions: 1}, status(http.MethodPost))
+
+	require.True(t, node.upf.setDraining(false))
+	require.False(t, node.upf.setDraining(false))
+	require.Equal(t, drainStatus{Sessions: 1}, status(http.MethodGet))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/v1/drain", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestPFCPConn_establishmentWhileDraining(t *testing.T) {
+	pConn := &PFCPConn{upf: &upf{draining: 1}, store: NewInMemoryStore()}
+	pConn.nodeID.localIE = ie.NewNodeID("198.18.0.1", "", "")
+	pConn.nodeID.remote = "198.18.0.2"
+
+	sereq := message.NewSessionEstablishmentRequest(0, 0, 0, 1, 0,
+		ie.NewNodeID("198.18.0.2", "", ""), ie.NewFSEID(3, net.ParseIP("198.18.0.2"), nil))
+
+	reply, err := pConn.handleSessionEstablishmentRequest(sereq)
+	require.ErrorIs(t, err, ErrDraining)
+
+	seres, ok := reply.(*message.SessionEstablishmentResponse)
+	require.True(t, ok)
+	require.Equal(t, uint64(3), seres.SEID())
+
+	cause, err := seres.Cause.Cause()
+	require.NoError(t, err)
+	require.Equal(t, ie.CauseNoResourcesAvailable, cause)
+	require.Empty(t, pConn.store.GetAllSessions())
+}
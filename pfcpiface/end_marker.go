@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sendEndMarkers writes the end markers of a path switch to the datapath
+// endMarkerCount times, endMarkerInterval apart, so that the target gNB still
+// gets one if some are lost. The first round is sent before returning.
+func (pConn *PFCPConn) sendEndMarkers(endMarkerList [][]byte) {
+	if len(endMarkerList) == 0 {
+		return
+	}
+
+	upf := pConn.upf
+
+	if !pConn.sendEndMarkerRound(endMarkerList) || upf.endMarkerCount <= 1 {
+		return
+	}
+
+	repeat := func() {
+		for i := uint8(1); i < upf.endMarkerCount; i++ {
+			time.Sleep(upf.endMarkerInterval)
+
+			if !pConn.sendEndMarkerRound(endMarkerList) {
+				return
+			}
+		}
+	}
+
+	if upf.endMarkerInterval == 0 {
+		repeat()
+		return
+	}
+
+	go repeat()
+}
+
+func (pConn *PFCPConn) sendEndMarkerRound(endMarkerList [][]byte) bool {
+	if err := pConn.upf.SendEndMarkers(&endMarkerList); err != nil {
+		log.Errorln("Sending End Markers Failed : ", err)
+		return false
+	}
+
+	pConn.SaveEndMarkers(pConn.nodeID.remote, len(endMarkerList))
+
+	return true
+}
@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/omec-project/upf-epc/pfcpiface/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+type endMarkerDatapath struct {
+	datapath
+	rounds int
+	err    error
+}
+
+func (d *endMarkerDatapath) SendEndMarkers(endMarkerList *[][]byte) error {
+	d.rounds++
+	return d.err
+}
+
+type endMarkerMetrics struct {
+	metrics.InstrumentPFCP
+	sent int
+}
+
+func (m *endMarkerMetrics) SaveEndMarkers(nodeID string, count int) {
+	m.sent += count
+}
+
+func TestPFCPConn_sendEndMarkers(t *testing.T) {
+	endMarkers := [][]byte{{0x01}, {0x02}}
+
+	t.Run("repeated back to back", func(t *testing.T) {
+		dp := &endMarkerDatapath{}
+		m := &endMarkerMetrics{}
+		pConn := &PFCPConn{upf: &upf{datapath: dp, endMarkerCount: 3}, InstrumentPFCP: m}
+
+		pConn.sendEndMarkers(endMarkers)
+		require.Equal(t, 3, dp.rounds)
+		require.Equal(t, 6, m.sent)
+	})
+
+	t.Run("failure stops repetitions", func(t *testing.T) {
+		dp := &endMarkerDatapath{err: errors.New("datapath down")}
+		m := &endMarkerMetrics{}
+		pConn := &PFCPConn{upf: &upf{datapath: dp, endMarkerCount: 3}, InstrumentPFCP: m}
+
+		pConn.sendEndMarkers(endMarkers)
+		require.Equal(t, 1, dp.rounds)
+		require.Zero(t, m.sent)
+	})
+
+	t.Run("nothing to send", func(t *testing.T) {
+		dp := &endMarkerDatapath{}
+		pConn := &PFCPConn{upf: &upf{datapath: dp, endMarkerCount: 3}}
+
+		pConn.sendEndMarkers(nil)
+		require.Zero(t, dp.rounds)
+	})
+}
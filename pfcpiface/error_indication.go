@@ -0,0 +1,196 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+// GTP-U Error Indication message and IEs (3GPP TS 29.281).
+const (
+	gtpuMessageTypeErrorIndication = 26
+	gtpuIETypeTEIDDataI            = 16
+	gtpuIETypePeerAddress          = 133
+
+	gtpuFlagE  = 0x04
+	gtpuFlagS  = 0x02
+	gtpuFlagPN = 0x01
+)
+
+// fteidFlagV4 is the V4 flag of the F-TEID IE (3GPP TS 29.244, clause 8.2.3).
+const fteidFlagV4 = 0x01
+
+// gtpuErrorIndication is sent by a GTP-U peer receiving a G-PDU for a tunnel it does
+// not know. teid and peer identify the tunnel as the UPF tunnels traffic to it.
+type gtpuErrorIndication struct {
+	teid uint32
+	peer net.IP
+}
+
+func (e gtpuErrorIndication) String() string {
+	return fmt.Sprintf("GTP-U Error Indication from %v for TEID %#x", e.peer, e.teid)
+}
+
+// parseErrorIndication parses the GTP-U Error Indication message in b.
+func parseErrorIndication(b []byte) (gtpuErrorIndication, error) {
+	var ind gtpuErrorIndication
+
+	if len(b) < gtpuHeaderLen || b[0]>>5 != 1 {
+		return ind, ErrInvalidArgumentWithReason("GTP-U message", len(b), "malformed header")
+	}
+
+	if b[1] != gtpuMessageTypeErrorIndication {
+		return ind, ErrUnsupported("GTP-U message type", b[1])
+	}
+
+	end := gtpuHeaderLen + int(binary.BigEndian.Uint16(b[2:4]))
+	if end > len(b) {
+		return ind, ErrInvalidArgumentWithReason("GTP-U message length", end, "exceeds packet")
+	}
+
+	off := gtpuHeaderLen
+
+	if b[0]&(gtpuFlagE|gtpuFlagS|gtpuFlagPN) != 0 {
+		off += 4
+		if off > end {
+			return ind, ErrInvalidArgumentWithReason("GTP-U message", len(b), "truncated optional fields")
+		}
+
+		// Skip the extension headers, e.g. the UDP Port of the Error Indication.
+		next := b[off-1]
+		for b[0]&gtpuFlagE != 0 && next != 0 {
+			if off >= end || b[off] == 0 || off+int(b[off])*4 > end {
+				return ind, ErrInvalidArgumentWithReason("GTP-U message", len(b), "truncated extension header")
+			}
+
+			extLen := int(b[off]) * 4
+			next = b[off+extLen-1]
+			off += extLen
+		}
+	}
+
+	var foundTEID bool
+
+	for off < end {
+		t := b[off]
+
+		switch {
+		case t == gtpuIETypeTEIDDataI:
+			if off+5 > end {
+				return ind, ErrInvalidArgumentWithReason("TEID Data I", end-off, "truncated IE")
+			}
+
+			ind.teid = binary.BigEndian.Uint32(b[off+1 : off+5])
+			foundTEID = true
+			off += 5
+		case t == gtpuIETypeRecovery:
+			off += 2
+		case t >= 128:
+			if off+3 > end {
+				return ind, ErrInvalidArgumentWithReason("GTP-U IE", t, "truncated IE")
+			}
+
+			l := int(binary.BigEndian.Uint16(b[off+1 : off+3]))
+			if off+3+l > end {
+				return ind, ErrInvalidArgumentWithReason("GTP-U IE", t, "truncated IE")
+			}
+
+			if t == gtpuIETypePeerAddress {
+				ind.peer = append(net.IP{}, b[off+3:off+3+l]...)
+			}
+
+			off += 3 + l
+		default:
+			return ind, ErrUnsupported("GTP-U IE", t)
+		}
+	}
+
+	if !foundTEID {
+		return ind, ErrNotFound("TEID Data I")
+	}
+
+	if ind.peer == nil {
+		return ind, ErrNotFound("GTP-U Peer Address")
+	}
+
+	return ind, nil
+}
+
+// parseErrorIndicationFrame parses the GTP-U Error Indication carried in an Ethernet frame.
+func parseErrorIndicationFrame(frame []byte) (gtpuErrorIndication, error) {
+	pkt := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.NoCopy)
+
+	udp, ok := pkt.Layer(layers.LayerTypeUDP).(*layers.UDP)
+	if !ok {
+		return gtpuErrorIndication{}, ErrInvalidArgumentWithReason("error indication frame", len(frame), "not a UDP packet")
+	}
+
+	return parseErrorIndication(udp.Payload)
+}
+
+// handleGTPUErrorIndication reports the Error Indication to the CP node owning the tunnel.
+func (node *PFCPNode) handleGTPUErrorIndication(ind gtpuErrorIndication) {
+	peer := ind.peer.To4()
+	if peer == nil {
+		log.Warnln("Ignoring", ind, ": IPv6 tunnels are not supported")
+		return
+	}
+
+	found := false
+
+	node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+
+		fseid, ok := pConn.teids.lookup(ip2int(peer), ind.teid)
+		if !ok {
+			return true
+		}
+
+		session, ok := pConn.store.GetSession(fseid)
+		if !ok {
+			return true
+		}
+
+		found = true
+
+		pConn.sendErrorIndicationReport(session, ind)
+
+		return false
+	})
+
+	if !found {
+		log.Warnln("No session found for", ind)
+	}
+}
+
+// sendErrorIndicationReport sends a Session Report Request carrying the remote
+// F-TEID named by the Error Indication, so that the CP can re-establish the tunnel.
+func (pConn *PFCPConn) sendErrorIndicationReport(session PFCPSession, ind gtpuErrorIndication) {
+	srreq := message.NewSessionReportRequest(0, /* MO?? <-- what's this */
+		0,                            /* FO <-- what's this? */
+		session.remoteSEID,           /* seid */
+		pConn.getSeqNum(),            /* seq # */
+		0,                            /* priority */
+		ie.NewReportType(0, 1, 0, 0), /*upir, erir, usar, dldr int*/
+	)
+	srreq.ErrorIndicationReport = ie.NewErrorIndicationReport(
+		ie.NewFTEID(fteidFlagV4, ind.teid, ind.peer.To4(), nil, 0),
+	)
+
+	log.WithFields(log.Fields{
+		"F-SEID": session.localSEID,
+		"peer":   ind.peer,
+		"TEID":   ind.teid,
+	}).Info("Sending Error Indication Report")
+
+	pConn.SendPFCPMsg(srreq)
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newErrorIndication(flags uint8, ext []byte, ies ...byte) []byte {
+	b := []byte{flags, gtpuMessageTypeErrorIndication, 0, 0, 0, 0, 0, 0}
+	if flags&(gtpuFlagE|gtpuFlagS|gtpuFlagPN) != 0 {
+		next := byte(0)
+		if len(ext) > 0 {
+			next = 0x40
+		}
+
+		b = append(b, 0, 1, 0, next)
+	}
+
+	b = append(b, ext...)
+	b = append(b, ies...)
+	b[3] = byte(len(b) - gtpuHeaderLen)
+
+	return b
+}
+
+func Test_parseErrorIndication(t *testing.T) {
+	ies := []byte{
+		gtpuIETypeTEIDDataI, 0x00, 0x00, 0x00, 0x2a,
+		gtpuIETypePeerAddress, 0x00, 0x04, 198, 18, 0, 1,
+	}
+
+	t.Run("with sequence number", func(t *testing.T) {
+		ind, err := parseErrorIndication(newErrorIndication(gtpuFlagsWithSeq, nil, ies...))
+		require.NoError(t, err)
+		require.Equal(t, uint32(42), ind.teid)
+		require.True(t, ind.peer.Equal(net.ParseIP("198.18.0.1")))
+	})
+
+	t.Run("with UDP Port extension header", func(t *testing.T) {
+		ext := []byte{0x01, 0x08, 0x68, 0x00}
+		ind, err := parseErrorIndication(newErrorIndication(gtpuFlagsWithSeq|gtpuFlagE, ext, ies...))
+		require.NoError(t, err)
+		require.Equal(t, uint32(42), ind.teid)
+	})
+
+	t.Run("missing TEID Data I", func(t *testing.T) {
+		_, err := parseErrorIndication(newErrorIndication(gtpuFlagsWithSeq, nil, ies[5:]...))
+		require.Error(t, err)
+	})
+
+	t.Run("truncated IE", func(t *testing.T) {
+		_, err := parseErrorIndication(newErrorIndication(gtpuFlagsWithSeq, nil, ies[:9]...))
+		require.Error(t, err)
+	})
+
+	t.Run("echo request", func(t *testing.T) {
+		_, err := parseErrorIndication(newEchoMessage(gtpuMessageTypeEchoRequest, 1))
+		require.Error(t, err)
+	})
+}
+
+func Test_teidIndex(t *testing.T) {
+	peer := ip2int(net.ParseIP("198.18.0.1"))
+	session := PFCPSession{localSEID: 1}
+	session.fars = []far{
+		{farID: 1, applyAction: ActionForward, tunnelIP4Dst: peer, tunnelTEID: 42},
+		{farID: 2, applyAction: ActionDrop, tunnelIP4Dst: peer, tunnelTEID: 43},
+	}
+
+	idx := newTEIDIndex()
+	idx.update(session)
+
+	fseid, ok := idx.lookup(peer, 42)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), fseid)
+
+	_, ok = idx.lookup(peer, 43)
+	require.False(t, ok)
+
+	// The tunnel moved to another TEID.
+	session.fars[0].tunnelTEID = 44
+	idx.update(session)
+
+	_, ok = idx.lookup(peer, 42)
+	require.False(t, ok)
+
+	_, ok = idx.lookup(peer, 44)
+	require.True(t, ok)
+
+	idx.remove(1)
+
+	_, ok = idx.lookup(peer, 44)
+	require.False(t, ok)
+}
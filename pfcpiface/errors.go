@@ -13,12 +13,17 @@ var (
 	errInvalidOperation = errors.New("invalid operation")
 	errFailed           = errors.New("failed")
 	errUnsupported      = errors.New("unsupported")
+	errExhausted        = errors.New("exhausted")
 )
 
 func ErrUnsupported(what string, value interface{}) error {
 	return fmt.Errorf("%s=%v %w", what, value, errUnsupported)
 }
 
+func ErrExhausted(what string) error {
+	return fmt.Errorf("%s %w", what, errExhausted)
+}
+
 func ErrNotFound(what string) error {
 	return fmt.Errorf("%s %w", what, errNotFound)
 }
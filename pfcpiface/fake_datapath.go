@@ -0,0 +1,348 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// fakeDatapathMaxOps bounds the operations recorded by the fake datapath, the oldest
+// ones are dropped first.
+const fakeDatapathMaxOps = 10000
+
+// fakeDatapathOp is an operation recorded by the fake datapath.
+type fakeDatapathOp struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	PDRs   []string  `json:"pdrs,omitempty"`
+	FARs   []string  `json:"fars,omitempty"`
+	QERs   []string  `json:"qers,omitempty"`
+	Info   string    `json:"info,omitempty"`
+}
+
+// fakeDatapathState is the view of the fake datapath served by its debug endpoint.
+type fakeDatapathState struct {
+	Operations []fakeDatapathOp `json:"operations"`
+	PDRs       []string         `json:"pdrs"`
+	FARs       []string         `json:"fars"`
+	QERs       []string         `json:"qers"`
+}
+
+type fakeRuleKey struct {
+	fseID uint64
+	id    uint32
+}
+
+// fakeDatapath records the operations of the PFCP agent in memory instead of
+// programming a forwarding plane, for unit tests and demos. The recorded operations
+// and the installed rules are served by /v1/debug/datapath.
+type fakeDatapath struct {
+	mu   sync.Mutex
+	ops  []fakeDatapathOp
+	pdrs map[fakeRuleKey]pdr
+	fars map[fakeRuleKey]far
+	qers map[fakeRuleKey]qer
+}
+
+func (f *fakeDatapath) record(op fakeDatapathOp) {
+	op.Time = time.Now()
+
+	if len(f.ops) >= fakeDatapathMaxOps {
+		f.ops = f.ops[1:]
+	}
+
+	f.ops = append(f.ops, op)
+}
+
+func (f *fakeDatapath) IsConnected(accessIP *net.IP) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.pdrs != nil
+}
+
+func (f *fakeDatapath) SetUpfInfo(u *upf, conf *Conf) error {
+	log.Println("SetUpfInfo fake")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.pdrs = make(map[fakeRuleKey]pdr)
+	f.fars = make(map[fakeRuleKey]far)
+	f.qers = make(map[fakeRuleKey]qer)
+
+	f.record(fakeDatapathOp{Method: "SetUpfInfo", Info: fmt.Sprintf("accessIP=%v, coreIP=%v", u.AccessIP, u.CoreIP)})
+
+	return nil
+}
+
+func (f *fakeDatapath) Exit() {
+	log.Println("Exit function fake")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.record(fakeDatapathOp{Method: "Exit"})
+}
+
+func (f *fakeDatapath) AddSliceInfo(sliceInfo *SliceInfo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.record(fakeDatapathOp{Method: "AddSliceInfo", Info: fmt.Sprintf("%+v", *sliceInfo)})
+
+	return nil
+}
+
+func (f *fakeDatapath) RemoveSliceInfo(sliceInfo *SliceInfo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.record(fakeDatapathOp{Method: "RemoveSliceInfo", Info: sliceInfo.name})
+
+	return nil
+}
+
+func (f *fakeDatapath) SendEndMarkers(endMarkerList *[][]byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.record(fakeDatapathOp{Method: "SendEndMarkers", Info: fmt.Sprintf("%d end markers", len(*endMarkerList))})
+
+	return nil
+}
+
+func (f *fakeDatapath) SendMsgToUPF(
+	method upfMsgType, rules PacketForwardingRules, updated PacketForwardingRules) uint8 {
+	if method == upfMsgTypeMod {
+		rules = updated
+	}
+
+	if err := f.apply(method, method.String(), rules); err != nil {
+		log.Errorln(err)
+		return ie.CauseRequestRejected
+	}
+
+	return ie.CauseRequestAccepted
+}
+
+// WriteSessionBatch records the updated rules as a single batch operation.
+func (f *fakeDatapath) WriteSessionBatch(method upfMsgType, all PacketForwardingRules, updated PacketForwardingRules) error {
+	if method != upfMsgTypeAdd && method != upfMsgTypeMod {
+		return ErrUnsupported("batched method", method)
+	}
+
+	return f.apply(method, "batch "+method.String(), updated)
+}
+
+// UpdateQERRates records the QER as updated in place.
+func (f *fakeDatapath) UpdateQERRates(q qer, all PacketForwardingRules) error {
+	return f.apply(upfMsgTypeMod, "update QER rates", PacketForwardingRules{qers: []qer{q}})
+}
+
+// UpdateFARTunnel records the FAR as updated in place.
+func (f *fakeDatapath) UpdateFARTunnel(fa far, all PacketForwardingRules) error {
+	return f.apply(upfMsgTypeMod, "update FAR tunnel", PacketForwardingRules{fars: []far{fa}})
+}
+
+func (f *fakeDatapath) apply(method upfMsgType, name string, rules PacketForwardingRules) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.pdrs == nil {
+		return ErrOperationFailedWithReason(name, "fake datapath not set up")
+	}
+
+	op := fakeDatapathOp{Method: name}
+
+	for _, p := range rules.pdrs {
+		op.PDRs = append(op.PDRs, p.String())
+
+		if method == upfMsgTypeDel {
+			delete(f.pdrs, fakeRuleKey{p.fseID, p.pdrID})
+		} else {
+			f.pdrs[fakeRuleKey{p.fseID, p.pdrID}] = p
+		}
+	}
+
+	for _, fa := range rules.fars {
+		op.FARs = append(op.FARs, fa.String())
+
+		if method == upfMsgTypeDel {
+			delete(f.fars, fakeRuleKey{fa.fseID, fa.farID})
+		} else {
+			f.fars[fakeRuleKey{fa.fseID, fa.farID}] = fa
+		}
+	}
+
+	for _, q := range rules.qers {
+		op.QERs = append(op.QERs, q.String())
+
+		if method == upfMsgTypeDel {
+			delete(f.qers, fakeRuleKey{q.fseID, q.qerID})
+		} else {
+			f.qers[fakeRuleKey{q.fseID, q.qerID}] = q
+		}
+	}
+
+	f.record(op)
+
+	return nil
+}
+
+// ReadPDRCounters reports no traffic, as the fake datapath forwards none.
+func (f *fakeDatapath) ReadPDRCounters(pdrs []pdr) (map[pdrCounterKey]pdrCounters, error) {
+	counters := make(map[pdrCounterKey]pdrCounters, len(pdrs))
+
+	for _, p := range pdrs {
+		counters[pdrCounterKey{fseID: p.fseID, pdrID: p.pdrID}] = pdrCounters{}
+	}
+
+	return counters, nil
+}
+
+// ReadSliceMeterCounters reports no traffic, as the fake datapath forwards none.
+func (f *fakeDatapath) ReadSliceMeterCounters(sliceInfo *SliceInfo) (map[string]sliceMeterCounters, error) {
+	return map[string]sliceMeterCounters{
+		sliceDirectionUplink:   {},
+		sliceDirectionDownlink: {},
+	}, nil
+}
+
+func (f *fakeDatapath) ReadInstalledPDRs(expected []pdr) (map[pdrCounterKey]struct{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	installed := make(map[pdrCounterKey]struct{}, len(f.pdrs))
+	for k := range f.pdrs {
+		installed[pdrCounterKey{fseID: k.fseID, pdrID: k.id}] = struct{}{}
+	}
+
+	return installed, nil
+}
+
+func (f *fakeDatapath) DeleteInstalledPDRs(keys []pdrCounterKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	op := fakeDatapathOp{Method: "DeleteInstalledPDRs"}
+
+	for _, k := range keys {
+		if p, ok := f.pdrs[fakeRuleKey{k.fseID, k.pdrID}]; ok {
+			op.PDRs = append(op.PDRs, p.String())
+			delete(f.pdrs, fakeRuleKey{k.fseID, k.pdrID})
+		}
+	}
+
+	f.record(op)
+
+	return nil
+}
+
+func (f *fakeDatapath) SummaryLatencyJitter(uc *upfCollector, ch chan<- prometheus.Metric) {
+}
+
+func (f *fakeDatapath) PortStats(uc *upfCollector, ch chan<- prometheus.Metric) {
+}
+
+func (f *fakeDatapath) SessionStats(*PfcpNodeCollector, chan<- prometheus.Metric) error {
+	return nil
+}
+
+// state returns the recorded operations and the installed rules, sorted by F-SEID and ID.
+func (f *fakeDatapath) state() fakeDatapathState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := fakeDatapathState{
+		Operations: append([]fakeDatapathOp{}, f.ops...),
+		PDRs:       make([]string, 0, len(f.pdrs)),
+		FARs:       make([]string, 0, len(f.fars)),
+		QERs:       make([]string, 0, len(f.qers)),
+	}
+
+	for _, k := range sortedFakeRuleKeys(f.pdrs) {
+		s.PDRs = append(s.PDRs, f.pdrs[k].String())
+	}
+
+	for _, k := range sortedFakeRuleKeys(f.fars) {
+		s.FARs = append(s.FARs, f.fars[k].String())
+	}
+
+	for _, k := range sortedFakeRuleKeys(f.qers) {
+		s.QERs = append(s.QERs, f.qers[k].String())
+	}
+
+	return s
+}
+
+func (f *fakeDatapath) clearOps() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.ops = nil
+}
+
+func sortedFakeRuleKeys(m interface{}) []fakeRuleKey {
+	var keys []fakeRuleKey
+
+	switch rules := m.(type) {
+	case map[fakeRuleKey]pdr:
+		for k := range rules {
+			keys = append(keys, k)
+		}
+	case map[fakeRuleKey]far:
+		for k := range rules {
+			keys = append(keys, k)
+		}
+	case map[fakeRuleKey]qer:
+		for k := range rules {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].fseID != keys[j].fseID {
+			return keys[i].fseID < keys[j].fseID
+		}
+
+		return keys[i].id < keys[j].id
+	})
+
+	return keys
+}
+
+type fakeDatapathHandler struct {
+	fake *fakeDatapath
+}
+
+func setupFakeDatapathHandler(mux *http.ServeMux, fake *fakeDatapath) {
+	mux.Handle("/v1/debug/datapath", &fakeDatapathHandler{fake: fake})
+}
+
+func (h *fakeDatapathHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(h.fake.state()); err != nil {
+			log.Errorln("Failed to encode fake datapath state:", err)
+		}
+	case http.MethodDelete:
+		h.fake.clearOps()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func Test_fakeDatapath(t *testing.T) {
+	f := &fakeDatapath{}
+
+	p := pdr{srcIface: access, fseID: 1, pdrID: 1, farID: 1}
+	fa := far{fseID: 1, farID: 1, applyAction: ActionForward}
+	q := qer{fseID: 1, qerID: 1}
+
+	require.Equal(t, uint8(ie.CauseRequestRejected), f.SendMsgToUPF(upfMsgTypeAdd, PacketForwardingRules{pdrs: []pdr{p}}, PacketForwardingRules{}))
+
+	f.SetUpfInfo(&upf{}, &Conf{})
+	require.True(t, f.IsConnected(nil))
+
+	rules := PacketForwardingRules{pdrs: []pdr{p}, fars: []far{fa}, qers: []qer{q}}
+	require.Equal(t, uint8(ie.CauseRequestAccepted), f.SendMsgToUPF(upfMsgTypeAdd, rules, rules))
+
+	fa.applyAction = ActionDrop
+	updated := PacketForwardingRules{fars: []far{fa}}
+	require.Equal(t, uint8(ie.CauseRequestAccepted), f.SendMsgToUPF(upfMsgTypeMod, rules, updated))
+
+	s := f.state()
+	require.Len(t, s.Operations, 3)
+	require.Equal(t, "modify", s.Operations[2].Method)
+	require.Equal(t, []string{fa.String()}, s.FARs)
+	require.Len(t, s.PDRs, 1)
+	require.Len(t, s.QERs, 1)
+
+	rules.fars = []far{fa}
+	require.Equal(t, uint8(ie.CauseRequestAccepted), f.SendMsgToUPF(upfMsgTypeDel, rules, PacketForwardingRules{}))
+
+	s = f.state()
+	require.Empty(t, s.PDRs)
+	require.Empty(t, s.FARs)
+	require.Empty(t, s.QERs)
+
+	t.Run("rules written in a batch", func(t *testing.T) {
+		u := &upf{datapath: f}
+		require.Equal(t, uint8(ie.CauseRequestAccepted), u.sendSessionRules(upfMsgTypeAdd, rules, rules))
+
+		s := f.state()
+		require.Equal(t, "batch add", s.Operations[len(s.Operations)-1].Method)
+		require.Len(t, s.PDRs, 1)
+
+		require.Equal(t, uint8(ie.CauseRequestAccepted), f.SendMsgToUPF(upfMsgTypeDel, rules, PacketForwardingRules{}))
+	})
+
+	t.Run("debug endpoint", func(t *testing.T) {
+		mux := http.NewServeMux()
+		setupFakeDatapathHandler(mux, f)
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/debug/datapath", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var state fakeDatapathState
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &state))
+		require.Len(t, state.Operations, 6)
+		require.Equal(t, "delete", state.Operations[5].Method)
+
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/v1/debug/datapath", nil))
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		require.Empty(t, f.state().Operations)
+	})
+}
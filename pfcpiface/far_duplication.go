@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// Modes of the mirroring of the FARs with Duplicating Parameters.
+const (
+	duplicationModeGTPU = "gtpu"
+	duplicationModeRaw  = "raw"
+)
+
+var errDuplicationDisabled = errors.New("FAR duplication is not enabled")
+
+// duplicator mirrors the traffic of the FARs with Duplicating Parameters to a
+// mediation or monitoring endpoint.
+type duplicator struct {
+	raw bool
+	// endpoint is the destination of the GTP-U tunnels of the copies.
+	endpoint net.IP
+}
+
+func newDuplicator(conf FARDuplicationInfo) *duplicator {
+	return &duplicator{
+		raw:      conf.Mode == duplicationModeRaw,
+		endpoint: net.ParseIP(conf.Endpoint).To4(),
+	}
+}
+
+// farDuplication is the GTP-U tunnel of the copies of the traffic of a FAR, unused in
+// raw mode.
+type farDuplication struct {
+	tunnelIP4Src uint32
+	tunnelIP4Dst uint32
+	tunnelTEID   uint32
+}
+
+// parseDuplicatingParameters parses the Duplicating Parameters of a FAR with the DUPL
+// action. The copies are tunneled from the core interface, where the mediation
+// endpoint is reached, with the TEID of the Outer Header Creation. A FAR updated
+// without Update Duplicating Parameters keeps its tunnel.
+func (f *far) parseDuplicatingParameters(farIE *ie.IE, upf *upf, op operation) error {
+	if !f.Duplicates() {
+		return nil
+	}
+
+	if upf.duplication == nil {
+		return fmt.Errorf("%w: FAR %v has the DUPL action", errDuplicationDisabled, f.farID)
+	}
+
+	var (
+		dupIEs []*ie.IE
+		err    error
+	)
+
+	if op == create {
+		dupIEs, err = farIE.DuplicatingParameters()
+	} else {
+		dupIEs, err = farIE.UpdateDuplicatingParameters()
+	}
+
+	switch {
+	case errors.Is(err, ie.ErrIENotFound) && op == update:
+		return nil
+	case errors.Is(err, ie.ErrIENotFound):
+		dupIEs = nil
+	case err != nil:
+		return err
+	}
+
+	if upf.duplication.raw {
+		return nil
+	}
+
+	for _, dupIE := range dupIEs {
+		if dupIE.Type != ie.OuterHeaderCreation || !dupIE.HasTEID() {
+			continue
+		}
+
+		ohc, err := dupIE.OuterHeaderCreation()
+		if err != nil {
+			return err
+		}
+
+		f.dup = farDuplication{
+			tunnelIP4Src: ip2int(upf.CoreIP),
+			tunnelIP4Dst: ip2int(upf.duplication.endpoint),
+			tunnelTEID:   ohc.TEID,
+		}
+
+		return nil
+	}
+
+	return ErrInvalidArgumentWithReason("Duplicating Parameters", f.farID, "no GTP-U Outer Header Creation")
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+var errRedirectDisabled = errors.New("FAR redirection is not enabled")
+
+// redirector redirects the uplink traffic of the FARs with Redirect Information, e.g.
+// of the subscribers out of quota, to a captive portal.
+type redirector struct {
+	// gateway is the destination of the redirections to an IPv6 address, URL or SIP
+	// URI, nil if they are not supported.
+	gateway net.IP
+}
+
+func newRedirector(conf FARRedirectInfo) *redirector {
+	return &redirector{
+		gateway: net.ParseIP(conf.Gateway).To4(),
+	}
+}
+
+// farRedirect is the redirection of the uplink traffic of a FAR, GTP-U tunneled with
+// the FAR ID as TEID to the redirect server, which answers the flows it receives.
+type farRedirect struct {
+	addrType uint8
+	// address is the Redirect Server Address of the Redirect Information.
+	address      string
+	tunnelIP4Src uint32
+	tunnelIP4Dst uint32
+}
+
+// Redirects reports whether the uplink traffic of the FAR is redirected.
+func (f *far) Redirects() bool {
+	return f.redirect.tunnelIP4Dst != 0
+}
+
+// parseRedirectInformation parses the Redirect Information of the Forwarding
+// Parameters of a FAR. Traffic redirected to an IPv4 address is tunneled to it, that
+// redirected to an IPv6 address, URL or SIP URI to the redirect gateway.
+func (f *far) parseRedirectInformation(fwdIE *ie.IE, upf *upf) error {
+	if upf.redirection == nil {
+		return fmt.Errorf("%w: FAR %v has Redirect Information", errRedirectDisabled, f.farID)
+	}
+
+	info, err := fwdIE.RedirectInformation()
+	if err != nil {
+		return err
+	}
+
+	server := upf.redirection.gateway
+
+	switch info.RedirectAddressType {
+	case ie.RedirectAddrIPv4, ie.RedirectAddrIPv4AndIPv6:
+		server = net.ParseIP(info.RedirectServerAddress).To4()
+		if server == nil {
+			return ErrInvalidArgumentWithReason("Redirect Server Address", info.RedirectServerAddress, "not an IPv4 address")
+		}
+	case ie.RedirectAddrIPv6, ie.RedirectAddrURL, ie.RedirectAddrSIPURI:
+		if server == nil {
+			return fmt.Errorf("%w: FAR %v redirects to %v without a redirect gateway", errRedirectDisabled,
+				f.farID, info.RedirectServerAddress)
+		}
+	default:
+		return ErrUnsupported("Redirect Address Type", info.RedirectAddressType)
+	}
+
+	f.redirect = farRedirect{
+		addrType:     info.RedirectAddressType,
+		address:      info.RedirectServerAddress,
+		tunnelIP4Src: ip2int(upf.CoreIP),
+		tunnelIP4Dst: ip2int(server),
+	}
+
+	return nil
+}
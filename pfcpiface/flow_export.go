@@ -0,0 +1,328 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	flowExportIntervalDefault = 10 * time.Second
+
+	ipfixVersion       = 10
+	ipfixHeaderLen     = 16
+	ipfixSetHeaderLen  = 4
+	ipfixTemplateSetID = 2
+	// Templates of the records, the UE IP being the source of uplink flows and the
+	// destination of downlink ones.
+	ipfixTemplateUplink   = 256
+	ipfixTemplateDownlink = 257
+	// ipfixMaxMessageLen keeps the messages within the MTU of the path to the collector.
+	ipfixMaxMessageLen = 1400
+	ipfixEnterpriseBit = 0x8000
+)
+
+// IANA Information Elements of the records.
+const (
+	ipfixOctetDeltaCount        = 1
+	ipfixPacketDeltaCount       = 2
+	ipfixSourceIPv4Address      = 8
+	ipfixDestinationIPv4Address = 12
+	ipfixFlowDirection          = 61
+	ipfixFlowEndMilliseconds    = 153
+	// ipfixQFI is the enterprise-specific element of the QFI.
+	ipfixQFI = 1
+)
+
+// Values of flowDirection, from the point of view of the access side.
+const (
+	ipfixDirectionIngress = 0
+	ipfixDirectionEgress  = 1
+)
+
+// ipfixField is a field of a template, the enterprise-specific ones being encoded
+// with the Private Enterprise Number.
+type ipfixField struct {
+	id         uint16
+	length     uint16
+	enterprise bool
+}
+
+var ipfixFields = []ipfixField{
+	{id: 0, length: 4}, // UE IP, set per template.
+	{id: ipfixOctetDeltaCount, length: 8},
+	{id: ipfixPacketDeltaCount, length: 8},
+	{id: ipfixFlowDirection, length: 1},
+	{id: ipfixFlowEndMilliseconds, length: 8},
+	{id: ipfixQFI, length: 1, enterprise: true},
+}
+
+const ipfixRecordLen = 4 + 8 + 8 + 1 + 8 + 1
+
+// flowRecord is the traffic of a PDR since the previous sample.
+type flowRecord struct {
+	ueIP    uint32
+	qfi     uint8
+	uplink  bool
+	bytes   uint64
+	packets uint64
+}
+
+// flowExporter periodically samples the counters of the PDRs of all sessions and
+// exports the traffic of each since the previous sample to an IPFIX collector, over
+// UDP.
+type flowExporter struct {
+	interval   time.Duration
+	domainID   uint32
+	enterprise uint32
+	conn       net.Conn
+
+	// last are the counters of the PDRs at the previous sample.
+	last map[pdrCounterKey]pdrCounters
+	// seq counts the data records exported, the sequence number of the messages.
+	seq uint32
+}
+
+func newFlowExporter(conf FlowExportInfo) (*flowExporter, error) {
+	conn, err := net.Dial("udp", conf.Collector)
+	if err != nil {
+		return nil, ErrOperationFailedWithReason("flow export collector", err.Error())
+	}
+
+	return &flowExporter{
+		interval:   validDuration(conf.Interval),
+		domainID:   conf.ObservationDomainID,
+		enterprise: conf.EnterpriseNumber,
+		conn:       conn,
+		last:       make(map[pdrCounterKey]pdrCounters),
+	}, nil
+}
+
+// close closes the connection of an exporter that is not run. Nothing is closed for
+// a nil exporter.
+func (f *flowExporter) close() {
+	if f == nil {
+		return
+	}
+
+	f.conn.Close()
+}
+
+// run exports the flows of sessions every interval, reading the counters of their
+// PDRs with read, until ctx is done.
+func (f *flowExporter) run(ctx context.Context, sessions func() []PFCPSession,
+	read func([]pdr) (map[pdrCounterKey]pdrCounters, error)) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	defer f.conn.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			all := sessions()
+
+			var pdrs []pdr
+			for _, s := range all {
+				pdrs = append(pdrs, s.pdrs...)
+			}
+
+			if len(pdrs) == 0 {
+				continue
+			}
+
+			counters, err := read(pdrs)
+			if err != nil {
+				log.Debugln("Reading flow counters from datapath failed:", err)
+				continue
+			}
+
+			f.export(f.flows(all, counters), now)
+		}
+	}
+}
+
+// flows returns the traffic of the PDRs of sessions since the previous sample, and
+// records counters for the next one.
+func (f *flowExporter) flows(sessions []PFCPSession, counters map[pdrCounterKey]pdrCounters) []flowRecord {
+	var records []flowRecord
+
+	last := make(map[pdrCounterKey]pdrCounters, len(counters))
+
+	for _, s := range sessions {
+		for _, p := range s.pdrs {
+			key := pdrCounterKey{fseID: p.fseID, pdrID: p.pdrID}
+
+			c, ok := counters[key]
+			if !ok || p.ueAddress == 0 {
+				continue
+			}
+
+			last[key] = c
+
+			// Counters restart from zero if the PDR was installed again.
+			delta := c
+			if prev, ok := f.last[key]; ok && c.bytes >= prev.bytes && c.packets >= prev.packets {
+				delta = pdrCounters{bytes: c.bytes - prev.bytes, packets: c.packets - prev.packets}
+			}
+
+			if delta.packets == 0 && delta.bytes == 0 {
+				continue
+			}
+
+			records = append(records, flowRecord{
+				ueIP:    p.ueAddress,
+				qfi:     pdrQFI(s, p),
+				uplink:  p.srcIface == access,
+				bytes:   delta.bytes,
+				packets: delta.packets,
+			})
+		}
+	}
+
+	f.last = last
+
+	return records
+}
+
+// pdrQFI returns the QFI of the traffic of p: the one it matches, or else the one
+// set by its QERs.
+func pdrQFI(s PFCPSession, p pdr) uint8 {
+	if p.qfiMask != 0 {
+		return p.qfi
+	}
+
+	for _, id := range p.qerIDList {
+		for _, q := range s.qers {
+			if q.qerID == id && q.qfi != 0 {
+				return q.qfi
+			}
+		}
+	}
+
+	return 0
+}
+
+// export sends records to the collector, in as many messages as needed.
+func (f *flowExporter) export(records []flowRecord, now time.Time) {
+	for _, msg := range f.messages(records, now) {
+		if _, err := f.conn.Write(msg); err != nil {
+			log.Errorln("Failed to export flows:", err)
+			return
+		}
+	}
+}
+
+// messages encodes records as IPFIX messages. Each message carries the templates,
+// as the collector may have missed or expired those of previous ones over UDP.
+func (f *flowExporter) messages(records []flowRecord, now time.Time) [][]byte {
+	templates := f.templateSet()
+	perMessage := (ipfixMaxMessageLen - ipfixHeaderLen - len(templates) - 2*ipfixSetHeaderLen) / ipfixRecordLen
+
+	var msgs [][]byte
+
+	for len(records) > 0 {
+		n := perMessage
+		if n > len(records) {
+			n = len(records)
+		}
+
+		var sets bytes.Buffer
+
+		sets.Write(templates)
+
+		for _, uplink := range []bool{true, false} {
+			sets.Write(ipfixDataSet(records[:n], uplink, now))
+		}
+
+		var msg bytes.Buffer
+
+		writeBE(&msg, uint16(ipfixVersion), uint16(ipfixHeaderLen+sets.Len()), uint32(now.Unix()), f.seq, f.domainID)
+		msg.Write(sets.Bytes())
+
+		f.seq += uint32(n)
+		msgs = append(msgs, msg.Bytes())
+		records = records[n:]
+	}
+
+	return msgs
+}
+
+func (f *flowExporter) templateSet() []byte {
+	var records bytes.Buffer
+
+	for _, t := range []struct {
+		id   uint16
+		ueIP uint16
+	}{
+		{ipfixTemplateUplink, ipfixSourceIPv4Address},
+		{ipfixTemplateDownlink, ipfixDestinationIPv4Address},
+	} {
+		writeBE(&records, t.id, uint16(len(ipfixFields)))
+
+		for i, field := range ipfixFields {
+			id := field.id
+			if i == 0 {
+				id = t.ueIP
+			}
+
+			if !field.enterprise {
+				writeBE(&records, id, field.length)
+				continue
+			}
+
+			writeBE(&records, id|ipfixEnterpriseBit, field.length, f.enterprise)
+		}
+	}
+
+	return ipfixSet(ipfixTemplateSetID, records.Bytes())
+}
+
+// ipfixDataSet returns the set of the uplink or downlink records, empty if none.
+func ipfixDataSet(records []flowRecord, uplink bool, now time.Time) []byte {
+	var data bytes.Buffer
+
+	setID, direction := uint16(ipfixTemplateUplink), uint8(ipfixDirectionIngress)
+	if !uplink {
+		setID, direction = ipfixTemplateDownlink, ipfixDirectionEgress
+	}
+
+	endMs := uint64(now.UnixNano() / int64(time.Millisecond))
+
+	for _, r := range records {
+		if r.uplink == uplink {
+			writeBE(&data, r.ueIP, r.bytes, r.packets, direction, endMs, r.qfi)
+		}
+	}
+
+	if data.Len() == 0 {
+		return nil
+	}
+
+	return ipfixSet(setID, data.Bytes())
+}
+
+func ipfixSet(id uint16, records []byte) []byte {
+	var set bytes.Buffer
+
+	writeBE(&set, id, uint16(ipfixSetHeaderLen+len(records)))
+	set.Write(records)
+
+	return set.Bytes()
+}
+
+// writeBE writes the fixed-size values in network byte order.
+func writeBE(b *bytes.Buffer, values ...interface{}) {
+	for _, v := range values {
+		// Writes to a bytes.Buffer do not fail.
+		_ = binary.Write(b, binary.BigEndian, v)
+	}
+}
@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func flowExportSession(seid uint64) PFCPSession {
+	ueIP := ip2int(net.ParseIP("10.250.0.1"))
+
+	return PFCPSession{
+		localSEID: seid,
+		PacketForwardingRules: PacketForwardingRules{
+			pdrs: []pdr{
+				{pdrID: 1, fseID: seid, srcIface: access, ueAddress: ueIP, qfi: 9, qfiMask: 0x3f},
+				{pdrID: 2, fseID: seid, srcIface: core, ueAddress: ueIP, qerIDList: []uint32{1, 2}},
+			},
+			qers: []qer{{qerID: 1}, {qerID: 2, qfi: 5}},
+		},
+	}
+}
+
+func Test_flowExporter_flows(t *testing.T) {
+	const seid = uint64(1)
+
+	session := flowExportSession(seid)
+	f := &flowExporter{last: make(map[pdrCounterKey]pdrCounters)}
+
+	records := f.flows([]PFCPSession{session}, map[pdrCounterKey]pdrCounters{
+		{fseID: seid, pdrID: 1}: {packets: 2, bytes: 200},
+		{fseID: seid, pdrID: 2}: {packets: 4, bytes: 800},
+	})
+	require.Equal(t, []flowRecord{
+		{ueIP: session.pdrs[0].ueAddress, qfi: 9, uplink: true, bytes: 200, packets: 2},
+		{ueIP: session.pdrs[0].ueAddress, qfi: 5, bytes: 800, packets: 4},
+	}, records)
+
+	records = f.flows([]PFCPSession{session}, map[pdrCounterKey]pdrCounters{
+		{fseID: seid, pdrID: 1}: {packets: 2, bytes: 200},
+		{fseID: seid, pdrID: 2}: {packets: 1, bytes: 100},
+	})
+	require.Equal(t, []flowRecord{
+		{ueIP: session.pdrs[0].ueAddress, qfi: 5, bytes: 100, packets: 1},
+	}, records, "idle PDRs are not exported, reset counters are exported whole")
+}
+
+func Test_flowExporter_messages(t *testing.T) {
+	f := &flowExporter{domainID: 7, enterprise: 26616}
+	now := time.Unix(1700000000, 0)
+
+	records := make([]flowRecord, 100)
+	for i := range records {
+		records[i] = flowRecord{ueIP: uint32(i), uplink: i%2 == 0, bytes: 100, packets: 1, qfi: 9}
+	}
+
+	msgs := f.messages(records, now)
+	require.Len(t, msgs, 3)
+
+	var seq uint32
+
+	for _, msg := range msgs {
+		require.LessOrEqual(t, len(msg), ipfixMaxMessageLen)
+		require.Equal(t, uint16(ipfixVersion), binary.BigEndian.Uint16(msg[0:]))
+		require.Equal(t, uint16(len(msg)), binary.BigEndian.Uint16(msg[2:]))
+		require.Equal(t, uint32(1700000000), binary.BigEndian.Uint32(msg[4:]))
+		require.Equal(t, seq, binary.BigEndian.Uint32(msg[8:]))
+		require.Equal(t, uint32(7), binary.BigEndian.Uint32(msg[12:]))
+
+		sets := map[uint16][]byte{}
+		for b := msg[ipfixHeaderLen:]; len(b) > 0; {
+			n := binary.BigEndian.Uint16(b[2:])
+			sets[binary.BigEndian.Uint16(b)] = b[ipfixSetHeaderLen:n]
+			b = b[n:]
+		}
+
+		template := sets[ipfixTemplateSetID]
+		require.Equal(t, uint16(ipfixTemplateUplink), binary.BigEndian.Uint16(template))
+		require.Equal(t, uint16(len(ipfixFields)), binary.BigEndian.Uint16(template[2:]))
+		require.Equal(t, uint16(ipfixSourceIPv4Address), binary.BigEndian.Uint16(template[4:]))
+
+		uplink, downlink := sets[ipfixTemplateUplink], sets[ipfixTemplateDownlink]
+		require.Zero(t, len(uplink)%ipfixRecordLen)
+		require.Zero(t, len(downlink)%ipfixRecordLen)
+
+		record := downlink[:ipfixRecordLen]
+		require.Equal(t, uint32(1), binary.BigEndian.Uint32(record)%2, "UE IP")
+		require.Equal(t, uint64(100), binary.BigEndian.Uint64(record[4:]), "bytes")
+		require.Equal(t, uint64(1), binary.BigEndian.Uint64(record[12:]), "packets")
+		require.Equal(t, uint8(ipfixDirectionEgress), record[20])
+		require.Equal(t, uint64(1700000000000), binary.BigEndian.Uint64(record[21:]), "end time")
+		require.Equal(t, uint8(9), record[29], "QFI")
+
+		seq += uint32((len(uplink) + len(downlink)) / ipfixRecordLen)
+	}
+
+	require.Equal(t, uint32(100), seq)
+	require.Equal(t, seq, f.seq)
+}
+
+func Test_flowExporter_run(t *testing.T) {
+	collector, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer collector.Close()
+
+	f, err := newFlowExporter(FlowExportInfo{Collector: collector.LocalAddr().String(), Interval: "10ms"})
+	require.NoError(t, err)
+
+	const seid = uint64(1)
+
+	var bytes uint64
+
+	read := func(pdrs []pdr) (map[pdrCounterKey]pdrCounters, error) {
+		bytes += 100
+
+		return map[pdrCounterKey]pdrCounters{
+			{fseID: seid, pdrID: 1}: {packets: 1, bytes: bytes},
+		}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go f.run(ctx, func() []PFCPSession { return []PFCPSession{flowExportSession(seid)} }, read)
+
+	buf := make([]byte, ipfixMaxMessageLen)
+
+	require.NoError(t, collector.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := collector.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, uint16(ipfixVersion), binary.BigEndian.Uint16(buf))
+	require.Equal(t, uint16(n), binary.BigEndian.Uint16(buf[2:]))
+}
@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/hex"
+	"io"
+	"net"
+
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// upCSID is the single PDN Connection Set Identifier of the UPF. All its sessions
+// fail together, a restart being signalled by its Recovery Time Stamp, so the UPF
+// never sends Session Set Deletion Requests itself.
+const upCSID = 1
+
+// fqCSID is a PDN Connection Set Identifier of a node (3GPP TS 23.007, clause 16).
+type fqCSID struct {
+	Node string `json:"node"`
+	CSID uint16 `json:"csid"`
+}
+
+// parseFQCSID returns the CSIDs of an FQ-CSID IE.
+func parseFQCSID(i *ie.IE) ([]fqCSID, error) {
+	b, err := i.FQCSID()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		node    string
+		nodeLen int
+	)
+
+	nodeType := b[0] >> 4
+	n := int(b[0] & 0x0f)
+
+	switch nodeType {
+	case 0, 2: // IPv4 address, MCC/MNC-based identifier
+		nodeLen = 4
+	case 1:
+		nodeLen = net.IPv6len
+	default:
+		return nil, ErrInvalidArgument("FQ-CSID node ID type", nodeType)
+	}
+
+	if len(b) < 1+nodeLen+2*n {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	if nodeType == 2 {
+		node = hex.EncodeToString(b[1 : 1+nodeLen])
+	} else {
+		node = net.IP(b[1 : 1+nodeLen]).String()
+	}
+
+	csids := make([]fqCSID, 0, n)
+
+	for off := 1 + nodeLen; off < 1+nodeLen+2*n; off += 2 {
+		csids = append(csids, fqCSID{Node: node, CSID: uint16(b[off])<<8 | uint16(b[off+1])})
+	}
+
+	return csids, nil
+}
+
+// messageFQCSIDs returns the CSIDs of all the FQ-CSID IEs in the payload of a message,
+// and the IE failing to parse if any. The FQ-CSIDs of the MME, SGW-C, PGW-C/SMF, ePDG
+// and TWAN share the IE type, go-pfcp only keeps the last one.
+func messageFQCSIDs(payload []byte) ([]fqCSID, *ie.IE, error) {
+	if len(payload) == 0 {
+		return nil, nil, nil
+	}
+
+	ies, err := ie.ParseMultiIEs(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var csids []fqCSID
+
+	for _, i := range ies {
+		if i.Type != ie.FQCSID {
+			continue
+		}
+
+		c, err := parseFQCSID(i)
+		if err != nil {
+			return nil, i, err
+		}
+
+		csids = append(csids, c...)
+	}
+
+	return csids, nil, nil
+}
+
+// inCSIDSet returns true if a session with csids is in one of the requested sets. The
+// sessions the UPF reported its own FQ-CSID for, those with CP FQ-CSIDs, are in its set.
+func inCSIDSet(csids []fqCSID, requested map[fqCSID]bool, own fqCSID) bool {
+	if len(csids) > 0 && requested[own] {
+		return true
+	}
+
+	for _, c := range csids {
+		if requested[c] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ownFQCSID returns the FQ-CSID of the UPF, with its N4 address.
+func (pConn *PFCPConn) ownFQCSID() fqCSID {
+	return fqCSID{Node: pConn.localIP().String(), CSID: upCSID}
+}
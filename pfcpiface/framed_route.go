@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// framedRoute is a subnet behind a UE acting as a router, routed to the UE.
+type framedRoute struct {
+	ip   uint32
+	mask uint32
+}
+
+func (r framedRoute) String() string {
+	ones, _ := net.IPMask(int2ip(r.mask)).Size()
+
+	return fmt.Sprintf("%v/%v", int2ip(r.ip), ones)
+}
+
+// parseFramedRoute parses a Framed-Route, as in RADIUS (RFC 2865, clause 5.22):
+// "<prefix>[/<length>] <gateway> <metrics>". Only the prefix is used.
+func parseFramedRoute(route string) (framedRoute, error) {
+	fields := strings.Fields(route)
+	if len(fields) == 0 {
+		return framedRoute{}, ErrInvalidArgument("Framed-Route", route)
+	}
+
+	prefix := fields[0]
+	if !strings.Contains(prefix, "/") {
+		prefix += "/32"
+	}
+
+	_, subnet, err := net.ParseCIDR(prefix)
+	if err != nil || subnet.IP.To4() == nil {
+		return framedRoute{}, ErrInvalidArgumentWithReason("Framed-Route", route, "not an IPv4 prefix")
+	}
+
+	return framedRoute{ip: ip2int(subnet.IP), mask: ipMask2int(subnet.Mask)}, nil
+}
+
+// parseFramedRoutes parses the Framed-Routes of the PDI of a PDR. Datapaths match IPv4
+// UE addresses, so Framed-IPv6-Routes are not supported.
+func (p *pdr) parseFramedRoutes(pdiIEs []*ie.IE) error {
+	p.framedRoutes = nil
+
+	for _, pdiIE := range pdiIEs {
+		switch pdiIE.Type {
+		case ie.FramedRoute:
+			route, err := pdiIE.FramedRoute()
+			if err != nil {
+				return err
+			}
+
+			r, err := parseFramedRoute(route)
+			if err != nil {
+				return err
+			}
+
+			p.framedRoutes = append(p.framedRoutes, r)
+		case ie.FramedIPv6Route:
+			route, _ := pdiIE.FramedIPv6Route()
+			return ErrUnsupported("Framed-IPv6-Route", route)
+		}
+	}
+
+	return nil
+}
+
+// withFramedRoutes returns pdrs, each followed by a copy for each of its Framed-Routes
+// matching the subnet in place of the UE address. The copies share the PDR ID and
+// counter of the PDR. PDRs not matching the UE address only, e.g. by SDF filters on
+// the UE side, are not copied.
+func withFramedRoutes(pdrs []pdr) []pdr {
+	expanded := make([]pdr, 0, len(pdrs))
+
+	for _, p := range pdrs {
+		expanded = append(expanded, p)
+
+		for _, r := range p.framedRoutes {
+			c := p
+
+			switch {
+			case p.IsDownlink() && p.appFilter.dstIP == p.ueAddress && p.appFilter.dstIPMask == math.MaxUint32:
+				c.appFilter.dstIP, c.appFilter.dstIPMask = r.ip, r.mask
+			case p.IsUplink() && p.appFilter.srcIP == p.ueAddress && p.appFilter.srcIPMask == math.MaxUint32:
+				c.appFilter.srcIP, c.appFilter.srcIPMask = r.ip, r.mask
+			default:
+				continue
+			}
+
+			expanded = append(expanded, c)
+		}
+	}
+
+	return expanded
+}
+
+// routedSubnet is a Framed-Route of a session, to be advertised on N6 toward the UPF.
+type routedSubnet struct {
+	Subnet string `json:"subnet"`
+	UEIP   string `json:"ue_ip"`
+	NodeID string `json:"node_id"`
+	FSEID  string `json:"fseid"`
+}
+
+// routedSubnets returns the Framed-Routes of the downlink PDRs of session.
+func routedSubnets(nodeID string, session PFCPSession) []routedSubnet {
+	var subnets []routedSubnet
+
+	seen := make(map[framedRoute]bool)
+
+	for _, p := range session.pdrs {
+		if !p.IsDownlink() {
+			continue
+		}
+
+		for _, r := range p.framedRoutes {
+			if seen[r] {
+				continue
+			}
+
+			seen[r] = true
+
+			subnets = append(subnets, routedSubnet{
+				Subnet: r.String(),
+				UEIP:   int2ip(p.ueAddress).String(),
+				NodeID: nodeID,
+				FSEID:  strconv.FormatUint(session.localSEID, 10),
+			})
+		}
+	}
+
+	return subnets
+}
+
+// framedRoutesHandler serves the Framed-Routes of all the sessions, for a routing
+// daemon to advertise them on N6:
+//
+//	GET /v1/framed-routes
+type framedRoutesHandler struct {
+	node *PFCPNode
+}
+
+func (h *framedRoutesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	subnets := make([]routedSubnet, 0)
+
+	h.node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+		for _, session := range pConn.store.GetAllSessions() {
+			subnets = append(subnets, routedSubnets(pConn.nodeID.remote, session)...)
+		}
+
+		return true
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(subnets); err != nil {
+		log.Errorln("Failed to encode Framed-Routes:", err)
+	}
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"math"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func Test_parseFramedRoute(t *testing.T) {
+	for route, expected := range map[string]string{
+		"192.0.2.0/24 0.0.0.0 1": "192.0.2.0/24",
+		"198.51.100.7":           "198.51.100.7/32",
+		"203.0.113.9/29":         "203.0.113.8/29",
+	} {
+		r, err := parseFramedRoute(route)
+		require.NoError(t, err, route)
+		require.Equal(t, expected, r.String(), route)
+	}
+
+	for _, route := range []string{"", "2001:db8::/64", "192.0.2.0/33"} {
+		_, err := parseFramedRoute(route)
+		require.Error(t, err, route)
+	}
+}
+
+func TestParsePDR_framedRoutes(t *testing.T) {
+	ueAddress := net.ParseIP("10.0.1.1")
+	downlinkPDR := func(routes ...*ie.IE) *ie.IE {
+		return ie.NewCreatePDR(
+			ie.NewPDRID(1),
+			ie.NewPrecedence(1),
+			ie.NewPDI(append([]*ie.IE{
+				ie.NewSourceInterface(ie.SrcInterfaceCore),
+				ie.NewUEIPAddress(0x2, ueAddress.String(), "", 0, 0),
+			}, routes...)...),
+			ie.NewFARID(1),
+		)
+	}
+
+	var p pdr
+	require.NoError(t, p.parsePDR(downlinkPDR(ie.NewFramedRoute("192.0.2.0/24 10.0.1.1 1"),
+		ie.NewFramedRoute("198.51.100.0/28")), 100, nil, nil, nil, nil, nil))
+	require.Equal(t, []framedRoute{
+		{ip: ip2int(net.ParseIP("192.0.2.0")), mask: 0xffffff00},
+		{ip: ip2int(net.ParseIP("198.51.100.0")), mask: 0xfffffff0},
+	}, p.framedRoutes)
+
+	p = pdr{}
+	require.Error(t, p.parsePDR(downlinkPDR(ie.NewFramedIPv6Route("2001:db8::/64")), 100, nil, nil, nil, nil, nil))
+
+	p = pdr{}
+	require.NoError(t, p.parsePDR(downlinkPDR(), 100, nil, nil, nil, nil, nil))
+	require.Empty(t, p.framedRoutes)
+}
+
+func Test_withFramedRoutes(t *testing.T) {
+	ue := ip2int(net.ParseIP("10.0.1.1"))
+	route := framedRoute{ip: ip2int(net.ParseIP("192.0.2.0")), mask: 0xffffff00}
+
+	downlink := pdr{pdrID: 1, srcIface: core, ueAddress: ue, framedRoutes: []framedRoute{route}}
+	downlink.resetAppFilter()
+
+	uplink := pdr{pdrID: 2, srcIface: access, ueAddress: ue, framedRoutes: []framedRoute{route}}
+	uplink.resetAppFilter()
+
+	filtered := downlink
+	filtered.pdrID = 3
+	filtered.appFilter.dstIPMask = 0xffff0000
+
+	pdrs := withFramedRoutes([]pdr{downlink, uplink, filtered})
+	require.Len(t, pdrs, 5)
+
+	require.Equal(t, ue, pdrs[0].appFilter.dstIP)
+	require.Equal(t, uint32(1), pdrs[1].pdrID)
+	require.Equal(t, route.ip, pdrs[1].appFilter.dstIP)
+	require.Equal(t, route.mask, pdrs[1].appFilter.dstIPMask)
+
+	require.Equal(t, uint32(2), pdrs[3].pdrID)
+	require.Equal(t, route.ip, pdrs[3].appFilter.srcIP)
+	require.Equal(t, route.mask, pdrs[3].appFilter.srcIPMask)
+
+	require.Equal(t, uint32(3), pdrs[4].pdrID, "PDRs not matching the UE address only are not copied")
+	require.Equal(t, uint32(math.MaxUint32), pdrs[0].appFilter.dstIPMask)
+}
+
+func Test_routedSubnets(t *testing.T) {
+	route := framedRoute{ip: ip2int(net.ParseIP("192.0.2.0")), mask: 0xffffff00}
+	session := PFCPSession{
+		localSEID: 7,
+		PacketForwardingRules: PacketForwardingRules{pdrs: []pdr{
+			{pdrID: 1, srcIface: core, ueAddress: ip2int(net.ParseIP("10.0.1.1")), framedRoutes: []framedRoute{route}},
+			{pdrID: 2, srcIface: core, ueAddress: ip2int(net.ParseIP("10.0.1.1")), framedRoutes: []framedRoute{route}},
+			{pdrID: 3, srcIface: access, framedRoutes: []framedRoute{route}},
+		}},
+	}
+
+	require.Equal(t, []routedSubnet{{
+		Subnet: "192.0.2.0/24",
+		UEIP:   "10.0.1.1",
+		NodeID: "smf",
+		FSEID:  "7",
+	}}, routedSubnets("smf", session))
+
+	require.Error(t, xdpCheckSupported(session.pdrs[0]))
+	require.Error(t, verifyPDR(session.pdrs[0]))
+}
@@ -4,6 +4,11 @@
 package pfcpiface
 
 import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -68,33 +73,140 @@ func (s simMode) enable() bool {
 	return s != simModeDisable
 }
 
+// Core interfaces of the simulated sessions.
+const (
+	simIfaceN6 = "n6"
+	simIfaceN9 = "n9"
+)
+
+// loadSimProfile overrides the sim attributes of s with those of its profile file,
+// read as YAML if its extension is .yaml or .yml, as JSON otherwise.
+func loadSimProfile(s *SimModeInfo) error {
+	path := s.Profile
+
+	byteValue, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		byteValue, err = yamlToJSON(byteValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = json.Unmarshal(byteValue, s); err != nil {
+		return ErrOperationFailedWithReason("loading sim profile "+path, err.Error())
+	}
+
+	s.Profile = path
+
+	return nil
+}
+
+// simIPRange is a range of size UE addresses from start.
+type simIPRange struct {
+	start, size uint32
+}
+
+// simProfile is the shape of the simulated sessions.
+type simProfile struct {
+	ueRanges []simIPRange
+	gnbs     uint32
+	n6, n9   bool
+	// interval between two sessions, 0 if not paced.
+	interval time.Duration
+}
+
+func newSimProfile(s *SimModeInfo) simProfile {
+	p := simProfile{gnbs: s.NumGNBs}
+
+	for _, r := range s.UEIPRanges {
+		if _, ipNet, err := net.ParseCIDR(r); err == nil {
+			ones, bits := ipNet.Mask.Size()
+			p.ueRanges = append(p.ueRanges, simIPRange{start: ip2int(ipNet.IP), size: 1 << uint(bits-ones)})
+		}
+	}
+
+	if len(p.ueRanges) == 0 {
+		p.ueRanges = []simIPRange{{start: ip2int(s.StartUEIP)}}
+	}
+
+	for _, iface := range s.Interfaces {
+		p.n6 = p.n6 || iface == simIfaceN6
+		p.n9 = p.n9 || iface == simIfaceN9
+	}
+
+	if !p.n6 && !p.n9 {
+		p.n6, p.n9 = true, true
+	}
+
+	if s.SessionsPerSecond > 0 {
+		p.interval = time.Second / time.Duration(s.SessionsPerSecond)
+	}
+
+	return p
+}
+
+// ueIP returns the address of the i-th UE, taken from the ranges in order.
+func (p simProfile) ueIP(i uint32) uint32 {
+	for _, r := range p.ueRanges {
+		if r.size == 0 || i < r.size {
+			return r.start + i
+		}
+
+		i -= r.size
+	}
+
+	last := p.ueRanges[len(p.ueRanges)-1]
+
+	return last.start + last.size + i
+}
+
+// gnbIndex returns the index of the gNB serving the i-th UE.
+func (p simProfile) gnbIndex(i uint32) uint32 {
+	if p.gnbs > 0 {
+		return i % p.gnbs
+	}
+
+	// NG4T-based formula to calculate enodeB IP address against a given UE IP address
+	// il_trafficgen also uses the same scheme
+	// See SimuCPEnbv4Teid(...) in ngic code for more details
+	const ng4tMaxUeRan, ng4tMaxEnbRan = 500000, 80
+
+	ueOfRan := i % ng4tMaxUeRan
+	ran := i / ng4tMaxUeRan
+	enbOfRan := ueOfRan % ng4tMaxEnbRan
+
+	return ran*ng4tMaxEnbRan + enbOfRan
+}
+
 func (u *upf) sim(mode simMode, s *SimModeInfo) {
-	log.Infoln(simulate.String(), "sessions:", s.MaxSessions)
+	log.Infoln(mode.String(), "sessions:", s.MaxSessions)
 
 	start := time.Now()
-	ueip := s.StartUEIP
+	profile := newSimProfile(s)
 	enbip := s.StartENBIP
 	aupfip := s.StartAUPFIP
 	n9appip := s.N9AppIP
 	n3TEID := hex2int(s.StartN3TEID)
 	n9TEID := hex2int(s.StartN9TEID)
 
-	const ng4tMaxUeRan, ng4tMaxEnbRan = 500000, 80
-
 	for i := uint32(0); i < s.MaxSessions; i++ {
-		// NG4T-based formula to calculate enodeB IP address against a given UE IP address
-		// il_trafficgen also uses the same scheme
-		// See SimuCPEnbv4Teid(...) in ngic code for more details
-		ueOfRan := i % ng4tMaxUeRan
-		ran := i / ng4tMaxUeRan
-		enbOfRan := ueOfRan % ng4tMaxEnbRan
-		enbIdx := ran*ng4tMaxEnbRan + enbOfRan
+		if profile.interval > 0 {
+			time.Sleep(time.Until(start.Add(time.Duration(i) * profile.interval)))
+		}
+
+		ueIP := profile.ueIP(i)
+		enbIdx := profile.gnbIndex(i)
 
 		// create/delete downlink pdr
 		pdrN6Down := pdr{
 			srcIface: core,
 			appFilter: applicationFilter{
-				dstIP:     ip2int(ueip) + i,
+				dstIP:     ueIP,
 				dstIPMask: 0xFFFFFFFF,
 			},
 
@@ -135,7 +247,7 @@ func (u *upf) sim(mode simMode, s *SimModeInfo) {
 			tunnelIP4Dst: ip2int(u.AccessIP),
 			tunnelTEID:   n3TEID + i,
 			appFilter: applicationFilter{
-				srcIP:     ip2int(ueip) + i,
+				srcIP:     ueIP,
 				srcIPMask: 0xFFFFFFFF,
 			},
 
@@ -176,7 +288,15 @@ func (u *upf) sim(mode simMode, s *SimModeInfo) {
 			needDecap: 1,
 		}
 
-		pdrs := []pdr{pdrN6Down, pdrN9Down, pdrN6Up, pdrN9Up}
+		var pdrs []pdr
+
+		if profile.n6 {
+			pdrs = append(pdrs, pdrN6Down, pdrN6Up)
+		}
+
+		if profile.n9 {
+			pdrs = append(pdrs, pdrN9Down, pdrN9Up)
+		}
 
 		// create/delete downlink far
 		farDown := far{
@@ -214,7 +334,15 @@ func (u *upf) sim(mode simMode, s *SimModeInfo) {
 			tunnelPort:   tunnelGTPUPort,
 		}
 
-		fars := []far{farDown, farN6Up, farN9Up}
+		fars := []far{farDown}
+
+		if profile.n6 {
+			fars = append(fars, farN6Up)
+		}
+
+		if profile.n9 {
+			fars = append(fars, farN9Up)
+		}
 
 		// create/delete uplink qer
 		qerN6 := qer{
@@ -237,7 +365,15 @@ func (u *upf) sim(mode simMode, s *SimModeInfo) {
 			dlMbr: 90000,
 		}
 
-		qers := []qer{qerN6, qerN9}
+		var qers []qer
+
+		if profile.n6 {
+			qers = append(qers, qerN6)
+		}
+
+		if profile.n9 {
+			qers = append(qers, qerN9)
+		}
 
 		// create/delete session qers
 		sessionQer := qer{
@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_simProfile(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		p := newSimProfile(&SimModeInfo{StartUEIP: net.ParseIP("16.0.0.1")})
+
+		require.Equal(t, ip2int(net.ParseIP("16.0.0.1"))+1000, p.ueIP(1000))
+		require.Equal(t, uint32(79), p.gnbIndex(79))
+		require.Equal(t, uint32(0), p.gnbIndex(80))
+		require.True(t, p.n6)
+		require.True(t, p.n9)
+		require.Zero(t, p.interval)
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		p := newSimProfile(&SimModeInfo{
+			SessionsPerSecond: 100,
+			UEIPRanges:        []string{"10.250.0.0/30", "10.251.0.0/24"},
+			NumGNBs:           3,
+			Interfaces:        []string{simIfaceN9},
+		})
+
+		require.Equal(t, ip2int(net.ParseIP("10.250.0.3")), p.ueIP(3))
+		require.Equal(t, ip2int(net.ParseIP("10.251.0.0")), p.ueIP(4))
+		require.Equal(t, ip2int(net.ParseIP("10.251.0.1")), p.ueIP(5))
+		require.Equal(t, uint32(2), p.gnbIndex(5))
+		require.False(t, p.n6)
+		require.True(t, p.n9)
+		require.Equal(t, 10*time.Millisecond, p.interval)
+	})
+}
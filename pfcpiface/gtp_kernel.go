@@ -0,0 +1,355 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+const (
+	// gtpIfNameDefault is the name of the gtp link created by the kernel GTP datapath.
+	gtpIfNameDefault = "gtp0"
+	// gtpPDPHashSize sizes the PDP context hash tables of the gtp link.
+	gtpPDPHashSize = 1024
+)
+
+// gtpPDP is a PDP context of the kernel gtp module: traffic to the UE at msAddress
+// is tunnelled to peer with oTEI, traffic received with iTEI is decapsulated.
+type gtpPDP struct {
+	msAddress uint32
+	peer      uint32
+	iTEI      uint32
+	oTEI      uint32
+}
+
+func (p gtpPDP) String() string {
+	return fmt.Sprintf("PDP(msAddress=%v, peer=%v, iTEI=%v, oTEI=%v)",
+		int2ip(p.msAddress), int2ip(p.peer), p.iTEI, p.oTEI)
+}
+
+// gtpSession is the state of a session kept by the kernel GTP datapath, which
+// receives rule deltas but programs one PDP context per session.
+type gtpSession struct {
+	pdrs map[uint32]pdr
+	fars map[uint32]far
+	pdp  *gtpPDP
+}
+
+func newGTPSession() *gtpSession {
+	return &gtpSession{
+		pdrs: make(map[uint32]pdr),
+		fars: make(map[uint32]far),
+	}
+}
+
+// update adds or removes the rules of a datapath message to the session.
+func (s *gtpSession) update(method upfMsgType, pdrs []pdr, fars []far) {
+	for _, p := range pdrs {
+		if method == upfMsgTypeDel {
+			delete(s.pdrs, p.pdrID)
+		} else {
+			s.pdrs[p.pdrID] = p
+		}
+	}
+
+	for _, f := range fars {
+		if method == upfMsgTypeDel {
+			delete(s.fars, f.farID)
+		} else {
+			s.fars[f.farID] = f
+		}
+	}
+}
+
+// desiredPDP returns the PDP context implementing the session, if its uplink
+// F-TEID and downlink tunnel are both known.
+func (s *gtpSession) desiredPDP() (*gtpPDP, error) {
+	var (
+		pdp            gtpPDP
+		hasUL, hasDL   bool
+		ueAddr, ulTEID uint32
+	)
+
+	for _, p := range s.pdrs {
+		if p.IsUplink() {
+			if hasUL && p.tunnelTEID != ulTEID {
+				return nil, ErrUnsupported("multiple uplink F-TEIDs per session", p.tunnelTEID)
+			}
+
+			hasUL, ulTEID = true, p.tunnelTEID
+
+			continue
+		}
+
+		if !p.IsDownlink() {
+			continue
+		}
+
+		if hasDL && p.ueAddress != ueAddr {
+			return nil, ErrUnsupported("multiple UE addresses per session", int2ip(p.ueAddress))
+		}
+
+		hasDL, ueAddr = true, p.ueAddress
+
+		f, ok := s.fars[p.farID]
+		if !ok || !f.Forwards() || f.tunnelIP4Dst == 0 {
+			continue
+		}
+
+		pdp.peer, pdp.oTEI = f.tunnelIP4Dst, f.tunnelTEID
+	}
+
+	if !hasUL || !hasDL || pdp.peer == 0 {
+		return nil, nil
+	}
+
+	pdp.msAddress, pdp.iTEI = ueAddr, ulTEID
+
+	return &pdp, nil
+}
+
+// gtpKernelCheckSupported returns an error if p cannot be implemented by a PDP context.
+func gtpKernelCheckSupported(p pdr) error {
+	switch {
+	case !p.IsAppFilterEmpty():
+		return ErrUnsupported("SDF filter", p.appFilter)
+	case p.matchesQFI():
+		return ErrUnsupported("QFI match", p.qfi)
+	case p.IsUplink() && p.tunnelTEIDMask == 0:
+		return ErrUnsupported("uplink PDR without F-TEID", p.pdrID)
+	case p.IsDownlink() && p.ueAddress == 0:
+		return ErrUnsupported("downlink PDR without UE address", p.pdrID)
+	case len(p.framedRoutes) > 0:
+		return ErrUnsupported("Framed-Route", p.framedRoutes)
+	}
+
+	return nil
+}
+
+func gtpKernelCheckFARSupported(f far) error {
+	if f.dstIntf == ie.DstInterfaceCore && f.tunnelIP4Dst != 0 {
+		return ErrUnsupported("N9 tunnel", int2ip(f.tunnelIP4Dst))
+	}
+
+	return nil
+}
+
+// gtpKernel programs PDP contexts of the Linux kernel gtp module over netlink.
+// It only forwards traffic: QERs, usage counters, end markers, slice meters and
+// DSCP marking are not supported, and PDRs match the tunnel or UE address only.
+type gtpKernel struct {
+	mu       sync.Mutex
+	link     *gtpLink
+	sessions map[uint64]*gtpSession
+}
+
+func (g *gtpKernel) IsConnected(accessIP *net.IP) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.link != nil
+}
+
+func (g *gtpKernel) SetUpfInfo(u *upf, conf *Conf) error {
+	log.Println("SetUpfInfo gtp")
+
+	ifname := conf.GTPIface.IfName
+	if ifname == "" {
+		ifname = gtpIfNameDefault
+	}
+
+	link, err := openGTPLink(ifname, u.AccessIP)
+	if err != nil {
+		return ErrOperationFailedWithReason("kernel GTP datapath setup", err.Error())
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.link = link
+	g.sessions = make(map[uint64]*gtpSession)
+
+	return nil
+}
+
+func (g *gtpKernel) Exit() {
+	log.Println("Exit function gtp")
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.link == nil {
+		return
+	}
+
+	if err := g.link.close(); err != nil {
+		log.Errorln("Failed to delete gtp link:", err)
+	}
+
+	g.link = nil
+}
+
+func (g *gtpKernel) AddSliceInfo(sliceInfo *SliceInfo) error {
+	return ErrUnsupported("slice meter", "gtp")
+}
+
+func (g *gtpKernel) RemoveSliceInfo(sliceInfo *SliceInfo) error {
+	return ErrUnsupported("slice meter", "gtp")
+}
+
+func (g *gtpKernel) SendEndMarkers(endMarkerList *[][]byte) error {
+	return ErrUnsupported("end markers", "gtp")
+}
+
+func (g *gtpKernel) SendMsgToUPF(
+	method upfMsgType, rules PacketForwardingRules, updated PacketForwardingRules) uint8 {
+	if method != upfMsgTypeDel {
+		for _, p := range rules.pdrs {
+			if err := gtpKernelCheckSupported(p); err != nil {
+				log.Errorln("Rejecting", p, ":", err)
+				return ie.CauseRequestRejected
+			}
+		}
+
+		for _, f := range rules.fars {
+			if err := gtpKernelCheckFARSupported(f); err != nil {
+				log.Errorln("Rejecting", f, ":", err)
+				return ie.CauseRequestRejected
+			}
+		}
+	}
+
+	if len(rules.qers) > 0 {
+		log.Debugln("Kernel GTP datapath ignores", len(rules.qers), "QERs")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.link == nil {
+		log.Errorln("Kernel GTP datapath not set up")
+		return ie.CauseRequestRejected
+	}
+
+	fseids := make(map[uint64]struct{})
+	for _, p := range rules.pdrs {
+		fseids[p.fseID] = struct{}{}
+	}
+
+	for _, f := range rules.fars {
+		fseids[f.fseID] = struct{}{}
+	}
+
+	for fseid := range fseids {
+		if err := g.updateSession(fseid, method, rules); err != nil {
+			log.Errorln("Failed to", method, "rules in kernel GTP datapath:", err)
+			return ie.CauseRequestRejected
+		}
+	}
+
+	return ie.CauseRequestAccepted
+}
+
+func (g *gtpKernel) WriteSessionBatch(method upfMsgType, all PacketForwardingRules, updated PacketForwardingRules) error {
+	return ErrUnsupported("batched rules", "gtp")
+}
+
+func (g *gtpKernel) UpdateQERRates(q qer, all PacketForwardingRules) error {
+	return ErrUnsupported("in-place rule updates", "gtp")
+}
+
+func (g *gtpKernel) UpdateFARTunnel(f far, all PacketForwardingRules) error {
+	return ErrUnsupported("in-place rule updates", "gtp")
+}
+
+// updateSession applies the rules of fseid to its session and reprograms its PDP context.
+func (g *gtpKernel) updateSession(fseid uint64, method upfMsgType, rules PacketForwardingRules) error {
+	s, ok := g.sessions[fseid]
+	if !ok {
+		s = newGTPSession()
+	}
+
+	var pdrs []pdr
+
+	for _, p := range rules.pdrs {
+		if p.fseID == fseid {
+			pdrs = append(pdrs, p)
+		}
+	}
+
+	var fars []far
+
+	for _, f := range rules.fars {
+		if f.fseID == fseid {
+			fars = append(fars, f)
+		}
+	}
+
+	s.update(method, pdrs, fars)
+
+	pdp, err := s.desiredPDP()
+	if err != nil {
+		return err
+	}
+
+	if s.pdp != nil && (pdp == nil || *pdp != *s.pdp) {
+		log.Traceln("gtp delete", s.pdp)
+
+		if err := g.link.deletePDP(*s.pdp); err != nil {
+			return err
+		}
+
+		s.pdp = nil
+	}
+
+	if pdp != nil && s.pdp == nil {
+		log.Traceln("gtp add", pdp)
+
+		if err := g.link.addPDP(*pdp); err != nil {
+			return err
+		}
+
+		s.pdp = pdp
+	}
+
+	if len(s.pdrs) == 0 && len(s.fars) == 0 {
+		delete(g.sessions, fseid)
+	} else {
+		g.sessions[fseid] = s
+	}
+
+	return nil
+}
+
+func (g *gtpKernel) ReadPDRCounters(pdrs []pdr) (map[pdrCounterKey]pdrCounters, error) {
+	return nil, ErrUnsupported("PDR counters", "gtp")
+}
+
+func (g *gtpKernel) ReadSliceMeterCounters(sliceInfo *SliceInfo) (map[string]sliceMeterCounters, error) {
+	return nil, ErrUnsupported("slice meter", "gtp")
+}
+
+func (g *gtpKernel) ReadInstalledPDRs(expected []pdr) (map[pdrCounterKey]struct{}, error) {
+	return nil, ErrUnsupported("reading installed PDRs", "gtp")
+}
+
+func (g *gtpKernel) DeleteInstalledPDRs(keys []pdrCounterKey) error {
+	return ErrUnsupported("deleting PDRs by ID", "gtp")
+}
+
+func (g *gtpKernel) SummaryLatencyJitter(uc *upfCollector, ch chan<- prometheus.Metric) {
+}
+
+func (g *gtpKernel) PortStats(uc *upfCollector, ch chan<- prometheus.Metric) {
+}
+
+func (g *gtpKernel) SessionStats(*PfcpNodeCollector, chan<- prometheus.Metric) error {
+	return nil
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"math"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func Test_gtpSessionDesiredPDP(t *testing.T) {
+	ueAddress := ip2int(net.ParseIP("17.0.0.1"))
+	gnb := ip2int(net.ParseIP("198.18.0.1"))
+
+	uplink := pdr{srcIface: access, tunnelIP4Dst: ip2int(net.ParseIP("198.18.0.2")),
+		tunnelTEID: 1, tunnelTEIDMask: math.MaxUint32, fseID: 7, pdrID: 1, farID: 1}
+	downlink := pdr{srcIface: core, ueAddress: ueAddress, fseID: 7, pdrID: 2, farID: 2}
+	ulFAR := far{fseID: 7, farID: 1, applyAction: ActionForward, dstIntf: ie.DstInterfaceCore}
+	dlFAR := far{fseID: 7, farID: 2, applyAction: ActionBuffer, dstIntf: ie.DstInterfaceAccess}
+
+	s := newGTPSession()
+
+	t.Run("no PDP until the downlink tunnel is known", func(t *testing.T) {
+		s.update(upfMsgTypeAdd, []pdr{uplink, downlink}, []far{ulFAR, dlFAR})
+
+		pdp, err := s.desiredPDP()
+		require.NoError(t, err)
+		require.Nil(t, pdp)
+	})
+
+	t.Run("PDP once the downlink FAR forwards", func(t *testing.T) {
+		dlFAR.applyAction = ActionForward
+		dlFAR.tunnelIP4Dst, dlFAR.tunnelTEID = gnb, 2
+		s.update(upfMsgTypeMod, []pdr{uplink, downlink}, []far{ulFAR, dlFAR})
+
+		pdp, err := s.desiredPDP()
+		require.NoError(t, err)
+		require.Equal(t, &gtpPDP{msAddress: ueAddress, peer: gnb, iTEI: 1, oTEI: 2}, pdp)
+	})
+
+	t.Run("no PDP once the downlink PDR is deleted", func(t *testing.T) {
+		s.update(upfMsgTypeDel, []pdr{downlink}, nil)
+
+		pdp, err := s.desiredPDP()
+		require.NoError(t, err)
+		require.Nil(t, pdp)
+	})
+
+	t.Run("multiple uplink F-TEIDs are rejected", func(t *testing.T) {
+		other := uplink
+		other.pdrID, other.tunnelTEID = 3, 3
+		s.update(upfMsgTypeAdd, []pdr{other, downlink}, nil)
+
+		_, err := s.desiredPDP()
+		require.Error(t, err)
+	})
+}
+
+func Test_gtpKernelCheckSupported(t *testing.T) {
+	downlink := pdr{srcIface: core, ueAddress: ip2int(net.ParseIP("17.0.0.1"))}
+	downlink.resetAppFilter()
+	require.NoError(t, gtpKernelCheckSupported(downlink))
+
+	sdf := downlink
+	sdf.appFilter.proto = 17
+	sdf.appFilter.protoMask = math.MaxUint8
+	require.Error(t, gtpKernelCheckSupported(sdf))
+
+	noTunnel := pdr{srcIface: access}
+	noTunnel.resetAppFilter()
+	require.Error(t, gtpKernelCheckSupported(noTunnel))
+
+	n9 := far{dstIntf: ie.DstInterfaceCore, tunnelIP4Dst: 1}
+	require.Error(t, gtpKernelCheckFARSupported(n9))
+}
+
+func Test_gtpNetlinkEncoding(t *testing.T) {
+	require.Equal(t, []byte{8, 0, 3, 0, 'g', 't', 'p', 0}, nlAttrString(iflaIfName, "gtp"))
+	require.Equal(t, []byte{5, 0, 1, 0, 1, 0, 0, 0}, nlAttr(1, []byte{1}))
+
+	pdp := gtpPDP{msAddress: ip2int(net.ParseIP("17.0.0.1")), peer: ip2int(net.ParseIP("198.18.0.1")), iTEI: 1, oTEI: 2}
+	attrs := nlParseAttrs(gtpPDPAttrs(4, pdp, true))
+	require.Equal(t, []byte{4, 0, 0, 0}, attrs[gtpaLink])
+	require.Equal(t, []byte{1, 0, 0, 0}, attrs[gtpaVersion])
+	require.Equal(t, []byte{17, 0, 0, 1}, attrs[gtpaMSAddress])
+	require.Equal(t, []byte{198, 18, 0, 1}, attrs[gtpaPeerAddress])
+	require.Equal(t, []byte{1, 0, 0, 0}, attrs[gtpaITEI])
+	require.Equal(t, []byte{2, 0, 0, 0}, attrs[gtpaOTEI])
+
+	attrs = nlParseAttrs(gtpPDPAttrs(4, pdp, false))
+	require.Len(t, attrs, 3)
+
+	linkInfo := nlParseAttrs(nlParseAttrs(gtpNewLinkAttrs("gtp0", 9))[iflaLinkInfo])
+	require.Equal(t, []byte{'g', 't', 'p', 0}, linkInfo[iflaInfoKind])
+	require.Equal(t, []byte{9, 0, 0, 0}, nlParseAttrs(linkInfo[iflaInfoData])[iflaGTPFD1])
+
+	msg := nlMessage(rtmNewLink, nlFlagAck, 5, []byte{1, 2, 3, 4})
+	require.Equal(t, []byte{20, 0, 0, 0, rtmNewLink, 0, nlFlagRequest | nlFlagAck, 0, 5, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4}, msg)
+}
@@ -0,0 +1,186 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/binary"
+)
+
+// Netlink message and attribute layout (linux/netlink.h, linux/genetlink.h).
+const (
+	nlMsgHdrLen   = 16
+	nlAttrHdrLen  = 4
+	nlAttrNested  = 0x8000
+	genlMsgHdrLen = 4
+	ifInfoMsgLen  = 16
+
+	nlMsgError     = 0x2
+	nlFlagRequest  = 0x1
+	nlFlagAck      = 0x4
+	nlFlagExcl     = 0x200
+	nlFlagCreate   = 0x400
+	genlIDCtrl     = 0x10
+	genlCtrlGetFam = 3
+
+	genlCtrlAttrFamilyID   = 1
+	genlCtrlAttrFamilyName = 2
+)
+
+// rtnetlink link attributes (linux/if_link.h).
+const (
+	rtmNewLink = 16
+	rtmDelLink = 17
+
+	iflaIfName   = 3
+	iflaLinkInfo = 18
+	iflaInfoKind = 1
+	iflaInfoData = 2
+
+	iflaGTPFD1         = 2
+	iflaGTPPDPHashSize = 3
+	iflaGTPRole        = 4
+
+	gtpRoleGGSN = 0
+)
+
+// Generic netlink interface of the kernel gtp module (linux/gtp.h).
+const (
+	gtpGenlFamily = "gtp"
+
+	gtpCmdNewPDP = 0
+	gtpCmdDelPDP = 1
+
+	gtpaLink        = 1
+	gtpaVersion     = 2
+	gtpaPeerAddress = 4
+	gtpaMSAddress   = 5
+	gtpaITEI        = 8
+	gtpaOTEI        = 9
+
+	gtpVersion1 = 1
+)
+
+// nlEndian is the byte order of netlink headers and integer attributes on the hosts
+// running the kernel GTP datapath (x86-64, arm64).
+var nlEndian = binary.LittleEndian
+
+// nlAttr encodes a netlink attribute, padded to 4 bytes.
+func nlAttr(typ uint16, data []byte) []byte {
+	l := nlAttrHdrLen + len(data)
+	b := make([]byte, (l+3)&^3)
+	nlEndian.PutUint16(b[0:], uint16(l))
+	nlEndian.PutUint16(b[2:], typ)
+	copy(b[nlAttrHdrLen:], data)
+
+	return b
+}
+
+func nlAttrNest(typ uint16, attrs ...[]byte) []byte {
+	var data []byte
+	for _, a := range attrs {
+		data = append(data, a...)
+	}
+
+	return nlAttr(typ|nlAttrNested, data)
+}
+
+func nlAttrU32(typ uint16, v uint32) []byte {
+	b := make([]byte, 4)
+	nlEndian.PutUint32(b, v)
+
+	return nlAttr(typ, b)
+}
+
+// nlAttrBE32 encodes an attribute carried in network byte order, e.g. an IPv4 address.
+func nlAttrBE32(typ uint16, v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+
+	return nlAttr(typ, b)
+}
+
+func nlAttrString(typ uint16, s string) []byte {
+	return nlAttr(typ, append([]byte(s), 0))
+}
+
+// nlParseAttrs returns the attributes in b by type, ignoring the nested flag.
+func nlParseAttrs(b []byte) map[uint16][]byte {
+	attrs := make(map[uint16][]byte)
+
+	for len(b) >= nlAttrHdrLen {
+		l := int(nlEndian.Uint16(b[0:]))
+		if l < nlAttrHdrLen || l > len(b) {
+			break
+		}
+
+		attrs[nlEndian.Uint16(b[2:])&^nlAttrNested] = b[nlAttrHdrLen:l]
+
+		if l = (l + 3) &^ 3; l > len(b) {
+			break
+		}
+
+		b = b[l:]
+	}
+
+	return attrs
+}
+
+// nlMessage encodes a netlink message of the given type with the payload.
+func nlMessage(typ, flags uint16, seq uint32, payload ...[]byte) []byte {
+	b := make([]byte, nlMsgHdrLen)
+
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+
+	nlEndian.PutUint32(b[0:], uint32(len(b)))
+	nlEndian.PutUint16(b[4:], typ)
+	nlEndian.PutUint16(b[6:], flags|nlFlagRequest)
+	nlEndian.PutUint32(b[8:], seq)
+
+	return b
+}
+
+func genlHeader(cmd uint8) []byte {
+	return []byte{cmd, 0, 0, 0}
+}
+
+// ifInfoMsg encodes the header of rtnetlink link messages.
+func ifInfoMsg(index int32, flags, change uint32) []byte {
+	b := make([]byte, ifInfoMsgLen)
+	nlEndian.PutUint32(b[4:], uint32(index))
+	nlEndian.PutUint32(b[8:], flags)
+	nlEndian.PutUint32(b[12:], change)
+
+	return b
+}
+
+// gtpNewLinkAttrs describes a gtp link in the GGSN role, i.e. decapsulating the
+// tunnels of fd1 and encapsulating the traffic routed to the link.
+func gtpNewLinkAttrs(ifname string, fd1 int) []byte {
+	return append(nlAttrString(iflaIfName, ifname),
+		nlAttrNest(iflaLinkInfo,
+			nlAttrString(iflaInfoKind, "gtp"),
+			nlAttrNest(iflaInfoData,
+				nlAttrU32(iflaGTPFD1, uint32(fd1)),
+				nlAttrU32(iflaGTPPDPHashSize, gtpPDPHashSize),
+				nlAttrU32(iflaGTPRole, gtpRoleGGSN),
+			),
+		)...)
+}
+
+// gtpPDPAttrs describes the PDP context of pdp on the gtp link ifindex.
+// Only the link and the MS address identify the context on deletion.
+func gtpPDPAttrs(ifindex int, pdp gtpPDP, withTunnel bool) []byte {
+	b := append(nlAttrU32(gtpaLink, uint32(ifindex)), nlAttrU32(gtpaVersion, gtpVersion1)...)
+	b = append(b, nlAttrBE32(gtpaMSAddress, pdp.msAddress)...)
+
+	if withTunnel {
+		b = append(b, nlAttrBE32(gtpaPeerAddress, pdp.peer)...)
+		b = append(b, nlAttrU32(gtpaITEI, pdp.iTEI)...)
+		b = append(b, nlAttrU32(gtpaOTEI, pdp.oTEI)...)
+	}
+
+	return b
+}
@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// gtpLink is a gtp link of the kernel gtp module, created and programmed over netlink.
+type gtpLink struct {
+	ifname  string
+	ifindex int
+	family  uint16
+	// sock is the UDP socket of the GTP-U tunnels, owned by the link while it exists.
+	sock int
+	seq  uint32
+}
+
+// nlRequest sends a request on a new netlink socket of proto and returns the
+// payload of its reply, if any, once acknowledged.
+func (l *gtpLink) nlRequest(proto int, msg []byte) ([]byte, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd)
+
+	if err = unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	if err = unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	seq := nlEndian.Uint32(msg[8:])
+	buf := make([]byte, unix.Getpagesize())
+
+	var reply []byte
+
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range msgs {
+			if m.Header.Seq != seq {
+				continue
+			}
+
+			if m.Header.Type != nlMsgError {
+				reply = append([]byte{}, m.Data...)
+				continue
+			}
+
+			if len(m.Data) < 4 {
+				return nil, ErrInvalidArgumentWithReason("netlink error", len(m.Data), "truncated message")
+			}
+
+			if errno := int32(nlEndian.Uint32(m.Data)); errno != 0 {
+				return nil, syscall.Errno(-errno)
+			}
+
+			return reply, nil
+		}
+	}
+}
+
+func (l *gtpLink) nextSeq() uint32 {
+	return atomic.AddUint32(&l.seq, 1)
+}
+
+// openGTPLink creates the gtp link ifname, tunnelling GTP-U on addr.
+func openGTPLink(ifname string, addr net.IP) (*gtpLink, error) {
+	l := &gtpLink{ifname: ifname, sock: -1}
+
+	var err error
+
+	l.sock, err = unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, ErrOperationFailedWithReason("open GTP-U socket", err.Error())
+	}
+
+	sa := &unix.SockaddrInet4{Port: tunnelGTPUPort}
+	copy(sa.Addr[:], addr.To4())
+
+	if err = unix.Bind(l.sock, sa); err != nil {
+		l.close()
+		return nil, ErrOperationFailedWithReason("bind GTP-U socket", err.Error())
+	}
+
+	msg := nlMessage(rtmNewLink, nlFlagAck|nlFlagCreate|nlFlagExcl, l.nextSeq(),
+		ifInfoMsg(0, unix.IFF_UP, unix.IFF_UP), gtpNewLinkAttrs(ifname, l.sock))
+	if _, err = l.nlRequest(unix.NETLINK_ROUTE, msg); err != nil {
+		l.close()
+		return nil, ErrOperationFailedWithReason("create gtp link "+ifname, err.Error())
+	}
+
+	iface, err := net.InterfaceByName(ifname)
+	if err != nil {
+		l.close()
+		return nil, err
+	}
+
+	l.ifindex = iface.Index
+
+	msg = nlMessage(genlIDCtrl, nlFlagAck, l.nextSeq(),
+		genlHeader(genlCtrlGetFam), nlAttrString(genlCtrlAttrFamilyName, gtpGenlFamily))
+
+	reply, err := l.nlRequest(unix.NETLINK_GENERIC, msg)
+	if err != nil {
+		l.close()
+		return nil, ErrOperationFailedWithReason("resolve gtp netlink family", err.Error())
+	}
+
+	var id []byte
+	if len(reply) >= genlMsgHdrLen {
+		id = nlParseAttrs(reply[genlMsgHdrLen:])[genlCtrlAttrFamilyID]
+	}
+
+	if len(id) < 2 {
+		l.close()
+		return nil, ErrNotFound("gtp netlink family")
+	}
+
+	l.family = nlEndian.Uint16(id)
+
+	return l, nil
+}
+
+func (l *gtpLink) addPDP(pdp gtpPDP) error {
+	msg := nlMessage(l.family, nlFlagAck|nlFlagCreate|nlFlagExcl, l.nextSeq(),
+		genlHeader(gtpCmdNewPDP), gtpPDPAttrs(l.ifindex, pdp, true))
+
+	_, err := l.nlRequest(unix.NETLINK_GENERIC, msg)
+
+	return err
+}
+
+func (l *gtpLink) deletePDP(pdp gtpPDP) error {
+	msg := nlMessage(l.family, nlFlagAck, l.nextSeq(),
+		genlHeader(gtpCmdDelPDP), gtpPDPAttrs(l.ifindex, pdp, false))
+
+	_, err := l.nlRequest(unix.NETLINK_GENERIC, msg)
+	if err == unix.ENOENT {
+		return nil
+	}
+
+	return err
+}
+
+// close deletes the link, with its PDP contexts, and closes the GTP-U socket.
+func (l *gtpLink) close() error {
+	var err error
+
+	if l.ifindex != 0 {
+		msg := nlMessage(rtmDelLink, nlFlagAck, l.nextSeq(), ifInfoMsg(int32(l.ifindex), 0, 0))
+		_, err = l.nlRequest(unix.NETLINK_ROUTE, msg)
+		l.ifindex = 0
+	}
+
+	if l.sock >= 0 {
+		unix.Close(l.sock)
+		l.sock = -1
+	}
+
+	return err
+}
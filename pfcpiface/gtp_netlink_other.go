@@ -0,0 +1,31 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+//go:build !linux
+// +build !linux
+
+package pfcpiface
+
+import (
+	"net"
+	"runtime"
+)
+
+// gtpLink is a gtp link of the kernel gtp module, created and programmed over netlink.
+type gtpLink struct{}
+
+func openGTPLink(ifname string, addr net.IP) (*gtpLink, error) {
+	return nil, ErrUnsupported("kernel GTP on", runtime.GOOS)
+}
+
+func (l *gtpLink) addPDP(pdp gtpPDP) error {
+	return ErrUnsupported("kernel GTP on", runtime.GOOS)
+}
+
+func (l *gtpLink) deletePDP(pdp gtpPDP) error {
+	return ErrUnsupported("kernel GTP on", runtime.GOOS)
+}
+
+func (l *gtpLink) close() error {
+	return nil
+}
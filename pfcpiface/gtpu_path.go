@@ -0,0 +1,309 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// GTP-U message types and IEs used for path management (3GPP TS 29.281).
+const (
+	gtpuMessageTypeEchoRequest  = 1
+	gtpuMessageTypeEchoResponse = 2
+	gtpuIETypeRecovery          = 14
+
+	// gtpuFlagsWithSeq is version 1, protocol type GTP, sequence number present.
+	gtpuFlagsWithSeq = 0x32
+	gtpuHeaderLen    = 8
+)
+
+// gtpuPeer is a remote GTP-U endpoint, towards which at least one FAR tunnels traffic.
+type gtpuPeer struct {
+	ip      net.IP
+	dstIntf uint8
+}
+
+// gtpuPath tracks the liveness of the path towards one GTP-U peer.
+type gtpuPath struct {
+	gtpuPeer
+	up       bool
+	missed   uint8
+	pending  bool
+	seq      uint16
+	sentAt   time.Time
+	rtt      time.Duration
+	timeouts uint64
+}
+
+// gtpuPathStatus is a point-in-time view of a gtpuPath, exposed as metrics.
+type gtpuPathStatus struct {
+	peer     string
+	dstIntf  uint8
+	up       bool
+	rtt      time.Duration
+	timeouts uint64
+}
+
+type echoRequest struct {
+	peer net.IP
+	seq  uint16
+}
+
+// gtpuPathMonitor sends GTP-U Echo Requests to the active GTP-U peers every
+// interval. A peer not answering maxRetries consecutive requests is declared
+// down, and a gtpuPathEvent is raised when a path goes down or comes back up.
+type gtpuPathMonitor struct {
+	mu         sync.Mutex
+	conn       net.PacketConn
+	interval   time.Duration
+	maxRetries uint8
+	seq        uint16
+	paths      map[string]*gtpuPath
+	events     chan<- gtpuPathEvent
+}
+
+func newGTPUPathMonitor(interval time.Duration, maxRetries uint8, events chan<- gtpuPathEvent) *gtpuPathMonitor {
+	return &gtpuPathMonitor{
+		interval:   interval,
+		maxRetries: maxRetries,
+		paths:      make(map[string]*gtpuPath),
+		events:     events,
+	}
+}
+
+func (m *gtpuPathMonitor) raise(event gtpuPathEvent) {
+	select {
+	case m.events <- event:
+	default:
+		log.Warnln("Dropping", event, ": event queue full")
+	}
+}
+
+// probe updates the monitored paths to peers and accounts for the unanswered
+// requests of the previous round. Returns the Echo Requests to send.
+func (m *gtpuPathMonitor) probe(peers map[string]gtpuPeer, now time.Time) []echoRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.paths {
+		if _, ok := peers[key]; !ok {
+			delete(m.paths, key)
+		}
+	}
+
+	requests := make([]echoRequest, 0, len(peers))
+
+	for key, peer := range peers {
+		path, ok := m.paths[key]
+		if !ok {
+			path = &gtpuPath{gtpuPeer: peer, up: true}
+			m.paths[key] = path
+		}
+
+		if path.pending {
+			path.missed++
+			path.timeouts++
+
+			if path.up && path.missed >= m.maxRetries {
+				path.up = false
+				m.raise(gtpuPathEvent{peer: path.ip, dstIntf: path.dstIntf})
+			}
+		}
+
+		m.seq++
+		path.seq = m.seq
+		path.pending = true
+		path.sentAt = now
+
+		requests = append(requests, echoRequest{peer: path.ip, seq: path.seq})
+	}
+
+	return requests
+}
+
+// handleEchoResponse marks the path to peer as alive.
+func (m *gtpuPathMonitor) handleEchoResponse(peer net.IP, seq uint16, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path, ok := m.paths[peer.String()]
+	if !ok {
+		return
+	}
+
+	if path.pending && path.seq == seq {
+		path.rtt = now.Sub(path.sentAt)
+	}
+
+	path.pending = false
+	path.missed = 0
+
+	if !path.up {
+		path.up = true
+		m.raise(gtpuPathEvent{peer: path.ip, dstIntf: path.dstIntf, recovered: true})
+	}
+}
+
+// status returns the current state of all monitored paths.
+func (m *gtpuPathMonitor) status() []gtpuPathStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := make([]gtpuPathStatus, 0, len(m.paths))
+	for key, path := range m.paths {
+		status = append(status, gtpuPathStatus{
+			peer:     key,
+			dstIntf:  path.dstIntf,
+			up:       path.up,
+			rtt:      path.rtt,
+			timeouts: path.timeouts,
+		})
+	}
+
+	return status
+}
+
+func newEchoMessage(msgType uint8, seq uint16) []byte {
+	b := make([]byte, gtpuHeaderLen+4)
+	b[0] = gtpuFlagsWithSeq
+	b[1] = msgType
+	// Length covers the optional header fields, plus the Recovery IE of responses.
+	binary.BigEndian.PutUint16(b[2:4], 4)
+	binary.BigEndian.PutUint16(b[8:10], seq)
+
+	if msgType == gtpuMessageTypeEchoResponse {
+		b = append(b, gtpuIETypeRecovery, 0)
+		binary.BigEndian.PutUint16(b[2:4], 6)
+	}
+
+	return b
+}
+
+// parseEchoMessage returns the type and sequence number of a GTP-U Echo message.
+func parseEchoMessage(b []byte) (uint8, uint16, error) {
+	if len(b) < gtpuHeaderLen+4 || b[0]>>5 != 1 || b[0]&0x02 == 0 {
+		return 0, 0, ErrInvalidArgumentWithReason("GTP-U echo message", len(b), "malformed header")
+	}
+
+	switch b[1] {
+	case gtpuMessageTypeEchoRequest, gtpuMessageTypeEchoResponse:
+		return b[1], binary.BigEndian.Uint16(b[8:10]), nil
+	default:
+		return 0, 0, ErrUnsupported("GTP-U message type", b[1])
+	}
+}
+
+func (m *gtpuPathMonitor) listen() {
+	buf := make([]byte, 1024)
+
+	for {
+		n, rAddr, err := m.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			continue
+		}
+
+		udpAddr, ok := rAddr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+
+		msgType, seq, err := parseEchoMessage(buf[:n])
+		if err != nil {
+			log.Debugln("Ignoring GTP-U message from", rAddr, ":", err)
+			continue
+		}
+
+		if msgType == gtpuMessageTypeEchoRequest {
+			if _, err := m.conn.WriteTo(newEchoMessage(gtpuMessageTypeEchoResponse, seq), rAddr); err != nil {
+				log.Errorln("Failed to send GTP-U Echo Response to", rAddr, ":", err)
+			}
+
+			continue
+		}
+
+		m.handleEchoResponse(udpAddr.IP, seq, time.Now())
+	}
+}
+
+// run monitors the paths to the peers returned by activePeers until ctx is done. The
+// Echo Requests are sent from the GTP-U port of localIP, the address the peers tunnel
+// traffic to, so that they are answered on the path being monitored.
+func (m *gtpuPathMonitor) run(ctx context.Context, localIP net.IP, activePeers func() map[string]gtpuPeer) {
+	conn, err := net.ListenPacket("udp", net.JoinHostPort(localIP.String(), strconv.Itoa(tunnelGTPUPort)))
+	if err != nil {
+		log.Errorln("GTP-U path management disabled:", err)
+		return
+	}
+
+	m.conn = conn
+	defer m.conn.Close()
+
+	go m.listen()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infoln("Stopping GTP-U path management")
+			return
+		case now := <-ticker.C:
+			for _, r := range m.probe(activePeers(), now) {
+				dst := &net.UDPAddr{IP: r.peer, Port: tunnelGTPUPort}
+				if _, err := m.conn.WriteTo(newEchoMessage(gtpuMessageTypeEchoRequest, r.seq), dst); err != nil {
+					log.Errorln("Failed to send GTP-U Echo Request to", dst, ":", err)
+				}
+			}
+		}
+	}
+}
+
+// activeGTPUPeers returns the remote GTP-U peers of the forwarding FARs of all sessions.
+func (node *PFCPNode) activeGTPUPeers() map[string]gtpuPeer {
+	peers := make(map[string]gtpuPeer)
+
+	node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+
+		for _, session := range pConn.store.GetAllSessions() {
+			for _, f := range session.fars {
+				if !f.Forwards() || f.tunnelIP4Dst == 0 {
+					continue
+				}
+
+				ip := int2ip(f.tunnelIP4Dst)
+				peers[ip.String()] = gtpuPeer{ip: ip, dstIntf: f.dstIntf}
+			}
+		}
+
+		return true
+	})
+
+	return peers
+}
+
+func dstIntfName(dstIntf uint8) string {
+	switch dstIntf {
+	case ie.DstInterfaceAccess:
+		return "access"
+	case ie.DstInterfaceCore:
+		return "core"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func Test_gtpuPathMonitor(t *testing.T) {
+	events := make(chan gtpuPathEvent, 8)
+	m := newGTPUPathMonitor(time.Second, 2, events)
+
+	gnb := gtpuPeer{ip: net.ParseIP("198.18.0.1").To4(), dstIntf: ie.DstInterfaceAccess}
+	peers := map[string]gtpuPeer{gnb.ip.String(): gnb}
+	now := time.Now()
+
+	t.Run("answered requests keep the path up", func(t *testing.T) {
+		requests := m.probe(peers, now)
+		require.Len(t, requests, 1)
+
+		m.handleEchoResponse(gnb.ip, requests[0].seq, now.Add(10*time.Millisecond))
+
+		status := m.status()
+		require.Len(t, status, 1)
+		require.True(t, status[0].up)
+		require.Equal(t, 10*time.Millisecond, status[0].rtt)
+		require.Empty(t, events)
+	})
+
+	t.Run("path goes down after max retries", func(t *testing.T) {
+		m.probe(peers, now)
+		m.probe(peers, now)
+		require.Empty(t, events)
+
+		m.probe(peers, now)
+		require.Len(t, events, 1)
+
+		event := <-events
+		require.False(t, event.recovered)
+		require.True(t, event.peer.Equal(gnb.ip))
+
+		status := m.status()
+		require.False(t, status[0].up)
+		require.Equal(t, uint64(2), status[0].timeouts)
+	})
+
+	t.Run("path recovers on response", func(t *testing.T) {
+		m.handleEchoResponse(gnb.ip, 0, now)
+		require.Len(t, events, 1)
+		require.True(t, (<-events).recovered)
+	})
+
+	t.Run("inactive peers are forgotten", func(t *testing.T) {
+		require.Empty(t, m.probe(map[string]gtpuPeer{}, now))
+		require.Empty(t, m.status())
+	})
+}
+
+func Test_parseEchoMessage(t *testing.T) {
+	msgType, seq, err := parseEchoMessage(newEchoMessage(gtpuMessageTypeEchoRequest, 42))
+	require.NoError(t, err)
+	require.Equal(t, uint8(gtpuMessageTypeEchoRequest), msgType)
+	require.Equal(t, uint16(42), seq)
+
+	msgType, seq, err = parseEchoMessage(newEchoMessage(gtpuMessageTypeEchoResponse, 7))
+	require.NoError(t, err)
+	require.Equal(t, uint8(gtpuMessageTypeEchoResponse), msgType)
+	require.Equal(t, uint16(7), seq)
+
+	_, _, err = parseEchoMessage([]byte{0x32, gtpuMessageTypeEchoRequest})
+	require.Error(t, err)
+
+	gpdu := newEchoMessage(gtpuMessageTypeEchoRequest, 1)
+	gpdu[1] = gtpuMessageTypeGPDU
+	_, _, err = parseEchoMessage(gpdu)
+	require.Error(t, err)
+}
+
+func Test_gtpuPathMonitor_run(t *testing.T) {
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: tunnelGTPUPort})
+	require.NoError(t, err)
+
+	defer peer.Close()
+
+	m := newGTPUPathMonitor(50*time.Millisecond, 2, make(chan gtpuPathEvent, 10))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go m.run(ctx, net.IPv4(127, 0, 0, 1), func() map[string]gtpuPeer {
+		return map[string]gtpuPeer{"127.0.0.2": {ip: net.IPv4(127, 0, 0, 2), dstIntf: ie.DstInterfaceAccess}}
+	})
+
+	require.NoError(t, peer.SetReadDeadline(time.Now().Add(time.Second)))
+
+	buf := make([]byte, 1024)
+
+	n, addr, err := peer.ReadFrom(buf)
+	require.NoError(t, err)
+
+	msgType, _, err := parseEchoMessage(buf[:n])
+	require.NoError(t, err)
+	require.Equal(t, uint8(gtpuMessageTypeEchoRequest), msgType)
+	require.Equal(t, "127.0.0.1:2152", addr.String(), "Echo Requests are sent from the GTP-U port of the access IP")
+}
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// headerTypeHTTP is the HTTP Header Type of the Header Enrichment (3GPP TS 29.244,
+// clause 8.2.67).
+const headerTypeHTTP = 0
+
+var errHeaderEnrichmentDisabled = errors.New("header enrichment is not enabled")
+
+// enricher inserts headers into the uplink HTTP requests of the FARs with Header
+// Enrichment or an enriching Forwarding Policy. Their traffic is steered to an
+// enrichment proxy, which inserts the headers served at /v1/header-enrichment.
+type enricher struct {
+	proxy net.IP
+	// policies are the headers inserted for each Forwarding Policy Identifier.
+	policies map[string]string
+}
+
+func newEnricher(conf HeaderEnrichmentInfo) *enricher {
+	e := &enricher{
+		proxy:    net.ParseIP(conf.Proxy).To4(),
+		policies: make(map[string]string),
+	}
+
+	for id, headers := range conf.Policies {
+		names := make([]string, 0, len(headers))
+		for name := range headers {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		var b strings.Builder
+		for _, name := range names {
+			fmt.Fprintf(&b, "%s: %s\r\n", name, headers[name])
+		}
+
+		e.policies[id] = b.String()
+	}
+
+	return e
+}
+
+// farEnrichment is the tunnel of the uplink traffic of a FAR to the enrichment proxy,
+// with the FAR ID as TEID, and the headers the proxy inserts. The headers are HTTP
+// header lines, so that FARs remain comparable.
+type farEnrichment struct {
+	headers      string
+	tunnelIP4Src uint32
+	tunnelIP4Dst uint32
+}
+
+// Enriches reports whether headers are inserted into the uplink HTTP requests of the FAR.
+func (f *far) Enriches() bool {
+	return f.enrichment.tunnelIP4Dst != 0
+}
+
+// parseHeaderEnrichment parses the Header Enrichment and Forwarding Policy of the
+// Forwarding Parameters of a FAR. The headers of the Forwarding Policy, if configured,
+// come first. Forwarding Policies without headers are ignored.
+func (f *far) parseHeaderEnrichment(fwdIEs []*ie.IE, upf *upf) error {
+	var policyHeaders, headers string
+
+	for _, fwdIE := range fwdIEs {
+		switch fwdIE.Type {
+		case ie.ForwardingPolicy:
+			if upf.enrichment == nil {
+				continue
+			}
+
+			id, err := fwdIE.ForwardingPolicyIdentifier()
+			if err != nil {
+				return err
+			}
+
+			policyHeaders += upf.enrichment.policies[id]
+		case ie.HeaderEnrichment:
+			if upf.enrichment == nil {
+				return fmt.Errorf("%w: FAR %v has Header Enrichment", errHeaderEnrichmentDisabled, f.farID)
+			}
+
+			he, err := fwdIE.HeaderEnrichment()
+			if err != nil {
+				return err
+			}
+
+			if he.HeaderType != headerTypeHTTP {
+				return ErrUnsupported("Header Type", he.HeaderType)
+			}
+
+			headers += he.HeaderFieldName + ": " + he.HeaderFieldValue + "\r\n"
+		}
+	}
+
+	if policyHeaders == "" && headers == "" {
+		return nil
+	}
+
+	f.enrichment = farEnrichment{
+		headers:      policyHeaders + headers,
+		tunnelIP4Src: ip2int(upf.CoreIP),
+		tunnelIP4Dst: ip2int(upf.enrichment.proxy),
+	}
+
+	return nil
+}
+
+// enrichedFlow is the enrichment of the uplink HTTP requests of the UEs of a FAR.
+type enrichedFlow struct {
+	NodeID  string            `json:"node_id"`
+	FSEID   string            `json:"fseid"`
+	FARID   uint32            `json:"far_id"`
+	UEIPs   []string          `json:"ue_ips"`
+	Headers map[string]string `json:"headers"`
+}
+
+// enrichedFlows returns the enrichments of the FARs of session.
+func enrichedFlows(nodeID string, session PFCPSession) []enrichedFlow {
+	var flows []enrichedFlow
+
+	for _, f := range session.fars {
+		if !f.Enriches() {
+			continue
+		}
+
+		flow := enrichedFlow{
+			NodeID:  nodeID,
+			FSEID:   strconv.FormatUint(session.localSEID, 10),
+			FARID:   f.farID,
+			UEIPs:   []string{},
+			Headers: make(map[string]string),
+		}
+
+		for _, p := range session.pdrs {
+			if p.farID == f.farID && p.ueAddress != 0 {
+				flow.UEIPs = append(flow.UEIPs, int2ip(p.ueAddress).String())
+			}
+		}
+
+		for _, line := range strings.Split(strings.TrimSuffix(f.enrichment.headers, "\r\n"), "\r\n") {
+			if name, value, ok := cutHeader(line); ok {
+				flow.Headers[name] = value
+			}
+		}
+
+		flows = append(flows, flow)
+	}
+
+	return flows
+}
+
+func cutHeader(line string) (string, string, bool) {
+	i := strings.Index(line, ": ")
+	if i < 0 {
+		return "", "", false
+	}
+
+	return line[:i], line[i+2:], true
+}
+
+// headerEnrichmentHandler serves the enrichments of the FARs of all the sessions, for
+// the enrichment proxy to insert their headers into the requests of their UEs:
+//
+//	GET /v1/header-enrichment
+type headerEnrichmentHandler struct {
+	node *PFCPNode
+}
+
+func (h *headerEnrichmentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	flows := make([]enrichedFlow, 0)
+
+	h.node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+		for _, session := range pConn.store.GetAllSessions() {
+			flows = append(flows, enrichedFlows(pConn.nodeID.remote, session)...)
+		}
+
+		return true
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(flows); err != nil {
+		log.Errorln("Failed to encode header enrichment:", err)
+	}
+}
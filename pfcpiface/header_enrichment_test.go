@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func TestParseFAR_headerEnrichment(t *testing.T) {
+	mockUpf := &upf{
+		AccessIP: net.ParseIP("192.168.0.1"),
+		CoreIP:   net.ParseIP("10.0.10.1"),
+	}
+
+	enrichingFAR := func(dstIntf uint8, fwdIEs ...*ie.IE) *ie.IE {
+		return ie.NewCreateFAR(ie.NewFARID(1), ie.NewApplyAction(ActionForward),
+			ie.NewForwardingParameters(append([]*ie.IE{ie.NewDestinationInterface(dstIntf)}, fwdIEs...)...))
+	}
+	msisdn := ie.NewHeaderEnrichment(headerTypeHTTP, "X-MSISDN", "tok-1234")
+	policy := ie.NewForwardingPolicy("he-partner")
+
+	var f far
+	err := f.parseFAR(enrichingFAR(ie.DstInterfaceCore, msisdn), 1, mockUpf, create)
+	require.ErrorIs(t, err, errHeaderEnrichmentDisabled)
+	require.Equal(t, ie.CauseRuleCreationModificationFailure, ruleErrorCause(err))
+
+	f = far{}
+	require.NoError(t, f.parseFAR(enrichingFAR(ie.DstInterfaceCore, policy), 1, mockUpf, create),
+		"Forwarding Policies are ignored while disabled")
+	require.False(t, f.Enriches())
+
+	mockUpf.enrichment = newEnricher(HeaderEnrichmentInfo{
+		Proxy: "198.18.0.50",
+		Policies: map[string]map[string]string{
+			"he-partner": {"X-Partner": "acme", "X-Charging": "zero-rated"},
+		},
+	})
+
+	f = far{}
+	require.NoError(t, f.parseFAR(enrichingFAR(ie.DstInterfaceCore, msisdn, policy), 1, mockUpf, create))
+	require.True(t, f.Enriches())
+	require.Equal(t, farEnrichment{
+		headers:      "X-Charging: zero-rated\r\nX-Partner: acme\r\nX-MSISDN: tok-1234\r\n",
+		tunnelIP4Src: ip2int(net.ParseIP("10.0.10.1")),
+		tunnelIP4Dst: ip2int(net.ParseIP("198.18.0.50")),
+	}, f.enrichment, "headers of the policy come first")
+
+	f = far{}
+	require.NoError(t, f.parseFAR(enrichingFAR(ie.DstInterfaceCore, ie.NewForwardingPolicy("other")), 1, mockUpf, create))
+	require.False(t, f.Enriches(), "policies without headers do not enrich")
+
+	f = far{}
+	require.Error(t, f.parseFAR(enrichingFAR(ie.DstInterfaceAccess, msisdn), 1, mockUpf, create),
+		"downlink traffic is not enriched")
+
+	f = far{}
+	require.Error(t, f.parseFAR(enrichingFAR(ie.DstInterfaceCore, ie.NewHeaderEnrichment(1, "X-MSISDN", "tok")), 1, mockUpf, create),
+		"only HTTP headers are inserted")
+}
+
+func Test_enrichedFlows(t *testing.T) {
+	session := PFCPSession{
+		localSEID: 7,
+		PacketForwardingRules: PacketForwardingRules{
+			pdrs: []pdr{
+				{pdrID: 1, farID: 1, ueAddress: ip2int(net.ParseIP("10.250.0.1"))},
+				{pdrID: 2, farID: 2, ueAddress: ip2int(net.ParseIP("10.250.0.1"))},
+			},
+			fars: []far{
+				{farID: 1, enrichment: farEnrichment{headers: "X-MSISDN: tok-1234\r\n", tunnelIP4Dst: 1}},
+				{farID: 2},
+			},
+		},
+	}
+
+	require.Equal(t, []enrichedFlow{{
+		NodeID:  "smf",
+		FSEID:   "7",
+		FARID:   1,
+		UEIPs:   []string{"10.250.0.1"},
+		Headers: map[string]string{"X-MSISDN": "tok-1234"},
+	}}, enrichedFlows("smf", session))
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// hbFailurePurge shuts the connection down and purges the sessions of the CP node.
+	hbFailurePurge = "purge"
+	// hbFailureKeep keeps the sessions for a grace period, the CP node recovering its
+	// association with the same Recovery Time Stamp keeps them for good.
+	hbFailureKeep = "keep"
+	// hbFailureAlarm only raises an alarm, cleared when the CP node answers again.
+	hbFailureAlarm = "alarm"
+)
+
+// hbFailure applies the configured action to a CP node that stopped answering
+// heartbeats. It is owned by the heartbeat monitor of the connection.
+type hbFailure struct {
+	pConn  *PFCPConn
+	failed bool
+	// grace expires the sessions kept, nil unless the action is hbFailureKeep.
+	grace *time.Timer
+}
+
+// expired returns the channel fired at the end of the grace period, nil if none runs.
+func (f *hbFailure) expired() <-chan time.Time {
+	if f.grace == nil {
+		return nil
+	}
+
+	return f.grace.C
+}
+
+// fail handles a heartbeat left unanswered after all retransmissions. Returns whether
+// the connection must be shut down.
+func (f *hbFailure) fail() bool {
+	u := f.pConn.upf
+	if u.hbFailureAction == hbFailurePurge {
+		f.pConn.notifyWebhooks(webhookEvent{Event: webhookHeartbeatFailed})
+		return true
+	}
+
+	if f.failed {
+		return false
+	}
+
+	f.failed = true
+	f.pConn.assocLoss.lost(orphanHeartbeatFailure)
+	f.pConn.notifyWebhooks(webhookEvent{Event: webhookHeartbeatFailed})
+	f.pConn.SaveHeartbeatFailure(f.pConn.nodeID.remote, true)
+
+	if u.hbFailureAction == hbFailureKeep {
+		f.grace = time.NewTimer(u.hbFailureGracePeriod)
+
+		log.Warnln("CP node", f.pConn.RemoteAddr(), "stopped answering heartbeats, keeping its sessions for",
+			u.hbFailureGracePeriod)
+
+		return false
+	}
+
+	log.Errorln("CP node", f.pConn.RemoteAddr(), "stopped answering heartbeats")
+
+	return false
+}
+
+// recover handles a CP node heard from again. A CP node that restarted meanwhile
+// advertises a newer Recovery Time Stamp, its sessions being purged on reception.
+func (f *hbFailure) recover() {
+	if !f.failed {
+		return
+	}
+
+	log.Infoln("CP node", f.pConn.RemoteAddr(), "answers heartbeats again")
+
+	f.stop()
+}
+
+// stop clears the failure, if any.
+func (f *hbFailure) stop() {
+	if !f.failed {
+		return
+	}
+
+	if f.grace != nil {
+		f.grace.Stop()
+		f.grace = nil
+	}
+
+	f.failed = false
+	f.pConn.assocLoss.regained(orphanHeartbeatFailure)
+	f.pConn.SaveHeartbeatFailure(f.pConn.nodeID.remote, false)
+}
+
+// toleratesReadTimeout reports whether an idle connection is left to the heartbeat
+// failure action instead of being shut down.
+func (u *upf) toleratesReadTimeout() bool {
+	return u.enableHBTimer && u.hbFailureAction != hbFailurePurge
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/omec-project/upf-epc/pfcpiface/metrics"
+)
+
+type hbFailureMetrics struct {
+	metrics.InstrumentPFCP
+	failed bool
+}
+
+func (m *hbFailureMetrics) SaveHeartbeatFailure(nodeID string, failed bool) {
+	m.failed = failed
+}
+
+func newHBFailureConn(t *testing.T, action string, grace time.Duration) (*PFCPConn, *hbFailureMetrics) {
+	conn, err := net.Dial("udp", "127.0.0.1:8805")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	m := &hbFailureMetrics{}
+	u := &upf{enableHBTimer: true, hbFailureAction: action, hbFailureGracePeriod: grace}
+
+	return &PFCPConn{Conn: conn, upf: u, InstrumentPFCP: m}, m
+}
+
+func Test_hbFailure(t *testing.T) {
+	t.Run("purge shuts the connection down", func(t *testing.T) {
+		pConn, m := newHBFailureConn(t, hbFailurePurge, 0)
+		f := &hbFailure{pConn: pConn}
+
+		require.True(t, f.fail())
+		require.False(t, m.failed)
+		require.False(t, pConn.upf.toleratesReadTimeout())
+	})
+
+	t.Run("alarm is raised until the CP node answers", func(t *testing.T) {
+		pConn, m := newHBFailureConn(t, hbFailureAlarm, 0)
+		f := &hbFailure{pConn: pConn}
+
+		require.False(t, f.fail())
+		require.False(t, f.fail())
+		require.True(t, m.failed)
+		require.Nil(t, f.expired())
+		require.True(t, pConn.upf.toleratesReadTimeout())
+
+		f.recover()
+		require.False(t, m.failed)
+	})
+
+	t.Run("sessions are kept for the grace period", func(t *testing.T) {
+		pConn, m := newHBFailureConn(t, hbFailureKeep, 10*time.Millisecond)
+		f := &hbFailure{pConn: pConn}
+
+		require.False(t, f.fail())
+		require.True(t, m.failed)
+
+		select {
+		case <-f.expired():
+		case <-time.After(time.Second):
+			t.Fatal("grace period did not expire")
+		}
+	})
+
+	t.Run("recovery stops the grace period", func(t *testing.T) {
+		pConn, m := newHBFailureConn(t, hbFailureKeep, time.Minute)
+		f := &hbFailure{pConn: pConn}
+
+		require.False(t, f.fail())
+		f.recover()
+		require.False(t, m.failed)
+		require.Nil(t, f.expired())
+	})
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sessionActivity tracks when a session last forwarded packets.
+type sessionActivity struct {
+	// packets is the sum of the counters of the PDRs of the session when last read.
+	packets    uint64
+	lastActive time.Time
+	// reported is set once the inactivity is reported, until the traffic resumes.
+	reported bool
+}
+
+// inactivityTracker detects the sessions of a PFCP connection idle for longer than
+// their User Plane Inactivity Timer (3GPP TS 29.244, clause 5.11.3), from the datapath
+// counters of their PDRs.
+type inactivityTracker struct {
+	mu       sync.Mutex
+	sessions map[uint64]*sessionActivity
+}
+
+func newInactivityTracker() *inactivityTracker {
+	return &inactivityTracker{
+		sessions: make(map[uint64]*sessionActivity),
+	}
+}
+
+// forgetSession drops the activity of a deleted session, or restarts the timer of a
+// session whose User Plane Inactivity Timer was modified.
+func (t *inactivityTracker) forgetSession(seid uint64) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.sessions, seid)
+}
+
+// expired reports whether session has just been idle for its User Plane Inactivity
+// Timer. The inactivity is reported once, until packets are forwarded again.
+func (t *inactivityTracker) expired(session PFCPSession, counters map[pdrCounterKey]pdrCounters, now time.Time) bool {
+	var packets uint64
+
+	for _, p := range session.pdrs {
+		packets += counters[pdrCounterKey{fseID: session.localSEID, pdrID: p.pdrID}].packets
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a, ok := t.sessions[session.localSEID]
+	if !ok {
+		t.sessions[session.localSEID] = &sessionActivity{packets: packets, lastActive: now}
+		return false
+	}
+
+	if packets != a.packets {
+		a.packets, a.lastActive, a.reported = packets, now, false
+		return false
+	}
+
+	if a.reported || now.Sub(a.lastActive) < session.inactivityTimer {
+		return false
+	}
+
+	a.reported = true
+
+	return true
+}
+
+// checkInactivity reports the sessions idle for longer than their User Plane
+// Inactivity Timer to the CP, with a Session Report Request of type UPIR.
+func (pConn *PFCPConn) checkInactivity() {
+	var (
+		sessions []PFCPSession
+		pdrs     []pdr
+	)
+
+	for _, s := range pConn.store.GetAllSessions() {
+		if s.inactivityTimer > 0 {
+			sessions = append(sessions, s)
+			pdrs = append(pdrs, s.pdrs...)
+		}
+	}
+
+	if len(pdrs) == 0 {
+		return
+	}
+
+	counters, err := pConn.upf.ReadPDRCounters(pdrs)
+	if err != nil {
+		log.Debugln("Reading activity counters from datapath failed:", err)
+		return
+	}
+
+	now := time.Now()
+
+	for _, s := range sessions {
+		if !pConn.inactivity.expired(s, counters, now) {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"F-SEID": s.localSEID,
+			"timer":  s.inactivityTimer,
+		}).Info("Session inactive for its User Plane Inactivity Timer")
+
+		pConn.sendReleaseRequestReport(s)
+	}
+}
@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+type inactivityDatapath struct {
+	datapath
+	packets uint64
+}
+
+func (d *inactivityDatapath) ReadPDRCounters(pdrs []pdr) (map[pdrCounterKey]pdrCounters, error) {
+	counters := make(map[pdrCounterKey]pdrCounters)
+	for _, p := range pdrs {
+		counters[pdrCounterKey{fseID: p.fseID, pdrID: p.pdrID}] = pdrCounters{packets: d.packets}
+	}
+
+	return counters, nil
+}
+
+func Test_inactivityTracker(t *testing.T) {
+	tracker := newInactivityTracker()
+	session := PFCPSession{
+		localSEID:             1,
+		inactivityTimer:       time.Minute,
+		PacketForwardingRules: PacketForwardingRules{pdrs: []pdr{{fseID: 1, pdrID: 1}, {fseID: 1, pdrID: 2}}},
+	}
+
+	counters := func(packets uint64) map[pdrCounterKey]pdrCounters {
+		return map[pdrCounterKey]pdrCounters{
+			{fseID: 1, pdrID: 1}: {packets: packets},
+			{fseID: 1, pdrID: 2}: {packets: packets},
+		}
+	}
+
+	start := time.Now()
+
+	require.False(t, tracker.expired(session, counters(10), start))
+	require.False(t, tracker.expired(session, counters(10), start.Add(59*time.Second)))
+	require.True(t, tracker.expired(session, counters(10), start.Add(time.Minute)))
+	require.False(t, tracker.expired(session, counters(10), start.Add(2*time.Minute)), "reported once")
+
+	// Traffic resuming rearms the timer.
+	require.False(t, tracker.expired(session, counters(11), start.Add(3*time.Minute)))
+	require.False(t, tracker.expired(session, counters(11), start.Add(3*time.Minute+59*time.Second)))
+	require.True(t, tracker.expired(session, counters(11), start.Add(4*time.Minute)))
+
+	// A modified timer restarts.
+	tracker.forgetSession(1)
+	require.False(t, tracker.expired(session, counters(11), start.Add(5*time.Minute)))
+	require.False(t, tracker.expired(session, counters(11), start.Add(5*time.Minute+59*time.Second)))
+}
+
+func TestPFCPConn_checkInactivity(t *testing.T) {
+	cp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { cp.Close() })
+
+	conn, err := net.Dial("udp", cp.LocalAddr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	pConn := &PFCPConn{
+		Conn:           conn,
+		upf:            &upf{datapath: &inactivityDatapath{packets: 5}},
+		store:          NewInMemoryStore(),
+		inactivity:     newInactivityTracker(),
+		InstrumentPFCP: &asyncWriteMetrics{},
+	}
+
+	for _, session := range []PFCPSession{
+		{
+			localSEID:             1,
+			remoteSEID:            10,
+			inactivityTimer:       time.Second,
+			PacketForwardingRules: PacketForwardingRules{pdrs: []pdr{{fseID: 1, pdrID: 1}}},
+		},
+		{
+			localSEID:             2,
+			remoteSEID:            20,
+			PacketForwardingRules: PacketForwardingRules{pdrs: []pdr{{fseID: 2, pdrID: 1}}},
+		},
+	} {
+		require.NoError(t, pConn.store.PutSession(session, nil, false, 0))
+	}
+
+	pConn.checkInactivity()
+
+	// The session is idle from the first reading.
+	pConn.inactivity.sessions[1].lastActive = time.Now().Add(-time.Minute)
+
+	pConn.checkInactivity()
+
+	require.NoError(t, cp.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	buf := make([]byte, 1500)
+	n, err := cp.Read(buf)
+	require.NoError(t, err)
+
+	msg, err := message.Parse(buf[:n])
+	require.NoError(t, err)
+
+	srreq, ok := msg.(*message.SessionReportRequest)
+	require.True(t, ok)
+	require.Equal(t, uint64(10), srreq.SEID())
+	require.True(t, srreq.ReportType.HasUPIR())
+
+	require.NotContains(t, pConn.inactivity.sessions, uint64(2), "session without timer")
+}
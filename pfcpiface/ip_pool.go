@@ -4,19 +4,24 @@
 package pfcpiface
 
 import (
+	"encoding/binary"
 	"fmt"
 	"net"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type IPPool struct {
 	mu       sync.Mutex
+	subnet   *net.IPNet
 	freePool []net.IP
 	// inventory keeps track of allocated sessions and their IPs.
 	inventory map[uint64]net.IP
+	// reserved are the IPs taken out of the pool by operators.
+	reserved map[string]net.IP
 }
 
 // NewIPPool creates a new pool of IP addresses with the given subnet.
@@ -28,7 +33,9 @@ func NewIPPool(poolSubnet string) (*IPPool, error) {
 	}
 
 	i := &IPPool{
+		subnet:    ipnet,
 		inventory: make(map[uint64]net.IP),
+		reserved:  make(map[string]net.IP),
 	}
 
 	for ip := ip.Mask(ipnet.Mask); ipnet.Contains(ip); inc(ip) {
@@ -106,3 +113,535 @@ func (i *IPPool) String() string {
 
 	return sb.String()
 }
+
+// lookupIP returns the IP allocated to the session, if any.
+func (i *IPPool) lookupIP(seid uint64) (net.IP, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	ip, found := i.inventory[seid]
+	if !found {
+		return nil, false
+	}
+
+	ipVal := make(net.IP, len(ip))
+	copy(ipVal, ip)
+
+	return ipVal, true
+}
+
+// ueIPv6PrefixLen is the length of the IPv6 prefixes allocated to UEs.
+const ueIPv6PrefixLen = 64
+
+// IPv6Pool allocates /64 IPv6 prefixes to sessions. Prefixes are handed out in order
+// and reused once released, so that large pools need not be enumerated.
+type IPv6Pool struct {
+	mu     sync.Mutex
+	subnet *net.IPNet
+	// base is the upper half of the pool prefix.
+	base uint64
+	size uint64
+	next uint64
+	free []uint64
+	// inventory keeps track of allocated sessions and their prefix indexes.
+	inventory map[uint64]uint64
+}
+
+// NewIPv6Pool creates a new pool of the /64 prefixes of the given IPv6 subnet.
+func NewIPv6Pool(poolSubnet string) (*IPv6Pool, error) {
+	_, ipnet, err := net.ParseCIDR(poolSubnet)
+	if err != nil {
+		return nil, err
+	}
+
+	ones, bits := ipnet.Mask.Size()
+	if bits != net.IPv6len*8 || ipnet.IP.To4() != nil {
+		return nil, ErrInvalidArgumentWithReason("NewIPv6Pool", poolSubnet, "pool subnet is not IPv6")
+	}
+
+	if ones == 0 || ones > ueIPv6PrefixLen {
+		return nil, ErrInvalidArgumentWithReason("NewIPv6Pool", poolSubnet, "pool prefix must be between /1 and /64")
+	}
+
+	return &IPv6Pool{
+		subnet:    ipnet,
+		base:      binary.BigEndian.Uint64(ipnet.IP[:8]),
+		size:      1 << (ueIPv6PrefixLen - ones),
+		inventory: make(map[uint64]uint64),
+	}, nil
+}
+
+func (i *IPv6Pool) prefix(index uint64) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	binary.BigEndian.PutUint64(ip[:8], i.base|index)
+
+	return ip
+}
+
+// lookupIP returns the prefix allocated to the session, if any.
+func (i *IPv6Pool) lookupIP(seid uint64) (net.IP, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	index, found := i.inventory[seid]
+	if !found {
+		return nil, false
+	}
+
+	return i.prefix(index), true
+}
+
+func (i *IPv6Pool) LookupOrAllocIP(seid uint64) (net.IP, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if index, found := i.inventory[seid]; found {
+		return i.prefix(index), nil
+	}
+
+	var index uint64
+
+	switch {
+	case len(i.free) > 0:
+		index = i.free[0]
+		i.free = i.free[1:]
+	case i.next < i.size:
+		index = i.next
+		i.next++
+	default:
+		return nil, ErrOperationFailedWithReason("IPv6 prefix allocation", "ip pool empty")
+	}
+
+	i.inventory[seid] = index
+	log.Traceln("Allocated new session", seid, "IPv6 prefix", i.prefix(index))
+
+	return i.prefix(index), nil
+}
+
+func (i *IPv6Pool) DeallocIP(seid uint64) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	index, ok := i.inventory[seid]
+	if !ok {
+		return ErrInvalidArgumentWithReason("seid", seid, "can't dealloc non-existent session")
+	}
+
+	delete(i.inventory, seid)
+	i.free = append(i.free, index)
+	log.Traceln("Deallocated session ", seid, "IPv6 prefix", i.prefix(index))
+
+	return nil
+}
+
+// inUse returns whether prefixes of the pool are allocated.
+func (i *IPv6Pool) inUse() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return len(i.inventory) > 0
+}
+
+func (i *IPv6Pool) String() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return fmt.Sprintf("allocated IPv6 prefixes: %d, free: %d", len(i.inventory), i.size-uint64(len(i.inventory)))
+}
+
+// IPPools are the UE IP pools, each serving the sessions of a DNN. The default pool,
+// of the empty DNN, serves the sessions of DNNs without a pool of their own.
+type IPPools struct {
+	// poolsLock guards the pools, replaced when reloaded.
+	poolsLock sync.RWMutex
+	pools     map[string]*IPPool
+	pools6    map[string]*IPv6Pool
+	// slices are the slices the pools are bound to, keyed by DNN.
+	slices map[string]string
+
+	// journal records the allocations if they persist across restarts.
+	journal *ipAllocJournal
+	// restored are the sessions of the allocations restored from the journal.
+	restored     map[uint64]struct{}
+	restoredLock sync.Mutex
+
+	// leases are the last times the allocations of each session were seen in use.
+	leases     map[uint64]time.Time
+	leasesLock sync.Mutex
+}
+
+// NewIPPools creates the default pools of defaultSubnet and defaultSubnet6, if set, and
+// the pools of each DNN.
+func NewIPPools(defaultSubnet, defaultSubnet6 string, dnnPools []UEIPPoolInfo) (*IPPools, error) {
+	p := &IPPools{}
+	if err := p.setPools(defaultSubnet, defaultSubnet6, dnnPools); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// setPools creates the pools of the given subnets. The current pools of unchanged
+// subnets are kept, with their allocations.
+func (p *IPPools) setPools(defaultSubnet, defaultSubnet6 string, dnnPools []UEIPPoolInfo) error {
+	pools := make(map[string]*IPPool)
+	pools6 := make(map[string]*IPv6Pool)
+	slices := make(map[string]string)
+
+	newPool := func(dnn, subnet string) error {
+		if pool, ok := p.pools[dnn]; ok && sameSubnet(pool.subnet, subnet) {
+			pools[dnn] = pool
+			return nil
+		}
+
+		pool, err := NewIPPool(subnet)
+		if err != nil {
+			return err
+		}
+
+		pools[dnn] = pool
+
+		return nil
+	}
+
+	newPool6 := func(dnn, subnet string) error {
+		if pool, ok := p.pools6[dnn]; ok && sameSubnet(pool.subnet, subnet) {
+			pools6[dnn] = pool
+			return nil
+		}
+
+		pool, err := NewIPv6Pool(subnet)
+		if err != nil {
+			return err
+		}
+
+		pools6[dnn] = pool
+
+		return nil
+	}
+
+	if defaultSubnet != "" {
+		if err := newPool("", defaultSubnet); err != nil {
+			return err
+		}
+	}
+
+	if defaultSubnet6 != "" {
+		if err := newPool6("", defaultSubnet6); err != nil {
+			return err
+		}
+	}
+
+	for _, info := range dnnPools {
+		if _, ok := pools[info.Dnn]; ok {
+			return ErrInvalidArgumentWithReason("NewIPPools", info.Dnn, "duplicate pool for DNN")
+		}
+
+		if err := newPool(info.Dnn, info.Pool); err != nil {
+			return err
+		}
+
+		slices[info.Dnn] = info.Slice
+
+		if info.IPv6Pool != "" {
+			if err := newPool6(info.Dnn, info.IPv6Pool); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The allocations of replaced pools would be lost.
+	for dnn, pool := range p.pools {
+		if pools[dnn] != pool && pool.inUse() {
+			return ErrInvalidOperation(fmt.Sprintf("replace UE IP pool %v of DNN %q in use", pool.subnet, dnn))
+		}
+	}
+
+	for dnn, pool := range p.pools6 {
+		if pools6[dnn] != pool && pool.inUse() {
+			return ErrInvalidOperation(fmt.Sprintf("replace UE IPv6 pool %v of DNN %q in use", pool.subnet, dnn))
+		}
+	}
+
+	p.pools, p.pools6, p.slices = pools, pools6, slices
+
+	return nil
+}
+
+// reload replaces the pools with those of the given subnets. Only unused pools may be
+// removed or change subnet.
+func (p *IPPools) reload(defaultSubnet, defaultSubnet6 string, dnnPools []UEIPPoolInfo) error {
+	p.poolsLock.Lock()
+	defer p.poolsLock.Unlock()
+
+	return p.setPools(defaultSubnet, defaultSubnet6, dnnPools)
+}
+
+func sameSubnet(subnet *net.IPNet, cidr string) bool {
+	_, ipnet, err := net.ParseCIDR(cidr)
+
+	return err == nil && ipnet.String() == subnet.String()
+}
+
+// LookupOrAllocIP returns the IP already allocated to the session, or allocates one
+// from the pool of the DNN.
+func (p *IPPools) LookupOrAllocIP(dnn string, seid uint64) (net.IP, error) {
+	p.poolsLock.RLock()
+	defer p.poolsLock.RUnlock()
+
+	for _, pool := range p.pools {
+		if ip, found := pool.lookupIP(seid); found {
+			p.renewLease(seid, time.Now())
+			return ip, nil
+		}
+	}
+
+	pool, ok := p.pools[dnn]
+	if !ok {
+		pool, ok = p.pools[""]
+		if !ok {
+			return nil, ErrNotFoundWithParam("UE IP pool", "DNN", dnn)
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"F-SEID": seid,
+		"DNN":    dnn,
+		"slice":  p.slices[dnn],
+	}).Trace("Allocating UE IP")
+
+	ip, err := pool.LookupOrAllocIP(seid)
+	if err != nil {
+		return nil, err
+	}
+
+	p.renewLease(seid, time.Now())
+
+	if p.journal != nil {
+		p.journal.recordAlloc(seid, ip)
+	}
+
+	return ip, nil
+}
+
+// LookupOrAllocIP6 returns the IPv6 prefix already allocated to the session, or
+// allocates one from the IPv6 pool of the DNN.
+func (p *IPPools) LookupOrAllocIP6(dnn string, seid uint64) (net.IP, error) {
+	p.poolsLock.RLock()
+	defer p.poolsLock.RUnlock()
+
+	for _, pool := range p.pools6 {
+		if ip, found := pool.lookupIP(seid); found {
+			p.renewLease(seid, time.Now())
+			return ip, nil
+		}
+	}
+
+	pool, ok := p.pools6[dnn]
+	if !ok {
+		pool, ok = p.pools6[""]
+		if !ok {
+			return nil, ErrNotFoundWithParam("UE IPv6 pool", "DNN", dnn)
+		}
+	}
+
+	ip, err := pool.LookupOrAllocIP(seid)
+	if err != nil {
+		return nil, err
+	}
+
+	p.renewLease(seid, time.Now())
+
+	if p.journal != nil {
+		p.journal.recordAlloc(seid, ip)
+	}
+
+	return ip, nil
+}
+
+// DeallocIP releases the IPv4 address and IPv6 prefix allocated to the session, from
+// whichever pools they came.
+func (p *IPPools) DeallocIP(seid uint64) error {
+	p.poolsLock.RLock()
+	defer p.poolsLock.RUnlock()
+
+	return p.deallocIP(seid)
+}
+
+func (p *IPPools) deallocIP(seid uint64) error {
+	var released bool
+
+	for _, pool := range p.pools {
+		if _, found := pool.lookupIP(seid); found {
+			if err := pool.DeallocIP(seid); err != nil {
+				return err
+			}
+
+			released = true
+
+			break
+		}
+	}
+
+	for _, pool := range p.pools6 {
+		if _, found := pool.lookupIP(seid); found {
+			if err := pool.DeallocIP(seid); err != nil {
+				return err
+			}
+
+			released = true
+
+			break
+		}
+	}
+
+	if !released {
+		log.Warnln("Attempt to dealloc non-existent session", seid)
+		return ErrInvalidArgumentWithReason("seid", seid, "can't dealloc non-existent session")
+	}
+
+	p.dropLease(seid)
+
+	if p.journal != nil {
+		p.journal.recordRelease(seid)
+
+		p.restoredLock.Lock()
+		delete(p.restored, seid)
+		p.restoredLock.Unlock()
+	}
+
+	return nil
+}
+
+func (p *IPPools) String() string {
+	p.poolsLock.RLock()
+	defer p.poolsLock.RUnlock()
+
+	sb := strings.Builder{}
+
+	for dnn, pool := range p.pools {
+		sb.WriteString(fmt.Sprintf("{DNN %q: %v} ", dnn, pool))
+	}
+
+	for dnn, pool := range p.pools6 {
+		sb.WriteString(fmt.Sprintf("{DNN %q IPv6: %v} ", dnn, pool))
+	}
+
+	return sb.String()
+}
+
+// reserveIP takes a free IP out of the pool, so that it is not allocated to sessions.
+func (i *IPPool) reserveIP(ip net.IP) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, ok := i.reserved[ip.String()]; ok {
+		return nil
+	}
+
+	for seid, allocated := range i.inventory {
+		if allocated.Equal(ip) {
+			return ErrInvalidOperation(fmt.Sprintf("reserve %v allocated to F-SEID %d", ip, seid))
+		}
+	}
+
+	for idx, free := range i.freePool {
+		if free.Equal(ip) {
+			i.freePool = append(i.freePool[:idx], i.freePool[idx+1:]...)
+			i.reserved[ip.String()] = free
+
+			return nil
+		}
+	}
+
+	return ErrInvalidArgumentWithReason("ip", ip, "not a UE IP of the pool")
+}
+
+// unreserveIP returns a reserved IP to the pool.
+func (i *IPPool) unreserveIP(ip net.IP) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	reserved, ok := i.reserved[ip.String()]
+	if !ok {
+		return false
+	}
+
+	delete(i.reserved, ip.String())
+	i.freePool = append(i.freePool, reserved)
+
+	return true
+}
+
+// inUse returns whether IPs of the pool are allocated or reserved.
+func (i *IPPool) inUse() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return len(i.inventory) > 0 || len(i.reserved) > 0
+}
+
+// sessionOf returns the session the IP is allocated to, if any.
+func (i *IPPool) sessionOf(ip net.IP) (uint64, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for seid, allocated := range i.inventory {
+		if allocated.Equal(ip) {
+			return seid, true
+		}
+	}
+
+	return 0, false
+}
+
+// reserveIP takes a free IPv4 address out of its pool, so that it is not allocated to
+// sessions.
+func (p *IPPools) reserveIP(ip net.IP) error {
+	p.poolsLock.RLock()
+	defer p.poolsLock.RUnlock()
+
+	pool := p.poolOf(ip)
+	if pool == nil {
+		return ErrInvalidArgumentWithReason("ip", ip, "outside of the UE IP pools")
+	}
+
+	if err := pool.reserveIP(ip.To4()); err != nil {
+		return err
+	}
+
+	if p.journal != nil {
+		p.journal.recordReserve(ip)
+	}
+
+	return nil
+}
+
+// releaseIP returns an IPv4 address to its pool, whether reserved or allocated to a
+// session. The UE IPs of the session are all released, e.g. if it leaked.
+func (p *IPPools) releaseIP(ip net.IP) error {
+	p.poolsLock.RLock()
+	defer p.poolsLock.RUnlock()
+
+	pool := p.poolOf(ip)
+	if pool == nil {
+		return ErrInvalidArgumentWithReason("ip", ip, "outside of the UE IP pools")
+	}
+
+	if pool.unreserveIP(ip.To4()) {
+		if p.journal != nil {
+			p.journal.recordUnreserve(ip)
+		}
+
+		return nil
+	}
+
+	seid, ok := pool.sessionOf(ip.To4())
+	if !ok {
+		return ErrNotFoundWithParam("UE IP allocation", "ip", ip)
+	}
+
+	log.Warnln("Releasing UE IPs of F-SEID", seid, "on request")
+
+	return p.deallocIP(seid)
+}
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ipAllocation is a UE IP allocated to a session.
+type ipAllocation struct {
+	FSEID uint64 `json:"fseid"`
+	IP    string `json:"ip"`
+}
+
+// ipPoolStatus is the utilization of a UE IP pool.
+type ipPoolStatus struct {
+	DNN         string         `json:"dnn"`
+	Slice       string         `json:"slice,omitempty"`
+	Subnet      string         `json:"subnet"`
+	Size        uint64         `json:"size"`
+	Free        uint64         `json:"free"`
+	Utilization float64        `json:"utilization"`
+	Reserved    []string       `json:"reserved,omitempty"`
+	Allocations []ipAllocation `json:"allocations"`
+}
+
+// ipPoolsStatus is the body of GET /v1/ippool.
+type ipPoolsStatus struct {
+	Pools     []ipPoolStatus `json:"pools"`
+	IPv6Pools []ipPoolStatus `json:"ipv6_pools"`
+}
+
+// ipPoolRequest is the body of POST /v1/ippool.
+type ipPoolRequest struct {
+	Action string   `json:"action"`
+	IPs    []string `json:"ips"`
+}
+
+func (s *ipPoolStatus) setUtilization() {
+	if s.Size > 0 {
+		s.Utilization = float64(s.Size-s.Free) / float64(s.Size)
+	}
+
+	sort.Slice(s.Allocations, func(i, j int) bool { return s.Allocations[i].FSEID < s.Allocations[j].FSEID })
+	sort.Strings(s.Reserved)
+}
+
+func (i *IPPool) status() ipPoolStatus {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	status := ipPoolStatus{
+		Subnet:      i.subnet.String(),
+		Size:        uint64(len(i.freePool) + len(i.inventory) + len(i.reserved)),
+		Free:        uint64(len(i.freePool)),
+		Allocations: make([]ipAllocation, 0, len(i.inventory)),
+	}
+
+	for seid, ip := range i.inventory {
+		status.Allocations = append(status.Allocations, ipAllocation{FSEID: seid, IP: ip.String()})
+	}
+
+	for ip := range i.reserved {
+		status.Reserved = append(status.Reserved, ip)
+	}
+
+	status.setUtilization()
+
+	return status
+}
+
+func (i *IPv6Pool) status() ipPoolStatus {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	status := ipPoolStatus{
+		Subnet:      i.subnet.String(),
+		Size:        i.size,
+		Free:        i.size - uint64(len(i.inventory)),
+		Allocations: make([]ipAllocation, 0, len(i.inventory)),
+	}
+
+	for seid, index := range i.inventory {
+		status.Allocations = append(status.Allocations, ipAllocation{FSEID: seid, IP: i.prefix(index).String()})
+	}
+
+	status.setUtilization()
+
+	return status
+}
+
+// status returns the utilization of the pools, sorted by DNN.
+func (p *IPPools) status() ipPoolsStatus {
+	p.poolsLock.RLock()
+	defer p.poolsLock.RUnlock()
+
+	status := ipPoolsStatus{
+		Pools:     make([]ipPoolStatus, 0, len(p.pools)),
+		IPv6Pools: make([]ipPoolStatus, 0, len(p.pools6)),
+	}
+
+	for dnn, pool := range p.pools {
+		s := pool.status()
+		s.DNN, s.Slice = dnn, p.slices[dnn]
+		status.Pools = append(status.Pools, s)
+	}
+
+	for dnn, pool := range p.pools6 {
+		s := pool.status()
+		s.DNN, s.Slice = dnn, p.slices[dnn]
+		status.IPv6Pools = append(status.IPv6Pools, s)
+	}
+
+	sort.Slice(status.Pools, func(i, j int) bool { return status.Pools[i].DNN < status.Pools[j].DNN })
+	sort.Slice(status.IPv6Pools, func(i, j int) bool { return status.IPv6Pools[i].DNN < status.IPv6Pools[j].DNN })
+
+	return status
+}
+
+// ipPoolHandler reports the utilization of the UE IP pools and lets operators take
+// addresses out of them:
+//
+//	GET  /v1/ippool  reports the size, free count and allocations of each pool
+//	POST /v1/ippool  reserves or releases IPv4 addresses
+type ipPoolHandler struct {
+	upf *upf
+}
+
+func (h *ipPoolHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pools := h.upf.ippools
+	if pools == nil {
+		msg := "UE IP allocation is disabled"
+		if h.upf.ipam != nil {
+			msg = "UE IPs are allocated by an external IPAM"
+		}
+
+		http.Error(w, msg, http.StatusNotFound)
+
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(pools.status()); err != nil {
+			log.Errorln("Failed to encode UE IP pools:", err)
+		}
+	case http.MethodPost:
+		h.update(w, r, pools)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// update reserves or releases the addresses of the request in order, stopping at the
+// first failure.
+func (h *ipPoolHandler) update(w http.ResponseWriter, r *http.Request, pools *IPPools) {
+	var req ipPoolRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid UE IP pool request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var apply func(net.IP) error
+
+	switch req.Action {
+	case "reserve":
+		apply = pools.reserveIP
+	case "release":
+		apply = pools.releaseIP
+	default:
+		http.Error(w, "action must be reserve or release", http.StatusBadRequest)
+		return
+	}
+
+	ips := make([]net.IP, 0, len(req.IPs))
+
+	for _, s := range req.IPs {
+		ip := net.ParseIP(s)
+		if ip == nil || ip.To4() == nil {
+			http.Error(w, "invalid IPv4 address "+s, http.StatusBadRequest)
+			return
+		}
+
+		ips = append(ips, ip)
+	}
+
+	for _, ip := range ips {
+		log.WithFields(log.Fields{
+			"action": req.Action,
+			"ip":     ip,
+		}).Info("Handling UE IP pool request")
+
+		err := apply(ip)
+
+		switch {
+		case err == nil:
+			continue
+		case errors.Is(err, errInvalidArgument):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, errNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, errInvalidOperation):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ipPoolHandler(t *testing.T) {
+	u := &upf{}
+
+	mux := http.NewServeMux()
+	setupConfigHandler(mux, u)
+
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, "/v1/ippool", strings.NewReader(body)))
+
+		return rec
+	}
+
+	require.Equal(t, http.StatusNotFound, serve(http.MethodGet, "").Code)
+
+	var err error
+	u.ippools, err = NewIPPools("10.0.0.0/29", "2001:db8::/62", []UEIPPoolInfo{
+		{Dnn: "ims", Pool: "10.1.0.0/30", Slice: "slice1"},
+	})
+	require.NoError(t, err)
+
+	_, err = u.ippools.LookupOrAllocIP("", 1)
+	require.NoError(t, err)
+	_, err = u.ippools.LookupOrAllocIP6("", 1)
+	require.NoError(t, err)
+
+	status := func() ipPoolsStatus {
+		rec := serve(http.MethodGet, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var status ipPoolsStatus
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+
+		return status
+	}
+
+	require.Equal(t, ipPoolsStatus{
+		Pools: []ipPoolStatus{
+			{
+				Subnet: "10.0.0.0/29", Size: 6, Free: 5, Utilization: 1.0 / 6,
+				Allocations: []ipAllocation{{FSEID: 1, IP: "10.0.0.1"}},
+			},
+			{DNN: "ims", Slice: "slice1", Subnet: "10.1.0.0/30", Size: 2, Free: 2, Allocations: []ipAllocation{}},
+		},
+		IPv6Pools: []ipPoolStatus{
+			{
+				Subnet: "2001:db8::/62", Size: 4, Free: 3, Utilization: 0.25,
+				Allocations: []ipAllocation{{FSEID: 1, IP: "2001:db8::"}},
+			},
+		},
+	}, status())
+
+	t.Run("reserve", func(t *testing.T) {
+		rec := serve(http.MethodPost, `{"action": "reserve", "ips": ["10.0.0.2", "10.1.0.1"]}`)
+		require.Equal(t, http.StatusNoContent, rec.Code)
+
+		pools := status().Pools
+		require.Equal(t, []string{"10.0.0.2"}, pools[0].Reserved)
+		require.Equal(t, uint64(4), pools[0].Free)
+		require.Equal(t, []string{"10.1.0.1"}, pools[1].Reserved)
+
+		ip, err := u.ippools.LookupOrAllocIP("ims", 2)
+		require.NoError(t, err)
+		require.Equal(t, "10.1.0.2", ip.String())
+
+		_, err = u.ippools.LookupOrAllocIP("ims", 3)
+		require.Error(t, err)
+
+		require.Equal(t, http.StatusConflict, serve(http.MethodPost, `{"action": "reserve", "ips": ["10.0.0.1"]}`).Code)
+		require.Equal(t, http.StatusBadRequest, serve(http.MethodPost, `{"action": "reserve", "ips": ["10.0.0.7"]}`).Code)
+		require.Equal(t, http.StatusBadRequest, serve(http.MethodPost, `{"action": "reserve", "ips": ["10.2.0.1"]}`).Code)
+		require.Equal(t, http.StatusBadRequest, serve(http.MethodPost, `{"action": "reserve", "ips": ["2001:db8::"]}`).Code)
+	})
+
+	t.Run("release", func(t *testing.T) {
+		require.Equal(t, http.StatusNoContent, serve(http.MethodPost, `{"action": "release", "ips": ["10.0.0.2", "10.0.0.1"]}`).Code)
+
+		status := status()
+		require.Empty(t, status.Pools[0].Reserved)
+		require.Empty(t, status.Pools[0].Allocations)
+		require.Empty(t, status.IPv6Pools[0].Allocations)
+
+		require.Equal(t, http.StatusNotFound, serve(http.MethodPost, `{"action": "release", "ips": ["10.0.0.1"]}`).Code)
+	})
+
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodPost, `{"action": "drop", "ips": ["10.0.0.1"]}`).Code)
+	require.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodDelete, "").Code)
+}
@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// renewLease extends the lease of the UE IPs allocated to the session.
+func (p *IPPools) renewLease(seid uint64, now time.Time) {
+	p.leasesLock.Lock()
+	defer p.leasesLock.Unlock()
+
+	if p.leases == nil {
+		p.leases = make(map[uint64]time.Time)
+	}
+
+	p.leases[seid] = now
+}
+
+// renewLeases extends the leases of the given sessions that hold UE IPs.
+func (p *IPPools) renewLeases(seids map[uint64]struct{}, now time.Time) {
+	p.leasesLock.Lock()
+	defer p.leasesLock.Unlock()
+
+	for seid := range seids {
+		if _, ok := p.leases[seid]; ok {
+			p.leases[seid] = now
+		}
+	}
+}
+
+// expiredLeases returns the sessions whose lease was not renewed for ttl.
+func (p *IPPools) expiredLeases(now time.Time, ttl time.Duration) []uint64 {
+	p.leasesLock.Lock()
+	defer p.leasesLock.Unlock()
+
+	var expired []uint64
+
+	for seid, renewed := range p.leases {
+		if now.Sub(renewed) >= ttl {
+			expired = append(expired, seid)
+		}
+	}
+
+	return expired
+}
+
+func (p *IPPools) dropLease(seid uint64) {
+	p.leasesLock.Lock()
+	defer p.leasesLock.Unlock()
+
+	delete(p.leases, seid)
+}
+
+// reclaimUEIPs renews the leases of the UE IPs of stored sessions and releases those
+// not renewed for the lease TTL, held by sessions deleted without releasing them or
+// restored from before a restart and never established again.
+func (node *PFCPNode) reclaimUEIPs() int {
+	pools := node.upf.ippools
+	active := make(map[uint64]struct{})
+
+	node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+
+		for _, session := range pConn.store.GetAllSessions() {
+			active[session.localSEID] = struct{}{}
+		}
+
+		return true
+	})
+
+	now := time.Now()
+	pools.renewLeases(active, now)
+
+	reclaimed := 0
+
+	for _, seid := range pools.expiredLeases(now, node.upf.ueIPLeaseTTL) {
+		if err := pools.DeallocIP(seid); err != nil {
+			log.Warnln("Failed to reclaim UE IPs of F-SEID", seid, ":", err)
+			pools.dropLease(seid)
+
+			continue
+		}
+
+		log.WithField("F-SEID", seid).Warn("Reclaimed UE IPs with an expired lease")
+
+		reclaimed++
+	}
+
+	return reclaimed
+}
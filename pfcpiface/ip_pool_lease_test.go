@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPFCPNode_reclaimUEIPs(t *testing.T) {
+	pools, err := NewIPPools("10.0.0.0/24", "2001:db8::/48", nil)
+	require.NoError(t, err)
+
+	u := &upf{ippools: pools, ueIPLeaseTTL: time.Minute}
+	node := &PFCPNode{upf: u}
+
+	store := NewInMemoryStore()
+	node.pConns.Store("198.18.0.1:8805", &PFCPConn{store: store, upf: u})
+	require.NoError(t, store.PutSession(PFCPSession{localSEID: 1}, nil, false, 0))
+
+	for _, seid := range []uint64{1, 2, 3} {
+		_, err := pools.LookupOrAllocIP("", seid)
+		require.NoError(t, err)
+	}
+
+	_, err = pools.LookupOrAllocIP6("", 2)
+	require.NoError(t, err)
+
+	require.Zero(t, node.reclaimUEIPs(), "leases not expired yet")
+
+	// Session 1 is stored, session 2 was deleted without releasing its IPs.
+	past := time.Now().Add(-time.Hour)
+	pools.renewLease(1, past)
+	pools.renewLease(2, past)
+
+	require.Equal(t, 1, node.reclaimUEIPs())
+
+	_, found := pools.pools[""].lookupIP(1)
+	require.True(t, found)
+	_, found = pools.pools[""].lookupIP(2)
+	require.False(t, found)
+	_, found = pools.pools6[""].lookupIP(2)
+	require.False(t, found)
+	_, found = pools.pools[""].lookupIP(3)
+	require.True(t, found)
+
+	require.Empty(t, pools.expiredLeases(time.Now(), time.Minute))
+}
@@ -0,0 +1,377 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ipAllocJournal records UE IP allocations in a file, one line per allocation or
+// release, so that a restarted UPF does not hand out the IPs of surviving sessions.
+// The journal is compacted each time it is opened.
+type ipAllocJournal struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// journaledIPs are the UE IPs still allocated to sessions, keyed by F-SEID, and
+// those reserved by operators.
+type journaledIPs struct {
+	sessions map[uint64][]net.IP
+	reserved map[string]net.IP
+}
+
+// openIPAllocJournal replays the journal at path and returns the IPs still in use.
+func openIPAllocJournal(path string) (*ipAllocJournal, journaledIPs, error) {
+	ips := journaledIPs{
+		sessions: make(map[uint64][]net.IP),
+		reserved: make(map[string]net.IP),
+	}
+
+	f, err := os.Open(path)
+
+	switch {
+	case err == nil:
+		err = replayIPAllocJournal(f, ips)
+		f.Close()
+
+		if err != nil {
+			return nil, ips, err
+		}
+	case !os.IsNotExist(err):
+		return nil, ips, err
+	}
+
+	// Compact: the new journal only holds the IPs in use.
+	tmp := path + ".tmp"
+
+	f, err = os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, ips, err
+	}
+
+	w := bufio.NewWriter(f)
+
+	for seid, sessionIPs := range ips.sessions {
+		for _, ip := range sessionIPs {
+			fmt.Fprintf(w, "alloc %d %s\n", seid, ip)
+		}
+	}
+
+	for _, ip := range ips.reserved {
+		fmt.Fprintf(w, "reserve %s\n", ip)
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return nil, ips, err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, ips, err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		f.Close()
+		return nil, ips, err
+	}
+
+	return &ipAllocJournal{path: path, file: f}, ips, nil
+}
+
+func replayIPAllocJournal(r io.Reader, ips journaledIPs) error {
+	scanner := bufio.NewScanner(r)
+
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			return ErrInvalidArgumentWithReason("UE IP journal line", n, "too few fields")
+		}
+
+		switch fields[0] {
+		case "reserve", "unreserve":
+			ip := net.ParseIP(fields[1])
+			if ip == nil || len(fields) != 2 {
+				return ErrInvalidArgumentWithReason("UE IP journal line", n, "invalid IP")
+			}
+
+			if fields[0] == "reserve" {
+				ips.reserved[ip.String()] = ip
+			} else {
+				delete(ips.reserved, ip.String())
+			}
+
+			continue
+		}
+
+		seid, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return ErrInvalidArgumentWithReason("UE IP journal line", n, err.Error())
+		}
+
+		switch {
+		case fields[0] == "alloc" && len(fields) == 3:
+			ip := net.ParseIP(fields[2])
+			if ip == nil {
+				return ErrInvalidArgumentWithReason("UE IP journal line", n, "invalid IP")
+			}
+
+			ips.sessions[seid] = append(ips.sessions[seid], ip)
+		case fields[0] == "release":
+			delete(ips.sessions, seid)
+		default:
+			return ErrInvalidArgumentWithReason("UE IP journal line", n, "unknown record")
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (j *ipAllocJournal) write(format string, a ...interface{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := fmt.Fprintf(j.file, format, a...); err != nil {
+		log.Errorln("Failed to write UE IP journal", j.path, ":", err)
+	}
+}
+
+// close closes the journal file. Nothing is closed for a nil journal.
+func (j *ipAllocJournal) close() {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.file.Close()
+}
+
+func (j *ipAllocJournal) recordAlloc(seid uint64, ip net.IP) {
+	j.write("alloc %d %s\n", seid, ip)
+}
+
+func (j *ipAllocJournal) recordRelease(seid uint64) {
+	j.write("release %d\n", seid)
+}
+
+func (j *ipAllocJournal) recordReserve(ip net.IP) {
+	j.write("reserve %s\n", ip)
+}
+
+func (j *ipAllocJournal) recordUnreserve(ip net.IP) {
+	j.write("unreserve %s\n", ip)
+}
+
+// persist records the allocations of the pools in the journal at path, after
+// restoring those it holds. Restored IPs outside of the pools are dropped. It must be
+// called before the pools are used.
+func (p *IPPools) persist(path string) error {
+	journal, ips, err := openIPAllocJournal(path)
+	if err != nil {
+		return err
+	}
+
+	restored := 0
+	// IPv4 addresses are restored in one pass over the free IPs of each pool.
+	reserved4 := make(map[*IPPool]map[string]uint64)
+
+	for seid, sessionIPs := range ips.sessions {
+		for _, ip := range sessionIPs {
+			if pool := p.poolOf(ip); pool != nil {
+				if reserved4[pool] == nil {
+					reserved4[pool] = make(map[string]uint64)
+				}
+
+				reserved4[pool][ip.To4().String()] = seid
+
+				continue
+			}
+
+			if p.restoreIP6(seid, ip) {
+				restored++
+				continue
+			}
+
+			log.Warnln("Dropping UE IP", ip, "of F-SEID", seid, "outside of the UE IP pools")
+		}
+	}
+
+	for pool, poolIPs := range reserved4 {
+		restored += pool.reserve(poolIPs)
+	}
+
+	for _, ip := range ips.reserved {
+		if err := p.reserveIP(ip); err != nil {
+			log.Warnln("Dropping reserved UE IP", ip, ":", err)
+		}
+	}
+
+	log.Infoln("Restored", restored, "UE IP allocations from", path)
+
+	p.journal = journal
+	p.restored = make(map[uint64]struct{}, len(ips.sessions))
+
+	now := time.Now()
+
+	for seid := range ips.sessions {
+		p.restored[seid] = struct{}{}
+		p.renewLease(seid, now)
+	}
+
+	return nil
+}
+
+// poolOf returns the IPv4 pool of ip, or nil. The caller holds poolsLock.
+func (p *IPPools) poolOf(ip net.IP) *IPPool {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return nil
+	}
+
+	for _, pool := range p.pools {
+		if pool.subnet.Contains(ip4) {
+			return pool
+		}
+	}
+
+	return nil
+}
+
+// restoreIP6 marks an IPv6 prefix as allocated to the session in its pool.
+func (p *IPPools) restoreIP6(seid uint64, ip net.IP) bool {
+	if ip.To4() != nil {
+		return false
+	}
+
+	for _, pool := range p.pools6 {
+		if pool.contains(ip) {
+			return pool.reserve(seid, ip)
+		}
+	}
+
+	return false
+}
+
+// releaseRestored releases the IPs restored for a session unknown since the restart,
+// e.g. when its deletion is requested.
+func (p *IPPools) releaseRestored(seid uint64) {
+	p.restoredLock.Lock()
+	_, ok := p.restored[seid]
+	delete(p.restored, seid)
+	p.restoredLock.Unlock()
+
+	if ok {
+		if err := p.DeallocIP(seid); err != nil {
+			log.Warnln("Failed to release restored UE IP of F-SEID", seid, ":", err)
+		}
+	}
+}
+
+// reserve marks the free IPs of ips as allocated to their F-SEID and returns their number.
+func (i *IPPool) reserve(ips map[string]uint64) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	free := i.freePool[:0]
+	reserved := 0
+
+	for _, ip := range i.freePool {
+		seid, ok := ips[ip.String()]
+		if !ok {
+			free = append(free, ip)
+			continue
+		}
+
+		i.inventory[seid] = ip
+		reserved++
+	}
+
+	i.freePool = free
+
+	return reserved
+}
+
+func (i *IPv6Pool) contains(ip net.IP) bool {
+	ip = ip.To16()
+	if ip == nil {
+		return false
+	}
+
+	upper := binary.BigEndian.Uint64(ip[:8])
+
+	return upper&^(i.size-1) == i.base && binary.BigEndian.Uint64(ip[8:]) == 0
+}
+
+func (i *IPv6Pool) reserve(seid uint64, ip net.IP) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	index := binary.BigEndian.Uint64(ip.To16()[:8]) - i.base
+
+	for idx, free := range i.free {
+		if free == index {
+			i.free = append(i.free[:idx], i.free[idx+1:]...)
+			i.inventory[seid] = index
+
+			return true
+		}
+	}
+
+	if index < i.next {
+		return false
+	}
+
+	// Indexes skipped up to the restored one are free.
+	for ; i.next < index; i.next++ {
+		i.free = append(i.free, i.next)
+	}
+
+	i.next++
+	i.inventory[seid] = index
+
+	return true
+}
+
+// adoptIPs marks the UE IPs of a session taken over from another instance as
+// allocated to it. IPs outside of the pools or already allocated are skipped.
+func (p *IPPools) adoptIPs(seid uint64, ips []net.IP) {
+	p.poolsLock.RLock()
+	defer p.poolsLock.RUnlock()
+
+	for _, ip := range ips {
+		adopted := false
+
+		if pool := p.poolOf(ip); pool != nil {
+			adopted = pool.reserve(map[string]uint64{ip.To4().String(): seid}) == 1
+		} else {
+			adopted = p.restoreIP6(seid, ip)
+		}
+
+		if !adopted {
+			log.Warnln("Failed to adopt UE IP", ip, "of F-SEID", seid)
+			continue
+		}
+
+		if p.journal != nil {
+			p.journal.recordAlloc(seid, ip)
+		}
+	}
+
+	p.renewLease(seid, time.Now())
+}
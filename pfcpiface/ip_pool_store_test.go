@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPPools_persist(t *testing.T) {
+	path := t.TempDir() + "/ue_ips"
+
+	newPools := func() *IPPools {
+		pools, err := NewIPPools("10.0.0.0/24", "2001:db8::/48", nil)
+		require.NoError(t, err)
+		require.NoError(t, pools.persist(path))
+
+		return pools
+	}
+
+	pools := newPools()
+
+	for seid := uint64(1); seid <= 3; seid++ {
+		_, err := pools.LookupOrAllocIP("", seid)
+		require.NoError(t, err)
+	}
+
+	_, err := pools.LookupOrAllocIP6("", 2)
+	require.NoError(t, err)
+	require.NoError(t, pools.DeallocIP(1))
+	require.NoError(t, pools.reserveIP(net.ParseIP("10.0.0.5")))
+	require.NoError(t, pools.reserveIP(net.ParseIP("10.0.0.6")))
+	require.NoError(t, pools.releaseIP(net.ParseIP("10.0.0.6")))
+
+	t.Run("allocations survive a restart", func(t *testing.T) {
+		pools := newPools()
+
+		ip, err := pools.LookupOrAllocIP("", 2)
+		require.NoError(t, err)
+		require.Equal(t, "10.0.0.2", ip.String())
+
+		ip, err = pools.LookupOrAllocIP6("", 2)
+		require.NoError(t, err)
+		require.Equal(t, "2001:db8::", ip.String())
+
+		// Neither the IPs of surviving sessions nor the IPv6 prefix are handed out again.
+		ip, err = pools.LookupOrAllocIP("", 4)
+		require.NoError(t, err)
+		require.NotContains(t, []string{"10.0.0.2", "10.0.0.3"}, ip.String())
+
+		require.Equal(t, []string{"10.0.0.5"}, pools.status().Pools[0].Reserved)
+
+		ip, err = pools.LookupOrAllocIP6("", 4)
+		require.NoError(t, err)
+		require.Equal(t, "2001:db8:0:1::", ip.String())
+	})
+
+	t.Run("journal is compacted and restored sessions are released", func(t *testing.T) {
+		pools := newPools()
+
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.NotContains(t, string(b), "release")
+
+		pools.releaseRestored(3)
+		pools.releaseRestored(3)
+
+		_, found := pools.pools[""].lookupIP(3)
+		require.False(t, found)
+	})
+
+	t.Run("corrupted journal is rejected", func(t *testing.T) {
+		path := t.TempDir() + "/ue_ips"
+		require.NoError(t, os.WriteFile(path, []byte(strings.Join([]string{"alloc 1 10.0.0.1", "alloc x"}, "\n")), 0o600))
+
+		pools, err := NewIPPools("10.0.0.0/24", "", nil)
+		require.NoError(t, err)
+		require.Error(t, pools.persist(path))
+	})
+}
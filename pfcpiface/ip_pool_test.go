@@ -138,3 +138,112 @@ func TestIPPool_DeallocIP(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestIPPools(t *testing.T) {
+	pools, err := NewIPPools("10.0.0.0/24", "", []UEIPPoolInfo{
+		{Dnn: "internet", Pool: "10.1.0.0/24", Slice: "slice1"},
+		{Dnn: "ims", Pool: "10.2.0.0/24"},
+	})
+	require.NoError(t, err)
+
+	t.Run("pool of the DNN or the default pool", func(t *testing.T) {
+		ip, err := pools.LookupOrAllocIP("internet", 1)
+		require.NoError(t, err)
+		require.True(t, net.ParseIP("10.1.0.1").Equal(ip))
+
+		ip, err = pools.LookupOrAllocIP("ims", 2)
+		require.NoError(t, err)
+		require.True(t, net.ParseIP("10.2.0.1").Equal(ip))
+
+		ip, err = pools.LookupOrAllocIP("other", 3)
+		require.NoError(t, err)
+		require.True(t, net.ParseIP("10.0.0.1").Equal(ip))
+	})
+
+	t.Run("session keeps its IP", func(t *testing.T) {
+		ip, err := pools.LookupOrAllocIP("ims", 1)
+		require.NoError(t, err)
+		require.True(t, net.ParseIP("10.1.0.1").Equal(ip))
+	})
+
+	t.Run("dealloc from the pool of the session", func(t *testing.T) {
+		require.NoError(t, pools.DeallocIP(2))
+		require.Error(t, pools.DeallocIP(2))
+
+		ip, err := pools.LookupOrAllocIP("ims", 4)
+		require.NoError(t, err)
+		require.True(t, net.ParseIP("10.2.0.2").Equal(ip))
+	})
+
+	t.Run("no default pool", func(t *testing.T) {
+		pools, err := NewIPPools("", "", []UEIPPoolInfo{{Dnn: "internet", Pool: "10.1.0.0/24"}})
+		require.NoError(t, err)
+
+		_, err = pools.LookupOrAllocIP("other", 1)
+		require.Error(t, err)
+	})
+
+	t.Run("duplicate DNN", func(t *testing.T) {
+		_, err := NewIPPools("", "", []UEIPPoolInfo{
+			{Dnn: "internet", Pool: "10.1.0.0/24"},
+			{Dnn: "internet", Pool: "10.2.0.0/24"},
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestIPv6Pool(t *testing.T) {
+	t.Run("invalid subnets", func(t *testing.T) {
+		for _, subnet := range []string{"10.0.0.0/24", "2001:db8::/96", "::/0", "2001:db8::"} {
+			_, err := NewIPv6Pool(subnet)
+			assert.Error(t, err, subnet)
+		}
+	})
+
+	t.Run("prefixes are allocated in order and reused", func(t *testing.T) {
+		pool, err := NewIPv6Pool("2001:db8:0:2::/63")
+		require.NoError(t, err)
+
+		ip, err := pool.LookupOrAllocIP(1)
+		require.NoError(t, err)
+		require.Equal(t, "2001:db8:0:2::", ip.String())
+
+		ip, err = pool.LookupOrAllocIP(2)
+		require.NoError(t, err)
+		require.Equal(t, "2001:db8:0:3::", ip.String())
+
+		ip, err = pool.LookupOrAllocIP(1)
+		require.NoError(t, err)
+		require.Equal(t, "2001:db8:0:2::", ip.String())
+
+		_, err = pool.LookupOrAllocIP(3)
+		require.Error(t, err)
+
+		require.NoError(t, pool.DeallocIP(1))
+		require.Error(t, pool.DeallocIP(1))
+
+		ip, err = pool.LookupOrAllocIP(3)
+		require.NoError(t, err)
+		require.Equal(t, "2001:db8:0:2::", ip.String())
+	})
+
+	t.Run("dual-stack sessions release both", func(t *testing.T) {
+		pools, err := NewIPPools("10.0.0.0/24", "", []UEIPPoolInfo{
+			{Dnn: "internet", Pool: "10.1.0.0/24", IPv6Pool: "2001:db8:1::/48"},
+		})
+		require.NoError(t, err)
+
+		_, err = pools.LookupOrAllocIP6("other", 1)
+		require.Error(t, err)
+
+		_, err = pools.LookupOrAllocIP("internet", 1)
+		require.NoError(t, err)
+
+		ip, err := pools.LookupOrAllocIP6("internet", 1)
+		require.NoError(t, err)
+		require.Equal(t, "2001:db8:1::", ip.String())
+
+		require.NoError(t, pools.DeallocIP(1))
+		require.Error(t, pools.DeallocIP(1))
+	})
+}
@@ -0,0 +1,201 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const ipamTimeoutDefault = 2 * time.Second
+
+// ipamDriver allocates UE IPs to sessions. IPPools allocate from the local pools,
+// restIPAM from an external IPAM shared by several UPF instances.
+type ipamDriver interface {
+	LookupOrAllocIP(dnn string, seid uint64) (net.IP, error)
+	LookupOrAllocIP6(dnn string, seid uint64) (net.IP, error)
+	// DeallocIP releases all UE IPs of the session.
+	DeallocIP(seid uint64) error
+}
+
+const (
+	ipamFamilyIPv4 = "ipv4"
+	ipamFamilyIPv6 = "ipv6"
+)
+
+// ipamAllocRequest is the body of the allocation requests to the external IPAM.
+type ipamAllocRequest struct {
+	UPF    string `json:"upf"`
+	FSEID  uint64 `json:"fseid"`
+	DNN    string `json:"dnn"`
+	Family string `json:"family"`
+}
+
+type ipamAllocResponse struct {
+	IP string `json:"ip"`
+}
+
+// restIPAM allocates UE IPs from an external IPAM over REST:
+//
+//	POST   <url>/allocations               allocates an IP, or returns the IP already
+//	                                       allocated to the UPF, F-SEID and family
+//	DELETE <url>/allocations/<upf>/<fseid> releases the IPs of a session
+//
+// Allocations are cached, so that the PDRs of a session only cost one request. The
+// IPAM must answer concurrent allocations of the same session with the same IP.
+type restIPAM struct {
+	url    string
+	upf    string
+	client *http.Client
+
+	mu sync.Mutex
+	// allocs are the IPs allocated to sessions, keyed by F-SEID and family.
+	allocs map[uint64]map[string]net.IP
+}
+
+func newRESTIPAM(conf IPAMInfo, upf string) (*restIPAM, error) {
+	timeout := ipamTimeoutDefault
+
+	if conf.Timeout != "" {
+		var err error
+
+		timeout, err = time.ParseDuration(conf.Timeout)
+		if err != nil {
+			return nil, ErrInvalidArgumentWithReason("ipam.timeout", conf.Timeout, "invalid duration")
+		}
+	}
+
+	// Allocations are keyed by UPF, the node ID unless not set.
+	if upf == "" {
+		var err error
+
+		upf, err = os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &restIPAM{
+		url:    strings.TrimSuffix(conf.URL, "/"),
+		upf:    upf,
+		client: &http.Client{Timeout: timeout},
+		allocs: make(map[uint64]map[string]net.IP),
+	}, nil
+}
+
+func (r *restIPAM) LookupOrAllocIP(dnn string, seid uint64) (net.IP, error) {
+	return r.lookupOrAlloc(dnn, seid, ipamFamilyIPv4)
+}
+
+func (r *restIPAM) LookupOrAllocIP6(dnn string, seid uint64) (net.IP, error) {
+	return r.lookupOrAlloc(dnn, seid, ipamFamilyIPv6)
+}
+
+func (r *restIPAM) lookupOrAlloc(dnn string, seid uint64, family string) (net.IP, error) {
+	r.mu.Lock()
+	ip, ok := r.allocs[seid][family]
+	r.mu.Unlock()
+
+	if ok {
+		return ip, nil
+	}
+
+	body, err := json.Marshal(ipamAllocRequest{UPF: r.upf, FSEID: seid, DNN: dnn, Family: family})
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := r.do(http.MethodPost, r.url+"/allocations", body, http.StatusOK, http.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ipamAllocResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, ErrOperationFailedWithReason("IPAM allocation", "invalid response: "+err.Error())
+	}
+
+	ip = net.ParseIP(resp.IP)
+	if ip == nil || (family == ipamFamilyIPv4) != (ip.To4() != nil) {
+		return nil, ErrOperationFailedWithReason("IPAM allocation", "invalid "+family+" address "+resp.IP)
+	}
+
+	if family == ipamFamilyIPv4 {
+		ip = ip.To4()
+	}
+
+	r.mu.Lock()
+	if r.allocs[seid] == nil {
+		r.allocs[seid] = make(map[string]net.IP)
+	}
+
+	r.allocs[seid][family] = ip
+	r.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"F-SEID": seid,
+		"DNN":    dnn,
+		"IP":     ip,
+	}).Trace("Allocated UE IP from IPAM")
+
+	return ip, nil
+}
+
+func (r *restIPAM) DeallocIP(seid uint64) error {
+	// Sessions restored after a restart are not cached, the release is always sent.
+	_, err := r.do(http.MethodDelete, fmt.Sprintf("%s/allocations/%s/%d", r.url, r.upf, seid), nil,
+		http.StatusOK, http.StatusNoContent, http.StatusNotFound)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	delete(r.allocs, seid)
+	r.mu.Unlock()
+
+	return nil
+}
+
+// do sends a request to the IPAM and returns the response body if its status is one of
+// expected.
+func (r *restIPAM) do(method, url string, body []byte, expected ...int) ([]byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, ErrOperationFailedWithReason("IPAM request", err.Error())
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, ErrOperationFailedWithReason("IPAM request", err.Error())
+	}
+
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return respBody, nil
+		}
+	}
+
+	return nil, ErrOperationFailedWithReason("IPAM request",
+		fmt.Sprintf("%s %s: %s %s", method, url, resp.Status, strings.TrimSpace(string(respBody))))
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_restIPAM(t *testing.T) {
+	var requests []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/ipam/allocations":
+			var req ipamAllocRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			require.Equal(t, "upf1", req.UPF)
+
+			switch {
+			case req.DNN == "full":
+				http.Error(w, "pool exhausted", http.StatusServiceUnavailable)
+			case req.Family == ipamFamilyIPv6:
+				require.NoError(t, json.NewEncoder(w).Encode(ipamAllocResponse{IP: "2001:db8::"}))
+			default:
+				w.WriteHeader(http.StatusCreated)
+				require.NoError(t, json.NewEncoder(w).Encode(ipamAllocResponse{IP: "10.0.0.1"}))
+			}
+		case r.Method == http.MethodDelete && r.URL.Path == "/ipam/allocations/upf1/1":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ipam, err := newRESTIPAM(IPAMInfo{URL: srv.URL + "/ipam/"}, "upf1")
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		ip, err := ipam.LookupOrAllocIP("internet", 1)
+		require.NoError(t, err)
+		require.Equal(t, "10.0.0.1", ip.String())
+	}
+
+	ip, err := ipam.LookupOrAllocIP6("internet", 1)
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8::", ip.String())
+
+	_, err = ipam.LookupOrAllocIP("full", 2)
+	require.ErrorIs(t, err, errFailed)
+
+	require.NoError(t, ipam.DeallocIP(1))
+	// Unknown sessions are released.
+	require.NoError(t, ipam.DeallocIP(3))
+
+	require.Equal(t, []string{
+		"POST /ipam/allocations",
+		"POST /ipam/allocations",
+		"POST /ipam/allocations",
+		"DELETE /ipam/allocations/upf1/1",
+		"DELETE /ipam/allocations/upf1/3",
+	}, requests)
+
+	_, err = ipam.LookupOrAllocIP6("internet", 1)
+	require.NoError(t, err)
+	require.Len(t, requests, 6)
+}
@@ -0,0 +1,364 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	leaseNameDefault          = "upf-pfcp"
+	leaseDurationDefault      = 15 * time.Second
+	leaseRenewDeadlineDefault = 10 * time.Second
+	leaseRetryPeriodDefault   = 2 * time.Second
+
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// leaseReplicationURLAnnotation is the endpoint the followers replicate the
+	// sessions of the leader from.
+	leaseReplicationURLAnnotation = "upf.omec-project.org/replication-url"
+
+	// leaseTimeFormat is the format of the MicroTime of the Kubernetes API.
+	leaseTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+var (
+	errLeaseConflict  = errors.New("lease updated concurrently")
+	errLeadershipLost = errors.New("lost PFCP leadership")
+)
+
+// lease is the subset of a coordination.k8s.io/v1 Lease used for leader election.
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions"`
+}
+
+// leaderElector elects the replica serving N4 with a Kubernetes Lease: the holder of
+// the lease renews it every retry period, the other replicas acquire it once it was
+// not renewed for the lease duration.
+type leaderElector struct {
+	url            string
+	identity       string
+	replicationURL string
+	leaseDuration  time.Duration
+	renewDeadline  time.Duration
+	retryPeriod    time.Duration
+
+	client *http.Client
+	// tokenFile is the service account token, re-read before each request as the
+	// kubelet rotates it.
+	tokenFile string
+
+	// elected is closed once the lease is acquired.
+	elected chan struct{}
+	// lost is called when the lease could not be renewed within the renew deadline.
+	lost func()
+
+	mu        sync.Mutex
+	leaderURL string
+}
+
+// newLeaderElector creates the elector of conf, calling lost when the leadership is lost.
+func newLeaderElector(conf LeaderElectionInfo, httpPort string, lost func()) (*leaderElector, error) {
+	e := &leaderElector{
+		identity:       conf.Identity,
+		replicationURL: conf.ReplicationURL,
+		leaseDuration:  validDuration(conf.LeaseDuration),
+		renewDeadline:  validDuration(conf.RenewDeadline),
+		retryPeriod:    validDuration(conf.RetryPeriod),
+		elected:        make(chan struct{}),
+		lost:           lost,
+	}
+
+	if e.identity == "" {
+		e.identity, _ = os.Hostname()
+	}
+
+	if e.replicationURL == "" {
+		e.replicationURL = "http://" + net.JoinHostPort(GetLocalIP(), httpPort)
+	}
+
+	apiServer := conf.APIServer
+	if apiServer == "" {
+		apiServer = "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"))
+	}
+
+	namespace := conf.Namespace
+	if namespace == "" {
+		ns, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("lease namespace not set: %w", err)
+		}
+
+		namespace = strings.TrimSpace(string(ns))
+	}
+
+	e.url = fmt.Sprintf("%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", strings.TrimSuffix(apiServer, "/"), namespace)
+
+	name := conf.LeaseName
+	if name == "" {
+		name = leaseNameDefault
+	}
+
+	e.url += "/" + name
+
+	e.client = &http.Client{Timeout: e.retryPeriod}
+
+	// In cluster, the API server is reached with the service account of the pod.
+	e.tokenFile = serviceAccountDir + "/token"
+
+	if ca, err := os.ReadFile(serviceAccountDir + "/ca.crt"); err == nil {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+
+		e.client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}}
+	}
+
+	return e, nil
+}
+
+func (e *leaderElector) isLeader() bool {
+	select {
+	case <-e.elected:
+		return true
+	default:
+		return false
+	}
+}
+
+// currentLeaderURL returns the replication endpoint of the current leader, empty if unknown.
+func (e *leaderElector) currentLeaderURL() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.leaderURL
+}
+
+// run campaigns for the lease, then renews it, until ctx is done.
+func (e *leaderElector) run(ctx context.Context) {
+	ticker := time.NewTicker(e.retryPeriod)
+	defer ticker.Stop()
+
+	var renewed time.Time
+
+	for {
+		now := time.Now()
+
+		acquired, err := e.tryAcquireOrRenew(ctx, now)
+		if err != nil && !errors.Is(err, errLeaseConflict) {
+			log.Warnln("Leader election failed:", err)
+		}
+
+		switch {
+		case acquired && !e.isLeader():
+			log.Infoln("Acquired PFCP leadership as", e.identity)
+			close(e.elected)
+
+			renewed = now
+		case acquired:
+			renewed = now
+		case e.isLeader() && now.Sub(renewed) > e.renewDeadline:
+			e.lost()
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tryAcquireOrRenew takes the lease if it is free, expired or already held, and
+// returns whether it is held.
+func (e *leaderElector) tryAcquireOrRenew(ctx context.Context, now time.Time) (bool, error) {
+	l, found, err := e.getLease(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if found && l.Spec.HolderIdentity != e.identity {
+		e.mu.Lock()
+		e.leaderURL = l.Metadata.Annotations[leaseReplicationURLAnnotation]
+		e.mu.Unlock()
+
+		renewTime, err := time.Parse(leaseTimeFormat, l.Spec.RenewTime)
+		duration := time.Duration(l.Spec.LeaseDurationSeconds) * time.Second
+
+		if l.Spec.HolderIdentity != "" && err == nil && now.Before(renewTime.Add(duration)) {
+			return false, nil
+		}
+	}
+
+	if !found {
+		l = lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   leaseMetadata{Name: e.url[strings.LastIndex(e.url, "/")+1:]},
+		}
+	}
+
+	if l.Spec.HolderIdentity != e.identity {
+		l.Spec.HolderIdentity = e.identity
+		l.Spec.AcquireTime = now.Format(leaseTimeFormat)
+
+		if found {
+			l.Spec.LeaseTransitions++
+		}
+	}
+
+	l.Spec.RenewTime = now.Format(leaseTimeFormat)
+	l.Spec.LeaseDurationSeconds = int(e.leaseDuration.Seconds())
+
+	if l.Metadata.Annotations == nil {
+		l.Metadata.Annotations = make(map[string]string)
+	}
+
+	l.Metadata.Annotations[leaseReplicationURLAnnotation] = e.replicationURL
+
+	if err := e.putLease(ctx, l, found); err != nil {
+		return false, err
+	}
+
+	e.mu.Lock()
+	e.leaderURL = e.replicationURL
+	e.mu.Unlock()
+
+	return true, nil
+}
+
+func (e *leaderElector) do(ctx context.Context, method, url string, body interface{}) (*http.Response, error) {
+	var buf bytes.Buffer
+
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, &buf)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if token := e.bearerToken(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return e.client.Do(req)
+}
+
+// bearerToken returns the current service account token, empty out of cluster.
+func (e *leaderElector) bearerToken() string {
+	token, err := os.ReadFile(e.tokenFile)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(token))
+}
+
+func (e *leaderElector) getLease(ctx context.Context) (lease, bool, error) {
+	var l lease
+
+	resp, err := e.do(ctx, http.MethodGet, e.url, nil)
+	if err != nil {
+		return l, false, err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return l, true, json.NewDecoder(resp.Body).Decode(&l)
+	case http.StatusNotFound:
+		return l, false, nil
+	default:
+		return l, false, fmt.Errorf("get lease %v: %v", e.url, resp.Status)
+	}
+}
+
+// putLease updates the lease, or creates it if not found. Updates are rejected by
+// the API server if the lease changed since it was read.
+func (e *leaderElector) putLease(ctx context.Context, l lease, found bool) error {
+	method, url := http.MethodPut, e.url
+	if !found {
+		method, url = http.MethodPost, e.url[:strings.LastIndex(e.url, "/")]
+	}
+
+	resp, err := e.do(ctx, method, url, l)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		return errLeaseConflict
+	default:
+		return fmt.Errorf("%v lease %v: %v", method, url, resp.Status)
+	}
+}
+
+// waitForLeadership replicates the sessions of the leader until this replica is
+// elected. Returns false if ctx is done first.
+func (c *replicaClient) waitForLeadership(ctx context.Context, e *leaderElector) bool {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	leaderURL := func() string {
+		u := e.currentLeaderURL()
+		if u == "" || u == e.replicationURL {
+			return ""
+		}
+
+		return strings.TrimSuffix(u, "/") + "/v1/replication"
+	}
+
+	go c.replicate(streamCtx, leaderURL, nil, e.retryPeriod)
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-e.elected:
+		return true
+	}
+}
@@ -0,0 +1,194 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLeaseServer serves a single Lease as the Kubernetes API server does, rejecting
+// updates of stale versions.
+type fakeLeaseServer struct {
+	mu      sync.Mutex
+	lease   *lease
+	version int
+	fail    bool
+}
+
+func (s *fakeLeaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if s.lease == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(s.lease)
+	case http.MethodPost, http.MethodPut:
+		var l lease
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if (r.Method == http.MethodPost) != (s.lease == nil) ||
+			(s.lease != nil && l.Metadata.ResourceVersion != s.lease.Metadata.ResourceVersion) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		s.version++
+		l.Metadata.ResourceVersion = strconv.Itoa(s.version)
+		s.lease = &l
+
+		_ = json.NewEncoder(w).Encode(s.lease)
+	}
+}
+
+func newTestLeaderElector(t *testing.T, apiServer, identity string) *leaderElector {
+	e, err := newLeaderElector(LeaderElectionInfo{
+		Namespace:      "upf",
+		Identity:       identity,
+		ReplicationURL: "http://" + identity + ":8080",
+		APIServer:      apiServer,
+		LeaseDuration:  "2s",
+		RenewDeadline:  "100ms",
+		RetryPeriod:    "10ms",
+	}, "8080", func() {})
+	require.NoError(t, err)
+
+	return e
+}
+
+func Test_leaderElector(t *testing.T) {
+	server := &fakeLeaseServer{}
+	api := httptest.NewServer(server)
+
+	defer api.Close()
+
+	ctx := context.Background()
+	upf0 := newTestLeaderElector(t, api.URL, "upf-0")
+	upf1 := newTestLeaderElector(t, api.URL, "upf-1")
+	now := time.Now()
+
+	t.Run("free lease is acquired", func(t *testing.T) {
+		acquired, err := upf0.tryAcquireOrRenew(ctx, now)
+		require.NoError(t, err)
+		require.True(t, acquired)
+		require.Equal(t, "upf-0", server.lease.Spec.HolderIdentity)
+		require.Equal(t, 2, server.lease.Spec.LeaseDurationSeconds)
+	})
+
+	t.Run("held lease is not acquired", func(t *testing.T) {
+		acquired, err := upf1.tryAcquireOrRenew(ctx, now.Add(time.Second))
+		require.NoError(t, err)
+		require.False(t, acquired)
+		require.Equal(t, "http://upf-0:8080", upf1.currentLeaderURL())
+	})
+
+	t.Run("held lease is renewed", func(t *testing.T) {
+		acquired, err := upf0.tryAcquireOrRenew(ctx, now.Add(time.Second))
+		require.NoError(t, err)
+		require.True(t, acquired)
+		require.Equal(t, 0, server.lease.Spec.LeaseTransitions)
+	})
+
+	t.Run("expired lease is acquired", func(t *testing.T) {
+		acquired, err := upf1.tryAcquireOrRenew(ctx, now.Add(4*time.Second))
+		require.NoError(t, err)
+		require.True(t, acquired)
+		require.Equal(t, "upf-1", server.lease.Spec.HolderIdentity)
+		require.Equal(t, 1, server.lease.Spec.LeaseTransitions)
+		require.Equal(t, "http://upf-1:8080", server.lease.Metadata.Annotations[leaseReplicationURLAnnotation])
+	})
+
+	t.Run("stale update is rejected", func(t *testing.T) {
+		l, _, err := upf0.getLease(ctx)
+		require.NoError(t, err)
+
+		_, err = upf1.tryAcquireOrRenew(ctx, now.Add(5*time.Second))
+		require.NoError(t, err)
+		require.ErrorIs(t, upf0.putLease(ctx, l, true), errLeaseConflict)
+	})
+}
+
+func Test_leaderElector_run(t *testing.T) {
+	server := &fakeLeaseServer{}
+	api := httptest.NewServer(server)
+
+	defer api.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := newTestLeaderElector(t, api.URL, "upf-0")
+	lost := make(chan struct{})
+	e.lost = func() { close(lost) }
+
+	go e.run(ctx)
+
+	select {
+	case <-e.elected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lease not acquired")
+	}
+
+	server.mu.Lock()
+	server.fail = true
+	server.mu.Unlock()
+
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lease loss not detected")
+	}
+}
+
+func Test_leaderElector_rotatedToken(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		authz []string
+	)
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		authz = append(authz, r.Header.Get("Authorization"))
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	defer api.Close()
+
+	e := newTestLeaderElector(t, api.URL, "upf-0")
+	e.tokenFile = filepath.Join(t.TempDir(), "token")
+
+	for _, token := range []string{"token-0", "token-1"} {
+		require.NoError(t, os.WriteFile(e.tokenFile, []byte(token+"\n"), 0o600))
+
+		_, _, err := e.getLease(context.Background())
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, []string{"Bearer token-0", "Bearer token-1"}, authz)
+}
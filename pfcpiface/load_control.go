@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+const (
+	loadControlIntervalDefault = 5 * time.Second
+
+	// cpFeatureLOAD is the bit of the CP Function Features of CP nodes supporting the
+	// Load Control Information IE.
+	cpFeatureLOAD = 0x01
+)
+
+// loadSample is the utilization of each resource, in percent.
+type loadSample struct {
+	sessions      uint8
+	cpu           uint8
+	datapathQueue uint8
+}
+
+// metric is the load reported to the CP nodes, that of the most utilized resource.
+func (s loadSample) metric() uint8 {
+	m := s.sessions
+	if s.cpu > m {
+		m = s.cpu
+	}
+
+	if s.datapathQueue > m {
+		m = s.datapathQueue
+	}
+
+	return m
+}
+
+// loadMonitor computes the load of the UPF, reported to the CP nodes in the Load
+// Control Information IE of the session responses so that they steer new sessions to
+// less loaded UPFs.
+type loadMonitor struct {
+	interval    time.Duration
+	maxSessions uint32
+	// reportLoad is set if the load is reported to the CP nodes.
+	reportLoad bool
+	// overload detects the overload of the UPF from its load, nil if disabled.
+	overload *overloadDetector
+
+	// cpuStat returns the busy and total CPU time since boot.
+	cpuStat func() (busy, total uint64, ok bool)
+	busy    uint64
+	total   uint64
+
+	mu     sync.Mutex
+	sample loadSample
+	// seq is incremented on each change of the load metric, zero before the first sample.
+	seq uint32
+}
+
+func newLoadMonitor(conf Conf) *loadMonitor {
+	m := &loadMonitor{
+		interval:    validDuration(conf.LoadControl.Interval),
+		maxSessions: conf.LoadControl.MaxSessions,
+		reportLoad:  conf.LoadControl.Enable,
+		cpuStat:     procCPUStat,
+	}
+
+	if conf.OverloadControl.Enable {
+		m.overload = newOverloadDetector(conf.OverloadControl)
+	}
+
+	return m
+}
+
+// percent returns n in percent of max, capped at 100.
+func percent(n, max uint64) uint8 {
+	if max == 0 {
+		return 0
+	}
+
+	if n >= max {
+		return 100
+	}
+
+	return uint8(n * 100 / max)
+}
+
+// update samples the load, given the session count and the depth of the most loaded
+// datapath write queue, in percent.
+func (m *loadMonitor) update(sessions int, queueDepth uint8) {
+	s := loadSample{
+		sessions:      percent(uint64(sessions), uint64(m.maxSessions)),
+		datapathQueue: queueDepth,
+	}
+
+	// CPU utilization is measured between consecutive samples.
+	if busy, total, ok := m.cpuStat(); ok {
+		if m.total != 0 && total > m.total && busy >= m.busy {
+			s.cpu = percent(busy-m.busy, total-m.total)
+		}
+
+		m.busy, m.total = busy, total
+	}
+
+	if m.overload != nil {
+		m.overload.update(s.metric(), time.Now())
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.seq == 0 || s.metric() != m.sample.metric() {
+		m.seq++
+	}
+
+	m.sample = s
+}
+
+// status returns the last load sample and its sequence number, zero before the first.
+func (m *loadMonitor) status() (loadSample, uint32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.sample, m.seq
+}
+
+// loadControlIE returns the Load Control Information IE, nil before the first sample.
+func (m *loadMonitor) loadControlIE() *ie.IE {
+	sample, seq := m.status()
+	if seq == 0 {
+		return nil
+	}
+
+	return ie.NewLoadControlInformation(ie.NewSequenceNumber(seq), ie.NewMetric(sample.metric()))
+}
+
+func (m *loadMonitor) run(ctx context.Context, sessions func() int, queueDepth func() uint8) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.update(sessions(), queueDepth())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// procCPUStat reads the busy and total CPU time of all CPUs from /proc/stat.
+func procCPUStat() (busy, total uint64, ok bool) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0, false
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return 0, 0, false
+	}
+
+	// cpu user nice system idle iowait irq softirq steal ...
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, false
+	}
+
+	var idle uint64
+
+	for i, field := range fields[1:] {
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+
+		// Guest time is already accounted in user time.
+		if i >= 8 {
+			break
+		}
+
+		total += v
+
+		if i == 3 || i == 4 {
+			idle += v
+		}
+	}
+
+	return total - idle, total, true
+}
+
+// datapathQueueDepth returns the depth of the most loaded asynchronous datapath write
+// queue, in percent.
+func (node *PFCPNode) datapathQueueDepth() uint8 {
+	var depth uint8
+
+	node.pConns.Range(func(key, value interface{}) bool {
+		if w := value.(*PFCPConn).writer; w != nil {
+			if d := percent(uint64(len(w.queue)), uint64(cap(w.queue))); d > depth {
+				depth = d
+			}
+		}
+
+		return true
+	})
+
+	return depth
+}
+
+// cpFunctionFeatures returns the features of a CP Function Features IE, none if nil.
+func cpFunctionFeatures(i *ie.IE) uint8 {
+	if i == nil {
+		return 0
+	}
+
+	features, err := i.CPFunctionFeatures()
+	if err != nil {
+		return 0
+	}
+
+	return features
+}
+
+// addLoadControl reports the load of the UPF in the session responses, to CP nodes
+// supporting it.
+func (pConn *PFCPConn) addLoadControl(reply message.Message) {
+	monitor := pConn.upf.loadMonitor
+	if monitor == nil || !monitor.reportLoad || pConn.cpFeatures&cpFeatureLOAD == 0 {
+		return
+	}
+
+	lci := monitor.loadControlIE()
+	if lci == nil {
+		return
+	}
+
+	switch res := reply.(type) {
+	case *message.SessionEstablishmentResponse:
+		res.LoadControlInformation = lci
+	case *message.SessionModificationResponse:
+		res.LoadControlInformation = lci
+	case *message.SessionDeletionResponse:
+		res.LoadControlInformation = lci
+	}
+}
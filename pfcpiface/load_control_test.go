@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+func Test_loadMonitor(t *testing.T) {
+	var busy, total uint64
+
+	m := newLoadMonitor(Conf{LoadControl: LoadControlInfo{Enable: true, MaxSessions: 1000, Interval: "1s"}})
+	m.cpuStat = func() (uint64, uint64, bool) { return busy, total, true }
+
+	require.Nil(t, m.loadControlIE())
+
+	busy, total = 100, 1000
+	m.update(100, 0)
+
+	sample, seq := m.status()
+	require.Equal(t, loadSample{sessions: 10}, sample)
+	require.Equal(t, uint32(1), seq)
+
+	t.Run("load is that of the most utilized resource", func(t *testing.T) {
+		busy, total = 400, 1500
+		m.update(100, 0)
+
+		sample, seq := m.status()
+		require.Equal(t, loadSample{sessions: 10, cpu: 60}, sample)
+		require.Equal(t, uint32(2), seq)
+
+		busy, total = 400, 2000
+		m.update(100, 80)
+
+		sample, seq = m.status()
+		require.Equal(t, loadSample{sessions: 10, datapathQueue: 80}, sample)
+		require.Equal(t, uint32(3), seq)
+	})
+
+	t.Run("sequence number is kept while the load metric is unchanged", func(t *testing.T) {
+		busy, total = 400, 2500
+		m.update(800, 0)
+
+		sample, seq := m.status()
+		require.Equal(t, uint8(80), sample.metric())
+		require.Equal(t, uint32(3), seq)
+	})
+
+	t.Run("sessions beyond the maximum are a full load", func(t *testing.T) {
+		m.update(2000, 0)
+
+		lci := m.loadControlIE()
+		require.NotNil(t, lci)
+
+		metric, err := lci.Metric()
+		require.NoError(t, err)
+		require.Equal(t, uint8(100), metric)
+
+		seq, err := lci.SequenceNumber()
+		require.NoError(t, err)
+		require.Equal(t, uint32(4), seq)
+	})
+}
+
+func TestPFCPConn_addLoadControl(t *testing.T) {
+	monitor := newLoadMonitor(Conf{LoadControl: LoadControlInfo{Enable: true, Interval: "1s"}})
+	monitor.cpuStat = func() (uint64, uint64, bool) { return 0, 0, false }
+	monitor.update(0, 50)
+
+	pConn := &PFCPConn{upf: &upf{loadMonitor: monitor}}
+
+	seres := message.NewSessionEstablishmentResponse(0, 0, 1, 1, 0, ie.NewCause(ie.CauseRequestAccepted))
+	pConn.addLoadControl(seres)
+	require.Nil(t, seres.LoadControlInformation, "CP node without LOAD feature")
+
+	pConn.cpFeatures = cpFunctionFeatures(ie.NewCPFunctionFeatures(cpFeatureLOAD))
+	pConn.addLoadControl(seres)
+	require.NotNil(t, seres.LoadControlInformation)
+
+	metric, err := seres.LoadControlInformation.Metric()
+	require.NoError(t, err)
+	require.Equal(t, uint8(50), metric)
+}
@@ -22,6 +22,11 @@ type InMemoryStore struct {
 	// sync.Map is optimized for case when multiple goroutines
 	// read, write, and overwrite entries for disjoint sets of keys.
 	sessions sync.Map
+
+	// writeLock orders the changes seen by the watchers.
+	writeLock   sync.Mutex
+	watchers    map[int]func(sessionEvent)
+	nextWatcher int
 }
 
 func NewInMemoryStore() *InMemoryStore {
@@ -55,6 +60,10 @@ type RegisterReq struct {
 	CoreMac   string `json:"coremac"`
 	AccessMac string `json:"accessmac,omitempty"`
 	Hostname  string `json:"hostname,omitempty"`
+	// MaxSessions is the session capacity of the UPF, unlimited if zero.
+	MaxSessions uint32 `json:"maxsessions,omitempty"`
+	// Endpoints are the GTP-U endpoints of the UPF, on each of its interfaces.
+	Endpoints []gtpuEndpoint `json:"endpoints,omitempty"`
 }
 type lbtype int
 
@@ -143,7 +152,7 @@ func (pConn *PFCPConn) sendToLBer(req *http.Request) {
 	client := http.Client{
 		Timeout: 10 * time.Second,
 	}
-	for !done && retries < pConn.upf.maxReqRetries {
+	for !done && retries < pConn.timers().maxReqRetries {
 		resp, err := client.Do(req)
 		if err != nil {
 			log.Errorf("client: error making http request: %s\n", err)
@@ -163,10 +172,12 @@ func (node *PFCPNode) RegisterTolb(lb lbtype) {
 	coreMac := node.coreMac
 
 	registerReq := RegisterReq{
-		GwIP:      gatewayIP,
-		CoreMac:   coreMac,
-		AccessMac: node.accessMac,
-		Hostname:  node.hostname,
+		GwIP:        gatewayIP,
+		CoreMac:     coreMac,
+		AccessMac:   node.accessMac,
+		Hostname:    node.hostname,
+		MaxSessions: node.upf.sessionLimit.max,
+		Endpoints:   node.upf.gtpuEndpoints(),
 	}
 
 	registerReqJson, _ := json.Marshal(registerReq)
@@ -216,7 +227,11 @@ func (i *InMemoryStore) PutSession(session PFCPSession, pConn *PFCPConn, pushPDR
 		return ErrInvalidArgument("session.localSEID", session.localSEID)
 	}
 
+	i.writeLock.Lock()
+	_, exists := i.sessions.Load(session.localSEID)
 	i.sessions.Store(session.localSEID, session)
+	i.notify(sessionEvent{fseid: session.localSEID, session: session, created: !exists})
+	i.writeLock.Unlock()
 
 	log.WithFields(log.Fields{
 		"session": session,
@@ -233,11 +248,13 @@ func (i *InMemoryStore) PutSession(session PFCPSession, pConn *PFCPConn, pushPDR
 						break
 					}
 				}
+				pConn.sentIpsLock.Lock()
 				if _, ok := pConn.sentIpsToRouters[p.ueAddress]; !ok && !exists {
 					uEAddresses = append(uEAddresses, p.ueAddress)
 					pConn.sentIpsToRouters[p.ueAddress] = struct{}{}
 
 				}
+				pConn.sentIpsLock.Unlock()
 			}
 			if msgType == message.MsgTypeSessionModificationRequest {
 				time.Sleep(2 * time.Second)
@@ -250,7 +267,12 @@ func (i *InMemoryStore) PutSession(session PFCPSession, pConn *PFCPConn, pushPDR
 
 func (i *InMemoryStore) DeleteSession(fseid uint64, pConn *PFCPConn) error {
 
-	i.sessions.Delete(fseid)
+	i.writeLock.Lock()
+	// Only the removal of a stored session is a change.
+	if _, ok := i.sessions.LoadAndDelete(fseid); ok {
+		i.notify(sessionEvent{deleted: true, fseid: fseid})
+	}
+	i.writeLock.Unlock()
 
 	log.WithFields(log.Fields{
 		"F-SEID": fseid,
@@ -260,8 +282,13 @@ func (i *InMemoryStore) DeleteSession(fseid uint64, pConn *PFCPConn) error {
 }
 
 func (i *InMemoryStore) DeleteAllSessions() bool {
+	i.writeLock.Lock()
+	defer i.writeLock.Unlock()
+
 	i.sessions.Range(func(key, value interface{}) bool {
 		i.sessions.Delete(key)
+		i.notify(sessionEvent{deleted: true, fseid: key.(uint64)})
+
 		return true
 	})
 
@@ -287,3 +314,30 @@ func (i *InMemoryStore) GetSession(fseid uint64) (PFCPSession, bool) {
 
 	return session, ok
 }
+
+func (i *InMemoryStore) Watch(fn func(sessionEvent)) func() {
+	i.writeLock.Lock()
+	defer i.writeLock.Unlock()
+
+	if i.watchers == nil {
+		i.watchers = make(map[int]func(sessionEvent))
+	}
+
+	id := i.nextWatcher
+	i.nextWatcher++
+	i.watchers[id] = fn
+
+	return func() {
+		i.writeLock.Lock()
+		defer i.writeLock.Unlock()
+
+		delete(i.watchers, id)
+	}
+}
+
+// notify calls the watchers with event. The caller holds writeLock.
+func (i *InMemoryStore) notify(event sessionEvent) {
+	for _, fn := range i.watchers {
+		fn(event)
+	}
+}
@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+var errLocalSwitchingDisabled = errors.New("local switching is not enabled")
+
+// SwitchesLocally returns true if the FAR forwards to another UE of the 5G VN group of
+// the session, within the UPF rather than via N6.
+func (f *far) SwitchesLocally() bool {
+	return f.Forwards() && f.dstIntf == ie.DstInterface5GVNInternal
+}
+
+// checkLocalSwitching rejects a FAR forwarding to the 5G VN internal interface unless
+// local switching is enabled.
+func (f *far) checkLocalSwitching(upf *upf) error {
+	if !f.SwitchesLocally() || upf.localSwitching {
+		return nil
+	}
+
+	return fmt.Errorf("%w: FAR %v forwards to 5G VN internal", errLocalSwitchingDisabled, f.farID)
+}
+
+// validateLocalSwitching checks the 5G VN groups switched by UE subnet, which the BESS
+// pipeline loads from the config.
+func validateLocalSwitching(conf Conf, errs *confErrors) {
+	s := conf.LocalSwitching
+	if !s.Enable {
+		return
+	}
+
+	if conf.EnableP4rt || (conf.Datapath != "" && conf.Datapath != datapathBESS && conf.Datapath != datapathFake) {
+		errs.add(ErrInvalidArgumentWithReason("conf.LocalSwitching", s, "only supported by the BESS and fake datapaths"))
+	}
+
+	names := make(map[string]bool)
+
+	for _, g := range s.Groups {
+		if g.Name == "" || names[g.Name] {
+			errs.add(ErrInvalidArgumentWithReason("conf.LocalSwitching.Groups", g.Name, "empty or duplicate group name"))
+		}
+
+		names[g.Name] = true
+
+		if len(g.UESubnets) == 0 {
+			errs.add(ErrInvalidArgumentWithReason("conf.LocalSwitching.Groups", g.Name, "no UE subnet"))
+		}
+
+		for _, subnet := range g.UESubnets {
+			if ip, _, err := net.ParseCIDR(subnet); err != nil || ip.To4() == nil {
+				errs.add(ErrInvalidArgumentWithReason("conf.LocalSwitching.Groups.UESubnets", subnet, "must be an IPv4 CIDR"))
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func TestParseFARLocalSwitching(t *testing.T) {
+	farIE := ie.NewCreateFAR(
+		ie.NewFARID(3),
+		ie.NewApplyAction(ActionForward),
+		ie.NewForwardingParameters(
+			ie.NewDestinationInterface(ie.DstInterface5GVNInternal),
+			ie.NewNetworkInstance("vn-group-1"),
+		),
+	)
+
+	var f far
+
+	err := f.parseFAR(farIE, 1, &upf{}, create)
+	require.ErrorIs(t, err, errLocalSwitchingDisabled)
+
+	f = far{}
+	require.NoError(t, f.parseFAR(farIE, 1, &upf{localSwitching: true}, create))
+	require.True(t, f.SwitchesLocally())
+	require.Equal(t, uint32(0), f.tunnelIP4Src)
+	require.Equal(t, uint8(farLocalSwitch), (&bess{}).setActionValue(f))
+
+	f.applyAction = ActionBuffer | ActionNotify
+	require.False(t, f.SwitchesLocally())
+}
+
+func TestParseSourceInterface5GVNInternal(t *testing.T) {
+	var p pdr
+
+	require.NoError(t, p.parseSourceInterfaceIE(ie.NewSourceInterface(ie.SrcInterface5GVNInternal)))
+	require.Equal(t, uint8(core), p.srcIface)
+}
+
+func TestValidateLocalSwitching(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		conf  Conf
+		valid bool
+	}{
+		{
+			name:  "disabled",
+			conf:  Conf{Datapath: datapathXDP},
+			valid: true,
+		},
+		{
+			name: "groups",
+			conf: Conf{LocalSwitching: LocalSwitchingInfo{Enable: true, Groups: []VNGroupInfo{
+				{Name: "factory", UESubnets: []string{"10.250.0.0/24", "10.250.1.0/24"}},
+				{Name: "office", UESubnets: []string{"10.251.0.0/24"}},
+			}}},
+			valid: true,
+		},
+		{
+			name:  "P4 datapath",
+			conf:  Conf{EnableP4rt: true, LocalSwitching: LocalSwitchingInfo{Enable: true}},
+			valid: false,
+		},
+		{
+			name: "duplicate group",
+			conf: Conf{LocalSwitching: LocalSwitchingInfo{Enable: true, Groups: []VNGroupInfo{
+				{Name: "factory", UESubnets: []string{"10.250.0.0/24"}},
+				{Name: "factory", UESubnets: []string{"10.251.0.0/24"}},
+			}}},
+			valid: false,
+		},
+		{
+			name: "invalid subnet",
+			conf: Conf{LocalSwitching: LocalSwitchingInfo{Enable: true, Groups: []VNGroupInfo{
+				{Name: "factory", UESubnets: []string{"2001:db8::/64"}},
+			}}},
+			valid: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var errs confErrors
+
+			validateLocalSwitching(tc.conf, &errs)
+
+			if tc.valid {
+				require.NoError(t, errs.err())
+			} else {
+				require.Error(t, errs.err())
+			}
+		})
+	}
+}
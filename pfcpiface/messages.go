@@ -8,6 +8,7 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
 	"github.com/wmnsk/go-pfcp/message"
 
 	"github.com/omec-project/upf-epc/pfcpiface/metrics"
@@ -24,6 +25,10 @@ func (e *HandlePFCPMsgError) Error() string {
 	return "Error during " + e.Op + ": " + e.Err.Error()
 }
 
+func (e *HandlePFCPMsgError) Unwrap() error {
+	return e.Err
+}
+
 func errUnmarshal(err error) *HandlePFCPMsgError {
 	return &HandlePFCPMsgError{Op: "Unmarshal", Err: err}
 }
@@ -56,20 +61,96 @@ func (r *Request) GetResponse(done <-chan struct{}, respDuration time.Duration)
 
 // HandlePFCPMsg handles different types of PFCP messages.
 func (pConn *PFCPConn) HandlePFCPMsg(buf []byte) {
-	var (
-		reply message.Message
-		err   error
-	)
+	pConn.handlePFCPMsg(buf, nil)
+}
+
+// handlePFCPMsg handles the PFCP message in buf. pooled is returned to the pool once
+// the message is handled, unless nil.
+func (pConn *PFCPConn) handlePFCPMsg(buf []byte, pooled *[]byte) {
+	pConn.trace.record(false, buf)
 
 	msg, err := message.Parse(buf)
 	if err != nil {
-		log.Errorln("Ignoring undecodable message: ", buf, " error: ", err)
+		pConn.rejectUndecodable(buf, err)
+		pConn.releasePFCPBuf(pooled)
+
+		return
+	}
+
+	if retainsPFCPBuf(msg.MessageType()) {
+		pooled = nil
+	}
+
+	if !pConn.acceptPFCPMsg(buf, msg) {
+		pConn.releasePFCPBuf(pooled)
+		return
+	}
+
+	// Dispatched messages release their buffer once handled by their worker.
+	if pConn.workers != nil && pConn.workers.dispatch(msg, pooled) {
 		return
 	}
 
+	pConn.processPFCPMsg(msg)
+	pConn.releasePFCPBuf(pooled)
+}
+
+func (pConn *PFCPConn) releasePFCPBuf(pooled *[]byte) {
+	if pooled != nil {
+		putPFCPBuf(pooled)
+	}
+}
+
+// acceptPFCPMsg answers retransmitted, throttled and malformed messages, and returns
+// whether msg remains to be handled.
+func (pConn *PFCPConn) acceptPFCPMsg(buf []byte, msg message.Message) bool {
+	if reply, ok := pConn.responses.lookup(msg, time.Now()); ok {
+		log.Debugln("Retransmitted", msg.MessageTypeName(), "from", pConn.RemoteAddr(),
+			"with sequence number", msg.Sequence(), "answered again")
+		pConn.SendPFCPMsg(reply)
+
+		return false
+	}
+
+	if reply, throttled := pConn.throttle(msg); throttled {
+		if reply != nil {
+			pConn.SendPFCPMsg(reply)
+		}
+
+		return false
+	}
+
+	if malformed := validateMessage(buf, msg); malformed != nil {
+		pConn.rejectMalformed(msg, malformed)
+		return false
+	}
+
+	// The request may have been retransmitted while the original was queued or handled.
+	if reply, retransmitted := pConn.responses.start(msg, time.Now()); retransmitted {
+		if reply != nil {
+			pConn.SendPFCPMsg(reply)
+		} else {
+			log.Debugln("Retransmitted", msg.MessageTypeName(), "from", pConn.RemoteAddr(),
+				"with sequence number", msg.Sequence(), "dropped, the original is being handled")
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// processPFCPMsg handles a parsed and validated PFCP message, and sends its reply.
+func (pConn *PFCPConn) processPFCPMsg(msg message.Message) {
+	var (
+		reply message.Message
+		err   error
+	)
+
 	addr := pConn.RemoteAddr().String()
 	msgType := msg.MessageTypeName()
 	m := metrics.NewMessage(msgType, "Incoming")
+	events := pConn.sessionEvents(msg)
 
 	switch msg.MessageType() {
 	// Connection related messages
@@ -95,12 +176,15 @@ func (pConn *PFCPConn) HandlePFCPMsg(buf []byte) {
 		reply, err = pConn.handleSessionModificationRequest(msg)
 	case message.MsgTypeSessionDeletionRequest:
 		reply, err = pConn.handleSessionDeletionRequest(msg)
+	case message.MsgTypeSessionSetDeletionRequest:
+		reply, err = pConn.handleSessionSetDeletionRequest(msg)
 	case message.MsgTypeSessionReportResponse:
 		err = pConn.handleSessionReportResponse(msg)
 
 	// Incoming response messages
 	// TODO: Session Report Request
-	case message.MsgTypeAssociationSetupResponse, message.MsgTypeHeartbeatResponse:
+	case message.MsgTypeAssociationSetupResponse, message.MsgTypeAssociationUpdateResponse,
+		message.MsgTypeHeartbeatResponse, message.MsgTypeNodeReportResponse:
 		pConn.handleIncomingResponse(msg)
 
 	default:
@@ -120,11 +204,74 @@ func (pConn *PFCPConn) HandlePFCPMsg(buf []byte) {
 
 	pConn.SaveMessages(m)
 
+	if events != nil {
+		events(reply)
+	}
+
+	if reply != nil {
+		pConn.addLoadControl(reply)
+		pConn.addOverloadControl(reply)
+	}
+
+	pConn.responses.store(msg, reply, time.Now())
+
 	if reply != nil {
 		pConn.SendPFCPMsg(reply)
 	}
 }
 
+// causeReply returns the response rejecting the request msg with cause, and the
+// offending IE if not nil. Nil for requests answered without a cause.
+func (pConn *PFCPConn) causeReply(msg message.Message, causeValue uint8, offendingIE *ie.IE) message.Message {
+	cause := ie.NewCause(causeValue)
+
+	// The constructors of go-pfcp do not all skip nil IEs.
+	var optional []*ie.IE
+	if offendingIE != nil {
+		optional = append(optional, offendingIE)
+	}
+
+	// The response carries the SEID of the CP node for the session, if known.
+	remoteSEID := func(localSEID uint64) uint64 {
+		if session, ok := pConn.store.GetSession(localSEID); ok {
+			return session.remoteSEID
+		}
+
+		return 0
+	}
+
+	switch req := msg.(type) {
+	case *message.AssociationSetupRequest:
+		return message.NewAssociationSetupResponse(req.SequenceNumber,
+			append([]*ie.IE{pConn.nodeID.localIE, cause}, optional...)...)
+	case *message.AssociationReleaseRequest:
+		return message.NewAssociationReleaseResponse(req.SequenceNumber, pConn.nodeID.localIE, cause, optional...)
+	case *message.SessionEstablishmentRequest:
+		var seid uint64
+
+		if req.CPFSEID != nil {
+			if fseid, err := req.CPFSEID.FSEID(); err == nil {
+				seid = fseid.SEID
+			}
+		}
+
+		return message.NewSessionEstablishmentResponse(0, 0, seid, req.SequenceNumber,
+			req.Header.MessagePriority, append([]*ie.IE{pConn.nodeID.localIE, cause}, optional...)...)
+	case *message.SessionModificationRequest:
+		return message.NewSessionModificationResponse(0, 0, remoteSEID(req.SEID()), req.SequenceNumber,
+			req.Header.MessagePriority, append([]*ie.IE{cause}, optional...)...)
+	case *message.SessionDeletionRequest:
+		return message.NewSessionDeletionResponse(0, 0, remoteSEID(req.SEID()), req.SequenceNumber,
+			req.Header.MessagePriority, append([]*ie.IE{cause}, optional...)...)
+	case *message.SessionSetDeletionRequest:
+		return message.NewSessionSetDeletionResponse(req.SequenceNumber, pConn.nodeID.localIE, cause, offendingIE)
+	case *message.PFDManagementRequest:
+		return message.NewPFDManagementResponse(req.SequenceNumber, cause, offendingIE)
+	}
+
+	return nil
+}
+
 func (pConn *PFCPConn) SendPFCPMsg(msg message.Message) {
 	addr := pConn.RemoteAddr().String()
 	nodeID := pConn.nodeID.remote
@@ -133,16 +280,19 @@ func (pConn *PFCPConn) SendPFCPMsg(msg message.Message) {
 	m := metrics.NewMessage(msgType, "Outgoing")
 	defer pConn.SaveMessages(m)
 
-	out := make([]byte, msg.MarshalLen())
+	out := getPFCPBuf(msg.MarshalLen())
+	defer putPFCPBuf(out)
 
-	if err := msg.MarshalTo(out); err != nil {
+	if err := msg.MarshalTo(*out); err != nil {
 		m.Finish(nodeID, "Failure")
 		log.Errorln("Failed to marshal", msgType, "for", addr, err)
 
 		return
 	}
 
-	if _, err := pConn.Write(out); err != nil {
+	pConn.trace.record(true, *out)
+
+	if _, err := pConn.Write(*out); err != nil {
 		m.Finish(nodeID, "Failure")
 		log.Errorln("Failed to transmit", msgType, "to", addr, err)
 
@@ -156,20 +306,32 @@ func (pConn *PFCPConn) SendPFCPMsg(msg message.Message) {
 func (pConn *PFCPConn) sendPFCPRequestMessage(r *Request) (message.Message, bool) {
 	pConn.pendingReqs.Store(r.msg.Sequence(), r)
 
+	sent := time.Now()
+
 	pConn.SendPFCPMsg(r.msg)
-	retriesLeft := pConn.upf.maxReqRetries
+	timers := pConn.timers()
+	retriesLeft := timers.maxReqRetries
+	respTimeout := pConn.rtt.respTimeout(timers)
 
 	for {
-		if reply, rc := r.GetResponse(pConn.shutdown, pConn.upf.respTimeout); rc {
+		if reply, rc := r.GetResponse(pConn.shutdown, respTimeout); rc {
 			log.Traceln("Request Timeout, retriesLeft:", retriesLeft)
 
 			if retriesLeft > 0 {
+				pConn.SaveRetransmission(pConn.nodeID.remote, r.msg.MessageTypeName())
 				pConn.SendPFCPMsg(r.msg)
 				retriesLeft--
+				respTimeout = backoff(respTimeout, timers)
 			} else {
+				pConn.SaveRequestTimeout(pConn.nodeID.remote, r.msg.MessageTypeName())
 				return nil, true
 			}
 		} else {
+			// Replies to retransmitted requests can't be matched to a transmission.
+			if reply != nil && retriesLeft == timers.maxReqRetries {
+				pConn.rtt.sample(time.Since(sent))
+			}
+
 			return reply, false
 		}
 	}
@@ -5,15 +5,18 @@ package pfcpiface
 
 import (
 	"errors"
+	"net"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/wmnsk/go-pfcp/ie"
 	"github.com/wmnsk/go-pfcp/message"
 )
 
-var errFlowDescAbsent = errors.New("flow description not present")
 var errDatapathDown = errors.New("datapath down")
 var errReqRejected = errors.New("request rejected")
+var errPeerNotAllowed = errors.New("peer not allowed")
+var errReqTimeout = errors.New("request timed out")
+var errConnShutdown = errors.New("connection shut down")
 
 func (pConn *PFCPConn) sendAssociationRequest() {
 	// Build request message
@@ -71,7 +74,16 @@ func (pConn *PFCPConn) handleHeartbeatRequest(msg message.Message) (message.Mess
 		}
 	}
 
-	// TODO: Check and update remote recovery timestamp
+	if hbreq.RecoveryTimeStamp != nil {
+		ts, err := hbreq.RecoveryTimeStamp.RecoveryTimeStamp()
+		if err != nil {
+			return nil, errUnmarshal(err)
+		}
+
+		// Heartbeats are answered right away, the sessions of a restarted peer are
+		// purged after the messages received before.
+		pConn.inOrder(func() { pConn.updateRemoteRecoveryTS(ts) })
+	}
 
 	// Build response message
 	hbres := message.NewHeartbeatResponse(hbreq.SequenceNumber,
@@ -81,6 +93,24 @@ func (pConn *PFCPConn) handleHeartbeatRequest(msg message.Message) (message.Mess
 	return hbres, nil
 }
 
+func (pConn *PFCPConn) handleHeartbeatResponse(msg message.Message) error {
+	hbres, ok := msg.(*message.HeartbeatResponse)
+	if !ok {
+		return errUnmarshal(errMsgUnexpectedType)
+	}
+
+	if hbres.RecoveryTimeStamp != nil {
+		ts, err := hbres.RecoveryTimeStamp.RecoveryTimeStamp()
+		if err != nil {
+			return errUnmarshal(err)
+		}
+
+		pConn.inOrder(func() { pConn.updateRemoteRecoveryTS(ts) })
+	}
+
+	return nil
+}
+
 func (pConn *PFCPConn) handleIncomingResponse(msg message.Message) {
 	req, ok := pConn.pendingReqs.Load(msg.Sequence())
 
@@ -101,27 +131,116 @@ func (pConn *PFCPConn) associationIEs() []*ie.IE {
 		flags = uint8(0x61)
 	}
 
+	ies := []*ie.IE{
+		ie.NewRecoveryTimeStamp(pConn.ts.local),
+		pConn.nodeID.localIE,
+		// 0x41 = Spare (0) | Assoc Src Inst (1) | Assoc Net Inst (0) | Tied Range (000) | IPV6 (0) | IPV4 (1)
+		//      = 01000001
+		ie.NewUserPlaneIPResourceInformation(flags, 0, upf.AccessIP.String(), "", networkInstance, ie.SrcInterfaceAccess),
+	}
+
+	// An I-UPF also terminates the N9 tunnels from the PSAs on the core side.
+	if upf.role == roleIUPF {
+		ies = append(ies, ie.NewUserPlaneIPResourceInformation(flags, 0, upf.CoreIP.String(), "", networkInstance,
+			ie.SrcInterfaceCore))
+	}
+
+	// The access resources are advertised for the Network Instance of each DNN served.
+	for _, d := range upf.dnnInfos {
+		if d.networkInstance() == upf.Dnn {
+			continue
+		}
+
+		ies = append(ies, ie.NewUserPlaneIPResourceInformation(0x61, 0, upf.AccessIP.String(), "",
+			string(ie.NewNetworkInstanceFQDN(d.networkInstance()).Payload), ie.SrcInterfaceAccess))
+	}
+
+	// So is the interface of each Network Instance with an IP of its own, e.g. toward the
+	// gNBs of another subnet. Those on the core side only serve an I-UPF.
+	for _, e := range upf.nis.endpoints() {
+		srcIntf := uint8(ie.SrcInterfaceAccess)
+
+		if e.Interface == niInterfaceCore {
+			if upf.role != roleIUPF {
+				continue
+			}
+
+			srcIntf = ie.SrcInterfaceCore
+		}
+
+		ies = append(ies, ie.NewUserPlaneIPResourceInformation(0x61, 0, e.IP, "",
+			string(ie.NewNetworkInstanceFQDN(e.NetworkInstance).Payload), srcIntf))
+	}
+
+	return append(ies, upf.upFunctionFeatures())
+}
+
+// upFunctionFeatures builds the UP Function Features IE from the features enabled in the UPF.
+func (u *upf) upFunctionFeatures() *ie.IE {
 	features := make([]uint8, 4)
 
-	if upf.EnableUeIPAlloc {
+	if u.EnableUeIPAlloc {
 		setUeipFeature(features...)
 	}
 
-	if upf.EnableEndMarker {
+	if u.EnableEndMarker {
 		setEndMarkerFeature(features...)
 	}
 
-	ies := []*ie.IE{
-		ie.NewRecoveryTimeStamp(pConn.ts.local),
-		pConn.nodeID.localIE,
-		// 0x41 = Spare (0) | Assoc Src Inst (1) | Assoc Net Inst (0) | Tied Range (000) | IPV6 (0) | IPV4 (1)
-		//      = 01000001
-		ie.NewUserPlaneIPResourceInformation(flags, 0, upf.AccessIP.String(), "", networkInstance, ie.SrcInterfaceAccess),
-		//ie.NewUserPlaneIPResourceInformation(flags, 0, upf.CoreIP.String(), "", networkInstance, ie.SrcInterfaceCore),
-		ie.NewUPFunctionFeatures(features...),
+	if u.teidPool != nil {
+		setFTUPFeature(features...)
 	}
 
-	return ies
+	// QoS flow packet delays are measured on the GTP-U paths (QFQM).
+	if u.pathMonitor != nil {
+		features = append(features, 0)
+		setQFQMFeature(features...)
+	}
+
+	return ie.NewUPFunctionFeatures(features...)
+}
+
+// sendAssociationUpdateRequest sends an Association Update Request carrying the given IEs
+// and waits for the response. Retransmissions follow resp_timeout and max_req_retries.
+func (pConn *PFCPConn) sendAssociationUpdateRequest(ies ...*ie.IE) error {
+	aureq := message.NewAssociationUpdateRequest(pConn.getSeqNum(),
+		append([]*ie.IE{pConn.nodeID.localIE}, ies...)...,
+	)
+
+	r := newRequest(aureq)
+	reply, timeout := pConn.sendPFCPRequestMessage(r)
+
+	if timeout {
+		return errReqTimeout
+	}
+
+	if reply == nil {
+		return errConnShutdown
+	}
+
+	return pConn.handleAssociationUpdateResponse(reply)
+}
+
+func (pConn *PFCPConn) handleAssociationUpdateResponse(msg message.Message) error {
+	aures, ok := msg.(*message.AssociationUpdateResponse)
+	if !ok {
+		return errUnmarshal(errMsgUnexpectedType)
+	}
+
+	cause, err := aures.Cause.Cause()
+	if err != nil {
+		return errUnmarshal(err)
+	}
+
+	if cause != ie.CauseRequestAccepted {
+		log.Errorln("Association Update Response from", pConn.RemoteAddr(),
+			"with Cause:", cause)
+		return errReqRejected
+	}
+
+	log.Infoln("Association update accepted by", pConn.nodeID.remote)
+
+	return nil
 }
 
 func (pConn *PFCPConn) handleAssociationSetupRequest(msg message.Message) (message.Message, error) {
@@ -147,28 +266,42 @@ func (pConn *PFCPConn) handleAssociationSetupRequest(msg message.Message) (messa
 	asres := message.NewAssociationSetupResponse(asreq.SequenceNumber,
 		pConn.associationIEs()...)
 
+	if rAddr, ok := pConn.RemoteAddr().(*net.UDPAddr); ok && !upf.getPeerACL().allows(rAddr.IP) {
+		log.Warnln("Association Setup Request from", addr, "with Node ID", nodeID, "not in allowed peers")
+
+		asres.Cause = ie.NewCause(ie.CauseRequestRejected)
+
+		return asres, errProcess(errPeerNotAllowed)
+	}
+
 	if !upf.isConnected() {
 		asres.Cause = ie.NewCause(ie.CauseRequestRejected)
 		return asres, errProcess(errDatapathDown)
 	}
 
-	if pConn.ts.remote.IsZero() {
-		pConn.ts.remote = ts
+	if pConn.ts.getRemote().IsZero() {
 		log.Infoln("Association Setup Request from", addr,
 			"with recovery timestamp:", ts)
-	} else if ts.After(pConn.ts.remote) {
-		old := pConn.ts.remote
-		pConn.ts.remote = ts
+	} else if ts.After(pConn.ts.getRemote()) {
 		log.Warnln("Association Setup Request from", addr,
-			"with newer recovery timestamp:", ts, "older:", old)
+			"with newer recovery timestamp:", ts, "older:", pConn.ts.getRemote())
 	}
 
+	pConn.updateRemoteRecoveryTS(ts)
+
 	pConn.nodeID.remote = nodeID
+	pConn.cpFeatures = cpFunctionFeatures(asreq.CPFunctionFeatures)
 	asres.Cause = ie.NewCause(ie.CauseRequestAccepted)
 
 	log.Infoln("Association setup done between nodes",
 		"local:", pConn.nodeID.local, "remote:", pConn.nodeID.remote)
 
+	pConn.upf.associations.up(pConn.nodeID.remote, pConn.ts.getRemote())
+	pConn.upf.recovery.associated(pConn.RemoteAddr(), pConn.nodeID.remote)
+	pConn.assocLoss.regained("")
+	pConn.releaseRestoredTEIDs()
+	pConn.notifyWebhooks(webhookEvent{Event: webhookAssociationUp})
+
 	return asres, nil
 }
 
@@ -201,21 +334,27 @@ func (pConn *PFCPConn) handleAssociationSetupResponse(msg message.Message) error
 		return errUnmarshal(err)
 	}
 
-	if pConn.ts.remote.IsZero() {
-		pConn.ts.remote = ts
+	if pConn.ts.getRemote().IsZero() {
 		log.Infoln("Association Setup Response from", addr,
 			"with recovery timestamp:", ts)
-	} else if ts.After(pConn.ts.remote) {
-		old := pConn.ts.remote
-		pConn.ts.remote = ts
+	} else if ts.After(pConn.ts.getRemote()) {
 		log.Warnln("Association Setup Response from", addr,
-			"with newer recovery timestamp:", ts, "older:", old)
+			"with newer recovery timestamp:", ts, "older:", pConn.ts.getRemote())
 	}
 
+	pConn.updateRemoteRecoveryTS(ts)
+
 	pConn.nodeID.remote = nodeID
+	pConn.cpFeatures = cpFunctionFeatures(asres.CPFunctionFeatures)
 	log.Infoln("Association setup done between nodes",
 		"local:", pConn.nodeID.local, "remote:", pConn.nodeID.remote)
 
+	pConn.upf.associations.up(pConn.nodeID.remote, pConn.ts.getRemote())
+	pConn.upf.recovery.associated(pConn.RemoteAddr(), pConn.nodeID.remote)
+	pConn.assocLoss.regained("")
+	pConn.releaseRestoredTEIDs()
+	pConn.notifyWebhooks(webhookEvent{Event: webhookAssociationUp})
+
 	return nil
 }
 
@@ -232,6 +371,10 @@ func (pConn *PFCPConn) handleAssociationReleaseRequest(msg message.Message) (mes
 		ie.NewCause(ie.CauseRequestAccepted),
 	)
 
+	// The CP node is expected to have deleted its sessions, those left are orphaned.
+	pConn.assocLoss.lost(orphanReleased)
+	pConn.upf.recovery.released(pConn.RemoteAddr())
+
 	return arres, nil
 }
 
@@ -241,15 +384,8 @@ func (pConn *PFCPConn) handlePFDMgmtRequest(msg message.Message) (message.Messag
 		return nil, errUnmarshal(errMsgUnexpectedType)
 	}
 
-	currentAppPFDs := pConn.appPFDs
-
-	// On every PFD management request reset existing contents
-	// TODO: Analyse impact on PDRs referencing these IDs
-	pConn.ResetAppPFDs()
-
-	errUnmarshalReply := func(err error, offendingIE *ie.IE) (message.Message, error) {
-		// Revert the map to original contents
-		pConn.appPFDs = currentAppPFDs
+	replaced, offendingIE, err := pConn.applyPFDMgmtRequest(pfdmreq)
+	if err != nil {
 		// Build response message
 		pfdres := message.NewPFDManagementResponse(pfdmreq.SequenceNumber,
 			ie.NewCause(ie.CauseRequestRejected),
@@ -259,38 +395,8 @@ func (pConn *PFCPConn) handlePFDMgmtRequest(msg message.Message) (message.Messag
 		return pfdres, errUnmarshal(err)
 	}
 
-	for _, appIDPFD := range pfdmreq.ApplicationIDsPFDs {
-		id, err := appIDPFD.ApplicationID()
-		if err != nil {
-			return errUnmarshalReply(err, appIDPFD)
-		}
-
-		pConn.NewAppPFD(id)
-		appPFD := pConn.appPFDs[id]
-
-		pfdCtx, err := appIDPFD.PFDContext()
-		if err != nil {
-			pConn.RemoveAppPFD(id)
-			return errUnmarshalReply(err, appIDPFD)
-		}
-
-		for _, pfdContent := range pfdCtx {
-			fields, err := pfdContent.PFDContents()
-			if err != nil {
-				pConn.RemoveAppPFD(id)
-				return errUnmarshalReply(err, appIDPFD)
-			}
-
-			if fields.FlowDescription == "" {
-				return errUnmarshalReply(errFlowDescAbsent, appIDPFD)
-			}
-
-			appPFD.flowDescs = append(appPFD.flowDescs, fields.FlowDescription)
-		}
-
-		pConn.appPFDs[id] = appPFD
-		log.Traceln("Flow descriptions for AppID", id, ":", appPFD.flowDescs)
-	}
+	// PDRs referencing the replaced applications are classified on their new PFDs
+	pConn.recompileAppPDRs(replaced)
 
 	// Build response message
 	pfdres := message.NewPFDManagementResponse(pfdmreq.SequenceNumber,
@@ -0,0 +1,247 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+// newTestAssociation adds to node a connection associated with a fake CP node at ip,
+// answering the Association Update Requests with cause. The requests received by the
+// CP node are returned.
+func newTestAssociation(t *testing.T, node *PFCPNode, ip string, cause uint8) <-chan *message.AssociationUpdateRequest {
+	cp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(ip)})
+	require.NoError(t, err)
+	t.Cleanup(func() { cp.Close() })
+
+	conn, err := net.Dial("udp", cp.LocalAddr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	requests := make(chan *message.AssociationUpdateRequest, 10)
+
+	go func() {
+		buf := make([]byte, maxPFCPMsgSize)
+
+		for {
+			n, addr, err := cp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			req, ok := parseTestMessage(buf[:n]).(*message.AssociationUpdateRequest)
+			if !ok {
+				continue
+			}
+
+			requests <- req
+
+			reply := message.NewAssociationUpdateResponse(req.Sequence(), ie.NewNodeID(ip, "", ""), ie.NewCause(cause))
+
+			b := make([]byte, reply.MarshalLen())
+			if reply.MarshalTo(b) == nil {
+				_, _ = cp.WriteTo(b, addr)
+			}
+		}
+	}()
+
+	pConn := &PFCPConn{
+		Conn:           conn,
+		upf:            node.upf,
+		shutdown:       make(chan struct{}),
+		InstrumentPFCP: &ddnMetrics{},
+	}
+	pConn.nodeID.localIE = ie.NewNodeID("198.18.0.1", "", "")
+	pConn.nodeID.remote = ip
+
+	go func() {
+		buf := make([]byte, maxPFCPMsgSize)
+
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+
+			if msg := parseTestMessage(buf[:n]); msg != nil {
+				pConn.handleIncomingResponse(msg)
+			}
+		}
+	}()
+
+	node.pConns.Store(conn.LocalAddr().String(), pConn)
+
+	return requests
+}
+
+// parseTestMessage returns the PFCP message of b, nil if invalid.
+func parseTestMessage(b []byte) message.Message {
+	msg, err := message.Parse(b)
+	if err != nil {
+		return nil
+	}
+
+	return msg
+}
+
+// receiveAssociationUpdate returns the next request of requests, nil if none is received
+// within timeout.
+func receiveAssociationUpdate(requests <-chan *message.AssociationUpdateRequest, timeout time.Duration) *message.AssociationUpdateRequest {
+	select {
+	case req := <-requests:
+		return req
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+func TestPFCPConn_associationIEs(t *testing.T) {
+	resources := func(u *upf) []*ie.IE {
+		pConn := &PFCPConn{upf: u}
+		pConn.nodeID.localIE = ie.NewNodeID("198.18.0.1", "", "")
+
+		var ies []*ie.IE
+
+		for _, i := range pConn.associationIEs() {
+			if i.Type == ie.UserPlaneIPResourceInformation {
+				ies = append(ies, i)
+			}
+		}
+
+		return ies
+	}
+
+	u := &upf{AccessIP: net.ParseIP("198.18.0.1"), CoreIP: net.ParseIP("198.19.0.1"), role: rolePSA, Dnn: "internet"}
+	require.Len(t, resources(u), 1)
+
+	u.dnnInfos = []DNNInfo{{Dnn: "internet"}, {Dnn: "ims", NetworkInstance: "ims.mnc001.mcc001.gprs"}}
+	ies := resources(u)
+	require.Len(t, ies, 2, "one per network instance")
+
+	// The parser of go-pfcp reads past the IE with a Source Interface, the fields are
+	// checked in the payload: flags, IPv4 address, Network Instance, Source Interface.
+	payload := ies[1].Payload
+	networkInstance := ie.NewNetworkInstance(string(payload[5 : len(payload)-1]))
+	require.Equal(t, "ims.mnc001.mcc001.gprs", networkInstanceName(networkInstance))
+
+	u.role = roleIUPF
+	ies = resources(u)
+	require.Len(t, ies, 3)
+
+	payload = ies[1].Payload
+	require.Equal(t, ie.SrcInterfaceCore, payload[len(payload)-1]&0x0f, "an I-UPF terminates N9 tunnels")
+	require.Equal(t, "198.19.0.1", net.IP(payload[1:5]).String())
+
+	u.nis = newNITable([]NetworkInstanceInfo{
+		{NetworkInstance: "n3-site2", Interface: niInterfaceAccess, IP: "198.18.1.1"},
+		{NetworkInstance: "n9", Interface: niInterfaceCore, IP: "198.19.1.1"},
+		{NetworkInstance: "n6", Interface: niInterfaceCore},
+	})
+	ies = resources(u)
+	require.Len(t, ies, 5, "one per network instance with an IP")
+
+	payload = ies[3].Payload
+	require.Equal(t, "198.18.1.1", net.IP(payload[1:5]).String())
+	require.Equal(t, ie.SrcInterfaceAccess, payload[len(payload)-1]&0x0f)
+	require.Equal(t, "n3-site2", networkInstanceName(ie.NewNetworkInstance(string(payload[5:len(payload)-1]))))
+
+	u.role = rolePSA
+	require.Len(t, resources(u), 3, "the core endpoints only serve an I-UPF")
+}
+
+func TestUPF_gtpuEndpoints(t *testing.T) {
+	u := &upf{
+		AccessIP: net.ParseIP("198.18.0.1"),
+		CoreIP:   net.ParseIP("198.19.0.1"),
+		nis: newNITable([]NetworkInstanceInfo{
+			{NetworkInstance: "n3-site2", Interface: niInterfaceAccess, IP: "198.18.1.1"},
+			{NetworkInstance: "n6", Interface: niInterfaceCore},
+		}),
+	}
+
+	require.Equal(t, []gtpuEndpoint{
+		{Interface: niInterfaceAccess, IP: "198.18.0.1"},
+		{Interface: niInterfaceCore, IP: "198.19.0.1"},
+		{Interface: niInterfaceAccess, IP: "198.18.1.1", NetworkInstance: "n3-site2"},
+	}, u.gtpuEndpoints())
+
+	// UP4 has no core IP.
+	u.CoreIP = net.IPv4zero
+	require.Len(t, u.gtpuEndpoints(), 2)
+}
+
+func TestPFCPConn_sendAssociationUpdateRequest(t *testing.T) {
+	node := &PFCPNode{upf: &upf{timers: pfcpTimers{respTimeout: time.Second}}}
+
+	for cause, want := range map[uint8]error{
+		ie.CauseRequestAccepted: nil,
+		ie.CauseRequestRejected: errReqRejected,
+	} {
+		requests := newTestAssociation(t, node, "127.0.0.1", cause)
+
+		var pConn *PFCPConn
+
+		node.pConns.Range(func(key, value interface{}) bool {
+			pConn = value.(*PFCPConn)
+			node.pConns.Delete(key)
+
+			return false
+		})
+
+		require.ErrorIs(t, pConn.sendAssociationUpdateRequest(ie.NewGracefulReleasePeriod(time.Minute)), want)
+
+		req := receiveAssociationUpdate(requests, time.Second)
+		require.NotNil(t, req)
+		require.NotNil(t, req.NodeID)
+		require.NotNil(t, req.GracefulReleasePeriod)
+	}
+}
+
+func TestPFCPNode_ReleaseAssociations(t *testing.T) {
+	u := &upf{timers: pfcpTimers{respTimeout: time.Second, maxReqRetries: 3}}
+	node := &PFCPNode{upf: u}
+
+	requests := newTestAssociation(t, node, "127.0.0.1", ie.CauseRequestAccepted)
+
+	// A CP node that never answers.
+	cp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2)})
+	require.NoError(t, err)
+
+	defer cp.Close()
+
+	conn, err := net.Dial("udp", cp.LocalAddr().String())
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	unresponsive := &PFCPConn{Conn: conn, upf: u, shutdown: make(chan struct{}), InstrumentPFCP: &ddnMetrics{}}
+	unresponsive.nodeID.localIE = ie.NewNodeID("198.18.0.1", "", "")
+	unresponsive.nodeID.remote = "127.0.0.2"
+	node.pConns.Store(conn.LocalAddr().String(), unresponsive)
+
+	t.Run("nothing is released without a period", func(t *testing.T) {
+		node.ReleaseAssociations()
+		require.Nil(t, receiveAssociationUpdate(requests, 100*time.Millisecond))
+	})
+
+	t.Run("release is bounded by the period", func(t *testing.T) {
+		u.gracefulReleasePeriod = 300 * time.Millisecond
+
+		start := time.Now()
+		node.ReleaseAssociations()
+		require.Less(t, int64(time.Since(start)), int64(time.Second))
+
+		req := receiveAssociationUpdate(requests, time.Second)
+		require.NotNil(t, req, "the answering CP node is asked to release the association")
+		require.NotNil(t, req.PFCPAssociationReleaseRequest)
+	})
+
+	close(unresponsive.shutdown)
+}
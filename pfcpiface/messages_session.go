@@ -5,8 +5,8 @@ package pfcpiface
 
 import (
 	"errors"
-	"net"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/wmnsk/go-pfcp/ie"
@@ -18,8 +18,29 @@ var (
 	ErrWriteToDatapath = errors.New("write to datapath failed")
 	ErrAssocNotFound   = errors.New("no association found for NodeID")
 	ErrAllocateSession = errors.New("unable to allocate new PFCP session")
+	ErrDraining        = errors.New("draining, no new PFCP sessions accepted")
+	ErrSessionLimit    = errors.New("maximum number of PFCP sessions reached")
 )
 
+// ruleErrorCause returns the cause to reply with when a PDR or FAR cannot be parsed.
+// Filters the datapath cannot enforce, Network Instances of DNNs not served and
+// duplication, redirection or header enrichment while disabled are reported as a rule creation failure
+// rather than a generic rejection, as is QoS monitoring while disabled.
+func ruleErrorCause(err error) uint8 {
+	if errors.Is(err, errBadFilterDesc) || errors.Is(err, errUnknownNetworkInstance) ||
+		errors.Is(err, errNetworkInstanceMismatch) || errors.Is(err, errDuplicationDisabled) ||
+		errors.Is(err, errQoSMonitoringDisabled) || errors.Is(err, errRedirectDisabled) ||
+		errors.Is(err, errHeaderEnrichmentDisabled) {
+		return ie.CauseRuleCreationModificationFailure
+	}
+
+	if errors.Is(err, errNoTEIDs) {
+		return ie.CauseNoResourcesAvailable
+	}
+
+	return ie.CauseRequestRejected
+}
+
 func (pConn *PFCPConn) handleSessionEstablishmentRequest(msg message.Message) (message.Message, error) {
 	upf := pConn.upf
 
@@ -29,14 +50,15 @@ func (pConn *PFCPConn) handleSessionEstablishmentRequest(msg message.Message) (m
 	}
 
 	errUnmarshalReply := func(err error, offendingIE *ie.IE) (message.Message, error) {
-		// Build response message
+		// Build response message. The reply is cached, so it must not refer to the
+		// request, whose buffer is reused once handled.
 		pfdres := message.NewSessionEstablishmentResponse(0,
 			0,
 			0,
 			sereq.SequenceNumber,
 			sereq.Header.MessagePriority,
 			ie.NewCause(ie.CauseRequestRejected),
-			offendingIE,
+			ie.NewOffendingIE(offendingIE.Type),
 		)
 
 		return pfdres, errUnmarshal(err)
@@ -56,6 +78,20 @@ func (pConn *PFCPConn) handleSessionEstablishmentRequest(msg message.Message) (m
 	remoteSEID := fseid.SEID
 	fseidIP := ip2int(fseid.IPv4Address)
 
+	var inactivityTimer time.Duration
+
+	if sereq.UserPlaneInactivityTimer != nil {
+		inactivityTimer, err = sereq.UserPlaneInactivityTimer.UserPlaneInactivityTimer()
+		if err != nil {
+			return errUnmarshalReply(err, sereq.UserPlaneInactivityTimer)
+		}
+	}
+
+	csids, csidIE, err := messageFQCSIDs(sereq.Header.Payload)
+	if err != nil {
+		return errUnmarshalReply(err, csidIE)
+	}
+
 	errProcessReply := func(err error, cause uint8) (message.Message, error) {
 		// Build response message
 		seres := message.NewSessionEstablishmentResponse(0, /* MO?? <-- what's this */
@@ -76,20 +112,39 @@ func (pConn *PFCPConn) handleSessionEstablishmentRequest(msg message.Message) (m
 		return errProcessReply(ErrAssocNotFound, ie.CauseNoEstablishedPFCPAssociation)
 	}
 
+	if upf.isDraining() {
+		return errProcessReply(ErrDraining, ie.CauseNoResourcesAvailable)
+	}
+
+	if upf.sessionLimit.reached() {
+		return errProcessReply(ErrSessionLimit, ie.CauseNoResourcesAvailable)
+	}
+
 	session, ok := pConn.NewPFCPSession(remoteSEID)
 	if !ok {
 		return errProcessReply(ErrAllocateSession,
 			ie.CauseNoResourcesAvailable)
 	}
 
+	session.inactivityTimer = inactivityTimer
+	session.csids = csids
+
+	// The F-TEIDs allocated to the rules are released if the session is not set up.
+	errRulesReply := func(err error, cause uint8) (message.Message, error) {
+		upf.teidPool.release(session.localSEID)
+		return errProcessReply(err, cause)
+	}
+
 	addPDRs := make([]pdr, 0, MaxItems)
 	addFARs := make([]far, 0, MaxItems)
 	addQERs := make([]qer, 0, MaxItems)
+	addURRs := make([]urr, 0, MaxItems)
+	addBARs := make([]bar, 0, 1)
 
 	for _, cPDR := range sereq.CreatePDR {
 		var p pdr
-		if err := p.parsePDR(cPDR, session.localSEID, pConn.appPFDs, upf.ippool); err != nil {
-			return errProcessReply(err, ie.CauseRequestRejected)
+		if err := p.parsePDR(cPDR, session.localSEID, pConn.appPFDs, upf.ipam, upf.dnns, upf.nis, pConn); err != nil {
+			return errRulesReply(err, ruleErrorCause(err))
 		}
 
 		p.fseidIP = fseidIP
@@ -100,7 +155,7 @@ func (pConn *PFCPConn) handleSessionEstablishmentRequest(msg message.Message) (m
 	for _, cFAR := range sereq.CreateFAR {
 		var f far
 		if err := f.parseFAR(cFAR, session.localSEID, upf, create); err != nil {
-			return errProcessReply(err, ie.CauseRequestRejected)
+			return errRulesReply(err, ruleErrorCause(err))
 		}
 
 		f.fseidIP = fseidIP
@@ -111,7 +166,7 @@ func (pConn *PFCPConn) handleSessionEstablishmentRequest(msg message.Message) (m
 	for _, cQER := range sereq.CreateQER {
 		var q qer
 		if err := q.parseQER(cQER, session.localSEID); err != nil {
-			return errProcessReply(err, ie.CauseRequestRejected)
+			return errRulesReply(err, ie.CauseRequestRejected)
 		}
 
 		q.fseidIP = fseidIP
@@ -119,6 +174,36 @@ func (pConn *PFCPConn) handleSessionEstablishmentRequest(msg message.Message) (m
 		addQERs = append(addQERs, q)
 	}
 
+	for _, cURR := range sereq.CreateURR {
+		var u urr
+		if err := u.parseURR(cURR, session.localSEID); err != nil {
+			return errRulesReply(err, ie.CauseRequestRejected)
+		}
+
+		u.fseidIP = fseidIP
+		session.CreateURR(u)
+		addURRs = append(addURRs, u)
+	}
+
+	if sereq.CreateBAR != nil {
+		var b bar
+		if err := b.parseBAR(sereq.CreateBAR, session.localSEID); err != nil {
+			return errRulesReply(err, ie.CauseRequestRejected)
+		}
+
+		session.CreateBAR(b)
+		addBARs = append(addBARs, b)
+	}
+
+	for _, cSRR := range sereq.CreateSRR {
+		var r srr
+		if err := r.parseSRR(cSRR, session.localSEID, upf); err != nil {
+			return errRulesReply(err, ruleErrorCause(err))
+		}
+
+		session.CreateSRR(r)
+	}
+
 	session.MarkSessionQer(session.qers)
 	// FIXME: since PacketForwardingRules doesn't store pointers,
 	//  we must also mark session QERs in addQERs.
@@ -131,14 +216,24 @@ func (pConn *PFCPConn) handleSessionEstablishmentRequest(msg message.Message) (m
 		pdrs: addPDRs,
 		fars: addFARs,
 		qers: addQERs,
-	}
-
-	cause := upf.SendMsgToUPF(upfMsgTypeAdd, session.PacketForwardingRules, updated)
-	if cause == ie.CauseRequestRejected {
+		urrs: addURRs,
+		bars: addBARs,
+	}
+
+	cause := pConn.writeRules(datapathWrite{
+		fseid:   session.localSEID,
+		method:  upfMsgTypeAdd,
+		all:     session.PacketForwardingRules,
+		updated: updated,
+		batch:   true,
+	})
+	if cause != ie.CauseRequestAccepted {
 		pConn.RemoveSession(session)
-		return errProcessReply(ErrWriteToDatapath,
-			ie.CauseRequestRejected)
+		return errProcessReply(ErrWriteToDatapath, cause)
 	}
+
+	pConn.schedulePeriodicReports(addURRs)
+
 	var pushPDR bool
 	if sereq.Header.MessagePriority != 123 {
 		pushPDR = true
@@ -148,9 +243,11 @@ func (pConn *PFCPConn) handleSessionEstablishmentRequest(msg message.Message) (m
 		log.Errorf("Failed to put PFCP session to store: %v", err)
 	}
 
+	pConn.teids.update(session)
+
 	var localFSEID *ie.IE
 
-	localIP := pConn.LocalAddr().(*net.UDPAddr).IP
+	localIP := pConn.localIP()
 	if localIP.To4() != nil {
 		localFSEID = ie.NewFSEID(session.localSEID, localIP, nil)
 	} else {
@@ -168,6 +265,11 @@ func (pConn *PFCPConn) handleSessionEstablishmentRequest(msg message.Message) (m
 		localFSEID,
 	)
 
+	// The UPF is in the sets of the CP nodes that handle partial failures.
+	if len(csids) > 0 {
+		seres.FQCSID = ie.NewFQCSID(localIP.String(), upCSID)
+	}
+
 	addPdrInfo(seres, &session)
 
 	return seres, nil
@@ -183,20 +285,24 @@ func (pConn *PFCPConn) handleSessionModificationRequest(msg message.Message) (me
 
 	var remoteSEID uint64
 
-	sendError := func(err error) (message.Message, error) {
+	sendErrorWithCause := func(err error, cause uint8) (message.Message, error) {
 		log.Errorln(err)
 
 		smres := message.NewSessionModificationResponse(0, /* MO?? <-- what's this */
-			0,                                    /* FO <-- what's this? */
-			remoteSEID,                           /* seid */
-			smreq.SequenceNumber,                 /* seq # */
-			smreq.Header.MessagePriority,         /* priority */
-			ie.NewCause(ie.CauseRequestRejected), /* accept it blindly for the time being */
+			0,                            /* FO <-- what's this? */
+			remoteSEID,                   /* seid */
+			smreq.SequenceNumber,         /* seq # */
+			smreq.Header.MessagePriority, /* priority */
+			ie.NewCause(cause),
 		)
 
 		return smres, err
 	}
 
+	sendError := func(err error) (message.Message, error) {
+		return sendErrorWithCause(err, ie.CauseRequestRejected)
+	}
+
 	localSEID := smreq.SEID()
 
 	session, ok := pConn.store.GetSession(localSEID)
@@ -217,16 +323,20 @@ func (pConn *PFCPConn) handleSessionModificationRequest(msg message.Message) (me
 	}
 
 	remoteSEID = session.remoteSEID
+	// The rules are updated in place, the previous ones tell what changed.
+	before := session.PacketForwardingRules.clone()
 
 	addPDRs := make([]pdr, 0, MaxItems)
 	addFARs := make([]far, 0, MaxItems)
 	addQERs := make([]qer, 0, MaxItems)
+	addURRs := make([]urr, 0, MaxItems)
+	addBARs := make([]bar, 0, 1)
 	endMarkerList := make([][]byte, 0, MaxItems)
 
 	for _, cPDR := range smreq.CreatePDR {
 		var p pdr
-		if err := p.parsePDR(cPDR, localSEID, pConn.appPFDs, upf.ippool); err != nil {
-			return sendError(err)
+		if err := p.parsePDR(cPDR, localSEID, pConn.appPFDs, upf.ipam, upf.dnns, upf.nis, pConn); err != nil {
+			return sendErrorWithCause(err, ruleErrorCause(err))
 		}
 
 		p.fseidIP = fseidIP
@@ -238,7 +348,7 @@ func (pConn *PFCPConn) handleSessionModificationRequest(msg message.Message) (me
 	for _, cFAR := range smreq.CreateFAR {
 		var f far
 		if err := f.parseFAR(cFAR, localSEID, upf, create); err != nil {
-			return sendError(err)
+			return sendErrorWithCause(err, ruleErrorCause(err))
 		}
 
 		f.fseidIP = fseidIP
@@ -259,14 +369,36 @@ func (pConn *PFCPConn) handleSessionModificationRequest(msg message.Message) (me
 		addQERs = append(addQERs, q)
 	}
 
+	for _, cURR := range smreq.CreateURR {
+		var u urr
+		if err := u.parseURR(cURR, localSEID); err != nil {
+			return sendError(err)
+		}
+
+		u.fseidIP = fseidIP
+
+		session.CreateURR(u)
+		addURRs = append(addURRs, u)
+	}
+
+	if smreq.CreateBAR != nil {
+		var b bar
+		if err := b.parseBAR(smreq.CreateBAR, localSEID); err != nil {
+			return sendError(err)
+		}
+
+		session.CreateBAR(b)
+		addBARs = append(addBARs, b)
+	}
+
 	for _, uPDR := range smreq.UpdatePDR {
 		var (
 			p   pdr
 			err error
 		)
 
-		if err = p.parsePDR(uPDR, localSEID, pConn.appPFDs, upf.ippool); err != nil {
-			return sendError(err)
+		if err = p.parsePDR(uPDR, localSEID, pConn.appPFDs, upf.ipam, upf.dnns, upf.nis, pConn); err != nil {
+			return sendErrorWithCause(err, ruleErrorCause(err))
 		}
 
 		p.fseidIP = fseidIP
@@ -287,7 +419,7 @@ func (pConn *PFCPConn) handleSessionModificationRequest(msg message.Message) (me
 		)
 
 		if err = f.parseFAR(uFAR, localSEID, upf, update); err != nil {
-			return sendError(err)
+			return sendErrorWithCause(err, ruleErrorCause(err))
 		}
 
 		f.fseidIP = fseidIP
@@ -307,6 +439,11 @@ func (pConn *PFCPConn) handleSessionModificationRequest(msg message.Message) (me
 			err error
 		)
 
+		// The IEs absent from the update keep their value.
+		if id, err := uQER.QERID(); err == nil {
+			q, _ = findQER(session.qers, id)
+		}
+
 		if err = q.parseQER(uQER, localSEID); err != nil {
 			return sendError(err)
 		}
@@ -322,6 +459,84 @@ func (pConn *PFCPConn) handleSessionModificationRequest(msg message.Message) (me
 		addQERs = append(addQERs, q)
 	}
 
+	for _, uURR := range smreq.UpdateURR {
+		var (
+			u   urr
+			err error
+		)
+
+		if err = u.parseURR(uURR, localSEID); err != nil {
+			return sendError(err)
+		}
+
+		u.fseidIP = fseidIP
+
+		err = session.UpdateURR(u)
+		if err != nil {
+			log.Errorln("session URR update failed ", err)
+			continue
+		}
+
+		addURRs = append(addURRs, u)
+	}
+
+	if smreq.UpdateBAR != nil {
+		var b bar
+		if err := b.parseBAR(smreq.UpdateBAR, localSEID); err != nil {
+			return sendError(err)
+		}
+
+		if err := session.UpdateBAR(b); err != nil {
+			log.Errorln("session BAR update failed ", err)
+		} else {
+			addBARs = append(addBARs, b)
+		}
+	}
+
+	for _, cSRR := range smreq.CreateSRR {
+		var r srr
+		if err := r.parseSRR(cSRR, localSEID, upf); err != nil {
+			return sendErrorWithCause(err, ruleErrorCause(err))
+		}
+
+		session.CreateSRR(r)
+	}
+
+	for _, uSRR := range smreq.UpdateSRR {
+		var r srr
+		if err := r.parseSRR(uSRR, localSEID, upf); err != nil {
+			return sendErrorWithCause(err, ruleErrorCause(err))
+		}
+
+		if err := session.UpdateSRR(r); err != nil {
+			log.Errorln("session SRR update failed ", err)
+			continue
+		}
+
+		pConn.qos.forgetSRR(localSEID, r.srrID)
+	}
+
+	// A modified timer restarts, a zero one stops it.
+	if smreq.UserPlaneInactivityTimer != nil {
+		timer, err := smreq.UserPlaneInactivityTimer.UserPlaneInactivityTimer()
+		if err != nil {
+			return sendError(err)
+		}
+
+		session.inactivityTimer = timer
+		pConn.inactivity.forgetSession(localSEID)
+	}
+
+	// FQ-CSIDs replace those of the session, e.g. after a change of SGW-C.
+	csids, _, err := messageFQCSIDs(smreq.Header.Payload)
+	if err != nil {
+		return sendErrorWithCause(errUnmarshal(err), ie.CauseMandatoryIEIncorrect)
+	}
+
+	if len(csids) > 0 {
+		session.csids = csids
+	}
+
 	session.MarkSessionQer(session.qers)
 	// FIXME: since PacketForwardingRules doesn't store pointers,
 	//  we must also mark session QERs in addQERs.
@@ -332,23 +547,40 @@ func (pConn *PFCPConn) handleSessionModificationRequest(msg message.Message) (me
 		pdrs: addPDRs,
 		fars: addFARs,
 		qers: addQERs,
+		urrs: addURRs,
+		bars: addBARs,
 	}
 
-	cause := upf.SendMsgToUPF(upfMsgTypeMod, session.PacketForwardingRules, updated)
-	if cause == ie.CauseRequestRejected {
-		return sendError(ErrWriteToDatapath)
+	modify := datapathWrite{
+		fseid:   localSEID,
+		method:  upfMsgTypeMod,
+		all:     session.PacketForwardingRules,
+		updated: updated,
+		batch:   true,
+		inPlace: updatableInPlace(before, updated),
 	}
 
+	// End markers must follow the rules switching the path.
 	if upf.EnableEndMarker {
-		err := upf.SendEndMarkers(&endMarkerList)
-		if err != nil {
-			log.Errorln("Sending End Markers Failed : ", err)
+		modify.onSuccess = func() {
+			pConn.sendEndMarkers(endMarkerList)
 		}
 	}
 
+	cause := pConn.writeRules(modify)
+	if cause != ie.CauseRequestAccepted {
+		return sendErrorWithCause(ErrWriteToDatapath, cause)
+	}
+
+	pConn.schedulePeriodicReports(addURRs)
+	// The CP reacted to the session, so the next Downlink Data Report is not throttled.
+	pConn.ddn.reset(localSEID)
+
 	delPDRs := make([]pdr, 0, MaxItems)
 	delFARs := make([]far, 0, MaxItems)
 	delQERs := make([]qer, 0, MaxItems)
+	delURRs := make([]urr, 0, MaxItems)
+	delBARs := make([]bar, 0, 1)
 
 	for _, rPDR := range smreq.RemovePDR {
 		pdrID, err := rPDR.PDRID()
@@ -392,13 +624,63 @@ func (pConn *PFCPConn) handleSessionModificationRequest(msg message.Message) (me
 		delQERs = append(delQERs, *q)
 	}
 
+	for _, dURR := range smreq.RemoveURR {
+		urrID, err := dURR.URRID()
+		if err != nil {
+			return sendError(err)
+		}
+
+		u, err := session.RemoveURR(urrID)
+		if err != nil {
+			return sendError(err)
+		}
+
+		pConn.cancelPeriodicReport(localSEID, urrID)
+		pConn.usage.forgetURR(localSEID, urrID)
+
+		delURRs = append(delURRs, *u)
+	}
+
+	if smreq.RemoveBAR != nil {
+		barID, err := smreq.RemoveBAR.BARID()
+		if err != nil {
+			return sendError(err)
+		}
+
+		b, err := session.RemoveBAR(barID)
+		if err != nil {
+			return sendError(err)
+		}
+
+		delBARs = append(delBARs, *b)
+	}
+
+	for _, rSRR := range smreq.RemoveSRR {
+		srrID, err := rSRR.SRRID()
+		if err != nil {
+			return sendError(err)
+		}
+
+		if _, err := session.RemoveSRR(srrID); err != nil {
+			return sendError(err)
+		}
+
+		pConn.qos.forgetSRR(localSEID, srrID)
+	}
+
 	deleted := PacketForwardingRules{
 		pdrs: delPDRs,
 		fars: delFARs,
 		qers: delQERs,
+		urrs: delURRs,
+		bars: delBARs,
 	}
 
-	cause = upf.SendMsgToUPF(upfMsgTypeDel, deleted, PacketForwardingRules{})
+	cause = pConn.writeRules(datapathWrite{
+		fseid:  localSEID,
+		method: upfMsgTypeDel,
+		all:    deleted,
+	})
 	if cause == ie.CauseRequestRejected {
 		return sendError(ErrWriteToDatapath)
 	}
@@ -408,11 +690,13 @@ func (pConn *PFCPConn) handleSessionModificationRequest(msg message.Message) (me
 		pushPDR = true
 	}
 
-	err := pConn.store.PutSession(session, pConn, pushPDR, smreq.Header.Type)
+	err = pConn.store.PutSession(session, pConn, pushPDR, smreq.Header.Type)
 	if err != nil {
 		log.Errorf("Failed to put PFCP session to store: %v", err)
 	}
 
+	pConn.teids.update(session)
+
 	// Build response message
 	smres := message.NewSessionModificationResponse(0, /* MO?? <-- what's this */
 		0,                                    /* FO <-- what's this? */
@@ -422,6 +706,9 @@ func (pConn *PFCPConn) handleSessionModificationRequest(msg message.Message) (me
 		ie.NewCause(ie.CauseRequestAccepted), /* accept it blindly for the time being */
 	)
 
+	// The created PDRs are the first ones added.
+	smres.CreatedPDR = createdPDRs(addPDRs[:len(smreq.CreatePDR)])
+
 	return smres, nil
 }
 
@@ -450,15 +737,32 @@ func (pConn *PFCPConn) handleSessionDeletionRequest(msg message.Message) (messag
 
 	session, ok := pConn.store.GetSession(localSEID)
 	if !ok {
+		// The session may predate a restart, its UE IP is no longer in use.
+		if upf.ippools != nil {
+			upf.ippools.releaseRestored(localSEID)
+		} else if upf.ipam != nil {
+			if err := upf.ipam.DeallocIP(localSEID); err != nil {
+				log.Warnln("Failed to release UE IP of unknown session", localSEID, "from IPAM:", err)
+			}
+		}
+
 		return sendError(ErrNotFoundWithParam("PFCP session", "localSEID", localSEID))
 	}
 
-	cause := upf.SendMsgToUPF(upfMsgTypeDel, session.PacketForwardingRules, PacketForwardingRules{})
+	// Final usage must be read before the rules and their counters are removed.
+	usageReports := pConn.finalUsageReports(session)
+	sessionReports := pConn.qosMonitoringReports(session, time.Now(), true)
+
+	cause := pConn.writeRules(datapathWrite{
+		fseid:  localSEID,
+		method: upfMsgTypeDel,
+		all:    session.PacketForwardingRules,
+	})
 	if cause == ie.CauseRequestRejected {
 		return sendError(ErrWriteToDatapath)
 	}
 
-	if err := releaseAllocatedIPs(upf.ippool, &session); err != nil {
+	if err := releaseAllocatedIPs(upf.ipam, &session); err != nil {
 		return sendError(ErrOperationFailedWithReason("session IP dealloc", err.Error()))
 	}
 
@@ -473,10 +777,75 @@ func (pConn *PFCPConn) handleSessionDeletionRequest(msg message.Message) (messag
 		sdreq.Header.MessagePriority,         /* priority */
 		ie.NewCause(ie.CauseRequestAccepted), /* accept it blindly for the time being */
 	)
+	smres.UsageReport = usageReports
+	// go-pfcp has no Session Report field in the Session Deletion Response.
+	smres.IEs = append(smres.IEs, sessionReports...)
 
 	return smres, nil
 }
 
+func (pConn *PFCPConn) handleSessionSetDeletionRequest(msg message.Message) (message.Message, error) {
+	ssdreq, ok := msg.(*message.SessionSetDeletionRequest)
+	if !ok {
+		return nil, errUnmarshal(errMsgUnexpectedType)
+	}
+
+	sendError := func(err error, cause uint8, offendingIE *ie.IE) (message.Message, error) {
+		ssdres := message.NewSessionSetDeletionResponse(ssdreq.SequenceNumber,
+			pConn.nodeID.localIE,
+			ie.NewCause(cause),
+			offendingIE,
+		)
+
+		return ssdres, err
+	}
+
+	if ssdreq.NodeID == nil {
+		return sendError(errUnmarshal(ErrNotFound("NodeID IE")), ie.CauseMandatoryIEMissing, nil)
+	}
+
+	nodeID, err := ssdreq.NodeID.NodeID()
+	if err != nil {
+		return sendError(errUnmarshal(err), ie.CauseMandatoryIEIncorrect, ssdreq.NodeID)
+	}
+
+	if strings.Compare(nodeID, pConn.nodeID.remote) != 0 {
+		log.Warnln("Association not found for Session Set Deletion request",
+			"with nodeID: ", nodeID, ", Association NodeID: ", pConn.nodeID.remote)
+		return sendError(errProcess(ErrAssocNotFound), ie.CauseNoEstablishedPFCPAssociation, nil)
+	}
+
+	csids, csidIE, err := messageFQCSIDs(ssdreq.Header.Payload)
+	if err != nil {
+		return sendError(errUnmarshal(err), ie.CauseMandatoryIEIncorrect, csidIE)
+	}
+
+	if len(csids) == 0 {
+		return sendError(errUnmarshal(ErrNotFound("FQ-CSID IE")), ie.CauseMandatoryIEMissing, nil)
+	}
+
+	requested := make(map[fqCSID]bool, len(csids))
+	for _, c := range csids {
+		requested[c] = true
+	}
+
+	own := pConn.ownFQCSID()
+
+	// Only the sessions in the sets of the failed nodes are removed.
+	n := pConn.removeSessions("session set deletion", func(s PFCPSession) bool {
+		return inCSIDSet(s.csids, requested, own)
+	})
+	log.Infoln("Session Set Deletion from", nodeID, "for", csids, "removed", n, "sessions")
+
+	ssdres := message.NewSessionSetDeletionResponse(ssdreq.SequenceNumber,
+		pConn.nodeID.localIE,
+		ie.NewCause(ie.CauseRequestAccepted),
+		nil,
+	)
+
+	return ssdres, nil
+}
+
 func (pConn *PFCPConn) handleDigestReport(fseid uint64) {
 	session, ok := pConn.store.GetSession(fseid)
 	if !ok {
@@ -484,6 +853,61 @@ func (pConn *PFCPConn) handleDigestReport(fseid uint64) {
 		return
 	}
 
+	pdrIDs, notifyDelay := session.notifyingDownlinkPDRs()
+	if len(pdrIDs) == 0 {
+		log.Errorln("No buffering downlink PDR found, discarding notification")
+
+		return
+	}
+
+	batchWindow := pConn.upf.ddnBatchWindow
+
+	if reason, ok := pConn.ddn.admit(fseid, time.Now()); !ok {
+		if reason == ddnSuppressedPending && batchWindow > 0 {
+			reason = ddnSuppressedBatched
+		}
+
+		log.WithFields(log.Fields{
+			"F-SEID": fseid,
+			"reason": reason,
+		}).Trace("Suppressing Downlink Data Report")
+		pConn.SaveSuppressedDDN(pConn.nodeID.remote, reason)
+
+		return
+	}
+
+	// The notifications received until the report is sent are batched into it.
+	if batchWindow > notifyDelay {
+		notifyDelay = batchWindow
+	}
+
+	if notifyDelay > 0 {
+		pConn.ddn.delay(fseid, notifyDelay, func() {
+			pConn.sendDownlinkDataReport(fseid)
+		})
+
+		return
+	}
+
+	pConn.sendDownlinkDataReport(fseid)
+}
+
+// sendDownlinkDataReport reports the downlink PDRs of the session buffering and
+// notifying at the time of sending in one Session Report Request.
+func (pConn *PFCPConn) sendDownlinkDataReport(fseid uint64) {
+	// The session may be gone, or not buffer anymore, if the report has been delayed.
+	session, ok := pConn.store.GetSession(fseid)
+	if !ok {
+		pConn.ddn.reset(fseid)
+		return
+	}
+
+	pdrIDs, _ := session.notifyingDownlinkPDRs()
+	if len(pdrIDs) == 0 {
+		pConn.ddn.reset(fseid)
+		return
+	}
+
 	seq := pConn.getSeqNum()
 	srreq := message.NewSessionReportRequest(0, /* MO?? <-- what's this */
 		0,                            /* FO <-- what's this? */
@@ -494,49 +918,52 @@ func (pConn *PFCPConn) handleDigestReport(fseid uint64) {
 	)
 	srreq.Header.SEID = session.remoteSEID
 
-	var pdrID uint32
+	pdrIEs := make([]*ie.IE, 0, len(pdrIDs))
+	for _, pdrID := range pdrIDs {
+		pdrIEs = append(pdrIEs, ie.NewPDRID(uint16(pdrID)))
+	}
 
-	var farID uint32
+	srreq.DownlinkDataReport = ie.NewDownlinkDataReport(pdrIEs...)
 
-	for _, pdr := range session.pdrs {
-		if pdr.srcIface == core {
-			pdrID = pdr.pdrID
+	log.WithFields(log.Fields{
+		"F-SEID":  fseid,
+		"PDR IDs": pdrIDs,
+	}).Debug("Sending Downlink Data Report")
 
-			farID = pdr.farID
+	pConn.SendPFCPMsg(srreq)
+	pConn.ddn.sent(fseid, time.Now())
+}
 
-			break
-		}
+// updateBARFromReport applies the Update BAR IE of a Session Report Response.
+func (pConn *PFCPConn) updateBARFromReport(seid uint64, updateBAR *ie.IE) error {
+	session, ok := pConn.store.GetSession(seid)
+	if !ok {
+		return ErrNotFoundWithParam("PFCP session context", "SEID", seid)
 	}
 
-	for _, far := range session.fars {
-		if far.farID == farID {
-			if far.applyAction&ActionNotify == 0 {
-				log.Errorln("packet received for forwarding far. discard")
-				return
-			}
-		}
+	var b bar
+	if err := b.parseBAR(updateBAR, seid); err != nil {
+		return err
 	}
 
-	if pdrID == 0 {
-		log.Errorln("No Pdr found for downlink")
-
-		return
+	if err := session.UpdateBAR(b); err != nil {
+		return err
 	}
 
-	srreq.DownlinkDataReport = ie.NewDownlinkDataReport(
-		ie.NewPDRID(uint16(pdrID)))
-
-	log.WithFields(log.Fields{
-		"F-SEID": fseid,
-		"PDR ID": pdrID,
-	}).Debug("Sending Downlink Data Report")
+	cause := pConn.writeRules(datapathWrite{
+		fseid:   seid,
+		method:  upfMsgTypeMod,
+		all:     session.PacketForwardingRules,
+		updated: PacketForwardingRules{bars: []bar{b}},
+	})
+	if cause == ie.CauseRequestRejected {
+		return ErrWriteToDatapath
+	}
 
-	pConn.SendPFCPMsg(srreq)
+	return pConn.store.PutSession(session, pConn, false, message.MsgTypeSessionReportResponse)
 }
 
 func (pConn *PFCPConn) handleSessionReportResponse(msg message.Message) error {
-	upf := pConn.upf
-
 	srres, ok := msg.(*message.SessionReportResponse)
 	if !ok {
 		return errUnmarshal(errMsgUnexpectedType)
@@ -544,6 +971,12 @@ func (pConn *PFCPConn) handleSessionReportResponse(msg message.Message) error {
 
 	cause := srres.Cause.Payload[0]
 	if cause == ie.CauseRequestAccepted {
+		if srres.UpdateBAR != nil {
+			if err := pConn.updateBARFromReport(srres.SEID(), srres.UpdateBAR); err != nil {
+				return errProcess(err)
+			}
+		}
+
 		return nil
 	}
 
@@ -561,8 +994,11 @@ func (pConn *PFCPConn) handleSessionReportResponse(msg message.Message) error {
 
 		pConn.RemoveSession(sessItem)
 
-		cause := upf.SendMsgToUPF(
-			upfMsgTypeDel, sessItem.PacketForwardingRules, PacketForwardingRules{})
+		cause := pConn.writeRules(datapathWrite{
+			fseid:  seid,
+			method: upfMsgTypeDel,
+			all:    sessItem.PacketForwardingRules,
+		})
 		if cause == ie.CauseRequestRejected {
 			return errProcess(
 				ErrOperationFailedWithParam("delete session from datapath", "seid", seid))
@@ -0,0 +1,252 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+func TestPFCPConn_establishmentUplinkClassifier(t *testing.T) {
+	f := &fakeDatapath{}
+	u := &upf{datapath: f, AccessIP: net.ParseIP("198.18.0.1"), CoreIP: net.ParseIP("198.19.0.1"),
+		nodeIP: net.ParseIP("198.18.0.1"), role: roleIUPF, usageWheel: newTimerWheel()}
+	f.SetUpfInfo(u, &Conf{})
+
+	pConn := &PFCPConn{
+		upf:            u,
+		store:          NewInMemoryStore(),
+		usage:          newUsageTracker(),
+		teids:          newTEIDIndex(),
+		InstrumentPFCP: &asyncWriteMetrics{},
+	}
+	pConn.nodeID.localIE = ie.NewNodeID("198.18.0.1", "", "")
+	pConn.nodeID.remote = "198.18.0.2"
+
+	uplinkPDR := func(id uint16, precedence, farID uint32, sdf string) *ie.IE {
+		pdi := []*ie.IE{
+			ie.NewSourceInterface(ie.SrcInterfaceAccess),
+			ie.NewFTEID(0x01, 100, net.ParseIP("198.18.0.1"), nil, 0),
+			ie.NewUEIPAddress(0x2, "10.250.0.1", "", 0, 0),
+		}
+		if sdf != "" {
+			pdi = append(pdi, ie.NewSDFFilter(sdf, "", "", "", 0))
+		}
+
+		return ie.NewCreatePDR(ie.NewPDRID(id), ie.NewPrecedence(precedence), ie.NewPDI(pdi...),
+			ie.NewOuterHeaderRemoval(0, 0), ie.NewFARID(farID))
+	}
+
+	// Traffic to the edge application leaves by N6, the rest is steered to the PSA on N9.
+	// A priority of 123 keeps the UE address from being pushed to the load balancers.
+	sereq := message.NewSessionEstablishmentRequest(1, 0, 0, 1, 123,
+		ie.NewNodeID("198.18.0.2", "", ""),
+		ie.NewFSEID(3, net.ParseIP("198.18.0.2"), nil),
+		uplinkPDR(1, 10, 1, "permit out ip from 192.0.2.0/24 to assigned"),
+		uplinkPDR(2, 20, 2, ""),
+		ie.NewCreateFAR(ie.NewFARID(1), ie.NewApplyAction(ActionForward),
+			ie.NewForwardingParameters(ie.NewDestinationInterface(ie.DstInterfaceCore))),
+		ie.NewCreateFAR(ie.NewFARID(2), ie.NewApplyAction(ActionForward),
+			ie.NewForwardingParameters(ie.NewDestinationInterface(ie.DstInterfaceCore),
+				ie.NewOuterHeaderCreation(0x100, 200, "198.19.0.10", "", 0, 0, 0))),
+	)
+
+	reply, err := pConn.handleSessionEstablishmentRequest(sereq)
+	require.NoError(t, err)
+
+	cause, err := reply.(*message.SessionEstablishmentResponse).Cause.Cause()
+	require.NoError(t, err)
+	require.Equal(t, ie.CauseRequestAccepted, cause)
+
+	require.Len(t, f.pdrs, 2)
+	require.Len(t, f.fars, 2)
+
+	pdrs := make(map[uint32]pdr)
+	for _, p := range f.pdrs {
+		pdrs[p.pdrID] = p
+	}
+
+	require.Equal(t, pdrs[1].tunnelTEID, pdrs[2].tunnelTEID, "both PDRs match the uplink tunnel")
+	require.Equal(t, ip2int(net.ParseIP("192.0.2.0")), pdrs[1].appFilter.dstIP)
+	require.Zero(t, pdrs[2].appFilter.dstIP)
+
+	for _, r := range f.fars {
+		if r.farID == 1 {
+			require.Zero(t, r.tunnelType, "N6 traffic is not encapsulated")
+			continue
+		}
+
+		require.Equal(t, uint8(1), r.tunnelType)
+		require.Equal(t, ip2int(net.ParseIP("198.19.0.1")), r.tunnelIP4Src, "N9 tunnels start from the core IP")
+		require.Equal(t, ip2int(net.ParseIP("198.19.0.10")), r.tunnelIP4Dst)
+		require.Equal(t, uint32(200), r.tunnelTEID)
+	}
+}
+
+func TestPFCPConn_establishmentChooseFTEID(t *testing.T) {
+	f := &fakeDatapath{}
+	u := &upf{datapath: f, AccessIP: net.ParseIP("198.18.0.1"), CoreIP: net.ParseIP("198.19.0.1"),
+		nodeIP: net.ParseIP("198.18.0.1"), usageWheel: newTimerWheel(),
+		teidPool: newTEIDPool([]TEIDRangeInfo{{Peer: "198.18.0.2", Start: 0x1000, End: 0x1fff}})}
+	f.SetUpfInfo(u, &Conf{})
+
+	pConn := &PFCPConn{
+		upf:            u,
+		store:          NewInMemoryStore(),
+		usage:          newUsageTracker(),
+		teids:          newTEIDIndex(),
+		ddn:            newDDNThrottle(),
+		InstrumentPFCP: &asyncWriteMetrics{},
+	}
+	pConn.nodeID.localIE = ie.NewNodeID("198.18.0.1", "", "")
+	pConn.nodeID.remote = "198.18.0.2"
+
+	// Both uplink PDRs share CHOOSE ID 1, and so their F-TEID.
+	uplinkPDR := func(id uint16) *ie.IE {
+		return ie.NewCreatePDR(ie.NewPDRID(id), ie.NewPrecedence(uint32(id)), ie.NewPDI(
+			ie.NewSourceInterface(ie.SrcInterfaceAccess),
+			ie.NewFTEID(0x0c, 0, nil, nil, 1),
+		), ie.NewFARID(1))
+	}
+
+	sereq := message.NewSessionEstablishmentRequest(1, 0, 0, 1, 123,
+		ie.NewNodeID("198.18.0.2", "", ""),
+		ie.NewFSEID(3, net.ParseIP("198.18.0.2"), nil),
+		uplinkPDR(1),
+		uplinkPDR(2),
+		ie.NewCreateFAR(ie.NewFARID(1), ie.NewApplyAction(ActionForward),
+			ie.NewForwardingParameters(ie.NewDestinationInterface(ie.DstInterfaceCore))),
+	)
+
+	reply, err := pConn.handleSessionEstablishmentRequest(sereq)
+	require.NoError(t, err)
+
+	seres := reply.(*message.SessionEstablishmentResponse)
+	require.Len(t, seres.CreatedPDR, 2)
+
+	for _, created := range seres.CreatedPDR {
+		fteid, err := created.FTEID()
+		require.NoError(t, err)
+		require.Equal(t, uint32(0x1000), fteid.TEID)
+		require.Equal(t, "198.18.0.1", fteid.IPv4Address.String())
+	}
+
+	for _, p := range f.pdrs {
+		require.Equal(t, uint32(0x1000), p.tunnelTEID)
+	}
+
+	session, ok := pConn.store.GetSession(3)
+	require.True(t, ok)
+
+	pConn.RemoveSession(session)
+	require.Empty(t, u.teidPool.used, "TEIDs are released with their session")
+}
+
+func TestPFCPConn_sessionSetDeletion(t *testing.T) {
+	f := &fakeDatapath{}
+	u := &upf{datapath: f, AccessIP: net.ParseIP("198.18.0.1"), CoreIP: net.ParseIP("198.19.0.1"),
+		nodeIP: net.ParseIP("198.18.0.1"), usageWheel: newTimerWheel()}
+	f.SetUpfInfo(u, &Conf{})
+
+	pConn := &PFCPConn{
+		upf:            u,
+		store:          NewInMemoryStore(),
+		usage:          newUsageTracker(),
+		teids:          newTEIDIndex(),
+		ddn:            newDDNThrottle(),
+		InstrumentPFCP: &asyncWriteMetrics{},
+	}
+	pConn.nodeID.localIE = ie.NewNodeID("198.18.0.1", "", "")
+	pConn.nodeID.remote = "198.18.0.2"
+
+	// establish sets up a session of the SGW-C and PGW-C sets, parsed from the wire.
+	establish := func(seid uint64, sgwcCSID, pgwcCSID uint16) uint64 {
+		sereq := message.NewSessionEstablishmentRequest(0, 0, 0, 1, 123,
+			ie.NewNodeID("198.18.0.2", "", ""),
+			ie.NewFSEID(seid, net.ParseIP("198.18.0.2"), nil),
+			ie.NewCreatePDR(ie.NewPDRID(1), ie.NewPrecedence(1), ie.NewPDI(
+				ie.NewSourceInterface(ie.SrcInterfaceCore),
+				ie.NewUEIPAddress(0x2, fmt.Sprintf("10.250.0.%d", seid), "", 0, 0),
+			), ie.NewFARID(1)),
+			ie.NewCreateFAR(ie.NewFARID(1), ie.NewApplyAction(ActionDrop)),
+			ie.NewFQCSID("198.18.0.2", sgwcCSID),
+		)
+		sereq.IEs = append(sereq.IEs, ie.NewFQCSID("198.18.0.3", pgwcCSID))
+
+		msg, err := message.Parse(mustMarshal(t, sereq))
+		require.NoError(t, err)
+
+		reply, err := pConn.handleSessionEstablishmentRequest(msg)
+		require.NoError(t, err)
+
+		seres := reply.(*message.SessionEstablishmentResponse)
+		require.NotNil(t, seres.FQCSID, "the UPF reports its FQ-CSID")
+
+		fseid, err := seres.UPFSEID.FSEID()
+		require.NoError(t, err)
+
+		return fseid.SEID
+	}
+
+	setDeletion := func(csids ...*ie.IE) uint8 {
+		ssdreq := message.NewSessionSetDeletionRequest(1, ie.NewNodeID("198.18.0.2", "", ""), nil)
+		ssdreq.IEs = csids
+
+		msg, err := message.Parse(mustMarshal(t, ssdreq))
+		require.NoError(t, err)
+
+		reply, err := pConn.handleSessionSetDeletionRequest(msg)
+
+		cause, cerr := reply.(*message.SessionSetDeletionResponse).Cause.Cause()
+		require.NoError(t, cerr)
+
+		if cause == ie.CauseRequestAccepted {
+			require.NoError(t, err)
+		}
+
+		return cause
+	}
+
+	first := establish(1, 10, 20)
+	second := establish(2, 11, 20)
+	third := establish(3, 11, 21)
+
+	sessions := func() []uint64 {
+		var seids []uint64
+		for _, s := range []uint64{first, second, third} {
+			if _, ok := pConn.store.GetSession(s); ok {
+				seids = append(seids, s)
+			}
+		}
+
+		return seids
+	}
+
+	require.Equal(t, ie.CauseMandatoryIEMissing, setDeletion())
+
+	// A CSID of another node, or unknown, leaves the sessions alone.
+	require.Equal(t, ie.CauseRequestAccepted, setDeletion(ie.NewFQCSID("198.18.0.3", 10), ie.NewFQCSID("198.18.0.2", 12)))
+	require.Equal(t, []uint64{first, second, third}, sessions())
+
+	require.Equal(t, ie.CauseRequestAccepted, setDeletion(ie.NewFQCSID("198.18.0.3", 20)))
+	require.Equal(t, []uint64{third}, sessions())
+
+	// The UPF's own set holds the remaining sessions.
+	require.Equal(t, ie.CauseRequestAccepted, setDeletion(ie.NewFQCSID("198.18.0.1", upCSID)))
+	require.Empty(t, sessions())
+}
+
+func Test_parseFQCSID(t *testing.T) {
+	csids, err := parseFQCSID(ie.NewFQCSID("2001:db8::1", 1, 0x1234))
+	require.NoError(t, err)
+	require.Equal(t, []fqCSID{{Node: "2001:db8::1", CSID: 1}, {Node: "2001:db8::1", CSID: 0x1234}}, csids)
+
+	_, err = parseFQCSID(ie.New(ie.FQCSID, []byte{0x02, 198, 18, 0, 1, 0, 1}))
+	require.Error(t, err, "truncated CSIDs")
+}
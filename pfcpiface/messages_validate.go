@@ -0,0 +1,345 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"fmt"
+	"net"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+// pfcpHeaderLen is the part of the PFCP header not counted in its length field.
+const pfcpHeaderLen = 4
+
+// malformedMsg is the reason an incoming request is rejected before being processed,
+// answered with cause and the offending IE as in 3GPP TS 29.244 section 7.6.
+type malformedMsg struct {
+	cause uint8
+	// ieType is the offending IE, none if zero.
+	ieType uint16
+	err    error
+}
+
+func (m *malformedMsg) Error() string {
+	return m.err.Error()
+}
+
+func errInvalidLength(err error) *malformedMsg {
+	return &malformedMsg{cause: ie.CauseInvalidLength, err: err}
+}
+
+func errMandatoryIEMissing(ieType uint16) *malformedMsg {
+	return &malformedMsg{
+		cause:  ie.CauseMandatoryIEMissing,
+		ieType: ieType,
+		err:    ErrNotFound(fmt.Sprintf("mandatory IE %d", ieType)),
+	}
+}
+
+func errMandatoryIEIncorrect(ieType uint16, err error) *malformedMsg {
+	return &malformedMsg{
+		cause:  ie.CauseMandatoryIEIncorrect,
+		ieType: ieType,
+		err:    fmt.Errorf("mandatory IE %d incorrect: %w", ieType, err),
+	}
+}
+
+// ieDecoder decodes an IE, returning why it is incorrect.
+type ieDecoder func(i *ie.IE) error
+
+func decodeNodeID(i *ie.IE) error {
+	if len(i.Payload) < 2 {
+		return ErrInvalidArgumentWithReason("Node ID", i.Payload, "too short")
+	}
+
+	switch i.Payload[0] {
+	case ie.NodeIDIPv4Address:
+		if len(i.Payload) != 1+net.IPv4len {
+			return ErrInvalidArgumentWithReason("Node ID", i.Payload, "invalid IPv4 address")
+		}
+	case ie.NodeIDIPv6Address:
+		if len(i.Payload) != 1+net.IPv6len {
+			return ErrInvalidArgumentWithReason("Node ID", i.Payload, "invalid IPv6 address")
+		}
+	case ie.NodeIDFQDN:
+	default:
+		return ErrInvalidArgumentWithReason("Node ID type", i.Payload[0], "unknown type")
+	}
+
+	_, err := i.NodeID()
+
+	return err
+}
+
+func decodeFSEID(i *ie.IE) error {
+	_, err := i.FSEID()
+	return err
+}
+
+func decodeRecoveryTimeStamp(i *ie.IE) error {
+	_, err := i.RecoveryTimeStamp()
+	return err
+}
+
+func decodePDRID(i *ie.IE) error {
+	_, err := i.PDRID()
+	return err
+}
+
+func decodeFARID(i *ie.IE) error {
+	_, err := i.FARID()
+	return err
+}
+
+func decodePrecedence(i *ie.IE) error {
+	_, err := i.Precedence()
+	return err
+}
+
+func decodeSourceInterface(i *ie.IE) error {
+	iface, err := i.SourceInterface()
+	if err != nil {
+		return err
+	}
+
+	if iface > ie.SrcInterface5GVNInternal {
+		return ErrInvalidArgumentWithReason("Source Interface", iface, "unknown interface")
+	}
+
+	return nil
+}
+
+func decodeApplyAction(i *ie.IE) error {
+	action, err := i.ApplyAction()
+	if err != nil {
+		return err
+	}
+
+	if action&(ActionDrop|ActionForward|ActionBuffer) == 0 {
+		return ErrInvalidArgumentWithReason("Apply Action", action, "neither drop, forward nor buffer")
+	}
+
+	return nil
+}
+
+func decodeApplicationID(i *ie.IE) error {
+	_, err := i.ApplicationID()
+	return err
+}
+
+// mandatoryIE checks that i, of type ieType, is present and can be decoded.
+func mandatoryIE(i *ie.IE, ieType uint16, decode ieDecoder) *malformedMsg {
+	if i == nil {
+		return errMandatoryIEMissing(ieType)
+	}
+
+	if err := decode(i); err != nil {
+		return errMandatoryIEIncorrect(ieType, err)
+	}
+
+	return nil
+}
+
+// mandatoryChild checks the mandatory child IE of type ieType of a grouped IE.
+func mandatoryChild(group *ie.IE, ieType uint16, decode ieDecoder) *malformedMsg {
+	for _, child := range group.ChildIEs {
+		if child.Type == ieType {
+			return mandatoryIE(child, ieType, decode)
+		}
+	}
+
+	return errMandatoryIEMissing(ieType)
+}
+
+// mandatoryChildren checks the mandatory child IEs of each grouped IE of groups.
+func mandatoryChildren(groups []*ie.IE, checks ...func(group *ie.IE) *malformedMsg) *malformedMsg {
+	for _, group := range groups {
+		for _, check := range checks {
+			if m := check(group); m != nil {
+				return m
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkPDRID(group *ie.IE) *malformedMsg {
+	return mandatoryChild(group, ie.PDRID, decodePDRID)
+}
+
+func checkFARID(group *ie.IE) *malformedMsg {
+	return mandatoryChild(group, ie.FARID, decodeFARID)
+}
+
+func checkCreatePDR(group *ie.IE) *malformedMsg {
+	if m := mandatoryChild(group, ie.Precedence, decodePrecedence); m != nil {
+		return m
+	}
+
+	for _, child := range group.ChildIEs {
+		if child.Type == ie.PDI {
+			return mandatoryChild(child, ie.SourceInterface, decodeSourceInterface)
+		}
+	}
+
+	return errMandatoryIEMissing(ie.PDI)
+}
+
+func checkCreateFAR(group *ie.IE) *malformedMsg {
+	return mandatoryChild(group, ie.ApplyAction, decodeApplyAction)
+}
+
+func checkApplicationIDsPFDs(group *ie.IE) *malformedMsg {
+	return mandatoryChild(group, ie.ApplicationID, decodeApplicationID)
+}
+
+// validateMessage checks the length of buf against its header and the mandatory IEs of
+// the request msg parsed from buf, before it is processed.
+func validateMessage(buf []byte, msg message.Message) *malformedMsg {
+	if err := checkMessageLength(buf); err != nil {
+		return err
+	}
+
+	switch req := msg.(type) {
+	case *message.HeartbeatRequest:
+		return mandatoryIE(req.RecoveryTimeStamp, ie.RecoveryTimeStamp, decodeRecoveryTimeStamp)
+	case *message.AssociationSetupRequest:
+		if m := mandatoryIE(req.NodeID, ie.NodeID, decodeNodeID); m != nil {
+			return m
+		}
+
+		return mandatoryIE(req.RecoveryTimeStamp, ie.RecoveryTimeStamp, decodeRecoveryTimeStamp)
+	case *message.AssociationReleaseRequest:
+		return mandatoryIE(req.NodeID, ie.NodeID, decodeNodeID)
+	case *message.PFDManagementRequest:
+		return mandatoryChildren(req.ApplicationIDsPFDs, checkApplicationIDsPFDs)
+	case *message.SessionEstablishmentRequest:
+		if m := mandatoryIE(req.NodeID, ie.NodeID, decodeNodeID); m != nil {
+			return m
+		}
+
+		if m := mandatoryIE(req.CPFSEID, ie.FSEID, decodeFSEID); m != nil {
+			return m
+		}
+
+		if len(req.CreatePDR) == 0 {
+			return errMandatoryIEMissing(ie.CreatePDR)
+		}
+
+		if len(req.CreateFAR) == 0 {
+			return errMandatoryIEMissing(ie.CreateFAR)
+		}
+
+		if m := mandatoryChildren(req.CreatePDR, checkPDRID, checkCreatePDR); m != nil {
+			return m
+		}
+
+		return mandatoryChildren(req.CreateFAR, checkFARID, checkCreateFAR)
+	case *message.SessionModificationRequest:
+		if m := mandatoryChildren(req.CreatePDR, checkPDRID, checkCreatePDR); m != nil {
+			return m
+		}
+
+		if m := mandatoryChildren(req.CreateFAR, checkFARID, checkCreateFAR); m != nil {
+			return m
+		}
+
+		for _, groups := range [][]*ie.IE{req.UpdatePDR, req.RemovePDR} {
+			if m := mandatoryChildren(groups, checkPDRID); m != nil {
+				return m
+			}
+		}
+
+		for _, groups := range [][]*ie.IE{req.UpdateFAR, req.RemoveFAR} {
+			if m := mandatoryChildren(groups, checkFARID); m != nil {
+				return m
+			}
+		}
+
+		return nil
+	case *message.SessionSetDeletionRequest:
+		return mandatoryIE(req.NodeID, ie.NodeID, decodeNodeID)
+	}
+
+	return nil
+}
+
+// checkMessageLength checks that the length in the header of buf matches its size.
+func checkMessageLength(buf []byte) *malformedMsg {
+	h, err := message.ParseHeader(buf)
+	if err != nil {
+		return errInvalidLength(err)
+	}
+
+	if int(h.Length)+pfcpHeaderLen != len(buf) {
+		return errInvalidLength(ErrInvalidArgumentWithReason("message length", h.Length,
+			fmt.Sprintf("%d bytes received", len(buf))))
+	}
+
+	return nil
+}
+
+// requestOfHeader returns an empty request of the type in header h, to answer a request
+// that could not be parsed. Nil if h is not a request answered with a cause.
+func requestOfHeader(h *message.Header) message.Message {
+	switch h.Type {
+	case message.MsgTypeAssociationSetupRequest:
+		return &message.AssociationSetupRequest{Header: h}
+	case message.MsgTypeAssociationReleaseRequest:
+		return &message.AssociationReleaseRequest{Header: h}
+	case message.MsgTypePFDManagementRequest:
+		return &message.PFDManagementRequest{Header: h}
+	case message.MsgTypeSessionEstablishmentRequest:
+		return &message.SessionEstablishmentRequest{Header: h}
+	case message.MsgTypeSessionModificationRequest:
+		return &message.SessionModificationRequest{Header: h}
+	case message.MsgTypeSessionDeletionRequest:
+		return &message.SessionDeletionRequest{Header: h}
+	case message.MsgTypeSessionSetDeletionRequest:
+		return &message.SessionSetDeletionRequest{Header: h}
+	}
+
+	return nil
+}
+
+// rejectUndecodable answers a request that could not be parsed with "Invalid length",
+// if its header could. Other messages are dropped.
+func (pConn *PFCPConn) rejectUndecodable(buf []byte, err error) {
+	var msg message.Message
+
+	if h, hErr := message.ParseHeader(buf); hErr == nil {
+		msg = requestOfHeader(h)
+	}
+
+	if msg == nil {
+		log.Errorln("Ignoring undecodable message from", pConn.RemoteAddr(), "error:", err)
+		return
+	}
+
+	pConn.rejectMalformed(msg, errInvalidLength(err))
+}
+
+// rejectMalformed answers msg with the cause of m, heartbeats are not answered.
+func (pConn *PFCPConn) rejectMalformed(msg message.Message, m *malformedMsg) {
+	log.WithFields(log.Fields{
+		"CP node":      pConn.RemoteAddr(),
+		"message type": msg.MessageTypeName(),
+		"cause":        m.cause,
+	}).Warnln("Rejecting malformed PFCP message:", m)
+
+	pConn.SaveRejectedMessage(pConn.nodeID.remote, msg.MessageTypeName(), m.cause)
+
+	var offendingIE *ie.IE
+	if m.ieType != 0 {
+		offendingIE = ie.NewOffendingIE(m.ieType)
+	}
+
+	if reply := pConn.causeReply(msg, m.cause, offendingIE); reply != nil {
+		pConn.SendPFCPMsg(reply)
+	}
+}
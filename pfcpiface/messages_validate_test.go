@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+
+	"github.com/omec-project/upf-epc/pfcpiface/metrics"
+)
+
+type rejectMetrics struct {
+	metrics.InstrumentPFCP
+	rejected map[uint8]int
+}
+
+func (m *rejectMetrics) SaveRejectedMessage(nodeID, msgType string, cause uint8) {
+	m.rejected[cause]++
+}
+
+func (m *rejectMetrics) SaveMessages(msg *metrics.Message) {}
+
+func mustMarshal(t *testing.T, msg message.Message) []byte {
+	buf := make([]byte, msg.MarshalLen())
+	require.NoError(t, msg.MarshalTo(buf))
+
+	return buf
+}
+
+func newTestSessionEstablishmentRequest(ies ...*ie.IE) *message.SessionEstablishmentRequest {
+	return message.NewSessionEstablishmentRequest(0, 0, 0, 1, 0, ies...)
+}
+
+func Test_validateMessage(t *testing.T) {
+	nodeID := ie.NewNodeID("198.18.0.2", "", "")
+	fseid := ie.NewFSEID(1, net.ParseIP("198.18.0.2"), nil)
+	createPDR := ie.NewCreatePDR(ie.NewPDRID(1), ie.NewPrecedence(100),
+		ie.NewPDI(ie.NewSourceInterface(ie.SrcInterfaceAccess)), ie.NewFARID(1))
+	createFAR := ie.NewCreateFAR(ie.NewFARID(1), ie.NewApplyAction(ActionForward))
+
+	for _, tc := range []struct {
+		name   string
+		msg    message.Message
+		cause  uint8
+		ieType uint16
+	}{
+		{
+			name: "valid establishment",
+			msg:  newTestSessionEstablishmentRequest(nodeID, fseid, createPDR, createFAR),
+		},
+		{
+			name:   "establishment without F-SEID",
+			msg:    newTestSessionEstablishmentRequest(nodeID, createPDR, createFAR),
+			cause:  ie.CauseMandatoryIEMissing,
+			ieType: ie.FSEID,
+		},
+		{
+			name:   "establishment without FAR",
+			msg:    newTestSessionEstablishmentRequest(nodeID, fseid, createPDR),
+			cause:  ie.CauseMandatoryIEMissing,
+			ieType: ie.CreateFAR,
+		},
+		{
+			name: "PDR without PDI",
+			msg: newTestSessionEstablishmentRequest(nodeID, fseid,
+				ie.NewCreatePDR(ie.NewPDRID(1), ie.NewPrecedence(100)), createFAR),
+			cause:  ie.CauseMandatoryIEMissing,
+			ieType: ie.PDI,
+		},
+		{
+			name: "unknown source interface",
+			msg: newTestSessionEstablishmentRequest(nodeID, fseid,
+				ie.NewCreatePDR(ie.NewPDRID(1), ie.NewPrecedence(100), ie.NewPDI(ie.NewSourceInterface(9))), createFAR),
+			cause:  ie.CauseMandatoryIEIncorrect,
+			ieType: ie.SourceInterface,
+		},
+		{
+			name: "FAR without action",
+			msg: newTestSessionEstablishmentRequest(nodeID, fseid, createPDR,
+				ie.NewCreateFAR(ie.NewFARID(1), ie.NewApplyAction(0))),
+			cause:  ie.CauseMandatoryIEIncorrect,
+			ieType: ie.ApplyAction,
+		},
+		{
+			name: "update FAR without ID",
+			msg: message.NewSessionModificationRequest(0, 0, 1, 1, 0,
+				ie.NewUpdateFAR(ie.NewApplyAction(ActionDrop))),
+			cause:  ie.CauseMandatoryIEMissing,
+			ieType: ie.FARID,
+		},
+		{
+			name:   "association setup without recovery timestamp",
+			msg:    message.NewAssociationSetupRequest(1, nodeID),
+			cause:  ie.CauseMandatoryIEMissing,
+			ieType: ie.RecoveryTimeStamp,
+		},
+		{
+			name: "truncated IPv4 Node ID",
+			msg: message.NewAssociationSetupRequest(1, ie.New(ie.NodeID, []byte{ie.NodeIDIPv4Address, 198, 18}),
+				ie.NewRecoveryTimeStamp(time.Now())),
+			cause:  ie.CauseMandatoryIEIncorrect,
+			ieType: ie.NodeID,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := mustMarshal(t, tc.msg)
+
+			msg, err := message.Parse(buf)
+			require.NoError(t, err)
+
+			m := validateMessage(buf, msg)
+			if tc.cause == 0 {
+				require.Nil(t, m)
+				return
+			}
+
+			require.NotNil(t, m)
+			require.Equal(t, tc.cause, m.cause)
+			require.Equal(t, tc.ieType, m.ieType)
+		})
+	}
+
+	t.Run("length mismatch", func(t *testing.T) {
+		buf := mustMarshal(t, message.NewHeartbeatRequest(1, ie.NewRecoveryTimeStamp(time.Now()), nil))
+		binary.BigEndian.PutUint16(buf[2:4], uint16(len(buf)))
+
+		msg, err := message.Parse(buf)
+		require.NoError(t, err)
+
+		m := validateMessage(buf, msg)
+		require.NotNil(t, m)
+		require.Equal(t, ie.CauseInvalidLength, m.cause)
+	})
+}
+
+func TestPFCPConn_HandlePFCPMsg_malformed(t *testing.T) {
+	cp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+
+	defer cp.Close()
+
+	conn, err := net.Dial("udp", cp.LocalAddr().String())
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	m := &rejectMetrics{rejected: make(map[uint8]int)}
+	pConn := &PFCPConn{Conn: conn, upf: &upf{}, store: NewInMemoryStore(), InstrumentPFCP: m}
+	pConn.nodeID.localIE = ie.NewNodeID("198.18.0.1", "", "")
+
+	readCause := func() uint8 {
+		require.NoError(t, cp.SetReadDeadline(time.Now().Add(time.Second)))
+
+		buf := make([]byte, 1024)
+		n, _, err := cp.ReadFrom(buf)
+		require.NoError(t, err)
+
+		reply, err := message.Parse(buf[:n])
+		require.NoError(t, err)
+
+		seres, ok := reply.(*message.SessionEstablishmentResponse)
+		require.True(t, ok)
+
+		cause, err := seres.Cause.Cause()
+		require.NoError(t, err)
+
+		return cause
+	}
+
+	t.Run("missing IE", func(t *testing.T) {
+		pConn.HandlePFCPMsg(mustMarshal(t, newTestSessionEstablishmentRequest(ie.NewNodeID("198.18.0.2", "", ""))))
+		require.Equal(t, ie.CauseMandatoryIEMissing, readCause())
+	})
+
+	t.Run("undecodable IE", func(t *testing.T) {
+		buf := mustMarshal(t, newTestSessionEstablishmentRequest(ie.NewNodeID("198.18.0.2", "", "")))
+		// A Node ID IE claiming more bytes than the message holds.
+		buf = append(buf, 0x00, 0x3c, 0x00, 0x20, 0x00)
+		binary.BigEndian.PutUint16(buf[2:4], uint16(len(buf)-pfcpHeaderLen))
+
+		pConn.HandlePFCPMsg(buf)
+		require.Equal(t, ie.CauseInvalidLength, readCause())
+	})
+
+	require.Equal(t, map[uint8]int{ie.CauseMandatoryIEMissing: 1, ie.CauseInvalidLength: 1}, m.rejected)
+}
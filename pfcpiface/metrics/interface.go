@@ -51,5 +51,14 @@ func (s *Session) Delete() {
 type InstrumentPFCP interface {
 	SaveMessages(m *Message)
 	SaveSessions(s *Session)
+	SaveSuppressedDDN(nodeID, reason string)
+	SaveEndMarkers(nodeID string, count int)
+	SaveThrottledMessage(nodeID, msgType string)
+	SaveRejectedMessage(nodeID, msgType string, cause uint8)
+	SaveRetransmission(nodeID, msgType string)
+	SaveRequestTimeout(nodeID, msgType string)
+	SaveHeartbeatFailure(nodeID string, failed bool)
+	SaveReclaimedSessions(nodeID, reason string, count int)
+	SaveStoreOperation(backend, op string, duration time.Duration, err error)
 	Stop() error
 }
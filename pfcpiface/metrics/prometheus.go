@@ -4,6 +4,7 @@
 package metrics
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -15,6 +16,18 @@ type Service struct {
 
 	sessions        *prometheus.GaugeVec
 	sessionDuration *prometheus.HistogramVec
+
+	ddnSuppressed *prometheus.CounterVec
+	endMarkers    *prometheus.CounterVec
+	throttled     *prometheus.CounterVec
+	rejected      *prometheus.CounterVec
+	retransmitted *prometheus.CounterVec
+	timedOut      *prometheus.CounterVec
+	reclaimed     *prometheus.CounterVec
+	hbFailed      *prometheus.GaugeVec
+
+	storeDuration *prometheus.HistogramVec
+	storeErrors   *prometheus.CounterVec
 }
 
 func NewPrometheusService() (*Service, error) {
@@ -68,12 +81,115 @@ func NewPrometheusService() (*Service, error) {
 		return nil, err
 	}
 
+	ddnSuppressed := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pfcp_ddn_suppressed_total",
+		Help: "Counter for Downlink Data Notifications not sent to the CP because of rate limiting",
+	}, []string{"node_id", "reason"})
+
+	if err := prometheus.Register(ddnSuppressed); err != nil {
+		return nil, err
+	}
+
+	endMarkers := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pfcp_end_markers_sent_total",
+		Help: "Counter for GTP-U End Marker packets written to the datapath",
+	}, []string{"node_id"})
+
+	if err := prometheus.Register(endMarkers); err != nil {
+		return nil, err
+	}
+
+	throttled := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pfcp_messages_throttled_total",
+		Help: "Counter for incoming PFCP requests dropped or rejected because of rate limiting",
+	}, []string{"node_id", "message_type"})
+
+	if err := prometheus.Register(throttled); err != nil {
+		return nil, err
+	}
+
+	rejected := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pfcp_messages_rejected_total",
+		Help: "Counter for incoming PFCP messages rejected as malformed before processing",
+	}, []string{"node_id", "message_type", "cause"})
+
+	if err := prometheus.Register(rejected); err != nil {
+		return nil, err
+	}
+
+	retransmitted := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pfcp_requests_retransmitted_total",
+		Help: "Counter for outgoing PFCP requests retransmitted after a response timeout",
+	}, []string{"node_id", "message_type"})
+
+	if err := prometheus.Register(retransmitted); err != nil {
+		return nil, err
+	}
+
+	timedOut := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pfcp_requests_timed_out_total",
+		Help: "Counter for outgoing PFCP requests left unanswered after all their retransmissions",
+	}, []string{"node_id", "message_type"})
+
+	if err := prometheus.Register(timedOut); err != nil {
+		return nil, err
+	}
+
+	reclaimed := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pfcp_sessions_reclaimed_total",
+		Help: "Counter for sessions removed after the association of their CP node was gone for the grace period",
+	}, []string{"node_id", "reason"})
+
+	if err := prometheus.Register(reclaimed); err != nil {
+		return nil, err
+	}
+
+	hbFailed := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pfcp_peer_heartbeat_failed",
+		Help: "Whether the CP node stopped answering heartbeats, while its sessions are kept",
+	}, []string{"node_id"})
+
+	if err := prometheus.Register(hbFailed); err != nil {
+		return nil, err
+	}
+
+	storeDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pfcp_session_store_duration_seconds",
+		Help:    "The latency of the operations of the PFCP session store",
+		Buckets: []float64{1e-6, 1e-5, 1e-4, 1e-3, 1e-2, 1e-1, 1, 1e1},
+	}, []string{"backend", "operation"})
+
+	if err := prometheus.Register(storeDuration); err != nil {
+		return nil, err
+	}
+
+	storeErrors := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pfcp_session_store_errors_total",
+		Help: "Counter for failed operations of the PFCP session store",
+	}, []string{"backend", "operation"})
+
+	if err := prometheus.Register(storeErrors); err != nil {
+		return nil, err
+	}
+
 	s := &Service{
 		msgCount:    msgCount,
 		msgDuration: msgDuration,
 
 		sessions:        sessions,
 		sessionDuration: sessionDuration,
+
+		ddnSuppressed: ddnSuppressed,
+		endMarkers:    endMarkers,
+		throttled:     throttled,
+		rejected:      rejected,
+		retransmitted: retransmitted,
+		timedOut:      timedOut,
+		reclaimed:     reclaimed,
+		hbFailed:      hbFailed,
+
+		storeDuration: storeDuration,
+		storeErrors:   storeErrors,
 	}
 
 	return s, nil
@@ -94,11 +210,66 @@ func (s *Service) SaveSessions(sess *Session) {
 	s.sessionDuration.WithLabelValues(sess.NodeID).Observe(sess.Duration)
 }
 
+func (s *Service) SaveSuppressedDDN(nodeID, reason string) {
+	s.ddnSuppressed.WithLabelValues(nodeID, reason).Inc()
+}
+
+func (s *Service) SaveEndMarkers(nodeID string, count int) {
+	s.endMarkers.WithLabelValues(nodeID).Add(float64(count))
+}
+
+func (s *Service) SaveThrottledMessage(nodeID, msgType string) {
+	s.throttled.WithLabelValues(nodeID, msgType).Inc()
+}
+
+func (s *Service) SaveRejectedMessage(nodeID, msgType string, cause uint8) {
+	s.rejected.WithLabelValues(nodeID, msgType, strconv.Itoa(int(cause))).Inc()
+}
+
+func (s *Service) SaveRetransmission(nodeID, msgType string) {
+	s.retransmitted.WithLabelValues(nodeID, msgType).Inc()
+}
+
+func (s *Service) SaveRequestTimeout(nodeID, msgType string) {
+	s.timedOut.WithLabelValues(nodeID, msgType).Inc()
+}
+
+func (s *Service) SaveReclaimedSessions(nodeID, reason string, count int) {
+	s.reclaimed.WithLabelValues(nodeID, reason).Add(float64(count))
+}
+
+func (s *Service) SaveHeartbeatFailure(nodeID string, failed bool) {
+	if failed {
+		s.hbFailed.WithLabelValues(nodeID).Set(1)
+		return
+	}
+
+	s.hbFailed.DeleteLabelValues(nodeID)
+}
+
+func (s *Service) SaveStoreOperation(backend, op string, duration time.Duration, err error) {
+	s.storeDuration.WithLabelValues(backend, op).Observe(duration.Seconds())
+
+	if err != nil {
+		s.storeErrors.WithLabelValues(backend, op).Inc()
+	}
+}
+
 func (s *Service) Stop() error {
 	prometheus.Unregister(s.msgCount)
 	prometheus.Unregister(s.msgDuration)
 	prometheus.Unregister(s.sessions)
 	prometheus.Unregister(s.sessionDuration)
+	prometheus.Unregister(s.ddnSuppressed)
+	prometheus.Unregister(s.endMarkers)
+	prometheus.Unregister(s.throttled)
+	prometheus.Unregister(s.rejected)
+	prometheus.Unregister(s.retransmitted)
+	prometheus.Unregister(s.timedOut)
+	prometheus.Unregister(s.reclaimed)
+	prometheus.Unregister(s.hbFailed)
+	prometheus.Unregister(s.storeDuration)
+	prometheus.Unregister(s.storeErrors)
 
 	return nil
 }
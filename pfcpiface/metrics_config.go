@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Collectors that can be disabled with metrics.disabled_collectors, those reading the
+// datapath or walking all the sessions on each scrape.
+const (
+	collectorSession  = "session"
+	collectorStore    = "store"
+	collectorPort     = "port"
+	collectorLatency  = "latency"
+	collectorSlice    = "slice"
+	collectorGTPUPath = "gtpu_path"
+	collectorDatapath = "datapath"
+)
+
+var metricsCollectors = []string{
+	collectorSession,
+	collectorStore,
+	collectorPort,
+	collectorLatency,
+	collectorSlice,
+	collectorGTPUPath,
+	collectorDatapath,
+}
+
+var (
+	metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRegexp  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+func validateMetrics(m MetricsInfo, errs *confErrors) {
+	if m.Namespace != "" && !metricNameRegexp.MatchString(m.Namespace) {
+		errs.add(ErrInvalidArgumentWithReason("conf.Metrics.Namespace", m.Namespace, "invalid metric name prefix"))
+	}
+
+	for name := range m.Labels {
+		if !labelNameRegexp.MatchString(name) || len(name) > 1 && name[:2] == "__" {
+			errs.add(ErrInvalidArgumentWithReason("conf.Metrics.Labels", name, "invalid label name"))
+		}
+	}
+
+	for _, c := range m.DisabledCollectors {
+		known := false
+
+		for _, k := range metricsCollectors {
+			if c == k {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			errs.add(ErrInvalidArgumentWithReason("conf.Metrics.DisabledCollectors", c, "unknown collector"))
+		}
+	}
+}
+
+// collectorEnabled returns false if the collector name is disabled in the config.
+func (u *upf) collectorEnabled(name string) bool {
+	return !u.disabledCollectors[name]
+}
+
+// metricsGatherer exposes the metrics of a gatherer under a namespace, with static
+// labels attached to all of them. A label a metric already has keeps its value.
+type metricsGatherer struct {
+	prometheus.Gatherer
+	prefix string
+	labels []*dto.LabelPair
+}
+
+// newMetricsGatherer returns g itself when conf sets neither a namespace nor labels.
+func newMetricsGatherer(g prometheus.Gatherer, conf MetricsInfo) prometheus.Gatherer {
+	if conf.Namespace == "" && len(conf.Labels) == 0 {
+		return g
+	}
+
+	mg := &metricsGatherer{Gatherer: g}
+
+	if conf.Namespace != "" {
+		mg.prefix = conf.Namespace + "_"
+	}
+
+	for name, value := range conf.Labels {
+		mg.labels = append(mg.labels, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+	}
+
+	return mg
+}
+
+func (g *metricsGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+
+	for _, f := range families {
+		f.Name = proto.String(g.prefix + f.GetName())
+
+		for _, m := range f.Metric {
+			m.Label = g.withLabels(m.Label)
+		}
+	}
+
+	return families, err
+}
+
+// withLabels returns the labels of a metric with the static labels it lacks, sorted by
+// name as expected of a gathered metric.
+func (g *metricsGatherer) withLabels(labels []*dto.LabelPair) []*dto.LabelPair {
+	for _, static := range g.labels {
+		found := false
+
+		for _, l := range labels {
+			if l.GetName() == static.GetName() {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			labels = append(labels, static)
+		}
+	}
+
+	sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+
+	return labels
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsGatherer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "upf_test_total", Help: "test"}, []string{"slice"})
+	reg.MustRegister(counter)
+	counter.WithLabelValues("internet").Inc()
+
+	require.Equal(t, prometheus.Gatherer(reg), newMetricsGatherer(reg, MetricsInfo{}))
+
+	g := newMetricsGatherer(reg, MetricsInfo{
+		Namespace: "edge",
+		Labels:    map[string]string{"site": "edge-1", "slice": "default"},
+	})
+
+	families, err := g.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	require.Equal(t, "edge_upf_test_total", families[0].GetName())
+
+	labels := make(map[string]string)
+	for _, l := range families[0].Metric[0].GetLabel() {
+		labels[l.GetName()] = l.GetValue()
+	}
+
+	// The slice label of the metric is kept.
+	require.Equal(t, map[string]string{"site": "edge-1", "slice": "internet"}, labels)
+	require.Equal(t, "site", families[0].Metric[0].GetLabel()[0].GetName())
+}
+
+func TestUpfCollectorDisabledCollectors(t *testing.T) {
+	u := &upf{
+		datapath:           &sliceMeterDatapath{},
+		datapathMetrics:    newDatapathMetrics(),
+		disabledCollectors: map[string]bool{collectorSlice: true, collectorDatapath: true},
+	}
+	require.NoError(t, u.addSliceInfo(&SliceInfo{name: "metered"}))
+	u.datapathMetrics.errors.WithLabelValues(datapathFake, "add").Inc()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(newUpfCollector(u))
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	for _, f := range families {
+		require.NotContains(t, f.GetName(), "upf_slice_")
+		require.NotContains(t, f.GetName(), "upf_datapath_")
+	}
+
+	u.disabledCollectors = nil
+
+	families, err = reg.Gather()
+	require.NoError(t, err)
+
+	var names []string
+	for _, f := range families {
+		names = append(names, f.GetName())
+	}
+
+	require.Contains(t, names, "upf_slice_bytes_total")
+	require.Contains(t, names, "upf_datapath_operation_errors_total")
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	metricsPushJobDefault      = "upf"
+	metricsPushIntervalDefault = 15 * time.Second
+	metricsPushTimeout         = 10 * time.Second
+)
+
+// metricsPusher periodically pushes the metrics of the UPF, those of the upfCollector
+// and the PfcpNodeCollector included, to a Prometheus Pushgateway, for the pods that
+// live too short to be scraped. Each push replaces the group of the UPF.
+type metricsPusher struct {
+	pusher       *push.Pusher
+	interval     time.Duration
+	deleteOnStop bool
+}
+
+// newMetricsPusher returns a pusher of the metrics gathered by g. The group of the
+// UPF is labeled with instance, unless the grouping of conf sets it.
+func newMetricsPusher(conf MetricsPushInfo, g prometheus.Gatherer, instance string) *metricsPusher {
+	pusher := push.New(conf.URL, conf.Job).
+		Gatherer(g).
+		Client(&http.Client{Timeout: metricsPushTimeout})
+
+	if instance != "" {
+		pusher.Grouping("instance", instance)
+	}
+
+	for name, value := range conf.Grouping {
+		pusher.Grouping(name, value)
+	}
+
+	return &metricsPusher{
+		pusher:       pusher,
+		interval:     validDuration(conf.Interval),
+		deleteOnStop: conf.DeleteOnStop,
+	}
+}
+
+// run pushes the metrics every interval until ctx is done, then pushes them a last
+// time, or deletes the group of the UPF.
+func (m *metricsPusher) run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.stop()
+			return
+		case <-ticker.C:
+			if err := m.pusher.Push(); err != nil {
+				log.Warnln("Pushing metrics failed:", err)
+			}
+		}
+	}
+}
+
+func (m *metricsPusher) stop() {
+	if m.deleteOnStop {
+		if err := m.pusher.Delete(); err != nil {
+			log.Warnln("Deleting pushed metrics failed:", err)
+		}
+
+		return
+	}
+
+	if err := m.pusher.Push(); err != nil {
+		log.Warnln("Pushing metrics failed:", err)
+	}
+}
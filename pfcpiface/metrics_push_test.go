@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+type pushRequest struct {
+	method string
+	path   string
+	body   string
+}
+
+// fakePushgateway records the requests of a metricsPusher.
+type fakePushgateway struct {
+	mu       sync.Mutex
+	requests []pushRequest
+}
+
+func (g *fakePushgateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	g.mu.Lock()
+	g.requests = append(g.requests, pushRequest{method: r.Method, path: r.URL.Path, body: string(body)})
+	g.mu.Unlock()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (g *fakePushgateway) received() []pushRequest {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([]pushRequest(nil), g.requests...)
+}
+
+func TestMetricsPusher(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "upf_test_total", Help: "test"})
+	reg.MustRegister(counter)
+	counter.Add(3)
+
+	for _, deleteOnStop := range []bool{false, true} {
+		deleteOnStop := deleteOnStop
+
+		t.Run(map[bool]string{false: "push on stop", true: "delete on stop"}[deleteOnStop], func(t *testing.T) {
+			gw := &fakePushgateway{}
+			srv := httptest.NewServer(gw)
+			t.Cleanup(srv.Close)
+
+			m := newMetricsPusher(MetricsPushInfo{
+				URL:          srv.URL,
+				Job:          metricsPushJobDefault,
+				Interval:     "20ms",
+				Grouping:     map[string]string{"site": "edge-1"},
+				DeleteOnStop: deleteOnStop,
+			}, reg, "upf-1")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+
+			go func() {
+				defer close(done)
+				m.run(ctx)
+			}()
+
+			require.Eventually(t, func() bool { return len(gw.received()) > 0 }, time.Second, 10*time.Millisecond)
+			cancel()
+			<-done
+
+			requests := gw.received()
+			require.Equal(t, http.MethodPut, requests[0].method)
+			require.True(t, strings.HasPrefix(requests[0].path, "/metrics/job/upf/"))
+			require.Contains(t, requests[0].path, "/instance/upf-1")
+			require.Contains(t, requests[0].path, "/site/edge-1")
+			require.True(t, strings.Contains(requests[0].body, "upf_test_total"))
+
+			last := requests[len(requests)-1]
+			if deleteOnStop {
+				require.Equal(t, http.MethodDelete, last.method)
+			} else {
+				require.Equal(t, http.MethodPut, last.method)
+			}
+		})
+	}
+}
+
+func TestNewMetricsPusherInstanceGrouping(t *testing.T) {
+	gw := &fakePushgateway{}
+	srv := httptest.NewServer(gw)
+	t.Cleanup(srv.Close)
+
+	m := newMetricsPusher(MetricsPushInfo{
+		URL:      srv.URL,
+		Job:      "upf",
+		Interval: "1s",
+		Grouping: map[string]string{"instance": "pod-7"},
+	}, prometheus.NewRegistry(), "upf-1")
+
+	require.NoError(t, m.pusher.Push())
+	require.Equal(t, "/metrics/job/upf/instance/pod-7", gw.received()[0].path)
+}
@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+)
+
+// neighborProxy answers the ARP requests for the UE addresses of the proxied pools
+// received on the core interface, with the MAC address of the interface. Datapaths
+// match IPv4 UE addresses only, so there are no Neighbor Solicitations to answer.
+type neighborProxy struct {
+	pools   []*net.IPNet
+	mac     net.HardwareAddr
+	ifindex int
+}
+
+// newNeighborProxy returns nil unless the neighbor proxy is enabled.
+func newNeighborProxy(conf *Conf) (*neighborProxy, error) {
+	if !conf.NeighborProxy.Enable {
+		return nil, nil
+	}
+
+	iface, err := net.InterfaceByName(conf.CoreIface.IfName)
+	if err != nil {
+		return nil, ErrOperationFailedWithReason("neighbor proxy", err.Error())
+	}
+
+	n := &neighborProxy{mac: iface.HardwareAddr, ifindex: iface.Index}
+
+	for _, pool := range neighborProxyPools(*conf) {
+		_, subnet, err := net.ParseCIDR(pool)
+		if err != nil {
+			return nil, ErrInvalidArgumentWithReason("conf.NeighborProxy.Pools", pool, err.Error())
+		}
+
+		n.pools = append(n.pools, subnet)
+	}
+
+	return n, nil
+}
+
+// neighborProxyPools returns the proxied pools, the IPv4 UE IP pools if none is set.
+func neighborProxyPools(conf Conf) []string {
+	if len(conf.NeighborProxy.Pools) > 0 {
+		return conf.NeighborProxy.Pools
+	}
+
+	var pools []string
+
+	if conf.CPIface.UEIPPool != "" {
+		pools = append(pools, conf.CPIface.UEIPPool)
+	}
+
+	for _, p := range conf.CPIface.ueIPPools() {
+		if p.Pool != "" {
+			pools = append(pools, p.Pool)
+		}
+	}
+
+	return pools
+}
+
+// addresses returns the UE addresses of the downlink PDRs in the proxied pools.
+func (n *neighborProxy) addresses(pdrs []pdr) []uint32 {
+	var ips []uint32
+
+	seen := make(map[uint32]bool)
+
+	for _, p := range pdrs {
+		if !p.IsDownlink() || p.ueAddress == 0 || seen[p.ueAddress] {
+			continue
+		}
+
+		seen[p.ueAddress] = true
+
+		for _, pool := range n.pools {
+			if pool.Contains(int2ip(p.ueAddress)) {
+				ips = append(ips, p.ueAddress)
+				break
+			}
+		}
+	}
+
+	return ips
+}
+
+func validateNeighborProxy(conf Conf, errs *confErrors) {
+	np := conf.NeighborProxy
+	if !np.Enable {
+		return
+	}
+
+	if conf.EnableP4rt || (conf.Datapath != "" && conf.Datapath != datapathBESS &&
+		conf.Datapath != datapathXDP && conf.Datapath != datapathFake) {
+		errs.add(ErrInvalidArgumentWithReason("conf.NeighborProxy", np, "only supported by the BESS and XDP datapaths"))
+	}
+
+	if conf.CoreIface.IfName == "" {
+		errs.add(ErrInvalidArgumentWithReason("conf.CoreIface.IfName", conf.CoreIface.IfName,
+			"must be set to answer ARP requests on it"))
+	}
+
+	pools := neighborProxyPools(conf)
+	if len(pools) == 0 {
+		errs.add(ErrInvalidArgumentWithReason("conf.NeighborProxy.Pools", np.Pools, "no UE IP pool to proxy"))
+	}
+
+	for _, pool := range pools {
+		if ip, _, err := net.ParseCIDR(pool); err != nil || ip.To4() == nil {
+			errs.add(ErrInvalidArgumentWithReason("conf.NeighborProxy.Pools", pool, "must be an IPv4 CIDR"))
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNeighborProxyAddresses(t *testing.T) {
+	iface, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("no loopback interface:", err)
+	}
+
+	conf := &Conf{
+		CoreIface: IfaceType{IfName: iface.Name},
+		CPIface: CPIfaceInfo{
+			UEIPPool:  "10.250.0.0/16",
+			UEIPPools: []UEIPPoolInfo{{Dnn: "enterprise", Pool: "10.251.0.0/16"}},
+		},
+	}
+
+	np, err := newNeighborProxy(conf)
+	require.NoError(t, err)
+	require.Nil(t, np)
+
+	conf.NeighborProxy = NeighborProxyInfo{Enable: true}
+	np, err = newNeighborProxy(conf)
+	require.NoError(t, err)
+	require.Equal(t, iface.Index, np.ifindex)
+	require.Len(t, np.pools, 2)
+
+	ue := ip2int(net.ParseIP("10.251.0.7"))
+	pdrs := []pdr{
+		{srcIface: core, ueAddress: ue},
+		{srcIface: core, ueAddress: ue, pdrID: 2},
+		{srcIface: access, ueAddress: ip2int(net.ParseIP("10.250.0.1"))},
+		{srcIface: core, ueAddress: ip2int(net.ParseIP("172.16.0.1"))},
+	}
+	require.Equal(t, []uint32{ue}, np.addresses(pdrs))
+
+	conf.NeighborProxy.Pools = []string{"10.250.0.0/16"}
+	np, err = newNeighborProxy(conf)
+	require.NoError(t, err)
+	require.Empty(t, np.addresses(pdrs))
+}
+
+func TestValidateNeighborProxy(t *testing.T) {
+	core := IfaceType{IfName: "core"}
+	pools := CPIfaceInfo{UEIPPool: "10.250.0.0/16"}
+
+	for _, tc := range []struct {
+		name  string
+		conf  Conf
+		valid bool
+	}{
+		{
+			name:  "disabled",
+			conf:  Conf{EnableP4rt: true},
+			valid: true,
+		},
+		{
+			name:  "UE IP pools",
+			conf:  Conf{Datapath: datapathXDP, CoreIface: core, CPIface: pools, NeighborProxy: NeighborProxyInfo{Enable: true}},
+			valid: true,
+		},
+		{
+			name: "pools",
+			conf: Conf{CoreIface: core, NeighborProxy: NeighborProxyInfo{
+				Enable: true, Pools: []string{"10.250.0.0/24", "10.251.0.0/24"}}},
+			valid: true,
+		},
+		{
+			name:  "P4 datapath",
+			conf:  Conf{EnableP4rt: true, CoreIface: core, CPIface: pools, NeighborProxy: NeighborProxyInfo{Enable: true}},
+			valid: false,
+		},
+		{
+			name:  "no core interface",
+			conf:  Conf{CPIface: pools, NeighborProxy: NeighborProxyInfo{Enable: true}},
+			valid: false,
+		},
+		{
+			name:  "no pool",
+			conf:  Conf{CoreIface: core, NeighborProxy: NeighborProxyInfo{Enable: true}},
+			valid: false,
+		},
+		{
+			name:  "IPv6 pool",
+			conf:  Conf{CoreIface: core, NeighborProxy: NeighborProxyInfo{Enable: true, Pools: []string{"2001:db8::/64"}}},
+			valid: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var errs confErrors
+
+			validateNeighborProxy(tc.conf, &errs)
+
+			if tc.valid {
+				require.NoError(t, errs.err())
+			} else {
+				require.Error(t, errs.err())
+			}
+		})
+	}
+}
+
+func TestNeighborProxySetupFailure(t *testing.T) {
+	conf := &Conf{
+		CoreIface:     IfaceType{IfName: "nonexistent0"},
+		NeighborProxy: NeighborProxyInfo{Enable: true, Pools: []string{"10.250.0.0/16"}},
+	}
+
+	require.Error(t, (&xdp{}).SetUpfInfo(&upf{}, conf))
+	require.Error(t, (&bess{}).SetUpfInfo(&upf{}, conf))
+}
@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// Local interfaces Network Instances are mapped to.
+const (
+	niInterfaceAccess = "access"
+	niInterfaceCore   = "core"
+)
+
+var errNetworkInstanceMismatch = errors.New("network instance of another interface")
+
+// niIface is the local interface of a Network Instance. ip sources the tunnels leaving
+// by it, the access or core IP of the UPF if unset, and those to the peers of its
+// subnets.
+type niIface struct {
+	iface uint8
+	ip    net.IP
+	peers []*net.IPNet
+}
+
+// gtpuEndpoint is a local GTP-U endpoint, advertised to the load balancers.
+type gtpuEndpoint struct {
+	Interface       string `json:"interface"`
+	IP              string `json:"ip"`
+	NetworkInstance string `json:"network_instance,omitempty"`
+}
+
+// niTable maps Network Instances to local interfaces. Network Instances missing from
+// the table, e.g. those naming DNNs, use the access and core interfaces.
+type niTable map[string]niIface
+
+func newNITable(infos []NetworkInstanceInfo) niTable {
+	if len(infos) == 0 {
+		return nil
+	}
+
+	t := make(niTable, len(infos))
+
+	for _, info := range infos {
+		i := niIface{iface: core, ip: net.ParseIP(info.IP).To4()}
+		if info.Interface == niInterfaceAccess {
+			i.iface = access
+		}
+
+		if i.ip == nil && info.IfName != "" {
+			ip, err := GetUnicastAddressFromInterface(info.IfName)
+			if err != nil {
+				log.Errorln("Failed to get the IP of network instance", info.NetworkInstance, "interface:", err)
+			}
+
+			i.ip = ip
+		}
+
+		for _, subnet := range info.PeerSubnets {
+			if _, peers, err := net.ParseCIDR(subnet); err == nil {
+				i.peers = append(i.peers, peers)
+			}
+		}
+
+		t[info.NetworkInstance] = i
+	}
+
+	return t
+}
+
+func (t niTable) has(networkInstance string) bool {
+	_, ok := t[networkInstance]
+	return ok
+}
+
+// checkSource fails if networkInstance is mapped to another interface than srcIface,
+// that of a PDI.
+func (t niTable) checkSource(networkInstance string, srcIface uint8) error {
+	i, ok := t[networkInstance]
+	if !ok || srcIface == 0 || i.iface == srcIface {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s is not on the %s side", errNetworkInstanceMismatch, networkInstance, ifaceName(srcIface))
+}
+
+// tunnelSource returns the source IP of the tunnels to dstIntf, the Destination
+// Interface of a FAR, through the interface of networkInstance. ok is false if
+// networkInstance is not mapped.
+func (t niTable) tunnelSource(networkInstance string, dstIntf uint8, upf *upf) (ip net.IP, ok bool, err error) {
+	i, ok := t[networkInstance]
+	if !ok {
+		return nil, false, nil
+	}
+
+	iface := dstIface(dstIntf)
+	if i.iface != iface {
+		return nil, true, fmt.Errorf("%w: %s is not on the %s side", errNetworkInstanceMismatch, networkInstance, ifaceName(iface))
+	}
+
+	return i.source(upf), true, nil
+}
+
+// peerSource returns the source IP of the tunnels to peer through the interface on the
+// side of dstIntf whose peer subnets hold peer, the first by Network Instance name. ok
+// is false if there is none.
+func (t niTable) peerSource(dstIntf uint8, peer uint32, upf *upf) (ip net.IP, ok bool) {
+	if peer == 0 {
+		return nil, false
+	}
+
+	iface := dstIface(dstIntf)
+
+	for _, name := range t.names() {
+		i := t[name]
+		if i.iface != iface {
+			continue
+		}
+
+		for _, subnet := range i.peers {
+			if subnet.Contains(int2ip(peer)) {
+				return i.source(upf), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// endpointIP returns the IP of the interface of networkInstance, nil if it has none of
+// its own.
+func (t niTable) endpointIP(networkInstance string) net.IP {
+	return t[networkInstance].ip
+}
+
+// endpoints returns the GTP-U endpoints of the Network Instances with an IP of their
+// own, sorted by Network Instance.
+func (t niTable) endpoints() []gtpuEndpoint {
+	var endpoints []gtpuEndpoint
+
+	for _, name := range t.names() {
+		if i := t[name]; i.ip != nil {
+			endpoints = append(endpoints, gtpuEndpoint{Interface: ifaceName(i.iface), IP: i.ip.String(), NetworkInstance: name})
+		}
+	}
+
+	return endpoints
+}
+
+func (t niTable) names() []string {
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// source returns the IP of the interface, the access or core IP if it has none.
+func (i niIface) source(upf *upf) net.IP {
+	switch {
+	case i.ip != nil:
+		return i.ip
+	case i.iface == access:
+		return upf.AccessIP
+	default:
+		return upf.CoreIP
+	}
+}
+
+// gtpuEndpoints returns the access and core GTP-U endpoints of the UPF, followed by those
+// of the Network Instances.
+func (u *upf) gtpuEndpoints() []gtpuEndpoint {
+	var endpoints []gtpuEndpoint
+
+	for _, e := range []struct {
+		iface string
+		ip    net.IP
+	}{
+		{niInterfaceAccess, u.AccessIP},
+		{niInterfaceCore, u.CoreIP},
+	} {
+		if e.ip != nil && !e.ip.IsUnspecified() {
+			endpoints = append(endpoints, gtpuEndpoint{Interface: e.iface, IP: e.ip.String()})
+		}
+	}
+
+	return append(endpoints, u.nis.endpoints()...)
+}
+
+// dstIface returns the side of the UPF of dstIntf, the Destination Interface of a FAR.
+func dstIface(dstIntf uint8) uint8 {
+	if dstIntf == ie.DstInterfaceAccess {
+		return access
+	}
+
+	return core
+}
+
+func ifaceName(iface uint8) string {
+	if iface == access {
+		return niInterfaceAccess
+	}
+
+	return niInterfaceCore
+}
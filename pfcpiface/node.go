@@ -6,11 +6,14 @@ package pfcpiface
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"sync"
+	"time"
 
 	reuse "github.com/libp2p/go-reuseport"
 	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
 
 	"github.com/omec-project/upf-epc/pfcpiface/metrics"
 )
@@ -35,13 +38,15 @@ type PFCPNode struct {
 	upf *upf
 	// metrics for PFCP messages and sessions
 	metrics metrics.InstrumentPFCP
+	// replication streams the sessions to the standbys, nil without HA.
+	replication *replicationHub
 }
 
 // NewPFCPNode create a new PFCPNode listening on local address.
-func NewPFCPNode(upf *upf, conf *Conf) *PFCPNode {
-	conn, err := reuse.ListenPacket("udp", ":"+PFCPPort)
+func NewPFCPNode(upf *upf, conf *Conf) (*PFCPNode, error) {
+	conn, err := reuse.ListenPacket("udp", net.JoinHostPort(conf.CPIface.PFCPBindIP, conf.CPIface.PFCPPort))
 	if err != nil {
-		log.Fatalln("ListenUDP failed", err)
+		return nil, fmt.Errorf("listen on PFCP port failed: %w", err)
 	}
 
 	gwIp := getExitLbInt()
@@ -49,11 +54,17 @@ func NewPFCPNode(upf *upf, conf *Conf) *PFCPNode {
 
 	metrics, err := metrics.NewPrometheusService()
 	if err != nil {
-		log.Fatalln("prom metrics service init failed", err)
+		conn.Close()
+		return nil, fmt.Errorf("prom metrics service init failed: %w", err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
+	var replication *replicationHub
+	if conf.HA.Role != "" || conf.LeaderElection.Enable {
+		replication = newReplicationHub(conf.HA.Role == haRoleActive)
+	}
+
 	return &PFCPNode{
 		ctx:        ctx,
 		cancel:     cancel,
@@ -66,11 +77,13 @@ func NewPFCPNode(upf *upf, conf *Conf) *PFCPNode {
 		coreMac:    GetMac("core"),
 		accessMac:  GetMac("access"),
 		hostname:   conf.CPIface.NodeID,
-	}
+
+		replication: replication,
+	}, nil
 }
 
-func (node *PFCPNode) tryConnectToN4Peers(lAddrStr string) {
-	for _, peer := range node.upf.peers {
+func (node *PFCPNode) tryConnectToN4Peers(lAddrStr string, peers []string) {
+	for _, peer := range peers {
 		conn, err := net.Dial("udp", peer+":"+PFCPPort)
 		if err != nil {
 			log.Warnln("Failed to establish PFCP connection to peer ", peer)
@@ -96,7 +109,7 @@ func (node *PFCPNode) handleNewPeers() {
 	lAddrStr := node.LocalAddr().String()
 	log.Infoln("listening for new PFCP connections on", lAddrStr)
 
-	node.tryConnectToN4Peers(lAddrStr)
+	node.tryConnectToN4Peers(lAddrStr, node.connectPeers())
 
 	for {
 		buf := make([]byte, 1024)
@@ -122,21 +135,105 @@ func (node *PFCPNode) handleNewPeers() {
 	}
 }
 
+// connectPeers returns the configured CP nodes, and those associated before a restart,
+// which learn of it from the Recovery Time Stamp of the Association Setup Request.
+func (node *PFCPNode) connectPeers() []string {
+	peers := append([]string(nil), node.upf.getPeers()...)
+
+	for _, prev := range node.upf.recovery.previousPeers() {
+		known := false
+
+		for _, peer := range peers {
+			if peer == prev {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			peers = append(peers, prev)
+		}
+	}
+
+	return peers
+}
+
 // Serve listens for the first packet from a new PFCP peer and creates PFCPConn.
 func (node *PFCPNode) Serve() {
 	go node.handleNewPeers()
+	go node.upf.usageWheel.run(node.ctx)
+
+	if node.upf.pathMonitor != nil {
+		go node.upf.pathMonitor.run(node.ctx, node.upf.AccessIP, node.activeGTPUPeers)
+	}
+
+	if node.upf.webhooks != nil {
+		go node.upf.webhooks.run(node.ctx)
+	}
+
+	if node.upf.charging != nil {
+		go node.upf.charging.run(node.ctx)
+	}
+
+	if node.upf.flowExport != nil {
+		go node.upf.flowExport.run(node.ctx, node.allSessions, node.upf.ReadPDRCounters)
+	}
+
+	if node.upf.sessionEvents != nil {
+		go node.upf.sessionEvents.run(node.ctx, node.sessionEventsSnapshot)
+	}
+
+	if node.upf.loadMonitor != nil {
+		go node.upf.loadMonitor.run(node.ctx, node.sessionCount, node.datapathQueueDepth)
+	}
+
+	// Audits run in this loop, not concurrently with replaying sessions.
+	var auditTicks <-chan time.Time
+
+	if node.upf.auditor != nil {
+		ticker := time.NewTicker(node.upf.auditor.interval)
+		defer ticker.Stop()
+
+		auditTicks = ticker.C
+	}
+
+	// Leases are checked twice per TTL, so that UE IPs are reclaimed within 1.5 TTL.
+	var leaseTicks <-chan time.Time
+
+	if node.upf.ueIPLeaseTTL != 0 {
+		ticker := time.NewTicker(node.upf.ueIPLeaseTTL / 2)
+		defer ticker.Stop()
+
+		leaseTicks = ticker.C
+	}
+
+	var gcTicks <-chan time.Time
+
+	if node.upf.sessionGC != nil {
+		ticker := time.NewTicker(node.upf.sessionGC.interval)
+		defer ticker.Stop()
+
+		gcTicks = ticker.C
+	}
 
 	shutdown := false
 
 	for !shutdown {
 		select {
-		case fseid := <-node.upf.reportNotifyChan:
-			// TODO: Logic to distinguish PFCPConn based on SEID
-			node.pConns.Range(func(key, value interface{}) bool {
-				pConn := value.(*PFCPConn)
-				pConn.handleDigestReport(fseid)
-				return false
-			})
+		case <-node.upf.reports.ready:
+			node.handleReportNotifications()
+		case event := <-node.upf.pathEventChan:
+			node.reportGTPUPathEvent(event)
+		case ind := <-node.upf.errorIndChan:
+			node.handleGTPUErrorIndication(ind)
+		case <-node.upf.resyncChan:
+			node.resyncDatapath()
+		case <-auditTicks:
+			node.auditDatapath()
+		case <-leaseTicks:
+			node.reclaimUEIPs()
+		case <-gcTicks:
+			node.collectOrphanedSessions()
 		case rAddr := <-node.pConnDone:
 			node.pConns.Delete(rAddr)
 			log.Infoln("Removed connection to", rAddr)
@@ -186,6 +283,161 @@ func (node *PFCPNode) Serve() {
 	close(node.done)
 }
 
+// SendAssociationUpdate sends an Association Update Request with the given IEs to every
+// associated CP node and blocks until all of them have answered or timed out.
+func (node *PFCPNode) SendAssociationUpdate(ies ...*ie.IE) {
+	node.sendAssociationUpdate(nil, ies...)
+}
+
+// sendAssociationUpdate sends an Association Update Request with the given IEs to the
+// associated CP nodes selected by match, all of them if nil.
+func (node *PFCPNode) sendAssociationUpdate(match func(*PFCPConn) bool, ies ...*ie.IE) {
+	var wg sync.WaitGroup
+
+	node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+		if pConn.nodeID.remote == "" {
+			// association not established yet
+			return true
+		}
+
+		if match != nil && !match(pConn) {
+			return true
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := pConn.sendAssociationUpdateRequest(ies...); err != nil {
+				log.Errorln("Association Update Request to", pConn.RemoteAddr(), "failed:", err)
+			}
+		}()
+
+		return true
+	})
+
+	wg.Wait()
+}
+
+// AdvertiseUEIPPools notifies all associated CP nodes about the UE IP pools of the given
+// DNNs, identified by their DNN. The default pool, of DNN "", is that of the UPF DNN.
+func (node *PFCPNode) AdvertiseUEIPPools(dnns []string) {
+	ies := make([]*ie.IE, 0, len(dnns))
+
+	for _, dnn := range dnns {
+		if dnn == "" {
+			dnn = node.upf.Dnn
+		}
+
+		ies = append(ies, ie.NewUEIPAddressPoolInformation(
+			ie.NewUEIPAddressPoolIdentity(dnn),
+			ie.NewNetworkInstanceFQDN(dnn),
+		))
+	}
+
+	node.SendAssociationUpdate(ies...)
+}
+
+// ReleaseAssociations asks every associated CP node to release the PFCP association.
+// The CP nodes are given the configured graceful release period to remove their
+// sessions; ReleaseAssociations returns once all sessions are gone or the period expired,
+// whether the CP nodes answered or not. Nothing is released without a period.
+func (node *PFCPNode) ReleaseAssociations() {
+	period := node.upf.gracefulReleasePeriod
+	if period == 0 {
+		return
+	}
+
+	log.Infoln("Requesting release of PFCP associations, graceful release period:", period)
+
+	deadline := time.After(period)
+	sent := make(chan struct{})
+
+	go func() {
+		defer close(sent)
+
+		node.SendAssociationUpdate(
+			ie.NewPFCPAssociationReleaseRequest(1, 0),
+			ie.NewGracefulReleasePeriod(period),
+		)
+	}()
+
+	select {
+	case <-deadline:
+		log.Warnln("Graceful release period expired before all CP nodes answered")
+		return
+	case <-sent:
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+
+	defer ticker.Stop()
+
+	for node.sessionCount() > 0 {
+		select {
+		case <-deadline:
+			log.Warnln("Graceful release period expired with", node.sessionCount(), "sessions left")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// releasePeers asks the CP nodes at the given addresses, removed from the config, to
+// release their association. Their sessions are kept until they do.
+func (node *PFCPNode) releasePeers(peers []string) {
+	ips := make(map[string]bool)
+
+	for _, peer := range peers {
+		addrs, err := net.LookupHost(peer)
+		if err != nil {
+			log.Warnln("Failed to resolve removed peer", peer, ":", err)
+			continue
+		}
+
+		for _, addr := range addrs {
+			ips[net.ParseIP(addr).String()] = true
+		}
+	}
+
+	log.Infoln("Requesting release of PFCP associations of removed peers", peers)
+
+	node.sendAssociationUpdate(func(pConn *PFCPConn) bool {
+		host, _, err := net.SplitHostPort(pConn.RemoteAddr().String())
+
+		return err == nil && ips[net.ParseIP(host).String()]
+	},
+		ie.NewPFCPAssociationReleaseRequest(1, 0),
+		ie.NewGracefulReleasePeriod(node.upf.gracefulReleasePeriod),
+	)
+}
+
+// sessionCount returns the number of sessions across all PFCP connections.
+func (node *PFCPNode) sessionCount() int {
+	count := 0
+
+	node.pConns.Range(func(key, value interface{}) bool {
+		count += len(value.(*PFCPConn).store.GetAllSessions())
+		return true
+	})
+
+	return count
+}
+
+// allSessions returns the sessions of all CP nodes.
+func (node *PFCPNode) allSessions() []PFCPSession {
+	var sessions []PFCPSession
+
+	node.pConns.Range(func(key, value interface{}) bool {
+		sessions = append(sessions, value.(*PFCPConn).store.GetAllSessions()...)
+		return true
+	})
+
+	return sessions
+}
+
 func (node *PFCPNode) Stop() {
 	node.cancel()
 
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+// Node Report Type flags (3GPP TS 29.244, clause 8.2.69).
+const (
+	nodeReportTypeUPFR = 0x01 // User Plane Path Failure Report
+	nodeReportTypeUPRR = 0x02 // User Plane Path Recovery Report
+)
+
+// Remote GTP-U Peer flags (3GPP TS 29.244, clause 8.2.70).
+const (
+	remoteGTPUPeerV6 = 0x01
+	remoteGTPUPeerV4 = 0x02
+	remoteGTPUPeerDI = 0x04
+)
+
+// gtpuPathEvent is raised by GTP-U path management whenever a remote GTP-U peer
+// (gNB/eNB on N3 or another UPF on N9) stops or resumes answering.
+type gtpuPathEvent struct {
+	peer      net.IP
+	dstIntf   uint8
+	recovered bool
+}
+
+func (e gtpuPathEvent) String() string {
+	state := "failure"
+	if e.recovered {
+		state = "recovery"
+	}
+
+	return "GTP-U path " + state + " to " + e.peer.String()
+}
+
+// remoteGTPUPeerIE builds the Remote GTP-U Peer IE identifying the peer of the event.
+func (e gtpuPathEvent) remoteGTPUPeerIE() *ie.IE {
+	if e.peer.To4() != nil {
+		return ie.NewRemoteGTPUPeer(remoteGTPUPeerV4|remoteGTPUPeerDI, e.peer.String(), "", e.dstIntf, "")
+	}
+
+	return ie.NewRemoteGTPUPeer(remoteGTPUPeerV6|remoteGTPUPeerDI, "", e.peer.String(), e.dstIntf, "")
+}
+
+// sendNodeReportRequest reports a GTP-U path event to the peer CP node and waits for the response.
+func (pConn *PFCPConn) sendNodeReportRequest(event gtpuPathEvent) error {
+	var (
+		reportType uint8
+		report     *ie.IE
+	)
+
+	if event.recovered {
+		reportType = nodeReportTypeUPRR
+		report = ie.NewUserPlanePathRecoveryReport(event.remoteGTPUPeerIE())
+	} else {
+		reportType = nodeReportTypeUPFR
+		report = ie.NewUserPlanePathFailureReport(event.remoteGTPUPeerIE())
+	}
+
+	nrreq := message.NewNodeReportRequest(pConn.getSeqNum(),
+		pConn.nodeID.localIE,
+		ie.NewNodeReportType(reportType),
+		report,
+	)
+
+	r := newRequest(nrreq)
+	reply, timeout := pConn.sendPFCPRequestMessage(r)
+
+	if timeout {
+		return errReqTimeout
+	}
+
+	if reply == nil {
+		return errConnShutdown
+	}
+
+	return pConn.handleNodeReportResponse(reply)
+}
+
+func (pConn *PFCPConn) handleNodeReportResponse(msg message.Message) error {
+	nrres, ok := msg.(*message.NodeReportResponse)
+	if !ok {
+		return errUnmarshal(errMsgUnexpectedType)
+	}
+
+	cause, err := nrres.Cause.Cause()
+	if err != nil {
+		return errUnmarshal(err)
+	}
+
+	if cause != ie.CauseRequestAccepted {
+		log.Errorln("Node Report Response from", pConn.RemoteAddr(),
+			"with Cause:", cause)
+		return errReqRejected
+	}
+
+	return nil
+}
+
+// reportGTPUPathEvent sends a Node Report Request about event to every associated CP node.
+func (node *PFCPNode) reportGTPUPathEvent(event gtpuPathEvent) {
+	log.Warnln("Reporting", event, "to associated CP nodes")
+
+	node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+		if pConn.nodeID.remote == "" {
+			return true
+		}
+
+		go func() {
+			if err := pConn.sendNodeReportRequest(event); err != nil {
+				log.Errorln("Node Report Request to", pConn.RemoteAddr(), "failed:", err)
+			}
+		}()
+
+		return true
+	})
+}
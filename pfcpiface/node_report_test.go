@@ -0,0 +1,34 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func Test_gtpuPathEvent_remoteGTPUPeerIE(t *testing.T) {
+	t.Run("IPv4 peer", func(t *testing.T) {
+		event := gtpuPathEvent{peer: net.ParseIP("198.18.0.1"), dstIntf: ie.DstInterfaceAccess}
+
+		fields, err := event.remoteGTPUPeerIE().RemoteGTPUPeer()
+		require.NoError(t, err)
+		require.True(t, fields.IPv4Address.Equal(event.peer))
+		require.Nil(t, fields.IPv6Address)
+		require.Equal(t, uint8(ie.DstInterfaceAccess), fields.DestinationInterface)
+	})
+
+	t.Run("IPv6 peer", func(t *testing.T) {
+		event := gtpuPathEvent{peer: net.ParseIP("2001:db8::1"), dstIntf: ie.DstInterfaceCore}
+
+		fields, err := event.remoteGTPUPeerIE().RemoteGTPUPeer()
+		require.NoError(t, err)
+		require.True(t, fields.IPv6Address.Equal(event.peer))
+		require.Nil(t, fields.IPv4Address)
+		require.Equal(t, uint8(ie.DstInterfaceCore), fields.DestinationInterface)
+	})
+}
@@ -0,0 +1,383 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const openAPIVersion = "3.0.3"
+
+// textMarshalerType is encoded as a string by encoding/json, e.g. time.Time.
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// apiOperation is an operation of the admin API. The schemas of its bodies are
+// generated from request and response, values of the types the handler decodes and
+// encodes, so that the spec follows the handlers.
+type apiOperation struct {
+	path     string
+	method   string
+	summary  string
+	request  interface{}
+	response interface{}
+	// code is the status of response, 200 if unset.
+	code int
+	// statuses are the other status codes of the operation, with their description.
+	statuses map[int]string
+}
+
+// succeeds reports whether one of the statuses of the operation is a success.
+func (op apiOperation) succeeds() bool {
+	for code := range op.statuses {
+		if code >= 200 && code < 300 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apiOperations are the operations of the admin API described by /v1/openapi.json.
+// Operations added to a handler are added here, TestOpenAPISpec checks that each one
+// is served.
+var apiOperations = []apiOperation{
+	{
+		path: "/v1/config", method: http.MethodGet,
+		summary:  "Return the config in use",
+		response: Conf{},
+	},
+	{
+		path: "/v1/config", method: http.MethodPut,
+		summary:  "Apply a config, in the format of the config file",
+		request:  Conf{},
+		response: confReloadResponse{},
+		statuses: map[int]string{
+			http.StatusBadRequest: "Invalid config",
+			http.StatusConflict:   "Config not applicable",
+		},
+	},
+	{
+		path: "/v1/config/network-slices", method: http.MethodPost,
+		summary:  "Configure a slice and its UE resources",
+		request:  NetworkSlice{},
+		statuses: map[int]string{http.StatusCreated: "Slice configured", http.StatusBadRequest: "Invalid slice"},
+	},
+	{
+		path: "/v1/config/network-slices", method: http.MethodPut,
+		summary:  "Configure a slice and its UE resources",
+		request:  NetworkSlice{},
+		statuses: map[int]string{http.StatusCreated: "Slice configured", http.StatusBadRequest: "Invalid slice"},
+	},
+	{
+		path: "/v1/config/slices", method: http.MethodGet,
+		summary:  "List the slices, rates in bps",
+		response: []NetworkSlice{},
+	},
+	{
+		path: "/v1/config/slices", method: http.MethodPost,
+		summary: "Create a slice",
+		request: NetworkSlice{},
+		statuses: map[int]string{
+			http.StatusCreated:    "Slice created",
+			http.StatusBadRequest: "Invalid slice",
+			http.StatusConflict:   "Slice already exists",
+		},
+	},
+	{
+		path: "/v1/config/slices/{name}", method: http.MethodPut,
+		summary: "Create or update a slice",
+		request: NetworkSlice{},
+		statuses: map[int]string{
+			http.StatusOK:         "Slice updated",
+			http.StatusCreated:    "Slice created",
+			http.StatusBadRequest: "Invalid slice",
+		},
+	},
+	{
+		path: "/v1/config/slices/{name}", method: http.MethodDelete,
+		summary:  "Remove a slice",
+		statuses: map[int]string{http.StatusNoContent: "Slice removed", http.StatusNotFound: "No such slice"},
+	},
+	{
+		path: "/v1/ippool", method: http.MethodGet,
+		summary:  "Report the UE IP pools and their allocations",
+		response: ipPoolsStatus{},
+		statuses: map[int]string{http.StatusNotFound: "UE IP allocation disabled"},
+	},
+	{
+		path: "/v1/ippool", method: http.MethodPost,
+		summary: "Reserve or release UE IPv4 addresses",
+		request: ipPoolRequest{},
+		statuses: map[int]string{
+			http.StatusNoContent:  "Addresses reserved or released",
+			http.StatusBadRequest: "Invalid request",
+			http.StatusNotFound:   "Address out of the pools",
+			http.StatusConflict:   "Address already reserved, allocated or free",
+		},
+	},
+	{
+		path: "/v1/drain", method: http.MethodGet,
+		summary:  "Report the draining state and the remaining sessions",
+		response: drainStatus{},
+	},
+	{
+		path: "/v1/drain", method: http.MethodPost,
+		summary:  "Reject new sessions",
+		response: drainStatus{},
+	},
+	{
+		path: "/v1/drain", method: http.MethodDelete,
+		summary:  "Accept new sessions again",
+		response: drainStatus{},
+	},
+	{
+		path: "/v1/sessions", method: http.MethodGet,
+		summary:  "List the sessions, optionally of one CP node with ?node=<node ID>",
+		response: []sessionSummary{},
+	},
+	{
+		path: "/v1/sessions/export", method: http.MethodGet,
+		summary:  "Dump the full state of the sessions, optionally of one CP node with ?node=<node ID>",
+		response: []sessionDump{},
+	},
+	{
+		path: "/v1/sessions/import", method: http.MethodPost,
+		summary:  "Replay exported sessions into the store and the datapath",
+		request:  []sessionDump{},
+		response: sessionImportResult{},
+		statuses: map[int]string{http.StatusBadRequest: "Invalid session dump"},
+	},
+	{
+		path: "/v1/associations", method: http.MethodGet,
+		summary:  "Report the association with each CP node",
+		response: []associationStatus{},
+	},
+	{
+		path: "/v1/framed-routes", method: http.MethodGet,
+		summary:  "List the Framed-Routes of the sessions",
+		response: []routedSubnet{},
+	},
+	{
+		path: "/v1/simulate", method: http.MethodGet,
+		summary:  "Report the simulation in progress",
+		response: simStatus{},
+	},
+	{
+		path: "/v1/simulate", method: http.MethodPost,
+		summary:  "Start creating or deleting simulated sessions",
+		request:  simRequest{},
+		response: simStatus{},
+		code:     http.StatusAccepted,
+		statuses: map[int]string{http.StatusConflict: "Simulation in progress"},
+	},
+	{
+		path: "/v1/self-test", method: http.MethodPost,
+		summary:  "Check that the datapath forwards a canary packet",
+		response: selfTestResult{},
+		statuses: map[int]string{
+			http.StatusConflict:           "Self-test in progress",
+			http.StatusServiceUnavailable: "Self-test failed",
+		},
+	},
+	{
+		path: "/v1/openapi.json", method: http.MethodGet,
+		summary: "Return this specification",
+	},
+}
+
+// openAPIHandler serves the OpenAPI specification of the admin API:
+//
+//	GET /v1/openapi.json
+type openAPIHandler struct {
+	once sync.Once
+	spec []byte
+}
+
+func (h *openAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.once.Do(func() {
+		var err error
+		if h.spec, err = json.Marshal(openAPISpec(apiOperations)); err != nil {
+			log.Errorln("Failed to encode OpenAPI spec:", err)
+		}
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, err := w.Write(h.spec); err != nil {
+		log.Errorln("Failed to write OpenAPI spec:", err)
+	}
+}
+
+// openAPISpec returns the OpenAPI document of ops, with a schema for each struct type
+// of their bodies under components.
+func openAPISpec(ops []apiOperation) map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]map[string]interface{})
+
+	for _, op := range ops {
+		responses := map[string]interface{}{}
+
+		for code, description := range op.statuses {
+			responses[strconv.Itoa(code)] = map[string]interface{}{"description": description}
+		}
+
+		code := op.code
+		if code == 0 {
+			code = http.StatusOK
+		}
+
+		switch {
+		case op.response != nil:
+			responses[strconv.Itoa(code)] = map[string]interface{}{
+				"description": http.StatusText(code),
+				"content":     jsonContent(schemaOf(reflect.TypeOf(op.response), schemas)),
+			}
+		case !op.succeeds():
+			responses[strconv.Itoa(code)] = map[string]interface{}{"description": http.StatusText(code)}
+		}
+
+		operation := map[string]interface{}{
+			"summary":   op.summary,
+			"responses": responses,
+		}
+
+		if op.request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(schemaOf(reflect.TypeOf(op.request), schemas)),
+			}
+		}
+
+		if strings.Contains(op.path, "{name}") {
+			operation["parameters"] = []interface{}{map[string]interface{}{
+				"name":     "name",
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			}}
+		}
+
+		if paths[op.path] == nil {
+			paths[op.path] = make(map[string]interface{})
+		}
+
+		paths[op.path][strings.ToLower(op.method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":   "UPF admin API",
+			"version": "v1",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// schemaOf returns the JSON schema of t as encoded by encoding/json. Named structs are
+// added to schemas and referenced.
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+
+		if _, ok := schemas[t.Name()]; !ok {
+			// Placeholder for recursive types.
+			schemas[t.Name()] = nil
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+
+		return ref
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema returns the object schema of the exported fields of t, with the
+// fields not omitted when empty as required.
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx:]
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		properties[name] = schemaOf(f.Type, schemas)
+
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+
+	return schema
+}
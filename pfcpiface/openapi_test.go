@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	u := &upf{}
+	p := &PFCPIface{upf: u, node: &PFCPNode{upf: u}}
+
+	mux := http.NewServeMux()
+	p.setupAdminHandlers(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var spec struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]interface{} `json:"properties"`
+				Required   []string               `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+
+	body := rec.Body.String()
+	require.NoError(t, json.Unmarshal([]byte(body), &spec))
+	require.Equal(t, openAPIVersion, spec.OpenAPI)
+
+	t.Run("operations are served", func(t *testing.T) {
+		for _, op := range apiOperations {
+			path := strings.ReplaceAll(op.path, "{name}", "slice")
+
+			_, pattern := mux.Handler(httptest.NewRequest(op.method, path, nil))
+			require.NotEmpty(t, pattern, "%s %s not served", op.method, op.path)
+
+			require.Contains(t, spec.Paths[op.path], strings.ToLower(op.method))
+		}
+	})
+
+	t.Run("schemas follow the handler types", func(t *testing.T) {
+		drain := spec.Components.Schemas["drainStatus"]
+		require.Len(t, drain.Properties, 2)
+		require.Contains(t, drain.Properties, "draining")
+		require.Contains(t, drain.Properties, "sessions")
+
+		pool := spec.Components.Schemas["ipPoolStatus"]
+		require.Contains(t, pool.Required, "subnet")
+		require.NotContains(t, pool.Required, "slice", "omitempty")
+
+		require.Contains(t, spec.Components.Schemas, "Conf")
+		require.Contains(t, spec.Components.Schemas, "NetworkSlice")
+		require.Contains(t, spec.Components.Schemas, "SliceQos")
+	})
+
+	t.Run("references resolve", func(t *testing.T) {
+		for _, ref := range strings.Split(body, `"$ref":"#/components/schemas/`)[1:] {
+			name := ref[:strings.Index(ref, `"`)]
+			require.Contains(t, spec.Components.Schemas, name)
+		}
+	})
+}
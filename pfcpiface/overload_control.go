@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+const (
+	overloadThresholdDefault      = 90
+	overloadClearThresholdDefault = 80
+	overloadReductionDefault      = 50
+	overloadPeriodDefault         = 30 * time.Second
+
+	// cpFeatureOVRL is the bit of the CP Function Features of CP nodes supporting the
+	// Overload Control Information IE.
+	cpFeatureOVRL = 0x02
+
+	// ociFlagAOCI associates the overload control information with the Node ID of the
+	// UPF rather than with the session.
+	ociFlagAOCI = 0x01
+)
+
+// overloadDetector enters overload when the load metric reaches the threshold, and
+// leaves it when the load metric falls below the clear threshold. While in overload,
+// the CP nodes are told to throttle a percentage of their requests to the UPF for a
+// validity period, renewed by each response carrying the Overload Control Information.
+type overloadDetector struct {
+	threshold      uint8
+	clearThreshold uint8
+	reduction      uint8
+	period         time.Duration
+
+	mu     sync.Mutex
+	active bool
+	// seq is incremented on each change of the overload state, zero if never overloaded.
+	seq uint32
+	// changed is when the overload state last changed.
+	changed time.Time
+}
+
+func newOverloadDetector(conf OverloadControlInfo) *overloadDetector {
+	return &overloadDetector{
+		threshold:      conf.Threshold,
+		clearThreshold: conf.ClearThreshold,
+		reduction:      conf.Reduction,
+		period:         validDuration(conf.Period),
+	}
+}
+
+// update enters or leaves overload given the load metric.
+func (d *overloadDetector) update(metric uint8, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch {
+	case !d.active && metric >= d.threshold:
+		log.Warnln("Overloaded with load", metric, ", asking CP nodes to throttle",
+			d.reduction, "% of their requests")
+	case d.active && metric < d.clearThreshold:
+		log.Infoln("No longer overloaded with load", metric)
+	default:
+		return
+	}
+
+	d.active = !d.active
+	d.seq++
+	d.changed = now
+}
+
+// status returns whether overloaded and the reduction of the requests asked for.
+func (d *overloadDetector) status() (bool, uint8) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.active {
+		return false, 0
+	}
+
+	return true, d.reduction
+}
+
+// overloadControlIE returns the Overload Control Information IE while overloaded,
+// and for a validity period after it left overload so that CP nodes stop throttling.
+// Nil otherwise.
+func (d *overloadDetector) overloadControlIE(now time.Time) *ie.IE {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.seq == 0 || (!d.active && now.Sub(d.changed) > d.period) {
+		return nil
+	}
+
+	var reduction uint8
+	if d.active {
+		reduction = d.reduction
+	}
+
+	return ie.NewOverloadControlInformation(
+		ie.NewSequenceNumber(d.seq),
+		ie.NewMetric(reduction),
+		ie.NewTimer(d.period),
+		ie.NewOCIFlags(ociFlagAOCI),
+	)
+}
+
+// addOverloadControl asks CP nodes supporting it to throttle their requests in the
+// session responses, while the UPF is overloaded.
+func (pConn *PFCPConn) addOverloadControl(reply message.Message) {
+	monitor := pConn.upf.loadMonitor
+	if monitor == nil || monitor.overload == nil || pConn.cpFeatures&cpFeatureOVRL == 0 {
+		return
+	}
+
+	oci := monitor.overload.overloadControlIE(time.Now())
+	if oci == nil {
+		return
+	}
+
+	switch res := reply.(type) {
+	case *message.SessionEstablishmentResponse:
+		res.OverloadControlInformation = oci
+	case *message.SessionModificationResponse:
+		res.OverloadControlInformation = oci
+	case *message.SessionDeletionResponse:
+		res.OverloadControlInformation = oci
+	}
+}
@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+func Test_overloadDetector(t *testing.T) {
+	d := newOverloadDetector(OverloadControlInfo{Threshold: 90, ClearThreshold: 80, Reduction: 30, Period: "10s"})
+	now := time.Now()
+
+	d.update(85, now)
+	require.Nil(t, d.overloadControlIE(now))
+
+	d.update(90, now)
+
+	overloaded, reduction := d.status()
+	require.True(t, overloaded)
+	require.Equal(t, uint8(30), reduction)
+
+	oci := d.overloadControlIE(now)
+	require.NotNil(t, oci)
+
+	metric, err := oci.Metric()
+	require.NoError(t, err)
+	require.Equal(t, uint8(30), metric)
+
+	seq, err := oci.SequenceNumber()
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), seq)
+
+	t.Run("overload is kept above the clear threshold", func(t *testing.T) {
+		d.update(80, now.Add(time.Minute))
+
+		overloaded, _ := d.status()
+		require.True(t, overloaded)
+		require.NotNil(t, d.overloadControlIE(now.Add(time.Minute)))
+	})
+
+	t.Run("throttling is stopped after leaving overload", func(t *testing.T) {
+		left := now.Add(2 * time.Minute)
+		d.update(79, left)
+
+		overloaded, reduction := d.status()
+		require.False(t, overloaded)
+		require.Zero(t, reduction)
+
+		oci := d.overloadControlIE(left.Add(5 * time.Second))
+		require.NotNil(t, oci)
+
+		metric, err := oci.Metric()
+		require.NoError(t, err)
+		require.Zero(t, metric)
+
+		seq, err := oci.SequenceNumber()
+		require.NoError(t, err)
+		require.Equal(t, uint32(2), seq)
+
+		require.Nil(t, d.overloadControlIE(left.Add(time.Minute)))
+	})
+}
+
+func TestPFCPConn_addOverloadControl(t *testing.T) {
+	monitor := newLoadMonitor(Conf{
+		LoadControl:     LoadControlInfo{Interval: "1s"},
+		OverloadControl: OverloadControlInfo{Enable: true, Threshold: 50, ClearThreshold: 40, Reduction: 20, Period: "30s"},
+	})
+	monitor.cpuStat = func() (uint64, uint64, bool) { return 0, 0, false }
+	monitor.update(0, 60)
+
+	pConn := &PFCPConn{upf: &upf{loadMonitor: monitor}}
+	pConn.cpFeatures = cpFunctionFeatures(ie.NewCPFunctionFeatures(cpFeatureOVRL))
+
+	smres := message.NewSessionModificationResponse(0, 0, 1, 1, 0, ie.NewCause(ie.CauseRequestAccepted))
+	pConn.addLoadControl(smres)
+	pConn.addOverloadControl(smres)
+
+	require.Nil(t, smres.LoadControlInformation, "load control disabled")
+	require.NotNil(t, smres.OverloadControlInformation)
+
+	metric, err := smres.OverloadControlInformation.Metric()
+	require.NoError(t, err)
+	require.Equal(t, uint8(20), metric)
+}
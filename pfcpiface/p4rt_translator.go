@@ -42,9 +42,13 @@ const (
 	FieldSliceID           = "slice_id"
 	FieldSessionMeterIndex = "session_meter_idx"
 	FieldAppMeterIndex     = "app_meter_idx"
+	FieldIPv4Src           = "ipv4_src"
+	FieldIPv4Dst           = "ipv4_dst"
 
 	DefaultPriority      = 0
 	DefaultApplicationID = 0
+	// MirrorACLPriority is that of the ACL entries cloning the traffic of UEs.
+	MirrorACLPriority = 10
 )
 
 type tunnelParams struct {
@@ -388,7 +392,6 @@ func (t *P4rtTranslator) withActionParam(action *p4.Action, name string, value i
 	return nil
 }
 
-//nolint:unused
 func (t *P4rtTranslator) getActionParamValue(tableEntry *p4.TableEntry, id uint32) ([]byte, error) {
 	for _, param := range tableEntry.Action.GetAction().Params {
 		if param.ParamId == id {
@@ -399,6 +402,31 @@ func (t *P4rtTranslator) getActionParamValue(tableEntry *p4.TableEntry, id uint3
 	return nil, ErrNotFoundWithParam("action param", "id", id)
 }
 
+// getCounterIndex returns the counter index set by the action of a terminations entry.
+func (t *P4rtTranslator) getCounterIndex(tableEntry *p4.TableEntry) (uint32, error) {
+	p4Action, err := t.getActionByID(tableEntry.GetAction().GetAction().GetActionId())
+	if err != nil {
+		return 0, err
+	}
+
+	p4ActionParam := t.getActionParamByName(p4Action, FieldCounterIndex)
+	if p4ActionParam == nil {
+		return 0, ErrOperationFailedWithParam("find action param", "action param name", FieldCounterIndex)
+	}
+
+	value, err := t.getActionParamValue(tableEntry, p4ActionParam.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	var index uint32
+	for _, b := range value {
+		index = index<<8 | uint32(b)
+	}
+
+	return index, nil
+}
+
 //nolint:unused
 func (t *P4rtTranslator) getLPMMatchFieldValue(tableEntry *p4.TableEntry, name string) (*net.IPNet, error) {
 	tableID := tableEntry.TableId
@@ -819,6 +847,37 @@ func (t *P4rtTranslator) BuildGTPTunnelPeerTableEntry(tunnelPeerID uint8, tunnel
 	return entry, nil
 }
 
+// BuildMirrorACLTableEntry builds the ACL entry cloning the traffic of the UE of pdr,
+// in the direction of pdr, to the CPU clone session.
+func (t *P4rtTranslator) BuildMirrorACLTableEntry(pdr pdr) (*p4.TableEntry, error) {
+	entry := &p4.TableEntry{
+		TableId:  p4constants.TablePreQosPipeAclAcls,
+		Priority: MirrorACLPriority,
+		Action: &p4.TableAction{
+			Type: &p4.TableAction_Action{
+				Action: &p4.Action{
+					ActionId: p4constants.ActionPreQosPipeAclCloneToCpu,
+				},
+			},
+		},
+	}
+
+	if err := t.withTernaryMatchField(entry, FieldSrcIface, pdr.srcIface, uint8(0xff)); err != nil {
+		return nil, err
+	}
+
+	ueField := FieldIPv4Dst
+	if pdr.IsUplink() {
+		ueField = FieldIPv4Src
+	}
+
+	if err := t.withTernaryMatchField(entry, ueField, pdr.ueAddress, uint32(0xffffffff)); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
 func (t *P4rtTranslator) BuildMeterEntry(meterID uint32, cellID uint32, config *p4.MeterConfig) *p4.MeterEntry {
 	meterName := p4constants.GetMeterIDToNameMap()[meterID]
 
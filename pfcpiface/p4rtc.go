@@ -5,6 +5,8 @@ package pfcpiface
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"os"
 	"time"
@@ -14,6 +16,7 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 
 	//nolint:staticcheck // Ignore SA1019.
@@ -46,6 +49,7 @@ type P4rtClient struct {
 	conn       *grpc.ClientConn
 	stream     p4.P4Runtime_StreamChannelClient
 	electionID p4.Uint128
+	roleID     uint64
 	deviceID   uint64
 	digests    chan *p4.DigestList
 
@@ -132,6 +136,10 @@ func (c *P4rtClient) SetMastership(electionID p4.Uint128) (err error) {
 			},
 		},
 	}
+
+	if c.roleID != 0 {
+		mastershipReq.GetArbitration().Role = &p4.Role{Id: c.roleID}
+	}
 	err = c.stream.Send(mastershipReq)
 
 	return
@@ -360,7 +368,7 @@ func (c *P4rtClient) InsertTableEntry(entry *p4.TableEntry, funcType uint8) erro
 	return c.WriteReq(update)
 }
 
-func (c *P4rtClient) ApplyTableEntries(methodType p4.Update_Type, entries ...*p4.TableEntry) error {
+func tableEntryUpdates(methodType p4.Update_Type, entries ...*p4.TableEntry) []*p4.Update {
 	var updates []*p4.Update
 
 	for _, entry := range entries {
@@ -375,10 +383,10 @@ func (c *P4rtClient) ApplyTableEntries(methodType p4.Update_Type, entries ...*p4
 		updates = append(updates, update)
 	}
 
-	return c.WriteBatchReq(updates)
+	return updates
 }
 
-func (c *P4rtClient) ApplyMeterEntries(methodType p4.Update_Type, entries ...*p4.MeterEntry) error {
+func meterEntryUpdates(methodType p4.Update_Type, entries ...*p4.MeterEntry) []*p4.Update {
 	var updates []*p4.Update
 
 	for _, entry := range entries {
@@ -392,13 +400,22 @@ func (c *P4rtClient) ApplyMeterEntries(methodType p4.Update_Type, entries ...*p4
 		updates = append(updates, update)
 	}
 
-	return c.WriteBatchReq(updates)
+	return updates
+}
+
+func (c *P4rtClient) ApplyTableEntries(methodType p4.Update_Type, entries ...*p4.TableEntry) error {
+	return c.WriteBatchReq(tableEntryUpdates(methodType, entries...))
+}
+
+func (c *P4rtClient) ApplyMeterEntries(methodType p4.Update_Type, entries ...*p4.MeterEntry) error {
+	return c.WriteBatchReq(meterEntryUpdates(methodType, entries...))
 }
 
 // WriteReq ... Write Request.
 func (c *P4rtClient) WriteReq(update *p4.Update) error {
 	req := &p4.WriteRequest{
 		DeviceId:   c.deviceID,
+		RoleId:     c.roleID,
 		ElectionId: &c.electionID,
 		Updates:    []*p4.Update{update},
 	}
@@ -412,6 +429,7 @@ func (c *P4rtClient) WriteReq(update *p4.Update) error {
 func (c *P4rtClient) WriteBatchReq(updates []*p4.Update) error {
 	req := &p4.WriteRequest{
 		DeviceId:   c.deviceID,
+		RoleId:     c.roleID,
 		ElectionId: &c.electionID,
 	}
 
@@ -424,6 +442,11 @@ func (c *P4rtClient) WriteBatchReq(updates []*p4.Update) error {
 	return convertError(err)
 }
 
+// write implements p4Writer by writing the updates right away.
+func (c *P4rtClient) write(updates []*p4.Update) error {
+	return c.WriteBatchReq(updates)
+}
+
 // GetForwardingPipelineConfig ... Get Pipeline config from switch.
 func (c *P4rtClient) GetForwardingPipelineConfig() (err error) {
 	getLog := log.WithFields(log.Fields{
@@ -526,11 +549,11 @@ func SetPipelineConfig(client p4.P4RuntimeClient, deviceID uint64, electionID *p
 }
 
 // GetConnection ... Get Grpc connection.
-func GetConnection(host string) (conn *grpc.ClientConn, err error) {
+func GetConnection(host string, creds credentials.TransportCredentials) (conn *grpc.ClientConn, err error) {
 	/* get connection */
 	log.Println("Get connection.")
 
-	conn, err = grpc.Dial(host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err = grpc.Dial(host, grpc.WithTransportCredentials(creds))
 	if err != nil {
 		log.Println("grpc dial err: ", err)
 		return nil, err
@@ -564,11 +587,53 @@ func LoadDeviceConfig(deviceConfigPath string) (P4DeviceConfig, error) {
 	return bin, nil
 }
 
+// p4rtcCredentials returns the transport credentials of the P4Runtime channel,
+// insecure unless TLS is enabled.
+func p4rtcCredentials(conf P4rtcTLSInfo) (credentials.TransportCredentials, error) {
+	if !conf.Enabled {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConf := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: conf.ServerName,
+	}
+
+	if conf.CACert != "" {
+		pem, err := os.ReadFile(conf.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", conf.CACert, err)
+		}
+
+		tlsConf.RootCAs = x509.NewCertPool()
+		if !tlsConf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, ErrInvalidArgumentWithReason("tls.ca_cert", conf.CACert, "no PEM certificate found")
+		}
+	}
+
+	if conf.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(conf.ClientCert, conf.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate %s: %w", conf.ClientCert, err)
+		}
+
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(tlsConf), nil
+}
+
 // CreateChannel ... Create p4runtime client channel.
-func CreateChannel(host string, deviceID uint64) (*P4rtClient, error) {
+func CreateChannel(host string, deviceID uint64, conf P4rtcInfo) (*P4rtClient, error) {
 	log.Println("create channel")
 
-	conn, err := GetConnection(host)
+	creds, err := p4rtcCredentials(conf.TLS)
+	if err != nil {
+		log.Println("P4Runtime credentials failed")
+		return nil, err
+	}
+
+	conn, err := GetConnection(host, creds)
 	if err != nil {
 		log.Println("grpc connection failed")
 		return nil, err
@@ -579,6 +644,7 @@ func CreateChannel(host string, deviceID uint64) (*P4rtClient, error) {
 		client:   p4.NewP4RuntimeClient(conn),
 		conn:     conn,
 		deviceID: deviceID,
+		roleID:   conf.RoleID,
 	}
 
 	err = client.Init()
@@ -596,7 +662,12 @@ func CreateChannel(host string, deviceID uint64) (*P4rtClient, error) {
 		}
 	}
 
-	err = client.SetMastership(TimeBasedElectionId())
+	electionID := TimeBasedElectionId()
+	if conf.ElectionID != 0 {
+		electionID = p4.Uint128{Low: conf.ElectionID}
+	}
+
+	err = client.SetMastership(electionID)
 	if err != nil {
 		log.Error("Set Mastership error: ", err)
 		closeStreamOnError()
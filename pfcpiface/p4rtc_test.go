@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mustWriteTestCertificate writes a self-signed certificate and its key to dir.
+func mustWriteTestCertificate(t *testing.T, dir string) (certPath, keyPath string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "up4"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath, keyPath = dir+"/cert.pem", dir+"/key.pem"
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certPath, keyPath
+}
+
+func Test_p4rtcCredentials(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := mustWriteTestCertificate(t, dir)
+
+	t.Run("insecure unless enabled", func(t *testing.T) {
+		creds, err := p4rtcCredentials(P4rtcTLSInfo{CACert: certPath})
+		require.NoError(t, err)
+		require.Equal(t, "insecure", creds.Info().SecurityProtocol)
+	})
+
+	t.Run("TLS with client certificate", func(t *testing.T) {
+		creds, err := p4rtcCredentials(P4rtcTLSInfo{
+			Enabled:    true,
+			CACert:     certPath,
+			ClientCert: certPath,
+			ClientKey:  keyPath,
+			ServerName: "up4",
+		})
+		require.NoError(t, err)
+		require.Equal(t, "tls", creds.Info().SecurityProtocol)
+	})
+
+	t.Run("invalid files are rejected", func(t *testing.T) {
+		_, err := p4rtcCredentials(P4rtcTLSInfo{Enabled: true, CACert: keyPath})
+		require.Error(t, err)
+
+		_, err = p4rtcCredentials(P4rtcTLSInfo{Enabled: true, ClientCert: certPath, ClientKey: dir + "/missing.pem"})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+type bar struct {
+	barID             uint8
+	notifyDelay       time.Duration
+	suggestedPktCount uint8
+	fseID             uint64
+}
+
+func (b bar) String() string {
+	return fmt.Sprintf("BAR(id=%v, F-SEID=%v, notificationDelay=%v, suggestedBufferingPackets=%v)",
+		b.barID, b.fseID, b.notifyDelay, b.suggestedPktCount)
+}
+
+func (b *bar) parseBAR(ie1 *ie.IE, seid uint64) error {
+	barID, err := ie1.BARID()
+	if err != nil {
+		log.Println("Could not read BAR ID!")
+		return err
+	}
+
+	delay, err := ie1.DownlinkDataNotificationDelay()
+	if err != nil && !errors.Is(err, ie.ErrIENotFound) {
+		log.Println("Could not read Downlink Data Notification Delay!")
+	}
+
+	count, err := ie1.SuggestedBufferingPacketsCount()
+	if err != nil && !errors.Is(err, ie.ErrIENotFound) {
+		log.Println("Could not read Suggested Buffering Packets Count!")
+	}
+
+	b.barID = barID
+	b.notifyDelay = delay
+	b.suggestedPktCount = count
+	b.fseID = seid
+
+	return nil
+}
@@ -23,6 +23,8 @@ const (
 	ActionDrop    = 0x1
 	ActionBuffer  = 0x4
 	ActionNotify  = 0x8
+	// ActionDuplicate mirrors the traffic after the Duplicating Parameters.
+	ActionDuplicate = 0x10
 )
 
 const (
@@ -35,6 +37,7 @@ type far struct {
 	fseID   uint64
 	fseidIP uint32
 
+	barID         uint8
 	dstIntf       uint8
 	sendEndMarker bool
 	applyAction   uint8
@@ -43,14 +46,20 @@ type far struct {
 	tunnelIP4Dst  uint32
 	tunnelTEID    uint32
 	tunnelPort    uint16
+	// dup is the tunnel of the copies of the traffic, if the FAR duplicates it.
+	dup farDuplication
+	// redirect is the tunnel to the redirect server, if the FAR redirects the traffic.
+	redirect farRedirect
+	// enrichment is the tunnel to the enrichment proxy, if the FAR enriches the traffic.
+	enrichment farEnrichment
 }
 
 func (f far) String() string {
 	return fmt.Sprintf("FAR(id=%v, F-SEID=%v, F-SEID IPv4=%v, dstInterface=%v, tunnelType=%v, "+
 		"tunnelIPv4Src=%v, tunnelIPv4Dst=%v, tunnelTEID=%v, tunnelSrcPort=%v, "+
-		"sendEndMarker=%v, drops=%v, forwards=%v, buffers=%v)", f.farID, f.fseID, int2ip(f.fseidIP), f.dstIntf,
-		f.tunnelType, int2ip(f.tunnelIP4Src), int2ip(f.tunnelIP4Dst), f.tunnelTEID, f.tunnelPort, f.sendEndMarker,
-		f.Drops(), f.Forwards(), f.Buffers())
+		"sendEndMarker=%v, drops=%v, forwards=%v, buffers=%v, duplicates=%v, redirect=%q, barID=%v)", f.farID, f.fseID,
+		int2ip(f.fseidIP), f.dstIntf, f.tunnelType, int2ip(f.tunnelIP4Src), int2ip(f.tunnelIP4Dst), f.tunnelTEID, f.tunnelPort,
+		f.sendEndMarker, f.Drops(), f.Forwards(), f.Buffers(), f.Duplicates(), f.redirect.address, f.barID)
 }
 
 func (f *far) Drops() bool {
@@ -65,6 +74,10 @@ func (f *far) Forwards() bool {
 	return f.applyAction&ActionForward != 0
 }
 
+func (f *far) Duplicates() bool {
+	return f.applyAction&ActionDuplicate != 0
+}
+
 func (f *far) parseFAR(farIE *ie.IE, fseid uint64, upf *upf, op operation) error {
 	f.fseID = (fseid)
 
@@ -86,6 +99,14 @@ func (f *far) parseFAR(farIE *ie.IE, fseid uint64, upf *upf, op operation) error
 
 	f.applyAction = action
 
+	if barID, errBAR := farIE.BARID(); errBAR == nil {
+		f.barID = barID
+	}
+
+	if err := f.parseDuplicatingParameters(farIE, upf, op); err != nil {
+		return err
+	}
+
 	var fwdIEs []*ie.IE
 
 	switch op {
@@ -104,8 +125,13 @@ func (f *far) parseFAR(farIE *ie.IE, fseid uint64, upf *upf, op operation) error
 	}
 
 	f.sendEndMarker = false
+	f.redirect = farRedirect{}
+	f.enrichment = farEnrichment{}
 
-	var fields Bits
+	var (
+		fields          Bits
+		networkInstance string
+	)
 
 	for _, fwdIE := range fwdIEs {
 		switch fwdIE.Type {
@@ -118,6 +144,11 @@ func (f *far) parseFAR(farIE *ie.IE, fseid uint64, upf *upf, op operation) error
 				continue
 			}
 
+			// Only GTP-U tunnels are encapsulated, toward a gNB on N3 or another UPF on N9.
+			if !fwdIE.HasTEID() {
+				return ErrUnsupported("Outer Header Creation Description", ohcFields.OuterHeaderCreationDescription)
+			}
+
 			f.tunnelTEID = ohcFields.TEID
 			f.tunnelIP4Dst = ip2int(ohcFields.IPv4Address)
 			f.tunnelType = uint8(1) // FIXME: what does it mean?
@@ -130,12 +161,8 @@ func (f *far) parseFAR(farIE *ie.IE, fseid uint64, upf *upf, op operation) error
 				log.Println("Unable to parse DestinationInterface field")
 				continue
 			}
-
-			if f.dstIntf == ie.DstInterfaceAccess {
-				f.tunnelIP4Src = ip2int(upf.AccessIP)
-			} else if f.dstIntf == ie.DstInterfaceCore {
-				f.tunnelIP4Src = ip2int(upf.CoreIP)
-			}
+		case ie.NetworkInstance:
+			networkInstance = networkInstanceName(fwdIE)
 		case ie.PFCPSMReqFlags:
 			fields = Set(fields, FwdIEPfcpSMReqFlags)
 
@@ -148,7 +175,51 @@ func (f *far) parseFAR(farIE *ie.IE, fseid uint64, upf *upf, op operation) error
 			if has2ndBit(smReqFlags) {
 				f.sendEndMarker = true
 			}
+		case ie.RedirectInformation:
+			if err := f.parseRedirectInformation(fwdIE, upf); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := f.parseHeaderEnrichment(fwdIEs, upf); err != nil {
+		return err
+	}
+
+	if err := f.checkLocalSwitching(upf); err != nil {
+		return err
+	}
+
+	// Only the uplink traffic is redirected or enriched, by the redirect server or the
+	// enrichment proxy.
+	if f.Redirects() && f.Enriches() {
+		return ErrInvalidArgumentWithReason("Header Enrichment", f.farID, "FAR has Redirect Information")
+	}
+
+	if (f.Redirects() || f.Enriches()) && f.dstIntf == ie.DstInterfaceAccess {
+		return ErrInvalidArgumentWithReason("Forwarding Parameters", f.farID,
+			"redirection or header enrichment of a FAR forwarding to the access interface")
+	}
+
+	// Tunnels are sourced from the interface they leave by, whatever the order of the IEs.
+	if fields&FwdIEDestinationIntf == 0 {
+		return nil
+	}
+
+	// The interface of the Network Instance, if mapped, is that of the route taken.
+	if ip, ok, err := upf.nis.tunnelSource(networkInstance, f.dstIntf, upf); ok {
+		if err != nil {
+			return err
 		}
+
+		f.tunnelIP4Src = ip2int(ip)
+	} else if ip, ok := upf.nis.peerSource(f.dstIntf, f.tunnelIP4Dst, upf); ok {
+		// Otherwise that of the subnet of the tunnel peer, e.g. a gNB of another site.
+		f.tunnelIP4Src = ip2int(ip)
+	} else if f.dstIntf == ie.DstInterfaceAccess {
+		f.tunnelIP4Src = ip2int(upf.AccessIP)
+	} else if f.dstIntf == ie.DstInterfaceCore || f.dstIntf == ie.DstInterfaceSGiLANN6LAN {
+		f.tunnelIP4Src = ip2int(upf.CoreIP)
 	}
 
 	return nil
@@ -71,6 +71,29 @@ func TestParseFAR(t *testing.T) {
 			},
 			description: "Valid Downlink FAR input with update operation",
 		},
+		{
+			op: createOp,
+			input: ie.NewCreateFAR(
+				ie.NewFARID(2),
+				ie.NewApplyAction(ActionForward),
+				ie.NewForwardingParameters(
+					ie.NewOuterHeaderCreation(0x100, 200, "10.0.20.1", "", 0, 0, 0),
+					ie.NewDestinationInterface(ie.DstInterfaceCore),
+				),
+			),
+			expected: &far{
+				farID:        2,
+				fseID:        FSEID,
+				applyAction:  ActionForward,
+				dstIntf:      ie.DstInterfaceCore,
+				tunnelTEID:   200,
+				tunnelType:   1,
+				tunnelIP4Src: ip2int(CoreIP),
+				tunnelIP4Dst: ip2int(net.ParseIP("10.0.20.1")),
+				tunnelPort:   uint16(defaultGTPProtocolPort),
+			},
+			description: "Uplink FAR steering to another UPF on N9",
+		},
 	} {
 		t.Run(scenario.description, func(t *testing.T) {
 			mockFar := &far{}
@@ -138,6 +161,24 @@ func TestParseFARShouldError(t *testing.T) {
 			},
 			description: "Malformed Downlink FAR with missing FARID",
 		},
+		{
+			op: createOp,
+			input: ie.NewCreateFAR(
+				ie.NewFARID(1),
+				ie.NewApplyAction(ActionForward),
+				ie.NewForwardingParameters(
+					ie.NewDestinationInterface(ie.DstInterfaceCore),
+					ie.NewOuterHeaderCreation(0x400, 0, "10.0.20.1", "", 2152, 0, 0),
+				),
+			),
+			expected: &far{
+				farID:       1,
+				fseID:       FSEID,
+				applyAction: ActionForward,
+				dstIntf:     ie.DstInterfaceCore,
+			},
+			description: "Uplink FAR with a UDP/IPv4 outer header",
+		},
 	} {
 		t.Run(scenario.description, func(t *testing.T) {
 			mockFar := &far{}
@@ -153,3 +194,185 @@ func TestParseFARShouldError(t *testing.T) {
 		})
 	}
 }
+
+func TestParseFAR_networkInstances(t *testing.T) {
+	mockUpf := &upf{
+		AccessIP: net.ParseIP("192.168.0.1"),
+		CoreIP:   net.ParseIP("10.0.10.1"),
+		nis: newNITable([]NetworkInstanceInfo{
+			{NetworkInstance: "n9", Interface: niInterfaceCore, IP: "10.0.30.1"},
+			{NetworkInstance: "internet", Interface: niInterfaceCore},
+			{NetworkInstance: "access", Interface: niInterfaceAccess},
+		}),
+	}
+
+	farWith := func(dstIntf uint8, networkInstance string) *ie.IE {
+		return ie.NewCreateFAR(ie.NewFARID(1), ie.NewApplyAction(ActionForward),
+			ie.NewForwardingParameters(
+				ie.NewDestinationInterface(dstIntf),
+				ie.NewNetworkInstanceFQDN(networkInstance),
+				ie.NewOuterHeaderCreation(0x100, 200, "10.0.20.1", "", 0, 0, 0),
+			))
+	}
+
+	for _, tt := range []struct {
+		dstIntf         uint8
+		networkInstance string
+		tunnelIP4Src    string
+	}{
+		{ie.DstInterfaceCore, "n9", "10.0.30.1"},
+		{ie.DstInterfaceCore, "internet", "10.0.10.1"},
+		{ie.DstInterfaceAccess, "access", "192.168.0.1"},
+		{ie.DstInterfaceCore, "unmapped", "10.0.10.1"},
+	} {
+		var f far
+		require.NoError(t, f.parseFAR(farWith(tt.dstIntf, tt.networkInstance), 1, mockUpf, create))
+		require.Equal(t, tt.tunnelIP4Src, int2ip(f.tunnelIP4Src).String(), tt.networkInstance)
+	}
+
+	var f far
+	err := f.parseFAR(farWith(ie.DstInterfaceAccess, "n9"), 1, mockUpf, create)
+	require.ErrorIs(t, err, errNetworkInstanceMismatch)
+	require.Equal(t, ie.CauseRuleCreationModificationFailure, ruleErrorCause(err))
+}
+
+func TestParseFAR_peerSubnets(t *testing.T) {
+	mockUpf := &upf{
+		AccessIP: net.ParseIP("192.168.0.1"),
+		CoreIP:   net.ParseIP("10.0.10.1"),
+		nis: newNITable([]NetworkInstanceInfo{
+			{NetworkInstance: "n3-site2", Interface: niInterfaceAccess, IP: "192.168.1.1", PeerSubnets: []string{"10.0.40.0/24"}},
+			{NetworkInstance: "n9", Interface: niInterfaceCore, IP: "10.0.30.1", PeerSubnets: []string{"10.0.50.0/24"}},
+		}),
+	}
+
+	farTo := func(dstIntf uint8, networkInstance, peer string) *ie.IE {
+		return ie.NewCreateFAR(ie.NewFARID(1), ie.NewApplyAction(ActionForward),
+			ie.NewForwardingParameters(
+				ie.NewDestinationInterface(dstIntf),
+				ie.NewNetworkInstanceFQDN(networkInstance),
+				ie.NewOuterHeaderCreation(0x100, 200, peer, "", 0, 0, 0),
+			))
+	}
+
+	for _, tt := range []struct {
+		dstIntf         uint8
+		networkInstance string
+		peer            string
+		tunnelIP4Src    string
+	}{
+		{ie.DstInterfaceAccess, "internet", "10.0.40.7", "192.168.1.1"},
+		{ie.DstInterfaceAccess, "internet", "10.0.41.7", "192.168.0.1"},
+		{ie.DstInterfaceCore, "internet", "10.0.50.7", "10.0.30.1"},
+		// The subnets of the other side are not looked up.
+		{ie.DstInterfaceCore, "internet", "10.0.40.7", "10.0.10.1"},
+		// A mapped Network Instance takes precedence.
+		{ie.DstInterfaceCore, "n9", "10.0.40.7", "10.0.30.1"},
+	} {
+		var f far
+		require.NoError(t, f.parseFAR(farTo(tt.dstIntf, tt.networkInstance, tt.peer), 1, mockUpf, create))
+		require.Equal(t, tt.tunnelIP4Src, int2ip(f.tunnelIP4Src).String(), tt.peer)
+	}
+}
+
+func TestParseFAR_duplicatingParameters(t *testing.T) {
+	const dupl = ActionForward | ActionDuplicate
+
+	mockUpf := &upf{
+		AccessIP: net.ParseIP("192.168.0.1"),
+		CoreIP:   net.ParseIP("10.0.10.1"),
+	}
+
+	duplicatingFAR := func(dupIEs ...*ie.IE) *ie.IE {
+		return ie.NewCreateFAR(ie.NewFARID(1), ie.NewApplyAction(dupl),
+			ie.NewForwardingParameters(ie.NewDestinationInterface(ie.DstInterfaceCore)),
+			ie.NewDuplicatingParameters(dupIEs...))
+	}
+	liTunnel := ie.NewOuterHeaderCreation(0x100, 0x55, "198.18.0.99", "", 0, 0, 0)
+
+	var f far
+	err := f.parseFAR(duplicatingFAR(ie.NewDestinationInterface(ie.DstInterfaceLIFunction), liTunnel), 1, mockUpf, create)
+	require.ErrorIs(t, err, errDuplicationDisabled)
+	require.Equal(t, ie.CauseRuleCreationModificationFailure, ruleErrorCause(err))
+
+	mockUpf.duplication = newDuplicator(FARDuplicationInfo{Mode: duplicationModeGTPU, Endpoint: "198.18.0.10"})
+
+	f = far{}
+	require.NoError(t, f.parseFAR(duplicatingFAR(ie.NewDestinationInterface(ie.DstInterfaceLIFunction), liTunnel), 1, mockUpf, create))
+	require.True(t, f.Duplicates())
+	require.Equal(t, farDuplication{
+		tunnelIP4Src: ip2int(net.ParseIP("10.0.10.1")),
+		tunnelIP4Dst: ip2int(net.ParseIP("198.18.0.10")),
+		tunnelTEID:   0x55,
+	}, f.dup, "copies are tunneled to the configured endpoint")
+
+	f = far{}
+	require.Error(t, f.parseFAR(duplicatingFAR(ie.NewDestinationInterface(ie.DstInterfaceLIFunction)), 1, mockUpf, create),
+		"copies need a TEID in gtpu mode")
+
+	session := PFCPSession{}
+	session.CreateFAR(far{farID: 1, applyAction: dupl, dup: farDuplication{tunnelTEID: 0x55}})
+
+	var u far
+	require.NoError(t, u.parseFAR(ie.NewUpdateFAR(ie.NewFARID(1), ie.NewApplyAction(dupl),
+		ie.NewUpdateForwardingParameters(ie.NewDestinationInterface(ie.DstInterfaceCore))), 1, mockUpf, update))
+	require.NoError(t, session.UpdateFAR(&u, &[][]byte{}))
+	require.Equal(t, uint32(0x55), session.fars[0].dup.tunnelTEID, "copies keep their tunnel unless updated")
+
+	mockUpf.duplication = newDuplicator(FARDuplicationInfo{Mode: duplicationModeRaw, IfName: "mirror"})
+
+	f = far{}
+	require.NoError(t, f.parseFAR(duplicatingFAR(ie.NewDestinationInterface(ie.DstInterfaceLIFunction)), 1, mockUpf, create))
+	require.True(t, f.Duplicates())
+	require.Zero(t, f.dup)
+}
+
+func TestParseFAR_redirectInformation(t *testing.T) {
+	mockUpf := &upf{
+		AccessIP: net.ParseIP("192.168.0.1"),
+		CoreIP:   net.ParseIP("10.0.10.1"),
+	}
+
+	redirectingFAR := func(dstIntf uint8, redirect *ie.IE) *ie.IE {
+		return ie.NewCreateFAR(ie.NewFARID(1), ie.NewApplyAction(ActionForward),
+			ie.NewForwardingParameters(ie.NewDestinationInterface(dstIntf), redirect))
+	}
+	toPortal := ie.NewRedirectInformation(ie.RedirectAddrIPv4, "198.18.0.40")
+	toURL := ie.NewRedirectInformation(ie.RedirectAddrURL, "http://portal.example.com/topup")
+
+	var f far
+	err := f.parseFAR(redirectingFAR(ie.DstInterfaceCore, toPortal), 1, mockUpf, create)
+	require.ErrorIs(t, err, errRedirectDisabled)
+	require.Equal(t, ie.CauseRuleCreationModificationFailure, ruleErrorCause(err))
+
+	mockUpf.redirection = newRedirector(FARRedirectInfo{})
+
+	f = far{}
+	require.NoError(t, f.parseFAR(redirectingFAR(ie.DstInterfaceCore, toPortal), 1, mockUpf, create))
+	require.True(t, f.Redirects())
+	require.Equal(t, farRedirect{
+		addrType:     ie.RedirectAddrIPv4,
+		address:      "198.18.0.40",
+		tunnelIP4Src: ip2int(net.ParseIP("10.0.10.1")),
+		tunnelIP4Dst: ip2int(net.ParseIP("198.18.0.40")),
+	}, f.redirect, "traffic is tunneled to the redirect address")
+
+	f = far{}
+	err = f.parseFAR(redirectingFAR(ie.DstInterfaceCore, toURL), 1, mockUpf, create)
+	require.ErrorIs(t, err, errRedirectDisabled, "URLs need a redirect gateway")
+
+	f = far{}
+	require.Error(t, f.parseFAR(redirectingFAR(ie.DstInterfaceAccess, toPortal), 1, mockUpf, create),
+		"downlink traffic is not redirected")
+
+	mockUpf.redirection = newRedirector(FARRedirectInfo{Gateway: "198.18.0.41"})
+
+	f = far{}
+	require.NoError(t, f.parseFAR(redirectingFAR(ie.DstInterfaceCore, toURL), 1, mockUpf, create))
+	require.Equal(t, ip2int(net.ParseIP("198.18.0.41")), f.redirect.tunnelIP4Dst, "URLs are tunneled to the gateway")
+	require.Equal(t, "http://portal.example.com/topup", f.redirect.address)
+
+	require.NoError(t, f.parseFAR(ie.NewUpdateFAR(ie.NewFARID(1), ie.NewApplyAction(ActionForward),
+		ie.NewUpdateForwardingParameters(ie.NewDestinationInterface(ie.DstInterfaceCore))), 1, mockUpf, update))
+	require.False(t, f.Redirects(), "updated Forwarding Parameters without Redirect Information stop the redirection")
+}
@@ -5,10 +5,10 @@
 package pfcpiface
 
 import (
-	"errors"
 	"fmt"
 	"math"
 	"net"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/wmnsk/go-pfcp/ie"
@@ -278,7 +278,14 @@ type pdr struct {
 	tunnelIP4DstMask uint32
 	tunnelTEIDMask   uint32
 
+	// qfi matches on the QFI of the PDU Session Container extension header,
+	// if qfiMask is non-zero.
+	qfi     uint8
+	qfiMask uint8
+
 	appFilter applicationFilter
+	// appID is the Application ID the appFilter was compiled from, if any.
+	appID string
 
 	precedence  uint32
 	pdrID       uint32
@@ -287,16 +294,38 @@ type pdr struct {
 	ctrID       uint32
 	farID       uint32
 	qerIDList   []uint32
+	urrIDList   []uint32
 	needDecap   uint8
 	allocIPFlag bool
+	// allocTEIDKey is the key of the F-TEID chosen by the UPF, 0 if chosen by the CP.
+	allocTEIDKey uint32
+	// ueAddress6 is the IPv6 prefix of a dual-stack UE, only reported to the CP:
+	// datapaths match IPv4 UE addresses.
+	ueAddress6 net.IP
+	// framedRoutes are the subnets behind the UE, matched like its address.
+	framedRoutes []framedRoute
 }
 
+// Flags of the UE IP Address IE.
+const (
+	ueIPAddressV6   = 0x01
+	ueIPAddressV4   = 0x02
+	ueIPAddressCHV4 = 0x10
+	ueIPAddressCHV6 = 0x20
+	ueIPAddressIP6L = 0x40
+)
+
 func needAllocIP(ueIPaddr *ie.UEIPAddressFields) bool {
-	if has2ndBit(ueIPaddr.Flags) && !has5thBit(ueIPaddr.Flags) {
-		return false
+	if ueIPaddr.Flags&ueIPAddressCHV4 != 0 {
+		return true
 	}
 
-	return true
+	// An IE without any address, as sent before CHV4 was honored, asks for an IPv4.
+	return ueIPaddr.Flags&(ueIPAddressV4|ueIPAddressV6|ueIPAddressCHV6) == 0
+}
+
+func needAllocIP6(ueIPaddr *ie.UEIPAddressFields) bool {
+	return ueIPaddr.Flags&ueIPAddressCHV6 != 0
 }
 
 func (af applicationFilter) String() string {
@@ -308,10 +337,10 @@ func (af applicationFilter) String() string {
 func (p pdr) String() string {
 	return fmt.Sprintf("PDR(id=%v, F-SEID=%v, srcIface=%v, tunnelIPv4Dst=%v/%x, "+
 		"tunnelTEID=%v/%x, ueAddress=%v, applicationFilter=%v, precedence=%v, F-SEID IP=%v, "+
-		"counterID=%v, farID=%v, qerIDs=%v, needDecap=%v, allocIPFlag=%v)",
+		"counterID=%v, farID=%v, qerIDs=%v, urrIDs=%v, needDecap=%v, allocIPFlag=%v, ueAddress6=%v, framedRoutes=%v)",
 		p.pdrID, p.fseID, p.srcIface, int2ip(p.tunnelIP4Dst), p.tunnelIP4DstMask,
 		p.tunnelTEID, p.tunnelTEIDMask, int2ip(p.ueAddress), p.appFilter, p.precedence,
-		p.fseidIP, p.ctrID, p.farID, p.qerIDList, p.needDecap, p.allocIPFlag)
+		p.fseidIP, p.ctrID, p.farID, p.qerIDList, p.urrIDList, p.needDecap, p.allocIPFlag, p.ueAddress6, p.framedRoutes)
 }
 
 func (p pdr) IsAppFilterEmpty() bool {
@@ -328,7 +357,27 @@ func (p pdr) IsDownlink() bool {
 	return p.srcIface == core
 }
 
-func (p *pdr) parseUEAddressIE(ueAddrIE *ie.IE, ippool *IPPool) error {
+// networkInstanceName returns the name carried by a Network Instance IE, encoded as
+// DNS labels or as plain text.
+func networkInstanceName(networkInstance *ie.IE) string {
+	b := networkInstance.Payload
+
+	var labels []string
+
+	for i := 0; i < len(b); {
+		n := int(b[i])
+		if n == 0 || i+1+n > len(b) {
+			return string(b)
+		}
+
+		labels = append(labels, string(b[i+1:i+1+n]))
+		i += 1 + n
+	}
+
+	return strings.Join(labels, ".")
+}
+
+func (p *pdr) parseUEAddressIE(ueAddrIE *ie.IE, ipam ipamDriver, dnn string) error {
 	var ueIP4 net.IP
 
 	ueIPaddr, err := ueAddrIE.UEIPAddress()
@@ -336,23 +385,46 @@ func (p *pdr) parseUEAddressIE(ueAddrIE *ie.IE, ippool *IPPool) error {
 		return err
 	}
 
+	if (needAllocIP(ueIPaddr) || needAllocIP6(ueIPaddr)) && ipam == nil {
+		return ErrOperationFailedWithReason("IP allocation", "UE IP allocation is not enabled")
+	}
+
 	if needAllocIP(ueIPaddr) {
-		/* alloc IPV6 if CHV6 is enabled : TBD */
 		log.Infof("UPF should alloc UE IP for SEID %v. CHV4 flag set", p.fseID)
 
-		ueIP4, err = ippool.LookupOrAllocIP(p.fseID)
+		ueIP4, err = ipam.LookupOrAllocIP(dnn, p.fseID)
 		if err != nil {
 			log.Errorln("failed to allocate UE IP")
 			return err
 		}
 
-		log.Traceln("Found or allocated new IP", ueIP4, "from pool", ippool)
+		log.Traceln("Found or allocated new IP", ueIP4, "for DNN", dnn)
 
 		p.allocIPFlag = true
 	} else {
 		ueIP4 = ueIPaddr.IPv4Address
 	}
 
+	if needAllocIP6(ueIPaddr) {
+		log.Infof("UPF should alloc UE IPv6 prefix for SEID %v. CHV6 flag set", p.fseID)
+
+		p.ueAddress6, err = ipam.LookupOrAllocIP6(dnn, p.fseID)
+		if err != nil {
+			log.Errorln("failed to allocate UE IPv6 prefix")
+			return err
+		}
+
+		p.allocIPFlag = true
+	} else if ueIPaddr.Flags&ueIPAddressV6 != 0 {
+		// The address refers to the buffer of the request, reused once handled.
+		p.ueAddress6 = append(net.IP(nil), ueIPaddr.IPv6Address...)
+	}
+
+	if len(ueIP4) == 0 && p.ueAddress6 != nil {
+		return ErrOperationFailedWithReason("parse UE Address IE",
+			"IPv6-only UE addresses are not supported, datapaths match IPv4 UE addresses")
+	}
+
 	// Needed if SDF filter is bad or absent
 	if len(ueIP4) != 4 {
 		return ErrOperationFailedWithParam("parse UE Address IE",
@@ -375,7 +447,9 @@ func (p *pdr) parseSourceInterfaceIE(srcIfaceIE *ie.IE) error {
 	} else if srcIface == ie.SrcInterfaceAccess {
 		p.srcIface = access
 		p.srcIfaceMask = 0xFF
-	} else if srcIface == ie.SrcInterfaceCore {
+	} else if srcIface == ie.SrcInterfaceCore || srcIface == ie.SrcInterface5GVNInternal {
+		// The traffic switched between the UEs of a 5G VN group is matched as coming
+		// from the core interface.
 		p.srcIface = core
 		p.srcIfaceMask = 0xFF
 	}
@@ -389,6 +463,12 @@ func (p *pdr) parseFTEID(teidIE *ie.IE) error {
 		return err
 	}
 
+	// The F-TEID is allocated once the Source Interface, whose IP it takes, is known.
+	if fteid.HasCh() {
+		p.allocTEIDKey = teidChooseKey(p.pdrID, fteid.ChooseID, fteid.HasChID())
+		return nil
+	}
+
 	teid := fteid.TEID
 	tunnelIPv4Address := fteid.IPv4Address
 
@@ -402,12 +482,50 @@ func (p *pdr) parseFTEID(teidIE *ie.IE) error {
 	return nil
 }
 
+// allocFTEID sets the F-TEID chosen by the UPF.
+func (p *pdr) allocFTEID(teids teidAllocator) error {
+	if teids == nil {
+		return ErrOperationFailedWithReason("F-TEID allocation", "FTUP is not enabled")
+	}
+
+	teid, ip, err := teids.allocTEID(p.fseID, p.allocTEIDKey, p.srcIface)
+	if err != nil {
+		return err
+	}
+
+	p.tunnelTEID = teid
+	p.tunnelTEIDMask = 0xFFFFFFFF
+	p.tunnelIP4Dst = ip2int(ip)
+	p.tunnelIP4DstMask = 0xFFFFFFFF
+
+	return nil
+}
+
+func (p *pdr) parseQFI(ie *ie.IE) error {
+	qfi, err := ie.QFI()
+	if err != nil {
+		return err
+	}
+
+	p.qfi = qfi
+	p.qfiMask = 0x3f // QFI is 6 bits wide
+
+	return nil
+}
+
+// matchesQFI returns true if the PDR only matches packets carrying a given QFI.
+func (p pdr) matchesQFI() bool {
+	return p.qfiMask != 0
+}
+
 func (p *pdr) parseApplicationID(ie *ie.IE, appPFDs map[string]appPFD) error {
 	appID, err := ie.ApplicationID()
 	if err != nil {
 		return err
 	}
 
+	p.appID = appID
+
 	apfd, ok := appPFDs[appID]
 	if !ok {
 		return ErrNotFoundWithParam("Application PFD for ApplicationID", "application ID", appID)
@@ -417,6 +535,12 @@ func (p *pdr) parseApplicationID(ie *ie.IE, appPFDs map[string]appPFD) error {
 		log.Fatalln("Mismatch in App ID", appID, apfd.appID)
 	}
 
+	return p.applyAppPFD(apfd)
+}
+
+// applyAppPFD sets the application filter from the first flow description of
+// apfd that matches the direction of the PDR.
+func (p *pdr) applyAppPFD(apfd appPFD) error {
 	for _, flowDesc := range apfd.flowDescs {
 		logger := log.WithFields(log.Fields{
 			"Application ID":   apfd.appID,
@@ -426,7 +550,11 @@ func (p *pdr) parseApplicationID(ie *ie.IE, appPFDs map[string]appPFD) error {
 
 		ipf, err := parseFlowDesc(flowDesc, int2ip(p.ueAddress).String())
 		if err != nil {
-			return errBadFilterDesc
+			return err
+		}
+
+		if err := ipf.checkSupported(); err != nil {
+			return err
 		}
 
 		if (p.srcIface == access && ipf.direction == "out") ||
@@ -469,7 +597,11 @@ func (p *pdr) parseSDFFilter(ie *ie.IE) error {
 
 	ipf, err := parseFlowDesc(flowDesc, int2ip(p.ueAddress).String())
 	if err != nil {
-		return errBadFilterDesc
+		return err
+	}
+
+	if err := ipf.checkSupported(); err != nil {
+		return err
 	}
 
 	if ipf.proto != reservedProto {
@@ -511,11 +643,46 @@ func (p *pdr) parseSDFFilter(ie *ie.IE) error {
 	return nil
 }
 
-func (p *pdr) parsePDI(pdiIEs []*ie.IE, appPFDs map[string]appPFD, ippool *IPPool) error {
+// resetAppFilter resets the application filter to match all traffic of the UE.
+func (p *pdr) resetAppFilter() {
+	p.appFilter = applicationFilter{}
+
+	if p.IsDownlink() && p.ueAddress != 0 {
+		p.appFilter.dstIP = p.ueAddress
+		p.appFilter.dstIPMask = math.MaxUint32 // /32
+	} else if p.IsUplink() && p.ueAddress != 0 {
+		p.appFilter.srcIP = p.ueAddress
+		p.appFilter.srcIPMask = math.MaxUint32 // /32
+	}
+}
+
+func (p *pdr) parsePDI(pdiIEs []*ie.IE, appPFDs map[string]appPFD, ipam ipamDriver, dnns dnnTable, nis niTable,
+	teids teidAllocator) error {
+	// The UE IP is allocated from the pool of the DNN, sent as Network Instance, unless
+	// the Network Instance is that of a local interface.
+	var networkInstance, dnn string
+
+	for _, pdiIE := range pdiIEs {
+		if pdiIE.Type == ie.NetworkInstance {
+			networkInstance = networkInstanceName(pdiIE)
+
+			if nis.has(networkInstance) && !dnns.has(networkInstance) {
+				continue
+			}
+
+			var err error
+
+			if dnn, err = dnns.lookup(networkInstance); err != nil {
+				log.Errorf("Failed to parse Network Instance IE: %v", err)
+				return err
+			}
+		}
+	}
+
 	for _, pdiIE := range pdiIEs {
 		switch pdiIE.Type {
 		case ie.UEIPAddress:
-			if err := p.parseUEAddressIE(pdiIE, ippool); err != nil {
+			if err := p.parseUEAddressIE(pdiIE, ipam, dnn); err != nil {
 				log.Errorf("Failed to parse UE Address IE: %v", err)
 				return err
 			}
@@ -529,18 +696,39 @@ func (p *pdr) parsePDI(pdiIEs []*ie.IE, appPFDs map[string]appPFD, ippool *IPPoo
 				log.Errorf("Failed to parse F-TEID IE: %v", err)
 				return err
 			}
+		case ie.QFI:
+			if err := p.parseQFI(pdiIE); err != nil {
+				log.Errorf("Failed to parse QFI IE: %v", err)
+				return err
+			}
+		}
+	}
+
+	if err := p.parseFramedRoutes(pdiIEs); err != nil {
+		log.Errorf("Failed to parse Framed-Route IE: %v", err)
+		return err
+	}
+
+	if err := nis.checkSource(networkInstance, p.srcIface); err != nil {
+		log.Errorf("Failed to parse Network Instance IE: %v", err)
+		return err
+	}
+
+	if p.allocTEIDKey != 0 {
+		if err := p.allocFTEID(teids); err != nil {
+			log.Errorf("Failed to allocate F-TEID: %v", err)
+			return err
+		}
+
+		// The F-TEID of a mapped Network Instance takes the IP of its interface.
+		if ip := nis.endpointIP(networkInstance); ip != nil {
+			p.tunnelIP4Dst = ip2int(ip)
 		}
 	}
 
 	// initialize application filter with UE address;
 	// it can be overwritten by parseSDFFilter() later.
-	if p.IsDownlink() && p.ueAddress != 0 {
-		p.appFilter.dstIP = p.ueAddress
-		p.appFilter.dstIPMask = math.MaxUint32 // /32
-	} else if p.IsUplink() && p.ueAddress != 0 {
-		p.appFilter.srcIP = p.ueAddress
-		p.appFilter.srcIPMask = math.MaxUint32 // /32
-	}
+	p.resetAppFilter()
 
 	// make another iteration because Application ID and SDF Filter depend on UE IP Address IE
 	for _, ie2 := range pdiIEs {
@@ -561,7 +749,8 @@ func (p *pdr) parsePDI(pdiIEs []*ie.IE, appPFDs map[string]appPFD, ippool *IPPoo
 	return nil
 }
 
-func (p *pdr) parsePDR(ie1 *ie.IE, seid uint64, appPFDs map[string]appPFD, ippool *IPPool) error {
+func (p *pdr) parsePDR(ie1 *ie.IE, seid uint64, appPFDs map[string]appPFD, ipam ipamDriver, dnns dnnTable, nis niTable,
+	teids teidAllocator) error {
 	/* reset outerHeaderRemoval to begin with */
 	outerHeaderRemoval := uint8(0)
 	p.qerIDList = make([]uint32, 0)
@@ -573,6 +762,8 @@ func (p *pdr) parsePDR(ie1 *ie.IE, seid uint64, appPFDs map[string]appPFD, ippoo
 		return err
 	}
 
+	p.pdrID = uint32(pdrID)
+
 	precedence, err := ie1.Precedence()
 	if err != nil {
 		log.Println("Could not read Precedence!")
@@ -590,8 +781,8 @@ func (p *pdr) parsePDR(ie1 *ie.IE, seid uint64, appPFDs map[string]appPFD, ippoo
 		outerHeaderRemoval = 1
 	}
 
-	err = p.parsePDI(pdi, appPFDs, ippool)
-	if err != nil && !errors.Is(err, errBadFilterDesc) {
+	err = p.parsePDI(pdi, appPFDs, ipam, dnns, nis, teids)
+	if err != nil {
 		return err
 	}
 
@@ -601,7 +792,7 @@ func (p *pdr) parsePDR(ie1 *ie.IE, seid uint64, appPFDs map[string]appPFD, ippoo
 		return err
 	}
 
-	/* Multiple instances of QERID can be present in CreatePDR/UpdatePDR
+	/* Multiple instances of QERID and URRID can be present in CreatePDR/UpdatePDR
 	   go-pfcp currently support API to return list of QERIDs. So, we
 	   are parsing the IE list in Application code.*/
 	var ies []*ie.IE
@@ -631,6 +822,16 @@ func (p *pdr) parsePDR(ie1 *ie.IE, seid uint64, appPFDs map[string]appPFD, ippoo
 				p.qerIDList = append(p.qerIDList, qerID)
 			}
 		}
+
+		if x.Type == ie.URRID {
+			urrID, errRead := x.URRID()
+			if errRead != nil {
+				log.Errorln("urrID read failed")
+				continue
+			}
+
+			p.urrIDList = append(p.urrIDList, urrID)
+		}
 	}
 	/*qerID, err := ie1.QERID()
 	if err != nil {
@@ -638,7 +839,6 @@ func (p *pdr) parsePDR(ie1 *ie.IE, seid uint64, appPFDs map[string]appPFD, ippoo
 	}*/
 
 	p.precedence = precedence
-	p.pdrID = uint32(pdrID)
 	p.farID = farID // farID currently not being set <--- FIXIT/TODO/XXX
 	/*p.qerID = qerID*/
 	p.needDecap = outerHeaderRemoval
@@ -12,6 +12,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
 )
 
 type pdrTestCase struct {
@@ -119,9 +120,9 @@ func Test_parsePDR(t *testing.T) {
 				flowDescs: nil,
 			}
 			mockPDR := &pdr{}
-			mockIPPool, _ := NewIPPool("10.0.0.0")
+			mockIPPool, _ := NewIPPools("10.0.0.0", "", nil)
 
-			err := mockPDR.parsePDR(scenario.input, FSEID, mockMapPFD, mockIPPool)
+			err := mockPDR.parsePDR(scenario.input, FSEID, mockMapPFD, mockIPPool, nil, nil, nil)
 			require.NoError(t, err)
 
 			assert.Equal(t, mockPDR, scenario.expected)
@@ -158,9 +159,9 @@ func TestParsePDRShouldError(t *testing.T) {
 				flowDescs: nil,
 			}
 			mockPDR := &pdr{}
-			mockIPPool, _ := NewIPPool("10.0.0.0")
+			mockIPPool, _ := NewIPPools("10.0.0.0", "", nil)
 
-			err := mockPDR.parsePDR(scenario.input, FSEID, mockMapPFD, mockIPPool)
+			err := mockPDR.parsePDR(scenario.input, FSEID, mockMapPFD, mockIPPool, nil, nil, nil)
 			require.Error(t, err)
 
 			assert.Equal(t, scenario.expected, mockPDR)
@@ -633,6 +634,18 @@ func Test_pdr_parseSDFFilter(t *testing.T) {
 			sdfIE:   newFilter(""),
 			wantErr: true,
 		},
+		{
+			name:      "IPv6 flow description",
+			sdfIE:     newFilter("permit out udp from 2001:db8::1 to assigned"),
+			direction: core,
+			wantErr:   true,
+		},
+		{
+			name:      "unknown protocol",
+			sdfIE:     newFilter("permit out foo from 192.168.1.1/32 to assigned"),
+			direction: core,
+			wantErr:   true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -657,7 +670,7 @@ func Test_pdr_parsePDI(t *testing.T) {
 	type args struct {
 		pdiIEs  []*ie.IE
 		appPFDs map[string]appPFD
-		ippool  *IPPool
+		ippool  ipamDriver
 	}
 
 	tests := []struct {
@@ -710,7 +723,7 @@ func Test_pdr_parsePDI(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := pdr{}
-			if err := p.parsePDI(tt.args.pdiIEs, tt.args.appPFDs, tt.args.ippool); (err != nil) != tt.wantErr {
+			if err := p.parsePDI(tt.args.pdiIEs, tt.args.appPFDs, tt.args.ippool, nil, nil, nil); (err != nil) != tt.wantErr {
 				t.Errorf("parsePDI() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
@@ -720,3 +733,195 @@ func Test_pdr_parsePDI(t *testing.T) {
 		})
 	}
 }
+
+func Test_pdr_parseQFI(t *testing.T) {
+	var p pdr
+
+	require.False(t, p.matchesQFI())
+	require.NoError(t, p.parseQFI(ie.NewQFI(5)))
+	require.True(t, p.matchesQFI())
+	require.Equal(t, uint8(5), p.qfi)
+
+	require.Error(t, p.parseQFI(ie.NewQERID(1)))
+}
+
+func Test_pdr_parsePDI_ipPoolOfDNN(t *testing.T) {
+	pools, err := NewIPPools("10.0.0.0/24", "", []UEIPPoolInfo{{Dnn: "internet", Pool: "10.1.0.0/24"}})
+	require.NoError(t, err)
+
+	_, dnnPool, _ := net.ParseCIDR("10.1.0.0/24")
+
+	for i, networkInstance := range []*ie.IE{ie.NewNetworkInstance("internet"), ie.NewNetworkInstanceFQDN("internet")} {
+		p := pdr{fseID: uint64(i)}
+		err := p.parsePDI([]*ie.IE{
+			ie.NewSourceInterface(ie.SrcInterfaceCore),
+			ie.NewUEIPAddress(0x10, "", "", 0, 0),
+			networkInstance,
+		}, nil, pools, nil, nil, nil)
+		require.NoError(t, err)
+		require.True(t, dnnPool.Contains(int2ip(p.ueAddress)))
+		require.True(t, p.allocIPFlag)
+	}
+
+	p := pdr{fseID: 100}
+	require.NoError(t, p.parsePDI([]*ie.IE{ie.NewUEIPAddress(0x10, "", "", 0, 0)}, nil, pools, nil, nil, nil))
+	require.Equal(t, "10.0.0.1", int2ip(p.ueAddress).String())
+}
+
+func Test_pdr_parsePDI_dnns(t *testing.T) {
+	dnns := []DNNInfo{
+		{Dnn: "internet", Pool: "10.1.0.0/24"},
+		{Dnn: "ims", NetworkInstance: "ims.mnc001.mcc001.gprs", Pool: "10.2.0.0/24", Slice: "voice"},
+	}
+
+	pools, err := NewIPPools("10.0.0.0/24", "", CPIfaceInfo{DNNs: dnns}.ueIPPools())
+	require.NoError(t, err)
+
+	table := newDNNTable(dnns)
+
+	for i, tt := range []struct {
+		networkInstance string
+		pool            string
+	}{
+		{"internet", "10.1.0.0/24"},
+		{"ims.mnc001.mcc001.gprs", "10.2.0.0/24"},
+	} {
+		p := pdr{fseID: uint64(i)}
+		require.NoError(t, p.parsePDI([]*ie.IE{
+			ie.NewSourceInterface(ie.SrcInterfaceCore),
+			ie.NewUEIPAddress(0x10, "", "", 0, 0),
+			ie.NewNetworkInstanceFQDN(tt.networkInstance),
+		}, nil, pools, table, nil, nil))
+
+		_, pool, _ := net.ParseCIDR(tt.pool)
+		require.True(t, pool.Contains(int2ip(p.ueAddress)), tt.networkInstance)
+	}
+
+	p := pdr{fseID: 3}
+	err = p.parsePDI([]*ie.IE{ie.NewSourceInterface(ie.SrcInterfaceAccess), ie.NewNetworkInstance("ims")}, nil, pools, table, nil, nil)
+	require.ErrorIs(t, err, errUnknownNetworkInstance, "the DNN is not its network instance")
+	require.Equal(t, ie.CauseRuleCreationModificationFailure, ruleErrorCause(err))
+
+	require.NoError(t, p.parsePDI([]*ie.IE{ie.NewSourceInterface(ie.SrcInterfaceAccess)}, nil, pools, table, nil, nil),
+		"PDIs without network instance are accepted")
+	require.NoError(t, p.parsePDI([]*ie.IE{ie.NewNetworkInstance("ims")}, nil, pools, nil, nil, nil), "any DNN is served")
+}
+
+func Test_pdr_parsePDI_networkInstances(t *testing.T) {
+	dnns := []DNNInfo{{Dnn: "internet", Pool: "10.1.0.0/24"}}
+
+	pools, err := NewIPPools("10.0.0.0/24", "", CPIfaceInfo{DNNs: dnns}.ueIPPools())
+	require.NoError(t, err)
+
+	nis := newNITable([]NetworkInstanceInfo{
+		{NetworkInstance: "access", Interface: niInterfaceAccess},
+		{NetworkInstance: "internet", Interface: niInterfaceCore},
+	})
+
+	p := pdr{fseID: 1}
+	require.NoError(t, p.parsePDI([]*ie.IE{
+		ie.NewSourceInterface(ie.SrcInterfaceAccess),
+		ie.NewNetworkInstanceFQDN("access"),
+		ie.NewUEIPAddress(0x10, "", "", 0, 0),
+	}, nil, pools, newDNNTable(dnns), nis, nil), "the network instance of an interface is not a DNN")
+	require.Equal(t, "10.0.0.1", int2ip(p.ueAddress).String())
+
+	p = pdr{fseID: 2}
+	require.NoError(t, p.parsePDI([]*ie.IE{
+		ie.NewSourceInterface(ie.SrcInterfaceCore),
+		ie.NewNetworkInstanceFQDN("internet"),
+		ie.NewUEIPAddress(0x10, "", "", 0, 0),
+	}, nil, pools, newDNNTable(dnns), nis, nil))
+	require.Equal(t, "10.1.0.1", int2ip(p.ueAddress).String())
+
+	p = pdr{fseID: 3}
+	err = p.parsePDI([]*ie.IE{
+		ie.NewSourceInterface(ie.SrcInterfaceCore),
+		ie.NewNetworkInstanceFQDN("access"),
+	}, nil, pools, newDNNTable(dnns), nis, nil)
+	require.ErrorIs(t, err, errNetworkInstanceMismatch)
+	require.Equal(t, ie.CauseRuleCreationModificationFailure, ruleErrorCause(err))
+}
+
+// accessTEIDs allocates the TEIDs chosen by the UPF from 0x100, with the access IP.
+type accessTEIDs struct {
+	next uint32
+}
+
+func (a *accessTEIDs) allocTEID(seid uint64, key uint32, srcIface uint8) (uint32, net.IP, error) {
+	a.next++
+	return 0x100 + a.next, net.ParseIP("198.18.0.1"), nil
+}
+
+func Test_pdr_parsePDI_networkInstanceFTEID(t *testing.T) {
+	nis := newNITable([]NetworkInstanceInfo{
+		{NetworkInstance: "n3-site2", Interface: niInterfaceAccess, IP: "198.18.1.1"},
+		{NetworkInstance: "access", Interface: niInterfaceAccess},
+	})
+	teids := &accessTEIDs{}
+
+	for _, tt := range []struct {
+		networkInstance string
+		tunnelIP4Dst    string
+	}{
+		{"n3-site2", "198.18.1.1"},
+		{"access", "198.18.0.1"},
+		{"internet", "198.18.0.1"},
+	} {
+		p := pdr{fseID: 1, pdrID: 1}
+		require.NoError(t, p.parsePDI([]*ie.IE{
+			ie.NewSourceInterface(ie.SrcInterfaceAccess),
+			ie.NewNetworkInstanceFQDN(tt.networkInstance),
+			ie.NewFTEID(0x05, 0, nil, nil, 0),
+		}, nil, nil, nil, nis, teids), tt.networkInstance)
+		require.Equal(t, tt.tunnelIP4Dst, int2ip(p.tunnelIP4Dst).String(), tt.networkInstance)
+	}
+}
+
+func Test_pdr_parsePDI_ipv6(t *testing.T) {
+	pools, err := NewIPPools("10.0.0.0/24", "2001:db8::/48", nil)
+	require.NoError(t, err)
+
+	t.Run("dual-stack allocation", func(t *testing.T) {
+		p := pdr{fseID: 1}
+		require.NoError(t, p.parsePDI([]*ie.IE{
+			ie.NewSourceInterface(ie.SrcInterfaceCore),
+			ie.NewUEIPAddress(ueIPAddressCHV4|ueIPAddressCHV6, "", "", 0, 0),
+		}, nil, pools, nil, nil, nil))
+		require.Equal(t, "10.0.0.1", int2ip(p.ueAddress).String())
+		require.Equal(t, "2001:db8::", p.ueAddress6.String())
+
+		session := PFCPSession{localSEID: 1, PacketForwardingRules: PacketForwardingRules{pdrs: []pdr{p}}}
+		msg := message.NewSessionEstablishmentResponse(0, 0, 0, 0, 0)
+		addPdrInfo(msg, &session)
+
+		require.Len(t, msg.CreatedPDR, 1)
+		ueIP, err := msg.CreatedPDR[0].UEIPAddress()
+		require.NoError(t, err)
+		require.Equal(t, "10.0.0.1", ueIP.IPv4Address.String())
+		require.Equal(t, "2001:db8::", ueIP.IPv6Address.String())
+		require.Equal(t, uint8(ueIPv6PrefixLen), ueIP.IPv6PrefixLength)
+	})
+
+	t.Run("IPv6-only is rejected", func(t *testing.T) {
+		p := pdr{fseID: 2}
+		require.Error(t, p.parsePDI([]*ie.IE{
+			ie.NewSourceInterface(ie.SrcInterfaceCore),
+			ie.NewUEIPAddress(ueIPAddressCHV6, "", "", 0, 0),
+		}, nil, pools, nil, nil, nil))
+	})
+}
+
+func Test_pdrLookupRule_QFI(t *testing.T) {
+	var p pdr
+
+	rule := pdrLookupRule(p, 0, portRangeTernaryCartesianProduct{})
+	require.Equal(t, uint64(0), rule.Masks[8].GetValueInt(), "QFI wildcarded")
+
+	require.NoError(t, p.parseQFI(ie.NewQFI(5)))
+
+	rule = pdrLookupRule(p, 0, portRangeTernaryCartesianProduct{})
+	require.Len(t, rule.Values, 9)
+	require.Equal(t, uint64(5), rule.Values[8].GetValueInt())
+	require.Equal(t, uint64(0x3f), rule.Masks[8].GetValueInt())
+}
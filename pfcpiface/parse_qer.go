@@ -42,6 +42,8 @@ func (q qer) String() string {
 		qosLevel, q.ulStatus, q.dlStatus)
 }
 
+// parseQER parses a Create or Update QER IE. The fields of the IEs absent from an
+// Update QER, e.g. the bit rates of a gate status change, are left as they are.
 func (q *qer) parseQER(ie1 *ie.IE, seid uint64) error {
 	qerID, err := ie1.QERID()
 	if err != nil {
@@ -49,50 +51,50 @@ func (q *qer) parseQER(ie1 *ie.IE, seid uint64) error {
 		return err
 	}
 
-	qfi, err := ie1.QFI()
-	if err != nil {
+	q.qerID = qerID
+	q.fseID = seid
+
+	if qfi, err := ie1.QFI(); err == nil {
+		q.qfi = qfi
+	} else {
 		log.Println("Could not read QFI!")
 	}
 
-	gsUL, err := ie1.GateStatusUL()
-	if err != nil {
+	if gsUL, err := ie1.GateStatusUL(); err == nil {
+		q.ulStatus = gsUL
+	} else {
 		log.Println("Could not read Gate status uplink!")
 	}
 
-	gsDL, err := ie1.GateStatusDL()
-	if err != nil {
+	if gsDL, err := ie1.GateStatusDL(); err == nil {
+		q.dlStatus = gsDL
+	} else {
 		log.Println("Could not read Gate status downlink!")
 	}
 
-	mbrUL, err := ie1.MBRUL()
-	if err != nil {
+	if mbrUL, err := ie1.MBRUL(); err == nil {
+		q.ulMbr = mbrUL
+	} else {
 		log.Println("Could not read MBRUL!")
 	}
 
-	mbrDL, err := ie1.MBRDL()
-	if err != nil {
+	if mbrDL, err := ie1.MBRDL(); err == nil {
+		q.dlMbr = mbrDL
+	} else {
 		log.Println("Could not read MBRDL!")
 	}
 
-	gbrUL, err := ie1.GBRUL()
-	if err != nil {
+	if gbrUL, err := ie1.GBRUL(); err == nil {
+		q.ulGbr = gbrUL
+	} else {
 		log.Println("Could not read GBRUL!")
 	}
 
-	gbrDL, err := ie1.GBRDL()
-	if err != nil {
+	if gbrDL, err := ie1.GBRDL(); err == nil {
+		q.dlGbr = gbrDL
+	} else {
 		log.Println("Could not read GBRDL!")
 	}
 
-	q.qerID = qerID
-	q.qfi = qfi
-	q.ulStatus = gsUL
-	q.dlStatus = gsDL
-	q.ulMbr = mbrUL
-	q.dlMbr = mbrDL
-	q.ulGbr = gbrUL
-	q.dlGbr = gbrDL
-	q.fseID = seid
-
 	return nil
 }
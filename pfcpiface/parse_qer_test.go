@@ -84,3 +84,23 @@ func TestParseQERShouldError(t *testing.T) {
 		})
 	}
 }
+
+func TestParseQERUpdateKeepsAbsentIEs(t *testing.T) {
+	q := qer{qerID: 5, qfi: 9, ulMbr: 1000, dlMbr: 2000, fseID: 100}
+
+	err := q.parseQER(ie.NewUpdateQER(
+		ie.NewQERID(5),
+		ie.NewGateStatus(ie.GateStatusClosed, ie.GateStatusClosed),
+	), 100)
+	require.NoError(t, err)
+
+	assert.Equal(t, qer{
+		qerID:    5,
+		qfi:      9,
+		ulMbr:    1000,
+		dlMbr:    2000,
+		ulStatus: ie.GateStatusClosed,
+		dlStatus: ie.GateStatusClosed,
+		fseID:    100,
+	}, q)
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -21,6 +22,21 @@ const (
 
 var errBadFilterDesc = errors.New("unsupported Filter Description format")
 
+// l4ProtoKeywords maps the protocol keywords of a Flow Description to their
+// IANA protocol numbers. "ip" matches any protocol.
+var l4ProtoKeywords = map[string]uint8{
+	"ip":     reservedProto,
+	"icmp":   1,
+	"igmp":   2,
+	"tcp":    6,
+	"udp":    17,
+	"gre":    47,
+	"esp":    50,
+	"ah":     51,
+	"icmpv6": 58,
+	"sctp":   132,
+}
+
 type endpoint struct {
 	IPNet *net.IPNet
 	ports portRange
@@ -31,7 +47,11 @@ func (ep *endpoint) parseNet(ipnet string) error {
 
 	switch len(ipNetFields) {
 	case 1:
-		ipnet = ipNetFields[0] + "/32"
+		if strings.Contains(ipnet, ":") {
+			ipnet = ipNetFields[0] + "/128"
+		} else {
+			ipnet = ipNetFields[0] + "/32"
+		}
 	case 2:
 	default:
 		return ErrInvalidArgument("network string", len(ipNetFields))
@@ -47,7 +67,52 @@ func (ep *endpoint) parseNet(ipnet string) error {
 	return nil
 }
 
+// isIPv6 returns true if the endpoint matches on an IPv6 prefix.
+func (ep *endpoint) isIPv6() bool {
+	return ep.IPNet != nil && ep.IPNet.IP.To4() == nil
+}
+
+// parsePort parses a port, a port range or a comma-separated list of them. The
+// datapath matches a single range per endpoint, so the list must be contiguous.
 func (ep *endpoint) parsePort(port string) error {
+	items := strings.Split(port, ",")
+	if len(items) == 1 {
+		return ep.parsePortRange(port)
+	}
+
+	ranges := make([]portRange, 0, len(items))
+
+	for _, item := range items {
+		var e endpoint
+		if err := e.parsePortRange(item); err != nil {
+			return err
+		}
+
+		ranges = append(ranges, e.ports)
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].low < ranges[j].low
+	})
+
+	merged := ranges[0]
+
+	for _, r := range ranges[1:] {
+		if uint32(r.low) > uint32(merged.high)+1 {
+			return ErrInvalidArgumentWithReason("port", port, "non-contiguous port list")
+		}
+
+		if r.high > merged.high {
+			merged.high = r.high
+		}
+	}
+
+	ep.ports = newRangeMatchPortRange(merged.low, merged.high)
+
+	return nil
+}
+
+func (ep *endpoint) parsePortRange(port string) error {
 	ports := strings.Split(port, "-")
 	if len(ports) == 0 || len(ports) > 2 {
 		return ErrInvalidArgument("port string", port)
@@ -95,6 +160,15 @@ func (ipf *ipFilterRule) String() string {
 		ipf.action, ipf.direction, ipf.proto, ipf.src.IPNet, ipf.src.ports, ipf.dst.IPNet, ipf.dst.ports)
 }
 
+// checkSupported returns an error if the datapath cannot enforce the rule.
+func (ipf *ipFilterRule) checkSupported() error {
+	if ipf.src.isIPv6() || ipf.dst.isIPv6() {
+		return fmt.Errorf("%w: IPv6 prefixes are not supported by the datapath", errBadFilterDesc)
+	}
+
+	return nil
+}
+
 func parseFlowDesc(flowDesc, ueIP string) (*ipFilterRule, error) {
 	parseLog := log.WithFields(log.Fields{
 		"flow-description": flowDesc,
@@ -120,7 +194,14 @@ func parseFlowDesc(flowDesc, ueIP string) (*ipFilterRule, error) {
 	}
 
 	ipf.direction = fields[1]
-	ipf.proto, _ = parseL4Proto(fields[2])
+
+	proto, err := parseL4Proto(fields[2])
+	if err != nil {
+		parseLog.Error("protocol parse failed ", err)
+		return nil, fmt.Errorf("%w: unknown protocol %s", errBadFilterDesc, fields[2])
+	}
+
+	ipf.proto = proto
 
 	// bring to common intermediate representation
 	xform := func(i int) {
@@ -142,31 +223,39 @@ func parseFlowDesc(flowDesc, ueIP string) (*ipFilterRule, error) {
 		switch fields[i] {
 		case "from":
 			i++
+			if i >= len(fields) {
+				return nil, fmt.Errorf("%w: missing source address", errBadFilterDesc)
+			}
+
 			xform(i)
 
 			err := ipf.src.parseNet(fields[i])
 			if err != nil {
 				parseLog.Error(err)
-				return nil, err
+				return nil, fmt.Errorf("%w: %v", errBadFilterDesc, err)
 			}
 
-			if fields[i+1] != "to" {
+			if i+1 < len(fields) && fields[i+1] != "to" {
 				i++
 
 				err = ipf.src.parsePort(fields[i])
 				if err != nil {
 					parseLog.Error("src port parse failed ", err)
-					return nil, err
+					return nil, fmt.Errorf("%w: %v", errBadFilterDesc, err)
 				}
 			}
 		case "to":
 			i++
+			if i >= len(fields) {
+				return nil, fmt.Errorf("%w: missing destination address", errBadFilterDesc)
+			}
+
 			xform(i)
 
 			err := ipf.dst.parseNet(fields[i])
 			if err != nil {
 				parseLog.Error(err)
-				return nil, err
+				return nil, fmt.Errorf("%w: %v", errBadFilterDesc, err)
 			}
 
 			if i < len(fields)-1 {
@@ -175,7 +264,7 @@ func parseFlowDesc(flowDesc, ueIP string) (*ipFilterRule, error) {
 				err = ipf.dst.parsePort(fields[i])
 				if err != nil {
 					parseLog.Error("dst port parse failed ", err)
-					return nil, err
+					return nil, fmt.Errorf("%w: %v", errBadFilterDesc, err)
 				}
 			}
 		}
@@ -215,12 +304,9 @@ func parseL4Proto(proto string) (uint8, error) {
 		return uint8(p), nil
 	}
 
-	switch proto {
-	case "udp":
-		return 17, nil
-	case "tcp":
-		return 6, nil
-	default:
-		return reservedProto, errBadFilterDesc
+	if p, ok := l4ProtoKeywords[proto]; ok {
+		return p, nil
 	}
+
+	return reservedProto, errBadFilterDesc
 }
@@ -51,6 +51,10 @@ func Test_endpoint_parseNet(t *testing.T) {
 			args:    "2001:db8:a0b:12f0::1/32",
 			want:    endpoint{IPNet: mustParseCIDRNet("2001:db8:a0b:12f0::1/32")},
 			wantErr: false},
+		{name: "single IPv6 host",
+			args:    "2001:db8::1",
+			want:    endpoint{IPNet: mustParseCIDRNet("2001:db8::1/128")},
+			wantErr: false},
 		{name: "invalid empty arg",
 			args:    "",
 			wantErr: true},
@@ -114,6 +118,17 @@ func Test_endpoint_parsePort(t *testing.T) {
 		{name: "wrong separator",
 			args:    "200,300",
 			wantErr: true},
+		{name: "contiguous port list",
+			args:    "8080,8081-8084,8085",
+			want:    endpoint{ports: newRangeMatchPortRange(8080, 8085)},
+			wantErr: false},
+		{name: "overlapping unordered port list",
+			args:    "8082-8090,8080-8084",
+			want:    endpoint{ports: newRangeMatchPortRange(8080, 8090)},
+			wantErr: false},
+		{name: "invalid port in list",
+			args:    "8080,abc",
+			wantErr: true},
 		{name: "malformed non-decimal number format",
 			args:    "0x0000-0xffff",
 			wantErr: true},
@@ -407,6 +422,54 @@ func Test_parseFlowDesc(t *testing.T) {
 					ports: newExactMatchPortRange(9999),
 				},
 			}, wantErr: false},
+		{name: "protocol keyword",
+			args: args{
+				flowDesc: "permit out icmp from any to assigned",
+				ueIP:     ueIpString,
+			},
+			want: &ipFilterRule{
+				action:    "permit",
+				direction: "out",
+				proto:     1,
+				src: endpoint{
+					IPNet: newIpv4WildcardNet(),
+					ports: newWildcardPortRange(),
+				},
+				dst: endpoint{
+					IPNet: newIpv4AddrAsNet(ueIpString),
+					ports: newWildcardPortRange(),
+				},
+			}, wantErr: false},
+		{name: "from IPv6 net",
+			args: args{
+				flowDesc: "permit out udp from 2001:db8::/64 to assigned",
+				ueIP:     ueIpString,
+			},
+			want: &ipFilterRule{
+				action:    "permit",
+				direction: "out",
+				proto:     udpProto,
+				src: endpoint{
+					IPNet: mustParseCIDRNet("2001:db8::/64"),
+					ports: newWildcardPortRange(),
+				},
+				dst: endpoint{
+					IPNet: newIpv4AddrAsNet(ueIpString),
+					ports: newWildcardPortRange(),
+				},
+			}, wantErr: false},
+		{name: "unknown protocol",
+			args: args{
+				flowDesc: "permit out foo from any to assigned",
+				ueIP:     ueIpString,
+			},
+			wantErr: true},
+		{name: "missing destination address",
+			args: args{
+				flowDesc: "permit out ip from any to",
+				ueIP:     ueIpString,
+			},
+			wantErr: true},
 		{name: "to unknown assigned UE IP (uplink)",
 			args: args{
 				flowDesc: "permit out udp from 60.60.0.1/32 to assigned",
@@ -449,6 +512,10 @@ func Test_parseL4Proto(t *testing.T) {
 		{name: "TCP proto", args: "tcp", want: 6, wantErr: false},
 		{name: "UDP proto", args: "udp", want: 17, wantErr: false},
 		{name: "numeric proto", args: "8", want: 8, wantErr: false},
+		{name: "any proto", args: "ip", want: 255, wantErr: false},
+		{name: "ICMP proto", args: "icmp", want: 1, wantErr: false},
+		{name: "SCTP proto", args: "sctp", want: 132, wantErr: false},
+		{name: "unknown proto", args: "foo", want: 255, wantErr: true},
 		{name: "empty proto", args: "", want: 255, wantErr: true},
 		{name: "hex proto", args: "0x10", want: 255, wantErr: true},
 	}
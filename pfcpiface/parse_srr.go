@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// Requested QoS Monitoring flags (3GPP TS 29.244, clause 8.2.163), also those of the
+// Packet Delay Thresholds and QoS Monitoring Measurement.
+const (
+	qosMonitorDL = 0x01
+	qosMonitorUL = 0x02
+	qosMonitorRP = 0x04
+)
+
+// Reporting Frequency flags (3GPP TS 29.244, clause 8.2.164).
+const (
+	qosReportEVETT = 0x01
+	qosReportPERIO = 0x02
+	qosReportSESRL = 0x04
+)
+
+var errQoSMonitoringDisabled = errors.New("QoS monitoring is not enabled")
+
+// packetDelays are packet delays in milliseconds, those set in flags only.
+type packetDelays struct {
+	flags uint8
+	dl    uint32
+	ul    uint32
+	rp    uint32
+}
+
+// qosMonitoring is the QoS monitoring requested for some QoS flows of a session.
+type qosMonitoring struct {
+	qfis       []uint8
+	requested  uint8
+	frequency  uint8
+	thresholds packetDelays
+	minWait    time.Duration
+	period     time.Duration
+}
+
+// srr is a Session Reporting Rule. Only QoS monitoring is supported.
+type srr struct {
+	srrID uint8
+	fseID uint64
+	flows []qosMonitoring
+}
+
+func (s srr) String() string {
+	return fmt.Sprintf("SRR(id=%v, F-SEID=%v, QoS monitoring=%+v)", s.srrID, s.fseID, s.flows)
+}
+
+// parseSRR parses a Create SRR or Update SRR IE. The QoS monitoring of an updated SRR
+// replaces the previous one.
+func (s *srr) parseSRR(srrIE *ie.IE, seid uint64, upf *upf) error {
+	srrID, err := srrIE.SRRID()
+	if err != nil {
+		return err
+	}
+
+	var ies []*ie.IE
+
+	if srrIE.Type == ie.CreateSRR {
+		ies, err = srrIE.CreateSRR()
+	} else {
+		ies, err = srrIE.UpdateSRR()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.srrID = srrID
+	s.fseID = seid
+	s.flows = nil
+
+	for _, x := range ies {
+		if x.Type != ie.QoSMonitoringPerQoSFlowControlInformation {
+			continue
+		}
+
+		if upf.pathMonitor == nil {
+			return fmt.Errorf("%w: SRR %v requests QoS monitoring", errQoSMonitoringDisabled, srrID)
+		}
+
+		var q qosMonitoring
+		if err := q.parse(x); err != nil {
+			return err
+		}
+
+		s.flows = append(s.flows, q)
+	}
+
+	return nil
+}
+
+func (q *qosMonitoring) parse(infoIE *ie.IE) error {
+	ies, err := infoIE.QoSMonitoringPerQoSFlowControlInformation()
+	if err != nil {
+		return err
+	}
+
+	for _, x := range ies {
+		switch x.Type {
+		case ie.QFI:
+			qfi, err := x.QFI()
+			if err != nil {
+				return err
+			}
+
+			q.qfis = append(q.qfis, qfi)
+		case ie.RequestedQoSMonitoring:
+			q.requested, err = x.RequestedQoSMonitoring()
+		case ie.ReportingFrequency:
+			q.frequency, err = x.ReportingFrequency()
+		case ie.PacketDelayThresholds:
+			var th *ie.PacketDelayThresholdsFields
+
+			if th, err = x.PacketDelayThresholds(); err == nil {
+				q.thresholds = packetDelays{
+					flags: th.Flags,
+					dl:    th.DownlinkPacketDelayThresholds,
+					ul:    th.UplinkPacketDelayThresholds,
+					rp:    th.RoundTripPacketDelayThresholds,
+				}
+			}
+		case ie.MinimumWaitTime:
+			q.minWait, err = x.MinimumWaitTime()
+		case ie.MeasurementPeriod:
+			q.period, err = x.MeasurementPeriod()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(q.qfis) == 0 {
+		return ErrInvalidArgumentWithReason("QoS Monitoring per QoS flow Control Information", q, "no QFI")
+	}
+
+	if q.frequency&qosReportPERIO != 0 && q.period == 0 {
+		return ErrInvalidArgumentWithReason("QoS Monitoring per QoS flow Control Information", q,
+			"periodic reporting without Measurement Period")
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// Measurement Method flags (3GPP TS 29.244, clause 8.2.40).
+const (
+	measureDuration = 0x01
+	measureVolume   = 0x02
+	measureEvent    = 0x04
+)
+
+// Reporting Triggers flags (3GPP TS 29.244, clause 8.2.41), as returned by go-pfcp.
+const (
+	reportPeriodic        = 0x0100
+	reportVolumeThreshold = 0x0200
+	reportTimeThreshold   = 0x0400
+	reportStartOfTraffic  = 0x1000
+	reportStopOfTraffic   = 0x2000
+)
+
+// Volume Threshold flags (3GPP TS 29.244, clause 8.2.13).
+const (
+	volumeTotal    = 0x01
+	volumeUplink   = 0x02
+	volumeDownlink = 0x04
+)
+
+type volumeThreshold struct {
+	flags    uint8
+	total    uint64 // in bytes
+	uplink   uint64 // in bytes
+	downlink uint64 // in bytes
+}
+
+type urr struct {
+	urrID          uint32
+	measureMethod  uint8
+	reportTriggers uint16
+	volThreshold   volumeThreshold
+	timeThreshold  uint32 // in seconds
+	measurePeriod  uint32 // in seconds
+	inactivityTime uint32 // in seconds
+	fseID          uint64
+	fseidIP        uint32
+}
+
+func (u urr) String() string {
+	return fmt.Sprintf("URR(id=%v, F-SEID=%v, F-SEID IP=%v, measurementMethod=%#x, "+
+		"reportingTriggers=%#x, volumeThreshold=%v/%v/%v (flags=%#x), timeThreshold=%v, "+
+		"measurementPeriod=%v, inactivityDetectionTime=%v)",
+		u.urrID, u.fseID, u.fseidIP, u.measureMethod, u.reportTriggers,
+		u.volThreshold.total, u.volThreshold.uplink, u.volThreshold.downlink,
+		u.volThreshold.flags, u.timeThreshold, u.measurePeriod, u.inactivityTime)
+}
+
+func (u urr) hasVolumeThreshold() bool {
+	return u.measureMethod&measureVolume != 0 && u.reportTriggers&reportVolumeThreshold != 0 &&
+		u.volThreshold.flags != 0
+}
+
+func (u urr) hasTimeThreshold() bool {
+	return u.measureMethod&measureDuration != 0 && u.reportTriggers&reportTimeThreshold != 0 &&
+		u.timeThreshold != 0
+}
+
+// detectsTraffic reports whether the start or stop of the traffic of the PDRs of the URR
+// is reported.
+func (u urr) detectsTraffic() bool {
+	return u.reportTriggers&(reportStartOfTraffic|reportStopOfTraffic) != 0
+}
+
+func (u *urr) parseURR(ie1 *ie.IE, seid uint64) error {
+	urrID, err := ie1.URRID()
+	if err != nil {
+		log.Println("Could not read URR ID!")
+		return err
+	}
+
+	method, err := ie1.MeasurementMethod()
+	if err != nil {
+		log.Println("Could not read Measurement Method!")
+	}
+
+	triggers, err := ie1.ReportingTriggers()
+	if err != nil {
+		log.Println("Could not read Reporting Triggers!")
+	}
+
+	volThreshold, err := ie1.VolumeThreshold()
+	if err != nil && !errors.Is(err, ie.ErrIENotFound) {
+		log.Println("Could not read Volume Threshold!")
+	}
+
+	timeThreshold, err := ie1.TimeThreshold()
+	if err != nil && !errors.Is(err, ie.ErrIENotFound) {
+		log.Println("Could not read Time Threshold!")
+	}
+
+	period, err := ie1.MeasurementPeriod()
+	if err != nil && !errors.Is(err, ie.ErrIENotFound) {
+		log.Println("Could not read Measurement Period!")
+	}
+
+	inactivity, err := ie1.InactivityDetectionTime()
+	if err != nil && !errors.Is(err, ie.ErrIENotFound) {
+		log.Println("Could not read Inactivity Detection Time!")
+	}
+
+	u.urrID = urrID
+	u.measureMethod = method
+	u.reportTriggers = triggers
+	u.timeThreshold = timeThreshold
+	u.measurePeriod = uint32(period.Seconds())
+	u.inactivityTime = inactivity
+	u.fseID = seid
+
+	if volThreshold != nil {
+		u.volThreshold = volumeThreshold{
+			flags:    volThreshold.Flags,
+			total:    volThreshold.TotalVolume,
+			uplink:   volThreshold.UplinkVolume,
+			downlink: volThreshold.DownlinkVolume,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+type urrTestCase struct {
+	input       *ie.IE
+	expected    *urr
+	description string
+}
+
+func TestParseURR(t *testing.T) {
+	FSEID := uint64(100)
+
+	for _, scenario := range []urrTestCase{
+		{
+			input: ie.NewCreateURR(
+				ie.NewURRID(7),
+				ie.NewMeasurementMethod(0, 1, 1),
+				ie.NewReportingTriggers(reportVolumeThreshold|reportTimeThreshold),
+				ie.NewVolumeThreshold(volumeTotal|volumeDownlink, 1000, 0, 800),
+				ie.NewTimeThreshold(60),
+			),
+			expected: &urr{
+				urrID:          7,
+				measureMethod:  measureVolume | measureDuration,
+				reportTriggers: reportVolumeThreshold | reportTimeThreshold,
+				volThreshold: volumeThreshold{
+					flags:    volumeTotal | volumeDownlink,
+					total:    1000,
+					downlink: 800,
+				},
+				timeThreshold: 60,
+				fseID:         FSEID,
+			},
+			description: "Valid Create URR input with thresholds",
+		},
+		{
+			input: ie.NewUpdateURR(
+				ie.NewURRID(7),
+				ie.NewMeasurementMethod(0, 1, 0),
+				ie.NewReportingTriggers(reportPeriodic),
+				ie.NewMeasurementPeriod(30*time.Second),
+			),
+			expected: &urr{
+				urrID:          7,
+				measureMethod:  measureVolume,
+				reportTriggers: reportPeriodic,
+				measurePeriod:  30,
+				fseID:          FSEID,
+			},
+			description: "Valid Update URR input with measurement period",
+		},
+		{
+			input: ie.NewCreateURR(
+				ie.NewURRID(8),
+				ie.NewMeasurementMethod(1, 0, 0),
+				ie.NewReportingTriggers(reportStartOfTraffic|reportStopOfTraffic),
+				ie.NewInactivityDetectionTime(20),
+			),
+			expected: &urr{
+				urrID:          8,
+				measureMethod:  measureEvent,
+				reportTriggers: reportStartOfTraffic | reportStopOfTraffic,
+				inactivityTime: 20,
+				fseID:          FSEID,
+			},
+			description: "Valid Create URR input with start and stop of traffic",
+		},
+	} {
+		t.Run(scenario.description, func(t *testing.T) {
+			mockURR := &urr{}
+
+			err := mockURR.parseURR(scenario.input, FSEID)
+			require.NoError(t, err)
+
+			assert.Equal(t, scenario.expected, mockURR)
+		})
+	}
+}
+
+func TestParseURRShouldError(t *testing.T) {
+	mockURR := &urr{}
+
+	err := mockURR.parseURR(ie.NewCreateURR(ie.NewMeasurementMethod(0, 1, 0)), 100)
+	require.Error(t, err)
+	assert.Equal(t, &urr{}, mockURR)
+}
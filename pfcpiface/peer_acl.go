@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// peerACL lists the CP nodes allowed to set up a PFCP association, by IP, CIDR or
+// host name. Host names are resolved at each association setup, following DNS changes.
+// A nil peerACL allows all CP nodes.
+type peerACL struct {
+	nets      []*net.IPNet
+	hostnames []string
+}
+
+// newPeerACL returns the ACL of entries, validated by validateConf, nil if empty.
+func newPeerACL(entries []string) *peerACL {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	acl := &peerACL{}
+
+	for _, entry := range entries {
+		if ipNet, ok := parsePeerNet(entry); ok {
+			acl.nets = append(acl.nets, ipNet)
+		} else {
+			acl.hostnames = append(acl.hostnames, entry)
+		}
+	}
+
+	return acl
+}
+
+// parsePeerNet parses an IP or CIDR entry, an IP being a network of one address.
+func parsePeerNet(entry string) (*net.IPNet, bool) {
+	if strings.Contains(entry, "/") {
+		_, ipNet, err := net.ParseCIDR(entry)
+		return ipNet, err == nil
+	}
+
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, false
+	}
+
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, true
+}
+
+// validPeerACLEntry reports whether entry is an IP, a CIDR or can be a host name.
+func validPeerACLEntry(entry string) bool {
+	if _, ok := parsePeerNet(entry); ok {
+		return true
+	}
+
+	return entry != "" && !strings.ContainsAny(entry, "/: \t\n")
+}
+
+func (a *peerACL) allows(ip net.IP) bool {
+	if a == nil {
+		return true
+	}
+
+	for _, ipNet := range a.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	for _, hostname := range a.hostnames {
+		addrs, err := net.LookupHost(hostname)
+		if err != nil {
+			log.Warnln("Failed to resolve allowed peer", hostname, err)
+			continue
+		}
+
+		for _, addr := range addrs {
+			if net.ParseIP(addr).Equal(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (u *upf) getPeerACL() *peerACL {
+	u.reloadLock.RLock()
+	defer u.reloadLock.RUnlock()
+
+	return u.peerACL
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+func Test_peerACL(t *testing.T) {
+	t.Run("nil allows all", func(t *testing.T) {
+		require.Nil(t, newPeerACL(nil))
+		require.True(t, newPeerACL(nil).allows(net.ParseIP("198.18.0.1")))
+	})
+
+	acl := newPeerACL([]string{"198.18.0.0/24", "198.19.0.1", "2001:db8::1", "localhost"})
+
+	for ip, allowed := range map[string]bool{
+		"198.18.0.10": true,
+		"198.18.1.10": false,
+		"198.19.0.1":  true,
+		"198.19.0.2":  false,
+		"2001:db8::1": true,
+		"2001:db8::2": false,
+		"127.0.0.1":   true,
+	} {
+		require.Equal(t, allowed, acl.allows(net.ParseIP(ip)), ip)
+	}
+
+	for entry, valid := range map[string]bool{
+		"198.18.0.0/24": true,
+		"2001:db8::1":   true,
+		"smf.5gc":       true,
+		"198.18.0.0/33": false,
+		"smf:8805":      false,
+		"":              false,
+	} {
+		require.Equal(t, valid, validPeerACLEntry(entry), entry)
+	}
+}
+
+func TestPFCPConn_handleAssociationSetupRequest(t *testing.T) {
+	cp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+
+	defer cp.Close()
+
+	conn, err := net.Dial("udp", cp.LocalAddr().String())
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	f := &fakeDatapath{}
+	f.SetUpfInfo(&upf{}, &Conf{})
+
+	u := &upf{datapath: f, peerACL: newPeerACL([]string{"198.18.0.0/24"})}
+	pConn := &PFCPConn{Conn: conn, upf: u}
+	pConn.nodeID.localIE = ie.NewNodeID("198.18.0.1", "", "")
+
+	asreq := message.NewAssociationSetupRequest(1, ie.NewNodeID("", "", "smf"),
+		ie.NewRecoveryTimeStamp(time.Now()))
+
+	reply, err := pConn.handleAssociationSetupRequest(asreq)
+	require.ErrorIs(t, err, errPeerNotAllowed)
+
+	cause, err := reply.(*message.AssociationSetupResponse).Cause.Cause()
+	require.NoError(t, err)
+	require.Equal(t, ie.CauseRequestRejected, cause)
+	require.Empty(t, pConn.nodeID.remote)
+
+	u.peerACL = newPeerACL([]string{"127.0.0.0/8"})
+
+	reply, err = pConn.handleAssociationSetupRequest(asreq)
+	require.NoError(t, err)
+
+	cause, err = reply.(*message.AssociationSetupResponse).Cause.Cause()
+	require.NoError(t, err)
+	require.Equal(t, ie.CauseRequestAccepted, cause)
+	require.Equal(t, "smf", pConn.nodeID.remote)
+}
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Strategies of the backoff of the response timeout between the retransmissions of a
+// request.
+const (
+	backoffFixed             = "fixed"
+	backoffExponential       = "exponential"
+	backoffExponentialJitter = "exponential_jitter"
+)
+
+// adaptiveTimers bound the response timeout and heartbeat interval derived from the
+// round-trip times measured to a CP node.
+type adaptiveTimers struct {
+	minRespTimeout time.Duration
+	maxRespTimeout time.Duration
+	minHBInterval  time.Duration
+	maxHBInterval  time.Duration
+}
+
+// rttEstimator smooths the round-trip times measured to a CP node, as TCP does in
+// RFC 6298, to derive the retransmission timeout of the requests sent to it.
+type rttEstimator struct {
+	mu     sync.Mutex
+	srtt   time.Duration
+	rttvar time.Duration
+}
+
+// sample records the round-trip time of a request answered without retransmission,
+// those of retransmitted requests being ambiguous.
+func (e *rttEstimator) sample(rtt time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.srtt == 0 {
+		e.srtt = rtt
+		e.rttvar = rtt / 2
+
+		return
+	}
+
+	delta := e.srtt - rtt
+	if delta < 0 {
+		delta = -delta
+	}
+
+	e.rttvar = (3*e.rttvar + delta) / 4
+	e.srtt = (7*e.srtt + rtt) / 8
+}
+
+// smoothed returns the smoothed round-trip time, zero before the first sample.
+func (e *rttEstimator) smoothed() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.srtt
+}
+
+// respTimeout returns the timeout of the first transmission of a request, the
+// configured one until a round-trip time was measured.
+func (e *rttEstimator) respTimeout(timers pfcpTimers) time.Duration {
+	if timers.adaptive == nil {
+		return timers.respTimeout
+	}
+
+	e.mu.Lock()
+	rto := e.srtt + 4*e.rttvar
+	e.mu.Unlock()
+
+	if rto == 0 {
+		rto = timers.respTimeout
+	}
+
+	return clampDuration(rto, timers.adaptive.minRespTimeout, timers.adaptive.maxRespTimeout)
+}
+
+// hbInterval returns the heartbeat interval, scaled from the configured one as the
+// response timeout is from the configured one. Slow or lossy paths are probed less
+// often, leaving more time to the retransmissions of each heartbeat.
+func (e *rttEstimator) hbInterval(timers pfcpTimers) time.Duration {
+	if timers.adaptive == nil || timers.respTimeout == 0 {
+		return timers.hbInterval
+	}
+
+	scale := float64(e.respTimeout(timers)) / float64(timers.respTimeout)
+
+	return clampDuration(time.Duration(scale*float64(timers.hbInterval)),
+		timers.adaptive.minHBInterval, timers.adaptive.maxHBInterval)
+}
+
+// backoff returns the timeout of the retransmission following a timeout of d. Timeouts
+// doubled, randomly by 1 to 2 with jitter, so that peers recovering from a common
+// outage do not retransmit in step, are bounded by the adaptive ones if adaptive.
+func backoff(d time.Duration, timers pfcpTimers) time.Duration {
+	switch timers.backoff {
+	case backoffExponential:
+		d *= 2
+	case backoffExponentialJitter:
+		d += time.Duration(rand.Int63n(int64(d) + 1))
+	default:
+		return d
+	}
+
+	if timers.adaptive != nil {
+		return clampDuration(d, timers.adaptive.minRespTimeout, timers.adaptive.maxRespTimeout)
+	}
+
+	return clampDuration(d, timers.respTimeout, timers.maxBackoffTimeout())
+}
+
+// maxBackoffTimeout returns the bound of the backed off timeouts when not adaptive,
+// never below the response timeout, which peers may override.
+func (t pfcpTimers) maxBackoffTimeout() time.Duration {
+	if t.maxRespTimeout >= t.respTimeout {
+		return t.maxRespTimeout
+	}
+
+	if t.maxRespTimeout > 0 {
+		return t.respTimeout
+	}
+
+	return adaptiveHBMaxFactor * t.respTimeout
+}
+
+func clampDuration(d, min, max time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+
+	if d > max {
+		return max
+	}
+
+	return d
+}
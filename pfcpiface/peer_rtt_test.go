@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_rttEstimator(t *testing.T) {
+	timers := pfcpTimers{
+		respTimeout: 2 * time.Second,
+		hbInterval:  5 * time.Second,
+		backoff:     backoffExponential,
+		adaptive: &adaptiveTimers{
+			minRespTimeout: 500 * time.Millisecond,
+			maxRespTimeout: 8 * time.Second,
+			minHBInterval:  5 * time.Second,
+			maxHBInterval:  20 * time.Second,
+		},
+	}
+
+	t.Run("configured timers are used until an RTT is measured", func(t *testing.T) {
+		var e rttEstimator
+
+		require.Equal(t, 2*time.Second, e.respTimeout(timers))
+		require.Equal(t, 5*time.Second, e.hbInterval(timers))
+	})
+
+	t.Run("timers are fixed when not adaptive", func(t *testing.T) {
+		var e rttEstimator
+		e.sample(3 * time.Second)
+
+		fixed := timers
+		fixed.adaptive = nil
+		fixed.backoff = backoffFixed
+
+		require.Equal(t, 2*time.Second, e.respTimeout(fixed))
+		require.Equal(t, 5*time.Second, e.hbInterval(fixed))
+		require.Equal(t, 2*time.Second, backoff(2*time.Second, fixed))
+	})
+
+	t.Run("timers follow the measured RTT within bounds", func(t *testing.T) {
+		var e rttEstimator
+
+		e.sample(time.Second)
+		require.Equal(t, time.Second, e.smoothed())
+		require.Equal(t, 3*time.Second, e.respTimeout(timers))
+		require.Equal(t, 7500*time.Millisecond, e.hbInterval(timers))
+
+		for i := 0; i < 50; i++ {
+			e.sample(10 * time.Millisecond)
+		}
+
+		require.Equal(t, 500*time.Millisecond, e.respTimeout(timers))
+		require.Equal(t, 5*time.Second, e.hbInterval(timers))
+
+		for i := 0; i < 50; i++ {
+			e.sample(10 * time.Second)
+		}
+
+		require.Equal(t, 8*time.Second, e.respTimeout(timers))
+		require.Equal(t, 20*time.Second, e.hbInterval(timers))
+	})
+
+	t.Run("retransmissions back off up to the maximum", func(t *testing.T) {
+		require.Equal(t, 6*time.Second, backoff(3*time.Second, timers))
+		require.Equal(t, 8*time.Second, backoff(6*time.Second, timers))
+	})
+}
+
+func Test_backoff(t *testing.T) {
+	timers := pfcpTimers{respTimeout: 2 * time.Second}
+
+	t.Run("fixed", func(t *testing.T) {
+		timers := timers
+		timers.backoff = backoffFixed
+
+		require.Equal(t, 2*time.Second, backoff(2*time.Second, timers))
+	})
+
+	t.Run("exponential up to 4 × resp_timeout by default", func(t *testing.T) {
+		timers := timers
+		timers.backoff = backoffExponential
+
+		require.Equal(t, 4*time.Second, backoff(2*time.Second, timers))
+		require.Equal(t, 8*time.Second, backoff(4*time.Second, timers))
+		require.Equal(t, 8*time.Second, backoff(8*time.Second, timers))
+	})
+
+	t.Run("exponential up to max_timeout", func(t *testing.T) {
+		timers := timers
+		timers.backoff = backoffExponential
+		timers.maxRespTimeout = 5 * time.Second
+
+		require.Equal(t, 4*time.Second, backoff(2*time.Second, timers))
+		require.Equal(t, 5*time.Second, backoff(4*time.Second, timers))
+	})
+
+	t.Run("exponential with jitter", func(t *testing.T) {
+		timers := timers
+		timers.backoff = backoffExponentialJitter
+		timers.maxRespTimeout = time.Minute
+
+		for i := 0; i < 100; i++ {
+			d := backoff(2*time.Second, timers)
+			require.GreaterOrEqual(t, int64(d), int64(2*time.Second))
+			require.LessOrEqual(t, int64(d), int64(4*time.Second))
+		}
+	})
+}
@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"sync"
+
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+const (
+	// maxPFCPMsgSize is the maximum UDP payload size.
+	maxPFCPMsgSize = 65507
+	// pfcpBufSize is the size of the pooled buffers, larger messages are allocated.
+	pfcpBufSize = 4096
+)
+
+// pfcpBufs pools the buffers of the PFCP messages received and sent, so that steady
+// traffic does not allocate a buffer per message.
+var pfcpBufs = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, pfcpBufSize)
+		return &b
+	},
+}
+
+// getPFCPBuf returns a buffer of n bytes, pooled unless larger than pfcpBufSize.
+// It is returned to the pool with putPFCPBuf.
+func getPFCPBuf(n int) *[]byte {
+	if n > pfcpBufSize {
+		b := make([]byte, n)
+		return &b
+	}
+
+	b := pfcpBufs.Get().(*[]byte)
+	*b = (*b)[:n]
+
+	return b
+}
+
+func putPFCPBuf(b *[]byte) {
+	if cap(*b) != pfcpBufSize {
+		return
+	}
+
+	*b = (*b)[:pfcpBufSize]
+	pfcpBufs.Put(b)
+}
+
+// retainsPFCPBuf reports whether a message of type msgType is still used once
+// handled, by the request it answers, so that its buffer cannot be reused.
+func retainsPFCPBuf(msgType uint8) bool {
+	switch msgType {
+	case message.MsgTypeAssociationSetupResponse, message.MsgTypeAssociationUpdateResponse,
+		message.MsgTypeHeartbeatResponse, message.MsgTypeNodeReportResponse:
+		return true
+	}
+
+	return false
+}
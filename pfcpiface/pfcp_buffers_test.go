@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+func Test_getPFCPBuf(t *testing.T) {
+	b := getPFCPBuf(100)
+	require.Len(t, *b, 100)
+	require.Equal(t, pfcpBufSize, cap(*b))
+	putPFCPBuf(b)
+
+	large := getPFCPBuf(pfcpBufSize + 1)
+	require.Len(t, *large, pfcpBufSize+1)
+	putPFCPBuf(large)
+
+	require.True(t, retainsPFCPBuf(message.MsgTypeHeartbeatResponse))
+	require.False(t, retainsPFCPBuf(message.MsgTypeSessionModificationRequest))
+}
+
+func Test_pfcpBufs_allocations(t *testing.T) {
+	n := message.NewHeartbeatResponse(1, ie.NewRecoveryTimeStamp(time.Now())).MarshalLen()
+
+	// The pool may be emptied by a garbage collection, so allow some allocations.
+	allocs := testing.AllocsPerRun(100, func() {
+		putPFCPBuf(getPFCPBuf(n))
+	})
+	require.Less(t, allocs, 1.0)
+}
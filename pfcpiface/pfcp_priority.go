@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"sync"
+
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+// pfcpRecvQueueSize is the number of received messages queued behind the one being
+// handled, reading from the PFCP connection blocks once the queue is full.
+const pfcpRecvQueueSize = 1024
+
+// isPriorityPFCPMsg reports whether the undecoded message buf is a heartbeat. Heartbeats
+// are handled, and answered, as they are received, ahead of the queued messages, so
+// that a burst of session requests does not trip the heartbeat timeout of the CP node,
+// nor ours.
+func isPriorityPFCPMsg(buf []byte) bool {
+	if len(buf) < 2 {
+		return false
+	}
+
+	switch buf[1] {
+	case message.MsgTypeHeartbeatRequest, message.MsgTypeHeartbeatResponse:
+		return true
+	}
+
+	return false
+}
+
+// pfcpRecvQueue queues the messages received on a PFCP connection other than the
+// heartbeats, which are handled by the reader, for a single goroutine to handle them
+// in order.
+type pfcpRecvQueue struct {
+	handle   func(buf []byte, pooled *[]byte)
+	queue    chan pfcpRecv
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// pfcpRecv is a received message, with its pooled buffer if any, or a function to call
+// in order with the messages.
+type pfcpRecv struct {
+	buf    []byte
+	pooled *[]byte
+	fn     func()
+}
+
+func newPFCPRecvQueue(handle func(buf []byte, pooled *[]byte)) *pfcpRecvQueue {
+	return &pfcpRecvQueue{
+		handle: handle,
+		queue:  make(chan pfcpRecv, pfcpRecvQueueSize),
+		stop:   make(chan struct{}),
+	}
+}
+
+// run handles the queued messages until the queue is closed.
+func (q *pfcpRecvQueue) run() {
+	for {
+		select {
+		case <-q.stop:
+			return
+		case recv := <-q.queue:
+			if recv.fn != nil {
+				recv.fn()
+				continue
+			}
+
+			q.handle(recv.buf, recv.pooled)
+		}
+	}
+}
+
+// receive handles buf right away if it is a heartbeat, or queues it. It blocks while
+// the queue is full.
+func (q *pfcpRecvQueue) receive(buf []byte, pooled *[]byte) {
+	if isPriorityPFCPMsg(buf) {
+		q.handle(buf, pooled)
+		return
+	}
+
+	select {
+	case <-q.stop:
+	case q.queue <- pfcpRecv{buf: buf, pooled: pooled}:
+	}
+}
+
+// do queues fn, called once the messages queued before are handled. It blocks while
+// the queue is full.
+func (q *pfcpRecvQueue) do(fn func()) {
+	select {
+	case <-q.stop:
+	case q.queue <- pfcpRecv{fn: fn}:
+	}
+}
+
+// close stops handling the messages, queued messages are dropped.
+func (q *pfcpRecvQueue) close() {
+	q.stopOnce.Do(func() { close(q.stop) })
+}
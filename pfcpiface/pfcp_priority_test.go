@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+func marshalPFCP(t *testing.T, msg message.Message) []byte {
+	buf := make([]byte, msg.MarshalLen())
+	require.NoError(t, msg.MarshalTo(buf))
+
+	return buf
+}
+
+func Test_isPriorityPFCPMsg(t *testing.T) {
+	hbreq := message.NewHeartbeatRequest(1, ie.NewRecoveryTimeStamp(time.Now()), nil)
+	hbres := message.NewHeartbeatResponse(1, ie.NewRecoveryTimeStamp(time.Now()))
+	sdreq := message.NewSessionDeletionRequest(0, 0, 1, 2, 0)
+
+	require.True(t, isPriorityPFCPMsg(marshalPFCP(t, hbreq)))
+	require.True(t, isPriorityPFCPMsg(marshalPFCP(t, hbres)))
+	require.False(t, isPriorityPFCPMsg(marshalPFCP(t, sdreq)))
+	require.False(t, isPriorityPFCPMsg([]byte{0x20}))
+}
+
+func TestPFCPRecvQueue(t *testing.T) {
+	release := make(chan struct{})
+	handled := make(chan uint8, 16)
+
+	q := newPFCPRecvQueue(func(buf []byte, pooled *[]byte) {
+		if buf[1] == message.MsgTypeSessionDeletionRequest {
+			<-release
+		}
+
+		handled <- buf[1]
+	})
+
+	go q.run()
+	t.Cleanup(q.close)
+
+	sdreq := marshalPFCP(t, message.NewSessionDeletionRequest(0, 0, 1, 2, 0))
+	for i := 0; i < 3; i++ {
+		q.receive(sdreq, nil)
+	}
+
+	// The heartbeat is answered while the session requests are stuck.
+	q.receive(marshalPFCP(t, message.NewHeartbeatRequest(3, ie.NewRecoveryTimeStamp(time.Now()), nil)), nil)
+	require.Equal(t, message.MsgTypeHeartbeatRequest, <-handled)
+
+	// Functions queued by the heartbeat are called after the queued messages.
+	q.do(func() { handled <- 0 })
+
+	close(release)
+
+	for i := 0; i < 3; i++ {
+		require.Equal(t, message.MsgTypeSessionDeletionRequest, <-handled)
+	}
+
+	require.Equal(t, uint8(0), <-handled)
+}
+
+func TestPFCPConn_updateRemoteRecoveryTS(t *testing.T) {
+	conn, err := net.Dial("udp", "127.0.0.1:8805")
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	pConn := &PFCPConn{Conn: conn, upf: &upf{}, store: NewInMemoryStore()}
+	now := time.Now()
+
+	pConn.updateRemoteRecoveryTS(now)
+	require.Equal(t, now, pConn.ts.getRemote())
+
+	pConn.updateRemoteRecoveryTS(now.Add(-time.Second))
+	require.Equal(t, now, pConn.ts.getRemote(), "older timestamps are ignored")
+
+	pConn.updateRemoteRecoveryTS(now.Add(time.Second))
+	require.Equal(t, now.Add(time.Second), pConn.ts.getRemote(), "restarted peer")
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+// pfcpTrace keeps the last messages exchanged with a peer in a ring buffer. They
+// are only decoded when read, to keep tracing cheap.
+type pfcpTrace struct {
+	mu      sync.Mutex
+	entries []pfcpTraceEntry
+	// next is the index of the entry to overwrite once the buffer is full.
+	next int
+}
+
+type pfcpTraceEntry struct {
+	time     time.Time
+	outgoing bool
+	raw      []byte
+}
+
+func newPFCPTrace(size int) *pfcpTrace {
+	return &pfcpTrace{entries: make([]pfcpTraceEntry, 0, size)}
+}
+
+// record traces the message in b, which is copied. Nothing is traced on a nil trace.
+func (t *pfcpTrace) record(outgoing bool, b []byte) {
+	if t == nil {
+		return
+	}
+
+	entry := pfcpTraceEntry{time: time.Now(), outgoing: outgoing, raw: append([]byte(nil), b...)}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.entries) < cap(t.entries) {
+		t.entries = append(t.entries, entry)
+		return
+	}
+
+	t.entries[t.next] = entry
+	t.next = (t.next + 1) % len(t.entries)
+}
+
+// messages returns the traced messages decoded, oldest first.
+func (t *pfcpTrace) messages() []pfcpTraceMsg {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	entries := append(append([]pfcpTraceEntry{}, t.entries[t.next:]...), t.entries[:t.next]...)
+	t.mu.Unlock()
+
+	msgs := make([]pfcpTraceMsg, 0, len(entries))
+	for _, e := range entries {
+		msgs = append(msgs, e.decode())
+	}
+
+	return msgs
+}
+
+// pfcpTraceMsg is a traced message, as served by /v1/debug/pfcp-trace.
+type pfcpTraceMsg struct {
+	Time      time.Time     `json:"time"`
+	Direction string        `json:"direction"`
+	Type      string        `json:"type"`
+	Sequence  uint32        `json:"sequence"`
+	SEID      *uint64       `json:"seid,omitempty"`
+	IEs       []pfcpTraceIE `json:"ies,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// pfcpTraceIE is an IE of a traced message, with the IEs it groups or its value in hex.
+type pfcpTraceIE struct {
+	Type  uint16        `json:"type"`
+	Value string        `json:"value,omitempty"`
+	IEs   []pfcpTraceIE `json:"ies,omitempty"`
+}
+
+func (e pfcpTraceEntry) decode() pfcpTraceMsg {
+	m := pfcpTraceMsg{Time: e.time, Direction: "in"}
+	if e.outgoing {
+		m.Direction = "out"
+	}
+
+	h, err := message.ParseHeader(e.raw)
+	if err != nil {
+		m.Error = err.Error()
+		return m
+	}
+
+	m.Type = fmt.Sprintf("unknown (%d)", h.Type)
+	m.Sequence = h.SequenceNumber
+
+	if h.HasSEID() {
+		seid := h.SEID
+		m.SEID = &seid
+	}
+
+	if msg, err := message.Parse(e.raw); err == nil {
+		m.Type = msg.MessageTypeName()
+	} else {
+		m.Error = err.Error()
+	}
+
+	ies, err := ie.ParseMultiIEs(h.Payload)
+	if err != nil {
+		m.Error = err.Error()
+		return m
+	}
+
+	m.IEs = newPFCPTraceIEs(ies)
+
+	return m
+}
+
+func newPFCPTraceIEs(ies []*ie.IE) []pfcpTraceIE {
+	traced := make([]pfcpTraceIE, 0, len(ies))
+
+	for _, i := range ies {
+		t := pfcpTraceIE{Type: i.Type}
+
+		if i.IsGrouped() {
+			t.IEs = newPFCPTraceIEs(i.ChildIEs)
+		} else {
+			t.Value = hex.EncodeToString(i.Payload)
+		}
+
+		traced = append(traced, t)
+	}
+
+	return traced
+}
+
+// pfcpTraceHandler serves the traced messages of each peer, by peer address:
+//
+//	GET /v1/debug/pfcp-trace             the messages of all the peers
+//	GET /v1/debug/pfcp-trace?peer=<ip>   the messages of the peers with that address or node ID
+type pfcpTraceHandler struct {
+	node *PFCPNode
+}
+
+func (h *pfcpTraceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	peer := r.URL.Query().Get("peer")
+	traces := make(map[string][]pfcpTraceMsg)
+
+	h.node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+		addr := key.(string)
+		host, _, _ := net.SplitHostPort(addr)
+
+		if peer == "" || peer == addr || peer == host || peer == pConn.nodeID.remote {
+			traces[addr] = pConn.trace.messages()
+		}
+
+		return true
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(traces); err != nil {
+		log.Errorln("Failed to encode PFCP trace:", err)
+	}
+}
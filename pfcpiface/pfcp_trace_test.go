@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+func Test_pfcpTrace(t *testing.T) {
+	trace := newPFCPTrace(2)
+
+	for seq := uint32(1); seq <= 3; seq++ {
+		trace.record(seq == 2, mustMarshal(t, message.NewHeartbeatRequest(seq, ie.NewRecoveryTimeStamp(time.Now()), nil)))
+	}
+
+	msgs := trace.messages()
+	require.Len(t, msgs, 2)
+	require.Equal(t, uint32(2), msgs[0].Sequence, "oldest first")
+	require.Equal(t, "out", msgs[0].Direction)
+	require.Equal(t, uint32(3), msgs[1].Sequence)
+	require.Equal(t, "in", msgs[1].Direction)
+	require.Equal(t, "Heartbeat Request", msgs[1].Type)
+	require.Nil(t, msgs[1].SEID)
+	require.Len(t, msgs[1].IEs, 1)
+	require.Equal(t, ie.RecoveryTimeStamp, msgs[1].IEs[0].Type)
+
+	t.Run("session messages are decoded with their SEID and grouped IEs", func(t *testing.T) {
+		smreq := message.NewSessionModificationRequest(0, 0, 7, 4, 0,
+			ie.NewUpdateFAR(ie.NewFARID(2), ie.NewApplyAction(0x2)))
+		trace.record(false, mustMarshal(t, smreq))
+
+		msg := trace.messages()[1]
+		require.NotNil(t, msg.SEID)
+		require.Equal(t, uint64(7), *msg.SEID)
+		require.Equal(t, ie.UpdateFAR, msg.IEs[0].Type)
+		require.Equal(t, []pfcpTraceIE{{Type: ie.FARID, Value: "00000002"}, {Type: ie.ApplyAction, Value: "02"}}, msg.IEs[0].IEs)
+	})
+
+	t.Run("undecodable messages are kept", func(t *testing.T) {
+		trace.record(false, []byte{0x20, 0x01})
+		require.NotEmpty(t, trace.messages()[1].Error)
+	})
+
+	var disabled *pfcpTrace
+	disabled.record(true, []byte{0x20})
+	require.Nil(t, disabled.messages())
+}
+
+func Test_pfcpTraceHandler(t *testing.T) {
+	node := &PFCPNode{}
+	traced := &PFCPConn{trace: newPFCPTrace(4)}
+	traced.nodeID.remote = "smf.example.org"
+	traced.trace.record(false, mustMarshal(t, message.NewHeartbeatRequest(1, ie.NewRecoveryTimeStamp(time.Now()), nil)))
+	node.pConns.Store("198.18.0.2:8805", traced)
+	node.pConns.Store("198.18.0.3:8805", &PFCPConn{})
+
+	get := func(query string) map[string][]pfcpTraceMsg {
+		rec := httptest.NewRecorder()
+		(&pfcpTraceHandler{node: node}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/debug/pfcp-trace"+query, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var traces map[string][]pfcpTraceMsg
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&traces))
+
+		return traces
+	}
+
+	traces := get("")
+	require.Len(t, traces, 2)
+	require.Len(t, traces["198.18.0.2:8805"], 1)
+	require.Empty(t, traces["198.18.0.3:8805"])
+
+	require.Len(t, get("?peer=198.18.0.2"), 1)
+	require.Len(t, get("?peer=smf.example.org")["198.18.0.2:8805"], 1)
+	require.Empty(t, get("?peer=198.18.0.4"))
+}
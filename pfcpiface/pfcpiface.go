@@ -12,13 +12,11 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"os"
-	"os/signal"
 	"sync"
-	"syscall"
 	"time"
 
 	reuse "github.com/libp2p/go-reuseport"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -32,6 +30,8 @@ func init() {
 
 type PFCPIface struct {
 	conf Conf
+	// confPath is the config file reloaded by ReloadConfigFile, if set.
+	confPath string
 
 	node *PFCPNode
 	fp   datapath
@@ -42,18 +42,40 @@ type PFCPIface struct {
 
 	uc *upfCollector
 	nc *PfcpNodeCollector
+	// pusher pushes the metrics to a Pushgateway, nil unless enabled.
+	pusher *metricsPusher
+
+	// replica replicates the sessions of the active instance or the leader, nil unless
+	// standby or leader election is enabled.
+	replica *replicaClient
+	// elector elects the replica serving N4, nil unless leader election is enabled.
+	elector *leaderElector
+
+	// failed is the error that stopped Run, if any.
+	failed chan error
 
 	mu sync.Mutex
 }
 
-func NewPFCPIface(conf Conf) *PFCPIface {
+// NewPFCPIface creates the PFCP agent of conf, served by Run.
+func NewPFCPIface(conf Conf) (*PFCPIface, error) {
 	pfcpIface := &PFCPIface{
-		conf: conf,
+		conf:   conf,
+		failed: make(chan error, 1),
 	}
 
-	if conf.EnableP4rt {
+	switch {
+	case conf.EnableP4rt:
 		pfcpIface.fp = &UP4{}
-	} else {
+	case conf.Datapath == datapathXDP:
+		pfcpIface.fp = &xdp{}
+	case conf.Datapath == datapathGTP:
+		pfcpIface.fp = &gtpKernel{}
+	case conf.Datapath == datapathFake:
+		log.Warnln("Using the fake datapath, no traffic will be forwarded")
+
+		pfcpIface.fp = &fakeDatapath{}
+	default:
 		pfcpIface.fp = &bess{}
 	}
 
@@ -64,67 +86,183 @@ func NewPFCPIface(conf Conf) *PFCPIface {
 
 	pfcpIface.httpEndpoint = ":" + httpPort
 
-	pfcpIface.upf = NewUPF(&conf, pfcpIface.fp)
+	u, err := NewUPF(&conf, pfcpIface.fp)
+	if err != nil {
+		return nil, err
+	}
+
+	pfcpIface.upf = u
+
+	if conf.HA.Role == haRoleStandby {
+		pfcpIface.replica = newReplicaClient(conf.HA)
+	}
+
+	if conf.LeaderElection.Enable {
+		// Run stops so that another replica takes over.
+		elector, err := newLeaderElector(conf.LeaderElection, httpPort, func() {
+			pfcpIface.fail(errLeadershipLost)
+			pfcpIface.node.Stop()
+		})
+		if err != nil {
+			return nil, fmt.Errorf("leader election init failed: %w", err)
+		}
+
+		pfcpIface.elector = elector
+		pfcpIface.replica = newReplicaClient(HAInfo{})
+	}
 
-	return pfcpIface
+	return pfcpIface, nil
 }
 
-func (p *PFCPIface) mustInit() {
+func (p *PFCPIface) init() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	p.node = NewPFCPNode(p.upf, &p.conf)
-	httpMux := http.NewServeMux()
+	node, err := NewPFCPNode(p.upf, &p.conf)
+	if err != nil {
+		return err
+	}
 
-	setupConfigHandler(httpMux, p.upf)
+	p.node = node
+	httpMux := http.NewServeMux()
 
-	var err error
+	p.setupAdminHandlers(httpMux)
 
-	p.uc, p.nc, err = setupProm(httpMux, p.upf, p.node)
+	gatherer := newMetricsGatherer(prometheus.DefaultGatherer, p.conf.Metrics)
 
+	p.uc, p.nc, err = setupProm(httpMux, p.upf, p.node, gatherer)
 	if err != nil {
-		log.Fatalln("setupProm failed", err)
+		p.node.Close()
+		p.node.Stop()
+
+		return fmt.Errorf("setupProm failed: %w", err)
+	}
+
+	if p.conf.MetricsPush.Enable {
+		p.pusher = newMetricsPusher(p.conf.MetricsPush, gatherer, p.upf.NodeID)
 	}
 
 	// Note: due to error with golangci-lint ("Error: G112: Potential Slowloris Attack
 	// because ReadHeaderTimeout is not configured in the http.Server (gosec)"),
 	// the ReadHeaderTimeout is set to the same value as in nginx (client_header_timeout)
 	p.httpSrv = &http.Server{Addr: p.httpEndpoint, Handler: httpMux, ReadHeaderTimeout: 60 * time.Second}
+
+	return nil
+}
+
+// setupAdminHandlers registers the handlers of the admin API on mux. The operations
+// of the handlers are described by apiOperations.
+func (p *PFCPIface) setupAdminHandlers(mux *http.ServeMux) {
+	setupConfigHandler(mux, p.upf)
+	mux.Handle("/v1/config", &confHandler{iface: p})
+	mux.Handle("/v1/drain", &drainHandler{node: p.node})
+	mux.Handle("/v1/simulate", &simHandler{iface: p})
+	mux.Handle("/v1/debug/pfcp-trace", &pfcpTraceHandler{node: p.node})
+	mux.Handle("/v1/framed-routes", &framedRoutesHandler{node: p.node})
+	mux.Handle("/v1/sessions", &sessionsHandler{node: p.node})
+	mux.Handle("/v1/sessions/export", &sessionExportHandler{node: p.node})
+	mux.Handle("/v1/sessions/import", &sessionImportHandler{node: p.node})
+	mux.Handle("/v1/associations", &associationsHandler{node: p.node})
+	mux.Handle("/v1/self-test", &selfTestHandler{node: p.node})
+	mux.Handle("/v1/openapi.json", &openAPIHandler{})
+
+	if fake, ok := p.fp.(*fakeDatapath); ok {
+		setupFakeDatapathHandler(mux, fake)
+	}
+
+	if p.upf.enrichment != nil {
+		mux.Handle("/v1/header-enrichment", &headerEnrichmentHandler{node: p.node})
+	}
+
+	if p.node.replication != nil {
+		mux.Handle("/v1/replication", &replicationHandler{node: p.node})
+	}
 }
 
-func (p *PFCPIface) Run() {
+// Run serves N4 until ctx is done or Stop is called. It returns once the agent is
+// stopped, with the error that stopped it if any. Signals are left to the caller.
+func (p *PFCPIface) Run(ctx context.Context) error {
 	if simulate.enable() {
 		p.upf.sim(simulate, &p.conf.SimInfo)
 
 		if !simulate.keepGoing() {
-			return
+			return nil
 		}
 	}
 
-	p.mustInit()
+	if err := p.init(); err != nil {
+		return err
+	}
 
 	go func() {
 		if err := p.httpSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalln("http server failed", err)
+			p.fail(fmt.Errorf("http server failed: %w", err))
+			p.Stop()
+
+			return
 		}
 
 		log.Infoln("http server closed")
 	}()
 
+	if p.pusher != nil {
+		// Run returns once the metrics are pushed a last time.
+		pushed := make(chan struct{})
+
+		go func() {
+			defer close(pushed)
+			p.pusher.run(p.node.ctx)
+		}()
+
+		defer func() { <-pushed }()
+	}
+
 	//http.HandleFunc("/registergw", RegisterGw)
 	//server := http.Server{Addr: ":8082"}
 	//log.Traceln("starting http server on 8082")
 	//go server.ListenAndServe()
 
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt)
-	signal.Notify(sig, syscall.SIGTERM)
+	// Run returns once stopped on ctx, not before.
+	stopped, stopDone := make(chan struct{}), make(chan struct{})
+
+	defer func() {
+		close(stopped)
+		<-stopDone
+	}()
 
 	go func() {
-		oscall := <-sig
-		log.Infof("System call received: %+v", oscall)
-		p.Stop()
+		defer close(stopDone)
+
+		select {
+		case <-ctx.Done():
+			log.Infoln("Stopping:", ctx.Err())
+			p.Stop()
+		case <-stopped:
+		}
 	}()
+
+	// A standby or follower only serves N4 and registers with the load balancers once
+	// it takes over.
+	if p.replica != nil {
+		var takeOver bool
+
+		if p.elector != nil {
+			go p.elector.run(p.node.ctx)
+
+			takeOver = p.replica.waitForLeadership(p.node.ctx, p.elector)
+		} else {
+			takeOver = p.replica.waitForFailover(p.node.ctx)
+		}
+
+		if !takeOver {
+			// Stopped while standby, there is no PFCP connection to wait for.
+			close(p.node.done)
+			return p.runErr()
+		}
+
+		p.node.takeOver(p.replica.replicatedPeers())
+	}
+
 	//fmt.Println("parham log : calling PushPFCPInfo")
 	//lAddr := p.node.LocalAddr().String()
 	//PushPFCPInfo(lAddr)
@@ -140,6 +278,26 @@ func (p *PFCPIface) Run() {
 	p.node.RegisterTolb(exitlb)
 	// blocking
 	p.node.Serve()
+
+	return p.runErr()
+}
+
+// fail records err as the error that stopped Run, the first one only.
+func (p *PFCPIface) fail(err error) {
+	select {
+	case p.failed <- err:
+	default:
+	}
+}
+
+// runErr returns the error that stopped Run, nil if stopped on purpose.
+func (p *PFCPIface) runErr() error {
+	select {
+	case err := <-p.failed:
+		return err
+	default:
+		return nil
+	}
 }
 
 type PfcpInfo struct {
@@ -304,8 +462,13 @@ func (p *PFCPIface) Stop() {
 		log.Errorln("Failed to shutdown http: ", err)
 	}
 
+	// Let the CP nodes know we are leaving instead of waiting for heartbeat timeouts.
+	p.node.ReleaseAssociations()
+
 	p.node.Stop()
 
 	// Wait for PFCP node shutdown
 	p.node.Done()
+
+	p.upf.auditLog.close()
 }
@@ -3,10 +3,24 @@
 
 package pfcpiface
 
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
 // PFD holds the switch level application IDs.
 type appPFD struct {
 	appID     string
 	flowDescs []string
+	// urls and domainNames are stored for reference only, the datapath
+	// cannot classify traffic on them.
+	urls        []string
+	domainNames []string
+}
+
+func (a appPFD) isEmpty() bool {
+	return len(a.flowDescs) == 0 && len(a.urls) == 0 && len(a.domainNames) == 0
 }
 
 // ResetAppPFDs resets the map of application PFDs.
@@ -26,3 +40,165 @@ func (pConn *PFCPConn) NewAppPFD(appID string) {
 func (pConn *PFCPConn) RemoveAppPFD(appID string) {
 	delete(pConn.appPFDs, appID)
 }
+
+// parseAppIDPFDs parses an Application ID's PFDs IE. The returned appPFD is
+// empty if the IE carries no PFD Context, which deletes the PFDs of the application.
+func parseAppIDPFDs(appIDPFDs *ie.IE) (appPFD, error) {
+	id, err := appIDPFDs.ApplicationID()
+	if err != nil {
+		return appPFD{}, err
+	}
+
+	apfd := appPFD{
+		appID:     id,
+		flowDescs: make([]string, 0, MaxItems),
+	}
+
+	children, err := appIDPFDs.ApplicationIDsPFDs()
+	if err != nil {
+		return appPFD{}, err
+	}
+
+	for _, pfdCtx := range children {
+		if pfdCtx.Type != ie.PFDContext {
+			continue
+		}
+
+		contents, err := pfdCtx.PFDContext()
+		if err != nil {
+			return appPFD{}, err
+		}
+
+		for _, pfdContent := range contents {
+			fields, err := pfdContent.PFDContents()
+			if err != nil {
+				return appPFD{}, err
+			}
+
+			if fields.FlowDescription != "" {
+				apfd.flowDescs = append(apfd.flowDescs, fields.FlowDescription)
+			}
+
+			apfd.flowDescs = append(apfd.flowDescs, fields.AdditionalFlowDescription...)
+
+			if fields.URL != "" {
+				apfd.urls = append(apfd.urls, fields.URL)
+			}
+
+			if fields.DomainName != "" {
+				apfd.domainNames = append(apfd.domainNames, fields.DomainName)
+			}
+		}
+	}
+
+	return apfd, nil
+}
+
+// applyPFDMgmtRequest updates the stored PFDs as per 3GPP TS 29.244, clause 6.2.5:
+// a request without Application ID's PFDs deletes all PFDs, an application
+// without PFD Context has its PFDs deleted, otherwise its PFDs are replaced.
+// Returns the IDs of the applications whose PFDs were replaced.
+func (pConn *PFCPConn) applyPFDMgmtRequest(pfdmreq *message.PFDManagementRequest) ([]string, *ie.IE, error) {
+	if len(pfdmreq.ApplicationIDsPFDs) == 0 {
+		log.Infoln("Deleting all application PFDs")
+		pConn.ResetAppPFDs()
+
+		return nil, nil, nil
+	}
+
+	apfds := make([]appPFD, 0, len(pfdmreq.ApplicationIDsPFDs))
+
+	for _, appIDPFDs := range pfdmreq.ApplicationIDsPFDs {
+		apfd, err := parseAppIDPFDs(appIDPFDs)
+		if err != nil {
+			return nil, appIDPFDs, err
+		}
+
+		apfds = append(apfds, apfd)
+	}
+
+	replaced := make([]string, 0, len(apfds))
+
+	for _, apfd := range apfds {
+		if apfd.isEmpty() {
+			log.Infoln("Deleting PFDs of AppID", apfd.appID)
+			pConn.RemoveAppPFD(apfd.appID)
+
+			continue
+		}
+
+		if len(apfd.flowDescs) == 0 {
+			log.Warnln("AppID", apfd.appID, "has no flow description; URLs", apfd.urls,
+				"and domain names", apfd.domainNames, "cannot be enforced by the datapath")
+		}
+
+		pConn.appPFDs[apfd.appID] = apfd
+		replaced = append(replaced, apfd.appID)
+
+		log.Traceln("Flow descriptions for AppID", apfd.appID, ":", apfd.flowDescs)
+	}
+
+	return replaced, nil, nil
+}
+
+// recompileAppPDRs rebuilds the application filter of the installed PDRs that
+// reference one of appIDs and pushes the changed PDRs to the datapath.
+func (pConn *PFCPConn) recompileAppPDRs(appIDs []string) {
+	if len(appIDs) == 0 {
+		return
+	}
+
+	replaced := make(map[string]struct{}, len(appIDs))
+	for _, id := range appIDs {
+		replaced[id] = struct{}{}
+	}
+
+	for _, session := range pConn.store.GetAllSessions() {
+		updated := PacketForwardingRules{}
+
+		for _, p := range session.pdrs {
+			if _, ok := replaced[p.appID]; !ok {
+				continue
+			}
+
+			prev := p.appFilter
+
+			p.resetAppFilter()
+
+			if err := p.applyAppPFD(pConn.appPFDs[p.appID]); err != nil {
+				log.Warnln("Failed to recompile", p, ":", err)
+				continue
+			}
+
+			if p.appFilter == prev {
+				continue
+			}
+
+			if err := session.UpdatePDR(p); err != nil {
+				log.Warnln("Failed to update", p, ":", err)
+				continue
+			}
+
+			updated.pdrs = append(updated.pdrs, p)
+		}
+
+		if len(updated.pdrs) == 0 {
+			continue
+		}
+
+		cause := pConn.writeRules(datapathWrite{
+			fseid:   session.localSEID,
+			method:  upfMsgTypeMod,
+			all:     session.PacketForwardingRules,
+			updated: updated,
+		})
+		if cause == ie.CauseRequestRejected {
+			log.Errorln("Failed to write recompiled PDRs of session", session.localSEID, "to datapath")
+			continue
+		}
+
+		if err := pConn.store.PutSession(session, pConn, false, message.MsgTypePFDManagementRequest); err != nil {
+			log.Errorln("Failed to store session", session.localSEID, ":", err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"math"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+func newAppIDPFDs(appID string, contents ...*ie.IE) *ie.IE {
+	if len(contents) == 0 {
+		return ie.NewApplicationIDsPFDs(ie.NewApplicationID(appID))
+	}
+
+	return ie.NewApplicationIDsPFDs(ie.NewApplicationID(appID), ie.NewPFDContext(contents...))
+}
+
+func Test_parseAppIDPFDs(t *testing.T) {
+	t.Run("flow descriptions and URL", func(t *testing.T) {
+		apfd, err := parseAppIDPFDs(newAppIDPFDs("app1",
+			ie.NewPFDContents("permit out ip from 6.6.6.6/32 to assigned", "", "", "", "", nil, nil, nil),
+			ie.NewPFDContents("", "http://example.org", "", "", "", nil, nil, nil),
+			ie.NewPFDContents("", "", "example.org", "", "", nil, nil, nil),
+		))
+		require.NoError(t, err)
+		require.Equal(t, "app1", apfd.appID)
+		require.Equal(t, []string{"permit out ip from 6.6.6.6/32 to assigned"}, apfd.flowDescs)
+		require.Equal(t, []string{"http://example.org"}, apfd.urls)
+		require.Equal(t, []string{"example.org"}, apfd.domainNames)
+	})
+
+	t.Run("no PFD context", func(t *testing.T) {
+		apfd, err := parseAppIDPFDs(newAppIDPFDs("app1"))
+		require.NoError(t, err)
+		require.True(t, apfd.isEmpty())
+	})
+
+	t.Run("missing Application ID", func(t *testing.T) {
+		_, err := parseAppIDPFDs(ie.NewApplicationIDsPFDs())
+		require.Error(t, err)
+	})
+}
+
+func TestPFCPConn_applyPFDMgmtRequest(t *testing.T) {
+	flowDesc := ie.NewPFDContents("permit out ip from 6.6.6.6/32 to assigned", "", "", "", "", nil, nil, nil)
+
+	pConn := &PFCPConn{}
+	pConn.ResetAppPFDs()
+
+	replaced, _, err := pConn.applyPFDMgmtRequest(message.NewPFDManagementRequest(1,
+		newAppIDPFDs("app1", flowDesc), newAppIDPFDs("app2", flowDesc)))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"app1", "app2"}, replaced)
+	require.Len(t, pConn.appPFDs, 2)
+
+	// An application without PFD Context has its PFDs deleted, others are kept.
+	replaced, _, err = pConn.applyPFDMgmtRequest(message.NewPFDManagementRequest(2, newAppIDPFDs("app1")))
+	require.NoError(t, err)
+	require.Empty(t, replaced)
+	require.NotContains(t, pConn.appPFDs, "app1")
+	require.Contains(t, pConn.appPFDs, "app2")
+
+	// A malformed request leaves the stored PFDs untouched.
+	bad := ie.NewApplicationIDsPFDs()
+	_, offendingIE, err := pConn.applyPFDMgmtRequest(message.NewPFDManagementRequest(3,
+		newAppIDPFDs("app3", flowDesc), bad))
+	require.Error(t, err)
+	require.Equal(t, bad, offendingIE)
+	require.NotContains(t, pConn.appPFDs, "app3")
+
+	// A request without Application ID's PFDs deletes all PFDs.
+	_, _, err = pConn.applyPFDMgmtRequest(message.NewPFDManagementRequest(4))
+	require.NoError(t, err)
+	require.Empty(t, pConn.appPFDs)
+}
+
+func Test_pdr_applyAppPFD(t *testing.T) {
+	ueAddress := ip2int(net.ParseIP("17.0.0.1"))
+	apfd := appPFD{
+		appID:     "app1",
+		flowDescs: []string{"permit out udp from assigned to 6.6.6.0/24"},
+	}
+
+	p := &pdr{srcIface: access, ueAddress: ueAddress, appID: "app1"}
+	p.resetAppFilter()
+	require.NoError(t, p.applyAppPFD(apfd))
+	require.Equal(t, applicationFilter{
+		srcIP:        ueAddress,
+		dstIP:        ip2int(net.ParseIP("6.6.6.0")),
+		srcPortRange: newWildcardPortRange(),
+		dstPortRange: newWildcardPortRange(),
+		proto:        17,
+		srcIPMask:    math.MaxUint32,
+		dstIPMask:    0xFFFFFF00,
+		protoMask:    math.MaxUint8,
+	}, p.appFilter)
+}
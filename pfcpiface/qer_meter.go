@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+// qerMeter is the two-rate three-color meter (RFC 2698) enforcing the bit rates of a
+// QER in one direction: traffic within the GBR is green, within the MBR yellow and
+// above it red, i.e. dropped. Rates are in bytes per second, burst sizes in bytes.
+type qerMeter struct {
+	cir uint64
+	pir uint64
+	cbs uint64
+	pbs uint64
+	ebs uint64
+}
+
+// newQERMeter returns the meter of the MBR and GBR, in Kbps, of a QER. The burst sizes
+// are those of qosVal, unless the rates over its burst duration are larger. Non-GBR
+// QERs have no committed rate.
+func newQERMeter(mbr, gbr uint64, qosVal *QosConfigVal) qerMeter {
+	burstMs := uint64(qosVal.burstDurationMs)
+
+	m := qerMeter{
+		/* MBR/GBR is received in Kilobits/sec.
+		   CIR/PIR is sent in bytes */
+		cir: (gbr * 1000) / 8,
+		cbs: maxUint64(calcBurstSizeFromRate(gbr, burstMs), uint64(qosVal.cbs)),
+		pbs: maxUint64(calcBurstSizeFromRate(mbr, burstMs), uint64(qosVal.pbs)),
+		ebs: maxUint64(calcBurstSizeFromRate(mbr, burstMs), uint64(qosVal.ebs)),
+	}
+	m.pir = maxUint64((mbr*1000)/8, m.cir)
+
+	return m
+}
+
+// newQciQosMap returns the burst configurations of the QCIs, with a default one for
+// QCI 0 unless configured.
+func newQciQosMap(configs []QciQosConfig) map[uint8]*QosConfigVal {
+	qciQosMap := make(map[uint8]*QosConfigVal)
+
+	for _, qosVal := range configs {
+		qosConfigVal := &QosConfigVal{
+			cbs:              qosVal.CBS,
+			ebs:              qosVal.EBS,
+			pbs:              qosVal.PBS,
+			burstDurationMs:  qosVal.BurstDurationMs,
+			schedulePriority: qosVal.SchedulingPriority,
+		}
+		qciQosMap[qosVal.QCI] = qosConfigVal
+	}
+
+	if _, ok := qciQosMap[0]; !ok {
+		qciQosMap[0] = &QosConfigVal{
+			cbs:              DefaultBurstSize,
+			ebs:              DefaultBurstSize,
+			pbs:              DefaultBurstSize,
+			burstDurationMs:  10,
+			schedulePriority: 7,
+		}
+	}
+
+	return qciQosMap
+}
+
+// qosConfigOf returns the burst configuration of the QCI of qfi, else the default one.
+func qosConfigOf(qciQosMap map[uint8]*QosConfigVal, qfi uint8) *QosConfigVal {
+	if qosVal, ok := qciQosMap[qfi]; ok {
+		return qosVal
+	}
+
+	return qciQosMap[0]
+}
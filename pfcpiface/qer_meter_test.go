@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newQERMeter(t *testing.T) {
+	qciQosMap := newQciQosMap([]QciQosConfig{
+		{QCI: 1, CBS: 1000, PBS: 2000, EBS: 3000, BurstDurationMs: 100},
+	})
+
+	t.Run("GBR bearer", func(t *testing.T) {
+		// 8 Mbps GBR and 16 Mbps MBR, i.e. 1 and 2 MB/s.
+		m := newQERMeter(16000, 8000, qosConfigOf(qciQosMap, 1))
+		require.Equal(t, qerMeter{
+			cir: 1000000,
+			pir: 2000000,
+			cbs: 100000,
+			pbs: 200000,
+			ebs: 200000,
+		}, m)
+
+		config := getMeterConfigurationFromQER(16000, 8000, qosConfigOf(qciQosMap, 1))
+		require.Equal(t, int64(1000000), config.Cir)
+		require.Equal(t, int64(100000), config.Cburst)
+		require.Equal(t, int64(2000000), config.Pir)
+		require.Equal(t, int64(200000), config.Pburst)
+	})
+
+	t.Run("bursts of the QCI", func(t *testing.T) {
+		m := newQERMeter(8, 8, qosConfigOf(qciQosMap, 1))
+		require.Equal(t, qerMeter{cir: 1000, pir: 1000, cbs: 1000, pbs: 2000, ebs: 3000}, m)
+	})
+
+	t.Run("non-GBR bearer", func(t *testing.T) {
+		config := getMeterConfigurationFromQER(16000, 0, qosConfigOf(qciQosMap, 9))
+		require.Zero(t, config.Cir)
+		require.Zero(t, config.Cburst)
+		require.Equal(t, int64(2000000), config.Pir)
+		require.Equal(t, int64(DefaultBurstSize), config.Pburst)
+	})
+
+	t.Run("peak rate below the committed one", func(t *testing.T) {
+		m := newQERMeter(0, 8000, qosConfigOf(qciQosMap, 1))
+		require.Equal(t, m.cir, m.pir)
+	})
+}
@@ -0,0 +1,245 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+// reportTypeSESR is the SESR flag of the Report Type (3GPP TS 29.244, clause 8.2.21).
+const reportTypeSESR = 0x20
+
+// qosFlowKey identifies a QoS flow monitored by an SRR.
+type qosFlowKey struct {
+	seid  uint64
+	srrID uint8
+	qfi   uint8
+}
+
+// qosFlowReports are the times of the reports of a monitored QoS flow.
+type qosFlowReports struct {
+	start    time.Time
+	event    time.Time
+	periodic time.Time
+}
+
+// qosMonitor reports the packet delays of the QoS flows monitored by the SRRs of the
+// sessions of a PFCP connection. Delays are measured by probing: those of the QoS
+// flows of a session are derived from the round-trip time of the GTP-U Echo Requests
+// to its gNB, half of it each way.
+type qosMonitor struct {
+	mu    sync.Mutex
+	flows map[qosFlowKey]*qosFlowReports
+}
+
+func newQoSMonitor() *qosMonitor {
+	return &qosMonitor{
+		flows: make(map[qosFlowKey]*qosFlowReports),
+	}
+}
+
+// forgetSession drops the reports of a deleted session.
+func (m *qosMonitor) forgetSession(seid uint64) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.flows {
+		if key.seid == seid {
+			delete(m.flows, key)
+		}
+	}
+}
+
+// forgetSRR drops the reports of a removed SRR.
+func (m *qosMonitor) forgetSRR(seid uint64, srrID uint8) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.flows {
+		if key.seid == seid && key.srrID == srrID {
+			delete(m.flows, key)
+		}
+	}
+}
+
+// sessionDelays returns the packet delays of the QoS flows of session, measured on the
+// path to the gNB its downlink traffic is tunneled to.
+func sessionDelays(session PFCPSession, rtt func(net.IP) (time.Duration, bool)) (packetDelays, bool) {
+	for _, f := range session.fars {
+		if f.dstIntf != ie.DstInterfaceAccess || f.tunnelIP4Dst == 0 {
+			continue
+		}
+
+		d, ok := rtt(int2ip(f.tunnelIP4Dst))
+		if !ok {
+			continue
+		}
+
+		oneWay := uint32(d / 2 / time.Millisecond)
+
+		return packetDelays{
+			flags: qosMonitorDL | qosMonitorUL | qosMonitorRP,
+			dl:    oneWay,
+			ul:    oneWay,
+			rp:    uint32(d / time.Millisecond),
+		}, true
+	}
+
+	return packetDelays{}, false
+}
+
+// exceeds reports whether any of the delays is above its threshold.
+func (d packetDelays) exceeds(th packetDelays) bool {
+	flags := d.flags & th.flags
+
+	return (flags&qosMonitorDL != 0 && d.dl > th.dl) ||
+		(flags&qosMonitorUL != 0 && d.ul > th.ul) ||
+		(flags&qosMonitorRP != 0 && d.rp > th.rp)
+}
+
+// reports returns a Session Report for each SRR of session with QoS flows to report:
+// those whose delays exceed their thresholds, if they were not reported within their
+// minimum wait time, and those whose measurement period expired. On session release,
+// final, only the QoS flows to report then are.
+func (m *qosMonitor) reports(session PFCPSession, delays packetDelays, now time.Time, final bool) []*ie.IE {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reports []*ie.IE
+
+	for _, r := range session.srrs {
+		var flowReports []*ie.IE
+
+		for _, q := range r.flows {
+			measured := delays
+			measured.flags &= q.requested
+
+			if measured.flags == 0 {
+				continue
+			}
+
+			for _, qfi := range q.qfis {
+				key := qosFlowKey{seid: session.localSEID, srrID: r.srrID, qfi: qfi}
+
+				flow, ok := m.flows[key]
+				if !ok {
+					flow = &qosFlowReports{start: now, periodic: now}
+					m.flows[key] = flow
+				}
+
+				if !flow.due(q, measured, now, final) {
+					continue
+				}
+
+				flowReports = append(flowReports, ie.NewQoSMonitoringReport(
+					ie.NewQFI(qfi),
+					ie.NewQoSMonitoringMeasurement(measured.flags, measured.dl, measured.ul, measured.rp),
+					ie.NewEventTimeStamp(now),
+					ie.NewStartTime(flow.start),
+				))
+			}
+		}
+
+		if len(flowReports) > 0 {
+			reports = append(reports, ie.NewSessionReport(append([]*ie.IE{ie.NewSRRID(r.srrID)}, flowReports...)...))
+		}
+	}
+
+	return reports
+}
+
+// due reports whether the QoS flow is to be reported, and records the report.
+func (f *qosFlowReports) due(q qosMonitoring, measured packetDelays, now time.Time, final bool) bool {
+	if final {
+		return q.frequency&qosReportSESRL != 0
+	}
+
+	var due bool
+
+	if q.frequency&qosReportEVETT != 0 && measured.exceeds(q.thresholds) &&
+		(f.event.IsZero() || now.Sub(f.event) >= q.minWait) {
+		f.event = now
+		due = true
+	}
+
+	if q.frequency&qosReportPERIO != 0 && now.Sub(f.periodic) >= q.period {
+		f.periodic = now
+		due = true
+	}
+
+	return due
+}
+
+// rtt returns the round-trip time last measured to peer, if its path is up.
+func (m *gtpuPathMonitor) rtt(peer net.IP) (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path, ok := m.paths[peer.String()]
+	if !ok || !path.up || path.rtt == 0 {
+		return 0, false
+	}
+
+	return path.rtt, true
+}
+
+// qosMonitoringReports returns the QoS monitoring reports of session, nil if its
+// delays are not measured yet.
+func (pConn *PFCPConn) qosMonitoringReports(session PFCPSession, now time.Time, final bool) []*ie.IE {
+	if len(session.srrs) == 0 || pConn.upf.pathMonitor == nil || pConn.qos == nil {
+		return nil
+	}
+
+	delays, ok := sessionDelays(session, pConn.upf.pathMonitor.rtt)
+	if !ok {
+		return nil
+	}
+
+	return pConn.qos.reports(session, delays, now, final)
+}
+
+// checkQoSMonitoring reports the packet delays of the QoS flows of all sessions of
+// the connection that are due.
+func (pConn *PFCPConn) checkQoSMonitoring() {
+	now := time.Now()
+
+	for _, s := range pConn.store.GetAllSessions() {
+		if reports := pConn.qosMonitoringReports(s, now, false); len(reports) > 0 {
+			pConn.sendSessionReport(s, reports)
+		}
+	}
+}
+
+// sendSessionReport sends a Session Report Request carrying session reports of the session.
+func (pConn *PFCPConn) sendSessionReport(session PFCPSession, reports []*ie.IE) {
+	srreq := message.NewSessionReportRequest(0, /* MO?? <-- what's this */
+		0,                  /* FO <-- what's this? */
+		session.remoteSEID, /* seid */
+		pConn.getSeqNum(),  /* seq # */
+		0,                  /* priority */
+		ie.New(ie.ReportType, []byte{reportTypeSESR}),
+	)
+	srreq.SessionReport = reports
+
+	log.WithFields(log.Fields{
+		"F-SEID":  session.localSEID,
+		"reports": len(reports),
+	}).Debug("Sending QoS Monitoring Report")
+
+	pConn.SendPFCPMsg(srreq)
+}
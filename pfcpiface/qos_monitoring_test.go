@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func TestParseSRR(t *testing.T) {
+	const seid = uint64(100)
+
+	enabled := &upf{pathMonitor: newGTPUPathMonitor(time.Second, 3, nil)}
+
+	createSRR := ie.NewCreateSRR(
+		ie.NewSRRID(1),
+		ie.NewQoSMonitoringPerQoSFlowControlInformation(
+			ie.NewQFI(5),
+			ie.NewQFI(6),
+			ie.NewRequestedQoSMonitoring(1, 1, 1),
+			ie.NewReportingFrequency(1, 1, 1),
+			ie.NewPacketDelayThresholds(qosMonitorRP, 0, 0, 20),
+			ie.NewMinimumWaitTime(5*time.Second),
+			ie.NewMeasurementPeriod(30*time.Second),
+		),
+	)
+
+	t.Run("Create SRR with QoS monitoring", func(t *testing.T) {
+		var r srr
+		require.NoError(t, r.parseSRR(createSRR, seid, enabled))
+		require.Equal(t, srr{
+			srrID: 1,
+			fseID: seid,
+			flows: []qosMonitoring{{
+				qfis:       []uint8{5, 6},
+				requested:  qosMonitorDL | qosMonitorUL | qosMonitorRP,
+				frequency:  qosReportEVETT | qosReportPERIO | qosReportSESRL,
+				thresholds: packetDelays{flags: qosMonitorRP, rp: 20},
+				minWait:    5 * time.Second,
+				period:     30 * time.Second,
+			}},
+		}, r)
+	})
+
+	t.Run("Update SRR replaces the QoS monitoring", func(t *testing.T) {
+		r := srr{srrID: 1, flows: []qosMonitoring{{qfis: []uint8{5}}}}
+		require.NoError(t, r.parseSRR(ie.NewUpdateSRR(ie.NewSRRID(1)), seid, enabled))
+		require.Empty(t, r.flows)
+	})
+
+	t.Run("periodic reporting requires a measurement period", func(t *testing.T) {
+		var r srr
+		require.Error(t, r.parseSRR(ie.NewCreateSRR(
+			ie.NewSRRID(2),
+			ie.NewQoSMonitoringPerQoSFlowControlInformation(
+				ie.NewQFI(5),
+				ie.NewRequestedQoSMonitoring(1, 0, 0),
+				ie.NewReportingFrequency(0, 1, 0),
+			),
+		), seid, enabled))
+	})
+
+	t.Run("QoS monitoring is rejected without GTP-U path monitoring", func(t *testing.T) {
+		var r srr
+
+		err := r.parseSRR(createSRR, seid, &upf{})
+		require.True(t, errors.Is(err, errQoSMonitoringDisabled))
+		require.Equal(t, uint8(ie.CauseRuleCreationModificationFailure), ruleErrorCause(err))
+	})
+}
+
+func Test_sessionDelays(t *testing.T) {
+	gnb := net.ParseIP("198.18.0.1").To4()
+	session := PFCPSession{PacketForwardingRules: PacketForwardingRules{fars: []far{
+		{farID: 1, dstIntf: ie.DstInterfaceCore},
+		{farID: 2, dstIntf: ie.DstInterfaceAccess, tunnelIP4Dst: ip2int(gnb)},
+	}}}
+
+	rtt := func(peer net.IP) (time.Duration, bool) {
+		return 11 * time.Millisecond, peer.Equal(gnb)
+	}
+
+	delays, ok := sessionDelays(session, rtt)
+	require.True(t, ok)
+	require.Equal(t, packetDelays{flags: qosMonitorDL | qosMonitorUL | qosMonitorRP, dl: 5, ul: 5, rp: 11}, delays)
+
+	_, ok = sessionDelays(session, func(net.IP) (time.Duration, bool) { return 0, false })
+	require.False(t, ok)
+}
+
+func Test_qosMonitor_reports(t *testing.T) {
+	session := PFCPSession{
+		localSEID: 1,
+		srrs: []srr{{srrID: 1, flows: []qosMonitoring{{
+			qfis:       []uint8{5},
+			requested:  qosMonitorRP,
+			frequency:  qosReportEVETT | qosReportPERIO | qosReportSESRL,
+			thresholds: packetDelays{flags: qosMonitorRP, rp: 20},
+			minWait:    5 * time.Second,
+			period:     time.Minute,
+		}}}},
+	}
+
+	low := packetDelays{flags: qosMonitorDL | qosMonitorUL | qosMonitorRP, dl: 5, ul: 5, rp: 10}
+	high := packetDelays{flags: qosMonitorDL | qosMonitorUL | qosMonitorRP, dl: 15, ul: 15, rp: 30}
+
+	m := newQoSMonitor()
+	now := time.Now()
+
+	require.Empty(t, m.reports(session, low, now, false))
+
+	reports := m.reports(session, high, now.Add(time.Second), false)
+	require.Len(t, reports, 1)
+
+	srrID, err := reports[0].SRRID()
+	require.NoError(t, err)
+	require.Equal(t, uint8(1), srrID)
+
+	flowReports, err := reports[0].SessionReport()
+	require.NoError(t, err)
+	require.Len(t, flowReports, 2)
+
+	measurement, err := flowReports[1].QoSMonitoringMeasurement()
+	require.NoError(t, err)
+	require.Equal(t, uint8(qosMonitorRP), measurement.Flags)
+	require.Equal(t, uint32(30), measurement.RoundTripPacketDelay)
+
+	// Within the minimum wait time.
+	require.Empty(t, m.reports(session, high, now.Add(3*time.Second), false))
+	require.Len(t, m.reports(session, high, now.Add(6*time.Second), false), 1)
+
+	// Measurement period expired.
+	require.Len(t, m.reports(session, low, now.Add(time.Minute), false), 1)
+
+	// Session release.
+	require.Len(t, m.reports(session, low, now.Add(time.Minute), true), 1)
+
+	m.forgetSession(session.localSEID)
+	require.Empty(t, m.flows)
+}
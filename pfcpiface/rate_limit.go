@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+const (
+	// rateLimitActionDrop ignores the requests over the limit, the CP node retransmits them.
+	rateLimitActionDrop = "drop"
+	// rateLimitActionReject answers the requests over the limit with the cause
+	// "PFCP entity in congestion".
+	rateLimitActionReject = "reject"
+)
+
+// tokenBucket limits the rate of the requests of a CP node, allowing bursts of up to
+// burst requests.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst uint32) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// allow takes a token from the bucket, returns false if it is empty.
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
+
+// isRateLimited reports whether messages of type msgType count against the rate limit.
+// Heartbeats, association and response messages are never limited, so that a throttled
+// CP node keeps its association.
+func isRateLimited(msgType uint8) bool {
+	switch msgType {
+	case message.MsgTypeSessionEstablishmentRequest, message.MsgTypeSessionModificationRequest,
+		message.MsgTypeSessionDeletionRequest, message.MsgTypeSessionSetDeletionRequest,
+		message.MsgTypePFDManagementRequest:
+		return true
+	}
+
+	return false
+}
+
+// throttle returns true if msg exceeds the rate limit of the CP node, with the reply to
+// send, nil if the request is dropped.
+func (pConn *PFCPConn) throttle(msg message.Message) (message.Message, bool) {
+	if pConn.limiter == nil || !isRateLimited(msg.MessageType()) || pConn.limiter.allow(time.Now()) {
+		return nil, false
+	}
+
+	log.WithFields(log.Fields{
+		"CP node":      pConn.nodeID.remote,
+		"message type": msg.MessageTypeName(),
+	}).Debug("PFCP request over the rate limit")
+
+	pConn.SaveThrottledMessage(pConn.nodeID.remote, msg.MessageTypeName())
+
+	if pConn.upf.pfcpRateLimit.Action != rateLimitActionReject {
+		return nil, true
+	}
+
+	return pConn.causeReply(msg, ie.CausePFCPEntityInCongestion, nil), true
+}
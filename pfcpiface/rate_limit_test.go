@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+
+	"github.com/omec-project/upf-epc/pfcpiface/metrics"
+)
+
+type throttleMetrics struct {
+	metrics.InstrumentPFCP
+	throttled map[string]int
+}
+
+func (m *throttleMetrics) SaveThrottledMessage(nodeID, msgType string) {
+	m.throttled[msgType]++
+}
+
+func Test_tokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(10, 2)
+
+	require.True(t, b.allow(now))
+	require.True(t, b.allow(now))
+	require.False(t, b.allow(now))
+
+	// A token every 100ms, up to the burst.
+	require.False(t, b.allow(now.Add(50*time.Millisecond)))
+	require.True(t, b.allow(now.Add(100*time.Millisecond)))
+	require.False(t, b.allow(now.Add(100*time.Millisecond)))
+
+	now = now.Add(time.Hour)
+	require.True(t, b.allow(now))
+	require.True(t, b.allow(now))
+	require.False(t, b.allow(now))
+}
+
+func TestPFCPConn_throttle(t *testing.T) {
+	newConn := func(action string) (*PFCPConn, *throttleMetrics) {
+		m := &throttleMetrics{throttled: make(map[string]int)}
+		pConn := &PFCPConn{
+			upf:            &upf{pfcpRateLimit: PFCPRateLimitInfo{Rate: 1, Burst: 1, Action: action}},
+			store:          NewInMemoryStore(),
+			limiter:        newTokenBucket(1, 1),
+			InstrumentPFCP: m,
+		}
+		pConn.nodeID.localIE = ie.NewNodeID("198.18.0.1", "", "")
+
+		return pConn, m
+	}
+
+	smreq := message.NewSessionModificationRequest(0, 0, 1, 10, 0)
+
+	t.Run("drops requests over the limit", func(t *testing.T) {
+		pConn, m := newConn(rateLimitActionDrop)
+
+		_, throttled := pConn.throttle(smreq)
+		require.False(t, throttled)
+
+		reply, throttled := pConn.throttle(smreq)
+		require.True(t, throttled)
+		require.Nil(t, reply)
+		require.Equal(t, 1, m.throttled[smreq.MessageTypeName()])
+	})
+
+	t.Run("rejects requests over the limit", func(t *testing.T) {
+		pConn, _ := newConn(rateLimitActionReject)
+		require.NoError(t, pConn.store.PutSession(PFCPSession{localSEID: 1, remoteSEID: 2}, nil, false, 0))
+
+		_, throttled := pConn.throttle(smreq)
+		require.False(t, throttled)
+
+		reply, throttled := pConn.throttle(smreq)
+		require.True(t, throttled)
+
+		smres, ok := reply.(*message.SessionModificationResponse)
+		require.True(t, ok)
+		require.Equal(t, uint64(2), smres.SEID())
+
+		cause, err := smres.Cause.Cause()
+		require.NoError(t, err)
+		require.Equal(t, ie.CausePFCPEntityInCongestion, cause)
+
+		sereq := message.NewSessionEstablishmentRequest(0, 0, 0, 11, 0,
+			ie.NewNodeID("198.18.0.2", "", ""), ie.NewFSEID(3, net.ParseIP("198.18.0.2"), nil))
+
+		reply, throttled = pConn.throttle(sereq)
+		require.True(t, throttled)
+		require.Equal(t, uint64(3), reply.(*message.SessionEstablishmentResponse).SEID())
+	})
+
+	t.Run("heartbeats are not limited", func(t *testing.T) {
+		pConn, _ := newConn(rateLimitActionDrop)
+		hbreq := message.NewHeartbeatRequest(12, ie.NewRecoveryTimeStamp(time.Now()), nil)
+
+		for i := 0; i < 3; i++ {
+			_, throttled := pConn.throttle(hbreq)
+			require.False(t, throttled)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// recoveryState persists the Recovery Time Stamp of the UPF and the CP nodes associated
+// with it. A restarted UPF advertises a Recovery Time Stamp newer than the persisted one,
+// even if restarted within the same second or with its clock behind, and sets up the
+// association again with the CP nodes associated before the restart, which then remove
+// the sessions lost in the restart (3GPP TS 29.244, clause 19A).
+type recoveryState struct {
+	mu    sync.Mutex
+	path  string
+	state persistedRecovery
+	// previous are the addresses of the CP nodes associated before the restart.
+	previous []string
+}
+
+type persistedRecovery struct {
+	RecoveryTimeStamp time.Time `json:"recovery_time_stamp"`
+	// Associations are the node IDs of the associated CP nodes, by address.
+	Associations map[string]string `json:"associations"`
+}
+
+// openRecoveryState loads the state at path and sets the Recovery Time Stamp of this
+// run, saved before any association is set up.
+func openRecoveryState(path string, now time.Time) (*recoveryState, error) {
+	s := &recoveryState{path: path}
+
+	b, err := os.ReadFile(path)
+
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(b, &s.state); err != nil {
+			return nil, ErrInvalidArgumentWithReason("recovery state", path, err.Error())
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	if s.state.Associations == nil {
+		s.state.Associations = make(map[string]string)
+	}
+
+	for addr := range s.state.Associations {
+		s.previous = append(s.previous, addr)
+	}
+
+	sort.Strings(s.previous)
+
+	// The Recovery Time Stamp has a resolution of a second.
+	prev := s.state.RecoveryTimeStamp
+	ts := now.Truncate(time.Second)
+
+	if !prev.IsZero() {
+		if !ts.After(prev) {
+			log.Warnln("Clock not past the previous Recovery Time Stamp", prev, ", advancing it by a second")
+
+			ts = prev.Add(time.Second)
+		}
+
+		log.Infoln("Restarted with Recovery Time Stamp", ts, "previous:", prev,
+			"CP nodes associated before:", s.previous)
+	}
+
+	s.state.RecoveryTimeStamp = ts
+
+	return s, s.save()
+}
+
+// recoveryTimeStamp returns the Recovery Time Stamp of this run.
+func (s *recoveryState) recoveryTimeStamp() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.RecoveryTimeStamp
+}
+
+// previousPeers returns the addresses of the CP nodes associated before the restart.
+func (s *recoveryState) previousPeers() []string {
+	if s == nil {
+		return nil
+	}
+
+	return s.previous
+}
+
+// associated records the association set up with the CP node at addr.
+func (s *recoveryState) associated(addr net.Addr, nodeID string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	host := addrHost(addr)
+	if s.state.Associations[host] == nodeID {
+		return
+	}
+
+	s.state.Associations[host] = nodeID
+
+	if err := s.save(); err != nil {
+		log.Errorln("Failed to save recovery state:", err)
+	}
+}
+
+// released forgets the CP node at addr, which released the association.
+func (s *recoveryState) released(addr net.Addr) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	host := addrHost(addr)
+	if _, ok := s.state.Associations[host]; !ok {
+		return
+	}
+
+	delete(s.state.Associations, host)
+
+	if err := s.save(); err != nil {
+		log.Errorln("Failed to save recovery state:", err)
+	}
+}
+
+// save replaces the state file, so that a crash leaves either the old or the new state.
+func (s *recoveryState) save() error {
+	b, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+// addrHost returns the IP of a UDP address.
+func addrHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return host
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoveryState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recovery")
+	start := time.Date(2022, 5, 1, 10, 0, 0, 500, time.UTC)
+
+	s, err := openRecoveryState(path, start)
+	require.NoError(t, err)
+	require.Equal(t, start.Truncate(time.Second), s.recoveryTimeStamp())
+	require.Empty(t, s.previousPeers())
+
+	smf1 := &net.UDPAddr{IP: net.ParseIP("198.18.0.10"), Port: 8805}
+	smf2 := &net.UDPAddr{IP: net.ParseIP("198.18.0.11"), Port: 8805}
+	s.associated(smf1, "smf1")
+	s.associated(smf2, "smf2")
+	s.released(smf2)
+
+	// Restarted within the same second: the Recovery Time Stamp must still be newer.
+	s, err = openRecoveryState(path, start.Add(100*time.Millisecond))
+	require.NoError(t, err)
+	require.Equal(t, start.Truncate(time.Second).Add(time.Second), s.recoveryTimeStamp())
+	require.Equal(t, []string{"198.18.0.10"}, s.previousPeers())
+
+	// Restarted later, with the clock ahead.
+	later := start.Add(time.Hour)
+	s, err = openRecoveryState(path, later)
+	require.NoError(t, err)
+	require.Equal(t, later.Truncate(time.Second), s.recoveryTimeStamp())
+	require.Equal(t, []string{"198.18.0.10"}, s.previousPeers())
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	_, err = openRecoveryState(path, later)
+	require.Error(t, err)
+}
+
+func TestConnectPeersAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recovery")
+
+	s, err := openRecoveryState(path, time.Now())
+	require.NoError(t, err)
+	s.associated(&net.UDPAddr{IP: net.ParseIP("198.18.0.10"), Port: 8805}, "smf1")
+	s.associated(&net.UDPAddr{IP: net.ParseIP("198.18.0.11"), Port: 8805}, "smf2")
+
+	s, err = openRecoveryState(path, time.Now())
+	require.NoError(t, err)
+
+	node := &PFCPNode{upf: &upf{peers: []string{"198.18.0.11"}, recovery: s}}
+	require.Equal(t, []string{"198.18.0.11", "198.18.0.10"}, node.connectPeers())
+
+	node.upf.recovery = nil
+	require.Equal(t, []string{"198.18.0.11"}, node.connectPeers())
+}
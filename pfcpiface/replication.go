@@ -0,0 +1,459 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/omec-project/upf-epc/pfcpiface/metrics"
+)
+
+const (
+	// haRoleActive serves N4 and streams its sessions to the standbys.
+	haRoleActive = "active"
+	// haRoleStandby replicates the sessions of the active instance and takes over N4
+	// when the active instance is silent for the failover timeout.
+	haRoleStandby = "standby"
+
+	haFailoverTimeoutDefault = 3 * time.Second
+
+	// replicationKeepaliveInterval is the period of the keepalives sent to standbys
+	// while no session changes.
+	replicationKeepaliveInterval = time.Second
+	// replicationQueueSize is the number of changes queued for a standby, a standby
+	// falling further behind is disconnected and gets a new snapshot.
+	replicationQueueSize = 4096
+)
+
+// Operations of the replication events.
+const (
+	// replicationReset drops the replicated sessions, a snapshot of the active ones follows.
+	replicationReset     = "reset"
+	replicationPut       = "put"
+	replicationDelete    = "delete"
+	replicationKeepalive = "keepalive"
+)
+
+var errReplicationClosed = errors.New("replication stream closed")
+
+// replicationEvent is a change of the sessions of a PFCP connection of the active
+// instance, sent to the standbys as a line of JSON.
+type replicationEvent struct {
+	Op string `json:"op"`
+	// Peer is the remote address of the PFCP connection.
+	Peer       string         `json:"peer,omitempty"`
+	NodeID     string         `json:"node_id,omitempty"`
+	RecoveryTS time.Time      `json:"recovery_ts,omitempty"`
+	FSEID      uint64         `json:"fseid,omitempty"`
+	Session    *sessionRecord `json:"session,omitempty"`
+}
+
+// replicationHub streams the session changes of all PFCP connections to the standbys.
+// It only streams once active, standbys being activated when they take over.
+type replicationHub struct {
+	active int32
+
+	mu   sync.Mutex
+	subs map[chan replicationEvent]struct{}
+}
+
+func newReplicationHub(active bool) *replicationHub {
+	h := &replicationHub{subs: make(map[chan replicationEvent]struct{})}
+	if active {
+		h.activate()
+	}
+
+	return h
+}
+
+func (h *replicationHub) activate() {
+	atomic.StoreInt32(&h.active, 1)
+}
+
+func (h *replicationHub) isActive() bool {
+	return atomic.LoadInt32(&h.active) == 1
+}
+
+// watch publishes the session changes of pConn.
+func (h *replicationHub) watch(pConn *PFCPConn) {
+	pConn.store.Watch(func(event sessionEvent) {
+		h.publish(pConn.replicationEvent(event))
+	})
+}
+
+func (h *replicationHub) publish(event replicationEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs {
+		select {
+		case ch <- event:
+		default:
+			log.Warnln("Standby too slow to replicate sessions, disconnecting it")
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (h *replicationHub) subscribe() chan replicationEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan replicationEvent, replicationQueueSize)
+	h.subs[ch] = struct{}{}
+
+	return ch
+}
+
+func (h *replicationHub) unsubscribe(ch chan replicationEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// replicationEvent returns the replication event of a change of the sessions of pConn.
+func (pConn *PFCPConn) replicationEvent(event sessionEvent) replicationEvent {
+	re := replicationEvent{
+		Op:         replicationDelete,
+		Peer:       pConn.RemoteAddr().String(),
+		NodeID:     pConn.nodeID.remote,
+		RecoveryTS: pConn.ts.getRemote(),
+		FSEID:      event.fseid,
+	}
+
+	if !event.deleted {
+		record := newSessionRecord(event.session)
+		re.Op = replicationPut
+		re.Session = &record
+	}
+
+	return re
+}
+
+// replicationHandler streams the sessions to a standby:
+//
+//	GET /v1/replication  newline-delimited JSON replicationEvents: a reset, the
+//	                     stored sessions, then their changes and keepalives
+type replicationHandler struct {
+	node *PFCPNode
+}
+
+func (h *replicationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	hub := h.node.replication
+	if !hub.isActive() {
+		http.Error(w, "not the active instance", http.StatusServiceUnavailable)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Changes made while the snapshot is taken are sent after it, in order.
+	events := hub.subscribe()
+	defer hub.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	enc := json.NewEncoder(w)
+	snapshot := []replicationEvent{{Op: replicationReset}}
+
+	h.node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+		for _, session := range pConn.store.GetAllSessions() {
+			snapshot = append(snapshot, pConn.replicationEvent(sessionEvent{fseid: session.localSEID, session: session}))
+		}
+
+		return true
+	})
+
+	for _, event := range snapshot {
+		if err := enc.Encode(event); err != nil {
+			return
+		}
+	}
+
+	flusher.Flush()
+
+	log.Infoln("Standby", r.RemoteAddr, "replicating", len(snapshot)-1, "sessions")
+
+	keepalive := time.NewTicker(replicationKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		var event replicationEvent
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			event = replicationEvent{Op: replicationKeepalive}
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+
+			event = e
+		}
+
+		if err := enc.Encode(event); err != nil {
+			log.Warnln("Replication to standby", r.RemoteAddr, "failed:", err)
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+// replicatedPeer are the sessions replicated from a PFCP connection of the active instance.
+type replicatedPeer struct {
+	addr       string
+	nodeID     string
+	recoveryTS time.Time
+	sessions   map[uint64]sessionRecord
+}
+
+// replicaClient keeps the sessions replicated from the active instance, until it
+// takes over.
+type replicaClient struct {
+	url             string
+	failoverTimeout time.Duration
+	client          *http.Client
+
+	mu    sync.Mutex
+	peers map[string]*replicatedPeer
+}
+
+func newReplicaClient(conf HAInfo) *replicaClient {
+	timeout := haFailoverTimeoutDefault
+	if conf.FailoverTimeout != "" {
+		timeout = validDuration(conf.FailoverTimeout)
+	}
+
+	return &replicaClient{
+		url:             strings.TrimSuffix(conf.ActiveURL, "/") + "/v1/replication",
+		failoverTimeout: timeout,
+		client:          &http.Client{},
+		peers:           make(map[string]*replicatedPeer),
+	}
+}
+
+func (c *replicaClient) apply(event replicationEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch event.Op {
+	case replicationReset:
+		c.peers = make(map[string]*replicatedPeer)
+	case replicationPut:
+		if event.Session == nil {
+			return
+		}
+
+		peer, ok := c.peers[event.Peer]
+		if !ok {
+			peer = &replicatedPeer{addr: event.Peer, sessions: make(map[uint64]sessionRecord)}
+			c.peers[event.Peer] = peer
+		}
+
+		peer.nodeID = event.NodeID
+		peer.recoveryTS = event.RecoveryTS
+		peer.sessions[event.FSEID] = *event.Session
+	case replicationDelete:
+		peer, ok := c.peers[event.Peer]
+		if !ok {
+			return
+		}
+
+		delete(peer.sessions, event.FSEID)
+
+		if len(peer.sessions) == 0 {
+			delete(c.peers, event.Peer)
+		}
+	}
+}
+
+// replicatedPeers returns the replicated PFCP connections, sorted by address.
+func (c *replicaClient) replicatedPeers() []*replicatedPeer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	peers := make([]*replicatedPeer, 0, len(c.peers))
+	for _, peer := range c.peers {
+		peers = append(peers, peer)
+	}
+
+	sort.Slice(peers, func(i, j int) bool { return peers[i].addr < peers[j].addr })
+
+	return peers
+}
+
+// stream replicates the sessions from url until the stream breaks, signaling alive
+// on each event received.
+func (c *replicaClient) stream(ctx context.Context, url string, alive chan<- struct{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("replication refused by %v: %v", url, resp.Status)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+
+	for {
+		var event replicationEvent
+		if err := dec.Decode(&event); err != nil {
+			return fmt.Errorf("%w: %v", errReplicationClosed, err)
+		}
+
+		c.apply(event)
+
+		select {
+		case alive <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// replicate streams the sessions from the URL returned by url, reconnecting every
+// retry until ctx is done. Nothing is streamed while url returns an empty string.
+func (c *replicaClient) replicate(ctx context.Context, url func() string, alive chan<- struct{}, retry time.Duration) {
+	for ctx.Err() == nil {
+		if u := url(); u != "" {
+			if err := c.stream(ctx, u, alive); err != nil && ctx.Err() == nil {
+				log.Warnln("Replication from", u, "failed:", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(retry):
+		}
+	}
+}
+
+// waitForFailover replicates the sessions of the active instance until it is silent
+// for the failover timeout. Returns false if ctx is done first.
+func (c *replicaClient) waitForFailover(ctx context.Context) bool {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	alive := make(chan struct{}, 1)
+
+	go c.replicate(streamCtx, func() string { return c.url }, alive, c.failoverTimeout/4)
+
+	log.Infoln("Standby replicating sessions from", c.url)
+
+	timer := time.NewTimer(c.failoverTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-alive:
+			if !timer.Stop() {
+				<-timer.C
+			}
+
+			timer.Reset(c.failoverTimeout)
+		case <-timer.C:
+			log.Warnln("Active instance silent for", c.failoverTimeout, ", taking over")
+			return true
+		}
+	}
+}
+
+// takeOver serves the PFCP connections replicated from the active instance and
+// programs their sessions into the datapath.
+func (node *PFCPNode) takeOver(peers []*replicatedPeer) {
+	lAddr := node.LocalAddr().String()
+	sessions := 0
+
+	for _, peer := range peers {
+		pConn := node.NewPFCPConn(lAddr, peer.addr, nil)
+		if pConn == nil {
+			continue
+		}
+
+		pConn.nodeID.remote = peer.nodeID
+		pConn.ts.setRemote(peer.recoveryTS)
+
+		for _, record := range peer.sessions {
+			if err := pConn.adoptSession(record); err != nil {
+				log.Errorln("Failed to adopt session", record.LocalSEID, "of", peer.nodeID, ":", err)
+				continue
+			}
+
+			sessions++
+		}
+
+		if node.upf.enableHBTimer {
+			go pConn.startHeartBeatMonitor()
+		}
+	}
+
+	node.replication.activate()
+
+	log.Infoln("Took over", sessions, "sessions of", len(peers), "CP nodes")
+
+	node.resyncDatapath()
+}
+
+// adoptSession stores a session replicated from the active instance, with the UE IPs
+// and F-TEIDs allocated to it. Its rules are written by the datapath resync.
+func (pConn *PFCPConn) adoptSession(record sessionRecord) error {
+	session := record.session()
+	session.metrics = metrics.NewSession(pConn.nodeID.remote)
+
+	if pConn.upf.ippools != nil {
+		pConn.upf.ippools.adoptIPs(session.localSEID, record.ueIPs())
+	}
+
+	for key, teid := range record.allocatedTEIDs() {
+		pConn.upf.teidPool.adopt(pConn.nodeID.remote, session.localSEID, key, teid)
+	}
+
+	if err := pConn.store.PutSession(session, pConn, false, 0); err != nil {
+		return err
+	}
+
+	pConn.SaveSessions(session.metrics)
+	pConn.teids.update(session)
+	pConn.schedulePeriodicReports(session.urrs)
+
+	return nil
+}
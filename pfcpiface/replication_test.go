@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newReplicatedTestSession(fseid uint64) PFCPSession {
+	return PFCPSession{
+		localSEID:  fseid,
+		remoteSEID: fseid + 100,
+		PacketForwardingRules: PacketForwardingRules{
+			pdrs: []pdr{{
+				srcIface:    core,
+				ueAddress:   ip2int(net.ParseIP("10.250.0.1")),
+				allocIPFlag: true,
+				appFilter:   applicationFilter{srcPortRange: portRange{low: 80, high: 443}},
+				fseID:       fseid,
+				pdrID:       1,
+				farID:       1,
+				qerIDList:   []uint32{1},
+			}},
+			fars: []far{{farID: 1, fseID: fseid, applyAction: ActionForward, tunnelTEID: 7}},
+			qers: []qer{{qerID: 1, fseID: fseid, ulMbr: 1000}},
+			urrs: []urr{{urrID: 1, fseID: fseid, volThreshold: volumeThreshold{total: 10}}},
+			bars: []bar{{barID: 1, fseID: fseid, notifyDelay: time.Second}},
+		},
+	}
+}
+
+func Test_sessionRecord(t *testing.T) {
+	session := newReplicatedTestSession(1)
+	record := newSessionRecord(session)
+
+	require.Equal(t, session, record.session())
+	require.Equal(t, []net.IP{net.ParseIP("10.250.0.1").To4()}, record.ueIPs())
+}
+
+func TestInMemoryStore_Watch(t *testing.T) {
+	store := NewInMemoryStore()
+
+	var events []sessionEvent
+
+	cancel := store.Watch(func(event sessionEvent) {
+		events = append(events, event)
+	})
+
+	session := newReplicatedTestSession(1)
+	require.NoError(t, store.PutSession(session, nil, false, 0))
+	require.NoError(t, store.PutSession(session, nil, false, 0))
+	require.NoError(t, store.DeleteSession(1, nil))
+
+	cancel()
+	require.NoError(t, store.PutSession(session, nil, false, 0))
+
+	require.Equal(t, []sessionEvent{
+		{fseid: 1, session: session, created: true},
+		{fseid: 1, session: session},
+		{deleted: true, fseid: 1},
+	}, events)
+}
+
+func Test_replication(t *testing.T) {
+	conn, err := net.Dial("udp", "127.0.0.1:8805")
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	node := &PFCPNode{replication: newReplicationHub(true)}
+	pConn := &PFCPConn{Conn: conn, store: NewInMemoryStore(), upf: &upf{}}
+	pConn.nodeID.remote = "smf"
+
+	node.replication.watch(pConn)
+	node.pConns.Store(conn.RemoteAddr().String(), pConn)
+
+	require.NoError(t, pConn.store.PutSession(newReplicatedTestSession(1), pConn, false, 0))
+
+	srv := httptest.NewServer(&replicationHandler{node: node})
+	defer srv.Close()
+
+	c := newReplicaClient(HAInfo{ActiveURL: srv.URL, FailoverTimeout: "200ms"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	alive := make(chan struct{}, 1)
+	streamed := make(chan error, 1)
+
+	go func() { streamed <- c.stream(ctx, c.url, alive) }()
+
+	sessions := func() map[uint64]sessionRecord {
+		peers := c.replicatedPeers()
+		if len(peers) != 1 {
+			return nil
+		}
+
+		return peers[0].sessions
+	}
+
+	require.Eventually(t, func() bool { return len(sessions()) == 1 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, "smf", c.replicatedPeers()[0].nodeID)
+
+	require.NoError(t, pConn.store.PutSession(newReplicatedTestSession(2), pConn, false, 0))
+	require.NoError(t, pConn.store.DeleteSession(1, pConn))
+
+	require.Eventually(t, func() bool {
+		s := sessions()
+		_, ok := s[2]
+
+		return len(s) == 1 && ok
+	}, time.Second, 10*time.Millisecond)
+
+	t.Run("standby refuses to stream", func(t *testing.T) {
+		standby := httptest.NewServer(&replicationHandler{node: &PFCPNode{replication: newReplicationHub(false)}})
+		defer standby.Close()
+
+		c := newReplicaClient(HAInfo{ActiveURL: standby.URL})
+		require.Error(t, c.stream(ctx, c.url, alive))
+	})
+
+	t.Run("standby takes over once the active instance is silent", func(t *testing.T) {
+		srv.CloseClientConnections()
+		srv.Close()
+
+		require.True(t, c.waitForFailover(ctx))
+		require.Len(t, sessions(), 1)
+	})
+}
@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// reportPipelineSize is the number of sessions with a notification pending.
+	reportPipelineSize = 1024
+	// reportPipelineBlockTimeout is how long a datapath reader is held back while the
+	// pipeline is full, before its notification is dropped.
+	reportPipelineBlockTimeout = 100 * time.Millisecond
+)
+
+// reportPipeline carries the notifications of the datapath, the F-SEIDs of the sessions
+// with downlink data buffered, to the PFCP node. Notifications of a session already
+// pending are coalesced, so a burst for a session is reported once. Once the sessions
+// pending fill the pipeline, the datapath reader is held back up to the block timeout,
+// then its notification is dropped and counted.
+type reportPipeline struct {
+	mu      sync.Mutex
+	pending map[uint64]struct{}
+	order   []uint64
+
+	// slots holds a token for each session pending, bounding them.
+	slots chan struct{}
+	// ready is signaled when notifications are pending.
+	ready chan struct{}
+
+	blockTimeout time.Duration
+
+	queued    uint64
+	coalesced uint64
+	dropped   uint64
+}
+
+func newReportPipeline(size int, blockTimeout time.Duration) *reportPipeline {
+	return &reportPipeline{
+		pending:      make(map[uint64]struct{}),
+		slots:        make(chan struct{}, size),
+		ready:        make(chan struct{}, 1),
+		blockTimeout: blockTimeout,
+	}
+}
+
+// notify queues a notification for fseid, or coalesces it with the one pending. It
+// blocks while the pipeline is full, and returns false if the notification is
+// dropped.
+func (p *reportPipeline) notify(fseid uint64) bool {
+	p.mu.Lock()
+	_, ok := p.pending[fseid]
+	p.mu.Unlock()
+
+	if ok {
+		atomic.AddUint64(&p.coalesced, 1)
+		return true
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		timer := time.NewTimer(p.blockTimeout)
+		defer timer.Stop()
+
+		select {
+		case p.slots <- struct{}{}:
+		case <-timer.C:
+			if atomic.AddUint64(&p.dropped, 1) == 1 {
+				log.Warnln("Report notification pipeline full, dropping notifications")
+			}
+
+			log.Debugln("Dropped report notification of F-SEID", fseid)
+
+			return false
+		}
+	}
+
+	p.mu.Lock()
+
+	if _, ok := p.pending[fseid]; ok {
+		// Queued by another reader meanwhile.
+		p.mu.Unlock()
+		<-p.slots
+		atomic.AddUint64(&p.coalesced, 1)
+
+		return true
+	}
+
+	p.pending[fseid] = struct{}{}
+	p.order = append(p.order, fseid)
+	p.mu.Unlock()
+
+	atomic.AddUint64(&p.queued, 1)
+
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// drain returns the F-SEIDs of the pending notifications, in the order they were
+// queued, and makes room for new ones.
+func (p *reportPipeline) drain() []uint64 {
+	p.mu.Lock()
+	fseids := p.order
+	p.order = nil
+	p.pending = make(map[uint64]struct{}, len(fseids))
+	p.mu.Unlock()
+
+	for range fseids {
+		<-p.slots
+	}
+
+	return fseids
+}
+
+// stats returns the number of notifications pending, queued, coalesced and dropped.
+func (p *reportPipeline) stats() (pending int, queued, coalesced, dropped uint64) {
+	return len(p.slots), atomic.LoadUint64(&p.queued), atomic.LoadUint64(&p.coalesced), atomic.LoadUint64(&p.dropped)
+}
+
+// handleReportNotifications hands the pending notifications to the connections of
+// their sessions.
+func (node *PFCPNode) handleReportNotifications() {
+	for _, fseid := range node.upf.reports.drain() {
+		handled := false
+
+		node.pConns.Range(func(key, value interface{}) bool {
+			pConn := value.(*PFCPConn)
+			if _, ok := pConn.store.GetSession(fseid); !ok {
+				return true
+			}
+
+			pConn.handleDigestReport(fseid)
+			handled = true
+
+			return false
+		})
+
+		if !handled {
+			log.Warnln("No session found for report notification of F-SEID", fseid)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportPipelineCoalesces(t *testing.T) {
+	p := newReportPipeline(4, time.Millisecond)
+
+	require.True(t, p.notify(1))
+	require.True(t, p.notify(2))
+	require.True(t, p.notify(1))
+
+	select {
+	case <-p.ready:
+	default:
+		t.Fatal("pipeline not signaled ready")
+	}
+
+	require.Equal(t, []uint64{1, 2}, p.drain())
+	require.Empty(t, p.drain())
+
+	pending, queued, coalesced, dropped := p.stats()
+	require.Equal(t, 0, pending)
+	require.Equal(t, uint64(2), queued)
+	require.Equal(t, uint64(1), coalesced)
+	require.Equal(t, uint64(0), dropped)
+
+	// Drained notifications are queued again.
+	require.True(t, p.notify(1))
+	require.Equal(t, []uint64{1}, p.drain())
+}
+
+func TestReportPipelineDropsWhenFull(t *testing.T) {
+	p := newReportPipeline(2, 10*time.Millisecond)
+
+	require.True(t, p.notify(1))
+	require.True(t, p.notify(2))
+
+	start := time.Now()
+
+	require.False(t, p.notify(3))
+	require.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+
+	// A session pending is coalesced even when full.
+	require.True(t, p.notify(2))
+
+	pending, _, _, dropped := p.stats()
+	require.Equal(t, 2, pending)
+	require.Equal(t, uint64(1), dropped)
+}
+
+func TestReportPipelineBlocksUntilDrained(t *testing.T) {
+	p := newReportPipeline(1, time.Second)
+
+	require.True(t, p.notify(1))
+
+	done := make(chan bool)
+
+	go func() { done <- p.notify(2) }()
+
+	select {
+	case <-done:
+		t.Fatal("notify did not block on a full pipeline")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	require.Equal(t, []uint64{1}, p.drain())
+	require.True(t, <-done)
+	require.Equal(t, []uint64{2}, p.drain())
+}
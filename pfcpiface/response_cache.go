@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+// responseCache keeps the responses to the recent session requests of a CP node, so
+// that a retransmitted request is answered again instead of being processed twice.
+// Responses are kept as long as the CP node may retransmit, assumed to use the same
+// timers as the UPF.
+type responseCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[uint32]cachedResponse
+	// inFlight are the requests being handled, not answered yet.
+	inFlight map[cachedRequest]bool
+	// order are the cached sequence numbers, oldest first.
+	order []cachedSequence
+}
+
+type cachedRequest struct {
+	seq     uint32
+	msgType uint8
+	seid    uint64
+}
+
+func newCachedRequest(req message.Message) cachedRequest {
+	return cachedRequest{seq: req.Sequence(), msgType: req.MessageType(), seid: req.SEID()}
+}
+
+type cachedResponse struct {
+	msgType uint8
+	seid    uint64
+	reply   message.Message
+	expiry  time.Time
+}
+
+type cachedSequence struct {
+	seq    uint32
+	expiry time.Time
+}
+
+func newResponseCache(timers pfcpTimers) *responseCache {
+	return &responseCache{
+		ttl:      timers.respTimeout * time.Duration(timers.maxReqRetries+1),
+		entries:  make(map[uint32]cachedResponse),
+		inFlight: make(map[cachedRequest]bool),
+	}
+}
+
+// isCachedRequest reports whether the responses to requests of type msgType are cached.
+func isCachedRequest(msgType uint8) bool {
+	switch msgType {
+	case message.MsgTypeSessionEstablishmentRequest, message.MsgTypeSessionModificationRequest,
+		message.MsgTypeSessionDeletionRequest:
+		return true
+	}
+
+	return false
+}
+
+// lookup returns the response already sent to req, if req is a retransmission.
+func (c *responseCache) lookup(req message.Message, now time.Time) (message.Message, bool) {
+	if c == nil || !isCachedRequest(req.MessageType()) {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(now)
+
+	entry, ok := c.entries[req.Sequence()]
+	if !ok || entry.msgType != req.MessageType() || entry.seid != req.SEID() {
+		return nil, false
+	}
+
+	return entry.reply, true
+}
+
+// start marks req as being handled until its response is stored. It returns true if
+// req is a retransmission, with the response already sent to it, or nil if the original
+// request is still being handled.
+func (c *responseCache) start(req message.Message, now time.Time) (message.Message, bool) {
+	if c == nil || !isCachedRequest(req.MessageType()) {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(now)
+
+	if entry, ok := c.entries[req.Sequence()]; ok && entry.msgType == req.MessageType() && entry.seid == req.SEID() {
+		return entry.reply, true
+	}
+
+	key := newCachedRequest(req)
+	if c.inFlight[key] {
+		return nil, true
+	}
+
+	c.inFlight[key] = true
+
+	return nil, false
+}
+
+// store caches the response reply sent to req, and ends its handling. Nothing is cached
+// if reply is nil.
+func (c *responseCache) store(req, reply message.Message, now time.Time) {
+	if c == nil || !isCachedRequest(req.MessageType()) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.inFlight, newCachedRequest(req))
+
+	if reply == nil {
+		return
+	}
+
+	c.expire(now)
+
+	expiry := now.Add(c.ttl)
+	c.entries[req.Sequence()] = cachedResponse{
+		msgType: req.MessageType(),
+		seid:    req.SEID(),
+		reply:   reply,
+		expiry:  expiry,
+	}
+	c.order = append(c.order, cachedSequence{seq: req.Sequence(), expiry: expiry})
+}
+
+// expire drops the expired responses. Caller holds mu.
+func (c *responseCache) expire(now time.Time) {
+	n := 0
+
+	for ; n < len(c.order) && !c.order[n].expiry.After(now); n++ {
+		// The sequence number may have been reused by a later request.
+		if entry := c.entries[c.order[n].seq]; entry.expiry.Equal(c.order[n].expiry) {
+			delete(c.entries, c.order[n].seq)
+		}
+	}
+
+	c.order = c.order[n:]
+}
@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+func Test_responseCache(t *testing.T) {
+	now := time.Now()
+	c := newResponseCache(pfcpTimers{respTimeout: 2 * time.Second, maxReqRetries: 2})
+	require.Equal(t, 6*time.Second, c.ttl)
+
+	smreq := message.NewSessionModificationRequest(0, 0, 1, 10, 0)
+	smres := message.NewSessionModificationResponse(0, 0, 2, 10, 0, ie.NewCause(ie.CauseRequestAccepted))
+
+	_, ok := c.lookup(smreq, now)
+	require.False(t, ok)
+
+	c.store(smreq, smres, now)
+
+	t.Run("retransmission is answered again", func(t *testing.T) {
+		reply, ok := c.lookup(smreq, now.Add(5*time.Second))
+		require.True(t, ok)
+		require.Equal(t, smres, reply)
+	})
+
+	t.Run("other requests with the sequence number are processed", func(t *testing.T) {
+		_, ok := c.lookup(message.NewSessionModificationRequest(0, 0, 3, 10, 0), now)
+		require.False(t, ok)
+
+		_, ok = c.lookup(message.NewSessionDeletionRequest(0, 0, 1, 10, 0), now)
+		require.False(t, ok)
+	})
+
+	t.Run("heartbeats are not cached", func(t *testing.T) {
+		hbreq := message.NewHeartbeatRequest(11, ie.NewRecoveryTimeStamp(now), nil)
+		c.store(hbreq, message.NewHeartbeatResponse(11, ie.NewRecoveryTimeStamp(now)), now)
+
+		_, ok := c.lookup(hbreq, now)
+		require.False(t, ok)
+	})
+
+	t.Run("responses expire", func(t *testing.T) {
+		// The sequence number is reused by a later request, whose response is kept.
+		later := message.NewSessionDeletionRequest(0, 0, 1, 10, 0)
+		c.store(later, message.NewSessionDeletionResponse(0, 0, 2, 10, 0), now.Add(3*time.Second))
+
+		_, ok := c.lookup(smreq, now.Add(7*time.Second))
+		require.False(t, ok)
+
+		_, ok = c.lookup(later, now.Add(7*time.Second))
+		require.True(t, ok)
+
+		_, ok = c.lookup(later, now.Add(9*time.Second))
+		require.False(t, ok)
+		require.Empty(t, c.entries)
+		require.Empty(t, c.order)
+	})
+
+	t.Run("retransmissions of requests being handled are dropped", func(t *testing.T) {
+		sereq := message.NewSessionEstablishmentRequest(0, 0, 0, 20, 0)
+		seres := message.NewSessionEstablishmentResponse(0, 0, 1, 20, 0, ie.NewCause(ie.CauseRequestAccepted))
+
+		_, retransmitted := c.start(sereq, now)
+		require.False(t, retransmitted)
+
+		reply, retransmitted := c.start(sereq, now)
+		require.True(t, retransmitted)
+		require.Nil(t, reply)
+
+		c.store(sereq, seres, now)
+		require.Empty(t, c.inFlight)
+
+		reply, retransmitted = c.start(sereq, now)
+		require.True(t, retransmitted)
+		require.Equal(t, seres, reply)
+	})
+
+	t.Run("unanswered requests end their handling", func(t *testing.T) {
+		sdreq := message.NewSessionDeletionRequest(0, 0, 5, 21, 0)
+
+		_, retransmitted := c.start(sdreq, now)
+		require.False(t, retransmitted)
+
+		c.store(sdreq, nil, now)
+
+		_, retransmitted = c.start(sdreq, now)
+		require.False(t, retransmitted, "handled again")
+	})
+
+	t.Run("nil cache never answers", func(t *testing.T) {
+		var c *responseCache
+		c.store(smreq, smres, now)
+
+		_, ok := c.lookup(smreq, now)
+		require.False(t, ok)
+	})
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// requestResync asks the PFCP node to replay all sessions into the datapath.
+// Datapaths call it once they are connected again with their rules cleared.
+func requestResync(resync chan<- struct{}) {
+	select {
+	case resync <- struct{}{}:
+	default:
+		// a resync is already pending
+	}
+}
+
+// resyncResult counts the sessions replayed into the datapath.
+type resyncResult struct {
+	sessions int
+	replayed int
+	failed   int
+}
+
+// resyncDatapath replays the slice meters and the rules of all stored sessions
+// into the datapath, which is expected to hold no rules.
+func (node *PFCPNode) resyncDatapath() resyncResult {
+	var result resyncResult
+
+	upf := node.upf
+
+	if !upf.isConnected() {
+		log.Warnln("Datapath not connected, skipping resync")
+		return result
+	}
+
+	for _, sliceInfo := range upf.getSliceInfos() {
+		if err := upf.AddSliceInfo(sliceInfo); err != nil {
+			log.Errorln("Failed to restore meters of slice", sliceInfo.name, ":", err)
+		}
+	}
+
+	node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+
+		for _, session := range pConn.store.GetAllSessions() {
+			result.sessions++
+
+			cause := upf.sendSessionRules(upfMsgTypeAdd, session.PacketForwardingRules, session.PacketForwardingRules)
+			if cause != ie.CauseRequestAccepted {
+				log.WithFields(log.Fields{
+					"F-SEID":  session.localSEID,
+					"CP node": pConn.nodeID.remote,
+				}).Error("Failed to replay session into datapath")
+
+				result.failed++
+
+				continue
+			}
+
+			result.replayed++
+		}
+
+		return true
+	})
+
+	logger := log.WithFields(log.Fields{
+		"sessions": result.sessions,
+		"replayed": result.replayed,
+		"failed":   result.failed,
+	})
+
+	if result.replayed != result.sessions {
+		logger.Error("Datapath resync incomplete, some sessions are not forwarded")
+	} else {
+		logger.Info("Datapath resync completed")
+	}
+
+	return result
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+type resyncDatapath struct {
+	datapath
+	connected bool
+	rejected  uint64
+	added     []uint64
+	slices    int
+}
+
+func (d *resyncDatapath) IsConnected(accessIP *net.IP) bool {
+	return d.connected
+}
+
+func (d *resyncDatapath) AddSliceInfo(sliceInfo *SliceInfo) error {
+	d.slices++
+	return nil
+}
+
+func (d *resyncDatapath) WriteSessionBatch(method upfMsgType, all, updated PacketForwardingRules) error {
+	return ErrUnsupported("batched rules", "test")
+}
+
+func (d *resyncDatapath) SendMsgToUPF(method upfMsgType, all, updated PacketForwardingRules) uint8 {
+	fseid := all.pdrs[0].fseID
+	if fseid == d.rejected {
+		return ie.CauseRequestRejected
+	}
+
+	d.added = append(d.added, fseid)
+
+	return ie.CauseRequestAccepted
+}
+
+func TestPFCPNode_resyncDatapath(t *testing.T) {
+	dp := &resyncDatapath{rejected: 2}
+	node := &PFCPNode{upf: &upf{datapath: dp, slices: map[string]*SliceInfo{"slice": {name: "slice"}}}}
+
+	store := NewInMemoryStore()
+
+	for _, fseid := range []uint64{1, 2, 3} {
+		session := PFCPSession{
+			localSEID:             fseid,
+			PacketForwardingRules: PacketForwardingRules{pdrs: []pdr{{fseID: fseid, pdrID: 1}}},
+		}
+		require.NoError(t, store.PutSession(session, nil, false, 0))
+	}
+
+	node.pConns.Store("198.18.0.1:8805", &PFCPConn{store: store})
+
+	t.Run("skipped while disconnected", func(t *testing.T) {
+		require.Equal(t, resyncResult{}, node.resyncDatapath())
+		require.Empty(t, dp.added)
+	})
+
+	t.Run("replays all sessions", func(t *testing.T) {
+		dp.connected = true
+
+		require.Equal(t, resyncResult{sessions: 3, replayed: 2, failed: 1}, node.resyncDatapath())
+		require.ElementsMatch(t, []uint64{1, 3}, dp.added)
+		require.Equal(t, 1, dp.slices)
+	})
+
+	t.Run("pending requests are coalesced", func(t *testing.T) {
+		resync := make(chan struct{}, 1)
+		requestResync(resync)
+		requestResync(resync)
+		require.Len(t, resync, 1)
+	})
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+// ratesOnlyChange reports whether q differs from old in its bit rates only.
+func (q qer) ratesOnlyChange(old qer) bool {
+	old.ulMbr, old.dlMbr, old.ulGbr, old.dlGbr = q.ulMbr, q.dlMbr, q.ulGbr, q.dlGbr
+
+	return q == old
+}
+
+// tunnelOnlyChange reports whether f differs from old in its action and outer
+// header only, e.g. the gNB tunnel switched on a handover.
+func (f far) tunnelOnlyChange(old far) bool {
+	old.applyAction, old.sendEndMarker = f.applyAction, f.sendEndMarker
+	old.tunnelType, old.tunnelIP4Src, old.tunnelIP4Dst = f.tunnelType, f.tunnelIP4Src, f.tunnelIP4Dst
+	old.tunnelTEID, old.tunnelPort = f.tunnelTEID, f.tunnelPort
+
+	return f == old
+}
+
+// updatableInPlace reports whether the rules updated in a session previously holding
+// before are FARs whose tunnel changed and QERs whose rates changed, and nothing else.
+// Those are updated without rewriting the other rules of the session.
+func updatableInPlace(before PacketForwardingRules, updated PacketForwardingRules) bool {
+	if len(updated.pdrs) > 0 || len(updated.urrs) > 0 || len(updated.bars) > 0 {
+		return false
+	}
+
+	if len(updated.fars) == 0 && len(updated.qers) == 0 {
+		return false
+	}
+
+	for _, f := range updated.fars {
+		old, ok := findFAR(before.fars, f.farID)
+		if !ok || !f.tunnelOnlyChange(old) {
+			return false
+		}
+	}
+
+	for _, q := range updated.qers {
+		old, ok := findQER(before.qers, q.qerID)
+		if !ok || !q.ratesOnlyChange(old) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func findFAR(fars []far, id uint32) (far, bool) {
+	for _, f := range fars {
+		if f.farID == id {
+			return f, true
+		}
+	}
+
+	return far{}, false
+}
+
+func findQER(qers []qer, id uint32) (qer, bool) {
+	for _, q := range qers {
+		if q.qerID == id {
+			return q, true
+		}
+	}
+
+	return qer{}, false
+}
+
+// updateRulesInPlace writes the updated FARs and QERs of the session of all one by
+// one, ErrUnsupported if the datapath cannot.
+func (u *upf) updateRulesInPlace(all PacketForwardingRules, updated PacketForwardingRules) error {
+	for _, q := range updated.qers {
+		if err := u.UpdateQERRates(q, all); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range updated.fars {
+		if err := u.UpdateFARTunnel(f, all); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func Test_updatableInPlace(t *testing.T) {
+	before := PacketForwardingRules{
+		pdrs: []pdr{{fseID: 1, pdrID: 1, farID: 1, qerIDList: []uint32{1}}},
+		fars: []far{{fseID: 1, farID: 1, applyAction: ActionBuffer, dstIntf: ie.DstInterfaceAccess}},
+		qers: []qer{{fseID: 1, qerID: 1, qfi: 9, ulMbr: 1000, dlMbr: 2000}},
+	}
+
+	handover := before.fars[0]
+	handover.applyAction = ActionForward
+	handover.tunnelIP4Dst = ip2int([]byte{198, 18, 0, 10})
+	handover.tunnelTEID = 7
+
+	rates := before.qers[0]
+	rates.dlMbr = 4000
+
+	for _, scenario := range []struct {
+		description string
+		updated     PacketForwardingRules
+		expected    bool
+	}{
+		{
+			description: "tunnel and rates updated",
+			updated:     PacketForwardingRules{fars: []far{handover}, qers: []qer{rates}},
+			expected:    true,
+		},
+		{
+			description: "destination interface updated",
+			updated:     PacketForwardingRules{fars: []far{{fseID: 1, farID: 1, dstIntf: ie.DstInterfaceCore}}},
+		},
+		{
+			description: "QFI updated",
+			updated:     PacketForwardingRules{qers: []qer{{fseID: 1, qerID: 1, qfi: 5, ulMbr: 1000, dlMbr: 2000}}},
+		},
+		{
+			description: "FAR created",
+			updated:     PacketForwardingRules{fars: []far{{fseID: 1, farID: 2}}},
+		},
+		{
+			description: "PDR updated",
+			updated:     PacketForwardingRules{pdrs: before.pdrs, fars: []far{handover}},
+		},
+		{
+			description: "nothing updated",
+		},
+	} {
+		t.Run(scenario.description, func(t *testing.T) {
+			require.Equal(t, scenario.expected, updatableInPlace(before, scenario.updated))
+		})
+	}
+}
+
+type inPlaceUnsupportedDatapath struct {
+	fakeDatapath
+}
+
+func (d *inPlaceUnsupportedDatapath) UpdateFARTunnel(f far, all PacketForwardingRules) error {
+	return ErrUnsupported("in-place rule updates", "test")
+}
+
+func Test_datapathWrite_inPlace(t *testing.T) {
+	p := pdr{srcIface: core, fseID: 1, pdrID: 1, farID: 1}
+	f := far{fseID: 1, farID: 1, applyAction: ActionForward, dstIntf: ie.DstInterfaceAccess}
+	all := PacketForwardingRules{pdrs: []pdr{p}, fars: []far{f}}
+	write := datapathWrite{
+		method:  upfMsgTypeMod,
+		all:     all,
+		updated: PacketForwardingRules{fars: []far{f}},
+		batch:   true,
+		inPlace: true,
+	}
+
+	lastOp := func(fp *fakeDatapath) string {
+		ops := fp.state().Operations
+		return ops[len(ops)-1].Method
+	}
+
+	t.Run("updated in place", func(t *testing.T) {
+		fp := &fakeDatapath{}
+		fp.SetUpfInfo(&upf{}, &Conf{})
+
+		require.Equal(t, uint8(ie.CauseRequestAccepted), write.send(&upf{datapath: fp}))
+		require.Equal(t, "update FAR tunnel", lastOp(fp))
+	})
+
+	t.Run("rewritten if the datapath cannot", func(t *testing.T) {
+		fp := &inPlaceUnsupportedDatapath{}
+		fp.SetUpfInfo(&upf{}, &Conf{})
+
+		require.Equal(t, uint8(ie.CauseRequestAccepted), write.send(&upf{datapath: fp}))
+		require.Equal(t, "batch modify", lastOp(&fp.fakeDatapath))
+	})
+}
@@ -0,0 +1,250 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// The canary session of the self-test. Its F-SEID and TEID are out of the ranges used
+// by the CP nodes, its UE address in the benchmarking range and its packet is sent to
+// the discard port of a documentation address.
+const (
+	selfTestSEID           = math.MaxUint64
+	selfTestTEID           = 0xfffffffe
+	selfTestUEIP           = "198.19.255.254"
+	selfTestDstIP          = "192.0.2.1"
+	selfTestDstPort        = 9
+	selfTestTimeoutDefault = 2 * time.Second
+	selfTestPollInterval   = 100 * time.Millisecond
+)
+
+// selfTestRules are the rules of the canary session: an uplink PDR from the N3 address
+// of the UPF forwarding to the core.
+func selfTestRules(u *upf) PacketForwardingRules {
+	return PacketForwardingRules{
+		pdrs: []pdr{{
+			srcIface:     access,
+			tunnelIP4Dst: ip2int(u.AccessIP),
+			tunnelTEID:   selfTestTEID,
+			appFilter: applicationFilter{
+				srcIP:     ip2int(net.ParseIP(selfTestUEIP)),
+				srcIPMask: math.MaxUint32,
+			},
+			srcIfaceMask:     0xff,
+			tunnelIP4DstMask: math.MaxUint32,
+			tunnelTEIDMask:   math.MaxUint32,
+			precedence:       255,
+			pdrID:            1,
+			fseID:            selfTestSEID,
+			farID:            1,
+			qerIDList:        []uint32{2, 1},
+			needDecap:        1,
+		}},
+		fars: []far{{
+			farID:       1,
+			fseID:       selfTestSEID,
+			applyAction: ActionForward,
+			dstIntf:     ie.DstInterfaceCore,
+		}},
+		qers: []qer{
+			{
+				qerID:    1,
+				fseID:    selfTestSEID,
+				qosLevel: SessionQos,
+				ulMbr:    100000,
+				dlMbr:    100000,
+			},
+			{
+				qerID: 2,
+				fseID: selfTestSEID,
+				qfi:   9,
+				ulMbr: 100000,
+				dlMbr: 100000,
+			},
+		},
+	}
+}
+
+// selfTestPacket returns the G-PDU of the canary session, a UDP datagram of the UE.
+func selfTestPacket() ([]byte, error) {
+	ipLayer := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		SrcIP:    net.ParseIP(selfTestUEIP).To4(),
+		DstIP:    net.ParseIP(selfTestDstIP).To4(),
+		Protocol: layers.IPProtocolUDP,
+	}
+	udpLayer := &layers.UDP{
+		SrcPort: selfTestDstPort,
+		DstPort: selfTestDstPort,
+	}
+
+	if err := udpLayer.SetNetworkLayerForChecksum(ipLayer); err != nil {
+		return nil, err
+	}
+
+	gtpLayer := &layers.GTPv1U{
+		Version:      1,
+		ProtocolType: 1,
+		MessageType:  gtpuMessageTypeGPDU,
+		TEID:         selfTestTEID,
+	}
+
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{
+		ComputeChecksums: true,
+		FixLengths:       true,
+	}
+
+	err := gopacket.SerializeLayers(buffer, options,
+		gtpLayer,
+		ipLayer,
+		udpLayer,
+		gopacket.Payload("upf self-test"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// selfTest installs the canary session, sends its G-PDU to the N3 address of the UPF
+// and waits up to timeout for the datapath to count it. The session is removed in any
+// case. Returns the number of packets counted.
+func (u *upf) selfTest(timeout time.Duration) (uint64, error) {
+	if !u.isConnected() {
+		return 0, errDatapathDown
+	}
+
+	if u.AccessIP == nil {
+		return 0, ErrOperationFailedWithReason("self-test", "no N3 address")
+	}
+
+	rules := selfTestRules(u)
+	key := pdrCounterKey{fseID: selfTestSEID, pdrID: rules.pdrs[0].pdrID}
+
+	if cause := u.sendSessionRules(upfMsgTypeAdd, rules, rules); cause != ie.CauseRequestAccepted {
+		return 0, ErrOperationFailedWithParam("self-test session install", "cause", cause)
+	}
+
+	defer u.SendMsgToUPF(upfMsgTypeDel, rules, PacketForwardingRules{})
+
+	before, err := u.ReadPDRCounters(rules.pdrs)
+	if err != nil {
+		return 0, err
+	}
+
+	pkt, err := selfTestPacket()
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := net.Dial("udp", net.JoinHostPort(u.AccessIP.String(), strconv.Itoa(tunnelGTPUPort)))
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(pkt); err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		time.Sleep(selfTestPollInterval)
+
+		after, err := u.ReadPDRCounters(rules.pdrs)
+		if err != nil {
+			return 0, err
+		}
+
+		if packets := after[key].packets - before[key].packets; packets > 0 {
+			return packets, nil
+		}
+
+		if time.Now().After(deadline) {
+			return 0, ErrOperationFailedWithReason("self-test", "no packet counted within "+timeout.String())
+		}
+	}
+}
+
+// selfTestResult is the outcome of a self-test.
+type selfTestResult struct {
+	Passed   bool    `json:"passed"`
+	Packets  uint64  `json:"packets"`
+	Duration float64 `json:"duration_seconds"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// selfTestHandler checks that the datapath forwards, for operators and CI. A failed
+// self-test is answered with 503, a running one with 409:
+//
+//	POST /v1/self-test[?timeout=<duration>]
+type selfTestHandler struct {
+	node    *PFCPNode
+	running int32
+}
+
+func (h *selfTestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	timeout := selfTestTimeoutDefault
+
+	if s := r.URL.Query().Get("timeout"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid timeout "+s, http.StatusBadRequest)
+			return
+		}
+
+		timeout = d
+	}
+
+	if !atomic.CompareAndSwapInt32(&h.running, 0, 1) {
+		http.Error(w, "self-test already running", http.StatusConflict)
+		return
+	}
+	defer atomic.StoreInt32(&h.running, 0)
+
+	start := time.Now()
+	packets, err := h.node.upf.selfTest(timeout)
+	result := selfTestResult{
+		Passed:   err == nil,
+		Packets:  packets,
+		Duration: time.Since(start).Seconds(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		log.Errorln("Self-test failed:", err)
+
+		result.Error = err.Error()
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		log.Infoln("Self-test passed,", packets, "packets counted")
+	}
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Errorln("Failed to encode self-test result:", err)
+	}
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// selfTestDatapath counts a packet on every read of the counters of an installed
+// session, if forwarding.
+type selfTestDatapath struct {
+	datapath
+	forwarding bool
+	installed  bool
+	packets    uint64
+}
+
+func (d *selfTestDatapath) IsConnected(accessIP *net.IP) bool {
+	return true
+}
+
+func (d *selfTestDatapath) WriteSessionBatch(method upfMsgType, all, updated PacketForwardingRules) error {
+	return ErrUnsupported("batched rules", "test")
+}
+
+func (d *selfTestDatapath) SendMsgToUPF(method upfMsgType, all, updated PacketForwardingRules) uint8 {
+	d.installed = method == upfMsgTypeAdd
+	return ie.CauseRequestAccepted
+}
+
+func (d *selfTestDatapath) ReadPDRCounters(pdrs []pdr) (map[pdrCounterKey]pdrCounters, error) {
+	if d.installed && d.forwarding {
+		d.packets++
+	}
+
+	counters := make(map[pdrCounterKey]pdrCounters)
+	for _, p := range pdrs {
+		counters[pdrCounterKey{fseID: p.fseID, pdrID: p.pdrID}] = pdrCounters{packets: d.packets}
+	}
+
+	return counters, nil
+}
+
+func Test_selfTestPacket(t *testing.T) {
+	pkt, err := selfTestPacket()
+	require.NoError(t, err)
+
+	packet := gopacket.NewPacket(pkt, layers.LayerTypeGTPv1U, gopacket.Default)
+
+	gtp, ok := packet.Layer(layers.LayerTypeGTPv1U).(*layers.GTPv1U)
+	require.True(t, ok)
+	require.Equal(t, uint32(selfTestTEID), gtp.TEID)
+	require.Equal(t, uint8(gtpuMessageTypeGPDU), gtp.MessageType)
+
+	ip, ok := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	require.True(t, ok)
+	require.Equal(t, selfTestUEIP, ip.SrcIP.String())
+}
+
+func TestSelfTestHandler(t *testing.T) {
+	dp := &selfTestDatapath{}
+	handler := &selfTestHandler{node: &PFCPNode{upf: &upf{datapath: dp, AccessIP: net.IPv4(127, 0, 0, 1)}}}
+
+	selfTest := func() (int, selfTestResult) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/self-test?timeout=200ms", nil))
+
+		var result selfTestResult
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+
+		return rec.Code, result
+	}
+
+	t.Run("fails if nothing is forwarded", func(t *testing.T) {
+		code, result := selfTest()
+		require.Equal(t, http.StatusServiceUnavailable, code)
+		require.False(t, result.Passed)
+		require.NotEmpty(t, result.Error)
+		require.False(t, dp.installed, "canary session removed")
+	})
+
+	t.Run("passes if the packet is counted", func(t *testing.T) {
+		dp.forwarding = true
+
+		code, result := selfTest()
+		require.Equal(t, http.StatusOK, code)
+		require.True(t, result.Passed)
+		require.NotZero(t, result.Packets)
+		require.Less(t, result.Duration, time.Second.Seconds())
+		require.False(t, dp.installed, "canary session removed")
+	})
+
+	t.Run("rejects other methods", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/self-test", nil))
+		require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+}
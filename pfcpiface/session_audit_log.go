@@ -0,0 +1,307 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+const (
+	auditLogMaxSizeMBDefault  = 100
+	auditLogMaxBackupsDefault = 5
+	// auditLogSyslogLocal sends the audit events to the syslog of the host.
+	auditLogSyslogLocal = "local"
+	auditLogSyslogTag   = "upf-audit"
+)
+
+// Operations of the session audit events.
+const (
+	auditOpCreate = "create"
+	auditOpModify = "modify"
+	auditOpDelete = "delete"
+)
+
+// sessionAuditEvent is a line of the session audit log.
+type sessionAuditEvent struct {
+	Time      time.Time `json:"timestamp"`
+	Peer      string    `json:"peer"`
+	SEID      uint64    `json:"seid"`
+	UEIP      string    `json:"ue_ip,omitempty"`
+	Operation string    `json:"operation"`
+	// Cause is that of the response, none for the sessions removed by the UPF.
+	Cause  uint8  `json:"cause,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// sessionAuditLog writes an event per session created, modified or deleted, as a
+// JSON line, to a rotated file and/or a syslog server.
+type sessionAuditLog struct {
+	mu      sync.Mutex
+	writers []io.Writer
+	closers []io.Closer
+}
+
+func newSessionAuditLog(conf AuditLogInfo) (*sessionAuditLog, error) {
+	a := &sessionAuditLog{}
+
+	if conf.Path != "" {
+		f, err := newRotatingFile(conf.Path, int64(conf.MaxSizeMB)<<20, conf.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+
+		a.writers = append(a.writers, f)
+		a.closers = append(a.closers, f)
+	}
+
+	if conf.Syslog != "" {
+		var (
+			w   *syslog.Writer
+			err error
+		)
+
+		priority := syslog.LOG_INFO | syslog.LOG_AUTHPRIV
+
+		if conf.Syslog == auditLogSyslogLocal {
+			w, err = syslog.New(priority, auditLogSyslogTag)
+		} else {
+			u, _ := url.Parse(conf.Syslog)
+			w, err = syslog.Dial(u.Scheme, u.Host, priority, auditLogSyslogTag)
+		}
+
+		if err != nil {
+			a.close()
+			return nil, ErrOperationFailedWithReason("audit log syslog", err.Error())
+		}
+
+		a.writers = append(a.writers, w)
+		a.closers = append(a.closers, w)
+	}
+
+	return a, nil
+}
+
+// record writes e. Nothing is written to a nil audit log.
+func (a *sessionAuditLog) record(e sessionAuditEvent) {
+	if a == nil {
+		return
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Errorln("Failed to encode audit event:", err)
+		return
+	}
+
+	b = append(b, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, w := range a.writers {
+		if _, err := w.Write(b); err != nil {
+			log.Errorln("Failed to write audit event:", err)
+		}
+	}
+}
+
+func (a *sessionAuditLog) close() {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, c := range a.closers {
+		c.Close()
+	}
+
+	a.writers, a.closers = nil, nil
+}
+
+// sessionUEIP returns the UE IPv4 address of session, empty if it has none.
+func sessionUEIP(session PFCPSession) string {
+	for _, p := range session.pdrs {
+		if p.srcIface == core && p.ueAddress != 0 {
+			return int2ip(p.ueAddress).String()
+		}
+	}
+
+	return ""
+}
+
+// sessionEvents returns the function recording the audit event of the session request
+// msg once answered by reply, and notifying the webhooks of the sessions created and
+// deleted. Nil unless msg is a session request and auditing or webhooks are enabled.
+func (pConn *PFCPConn) sessionEvents(msg message.Message) func(reply message.Message) {
+	if pConn.upf.auditLog == nil && pConn.upf.webhooks == nil {
+		return nil
+	}
+
+	var op string
+
+	switch msg.(type) {
+	case *message.SessionEstablishmentRequest:
+		op = auditOpCreate
+	case *message.SessionModificationRequest:
+		op = auditOpModify
+	case *message.SessionDeletionRequest:
+		op = auditOpDelete
+	default:
+		return nil
+	}
+
+	// The UE IP of a deleted session is only known before its deletion.
+	seid := msg.SEID()
+
+	var ueIP string
+	if session, ok := pConn.store.GetSession(seid); ok {
+		ueIP = sessionUEIP(session)
+	}
+
+	return func(reply message.Message) {
+		// Sessions are identified by the SEID of the UPF, only known once established.
+		if r, ok := reply.(*message.SessionEstablishmentResponse); ok && r.UPFSEID != nil {
+			if fseid, err := r.UPFSEID.FSEID(); err == nil {
+				seid = fseid.SEID
+			}
+		}
+
+		if session, ok := pConn.store.GetSession(seid); ok {
+			ueIP = sessionUEIP(session)
+		}
+
+		e := sessionAuditEvent{
+			Time:      time.Now(),
+			Peer:      pConn.nodeID.remote,
+			SEID:      seid,
+			UEIP:      ueIP,
+			Operation: op,
+		}
+
+		if reply != nil {
+			e.Cause = replyCause(reply)
+		}
+
+		pConn.upf.auditLog.record(e)
+
+		if e.Cause != ie.CauseRequestAccepted || op == auditOpModify {
+			return
+		}
+
+		event := webhookEvent{Event: webhookSessionCreated, SEID: seid, UEIP: ueIP}
+		if op == auditOpDelete {
+			event.Event = webhookSessionDeleted
+		}
+
+		pConn.notifyWebhooks(event)
+	}
+}
+
+// replyCause returns the cause of a session response, 0 if missing.
+func replyCause(reply message.Message) uint8 {
+	var cause *ie.IE
+
+	switch r := reply.(type) {
+	case *message.SessionEstablishmentResponse:
+		cause = r.Cause
+	case *message.SessionModificationResponse:
+		cause = r.Cause
+	case *message.SessionDeletionResponse:
+		cause = r.Cause
+	}
+
+	if cause == nil {
+		return 0
+	}
+
+	value, _ := cause.Cause()
+
+	return value
+}
+
+// rotatingFile is a file renamed with a .1 suffix, and older ones up to .<backups>,
+// once larger than maxSize.
+type rotatingFile struct {
+	path    string
+	maxSize int64
+	backups int
+
+	f    *os.File
+	size int64
+}
+
+func newRotatingFile(path string, maxSize int64, backups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, backups: backups}
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.f, r.size = f, info.Size()
+
+	return nil
+}
+
+func (r *rotatingFile) Write(b []byte) (int, error) {
+	if r.size > 0 && r.size+int64(len(b)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(b)
+	r.size += int64(n)
+
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	r.f.Close()
+
+	for i := r.backups; i > 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", r.path, i-1), fmt.Sprintf("%s.%d", r.path, i))
+	}
+
+	if r.backups > 0 {
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	return r.f.Close()
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+func readAuditEvents(t *testing.T, path string) []sessionAuditEvent {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	var events []sessionAuditEvent
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e sessionAuditEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		events = append(events, e)
+	}
+
+	return events
+}
+
+func TestPFCPConn_sessionEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	auditLog, err := newSessionAuditLog(AuditLogInfo{Enable: true, Path: path, MaxSizeMB: 1, MaxBackups: 1})
+	require.NoError(t, err)
+
+	pConn := &PFCPConn{upf: &upf{auditLog: auditLog}, store: NewInMemoryStore()}
+	pConn.nodeID.remote = "198.18.0.2"
+
+	session := PFCPSession{localSEID: 5}
+	session.pdrs = []pdr{{srcIface: core, ueAddress: ip2int(net.ParseIP("10.250.0.1"))}}
+
+	cpFSEID := ie.NewFSEID(3, net.ParseIP("198.18.0.2"), nil)
+	upFSEID := ie.NewFSEID(5, net.ParseIP("198.18.0.1"), nil)
+	accepted := ie.NewCause(ie.CauseRequestAccepted)
+
+	audit := pConn.sessionEvents(message.NewSessionEstablishmentRequest(0, 0, 0, 1, 0, cpFSEID))
+	require.NoError(t, pConn.store.PutSession(session, nil, false, 0))
+	audit(message.NewSessionEstablishmentResponse(0, 0, 3, 1, 0, accepted, upFSEID))
+
+	audit = pConn.sessionEvents(message.NewSessionModificationRequest(0, 0, 5, 2, 0))
+	audit(message.NewSessionModificationResponse(0, 0, 3, 2, 0, ie.NewCause(ie.CauseSessionContextNotFound)))
+
+	audit = pConn.sessionEvents(message.NewSessionDeletionRequest(0, 0, 5, 3, 0))
+	require.NoError(t, pConn.store.DeleteSession(5, nil))
+	audit(message.NewSessionDeletionResponse(0, 0, 3, 3, 0, accepted))
+
+	require.Nil(t, pConn.sessionEvents(message.NewHeartbeatRequest(4, nil, nil)))
+
+	auditLog.close()
+
+	events := readAuditEvents(t, path)
+	require.Len(t, events, 3)
+
+	for i, want := range []struct {
+		op    string
+		cause uint8
+	}{
+		{auditOpCreate, ie.CauseRequestAccepted},
+		{auditOpModify, ie.CauseSessionContextNotFound},
+		{auditOpDelete, ie.CauseRequestAccepted},
+	} {
+		require.Equal(t, want.op, events[i].Operation)
+		require.Equal(t, want.cause, events[i].Cause)
+		require.Equal(t, "198.18.0.2", events[i].Peer)
+		require.Equal(t, uint64(5), events[i].SEID)
+		require.Equal(t, "10.250.0.1", events[i].UEIP)
+	}
+
+	t.Run("nothing is audited when disabled", func(t *testing.T) {
+		pConn := &PFCPConn{upf: &upf{}, store: NewInMemoryStore()}
+		require.Nil(t, pConn.sessionEvents(message.NewSessionDeletionRequest(0, 0, 5, 3, 0)))
+	})
+}
+
+func Test_rotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	f, err := newRotatingFile(path, 8, 2)
+	require.NoError(t, err)
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, f.Close())
+
+	for name, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		b, err := os.ReadFile(name)
+		require.NoError(t, err)
+		require.Equal(t, want, string(b))
+	}
+
+	_, err = os.Stat(path + ".3")
+	require.True(t, os.IsNotExist(err), "backups beyond the limit are dropped")
+}
@@ -0,0 +1,33 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+// CreateBAR appends bar to existing list of BARs in the session.
+func (s *PFCPSession) CreateBAR(b bar) {
+	s.bars = append(s.bars, b)
+}
+
+// UpdateBAR updates existing bar in the session.
+func (s *PFCPSession) UpdateBAR(b bar) error {
+	for idx, v := range s.bars {
+		if v.barID == b.barID {
+			s.bars[idx] = b
+			return nil
+		}
+	}
+
+	return ErrNotFound("BAR")
+}
+
+// RemoveBAR removes bar from existing list of BARs in the session.
+func (s *PFCPSession) RemoveBAR(id uint8) (*bar, error) {
+	for idx, v := range s.bars {
+		if v.barID == id {
+			s.bars = append(s.bars[:idx], s.bars[idx+1:]...)
+			return &v, nil
+		}
+	}
+
+	return nil, ErrNotFound("BAR")
+}
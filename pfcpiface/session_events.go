@@ -0,0 +1,339 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	sessionEventsAddressDefault   = ":8808"
+	sessionEventsQueueSizeDefault = 4096
+)
+
+// Types of the session events.
+const (
+	// sessionEventSnapshot is a session stored when the stream started, followed by
+	// sessionEventSynced once all were sent.
+	sessionEventSnapshot    = "snapshot"
+	sessionEventSynced      = "synced"
+	sessionEventEstablished = "established"
+	sessionEventModified    = "modified"
+	sessionEventDeleted     = "deleted"
+	sessionEventUsage       = "usage"
+)
+
+// usageTriggerNames are the names of the Usage Report Triggers in the usage events.
+var usageTriggerNames = []struct {
+	octet int
+	flag  uint8
+	name  string
+}{
+	{0, usageTriggerPERIO, "PERIO"},
+	{0, usageTriggerVOLTH, "VOLTH"},
+	{0, usageTriggerTIMTH, "TIMTH"},
+	{0, usageTriggerSTART, "START"},
+	{0, usageTriggerSTOPT, "STOPT"},
+	{1, usageTriggerTERMR, "TERMR"},
+}
+
+// sessionEventsServer streams the session events to a gRPC client.
+type sessionEventsServer interface {
+	watch(stream grpc.ServerStream) error
+}
+
+// sessionEventsServiceDesc describes the upf.SessionEvents service of
+// sessionevents.proto. Its messages are well-known types, so it needs no generated code.
+var sessionEventsServiceDesc = grpc.ServiceDesc{
+	ServiceName: "upf.SessionEvents",
+	HandlerType: (*sessionEventsServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       watchSessionEventsHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "sessionevents.proto",
+}
+
+func watchSessionEventsHandler(srv interface{}, stream grpc.ServerStream) error {
+	if err := stream.RecvMsg(new(emptypb.Empty)); err != nil {
+		return err
+	}
+
+	return srv.(sessionEventsServer).watch(stream)
+}
+
+// sessionFeed streams the lifecycle and usage events of the sessions of all PFCP
+// connections to the gRPC clients, so that they maintain a live view of the sessions.
+// A client falling more than queueSize events behind is disconnected.
+type sessionFeed struct {
+	address   string
+	queueSize int
+
+	mu   sync.Mutex
+	subs map[chan *structpb.Struct]struct{}
+}
+
+func newSessionFeed(conf SessionEventsInfo) *sessionFeed {
+	return &sessionFeed{
+		address:   conf.Address,
+		queueSize: conf.QueueSize,
+		subs:      make(map[chan *structpb.Struct]struct{}),
+	}
+}
+
+// newFeedEvent returns the event of type with fields, timestamped now.
+func newFeedEvent(eventType string, fields map[string]interface{}) *structpb.Struct {
+	event := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"type":      structpb.NewStringValue(eventType),
+		"timestamp": structpb.NewStringValue(time.Now().UTC().Format(time.RFC3339Nano)),
+	}}
+
+	for k, v := range fields {
+		value, err := structpb.NewValue(v)
+		if err != nil {
+			log.Errorln("Failed to encode session event field", k, ":", err)
+			continue
+		}
+
+		event.Fields[k] = value
+	}
+
+	return event
+}
+
+// watch publishes the session changes of pConn. Nothing is published by a nil feed.
+func (f *sessionFeed) watch(pConn *PFCPConn) {
+	if f == nil {
+		return
+	}
+
+	pConn.store.Watch(func(event sessionEvent) {
+		f.publish(pConn.sessionFeedEvent(event))
+	})
+}
+
+func (f *sessionFeed) publish(event *structpb.Struct) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.subs {
+		select {
+		case ch <- event:
+		default:
+			log.Warnln("Session events client too slow, disconnecting it")
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (f *sessionFeed) subscribe() chan *structpb.Struct {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan *structpb.Struct, f.queueSize)
+	f.subs[ch] = struct{}{}
+
+	return ch
+}
+
+func (f *sessionFeed) unsubscribe(ch chan *structpb.Struct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.subs[ch]; ok {
+		delete(f.subs, ch)
+		close(ch)
+	}
+}
+
+// run serves the feed on its address until ctx is done. snapshot returns the events
+// of the sessions stored when a client connects.
+func (f *sessionFeed) run(ctx context.Context, snapshot func() []*structpb.Struct) {
+	lis, err := net.Listen("tcp", f.address)
+	if err != nil {
+		log.Errorln("Session events feed disabled:", err)
+		return
+	}
+
+	f.serve(ctx, lis, snapshot)
+}
+
+func (f *sessionFeed) serve(ctx context.Context, lis net.Listener, snapshot func() []*structpb.Struct) {
+	server := grpc.NewServer()
+	server.RegisterService(&sessionEventsServiceDesc, &sessionFeedServer{feed: f, snapshot: snapshot})
+
+	go func() {
+		<-ctx.Done()
+		server.Stop()
+	}()
+
+	log.Infoln("Serving session events on", lis.Addr())
+
+	if err := server.Serve(lis); err != nil {
+		log.Errorln("Session events feed stopped:", err)
+	}
+}
+
+type sessionFeedServer struct {
+	feed     *sessionFeed
+	snapshot func() []*structpb.Struct
+}
+
+// watch sends the stored sessions then their changes. Changes made while the snapshot
+// is taken are sent after it, in order.
+func (s *sessionFeedServer) watch(stream grpc.ServerStream) error {
+	events := s.feed.subscribe()
+	defer s.feed.unsubscribe(events)
+
+	for _, event := range s.snapshot() {
+		if err := stream.SendMsg(event); err != nil {
+			return err
+		}
+	}
+
+	if err := stream.SendMsg(newFeedEvent(sessionEventSynced, nil)); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "too slow to receive the session events")
+			}
+
+			if err := stream.SendMsg(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sessionFeedEvent returns the event of a change of the sessions of pConn.
+func (pConn *PFCPConn) sessionFeedEvent(event sessionEvent) *structpb.Struct {
+	switch {
+	case event.deleted:
+		return newFeedEvent(sessionEventDeleted, map[string]interface{}{
+			"node_id": pConn.nodeID.remote,
+			"fseid":   strconv.FormatUint(event.fseid, 10),
+		})
+	case event.created:
+		return pConn.sessionStateEvent(sessionEventEstablished, event.session)
+	default:
+		return pConn.sessionStateEvent(sessionEventModified, event.session)
+	}
+}
+
+// sessionStateEvent returns the event of type carrying the state of session. SEIDs
+// are strings, as the numbers of the events are doubles.
+func (pConn *PFCPConn) sessionStateEvent(eventType string, session PFCPSession) *structpb.Struct {
+	ueIPs := make([]interface{}, 0, 1)
+	seen := make(map[uint32]bool)
+
+	for _, p := range session.pdrs {
+		if p.ueAddress != 0 && !seen[p.ueAddress] {
+			seen[p.ueAddress] = true
+			ueIPs = append(ueIPs, int2ip(p.ueAddress).String())
+		}
+	}
+
+	return newFeedEvent(eventType, map[string]interface{}{
+		"node_id":     pConn.nodeID.remote,
+		"fseid":       strconv.FormatUint(session.localSEID, 10),
+		"remote_seid": strconv.FormatUint(session.remoteSEID, 10),
+		"ue_ips":      ueIPs,
+		"pdrs":        len(session.pdrs),
+		"fars":        len(session.fars),
+		"qers":        len(session.qers),
+		"urrs":        len(session.urrs),
+	})
+}
+
+// publishUsage publishes the usage reports of session sent to the CP.
+func (pConn *PFCPConn) publishUsage(session PFCPSession, reports []*ie.IE) {
+	feed := pConn.upf.sessionEvents
+	if feed == nil {
+		return
+	}
+
+	for _, report := range reports {
+		urrID, err := report.URRID()
+		if err != nil {
+			continue
+		}
+
+		fields := map[string]interface{}{
+			"node_id": pConn.nodeID.remote,
+			"fseid":   strconv.FormatUint(session.localSEID, 10),
+			"urr_id":  urrID,
+		}
+
+		if seq, err := report.URSEQN(); err == nil {
+			fields["seq"] = seq
+		}
+
+		if trigger, err := report.UsageReportTrigger(); err == nil {
+			triggers := make([]interface{}, 0, 1)
+
+			for _, t := range usageTriggerNames {
+				if t.octet < len(trigger) && trigger[t.octet]&t.flag != 0 {
+					triggers = append(triggers, t.name)
+				}
+			}
+
+			fields["triggers"] = triggers
+		}
+
+		if vol, err := report.VolumeMeasurement(); err == nil {
+			fields["uplink_bytes"] = vol.UplinkVolume
+			fields["downlink_bytes"] = vol.DownlinkVolume
+			fields["uplink_packets"] = vol.UplinkNumberOfPackets
+			fields["downlink_packets"] = vol.DownlinkNumberOfPackets
+		}
+
+		if d, err := report.DurationMeasurement(); err == nil {
+			fields["duration_seconds"] = d.Seconds()
+		}
+
+		feed.publish(newFeedEvent(sessionEventUsage, fields))
+	}
+}
+
+// sessionEventsSnapshot returns the events of the sessions of all PFCP connections.
+func (node *PFCPNode) sessionEventsSnapshot() []*structpb.Struct {
+	var events []*structpb.Struct
+
+	node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+		for _, session := range pConn.store.GetAllSessions() {
+			events = append(events, pConn.sessionStateEvent(sessionEventSnapshot, session))
+		}
+
+		return true
+	})
+
+	return events
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func Test_sessionFeed(t *testing.T) {
+	feed := newSessionFeed(SessionEventsInfo{QueueSize: 16})
+
+	node := &PFCPNode{}
+	pConn := &PFCPConn{store: NewInMemoryStore(), upf: &upf{sessionEvents: feed}}
+	pConn.nodeID.remote = "smf"
+
+	feed.watch(pConn)
+	node.pConns.Store("smf", pConn)
+
+	require.NoError(t, pConn.store.PutSession(newReplicatedTestSession(1), pConn, false, 0))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go feed.serve(ctx, lis, node.sessionEventsSnapshot)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	stream, err := conn.NewStream(ctx, &sessionEventsServiceDesc.Streams[0], "/upf.SessionEvents/Watch")
+	require.NoError(t, err)
+	require.NoError(t, stream.SendMsg(&emptypb.Empty{}))
+	require.NoError(t, stream.CloseSend())
+
+	recv := func() map[string]interface{} {
+		event := &structpb.Struct{}
+		require.NoError(t, stream.RecvMsg(event))
+
+		return event.AsMap()
+	}
+
+	snapshot := recv()
+	require.Equal(t, sessionEventSnapshot, snapshot["type"])
+	require.Equal(t, "1", snapshot["fseid"])
+	require.Equal(t, "smf", snapshot["node_id"])
+	require.Equal(t, []interface{}{"10.250.0.1"}, snapshot["ue_ips"])
+
+	require.Equal(t, sessionEventSynced, recv()["type"])
+
+	require.NoError(t, pConn.store.PutSession(newReplicatedTestSession(2), pConn, false, 0))
+	require.NoError(t, pConn.store.PutSession(newReplicatedTestSession(2), pConn, false, 0))
+	require.NoError(t, pConn.store.DeleteSession(2, pConn))
+
+	pConn.publishUsage(PFCPSession{localSEID: 1}, []*ie.IE{
+		ie.NewUsageReportWithinSessionReportRequest(
+			ie.NewURRID(10),
+			ie.NewURSEQN(3),
+			ie.NewUsageReportTrigger(usageTriggerVOLTH, 0, 0),
+			ie.NewVolumeMeasurement(volumeMeasurementAll, 300, 100, 200, 3, 1, 2),
+		),
+	})
+
+	for _, expected := range []string{sessionEventEstablished, sessionEventModified, sessionEventDeleted} {
+		event := recv()
+		require.Equal(t, expected, event["type"])
+		require.Equal(t, "2", event["fseid"])
+	}
+
+	usage := recv()
+	require.Equal(t, sessionEventUsage, usage["type"])
+	require.Equal(t, float64(10), usage["urr_id"])
+	require.Equal(t, []interface{}{"VOLTH"}, usage["triggers"])
+	require.Equal(t, float64(100), usage["uplink_bytes"])
+	require.Equal(t, float64(2), usage["downlink_packets"])
+}
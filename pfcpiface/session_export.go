@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// sessionDump holds the sessions of a CP node, as exported by GET /v1/sessions/export
+// and imported by POST /v1/sessions/import.
+type sessionDump struct {
+	NodeID string `json:"node_id"`
+	// Peer is the address of the PFCP connection of the CP node.
+	Peer     string          `json:"peer"`
+	Sessions []sessionRecord `json:"sessions"`
+}
+
+// sessionImportResult counts the sessions of an import.
+type sessionImportResult struct {
+	Imported int `json:"imported"`
+	// Skipped are the sessions whose F-SEID is already in use.
+	Skipped int `json:"skipped"`
+	Failed  int `json:"failed"`
+}
+
+// sessionExportHandler dumps the full state of the sessions, e.g. for a bug report:
+//
+//	GET /v1/sessions/export[?node=<node ID>]
+type sessionExportHandler struct {
+	node *PFCPNode
+}
+
+func (h *sessionExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	nodeID := r.URL.Query().Get("node")
+	dumps := make([]sessionDump, 0)
+
+	h.node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+		if nodeID != "" && pConn.nodeID.remote != nodeID {
+			return true
+		}
+
+		dump := sessionDump{
+			NodeID:   pConn.nodeID.remote,
+			Peer:     pConn.RemoteAddr().String(),
+			Sessions: make([]sessionRecord, 0),
+		}
+
+		for _, s := range pConn.store.GetAllSessions() {
+			dump.Sessions = append(dump.Sessions, newSessionRecord(s))
+		}
+
+		sort.Slice(dump.Sessions, func(i, j int) bool { return dump.Sessions[i].LocalSEID < dump.Sessions[j].LocalSEID })
+
+		dumps = append(dumps, dump)
+
+		return true
+	})
+
+	sort.Slice(dumps, func(i, j int) bool { return dumps[i].NodeID < dumps[j].NodeID })
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(dumps); err != nil {
+		log.Errorln("Failed to encode sessions:", err)
+	}
+}
+
+// sessionImportHandler replays exported sessions into the store and the datapath, e.g.
+// on a development UPF with the fake datapath. The sessions of a CP node without a
+// PFCP connection are given a connection to its exported peer address:
+//
+//	POST /v1/sessions/import
+type sessionImportHandler struct {
+	node *PFCPNode
+}
+
+func (h *sessionImportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var dumps []sessionDump
+	if err := json.NewDecoder(r.Body).Decode(&dumps); err != nil {
+		http.Error(w, "invalid session dump: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, dump := range dumps {
+		if dump.NodeID == "" {
+			http.Error(w, "node_id missing from session dump", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var result sessionImportResult
+
+	for _, dump := range dumps {
+		pConn := h.node.pConnByNodeID(dump.NodeID)
+		if pConn == nil {
+			if pConn = h.node.NewPFCPConn(h.node.LocalAddr().String(), dump.Peer, nil); pConn == nil {
+				result.Failed += len(dump.Sessions)
+				continue
+			}
+
+			pConn.nodeID.remote = dump.NodeID
+		}
+
+		for _, record := range dump.Sessions {
+			h.importSession(pConn, record, &result)
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"imported": result.Imported,
+		"skipped":  result.Skipped,
+		"failed":   result.Failed,
+	}).Warn("Imported sessions")
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Errorln("Failed to encode session import result:", err)
+	}
+}
+
+// importSession stores the session of record and writes its rules to the datapath.
+// A session whose F-SEID is in use is skipped.
+func (h *sessionImportHandler) importSession(pConn *PFCPConn, record sessionRecord, result *sessionImportResult) {
+	logger := log.WithFields(log.Fields{
+		"F-SEID":  record.LocalSEID,
+		"CP node": pConn.nodeID.remote,
+	})
+
+	if _, ok := pConn.store.GetSession(record.LocalSEID); ok {
+		logger.Warn("Session already exists, skipping import")
+
+		result.Skipped++
+
+		return
+	}
+
+	if err := pConn.adoptSession(record); err != nil {
+		logger.Errorln("Failed to import session:", err)
+
+		result.Failed++
+
+		return
+	}
+
+	session, _ := pConn.store.GetSession(record.LocalSEID)
+
+	cause := pConn.upf.sendSessionRules(upfMsgTypeAdd, session.PacketForwardingRules, session.PacketForwardingRules)
+	if cause != ie.CauseRequestAccepted {
+		logger.Error("Failed to write imported session to datapath")
+		pConn.RemoveSession(session)
+
+		result.Failed++
+
+		return
+	}
+
+	result.Imported++
+}
+
+// pConnByNodeID returns the PFCP connection of the CP node nodeID, nil if none.
+func (node *PFCPNode) pConnByNodeID(nodeID string) *PFCPConn {
+	var found *PFCPConn
+
+	node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+		if pConn.nodeID.remote == nodeID {
+			found = pConn
+			return false
+		}
+
+		return true
+	})
+
+	return found
+}
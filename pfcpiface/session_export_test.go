@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionExportImport(t *testing.T) {
+	m := &sessionGCMetrics{reclaimed: make(map[string]int)}
+
+	src := &upf{datapath: &resyncDatapath{connected: true}, usageWheel: newTimerWheel()}
+	srcNode := &PFCPNode{upf: src}
+	srcNode.pConns.Store("smf", newSessionGCConn(t, src, m, 1, 2))
+
+	rec := httptest.NewRecorder()
+	(&sessionExportHandler{node: srcNode}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/sessions/export", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var dumps []sessionDump
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &dumps))
+	require.Len(t, dumps, 1)
+	require.Equal(t, "smf", dumps[0].NodeID)
+	require.Equal(t, "127.0.0.1:8805", dumps[0].Peer)
+	require.Len(t, dumps[0].Sessions, 2)
+	require.Equal(t, uint64(1), dumps[0].Sessions[0].LocalSEID)
+
+	dp := &resyncDatapath{connected: true, rejected: 2}
+	dst := &upf{datapath: dp, usageWheel: newTimerWheel()}
+	dstNode := &PFCPNode{upf: dst}
+	dstConn := newSessionGCConn(t, dst, m)
+	dstNode.pConns.Store("smf", dstConn)
+
+	importSessions := func(body []byte) sessionImportResult {
+		rec := httptest.NewRecorder()
+		(&sessionImportHandler{node: dstNode}).ServeHTTP(rec,
+			httptest.NewRequest(http.MethodPost, "/v1/sessions/import", bytes.NewReader(body)))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var result sessionImportResult
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+
+		return result
+	}
+
+	require.Equal(t, sessionImportResult{Imported: 1, Failed: 1}, importSessions(rec.Body.Bytes()))
+	require.Equal(t, []uint64{1}, dp.added)
+
+	session, ok := dstConn.store.GetSession(1)
+	require.True(t, ok)
+	require.Len(t, session.pdrs, 1)
+	require.WithinDuration(t, time.Now(), session.metrics.CreatedAt, time.Minute)
+
+	_, ok = dstConn.store.GetSession(2)
+	require.False(t, ok, "session rejected by the datapath removed")
+
+	dp.rejected = 0
+	require.Equal(t, sessionImportResult{Imported: 1, Skipped: 1}, importSessions(rec.Body.Bytes()))
+
+	t.Run("dump without node ID", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		(&sessionImportHandler{node: dstNode}).ServeHTTP(rec,
+			httptest.NewRequest(http.MethodPost, "/v1/sessions/import", bytes.NewReader([]byte(`[{"sessions":[]}]`))))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -78,6 +78,11 @@ func (s *PFCPSession) UpdateFAR(f *far, endMarkerList *[][]byte) error {
 				addEndMarker(v, endMarkerList)
 			}
 
+			// The copies keep their tunnel unless the Duplicating Parameters are updated.
+			if f.Duplicates() && f.dup == (farDuplication{}) {
+				f.dup = v.dup
+			}
+
 			s.fars[idx] = *f
 
 			return nil
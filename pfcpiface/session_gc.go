@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	sessionGCIntervalDefault    = 30 * time.Second
+	sessionGCGracePeriodDefault = 5 * time.Minute
+)
+
+// Reasons of the loss of the association owning the sessions of a connection.
+const (
+	// orphanHeartbeatFailure is a CP node no longer answering heartbeats, with the
+	// alarm or keep heartbeat failure action.
+	orphanHeartbeatFailure = "heartbeat_failure"
+	// orphanReleased is an association released by the CP node without deleting its
+	// sessions.
+	orphanReleased = "association_released"
+)
+
+// sessionGC removes the sessions of the connections whose association has been gone
+// longer than gracePeriod.
+type sessionGC struct {
+	interval    time.Duration
+	gracePeriod time.Duration
+}
+
+func newSessionGC(conf SessionGCInfo) *sessionGC {
+	return &sessionGC{
+		interval:    validDuration(conf.Interval),
+		gracePeriod: validDuration(conf.GracePeriod),
+	}
+}
+
+// associationLoss records since when, and why, the association of a connection is gone.
+type associationLoss struct {
+	mu     sync.Mutex
+	since  time.Time
+	reason string
+}
+
+// lost records the association gone for reason. A release supersedes a heartbeat
+// failure, as the CP node answering again does not bring it back.
+func (l *associationLoss) lost(reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.since.IsZero() {
+		l.since = time.Now()
+	}
+
+	if l.reason != orphanReleased {
+		l.reason = reason
+	}
+}
+
+// regained clears a loss for reason, or for any reason if reason is empty, e.g. on a
+// new association.
+func (l *associationLoss) regained(reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if reason == "" || reason == l.reason {
+		l.since, l.reason = time.Time{}, ""
+	}
+}
+
+// lostSince returns since when and why the association is gone, a zero time if it is not.
+func (l *associationLoss) lostSince() (time.Time, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.since, l.reason
+}
+
+// collectOrphanedSessions removes from the datapath and the store the sessions of the
+// connections whose association has been gone longer than the grace period. Returns
+// the number of sessions removed.
+func (node *PFCPNode) collectOrphanedSessions() int {
+	gc := node.upf.sessionGC
+	now := time.Now()
+	reclaimed := 0
+
+	node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+
+		since, reason := pConn.assocLoss.lostSince()
+		if since.IsZero() || now.Sub(since) < gc.gracePeriod {
+			return true
+		}
+
+		n := pConn.removeSessions("orphaned: "+reason, nil)
+		if n == 0 {
+			return true
+		}
+
+		pConn.SaveReclaimedSessions(pConn.nodeID.remote, reason, n)
+
+		log.WithFields(log.Fields{
+			"peer":   pConn.RemoteAddr(),
+			"reason": reason,
+			"since":  since,
+		}).Warnln("Reclaimed", n, "orphaned sessions")
+
+		reclaimed += n
+
+		return true
+	})
+
+	return reclaimed
+}
@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/omec-project/upf-epc/pfcpiface/metrics"
+)
+
+type sessionGCMetrics struct {
+	metrics.InstrumentPFCP
+	reclaimed map[string]int
+}
+
+func (m *sessionGCMetrics) SaveSessions(sess *metrics.Session) {}
+
+func (m *sessionGCMetrics) SaveReclaimedSessions(nodeID, reason string, count int) {
+	m.reclaimed[reason] += count
+}
+
+func newSessionGCConn(t *testing.T, u *upf, m metrics.InstrumentPFCP, seids ...uint64) *PFCPConn {
+	conn, err := net.Dial("udp", "127.0.0.1:8805")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	pConn := &PFCPConn{
+		Conn:           conn,
+		upf:            u,
+		store:          NewInMemoryStore(),
+		usage:          newUsageTracker(),
+		qos:            newQoSMonitor(),
+		ddn:            newDDNThrottle(),
+		teids:          newTEIDIndex(),
+		InstrumentPFCP: m,
+		nodeID:         nodeID{remote: "smf"},
+	}
+
+	for _, seid := range seids {
+		session := PFCPSession{
+			localSEID:             seid,
+			metrics:               metrics.NewSession("smf"),
+			PacketForwardingRules: PacketForwardingRules{pdrs: []pdr{{fseID: seid, pdrID: 1}}},
+		}
+		require.NoError(t, pConn.store.PutSession(session, nil, false, 0))
+	}
+
+	return pConn
+}
+
+func TestPFCPNode_collectOrphanedSessions(t *testing.T) {
+	m := &sessionGCMetrics{reclaimed: make(map[string]int)}
+	u := &upf{
+		datapath:   &resyncDatapath{connected: true},
+		usageWheel: newTimerWheel(),
+		sessionGC:  &sessionGC{interval: time.Second, gracePeriod: time.Minute},
+	}
+	node := &PFCPNode{upf: u}
+
+	associated := newSessionGCConn(t, u, m, 1)
+	released := newSessionGCConn(t, u, m, 2, 3)
+	failed := newSessionGCConn(t, u, m, 4)
+
+	node.pConns.Store("198.18.0.1:8805", associated)
+	node.pConns.Store("198.18.0.2:8805", released)
+	node.pConns.Store("198.18.0.3:8805", failed)
+
+	released.assocLoss.lost(orphanReleased)
+	failed.assocLoss.lost(orphanHeartbeatFailure)
+
+	require.Zero(t, node.collectOrphanedSessions(), "grace period not over yet")
+
+	past := time.Now().Add(-time.Hour)
+	released.assocLoss.since = past
+	failed.assocLoss.since = past
+
+	// Heartbeats answered again do not bring a released association back.
+	released.assocLoss.regained(orphanHeartbeatFailure)
+	failed.assocLoss.regained(orphanHeartbeatFailure)
+
+	require.Equal(t, 2, node.collectOrphanedSessions())
+	require.Len(t, associated.store.GetAllSessions(), 1)
+	require.Empty(t, released.store.GetAllSessions())
+	require.Len(t, failed.store.GetAllSessions(), 1)
+	require.Equal(t, map[string]int{orphanReleased: 2}, m.reclaimed)
+
+	// A new association clears the loss.
+	failed.assocLoss.lost(orphanReleased)
+	failed.assocLoss.since = past
+	failed.assocLoss.regained("")
+
+	require.Zero(t, node.collectOrphanedSessions())
+}
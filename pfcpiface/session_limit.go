@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"sync/atomic"
+)
+
+// sessionLimit enforces the maximum number of sessions of the UPF, across all PFCP
+// connections. Sessions are counted from the changes of the stores, so that the limit
+// is checked without listing them.
+type sessionLimit struct {
+	max      uint32
+	sessions int64
+}
+
+// watch counts the sessions of pConn.
+func (l *sessionLimit) watch(pConn *PFCPConn) {
+	pConn.store.Watch(func(event sessionEvent) {
+		switch {
+		case event.created:
+			atomic.AddInt64(&l.sessions, 1)
+		case event.deleted:
+			atomic.AddInt64(&l.sessions, -1)
+		}
+	})
+}
+
+func (l *sessionLimit) count() int64 {
+	return atomic.LoadInt64(&l.sessions)
+}
+
+// reached reports whether no more session is accepted, never if there is no limit.
+func (l *sessionLimit) reached() bool {
+	return l.max != 0 && l.count() >= int64(l.max)
+}
+
+// saturation returns the ratio of the session count to the limit.
+func (l *sessionLimit) saturation() float64 {
+	if l.max == 0 {
+		return 0
+	}
+
+	return float64(l.count()) / float64(l.max)
+}
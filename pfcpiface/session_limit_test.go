@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+func Test_sessionLimit(t *testing.T) {
+	limit := &sessionLimit{max: 2}
+	pConn := &PFCPConn{store: NewInMemoryStore()}
+	limit.watch(pConn)
+
+	require.NoError(t, pConn.store.PutSession(PFCPSession{localSEID: 1}, nil, false, 0))
+	require.NoError(t, pConn.store.PutSession(PFCPSession{localSEID: 1}, nil, false, 0))
+	require.False(t, limit.reached())
+	require.Equal(t, 0.5, limit.saturation())
+
+	require.NoError(t, pConn.store.PutSession(PFCPSession{localSEID: 2}, nil, false, 0))
+	require.True(t, limit.reached())
+	require.Equal(t, 1.0, limit.saturation())
+
+	// Deleting an unknown session leaves the count as is.
+	require.NoError(t, pConn.store.DeleteSession(3, nil))
+	require.Equal(t, int64(2), limit.count())
+
+	require.NoError(t, pConn.store.DeleteSession(2, nil))
+	require.False(t, limit.reached())
+
+	require.True(t, pConn.store.DeleteAllSessions())
+	require.Equal(t, int64(0), limit.count())
+
+	unlimited := &sessionLimit{sessions: 100}
+	require.False(t, unlimited.reached())
+	require.Zero(t, unlimited.saturation())
+}
+
+func TestPFCPConn_establishmentAtSessionLimit(t *testing.T) {
+	pConn := &PFCPConn{upf: &upf{sessionLimit: sessionLimit{max: 1}}, store: NewInMemoryStore()}
+	pConn.nodeID.localIE = ie.NewNodeID("198.18.0.1", "", "")
+	pConn.nodeID.remote = "198.18.0.2"
+	pConn.upf.sessionLimit.watch(pConn)
+
+	require.NoError(t, pConn.store.PutSession(PFCPSession{localSEID: 1}, nil, false, 0))
+
+	sereq := message.NewSessionEstablishmentRequest(0, 0, 0, 1, 0,
+		ie.NewNodeID("198.18.0.2", "", ""), ie.NewFSEID(3, net.ParseIP("198.18.0.2"), nil))
+
+	reply, err := pConn.handleSessionEstablishmentRequest(sereq)
+	require.ErrorIs(t, err, ErrSessionLimit)
+
+	seres, ok := reply.(*message.SessionEstablishmentResponse)
+	require.True(t, ok)
+
+	cause, err := seres.Cause.Cause()
+	require.NoError(t, err)
+	require.Equal(t, ie.CauseNoResourcesAvailable, cause)
+	require.Len(t, pConn.store.GetAllSessions(), 1)
+}
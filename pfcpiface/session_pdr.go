@@ -13,7 +13,7 @@ import (
 )
 
 // Release allocated IPs.
-func releaseAllocatedIPs(ippool *IPPool, session *PFCPSession) error {
+func releaseAllocatedIPs(ipam ipamDriver, session *PFCPSession) error {
 	log.Println("release allocated IP")
 
 	// Check if we allocated an UE IP for this session and delete it.
@@ -23,7 +23,7 @@ func releaseAllocatedIPs(ippool *IPPool, session *PFCPSession) error {
 
 			log.Traceln("Releasing IP", ueIP, " of session", session.localSEID)
 
-			return ippool.DeallocIP(session.localSEID)
+			return ipam.DeallocIP(session.localSEID)
 		}
 	}
 
@@ -34,24 +34,46 @@ func addPdrInfo(msg *message.SessionEstablishmentResponse,
 	session *PFCPSession) {
 	log.Println("Add PDRs with UPF alloc IPs to Establishment response")
 
-	for _, pdr := range session.pdrs {
+	msg.CreatedPDR = append(msg.CreatedPDR, createdPDRs(session.pdrs)...)
+}
+
+// createdPDRs returns the Created PDR IEs of the pdrs with a UE IP or an F-TEID
+// allocated by the UPF.
+func createdPDRs(pdrs []pdr) []*ie.IE {
+	var created []*ie.IE
+
+	for _, pdr := range pdrs {
+		var ies []*ie.IE
+
 		if (pdr.allocIPFlag) && (pdr.srcIface == core) {
 			fmt.Println("parham log : addPdrInfo called for a pdr : ", pdr)
 			log.Println("pdrID : ", pdr.pdrID)
 
 			var (
-				flags uint8  = 0x02
+				flags uint8  = ueIPAddressV4
 				ueIP  net.IP = int2ip(pdr.ueAddress)
+				ueIP6 string
 			)
 
-			log.Println("ueIP : ", ueIP.String())
-			msg.CreatedPDR = append(msg.CreatedPDR,
-				ie.NewCreatedPDR(
-					ie.NewPDRID(uint16(pdr.pdrID)),
-					ie.NewUEIPAddress(flags, ueIP.String(), "", 0, 0),
-				))
+			if pdr.ueAddress6 != nil {
+				flags |= ueIPAddressV6 | ueIPAddressIP6L
+				ueIP6 = pdr.ueAddress6.String()
+			}
+
+			log.Println("ueIP : ", ueIP.String(), "ueIP6 : ", ueIP6)
+			ies = append(ies, ie.NewUEIPAddress(flags, ueIP.String(), ueIP6, 0, ueIPv6PrefixLen))
+		}
+
+		if pdr.allocTEIDKey != 0 {
+			ies = append(ies, ie.NewFTEID(0x01, pdr.tunnelTEID, int2ip(pdr.tunnelIP4Dst), nil, 0))
+		}
+
+		if len(ies) > 0 {
+			created = append(created, ie.NewCreatedPDR(append([]*ie.IE{ie.NewPDRID(uint16(pdr.pdrID))}, ies...)...))
 		}
 	}
+
+	return created
 }
 
 // CreatePDR appends pdr to existing list of PDRs in the session.
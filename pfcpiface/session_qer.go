@@ -87,7 +87,7 @@ func (s *PFCPSession) MarkSessionQer(qers []qer) {
 			return
 		}
 
-		copy(sessQerIDList, sList)
+		sessQerIDList = sList
 	}
 
 	// Loop through qer list and mark qer which matches
@@ -99,7 +99,7 @@ func (s *PFCPSession) MarkSessionQer(qers []qer) {
 	//    if len(sessQerIDList) = 3 : TBD (UE level QER handling).
 	//                                Currently handle same as len = 2
 	var (
-		sessionIdx int
+		sessionIdx = -1
 		sessionMbr uint64
 		sessQerID  uint32
 	)
@@ -123,6 +123,12 @@ func (s *PFCPSession) MarkSessionQer(qers []qer) {
 		}
 	}
 
+	// The session QER may not be among qers, e.g. the QERs of application PDRs
+	// created by a modification.
+	if sessionIdx < 0 {
+		return
+	}
+
 	log.Infoln("session QER found. QER ID : ", sessQerID)
 
 	qers[sessionIdx].qosLevel = SessionQos
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func TestPFCPSession_MarkSessionQer(t *testing.T) {
+	const sessQER, appQER = 1, 2
+
+	session := PFCPSession{PacketForwardingRules: PacketForwardingRules{
+		pdrs: []pdr{
+			{pdrID: 1, srcIface: access, qerIDList: []uint32{sessQER}},
+			{pdrID: 2, srcIface: core, qerIDList: []uint32{sessQER}},
+			{pdrID: 3, srcIface: access, appID: "video", qerIDList: []uint32{sessQER, appQER}},
+			{pdrID: 4, srcIface: core, appID: "video", qerIDList: []uint32{appQER, sessQER}},
+		},
+		qers: []qer{
+			{qerID: sessQER, ulMbr: 10000, dlMbr: 10000},
+			{qerID: appQER, ulMbr: 500, dlMbr: 2000},
+		},
+	}}
+
+	session.MarkSessionQer(session.qers)
+
+	require.Equal(t, SessionQos, session.qers[0].qosLevel)
+	require.Equal(t, ApplicationQos, session.qers[1].qosLevel)
+
+	// The application QER comes first, as the datapaths expect.
+	require.Equal(t, []uint32{appQER, sessQER}, session.pdrs[2].qerIDList)
+	require.Equal(t, []uint32{appQER, sessQER}, session.pdrs[3].qerIDList)
+
+	t.Run("application QERs created by a modification", func(t *testing.T) {
+		created := []qer{{qerID: 3, ulMbr: 100}, {qerID: 4, ulMbr: 200}}
+
+		session.MarkSessionQer(created)
+		require.Equal(t, ApplicationQos, created[0].qosLevel)
+		require.Equal(t, ApplicationQos, created[1].qosLevel)
+	})
+
+	t.Run("metered in each direction", func(t *testing.T) {
+		require.True(t, isBidirectionalQER(session.qers[1], session.pdrs))
+		require.False(t, isBidirectionalQER(qer{qerID: 3}, session.pdrs))
+	})
+
+	t.Run("gated by the session QER", func(t *testing.T) {
+		qers := append([]qer(nil), session.qers...)
+		qers[0].dlStatus = ie.GateStatusClosed
+
+		gated := closeGates(qers[1], session.pdrs[3], qers)
+		require.Equal(t, uint8(ie.GateStatusOpen), gated.ulStatus)
+		require.Equal(t, uint8(ie.GateStatusClosed), gated.dlStatus)
+	})
+}
@@ -0,0 +1,437 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"time"
+)
+
+// sessionRecord is the JSON form of a PFCPSession, as exchanged with other pfcpiface
+// instances. It holds the rules as programmed in the datapath.
+type sessionRecord struct {
+	LocalSEID  uint64      `json:"local_seid"`
+	RemoteSEID uint64      `json:"remote_seid"`
+	PDRs       []pdrRecord `json:"pdrs"`
+	FARs       []farRecord `json:"fars"`
+	QERs       []qerRecord `json:"qers"`
+	URRs       []urrRecord `json:"urrs"`
+	BARs       []barRecord `json:"bars,omitempty"`
+	SRRs       []srrRecord `json:"srrs,omitempty"`
+	// InactivityTimer is the User Plane Inactivity Timer, in seconds.
+	InactivityTimer uint32   `json:"inactivity_timer,omitempty"`
+	CSIDs           []fqCSID `json:"csids,omitempty"`
+}
+
+type pdrRecord struct {
+	SrcIface         uint8     `json:"src_iface"`
+	TunnelIP4Dst     uint32    `json:"tunnel_ip4_dst"`
+	TunnelTEID       uint32    `json:"tunnel_teid"`
+	UEAddress        uint32    `json:"ue_address"`
+	SrcIfaceMask     uint8     `json:"src_iface_mask"`
+	TunnelIP4DstMask uint32    `json:"tunnel_ip4_dst_mask"`
+	TunnelTEIDMask   uint32    `json:"tunnel_teid_mask"`
+	QFI              uint8     `json:"qfi"`
+	QFIMask          uint8     `json:"qfi_mask"`
+	AppFilter        appRecord `json:"app_filter"`
+	AppID            string    `json:"app_id,omitempty"`
+	Precedence       uint32    `json:"precedence"`
+	PDRID            uint32    `json:"pdr_id"`
+	FSEID            uint64    `json:"fseid"`
+	FSEIDIP          uint32    `json:"fseid_ip"`
+	CtrID            uint32    `json:"ctr_id"`
+	FARID            uint32    `json:"far_id"`
+	QERIDs           []uint32  `json:"qer_ids"`
+	URRIDs           []uint32  `json:"urr_ids"`
+	NeedDecap        uint8     `json:"need_decap"`
+	AllocIP          bool      `json:"alloc_ip"`
+	AllocTEIDKey     uint32    `json:"alloc_teid_key,omitempty"`
+	UEAddress6       net.IP    `json:"ue_address6,omitempty"`
+}
+
+type appRecord struct {
+	SrcIP     uint32    `json:"src_ip"`
+	DstIP     uint32    `json:"dst_ip"`
+	SrcPorts  [2]uint16 `json:"src_ports"`
+	DstPorts  [2]uint16 `json:"dst_ports"`
+	Proto     uint8     `json:"proto"`
+	SrcIPMask uint32    `json:"src_ip_mask"`
+	DstIPMask uint32    `json:"dst_ip_mask"`
+	ProtoMask uint8     `json:"proto_mask"`
+}
+
+type farRecord struct {
+	FARID         uint32 `json:"far_id"`
+	FSEID         uint64 `json:"fseid"`
+	FSEIDIP       uint32 `json:"fseid_ip"`
+	BARID         uint8  `json:"bar_id"`
+	DstIntf       uint8  `json:"dst_intf"`
+	SendEndMarker bool   `json:"send_end_marker"`
+	ApplyAction   uint8  `json:"apply_action"`
+	TunnelType    uint8  `json:"tunnel_type"`
+	TunnelIP4Src  uint32 `json:"tunnel_ip4_src"`
+	TunnelIP4Dst  uint32 `json:"tunnel_ip4_dst"`
+	TunnelTEID    uint32 `json:"tunnel_teid"`
+	TunnelPort    uint16 `json:"tunnel_port"`
+}
+
+type qerRecord struct {
+	QERID    uint32   `json:"qer_id"`
+	QosLevel QosLevel `json:"qos_level"`
+	QFI      uint8    `json:"qfi"`
+	ULStatus uint8    `json:"ul_status"`
+	DLStatus uint8    `json:"dl_status"`
+	ULMbr    uint64   `json:"ul_mbr"`
+	DLMbr    uint64   `json:"dl_mbr"`
+	ULGbr    uint64   `json:"ul_gbr"`
+	DLGbr    uint64   `json:"dl_gbr"`
+	FSEID    uint64   `json:"fseid"`
+	FSEIDIP  uint32   `json:"fseid_ip"`
+}
+
+type urrRecord struct {
+	URRID          uint32 `json:"urr_id"`
+	MeasureMethod  uint8  `json:"measure_method"`
+	ReportTriggers uint16 `json:"report_triggers"`
+	VolumeFlags    uint8  `json:"volume_flags"`
+	VolumeTotal    uint64 `json:"volume_total"`
+	VolumeUplink   uint64 `json:"volume_uplink"`
+	VolumeDownlink uint64 `json:"volume_downlink"`
+	TimeThreshold  uint32 `json:"time_threshold"`
+	MeasurePeriod  uint32 `json:"measure_period"`
+	InactivityTime uint32 `json:"inactivity_time,omitempty"`
+	FSEID          uint64 `json:"fseid"`
+	FSEIDIP        uint32 `json:"fseid_ip"`
+}
+
+type barRecord struct {
+	BARID             uint8         `json:"bar_id"`
+	NotifyDelay       time.Duration `json:"notify_delay"`
+	SuggestedPktCount uint8         `json:"suggested_pkt_count"`
+	FSEID             uint64        `json:"fseid"`
+}
+
+type srrRecord struct {
+	SRRID uint8                 `json:"srr_id"`
+	FSEID uint64                `json:"fseid"`
+	Flows []qosMonitoringRecord `json:"qos_monitoring"`
+}
+
+type qosMonitoringRecord struct {
+	QFIs       []uint8       `json:"qfis"`
+	Requested  uint8         `json:"requested"`
+	Frequency  uint8         `json:"frequency"`
+	DelayFlags uint8         `json:"delay_flags"`
+	DelayDL    uint32        `json:"delay_dl"`
+	DelayUL    uint32        `json:"delay_ul"`
+	DelayRP    uint32        `json:"delay_rp"`
+	MinWait    time.Duration `json:"min_wait"`
+	Period     time.Duration `json:"period"`
+}
+
+func newSessionRecord(s PFCPSession) sessionRecord {
+	r := sessionRecord{
+		LocalSEID:  s.localSEID,
+		RemoteSEID: s.remoteSEID,
+		PDRs:       make([]pdrRecord, 0, len(s.pdrs)),
+		FARs:       make([]farRecord, 0, len(s.fars)),
+		QERs:       make([]qerRecord, 0, len(s.qers)),
+		URRs:       make([]urrRecord, 0, len(s.urrs)),
+
+		InactivityTimer: uint32(s.inactivityTimer / time.Second),
+		CSIDs:           s.csids,
+	}
+
+	for _, p := range s.pdrs {
+		r.PDRs = append(r.PDRs, pdrRecord{
+			SrcIface:         p.srcIface,
+			TunnelIP4Dst:     p.tunnelIP4Dst,
+			TunnelTEID:       p.tunnelTEID,
+			UEAddress:        p.ueAddress,
+			SrcIfaceMask:     p.srcIfaceMask,
+			TunnelIP4DstMask: p.tunnelIP4DstMask,
+			TunnelTEIDMask:   p.tunnelTEIDMask,
+			QFI:              p.qfi,
+			QFIMask:          p.qfiMask,
+			AppFilter: appRecord{
+				SrcIP:     p.appFilter.srcIP,
+				DstIP:     p.appFilter.dstIP,
+				SrcPorts:  [2]uint16{p.appFilter.srcPortRange.low, p.appFilter.srcPortRange.high},
+				DstPorts:  [2]uint16{p.appFilter.dstPortRange.low, p.appFilter.dstPortRange.high},
+				Proto:     p.appFilter.proto,
+				SrcIPMask: p.appFilter.srcIPMask,
+				DstIPMask: p.appFilter.dstIPMask,
+				ProtoMask: p.appFilter.protoMask,
+			},
+			AppID:        p.appID,
+			Precedence:   p.precedence,
+			PDRID:        p.pdrID,
+			FSEID:        p.fseID,
+			FSEIDIP:      p.fseidIP,
+			CtrID:        p.ctrID,
+			FARID:        p.farID,
+			QERIDs:       p.qerIDList,
+			URRIDs:       p.urrIDList,
+			NeedDecap:    p.needDecap,
+			AllocIP:      p.allocIPFlag,
+			UEAddress6:   p.ueAddress6,
+			AllocTEIDKey: p.allocTEIDKey,
+		})
+	}
+
+	for _, f := range s.fars {
+		r.FARs = append(r.FARs, farRecord{
+			FARID:         f.farID,
+			FSEID:         f.fseID,
+			FSEIDIP:       f.fseidIP,
+			BARID:         f.barID,
+			DstIntf:       f.dstIntf,
+			SendEndMarker: f.sendEndMarker,
+			ApplyAction:   f.applyAction,
+			TunnelType:    f.tunnelType,
+			TunnelIP4Src:  f.tunnelIP4Src,
+			TunnelIP4Dst:  f.tunnelIP4Dst,
+			TunnelTEID:    f.tunnelTEID,
+			TunnelPort:    f.tunnelPort,
+		})
+	}
+
+	for _, q := range s.qers {
+		r.QERs = append(r.QERs, qerRecord{
+			QERID:    q.qerID,
+			QosLevel: q.qosLevel,
+			QFI:      q.qfi,
+			ULStatus: q.ulStatus,
+			DLStatus: q.dlStatus,
+			ULMbr:    q.ulMbr,
+			DLMbr:    q.dlMbr,
+			ULGbr:    q.ulGbr,
+			DLGbr:    q.dlGbr,
+			FSEID:    q.fseID,
+			FSEIDIP:  q.fseidIP,
+		})
+	}
+
+	for _, u := range s.urrs {
+		r.URRs = append(r.URRs, urrRecord{
+			URRID:          u.urrID,
+			MeasureMethod:  u.measureMethod,
+			ReportTriggers: u.reportTriggers,
+			VolumeFlags:    u.volThreshold.flags,
+			VolumeTotal:    u.volThreshold.total,
+			VolumeUplink:   u.volThreshold.uplink,
+			VolumeDownlink: u.volThreshold.downlink,
+			TimeThreshold:  u.timeThreshold,
+			MeasurePeriod:  u.measurePeriod,
+			InactivityTime: u.inactivityTime,
+			FSEID:          u.fseID,
+			FSEIDIP:        u.fseidIP,
+		})
+	}
+
+	for _, b := range s.bars {
+		r.BARs = append(r.BARs, barRecord{
+			BARID:             b.barID,
+			NotifyDelay:       b.notifyDelay,
+			SuggestedPktCount: b.suggestedPktCount,
+			FSEID:             b.fseID,
+		})
+	}
+
+	for _, sr := range s.srrs {
+		rec := srrRecord{SRRID: sr.srrID, FSEID: sr.fseID}
+
+		for _, q := range sr.flows {
+			rec.Flows = append(rec.Flows, qosMonitoringRecord{
+				QFIs:       q.qfis,
+				Requested:  q.requested,
+				Frequency:  q.frequency,
+				DelayFlags: q.thresholds.flags,
+				DelayDL:    q.thresholds.dl,
+				DelayUL:    q.thresholds.ul,
+				DelayRP:    q.thresholds.rp,
+				MinWait:    q.minWait,
+				Period:     q.period,
+			})
+		}
+
+		r.SRRs = append(r.SRRs, rec)
+	}
+
+	return r
+}
+
+// session returns the session of r, without metrics.
+func (r sessionRecord) session() PFCPSession {
+	s := PFCPSession{
+		localSEID:  r.LocalSEID,
+		remoteSEID: r.RemoteSEID,
+		PacketForwardingRules: PacketForwardingRules{
+			pdrs: make([]pdr, 0, len(r.PDRs)),
+			fars: make([]far, 0, len(r.FARs)),
+			qers: make([]qer, 0, len(r.QERs)),
+			urrs: make([]urr, 0, len(r.URRs)),
+		},
+		inactivityTimer: time.Duration(r.InactivityTimer) * time.Second,
+		csids:           r.CSIDs,
+	}
+
+	for _, p := range r.PDRs {
+		s.pdrs = append(s.pdrs, pdr{
+			srcIface:         p.SrcIface,
+			tunnelIP4Dst:     p.TunnelIP4Dst,
+			tunnelTEID:       p.TunnelTEID,
+			ueAddress:        p.UEAddress,
+			srcIfaceMask:     p.SrcIfaceMask,
+			tunnelIP4DstMask: p.TunnelIP4DstMask,
+			tunnelTEIDMask:   p.TunnelTEIDMask,
+			qfi:              p.QFI,
+			qfiMask:          p.QFIMask,
+			appFilter: applicationFilter{
+				srcIP:        p.AppFilter.SrcIP,
+				dstIP:        p.AppFilter.DstIP,
+				srcPortRange: portRange{low: p.AppFilter.SrcPorts[0], high: p.AppFilter.SrcPorts[1]},
+				dstPortRange: portRange{low: p.AppFilter.DstPorts[0], high: p.AppFilter.DstPorts[1]},
+				proto:        p.AppFilter.Proto,
+				srcIPMask:    p.AppFilter.SrcIPMask,
+				dstIPMask:    p.AppFilter.DstIPMask,
+				protoMask:    p.AppFilter.ProtoMask,
+			},
+			appID:        p.AppID,
+			precedence:   p.Precedence,
+			pdrID:        p.PDRID,
+			fseID:        p.FSEID,
+			fseidIP:      p.FSEIDIP,
+			ctrID:        p.CtrID,
+			farID:        p.FARID,
+			qerIDList:    p.QERIDs,
+			urrIDList:    p.URRIDs,
+			needDecap:    p.NeedDecap,
+			allocIPFlag:  p.AllocIP,
+			ueAddress6:   p.UEAddress6,
+			allocTEIDKey: p.AllocTEIDKey,
+		})
+	}
+
+	for _, f := range r.FARs {
+		s.fars = append(s.fars, far{
+			farID:         f.FARID,
+			fseID:         f.FSEID,
+			fseidIP:       f.FSEIDIP,
+			barID:         f.BARID,
+			dstIntf:       f.DstIntf,
+			sendEndMarker: f.SendEndMarker,
+			applyAction:   f.ApplyAction,
+			tunnelType:    f.TunnelType,
+			tunnelIP4Src:  f.TunnelIP4Src,
+			tunnelIP4Dst:  f.TunnelIP4Dst,
+			tunnelTEID:    f.TunnelTEID,
+			tunnelPort:    f.TunnelPort,
+		})
+	}
+
+	for _, q := range r.QERs {
+		s.qers = append(s.qers, qer{
+			qerID:    q.QERID,
+			qosLevel: q.QosLevel,
+			qfi:      q.QFI,
+			ulStatus: q.ULStatus,
+			dlStatus: q.DLStatus,
+			ulMbr:    q.ULMbr,
+			dlMbr:    q.DLMbr,
+			ulGbr:    q.ULGbr,
+			dlGbr:    q.DLGbr,
+			fseID:    q.FSEID,
+			fseidIP:  q.FSEIDIP,
+		})
+	}
+
+	for _, u := range r.URRs {
+		s.urrs = append(s.urrs, urr{
+			urrID:          u.URRID,
+			measureMethod:  u.MeasureMethod,
+			reportTriggers: u.ReportTriggers,
+			volThreshold: volumeThreshold{
+				flags:    u.VolumeFlags,
+				total:    u.VolumeTotal,
+				uplink:   u.VolumeUplink,
+				downlink: u.VolumeDownlink,
+			},
+			timeThreshold:  u.TimeThreshold,
+			measurePeriod:  u.MeasurePeriod,
+			inactivityTime: u.InactivityTime,
+			fseID:          u.FSEID,
+			fseidIP:        u.FSEIDIP,
+		})
+	}
+
+	for _, b := range r.BARs {
+		s.bars = append(s.bars, bar{
+			barID:             b.BARID,
+			notifyDelay:       b.NotifyDelay,
+			suggestedPktCount: b.SuggestedPktCount,
+			fseID:             b.FSEID,
+		})
+	}
+
+	for _, rec := range r.SRRs {
+		sr := srr{srrID: rec.SRRID, fseID: rec.FSEID}
+
+		for _, q := range rec.Flows {
+			sr.flows = append(sr.flows, qosMonitoring{
+				qfis:      q.QFIs,
+				requested: q.Requested,
+				frequency: q.Frequency,
+				thresholds: packetDelays{
+					flags: q.DelayFlags,
+					dl:    q.DelayDL,
+					ul:    q.DelayUL,
+					rp:    q.DelayRP,
+				},
+				minWait: q.MinWait,
+				period:  q.Period,
+			})
+		}
+
+		s.srrs = append(s.srrs, sr)
+	}
+
+	return s
+}
+
+// allocatedTEIDs returns the F-TEIDs allocated by the UPF to the session, by key.
+func (r sessionRecord) allocatedTEIDs() map[uint32]uint32 {
+	teids := make(map[uint32]uint32)
+
+	for _, p := range r.PDRs {
+		if p.AllocTEIDKey != 0 {
+			teids[p.AllocTEIDKey] = p.TunnelTEID
+		}
+	}
+
+	return teids
+}
+
+// ueIPs returns the UE IPs allocated by the UPF to the session.
+func (r sessionRecord) ueIPs() []net.IP {
+	var ips []net.IP
+
+	for _, p := range r.PDRs {
+		if !p.AllocIP || p.SrcIface != core {
+			continue
+		}
+
+		if p.UEAddress != 0 {
+			ips = append(ips, int2ip(p.UEAddress))
+		}
+
+		if p.UEAddress6 != nil {
+			ips = append(ips, p.UEAddress6)
+		}
+
+		break
+	}
+
+	return ips
+}
@@ -0,0 +1,33 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+// CreateSRR appends srr to existing list of SRRs in the session.
+func (s *PFCPSession) CreateSRR(r srr) {
+	s.srrs = append(s.srrs, r)
+}
+
+// UpdateSRR updates existing srr in the session.
+func (s *PFCPSession) UpdateSRR(r srr) error {
+	for idx, v := range s.srrs {
+		if v.srrID == r.srrID {
+			s.srrs[idx] = r
+			return nil
+		}
+	}
+
+	return ErrNotFound("SRR")
+}
+
+// RemoveSRR removes srr from existing list of SRRs in the session.
+func (s *PFCPSession) RemoveSRR(id uint8) (*srr, error) {
+	for idx, v := range s.srrs {
+		if v.srrID == id {
+			s.srrs = append(s.srrs[:idx], s.srrs[idx+1:]...)
+			return &v, nil
+		}
+	}
+
+	return nil, ErrNotFound("SRR")
+}
@@ -0,0 +1,33 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+// CreateURR appends urr to existing list of URRs in the session.
+func (s *PFCPSession) CreateURR(u urr) {
+	s.urrs = append(s.urrs, u)
+}
+
+// UpdateURR updates existing urr in the session.
+func (s *PFCPSession) UpdateURR(u urr) error {
+	for idx, v := range s.urrs {
+		if v.urrID == u.urrID {
+			s.urrs[idx] = u
+			return nil
+		}
+	}
+
+	return ErrNotFound("URR")
+}
+
+// RemoveURR removes urr from existing list of URRs in the session.
+func (s *PFCPSession) RemoveURR(id uint32) (*urr, error) {
+	for idx, v := range s.urrs {
+		if v.urrID == id {
+			s.urrs = append(s.urrs[:idx], s.urrs[idx+1:]...)
+			return &v, nil
+		}
+	}
+
+	return nil, ErrNotFound("URR")
+}
@@ -5,6 +5,8 @@ package pfcpiface
 
 import (
 	"fmt"
+	"time"
+	"unsafe"
 
 	log "github.com/sirupsen/logrus"
 
@@ -15,6 +17,8 @@ type PacketForwardingRules struct {
 	pdrs []pdr
 	fars []far
 	qers []qer
+	urrs []urr
+	bars []bar
 }
 
 // PFCPSession implements one PFCP session.
@@ -23,10 +27,29 @@ type PFCPSession struct {
 	remoteSEID uint64
 	metrics    *metrics.Session
 	PacketForwardingRules
+	// srrs are the Session Reporting Rules, not programmed in the datapath.
+	srrs []srr
+	// inactivityTimer is the User Plane Inactivity Timer, none if zero.
+	inactivityTimer time.Duration
+	// csids are the FQ-CSIDs of the CP nodes serving the session, matched by Session
+	// Set Deletion Requests.
+	csids []fqCSID
 }
 
 func (p PacketForwardingRules) String() string {
-	return fmt.Sprintf("PDRs=%v, FARs=%v, QERs=%v", p.pdrs, p.fars, p.qers)
+	return fmt.Sprintf("PDRs=%v, FARs=%v, QERs=%v, URRs=%v, BARs=%v", p.pdrs, p.fars, p.qers, p.urrs, p.bars)
+}
+
+// footprint estimates the memory held by the session in a store, in bytes: the session
+// and the arrays of its rules, not what they point to.
+func (s PFCPSession) footprint() uint64 {
+	return uint64(unsafe.Sizeof(s)) +
+		uint64(cap(s.pdrs))*uint64(unsafe.Sizeof(pdr{})) +
+		uint64(cap(s.fars))*uint64(unsafe.Sizeof(far{})) +
+		uint64(cap(s.qers))*uint64(unsafe.Sizeof(qer{})) +
+		uint64(cap(s.urrs))*uint64(unsafe.Sizeof(urr{})) +
+		uint64(cap(s.bars))*uint64(unsafe.Sizeof(bar{})) +
+		uint64(cap(s.srrs))*uint64(unsafe.Sizeof(srr{}))
 }
 
 // NewPFCPSession allocates an session with ID.
@@ -39,6 +62,7 @@ func (pConn *PFCPConn) NewPFCPSession(rseid uint64) (PFCPSession, bool) {
 			pdrs: make([]pdr, 0, MaxItems),
 			fars: make([]far, 0, MaxItems),
 			qers: make([]qer, 0, MaxItems),
+			urrs: make([]urr, 0, MaxItems),
 		},
 	}
 	s.metrics = metrics.NewSession(pConn.nodeID.remote)
@@ -56,9 +80,22 @@ func (pConn *PFCPConn) RemoveSession(session PFCPSession) {
 	session.metrics.Delete()
 	pConn.SaveSessions(session.metrics)
 
+	pConn.sentIpsLock.Lock()
 	for _, p := range session.pdrs {
 		delete(pConn.sentIpsToRouters, p.ueAddress)
 	}
+	pConn.sentIpsLock.Unlock()
+
+	for _, u := range session.urrs {
+		pConn.cancelPeriodicReport(session.localSEID, u.urrID)
+	}
+
+	pConn.usage.forgetSession(session.localSEID)
+	pConn.qos.forgetSession(session.localSEID)
+	pConn.inactivity.forgetSession(session.localSEID)
+	pConn.ddn.reset(session.localSEID)
+	pConn.teids.remove(session.localSEID)
+	pConn.upf.teidPool.release(session.localSEID)
 
 	if err := pConn.store.DeleteSession(session.localSEID, pConn); err != nil {
 		log.Errorf("Failed to delete PFCP session from store: %v", err)
@@ -3,6 +3,16 @@
 
 package pfcpiface
 
+// sessionEvent is a change of the sessions of a store.
+type sessionEvent struct {
+	// deleted is set if the session of fseid was removed, session is the stored one otherwise.
+	deleted bool
+	// created is set if the stored session is a new one.
+	created bool
+	fseid   uint64
+	session PFCPSession
+}
+
 type SessionsStore interface {
 	// PutSession modifies the PFCP Session data indexed by a given F-SEID or
 	// inserts a new PFCP Session record, if it doesn't exist yet.
@@ -16,4 +26,7 @@ type SessionsStore interface {
 	// DeleteAllSessions removes all PFCP sessions from the store.
 	// Returns true on success.
 	DeleteAllSessions() bool
+	// Watch calls fn with every change of the stored sessions, in order, until the
+	// returned function is called. fn must not block.
+	Watch(fn func(sessionEvent)) (cancel func())
 }
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// simRequest is the body of POST /v1/simulate. Count and rate default to the
+// max_sessions and sessions_per_second of the sim config.
+type simRequest struct {
+	Mode  string `json:"mode"`
+	Count uint32 `json:"count"`
+	Rate  uint32 `json:"rate"`
+}
+
+// simStatus reports the simulation in progress, if any.
+type simStatus struct {
+	Running bool   `json:"running"`
+	Mode    string `json:"mode,omitempty"`
+	Count   uint32 `json:"count,omitempty"`
+	Rate    uint32 `json:"rate,omitempty"`
+}
+
+// simHandler creates and removes simulated sessions on a running instance, like the
+// -simulate flag does at start, for soak testing:
+//
+//	GET  /v1/simulate  reports the simulation in progress
+//	POST /v1/simulate  starts creating or deleting sessions, e.g.
+//	                   {"mode": "create", "count": 1000, "rate": 100}
+type simHandler struct {
+	iface *PFCPIface
+
+	mu     sync.Mutex
+	status simStatus
+}
+
+func (h *simHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	code := http.StatusOK
+
+	var status simStatus
+
+	switch r.Method {
+	case http.MethodGet:
+		h.mu.Lock()
+		status = h.status
+		h.mu.Unlock()
+	case http.MethodPost:
+		var ok bool
+		if status, ok = h.start(w, r); !ok {
+			return
+		}
+
+		code = http.StatusAccepted
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Errorln("Failed to encode simulation status:", err)
+	}
+}
+
+// start starts the simulation requested by r in the background and returns its
+// status, or writes the error response and returns false if it cannot.
+func (h *simHandler) start(w http.ResponseWriter, r *http.Request) (simStatus, bool) {
+	var req simRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return simStatus{}, false
+	}
+
+	var mode simMode
+	if err := mode.Set(req.Mode); err != nil || !mode.enable() {
+		http.Error(w, "invalid mode: "+req.Mode, http.StatusBadRequest)
+		return simStatus{}, false
+	}
+
+	h.iface.mu.Lock()
+	sim := h.iface.conf.SimInfo
+	h.iface.mu.Unlock()
+
+	if req.Count > 0 {
+		sim.MaxSessions = req.Count
+	}
+
+	if req.Rate > 0 {
+		sim.SessionsPerSecond = req.Rate
+	}
+
+	if (sim.StartUEIP == nil && len(sim.UEIPRanges) == 0) || sim.StartENBIP == nil ||
+		sim.StartAUPFIP == nil || sim.N9AppIP == nil {
+		http.Error(w, "sim is not configured", http.StatusConflict)
+		return simStatus{}, false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.status.Running {
+		http.Error(w, "a simulation is in progress", http.StatusConflict)
+		return simStatus{}, false
+	}
+
+	h.status = simStatus{Running: true, Mode: mode.String(), Count: sim.MaxSessions, Rate: sim.SessionsPerSecond}
+
+	go func() {
+		h.iface.upf.sim(mode, &sim)
+
+		h.mu.Lock()
+		h.status = simStatus{}
+		h.mu.Unlock()
+	}()
+
+	return h.status, true
+}
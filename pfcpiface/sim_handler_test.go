@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_simHandler(t *testing.T) {
+	f := &fakeDatapath{}
+	f.SetUpfInfo(&upf{}, &Conf{})
+
+	u := &upf{datapath: f, AccessIP: net.ParseIP("198.18.0.1"), CoreIP: net.ParseIP("198.19.0.1")}
+	conf := Conf{SimInfo: SimModeInfo{
+		MaxSessions: 2,
+		StartUEIP:   net.ParseIP("16.0.0.1"),
+		StartENBIP:  net.ParseIP("11.1.1.129"),
+		StartAUPFIP: net.ParseIP("13.1.1.199"),
+		N9AppIP:     net.ParseIP("9.9.9.9"),
+		StartN3TEID: "0x30000000",
+		StartN9TEID: "0x90000000",
+		Interfaces:  []string{simIfaceN6},
+	}}
+	handler := &simHandler{iface: &PFCPIface{conf: conf, upf: u}}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/simulate", strings.NewReader(body)))
+
+		return rec
+	}
+
+	status := func() simStatus {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/simulate", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var s simStatus
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&s))
+
+		return s
+	}
+
+	require.Equal(t, simStatus{}, status())
+	require.Equal(t, http.StatusBadRequest, post(`{"mode": "disable"}`).Code)
+
+	t.Run("create", func(t *testing.T) {
+		rec := post(`{"mode": "create", "count": 3, "rate": 20}`)
+		require.Equal(t, http.StatusAccepted, rec.Code)
+
+		var s simStatus
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&s))
+		require.Equal(t, simStatus{Running: true, Mode: "create", Count: 3, Rate: 20}, s)
+
+		require.Equal(t, http.StatusConflict, post(`{"mode": "delete"}`).Code, "one simulation at a time")
+
+		require.Eventually(t, func() bool { return !status().Running }, time.Second, 10*time.Millisecond)
+		require.Len(t, f.state().PDRs, 3*2)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.Equal(t, http.StatusAccepted, post(`{"mode": "delete", "count": 3}`).Code)
+		require.Eventually(t, func() bool { return !status().Running }, time.Second, 10*time.Millisecond)
+		require.Empty(t, f.state().PDRs)
+	})
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const slicesPath = "/v1/config/slices"
+
+// sliceConfigHandler creates, updates and removes network slices at runtime:
+//
+//	GET    /v1/config/slices         lists the slices
+//	POST   /v1/config/slices         creates a slice
+//	PUT    /v1/config/slices/<name>  creates or updates a slice
+//	DELETE /v1/config/slices/<name>  removes a slice
+type sliceConfigHandler struct {
+	upf *upf
+}
+
+func (h *sliceConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, slicesPath), "/")
+
+	log.WithFields(log.Fields{
+		"method": r.Method,
+		"slice":  name,
+	}).Info("Handling slice config request")
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		h.list(w)
+	case r.Method == http.MethodPost && name == "":
+		h.put(w, r, "", false)
+	case r.Method == http.MethodPut && name != "":
+		h.put(w, r, name, true)
+	case r.Method == http.MethodDelete && name != "":
+		h.remove(w, name)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *sliceConfigHandler) list(w http.ResponseWriter) {
+	slices := make([]NetworkSlice, 0)
+	for _, sliceInfo := range h.upf.getSliceInfos() {
+		slices = append(slices, sliceInfo.networkSlice())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(slices); err != nil {
+		log.Errorln("Failed to encode slices:", err)
+	}
+}
+
+// put adds the slice of the request body. An existing slice of the same name is
+// replaced if replace is set, POST rejects it.
+func (h *sliceConfigHandler) put(w http.ResponseWriter, r *http.Request, name string, replace bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	var nwSlice NetworkSlice
+	if err := json.Unmarshal(body, &nwSlice); err != nil {
+		http.Error(w, "invalid slice config: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if nwSlice.SliceName == "" {
+		nwSlice.SliceName = name
+	}
+
+	if nwSlice.SliceName == "" || (name != "" && nwSlice.SliceName != name) {
+		http.Error(w, "slice name must match the request path", http.StatusBadRequest)
+		return
+	}
+
+	existing := h.upf.getSliceInfo(nwSlice.SliceName)
+	if existing != nil && !replace {
+		http.Error(w, "slice "+nwSlice.SliceName+" already exists", http.StatusConflict)
+		return
+	}
+
+	if err := h.upf.addSliceInfo(newSliceInfo(&nwSlice)); err != nil {
+		log.Errorln("Failed to add slice", nwSlice.SliceName, "to datapath:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	if existing != nil {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func (h *sliceConfigHandler) remove(w http.ResponseWriter, name string) {
+	err := h.upf.removeSliceInfo(name)
+
+	switch {
+	case errors.Is(err, errNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		log.Errorln("Failed to remove slice", name, "from datapath:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// networkSlice converts a slice back to its REST API representation, in bps.
+func (s *SliceInfo) networkSlice() NetworkSlice {
+	nwSlice := NetworkSlice{
+		SliceName: s.name,
+		SliceQos: SliceQos{
+			UplinkMbr:    s.uplinkMbr,
+			DownlinkMbr:  s.downlinkMbr,
+			BitrateUnit:  "bps",
+			UlBurstBytes: s.ulBurstBytes,
+			DlBurstBytes: s.dlBurstBytes,
+		},
+	}
+
+	for _, ueRes := range s.ueResList {
+		nwSlice.UeResInfo = append(nwSlice.UeResInfo, UeResInfo{Dnn: ueRes.dnn, Name: ueRes.name})
+	}
+
+	return nwSlice
+}
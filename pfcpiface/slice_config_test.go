@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_sliceConfigHandler(t *testing.T) {
+	f := &fakeDatapath{}
+	u := &upf{datapath: f}
+
+	mux := http.NewServeMux()
+	setupConfigHandler(mux, u)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+		return rec
+	}
+
+	slice := `{"sliceName": "slice1", "sliceQos": {"uplinkMbr": 10, "downlinkMbr": 20, "bitrateUnit": "Mbps"},
+		"ueResourceInfo": [{"dnn": "internet", "uePoolId": "pool1"}]}`
+
+	require.Equal(t, http.StatusCreated, serve(http.MethodPost, "/v1/config/slices", slice).Code)
+	require.Equal(t, http.StatusConflict, serve(http.MethodPost, "/v1/config/slices", slice).Code)
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/v1/config/slices", "{").Code)
+
+	rec := serve(http.MethodPut, "/v1/config/slices/slice1", `{"sliceQos": {"uplinkMbr": 5, "bitrateUnit": "Mbps"}}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, uint64(5*MB), u.getSliceInfo("slice1").uplinkMbr)
+
+	require.Equal(t, http.StatusBadRequest,
+		serve(http.MethodPut, "/v1/config/slices/slice1", `{"sliceName": "slice2"}`).Code)
+	require.Equal(t, http.StatusCreated, serve(http.MethodPut, "/v1/config/slices/slice2", `{}`).Code)
+
+	rec = serve(http.MethodGet, "/v1/config/slices", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var slices []NetworkSlice
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &slices))
+	require.Len(t, slices, 2)
+	require.Equal(t, "slice1", slices[0].SliceName)
+	require.Equal(t, uint64(5*MB), slices[0].SliceQos.UplinkMbr)
+
+	require.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/v1/config/slices/slice1", "").Code)
+	require.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/v1/config/slices/slice1", "").Code)
+	require.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodDelete, "/v1/config/slices", "").Code)
+	require.Len(t, u.getSliceInfos(), 1)
+}
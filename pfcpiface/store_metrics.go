@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"time"
+
+	"github.com/omec-project/upf-epc/pfcpiface/metrics"
+)
+
+// storeBackendMemory is the backend label of the in-memory session store.
+const storeBackendMemory = "memory"
+
+// instrumentedStore records the latency and the errors of the session operations
+// of a SessionsStore, to tell a slow store apart from a slow datapath.
+type instrumentedStore struct {
+	SessionsStore
+	backend string
+	metrics metrics.InstrumentPFCP
+}
+
+func newInstrumentedStore(store SessionsStore, backend string, m metrics.InstrumentPFCP) *instrumentedStore {
+	return &instrumentedStore{
+		SessionsStore: store,
+		backend:       backend,
+		metrics:       m,
+	}
+}
+
+func (s *instrumentedStore) PutSession(session PFCPSession, pConn *PFCPConn, pushPDR bool, msgType uint8) error {
+	start := time.Now()
+	err := s.SessionsStore.PutSession(session, pConn, pushPDR, msgType)
+	s.metrics.SaveStoreOperation(s.backend, "put", time.Since(start), err)
+
+	return err
+}
+
+func (s *instrumentedStore) GetSession(fseid uint64) (PFCPSession, bool) {
+	start := time.Now()
+	session, ok := s.SessionsStore.GetSession(fseid)
+	s.metrics.SaveStoreOperation(s.backend, "get", time.Since(start), nil)
+
+	return session, ok
+}
+
+func (s *instrumentedStore) DeleteSession(fseid uint64, pConn *PFCPConn) error {
+	start := time.Now()
+	err := s.SessionsStore.DeleteSession(fseid, pConn)
+	s.metrics.SaveStoreOperation(s.backend, "delete", time.Since(start), err)
+
+	return err
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/omec-project/upf-epc/pfcpiface/metrics"
+)
+
+type storeMetrics struct {
+	metrics.InstrumentPFCP
+	ops    map[string]int
+	errors map[string]int
+}
+
+func (m *storeMetrics) SaveStoreOperation(backend, op string, duration time.Duration, err error) {
+	m.ops[backend+"/"+op]++
+
+	if err != nil {
+		m.errors[backend+"/"+op]++
+	}
+}
+
+func Test_instrumentedStore(t *testing.T) {
+	m := &storeMetrics{ops: map[string]int{}, errors: map[string]int{}}
+	store := newInstrumentedStore(NewInMemoryStore(), storeBackendMemory, m)
+
+	require.NoError(t, store.PutSession(PFCPSession{localSEID: 1}, nil, false, 0))
+	require.Error(t, store.PutSession(PFCPSession{}, nil, false, 0))
+
+	_, ok := store.GetSession(1)
+	require.True(t, ok)
+
+	require.NoError(t, store.DeleteSession(1, nil))
+	require.Empty(t, store.GetAllSessions())
+
+	require.Equal(t, map[string]int{"memory/put": 2, "memory/get": 1, "memory/delete": 1}, m.ops)
+	require.Equal(t, map[string]int{"memory/put": 1}, m.errors)
+}
@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import "sync"
+
+// teidKey identifies a GTP-U tunnel towards a remote peer.
+type teidKey struct {
+	peer uint32
+	teid uint32
+}
+
+// teidIndex maps the remote GTP-U tunnels of the forwarding FARs to the F-SEID
+// of their session, so that GTP-U signalling naming a tunnel can be attributed.
+type teidIndex struct {
+	mu      sync.RWMutex
+	tunnels map[teidKey]uint64
+	// sessions stores the tunnels of each F-SEID, to update or remove them at once.
+	sessions map[uint64][]teidKey
+}
+
+func newTEIDIndex() *teidIndex {
+	return &teidIndex{
+		tunnels:  make(map[teidKey]uint64),
+		sessions: make(map[uint64][]teidKey),
+	}
+}
+
+// update replaces the tunnels indexed for the session with those of its current FARs.
+func (t *teidIndex) update(session PFCPSession) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.removeLocked(session.localSEID)
+
+	keys := make([]teidKey, 0, len(session.fars))
+
+	for _, f := range session.fars {
+		if !f.Forwards() || f.tunnelIP4Dst == 0 {
+			continue
+		}
+
+		key := teidKey{peer: f.tunnelIP4Dst, teid: f.tunnelTEID}
+		t.tunnels[key] = session.localSEID
+		keys = append(keys, key)
+	}
+
+	if len(keys) > 0 {
+		t.sessions[session.localSEID] = keys
+	}
+}
+
+// remove drops the tunnels indexed for the F-SEID.
+func (t *teidIndex) remove(fseid uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.removeLocked(fseid)
+}
+
+func (t *teidIndex) removeLocked(fseid uint64) {
+	for _, key := range t.sessions[fseid] {
+		if t.tunnels[key] == fseid {
+			delete(t.tunnels, key)
+		}
+	}
+
+	delete(t.sessions, fseid)
+}
+
+// lookup returns the F-SEID of the session tunnelling traffic to peer with teid.
+func (t *teidIndex) lookup(peer, teid uint32) (uint64, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	fseid, ok := t.tunnels[teidKey{peer: peer, teid: teid}]
+
+	return fseid, ok
+}
@@ -0,0 +1,435 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var errNoTEIDs = errors.New("no TEID available")
+
+// teidAllocator allocates the F-TEIDs of the PDIs with the CHOOSE flag.
+type teidAllocator interface {
+	allocTEID(seid uint64, key uint32, srcIface uint8) (uint32, net.IP, error)
+}
+
+// teidRange is the TEIDs allocated to the PDIs of a CP node, any CP node without a
+// range of its own if peer is empty.
+type teidRange struct {
+	peer       string
+	start, end uint32
+	// next is where the search for a free TEID starts.
+	next uint32
+}
+
+// teidAlloc is a TEID allocated to a session, to the PDIs sharing key.
+type teidAlloc struct {
+	peer string
+	seid uint64
+	key  uint32
+}
+
+// teidPool allocates the F-TEIDs of the PDIs with the CHOOSE flag (FTUP), from the
+// range of their CP node. TEIDs are held until their session is removed.
+type teidPool struct {
+	mu     sync.Mutex
+	ranges []*teidRange
+	used   map[uint32]teidAlloc
+	// sessions are the TEIDs of each F-SEID, by key.
+	sessions map[uint64]map[uint32]uint32
+	// restored are the F-SEIDs of the allocations restored from the journal, held until
+	// their CP node sets up its association again or their session is adopted.
+	restored map[uint64]string
+	journal  *teidAllocJournal
+}
+
+func newTEIDPool(ranges []TEIDRangeInfo) *teidPool {
+	p := &teidPool{
+		used:     make(map[uint32]teidAlloc),
+		sessions: make(map[uint64]map[uint32]uint32),
+		restored: make(map[uint64]string),
+	}
+
+	for _, r := range ranges {
+		p.ranges = append(p.ranges, &teidRange{peer: r.Peer, start: r.Start, end: r.End, next: r.Start})
+	}
+
+	if len(p.ranges) == 0 {
+		p.ranges = []*teidRange{{start: 1, end: math.MaxUint32, next: 1}}
+	}
+
+	return p
+}
+
+// teidChooseKey returns the key of the TEID of a PDI: its CHOOSE ID if set, so that
+// PDIs with the same CHOOSE ID share their TEID, its PDR ID otherwise.
+func teidChooseKey(pdrID uint32, chooseID uint8, hasChooseID bool) uint32 {
+	if hasChooseID {
+		return 1<<16 | uint32(chooseID)
+	}
+
+	return pdrID
+}
+
+func (p *teidPool) rangeOf(peer string) *teidRange {
+	var fallback *teidRange
+
+	for _, r := range p.ranges {
+		if r.peer == peer {
+			return r
+		}
+
+		if r.peer == "" {
+			fallback = r
+		}
+	}
+
+	return fallback
+}
+
+// allocate returns the TEID of key in the session of seid, allocating one from the
+// range of peer if needed.
+func (p *teidPool) allocate(peer string, seid uint64, key uint32) (uint32, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if teid, ok := p.sessions[seid][key]; ok {
+		return teid, nil
+	}
+
+	r := p.rangeOf(peer)
+	if r == nil {
+		return 0, fmt.Errorf("%w: no TEID range for CP node %s", errNoTEIDs, peer)
+	}
+
+	teid := r.next
+
+	for {
+		if _, ok := p.used[teid]; !ok {
+			break
+		}
+
+		if teid == r.end {
+			teid = r.start
+		} else {
+			teid++
+		}
+
+		if teid == r.next {
+			return 0, fmt.Errorf("%w: TEID range of CP node %s exhausted", errNoTEIDs, peer)
+		}
+	}
+
+	r.next = teid + 1
+	if teid == r.end {
+		r.next = r.start
+	}
+
+	p.store(teidAlloc{peer: peer, seid: seid, key: key}, teid)
+
+	return teid, nil
+}
+
+func (p *teidPool) store(a teidAlloc, teid uint32) {
+	p.used[teid] = a
+
+	if p.sessions[a.seid] == nil {
+		p.sessions[a.seid] = make(map[uint32]uint32)
+	}
+
+	p.sessions[a.seid][a.key] = teid
+
+	if p.journal != nil {
+		p.journal.recordAlloc(a, teid)
+	}
+}
+
+// adopt records teid as allocated to key in the session of seid, replicated from
+// another instance.
+func (p *teidPool) adopt(peer string, seid uint64, key, teid uint32) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.restored, seid)
+
+	if a, ok := p.used[teid]; ok && a.seid == seid && a.key == key {
+		return
+	}
+
+	p.store(teidAlloc{peer: peer, seid: seid, key: key}, teid)
+}
+
+// usage returns the number of allocated TEIDs and the size of the ranges.
+func (p *teidPool) usage() (used, size uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, r := range p.ranges {
+		size += uint64(r.end-r.start) + 1
+	}
+
+	return uint64(len(p.used)), size
+}
+
+// release frees the TEIDs of the session of seid.
+func (p *teidPool) release(seid uint64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.releaseLocked(seid)
+}
+
+func (p *teidPool) releaseLocked(seid uint64) {
+	teids, ok := p.sessions[seid]
+	if !ok {
+		return
+	}
+
+	for _, teid := range teids {
+		delete(p.used, teid)
+	}
+
+	delete(p.sessions, seid)
+	delete(p.restored, seid)
+
+	if p.journal != nil {
+		p.journal.recordRelease(seid)
+	}
+}
+
+// releaseRestored frees the TEIDs restored for the sessions of peer, which it no
+// longer knows once it sets up its association again.
+func (p *teidPool) releaseRestored(peer string) int {
+	if p == nil {
+		return 0
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	released := 0
+
+	for seid, restoredPeer := range p.restored {
+		if restoredPeer == peer {
+			p.releaseLocked(seid)
+			released++
+		}
+	}
+
+	return released
+}
+
+// persist restores the allocations journaled at path, and journals the next ones.
+func (p *teidPool) persist(path string) error {
+	journal, allocs, err := openTEIDAllocJournal(path)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for teid, a := range allocs {
+		p.used[teid] = a
+
+		if p.sessions[a.seid] == nil {
+			p.sessions[a.seid] = make(map[uint32]uint32)
+		}
+
+		p.sessions[a.seid][a.key] = teid
+		p.restored[a.seid] = a.peer
+	}
+
+	p.journal = journal
+
+	log.Infoln("Restored", len(allocs), "TEID allocations from", path)
+
+	return nil
+}
+
+// journalNoPeer stands for the empty node ID of a CP node in the journal.
+const journalNoPeer = "-"
+
+func journalPeer(peer string) string {
+	if peer == "" {
+		return journalNoPeer
+	}
+
+	return peer
+}
+
+// teidAllocJournal records TEID allocations in a file, like the UE IP journal, so
+// that a restarted UPF does not hand out the TEIDs of surviving sessions.
+type teidAllocJournal struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// openTEIDAllocJournal replays and compacts the journal at path, and returns the
+// TEIDs still allocated.
+func openTEIDAllocJournal(path string) (*teidAllocJournal, map[uint32]teidAlloc, error) {
+	allocs := make(map[uint32]teidAlloc)
+
+	f, err := os.Open(path)
+
+	switch {
+	case err == nil:
+		err = replayTEIDAllocJournal(f, allocs)
+		f.Close()
+
+		if err != nil {
+			return nil, allocs, err
+		}
+	case !os.IsNotExist(err):
+		return nil, allocs, err
+	}
+
+	tmp := path + ".tmp"
+
+	f, err = os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, allocs, err
+	}
+
+	w := bufio.NewWriter(f)
+
+	for teid, a := range allocs {
+		fmt.Fprintf(w, "alloc %s %d %d %d\n", journalPeer(a.peer), a.seid, a.key, teid)
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return nil, allocs, err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, allocs, err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		f.Close()
+		return nil, allocs, err
+	}
+
+	return &teidAllocJournal{path: path, file: f}, allocs, nil
+}
+
+func replayTEIDAllocJournal(r io.Reader, allocs map[uint32]teidAlloc) error {
+	scanner := bufio.NewScanner(r)
+
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+
+		switch {
+		case len(fields) == 5 && fields[0] == "alloc":
+			seid, errSEID := strconv.ParseUint(fields[2], 10, 64)
+			key, errKey := strconv.ParseUint(fields[3], 10, 32)
+			teid, errTEID := strconv.ParseUint(fields[4], 10, 32)
+
+			if errSEID != nil || errKey != nil || errTEID != nil {
+				return ErrInvalidArgumentWithReason("TEID journal line", n, "invalid number")
+			}
+
+			peer := fields[1]
+			if peer == journalNoPeer {
+				peer = ""
+			}
+
+			allocs[uint32(teid)] = teidAlloc{peer: peer, seid: seid, key: uint32(key)}
+		case len(fields) == 2 && fields[0] == "release":
+			seid, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return ErrInvalidArgumentWithReason("TEID journal line", n, err.Error())
+			}
+
+			for teid, a := range allocs {
+				if a.seid == seid {
+					delete(allocs, teid)
+				}
+			}
+		default:
+			return ErrInvalidArgumentWithReason("TEID journal line", n, "unknown record")
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (j *teidAllocJournal) write(format string, a ...interface{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := fmt.Fprintf(j.file, format, a...); err != nil {
+		log.Errorln("Failed to write TEID journal", j.path, ":", err)
+	}
+}
+
+// close closes the journal file. Nothing is closed for a nil journal.
+func (j *teidAllocJournal) close() {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.file.Close()
+}
+
+func (j *teidAllocJournal) recordAlloc(a teidAlloc, teid uint32) {
+	j.write("alloc %s %d %d %d\n", journalPeer(a.peer), a.seid, a.key, teid)
+}
+
+func (j *teidAllocJournal) recordRelease(seid uint64) {
+	j.write("release %d\n", seid)
+}
+
+// allocTEID returns the F-TEID chosen by the UPF for key in the session of seid, with
+// the IP of the interface of srcIface.
+func (pConn *PFCPConn) allocTEID(seid uint64, key uint32, srcIface uint8) (uint32, net.IP, error) {
+	pool := pConn.upf.teidPool
+	if pool == nil {
+		return 0, nil, ErrOperationFailedWithReason("F-TEID allocation", "FTUP is not enabled")
+	}
+
+	teid, err := pool.allocate(pConn.nodeID.remote, seid, key)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if srcIface == core {
+		return teid, pConn.upf.CoreIP, nil
+	}
+
+	return teid, pConn.upf.AccessIP, nil
+}
+
+// releaseRestoredTEIDs frees the TEIDs restored for the sessions of the CP node, set
+// up again.
+func (pConn *PFCPConn) releaseRestoredTEIDs() {
+	if n := pConn.upf.teidPool.releaseRestored(pConn.nodeID.remote); n > 0 {
+		log.Infoln("Released the TEIDs restored for", n, "sessions of", pConn.nodeID.remote)
+	}
+}
@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTEIDPool_allocate(t *testing.T) {
+	p := newTEIDPool([]TEIDRangeInfo{
+		{Peer: "smf1", Start: 100, End: 101},
+		{Start: 1000, End: 1999},
+	})
+
+	teid, err := p.allocate("smf1", 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint32(100), teid)
+
+	shared, err := p.allocate("smf1", 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, teid, shared, "PDIs with the same key share their TEID")
+
+	teid, err = p.allocate("smf2", 2, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1000), teid, "CP nodes without a range use the default one")
+
+	_, err = p.allocate("smf1", 3, 1)
+	require.NoError(t, err)
+
+	_, err = p.allocate("smf1", 4, 1)
+	require.ErrorIs(t, err, errNoTEIDs)
+	require.Equal(t, uint8(75), ruleErrorCause(err))
+
+	p.release(1)
+
+	teid, err = p.allocate("smf1", 4, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint32(100), teid, "TEIDs of removed sessions are reused")
+
+	p = newTEIDPool([]TEIDRangeInfo{{Peer: "smf1", Start: 100, End: 101}})
+	_, err = p.allocate("smf2", 1, 1)
+	require.ErrorIs(t, err, errNoTEIDs)
+}
+
+func TestTEIDPool_persist(t *testing.T) {
+	path := t.TempDir() + "/teids"
+
+	p := newTEIDPool(nil)
+	require.NoError(t, p.persist(path))
+
+	for seid := uint64(1); seid <= 3; seid++ {
+		_, err := p.allocate("smf1", seid, 1)
+		require.NoError(t, err)
+	}
+
+	_, err := p.allocate("smf2", 4, teidChooseKey(1, 5, true))
+	require.NoError(t, err)
+
+	p.release(2)
+
+	// Restarted.
+	p = newTEIDPool(nil)
+	require.NoError(t, p.persist(path))
+	require.Len(t, p.used, 3)
+
+	for _, want := range []uint32{2, 5} {
+		teid, err := p.allocate("smf1", uint64(want)+10, 1)
+		require.NoError(t, err)
+		require.Equal(t, want, teid, "restored TEIDs are not handed out")
+	}
+
+	require.Equal(t, 2, p.releaseRestored("smf1"))
+	require.Len(t, p.used, 3)
+
+	p.adopt("smf2", 4, teidChooseKey(1, 5, true), 4)
+	require.Zero(t, p.releaseRestored("smf2"), "adopted sessions are kept")
+}
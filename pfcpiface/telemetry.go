@@ -4,7 +4,9 @@
 package pfcpiface
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -34,6 +36,32 @@ type upfCollector struct {
 	latency *prometheus.Desc
 	jitter  *prometheus.Desc
 
+	gtpuPathUp       *prometheus.Desc
+	gtpuPathRTT      *prometheus.Desc
+	gtpuEchoTimeouts *prometheus.Desc
+
+	rulesOutOfSync *prometheus.Desc
+
+	loadMetric        *prometheus.Desc
+	overloadActive    *prometheus.Desc
+	overloadReduction *prometheus.Desc
+
+	sessionsMax        *prometheus.Desc
+	sessionsSaturation *prometheus.Desc
+
+	bessConnState   *prometheus.Desc
+	bessConnChanges *prometheus.Desc
+
+	reportNotifications *prometheus.Desc
+	reportsPending      *prometheus.Desc
+
+	up4CellsAllocated   *prometheus.Desc
+	up4CellsUtilization *prometheus.Desc
+
+	sliceBytes          *prometheus.Desc
+	sliceDroppedPackets *prometheus.Desc
+	sliceDroppedBytes   *prometheus.Desc
+
 	upf *upf
 }
 
@@ -59,6 +87,78 @@ func newUpfCollector(upf *upf) *upfCollector {
 			"Shows the packet processing jitter percentiles in UPF",
 			[]string{"iface"}, nil,
 		),
+		gtpuPathUp: prometheus.NewDesc(prometheus.BuildFQName("upf", "gtpu_path", "up"),
+			"Shows whether the remote GTP-U peer answers GTP-U Echo Requests",
+			[]string{"peer", "iface"}, nil,
+		),
+		gtpuPathRTT: prometheus.NewDesc(prometheus.BuildFQName("upf", "gtpu_path", "rtt_seconds"),
+			"Shows the round-trip time of the last answered GTP-U Echo Request",
+			[]string{"peer", "iface"}, nil,
+		),
+		gtpuEchoTimeouts: prometheus.NewDesc(prometheus.BuildFQName("upf", "gtpu_path", "echo_timeouts_total"),
+			"Shows the number of GTP-U Echo Requests left unanswered by the remote GTP-U peer",
+			[]string{"peer", "iface"}, nil,
+		),
+		rulesOutOfSync: prometheus.NewDesc(prometheus.BuildFQName("upf", "rules", "out_of_sync"),
+			"Shows the number of PDRs missing from or stale in the datapath at the last rules audit",
+			[]string{"kind"}, nil,
+		),
+		loadMetric: prometheus.NewDesc(prometheus.BuildFQName("upf", "load", "metric"),
+			"Shows the utilization in percent of each resource at the last load sample, the highest being reported to CP nodes",
+			[]string{"resource"}, nil,
+		),
+		overloadActive: prometheus.NewDesc(prometheus.BuildFQName("upf", "overload", "active"),
+			"Shows 1 while the UPF is overloaded and asks CP nodes to throttle their requests",
+			nil, nil,
+		),
+		overloadReduction: prometheus.NewDesc(prometheus.BuildFQName("upf", "overload", "reduction_percent"),
+			"Shows the percentage of requests CP nodes are asked to throttle, 0 when not overloaded",
+			nil, nil,
+		),
+		sessionsMax: prometheus.NewDesc(prometheus.BuildFQName("upf", "sessions", "max"),
+			"Shows the number of PFCP sessions above which establishments are rejected",
+			nil, nil,
+		),
+		sessionsSaturation: prometheus.NewDesc(prometheus.BuildFQName("upf", "sessions", "saturation_ratio"),
+			"Shows the ratio of the number of PFCP sessions to their maximum",
+			nil, nil,
+		),
+		bessConnState: prometheus.NewDesc(prometheus.BuildFQName("upf", "bess", "connection_state"),
+			"Shows the state of the gRPC connection to BESS, 1 for the current state",
+			[]string{"state"}, nil,
+		),
+		bessConnChanges: prometheus.NewDesc(prometheus.BuildFQName("upf", "bess", "connection_state_changes_total"),
+			"Shows the number of times the gRPC connection to BESS entered a state",
+			[]string{"state"}, nil,
+		),
+		reportNotifications: prometheus.NewDesc(prometheus.BuildFQName("upf", "report_notifications", "total"),
+			"Shows the number of downlink data notifications of the datapath queued, coalesced with a pending one, or dropped",
+			[]string{"result"}, nil,
+		),
+		reportsPending: prometheus.NewDesc(prometheus.BuildFQName("upf", "report_notifications", "pending"),
+			"Shows the number of sessions with a downlink data notification pending",
+			nil, nil,
+		),
+		up4CellsAllocated: prometheus.NewDesc(prometheus.BuildFQName("upf", "up4_cells", "allocated"),
+			"Shows the number of cells of a P4 counter or meter of UP4 allocated to the rules",
+			[]string{"pool"}, nil,
+		),
+		up4CellsUtilization: prometheus.NewDesc(prometheus.BuildFQName("upf", "up4_cells", "utilization_ratio"),
+			"Shows the ratio of the allocated cells of a P4 counter or meter of UP4 to its size",
+			[]string{"pool"}, nil,
+		),
+		sliceBytes: prometheus.NewDesc(prometheus.BuildFQName("upf", "slice", "bytes_total"),
+			"Shows the number of bytes admitted by the meter of a slice",
+			[]string{"slice", "direction"}, nil,
+		),
+		sliceDroppedPackets: prometheus.NewDesc(prometheus.BuildFQName("upf", "slice", "dropped_packets_total"),
+			"Shows the number of packets dropped by the meter of a slice",
+			[]string{"slice", "direction"}, nil,
+		),
+		sliceDroppedBytes: prometheus.NewDesc(prometheus.BuildFQName("upf", "slice", "dropped_bytes_total"),
+			"Shows the number of bytes dropped by the meter of a slice",
+			[]string{"slice", "direction"}, nil,
+		),
 		upf: upf,
 	}
 }
@@ -71,12 +171,165 @@ func (uc *upfCollector) Describe(ch chan<- *prometheus.Desc) {
 
 	ch <- uc.latency
 	ch <- uc.jitter
+
+	ch <- uc.gtpuPathUp
+	ch <- uc.gtpuPathRTT
+	ch <- uc.gtpuEchoTimeouts
+
+	ch <- uc.rulesOutOfSync
+
+	ch <- uc.loadMetric
+	ch <- uc.overloadActive
+	ch <- uc.overloadReduction
+
+	ch <- uc.sessionsMax
+	ch <- uc.sessionsSaturation
+
+	ch <- uc.bessConnState
+	ch <- uc.bessConnChanges
+
+	ch <- uc.reportNotifications
+	ch <- uc.reportsPending
+
+	ch <- uc.up4CellsAllocated
+	ch <- uc.up4CellsUtilization
+
+	ch <- uc.sliceBytes
+	ch <- uc.sliceDroppedPackets
+	ch <- uc.sliceDroppedBytes
+
+	uc.upf.datapathMetrics.describe(ch)
 }
 
 // Collect writes all metrics to prometheus metric channel.
 func (uc *upfCollector) Collect(ch chan<- prometheus.Metric) {
-	uc.summaryLatencyJitter(ch)
-	uc.portStats(ch)
+	if uc.upf.collectorEnabled(collectorLatency) {
+		uc.summaryLatencyJitter(ch)
+	}
+
+	if uc.upf.collectorEnabled(collectorPort) {
+		uc.portStats(ch)
+	}
+
+	if uc.upf.collectorEnabled(collectorGTPUPath) {
+		uc.gtpuPathStats(ch)
+	}
+
+	uc.rulesAuditStats(ch)
+	uc.loadStats(ch)
+	uc.sessionLimitStats(ch)
+
+	if uc.upf.collectorEnabled(collectorSlice) {
+		uc.sliceStats(ch)
+	}
+
+	uc.reportStats(ch)
+
+	if uc.upf.collectorEnabled(collectorDatapath) {
+		uc.upf.datapathMetrics.collect(ch)
+	}
+}
+
+func (uc *upfCollector) reportStats(ch chan<- prometheus.Metric) {
+	if uc.upf.reports == nil {
+		return
+	}
+
+	pending, queued, coalesced, dropped := uc.upf.reports.stats()
+
+	ch <- prometheus.MustNewConstMetric(uc.reportNotifications, prometheus.CounterValue, float64(queued), "queued")
+	ch <- prometheus.MustNewConstMetric(uc.reportNotifications, prometheus.CounterValue, float64(coalesced), "coalesced")
+	ch <- prometheus.MustNewConstMetric(uc.reportNotifications, prometheus.CounterValue, float64(dropped), "dropped")
+	ch <- prometheus.MustNewConstMetric(uc.reportsPending, prometheus.GaugeValue, float64(pending))
+}
+
+func (uc *upfCollector) sessionLimitStats(ch chan<- prometheus.Metric) {
+	limit := &uc.upf.sessionLimit
+	if limit.max == 0 {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(uc.sessionsMax, prometheus.GaugeValue, float64(limit.max))
+	ch <- prometheus.MustNewConstMetric(uc.sessionsSaturation, prometheus.GaugeValue, limit.saturation())
+}
+
+func (uc *upfCollector) sliceStats(ch chan<- prometheus.Metric) {
+	for _, sliceInfo := range uc.upf.getSliceInfos() {
+		counters, err := uc.upf.ReadSliceMeterCounters(sliceInfo)
+		if err != nil {
+			if !errors.Is(err, errUnsupported) && !errors.Is(err, errNotFound) {
+				log.Errorln("Failed to read meter counters of slice", sliceInfo.name, ":", err)
+			}
+
+			continue
+		}
+
+		for direction, c := range counters {
+			ch <- prometheus.MustNewConstMetric(uc.sliceBytes, prometheus.CounterValue,
+				float64(c.bytes), sliceInfo.name, direction)
+			ch <- prometheus.MustNewConstMetric(uc.sliceDroppedPackets, prometheus.CounterValue,
+				float64(c.droppedPackets), sliceInfo.name, direction)
+			ch <- prometheus.MustNewConstMetric(uc.sliceDroppedBytes, prometheus.CounterValue,
+				float64(c.droppedBytes), sliceInfo.name, direction)
+		}
+	}
+}
+
+func (uc *upfCollector) loadStats(ch chan<- prometheus.Metric) {
+	if uc.upf.loadMonitor == nil {
+		return
+	}
+
+	sample, _ := uc.upf.loadMonitor.status()
+
+	ch <- prometheus.MustNewConstMetric(uc.loadMetric, prometheus.GaugeValue, float64(sample.sessions), "sessions")
+	ch <- prometheus.MustNewConstMetric(uc.loadMetric, prometheus.GaugeValue, float64(sample.cpu), "cpu")
+	ch <- prometheus.MustNewConstMetric(uc.loadMetric, prometheus.GaugeValue, float64(sample.datapathQueue), "datapath_queue")
+
+	if uc.upf.loadMonitor.overload == nil {
+		return
+	}
+
+	overloaded, reduction := uc.upf.loadMonitor.overload.status()
+
+	active := 0.0
+	if overloaded {
+		active = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(uc.overloadActive, prometheus.GaugeValue, active)
+	ch <- prometheus.MustNewConstMetric(uc.overloadReduction, prometheus.GaugeValue, float64(reduction))
+}
+
+func (uc *upfCollector) rulesAuditStats(ch chan<- prometheus.Metric) {
+	if uc.upf.auditor == nil {
+		return
+	}
+
+	missing, stale := uc.upf.auditor.outOfSync()
+
+	ch <- prometheus.MustNewConstMetric(uc.rulesOutOfSync, prometheus.GaugeValue, float64(missing), "missing")
+	ch <- prometheus.MustNewConstMetric(uc.rulesOutOfSync, prometheus.GaugeValue, float64(stale), "stale")
+}
+
+func (uc *upfCollector) gtpuPathStats(ch chan<- prometheus.Metric) {
+	if uc.upf.pathMonitor == nil {
+		return
+	}
+
+	for _, s := range uc.upf.pathMonitor.status() {
+		up := 0.0
+		if s.up {
+			up = 1
+		}
+
+		iface := dstIntfName(s.dstIntf)
+
+		ch <- prometheus.MustNewConstMetric(uc.gtpuPathUp, prometheus.GaugeValue, up, s.peer, iface)
+		ch <- prometheus.MustNewConstMetric(uc.gtpuPathRTT, prometheus.GaugeValue, s.rtt.Seconds(), s.peer, iface)
+		ch <- prometheus.MustNewConstMetric(uc.gtpuEchoTimeouts, prometheus.CounterValue,
+			float64(s.timeouts), s.peer, iface)
+	}
 }
 
 func (uc *upfCollector) portStats(ch chan<- prometheus.Metric) {
@@ -97,6 +350,20 @@ type PfcpNodeCollector struct {
 	sessionRxPackets      *prometheus.Desc
 	sessionDroppedPackets *prometheus.Desc
 	sessionTxBytes        *prometheus.Desc
+
+	associationUp       *prometheus.Desc
+	associationUptime   *prometheus.Desc
+	peerRecoveryTS      *prometheus.Desc
+	associationRestarts *prometheus.Desc
+
+	storeSessions *prometheus.Desc
+	storeRules    *prometheus.Desc
+	storeBytes    *prometheus.Desc
+
+	ipPoolAllocated   *prometheus.Desc
+	ipPoolUtilization *prometheus.Desc
+	teidAllocated     *prometheus.Desc
+	teidUtilization   *prometheus.Desc
 }
 
 func NewPFCPNodeCollector(node *PFCPNode) *PfcpNodeCollector {
@@ -126,6 +393,50 @@ func NewPFCPNodeCollector(node *PFCPNode) *PfcpNodeCollector {
 			"Shows the total number of bytes for a given session in UPF",
 			[]string{"fseid", "pdr", "ue_ip"}, nil,
 		),
+		associationUp: prometheus.NewDesc(prometheus.BuildFQName("upf", "pfcp", "association_up"),
+			"Whether the PFCP association with a CP node is up",
+			[]string{"peer"}, nil,
+		),
+		associationUptime: prometheus.NewDesc(prometheus.BuildFQName("upf", "pfcp", "association_uptime_seconds"),
+			"Time since the PFCP association with a CP node was set up, 0 while down",
+			[]string{"peer"}, nil,
+		),
+		peerRecoveryTS: prometheus.NewDesc(prometheus.BuildFQName("upf", "pfcp", "peer_recovery_timestamp_seconds"),
+			"Last Recovery Time Stamp advertised by a CP node, in seconds since the epoch",
+			[]string{"peer"}, nil,
+		),
+		associationRestarts: prometheus.NewDesc(prometheus.BuildFQName("upf", "pfcp", "association_restarts_total"),
+			"Number of restarts of a CP node detected from a newer Recovery Time Stamp",
+			[]string{"peer"}, nil,
+		),
+		storeSessions: prometheus.NewDesc(prometheus.BuildFQName("upf", "store", "sessions"),
+			"Number of the sessions of a CP node in the session store",
+			[]string{"peer"}, nil,
+		),
+		storeRules: prometheus.NewDesc(prometheus.BuildFQName("upf", "store", "rules"),
+			"Number of the rules of the sessions of a CP node in the session store, by kind",
+			[]string{"peer", "kind"}, nil,
+		),
+		storeBytes: prometheus.NewDesc(prometheus.BuildFQName("upf", "store", "bytes"),
+			"Estimated memory held by the sessions of a CP node in the session store",
+			[]string{"peer"}, nil,
+		),
+		ipPoolAllocated: prometheus.NewDesc(prometheus.BuildFQName("upf", "ip_pool", "allocated"),
+			"Number of the allocated and reserved UE addresses of a pool, IPv6 prefixes for IPv6 pools",
+			[]string{"dnn", "family"}, nil,
+		),
+		ipPoolUtilization: prometheus.NewDesc(prometheus.BuildFQName("upf", "ip_pool", "utilization_ratio"),
+			"Ratio of the allocated and reserved UE addresses of a pool to its size",
+			[]string{"dnn", "family"}, nil,
+		),
+		teidAllocated: prometheus.NewDesc(prometheus.BuildFQName("upf", "teid_pool", "allocated"),
+			"Number of the TEIDs allocated by the UPF",
+			nil, nil,
+		),
+		teidUtilization: prometheus.NewDesc(prometheus.BuildFQName("upf", "teid_pool", "utilization_ratio"),
+			"Ratio of the TEIDs allocated by the UPF to the size of the TEID ranges",
+			nil, nil,
+		),
 	}
 }
 
@@ -134,7 +445,15 @@ func (col PfcpNodeCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (col PfcpNodeCollector) Collect(ch chan<- prometheus.Metric) {
-	if col.node.upf.EnableFlowMeasure {
+	col.associationStats(ch)
+
+	if col.node.upf.collectorEnabled(collectorStore) {
+		col.storeStats(ch)
+	}
+
+	col.poolStats(ch)
+
+	if col.node.upf.EnableFlowMeasure && col.node.upf.collectorEnabled(collectorSession) {
 		err := col.node.upf.SessionStats(&col, ch)
 		if err != nil {
 			log.Errorln(err)
@@ -143,7 +462,77 @@ func (col PfcpNodeCollector) Collect(ch chan<- prometheus.Metric) {
 	}
 }
 
-func setupProm(mux *http.ServeMux, upf *upf, node *PFCPNode) (*upfCollector, *PfcpNodeCollector, error) {
+func (col PfcpNodeCollector) associationStats(ch chan<- prometheus.Metric) {
+	now := time.Now()
+
+	for peer, s := range col.node.upf.associations.snapshot() {
+		up, uptime := 0.0, 0.0
+		if s.up {
+			up, uptime = 1, now.Sub(s.since).Seconds()
+		}
+
+		var recoveryTS float64
+		if !s.recoveryTS.IsZero() {
+			recoveryTS = float64(s.recoveryTS.Unix())
+		}
+
+		ch <- prometheus.MustNewConstMetric(col.associationUp, prometheus.GaugeValue, up, peer)
+		ch <- prometheus.MustNewConstMetric(col.associationUptime, prometheus.GaugeValue, uptime, peer)
+		ch <- prometheus.MustNewConstMetric(col.peerRecoveryTS, prometheus.GaugeValue, recoveryTS, peer)
+		ch <- prometheus.MustNewConstMetric(col.associationRestarts, prometheus.CounterValue, float64(s.restarts), peer)
+	}
+}
+
+func (col PfcpNodeCollector) storeStats(ch chan<- prometheus.Metric) {
+	col.node.pConns.Range(func(key, value interface{}) bool {
+		pConn := value.(*PFCPConn)
+		peer := pConn.nodeID.remote
+
+		var sessions, pdrs, fars, qers, bytes uint64
+
+		for _, s := range pConn.store.GetAllSessions() {
+			sessions++
+			pdrs += uint64(len(s.pdrs))
+			fars += uint64(len(s.fars))
+			qers += uint64(len(s.qers))
+			bytes += s.footprint()
+		}
+
+		ch <- prometheus.MustNewConstMetric(col.storeSessions, prometheus.GaugeValue, float64(sessions), peer)
+		ch <- prometheus.MustNewConstMetric(col.storeRules, prometheus.GaugeValue, float64(pdrs), peer, "pdr")
+		ch <- prometheus.MustNewConstMetric(col.storeRules, prometheus.GaugeValue, float64(fars), peer, "far")
+		ch <- prometheus.MustNewConstMetric(col.storeRules, prometheus.GaugeValue, float64(qers), peer, "qer")
+		ch <- prometheus.MustNewConstMetric(col.storeBytes, prometheus.GaugeValue, float64(bytes), peer)
+
+		return true
+	})
+}
+
+func (col PfcpNodeCollector) poolStats(ch chan<- prometheus.Metric) {
+	if pools := col.node.upf.ippools; pools != nil {
+		status := pools.status()
+
+		for family, statuses := range map[string][]ipPoolStatus{"ipv4": status.Pools, "ipv6": status.IPv6Pools} {
+			for _, s := range statuses {
+				ch <- prometheus.MustNewConstMetric(col.ipPoolAllocated, prometheus.GaugeValue,
+					float64(s.Size-s.Free), s.DNN, family)
+				ch <- prometheus.MustNewConstMetric(col.ipPoolUtilization, prometheus.GaugeValue,
+					s.Utilization, s.DNN, family)
+			}
+		}
+	}
+
+	if pool := col.node.upf.teidPool; pool != nil {
+		used, size := pool.usage()
+
+		ch <- prometheus.MustNewConstMetric(col.teidAllocated, prometheus.GaugeValue, float64(used))
+		ch <- prometheus.MustNewConstMetric(col.teidUtilization, prometheus.GaugeValue, float64(used)/float64(size))
+	}
+}
+
+// setupProm registers the collectors of upf and node, and serves the metrics gathered
+// by g on mux.
+func setupProm(mux *http.ServeMux, upf *upf, node *PFCPNode, g prometheus.Gatherer) (*upfCollector, *PfcpNodeCollector, error) {
 	uc := newUpfCollector(upf)
 	if err := prometheus.Register(uc); err != nil {
 		return nil, nil, err
@@ -154,7 +543,8 @@ func setupProm(mux *http.ServeMux, upf *upf, node *PFCPNode) (*upfCollector, *Pf
 		return nil, nil, err
 	}
 
-	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(g, promhttp.HandlerOpts{})))
 
 	return uc, nc, nil
 }
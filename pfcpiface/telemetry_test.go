@@ -4,7 +4,11 @@
 package pfcpiface
 
 import (
+	"testing"
+
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
 )
 
 // TODO: we currently need to reset the DefaultRegisterer between tests, as some
@@ -54,3 +58,77 @@ func restoreReg() {
 //	})
 //}
 //
+
+type sliceMeterDatapath struct {
+	fakeDatapath
+}
+
+func (d *sliceMeterDatapath) ReadSliceMeterCounters(sliceInfo *SliceInfo) (map[string]sliceMeterCounters, error) {
+	if sliceInfo.name != "metered" {
+		return nil, ErrNotFoundWithParam("slice meter", "slice", sliceInfo.name)
+	}
+
+	return map[string]sliceMeterCounters{
+		sliceDirectionBoth: {bytes: 1000, droppedPackets: 2, droppedBytes: 300},
+	}, nil
+}
+
+func Test_upfCollector_sliceStats(t *testing.T) {
+	u := &upf{datapath: &sliceMeterDatapath{}}
+	require.NoError(t, u.addSliceInfo(&SliceInfo{name: "metered"}))
+	require.NoError(t, u.addSliceInfo(&SliceInfo{name: "other"}))
+
+	ch := make(chan prometheus.Metric, 10)
+	newUpfCollector(u).sliceStats(ch)
+	close(ch)
+
+	var values []float64
+
+	for m := range ch {
+		var metric dto.Metric
+		require.NoError(t, m.Write(&metric))
+		require.Equal(t, "metered", metric.GetLabel()[1].GetValue())
+		values = append(values, metric.GetCounter().GetValue())
+	}
+
+	require.Equal(t, []float64{1000, 2, 300}, values)
+}
+
+func TestPfcpNodeCollector_resourceStats(t *testing.T) {
+	pools, err := NewIPPools("10.0.0.0/29", "", nil)
+	require.NoError(t, err)
+
+	_, err = pools.LookupOrAllocIP("", 1)
+	require.NoError(t, err)
+
+	teids := newTEIDPool([]TEIDRangeInfo{{Start: 1, End: 4}})
+	_, err = teids.allocate("", 1, 1)
+	require.NoError(t, err)
+
+	node := &PFCPNode{upf: &upf{ippools: pools, teidPool: teids}}
+	pConn := &PFCPConn{store: NewInMemoryStore()}
+	pConn.nodeID.remote = "198.18.0.2"
+	node.pConns.Store("198.18.0.2:8805", pConn)
+
+	session := PFCPSession{localSEID: 1, PacketForwardingRules: PacketForwardingRules{
+		pdrs: []pdr{{pdrID: 1}, {pdrID: 2}},
+		fars: []far{{farID: 1}},
+	}}
+	require.NoError(t, pConn.store.PutSession(session, nil, false, 0))
+
+	ch := make(chan prometheus.Metric, 20)
+	col := NewPFCPNodeCollector(node)
+	col.storeStats(ch)
+	col.poolStats(ch)
+	close(ch)
+
+	var values []float64
+
+	for m := range ch {
+		var metric dto.Metric
+		require.NoError(t, m.Write(&metric))
+		values = append(values, metric.GetGauge().GetValue())
+	}
+
+	require.Equal(t, []float64{1, 2, 1, 0, float64(session.footprint()), 1, 1.0 / 6, 1, 0.25}, values)
+}
@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// wheelTick is the resolution of the timer wheel, matching the one-second
+	// granularity of the Measurement Period IE.
+	wheelTick = time.Second
+	// wheelSlots is the number of slots of the timer wheel. Longer periods
+	// go around the wheel more than once.
+	wheelSlots = 512
+)
+
+type urrTimerKey struct {
+	pConn *PFCPConn
+	seid  uint64
+	urrID uint32
+}
+
+// urrTimer is a pending periodic measurement report for one URR.
+type urrTimer struct {
+	urrTimerKey
+	period uint32 // in seconds
+	rounds uint32
+	gen    uint64
+}
+
+// timerWheel schedules the periodic usage reports of all URRs with a single
+// ticker. Timers are cancelled lazily: rescheduling or cancelling a URR changes
+// its generation, and stale timers are discarded when their slot expires.
+type timerWheel struct {
+	mu     sync.Mutex
+	slots  [wheelSlots][]*urrTimer
+	cursor int
+	// gens are the generations of the armed timers. Generations are never reused,
+	// so that a stale timer cannot match the timer of a rescheduled URR.
+	gens    map[urrTimerKey]uint64
+	lastGen uint64
+}
+
+func newTimerWheel() *timerWheel {
+	return &timerWheel{
+		gens: make(map[urrTimerKey]uint64),
+	}
+}
+
+// schedule arms the periodic report of a URR, replacing any pending one.
+func (w *timerWheel) schedule(key urrTimerKey, period uint32) {
+	if period == 0 {
+		w.cancel(key)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lastGen++
+	w.gens[key] = w.lastGen
+
+	w.unsafeAdd(&urrTimer{urrTimerKey: key, period: period, gen: w.lastGen})
+}
+
+// cancel disarms the periodic report of a URR.
+func (w *timerWheel) cancel(key urrTimerKey) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.gens, key)
+}
+
+func (w *timerWheel) unsafeAdd(t *urrTimer) {
+	ticks := int(t.period)
+	t.rounds = uint32((ticks - 1) / wheelSlots)
+	slot := (w.cursor + ticks) % wheelSlots
+	w.slots[slot] = append(w.slots[slot], t)
+}
+
+// advance moves the wheel by one tick and returns the timers that expired.
+// Expired timers are re-armed for their next period.
+func (w *timerWheel) advance() []*urrTimer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.cursor = (w.cursor + 1) % wheelSlots
+
+	pending := w.slots[w.cursor]
+	w.slots[w.cursor] = nil
+
+	var expired []*urrTimer
+
+	for _, t := range pending {
+		if w.gens[t.urrTimerKey] != t.gen {
+			continue
+		}
+
+		if t.rounds > 0 {
+			t.rounds--
+			w.slots[w.cursor] = append(w.slots[w.cursor], t)
+
+			continue
+		}
+
+		expired = append(expired, t)
+		w.unsafeAdd(t)
+	}
+
+	return expired
+}
+
+// run drives the wheel until ctx is done, handing expired timers to their
+// connection in one batch per connection.
+func (w *timerWheel) run(ctx context.Context) {
+	ticker := time.NewTicker(wheelTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infoln("Stopping periodic usage reports")
+			return
+		case <-ticker.C:
+			expired := w.advance()
+			if len(expired) == 0 {
+				continue
+			}
+
+			batches := make(map[*PFCPConn][]*urrTimer)
+			for _, t := range expired {
+				batches[t.pConn] = append(batches[t.pConn], t)
+			}
+
+			for pConn, timers := range batches {
+				pConn.sendPeriodicReports(timers)
+			}
+		}
+	}
+}
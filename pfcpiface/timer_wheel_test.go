@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// advanceUntilExpired advances w until a timer expires and returns the number of ticks taken.
+func advanceUntilExpired(t *testing.T, w *timerWheel, limit int) int {
+	for i := 1; i <= limit; i++ {
+		if expired := w.advance(); len(expired) > 0 {
+			require.Len(t, expired, 1)
+			return i
+		}
+	}
+
+	return 0
+}
+
+func Test_timerWheel(t *testing.T) {
+	key := urrTimerKey{seid: 1, urrID: 1}
+
+	t.Run("fires every period", func(t *testing.T) {
+		w := newTimerWheel()
+		w.schedule(key, 3)
+
+		require.Equal(t, 3, advanceUntilExpired(t, w, 10))
+		require.Equal(t, 3, advanceUntilExpired(t, w, 10))
+	})
+
+	t.Run("period longer than the wheel", func(t *testing.T) {
+		w := newTimerWheel()
+		w.schedule(key, wheelSlots+5)
+
+		require.Equal(t, wheelSlots+5, advanceUntilExpired(t, w, 2*wheelSlots))
+	})
+
+	t.Run("period equal to the wheel", func(t *testing.T) {
+		w := newTimerWheel()
+		w.schedule(key, wheelSlots)
+
+		require.Equal(t, wheelSlots, advanceUntilExpired(t, w, 2*wheelSlots))
+		require.Equal(t, wheelSlots, advanceUntilExpired(t, w, 2*wheelSlots))
+	})
+
+	t.Run("reschedule replaces pending timer", func(t *testing.T) {
+		w := newTimerWheel()
+		w.schedule(key, 3)
+		w.schedule(key, 5)
+
+		require.Equal(t, 5, advanceUntilExpired(t, w, 10))
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		w := newTimerWheel()
+		w.schedule(key, 3)
+		w.cancel(key)
+
+		require.Equal(t, 0, advanceUntilExpired(t, w, 10))
+	})
+
+	t.Run("cancel then reschedule", func(t *testing.T) {
+		w := newTimerWheel()
+		w.schedule(key, 3)
+		w.cancel(key)
+		w.schedule(key, 3)
+
+		// The stale timer in the same slot does not fire.
+		require.Equal(t, 3, advanceUntilExpired(t, w, 10))
+		require.Equal(t, 3, advanceUntilExpired(t, w, 10))
+	})
+}
@@ -5,6 +5,7 @@ package pfcpiface
 
 import (
 	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
 	"math"
@@ -33,12 +34,15 @@ const (
 	maxGTPTunnelPeerIDs = 253
 	maxApplicationIDs   = 254
 
+	// up4CPUCloneSession is the clone session of the clone_to_cpu ACL action.
+	up4CPUCloneSession = 99
+
 	meterTypeApplication uint8 = 1
 	meterTypeSession     uint8 = 2
 
-	// DefaultQFI is set if no QER is sent by a control plane in PFCP messages.
+	// DefaultQFI is set if no QER is sent by a control plane in PFCP messages,
+	// unless overridden by p4rtciface.default_qfi.
 	// QFI=9 is used as a default value, because many Aether configurations uses it as default.
-	// TODO: we might want to make it configurable in future.
 	DefaultQFI = 9
 )
 
@@ -143,6 +147,10 @@ type UP4 struct {
 	meters               map[meterID]meter
 	appMeterCellIDsPool  set.Set
 	sessMeterCellIDsPool set.Set
+	appMeterSize         uint64
+	sessMeterSize        uint64
+	// qciQosMap stores the burst sizes of the meters of the QERs, per QCI.
+	qciQosMap map[uint8]*QosConfigVal
 
 	// ueAddrToFSEID is used to store UE Address <-> F-SEID mapping,
 	// which is needed to efficiently find F-SEID when we receive a P4 Digest (DDN) for a UE address.
@@ -152,8 +160,13 @@ type UP4 struct {
 	// We need both maps to make lookup efficient, but both maps should always be updated in atomic way.
 	fseidToUEAddr map[uint64]uint32
 
-	reportNotifyChan chan<- uint64
-	endMarkerChan    chan []byte
+	reports       *reportPipeline
+	resyncChan    chan<- struct{}
+	endMarkerChan chan []byte
+
+	// mirrorPort is the port the traffic of the FARs with the DUPL action is cloned to,
+	// 0 unless FAR duplication is enabled.
+	mirrorPort uint32
 }
 
 func toUP4ApplicationFilter(p pdr) up4ApplicationFilter {
@@ -224,6 +237,29 @@ func (up4 *UP4) AddSliceInfo(sliceInfo *SliceInfo) error {
 	return nil
 }
 
+// RemoveSliceInfo resets the slice meter to its default config, which does not meter
+// the traffic. The meter cell is the one of p4rtciface.slice_id, shared by all slices.
+func (up4 *UP4) RemoveSliceInfo(sliceInfo *SliceInfo) error {
+	err := up4.tryConnect()
+	if err != nil {
+		log.Error("UP4 server not connected")
+		return ErrOperationFailedWithReason("removeSliceInfo", "data plane is not connected")
+	}
+
+	meterCellId, err := GetSliceTCMeterIndex(up4.conf.SliceID, up4.conf.DefaultTC)
+	if err != nil {
+		return err
+	}
+
+	sliceMeterEntry := up4.p4RtTranslator.BuildMeterEntry(p4constants.MeterPreQosPipeSliceTcMeter, uint32(meterCellId), nil)
+
+	log.WithFields(log.Fields{
+		"Slice meter entry": sliceMeterEntry,
+	}).Debug("Resetting slice P4 Meter entry")
+
+	return up4.p4client.ApplyMeterEntries(p4.Update_MODIFY, sliceMeterEntry)
+}
+
 func (up4 *UP4) SummaryLatencyJitter(uc *upfCollector, ch chan<- prometheus.Metric) {
 }
 
@@ -231,7 +267,115 @@ func (up4 *UP4) SessionStats(*PfcpNodeCollector, chan<- prometheus.Metric) error
 	return nil
 }
 
+// ReadSliceMeterCounters is not supported, P4Runtime meters do not count the traffic
+// they color.
+func (up4 *UP4) ReadSliceMeterCounters(sliceInfo *SliceInfo) (map[string]sliceMeterCounters, error) {
+	return nil, ErrUnsupported("slice meter counters", "up4")
+}
+
+// ReadPDRCounters reads the post-QoS counter cells allocated to pdrs.
+func (up4 *UP4) ReadPDRCounters(pdrs []pdr) (map[pdrCounterKey]pdrCounters, error) {
+	if !up4.IsConnected(nil) {
+		return nil, ErrOperationFailedWithReason("read counters", "UP4 server not connected")
+	}
+
+	entities := make([]*p4.Entity, 0, len(pdrs))
+	keys := make(map[int64]pdrCounterKey, len(pdrs))
+
+	for _, p := range pdrs {
+		keys[int64(p.ctrID)] = pdrCounterKey{fseID: p.fseID, pdrID: p.pdrID}
+		entities = append(entities, &p4.Entity{
+			Entity: &p4.Entity_CounterEntry{CounterEntry: &p4.CounterEntry{
+				CounterId: p4constants.CounterPostQosPipePostQosCounter,
+				Index:     &p4.Index{Index: int64(p.ctrID)},
+			}},
+		})
+	}
+
+	resp, err := up4.p4client.ReadReqEntities(entities)
+	if err != nil {
+		return nil, err
+	}
+
+	counters := make(map[pdrCounterKey]pdrCounters, len(pdrs))
+
+	for _, entity := range resp.GetEntities() {
+		entry := entity.GetCounterEntry()
+		if entry == nil || entry.GetIndex() == nil {
+			continue
+		}
+
+		key, ok := keys[entry.GetIndex().GetIndex()]
+		if !ok {
+			continue
+		}
+
+		counters[key] = pdrCounters{
+			packets: uint64(entry.GetData().GetPacketCount()),
+			bytes:   uint64(entry.GetData().GetByteCount()),
+		}
+	}
+
+	return counters, nil
+}
+
+// ReadInstalledPDRs reads the terminations tables, in which the expected PDRs are
+// recognized by their counter index. Entries of other counter indexes are left to
+// the next table clearing, as UP4 cannot tell which PDR installed them.
+func (up4 *UP4) ReadInstalledPDRs(expected []pdr) (map[pdrCounterKey]struct{}, error) {
+	if !up4.IsConnected(nil) {
+		return nil, ErrOperationFailedWithReason("read installed PDRs", "UP4 server not connected")
+	}
+
+	keys := make(map[uint32]pdrCounterKey, len(expected))
+	for _, p := range expected {
+		keys[p.ctrID] = pdrCounterKey{fseID: p.fseID, pdrID: p.pdrID}
+	}
+
+	installed := make(map[pdrCounterKey]struct{}, len(expected))
+	unknown := 0
+
+	for _, tableID := range []uint32{
+		p4constants.TablePreQosPipeTerminationsUplink,
+		p4constants.TablePreQosPipeTerminationsDownlink,
+	} {
+		resp, err := up4.p4client.ReadTableEntry(&p4.TableEntry{
+			TableId:  tableID,
+			Priority: DefaultPriority,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entity := range resp.GetEntities() {
+			ctrID, err := up4.p4RtTranslator.getCounterIndex(entity.GetTableEntry())
+			if err != nil {
+				return nil, err
+			}
+
+			key, ok := keys[ctrID]
+			if !ok {
+				unknown++
+				continue
+			}
+
+			installed[key] = struct{}{}
+		}
+	}
+
+	if unknown > 0 {
+		log.Warnln("UP4 has", unknown, "terminations entries with the counter index of no PDR")
+	}
+
+	return installed, nil
+}
+
+func (up4 *UP4) DeleteInstalledPDRs(keys []pdrCounterKey) error {
+	return ErrUnsupported("deleting PDRs by ID", "UP4")
+}
+
 func (up4 *UP4) PortStats(uc *upfCollector, ch chan<- prometheus.Metric) {
+	up4.cellPoolStats(uc, ch)
 }
 
 func (up4 *UP4) initCounter(counterID uint8, name string, counterSize uint64) {
@@ -239,7 +383,8 @@ func (up4 *UP4) initCounter(counterID uint8, name string, counterSize uint64) {
 	up4.counters[counterID].counterID = uint64(counterID)
 	up4.counters[counterID].counterIDsPool = set.NewSet()
 
-	for i := uint64(0); i < up4.counters[counterID].maxSize; i++ {
+	// 0 is reserved, it is the cell of the PDRs not allocated one
+	for i := uint64(1); i < up4.counters[counterID].maxSize; i++ {
 		up4.counters[counterID].counterIDsPool.Add(i)
 	}
 
@@ -252,21 +397,24 @@ func (up4 *UP4) initCounter(counterID uint8, name string, counterSize uint64) {
 }
 
 func (up4 *UP4) releaseCounterID(p4counterID uint8, val uint64) {
+	if val == 0 {
+		// 0 is not a valid cell ID
+		return
+	}
+
 	log.Println("delete counter val ", val)
 	up4.counters[p4counterID].counterIDsPool.Add(val)
 }
 
 func (up4 *UP4) allocateCounterID(p4counterID uint8) (uint64, error) {
-	if up4.counters[p4counterID].counterIDsPool.Cardinality() == 0 {
-		return 0, ErrOperationFailedWithReason("allocate Counter ID",
-			"no free Counter IDs available")
+	if up4.counters[p4counterID].counterIDsPool == nil {
+		return 0, ErrExhausted("Counter IDs")
 	}
 
 	allocated := up4.counters[p4counterID].counterIDsPool.Pop()
 
 	if allocated == nil {
-		return 0, ErrOperationFailedWithReason("allocate Counter ID",
-			"no free Counter IDs available")
+		return 0, ErrExhausted("Counter IDs")
 	}
 
 	return allocated.(uint64), nil
@@ -283,7 +431,7 @@ func (up4 *UP4) setupChannel() error {
 	})
 	setupLog.Debug("Trying to setup P4Rt channel")
 
-	client, err := CreateChannel(up4.host, up4.deviceID)
+	client, err := CreateChannel(up4.host, up4.deviceID, up4.conf)
 	if err != nil {
 		setupLog.Errorf("create channel failed: %v", err)
 		return err
@@ -341,6 +489,7 @@ func (up4 *UP4) initMetersPools() {
 
 		switch meterID {
 		case p4constants.MeterPreQosPipeAppMeter:
+			up4.appMeterSize = uint64(meterSize)
 			up4.appMeterCellIDsPool = set.NewSet()
 			for i := 1; i < int(meterSize); i++ {
 				up4.appMeterCellIDsPool.Add(uint32(i))
@@ -348,6 +497,7 @@ func (up4 *UP4) initMetersPools() {
 
 			log.Trace("Application meter IDs pool initialized: ", up4.appMeterCellIDsPool.String())
 		case p4constants.MeterPreQosPipeSessionMeter:
+			up4.sessMeterSize = uint64(meterSize)
 			up4.sessMeterCellIDsPool = set.NewSet()
 			for i := 1; i < int(meterSize); i++ {
 				up4.sessMeterCellIDsPool.Add(uint32(i))
@@ -404,24 +554,34 @@ func (up4 *UP4) setConnectedStatus(status bool) {
 }
 
 // TODO: rename it to initUPF()
-func (up4 *UP4) SetUpfInfo(u *upf, conf *Conf) {
+func (up4 *UP4) SetUpfInfo(u *upf, conf *Conf) error {
 	log.Println("SetUpfInfo UP4")
 
 	up4.conf = conf.P4rtcIface
 
-	up4.AccessIP = MustParseStrIP(conf.P4rtcIface.AccessIP)
+	var err error
+
+	_, up4.AccessIP, err = net.ParseCIDR(conf.P4rtcIface.AccessIP)
+	if err != nil {
+		return ErrInvalidArgumentWithReason("p4rtciface.access_ip", conf.P4rtcIface.AccessIP, err.Error())
+	}
+
 	u.AccessIP = up4.AccessIP.IP
 
 	log.Infof("AccessIP: %v", up4.AccessIP)
 
-	up4.ueIPPool = MustParseStrIP(conf.CPIface.UEIPPool)
+	_, up4.ueIPPool, err = net.ParseCIDR(conf.CPIface.UEIPPool)
+	if err != nil {
+		return ErrInvalidArgumentWithReason("cpiface.ue_ip_pool", conf.CPIface.UEIPPool, err.Error())
+	}
 
 	log.Infof("UE IP pool: %v", up4.ueIPPool)
 
 	p4rtcServer := conf.P4rtcIface.P4rtcServer
 
 	p4rtcPort := conf.P4rtcIface.P4rtcPort
-	up4.reportNotifyChan = u.reportNotifyChan
+	up4.reports = u.reports
+	up4.resyncChan = u.resyncChan
 
 	if *p4RtcServerIP != "" {
 		p4rtcServer = *p4RtcServerIP
@@ -442,15 +602,23 @@ func (up4 *UP4) SetUpfInfo(u *upf, conf *Conf) {
 	up4.deviceID = 1
 	up4.timeout = 30
 	up4.EnableEndMarker = conf.EnableEndMarker
+
+	if conf.FARDuplication.Enable {
+		up4.mirrorPort = conf.FARDuplication.Port
+	}
+
 	up4.initTunnelPeerIDs()
 	up4.initApplicationIDs()
 	up4.meters = make(map[meterID]meter)
+	up4.qciQosMap = newQciQosMap(conf.QciQosConfig)
 	up4.ueAddrToFSEID = make(map[uint32]uint64)
 	up4.fseidToUEAddr = make(map[uint64]uint32)
 
 	up4.counters = make([]counter, 2)
 
 	go up4.keepTryingToConnect()
+
+	return nil
 }
 
 func (up4 *UP4) tryConnect() error {
@@ -478,6 +646,11 @@ func (up4 *UP4) tryConnect() error {
 
 	up4.setConnectedStatus(true)
 
+	// replay the sessions that were removed from UP4 together with its state.
+	if shouldClearAndInitialize || up4.conf.ClearStateOnRestart {
+		requestResync(up4.resyncChan)
+	}
+
 	return nil
 }
 
@@ -545,8 +718,6 @@ func (up4 *UP4) initInterfaces() error {
 func (up4 *UP4) listenToDDNs() {
 	log.Info("Listening to Data Notifications from UP4..")
 
-	notifier := NewDownlinkDataNotifier(up4.reportNotifyChan, 20*time.Second)
-
 	for {
 		if up4.IsConnected(nil) {
 			// blocking
@@ -554,12 +725,26 @@ func (up4 *UP4) listenToDDNs() {
 
 			ueAddr := binary.BigEndian.Uint32(digestData)
 			if fseid, exists := up4.ueAddrToFSEID[ueAddr]; exists {
-				notifier.Notify(fseid)
+				up4.reports.notify(fseid)
 			}
 		}
 	}
 }
 
+// resetAllocations releases the tunnel peers, applications and meters allocated
+// to the sessions, as their entries were cleared from UP4.
+func (up4 *UP4) resetAllocations() {
+	up4.tunnelPeerMu.Lock()
+	up4.initTunnelPeerIDs()
+	up4.tunnelPeerMu.Unlock()
+
+	up4.applicationMu.Lock()
+	up4.initApplicationIDs()
+	up4.applicationMu.Unlock()
+
+	up4.meters = make(map[meterID]meter)
+}
+
 func (up4 *UP4) clearDatapathState() error {
 	err := up4.clearTables()
 	if err != nil {
@@ -569,6 +754,7 @@ func (up4 *UP4) clearDatapathState() error {
 
 	up4.initAllCounters()
 	up4.initMetersPools()
+	up4.resetAllocations()
 
 	err = up4.initInterfaces()
 	if err != nil {
@@ -589,6 +775,10 @@ func (up4 *UP4) initialize(shouldClear bool) error {
 		}
 	}
 
+	if err := up4.initMirrorSession(); err != nil {
+		return err
+	}
+
 	up4.initOnce.Do(func() {
 		go up4.listenToDDNs()
 
@@ -603,6 +793,61 @@ func (up4 *UP4) initialize(shouldClear bool) error {
 	return nil
 }
 
+// initMirrorSession points the CPU clone session, the one of the ACL entries cloning
+// the traffic of UEs, to the mirror port.
+func (up4 *UP4) initMirrorSession() error {
+	if up4.mirrorPort == 0 {
+		return nil
+	}
+
+	entity := &p4.Entity{
+		Entity: &p4.Entity_PacketReplicationEngineEntry{
+			PacketReplicationEngineEntry: &p4.PacketReplicationEngineEntry{
+				Type: &p4.PacketReplicationEngineEntry_CloneSessionEntry{
+					CloneSessionEntry: &p4.CloneSessionEntry{
+						SessionId: up4CPUCloneSession,
+						Replicas:  []*p4.Replica{{EgressPort: up4.mirrorPort}},
+					},
+				},
+			},
+		},
+	}
+
+	err := up4.p4client.WriteReq(&p4.Update{Type: p4.Update_INSERT, Entity: entity})
+	if ignoreAlreadyExists(err) != nil {
+		return ErrOperationFailedWithReason("mirror clone session", err.Error())
+	}
+
+	if err != nil {
+		err = up4.p4client.WriteReq(&p4.Update{Type: p4.Update_MODIFY, Entity: entity})
+		if err != nil {
+			return ErrOperationFailedWithReason("mirror clone session", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// mirrorEntryUpdates returns the update of the ACL entry cloning the traffic of pdr to
+// the mirror port, installed while its FAR duplicates the traffic. Nil unless FAR
+// duplication is enabled.
+func (up4 *UP4) mirrorEntryUpdates(pdr pdr, far far, methodType p4.Update_Type) ([]*p4.Update, error) {
+	if up4.mirrorPort == 0 || (methodType == p4.Update_INSERT && !far.Duplicates()) {
+		return nil, nil
+	}
+
+	entry, err := up4.p4RtTranslator.BuildMirrorACLTableEntry(pdr)
+	if err != nil {
+		return nil, ErrOperationFailedWithReason("build P4rt table entry for ACL table", err.Error())
+	}
+
+	if methodType == p4.Update_DELETE || !far.Duplicates() {
+		return tableEntryUpdates(p4.Update_DELETE, entry), nil
+	}
+
+	return tableEntryUpdates(p4.Update_INSERT, entry), nil
+}
+
 func (up4 *UP4) SendEndMarkers(endMarkerList *[][]byte) error {
 	for _, eMarker := range *endMarkerList {
 		up4.endMarkerChan <- eMarker
@@ -630,6 +875,26 @@ func findRelatedFAR(pdr pdr, fars []far) (far, error) {
 	return far{}, ErrNotFoundWithParam("related FAR for PDR", "PDR", pdr)
 }
 
+// closeGates closes the gates of q in the directions closed by any QER of pdr, so that
+// the session QER also gates the traffic of application PDRs.
+func closeGates(q qer, pdr pdr, qers []qer) qer {
+	for _, other := range qers {
+		if !contains(pdr.qerIDList, other.qerID) {
+			continue
+		}
+
+		if other.ulStatus == ie.GateStatusClosed {
+			q.ulStatus = ie.GateStatusClosed
+		}
+
+		if other.dlStatus == ie.GateStatusClosed {
+			q.dlStatus = ie.GateStatusClosed
+		}
+	}
+
+	return q
+}
+
 func findRelatedApplicationQER(pdr pdr, qers []qer) (qer, error) {
 	for _, qer := range qers {
 		if len(pdr.qerIDList) != 0 {
@@ -687,7 +952,7 @@ func (up4 *UP4) getGTPTunnelPeer(tnlParams tunnelParams) (tunnelPeer, bool) {
 	return tnlPeer, exists
 }
 
-func (up4 *UP4) addOrUpdateGTPTunnelPeer(far far) error {
+func (up4 *UP4) addOrUpdateGTPTunnelPeer(far far, w p4Writer) error {
 	up4.tunnelPeerMu.Lock()
 	defer up4.tunnelPeerMu.Unlock()
 
@@ -736,7 +1001,7 @@ func (up4 *UP4) addOrUpdateGTPTunnelPeer(far far) error {
 		return err
 	}
 
-	if err := up4.p4client.ApplyTableEntries(methodType, gtpTunnelPeerEntry); err != nil {
+	if err := w.write(tableEntryUpdates(methodType, gtpTunnelPeerEntry)); err != nil {
 		releaseTnlPeerID()
 		return err
 	}
@@ -888,8 +1153,7 @@ func (up4 *UP4) allocateAppMeterCellID() (uint32, error) {
 	// pick from set
 	allocated := up4.appMeterCellIDsPool.Pop()
 	if allocated == nil {
-		return 0, ErrOperationFailedWithReason("allocate Application Meter Cell ID",
-			"no free AppMeter Cell IDs available")
+		return 0, ErrExhausted("Application Meter Cell IDs")
 	}
 
 	log.WithFields(log.Fields{
@@ -918,8 +1182,7 @@ func (up4 *UP4) allocateSessionMeterCellID() (uint32, error) {
 	// pick from set
 	allocated := up4.sessMeterCellIDsPool.Pop()
 	if allocated == nil {
-		return 0, ErrOperationFailedWithReason("allocate Session Meter Cell ID",
-			"no free SessionMeter Cell IDs available")
+		return 0, ErrExhausted("Session Meter Cell IDs")
 	}
 
 	log.WithFields(log.Fields{
@@ -962,14 +1225,14 @@ func (up4 *UP4) removeUeAddrAndFSEIDMappings(pdr pdr) {
 	delete(up4.fseidToUEAddr, pdr.fseID)
 }
 
-func (up4 *UP4) updateTunnelPeersBasedOnFARs(fars []far) error {
+func (up4 *UP4) updateTunnelPeersBasedOnFARs(fars []far, w p4Writer) error {
 	for _, far := range fars {
 		logger := log.WithFields(log.Fields{
 			"far": far,
 		})
 		// downlink FAR with tunnel params that does encapsulation
 		if far.Forwards() && far.dstIntf == ie.DstInterfaceAccess && far.tunnelTEID != 0 {
-			if err := up4.addOrUpdateGTPTunnelPeer(far); err != nil {
+			if err := up4.addOrUpdateGTPTunnelPeer(far, w); err != nil {
 				logger.Errorf("Failed to add or update GTP tunnel peer: %v", err)
 				return err
 			}
@@ -979,47 +1242,47 @@ func (up4 *UP4) updateTunnelPeersBasedOnFARs(fars []far) error {
 	return nil
 }
 
-func getMeterConfigurationFromQER(mbr uint64, gbr uint64) *p4.MeterConfig {
-	defaultBurstDurationMs := 10
+// getMeterConfigurationFromQER returns the two-rate three-color meter configuration
+// enforcing the MBR and GBR, in Kbps, of a QER: the committed rate is the GBR and the
+// peak rate the MBR.
+func getMeterConfigurationFromQER(mbr uint64, gbr uint64, qosVal *QosConfigVal) *p4.MeterConfig {
 	logger := log.WithFields(log.Fields{
 		"GBR (Kbps)":         gbr,
 		"MBR (Kbps)":         mbr,
-		"burstDuration (ms)": defaultBurstDurationMs,
+		"burstDuration (ms)": qosVal.burstDurationMs,
 	})
 	logger.Debug("Converting GBR/MBR to P4 Meter configuration")
 
-	// FIXME: calculate from rate once P4-UPF supports GBRs
-	cbs := 0
-	cir := 0
+	m := newQERMeter(mbr, gbr, qosVal)
 
-	pbs := calcBurstSizeFromRate(mbr, uint64(defaultBurstDurationMs))
+	if gbr == 0 {
+		// Non-GBR traffic is not committed, only limited to the MBR.
+		m.cbs = 0
+	}
 
-	var pir uint64 = 0
-	if mbr != 0 {
-		/* MBR/GBR is received in Kilobits/sec.
-		   CIR/PIR is sent in bytes */
-		pir = maxUint64((mbr*1000)/8, uint64(cir))
+	if mbr == 0 && gbr == 0 {
+		m.pbs = 0
 	}
 
 	logger = logger.WithFields(log.Fields{
-		"CIR": cir,
-		"CBS": cbs,
-		"PIR": pir,
-		"PBS": pbs,
+		"CIR": m.cir,
+		"CBS": m.cbs,
+		"PIR": m.pir,
+		"PBS": m.pbs,
 	})
 	logger.Debug("GBR/MBR has been converted to P4 Meter configuration")
 
 	return &p4.MeterConfig{
-		Cir:    int64(cir),
-		Cburst: int64(cbs),
-		Pir:    int64(pir),
-		Pburst: int64(pbs),
+		Cir:    int64(m.cir),
+		Cburst: int64(m.cbs),
+		Pir:    int64(m.pir),
+		Pburst: int64(m.pbs),
 	}
 }
 
 // configureApplicationMeter installs P4Runtime Meter Entries based on QoS configuration from QER.
 // If bidirectional, this function allocates two independent meter cell IDs, one per direction.
-func (up4 *UP4) configureApplicationMeter(q qer, bidirectional bool) (meter, error) {
+func (up4 *UP4) configureApplicationMeter(q qer, bidirectional bool, w p4Writer) (meter, error) {
 	entries := make([]*p4.MeterEntry, 0)
 
 	appMeter := meter{
@@ -1049,16 +1312,16 @@ func (up4 *UP4) configureApplicationMeter(q qer, bidirectional bool) (meter, err
 
 	releaseIDs := func() {
 		if appMeter.uplinkCellID != 0 {
-			up4.releaseSessionMeterCellID(appMeter.uplinkCellID)
+			up4.releaseAppMeterCellID(appMeter.uplinkCellID)
 		}
 
 		if appMeter.downlinkCellID != appMeter.uplinkCellID {
-			up4.releaseSessionMeterCellID(appMeter.downlinkCellID)
+			up4.releaseAppMeterCellID(appMeter.downlinkCellID)
 		}
 	}
 
 	if appMeter.uplinkCellID != 0 {
-		meterConfig := getMeterConfigurationFromQER(q.ulMbr, q.ulGbr)
+		meterConfig := getMeterConfigurationFromQER(q.ulMbr, q.ulGbr, qosConfigOf(up4.qciQosMap, q.qfi))
 
 		meterEntry := up4.p4RtTranslator.BuildMeterEntry(p4constants.MeterPreQosPipeAppMeter, appMeter.uplinkCellID, meterConfig)
 
@@ -1066,14 +1329,14 @@ func (up4 *UP4) configureApplicationMeter(q qer, bidirectional bool) (meter, err
 	}
 
 	if appMeter.downlinkCellID != appMeter.uplinkCellID {
-		meterConfig := getMeterConfigurationFromQER(q.dlMbr, q.dlGbr)
+		meterConfig := getMeterConfigurationFromQER(q.dlMbr, q.dlGbr, qosConfigOf(up4.qciQosMap, q.qfi))
 
 		meterEntry := up4.p4RtTranslator.BuildMeterEntry(p4constants.MeterPreQosPipeAppMeter, appMeter.downlinkCellID, meterConfig)
 
 		entries = append(entries, meterEntry)
 	}
 
-	err = up4.p4client.ApplyMeterEntries(p4.Update_MODIFY, entries...)
+	err = w.write(meterEntryUpdates(p4.Update_MODIFY, entries...))
 	if err != nil {
 		releaseIDs()
 		return meter{}, err
@@ -1084,7 +1347,7 @@ func (up4 *UP4) configureApplicationMeter(q qer, bidirectional bool) (meter, err
 
 // configureSessionMeter installs two P4Runtime Meter Entries.
 // Session QER is always bidirectional. Thus, this function always configures two independent cell IDs.
-func (up4 *UP4) configureSessionMeter(q qer) (meter, error) {
+func (up4 *UP4) configureSessionMeter(q qer, w p4Writer) (meter, error) {
 	uplinkCellID, err := up4.allocateSessionMeterCellID()
 	if err != nil {
 		return meter{}, err
@@ -1108,10 +1371,10 @@ func (up4 *UP4) configureSessionMeter(q qer) (meter, error) {
 	})
 	logger.Debug("Configuring Session Meter from QER")
 
-	uplinkMeterConfig := getMeterConfigurationFromQER(q.ulMbr, q.ulGbr)
+	uplinkMeterConfig := getMeterConfigurationFromQER(q.ulMbr, q.ulGbr, qosConfigOf(up4.qciQosMap, q.qfi))
 	uplinkMeterEntry := up4.p4RtTranslator.BuildMeterEntry(p4constants.MeterPreQosPipeSessionMeter, uplinkCellID, uplinkMeterConfig)
 
-	downlinkMeterConfig := getMeterConfigurationFromQER(q.dlMbr, q.dlGbr)
+	downlinkMeterConfig := getMeterConfigurationFromQER(q.dlMbr, q.dlGbr, qosConfigOf(up4.qciQosMap, q.qfi))
 	downlinkMeterEntry := up4.p4RtTranslator.BuildMeterEntry(p4constants.MeterPreQosPipeSessionMeter, downlinkCellID, downlinkMeterConfig)
 
 	logger = logger.WithFields(log.Fields{
@@ -1120,7 +1383,7 @@ func (up4 *UP4) configureSessionMeter(q qer) (meter, error) {
 	})
 	logger.Debug("Installing P4 Meter entries")
 
-	err = up4.p4client.ApplyMeterEntries(p4.Update_MODIFY, uplinkMeterEntry, downlinkMeterEntry)
+	err = w.write(meterEntryUpdates(p4.Update_MODIFY, uplinkMeterEntry, downlinkMeterEntry))
 	if err != nil {
 		releaseIDs()
 		return meter{}, err
@@ -1135,7 +1398,24 @@ func (up4 *UP4) configureSessionMeter(q qer) (meter, error) {
 	}, nil
 }
 
-func (up4 *UP4) configureMeters(qers []qer) error {
+// isBidirectionalQER reports whether q is referenced by both uplink and downlink PDRs,
+// e.g. the single QER of a session or the QER of an application, so that each
+// direction is metered by its own cell.
+func isBidirectionalQER(q qer, pdrs []pdr) bool {
+	var uplink, downlink bool
+
+	for _, p := range pdrs {
+		if contains(p.qerIDList, q.qerID) {
+			uplink = uplink || p.IsUplink()
+			downlink = downlink || p.IsDownlink()
+		}
+	}
+
+	return uplink && downlink
+}
+
+// configureMeters configures the meters of qers, pdrs being the PDRs of the session.
+func (up4 *UP4) configureMeters(qers []qer, pdrs []pdr, w p4Writer) error {
 	log.WithFields(log.Fields{
 		"qers": qers,
 	}).Debug("Configuring P4 Meters based on QERs")
@@ -1156,23 +1436,19 @@ func (up4 *UP4) configureMeters(qers []qer) error {
 
 		switch qer.qosLevel {
 		case ApplicationQos:
-			if len(qers) == 1 {
-				// if only a single QER is created, the QER is marked as Application QER,
-				// and all PDRs points to the same QER, which is not unique per direction.
-				// Therefore, we have to configure bidirectional meter (two independent cells, one per direction).
-				meter, err = up4.configureApplicationMeter(qer, true)
-			} else {
-				meter, err = up4.configureApplicationMeter(qer, false)
-			}
+			// A QER shared by the PDRs of both directions, e.g. if only a single QER is
+			// created, is not unique per direction. Therefore, we have to configure
+			// bidirectional meter (two independent cells, one per direction).
+			meter, err = up4.configureApplicationMeter(qer, isBidirectionalQER(qer, pdrs), w)
 		case SessionQos:
-			meter, err = up4.configureSessionMeter(qer)
+			meter, err = up4.configureSessionMeter(qer, w)
 		default:
 			// unknown, type of QER
 			continue
 		}
 
 		if err != nil {
-			return ErrOperationFailedWithReason("configure P4 Meter from QER", err.Error())
+			return fmt.Errorf("configure P4 Meter from QER: %w", err)
 		}
 
 		logger = logger.WithField("P4 meter", meter)
@@ -1192,6 +1468,11 @@ func verifyPDR(pdr pdr) error {
 		return ErrUnsupported("precedence greater than 65535", pdr.precedence)
 	}
 
+	// Sessions are looked up by the exact UE address.
+	if len(pdr.framedRoutes) > 0 {
+		return ErrUnsupported("Framed-Route", pdr.framedRoutes)
+	}
+
 	return nil
 }
 
@@ -1262,7 +1543,7 @@ func (up4 *UP4) resetMeters(qers []qer) {
 	}
 }
 
-func (up4 *UP4) resetCounter(pdr pdr) error {
+func (up4 *UP4) resetCounter(pdr pdr, w p4Writer) error {
 	builderLog := log.WithFields(log.Fields{
 		"Cell ID": pdr.ctrID,
 		"PDR ID":  pdr.pdrID,
@@ -1304,12 +1585,12 @@ func (up4 *UP4) resetCounter(pdr pdr) error {
 		},
 	}
 
-	return up4.p4client.WriteBatchReq(updates)
+	return w.write(updates)
 }
 
 // modifyUP4ForwardingConfiguration builds P4Runtime table entries and
 // inserts/modifies/removes table entries from UP4 device, according to methodType.
-func (up4 *UP4) modifyUP4ForwardingConfiguration(pdrs []pdr, allFARs []far, qers []qer, methodType p4.Update_Type) error {
+func (up4 *UP4) modifyUP4ForwardingConfiguration(pdrs []pdr, allFARs []far, qers []qer, methodType p4.Update_Type, w p4Writer) error {
 	for _, pdr := range pdrs {
 		if err := verifyPDR(pdr); err != nil {
 			return err
@@ -1404,7 +1685,7 @@ func (up4 *UP4) modifyUP4ForwardingConfiguration(pdrs []pdr, allFARs []far, qers
 			pdrLog.Debug("Application meter found for PDR: ", appMeter)
 		}
 
-		var qfi uint8 = DefaultQFI
+		qfi := up4.conf.DefaultQFI
 
 		relatedQER, err := findRelatedApplicationQER(pdr, qers)
 		if err != nil {
@@ -1414,7 +1695,9 @@ func (up4 *UP4) modifyUP4ForwardingConfiguration(pdrs []pdr, allFARs []far, qers
 			qfi = relatedQER.qfi
 		}
 
-		tc, exists := up4.conf.QFIToTC[relatedQER.qfi]
+		relatedQER = closeGates(relatedQER, pdr, qers)
+
+		tc, exists := up4.conf.QFIToTC[qfi]
 		if !exists {
 			tc = up4.conf.DefaultTC
 		}
@@ -1433,39 +1716,76 @@ func (up4 *UP4) modifyUP4ForwardingConfiguration(pdrs []pdr, allFARs []far, qers
 		})
 		pdrLog.Debug("Applying table entries")
 
-		err = up4.p4client.ApplyTableEntries(methodType, entriesToApply...)
+		if err = ignoreAlreadyExists(w.write(tableEntryUpdates(methodType, entriesToApply...))); err != nil {
+			return ErrOperationFailedWithReason("applying table entries to UP4", err.Error())
+		}
+
+		mirrorUpdates, err := up4.mirrorEntryUpdates(pdr, far, methodType)
 		if err != nil {
-			p4Error, ok := err.(*P4RuntimeError)
-			if !ok {
-				// not a P4Runtime error, returning err
-				return ErrOperationFailedWithReason("applying table entries to UP4", err.Error())
+			return err
+		}
+
+		if len(mirrorUpdates) > 0 {
+			// The entry exists already if the FAR duplicated the traffic before, and is
+			// missing if it did not.
+			if err = ignoreNotFound(ignoreAlreadyExists(w.write(mirrorUpdates))); err != nil {
+				return ErrOperationFailedWithReason("applying mirror entries to UP4", err.Error())
 			}
+		}
+	}
 
-			for _, status := range p4Error.Get() {
-				// ignore ALREADY_EXISTS or OK
-				if status.GetCanonicalCode() == int32(codes.AlreadyExists) ||
-					status.GetCanonicalCode() == int32(codes.OK) {
-					continue
-				}
+	return nil
+}
 
-				return ErrOperationFailedWithReason("applying table entries to UP4", p4Error.Error())
-			}
+// ignoreAlreadyExists returns nil if err only reports entries that already exist.
+func ignoreAlreadyExists(err error) error {
+	return ignoreStatus(err, codes.AlreadyExists)
+}
+
+// ignoreNotFound returns nil if err only reports entries that do not exist.
+func ignoreNotFound(err error) error {
+	return ignoreStatus(err, codes.NotFound)
+}
+
+func ignoreStatus(err error, code codes.Code) error {
+	if err == nil {
+		return nil
+	}
+
+	p4Error, ok := err.(*P4RuntimeError)
+	if !ok {
+		// not a P4Runtime error, returning err
+		return err
+	}
+
+	for _, status := range p4Error.Get() {
+		// ignore code or OK
+		if status.GetCanonicalCode() == int32(code) ||
+			status.GetCanonicalCode() == int32(codes.OK) {
+			continue
 		}
+
+		return p4Error
 	}
 
 	return nil
 }
 
-func (up4 *UP4) sendCreate(all PacketForwardingRules, updated PacketForwardingRules) error {
+func (up4 *UP4) sendCreate(all PacketForwardingRules, updated PacketForwardingRules, w p4Writer) error {
 	for i := range updated.pdrs {
 		val, err := up4.allocateCounterID(preQosCounterID)
 		if err != nil {
-			return ErrOperationFailedWithReason("Counter ID allocation", err.Error())
+			// Only the cells allocated so far are to be released.
+			for j := i; j < len(updated.pdrs); j++ {
+				all.pdrs[j].ctrID = 0
+			}
+
+			return err
 		}
 
 		all.pdrs[i].ctrID = uint32(val)
 
-		if err := up4.resetCounter(all.pdrs[i]); err != nil {
+		if err := up4.resetCounter(all.pdrs[i], w); err != nil {
 			return ErrOperationFailedWithReason("Reset Counters", err.Error())
 		}
 	}
@@ -1474,16 +1794,16 @@ func (up4 *UP4) sendCreate(all PacketForwardingRules, updated PacketForwardingRu
 		up4.updateUEAddrAndFSEIDMappings(p)
 	}
 
-	if err := up4.configureMeters(updated.qers); err != nil {
+	if err := up4.configureMeters(updated.qers, all.pdrs, w); err != nil {
 		return err
 	}
 
-	if err := up4.updateTunnelPeersBasedOnFARs(updated.fars); err != nil {
+	if err := up4.updateTunnelPeersBasedOnFARs(updated.fars, w); err != nil {
 		// TODO: revert operations (e.g. reset counter)
 		return err
 	}
 
-	if err := up4.modifyUP4ForwardingConfiguration(all.pdrs, all.fars, all.qers, p4.Update_INSERT); err != nil {
+	if err := up4.modifyUP4ForwardingConfiguration(all.pdrs, all.fars, all.qers, p4.Update_INSERT, w); err != nil {
 		// TODO: revert operations (e.g. reset counter)
 		return err
 	}
@@ -1491,32 +1811,37 @@ func (up4 *UP4) sendCreate(all PacketForwardingRules, updated PacketForwardingRu
 	return nil
 }
 
-func (up4 *UP4) sendUpdate(all PacketForwardingRules, updated PacketForwardingRules) error {
+func (up4 *UP4) sendUpdate(all PacketForwardingRules, updated PacketForwardingRules, w p4Writer) error {
 	// Update PDR IE might modify UE IP <-> F-SEID mappings
 	for _, p := range updated.pdrs {
 		up4.updateUEAddrAndFSEIDMappings(p)
 	}
 
-	if err := up4.updateTunnelPeersBasedOnFARs(updated.fars); err != nil {
+	if err := up4.updateMeters(updated.qers, all.pdrs, w); err != nil {
+		return err
+	}
+
+	if err := up4.updateTunnelPeersBasedOnFARs(updated.fars, w); err != nil {
 		return err
 	}
 
-	if err := up4.modifyUP4ForwardingConfiguration(all.pdrs, all.fars, all.qers, p4.Update_MODIFY); err != nil {
+	if err := up4.modifyUP4ForwardingConfiguration(all.pdrs, all.fars, all.qers, p4.Update_MODIFY, w); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// sendDelete deletes the entries of the rules. The cells and IDs they were allocated
+// are released even if the entries could not be deleted, so that the pools do not
+// leak: cells are reset when allocated again.
 func (up4 *UP4) sendDelete(deleted PacketForwardingRules) error {
 	for i := range deleted.pdrs {
 		up4.releaseCounterID(preQosCounterID,
 			uint64(deleted.pdrs[i].ctrID))
 	}
 
-	if err := up4.modifyUP4ForwardingConfiguration(deleted.pdrs, deleted.fars, deleted.qers, p4.Update_DELETE); err != nil {
-		return err
-	}
+	err := up4.modifyUP4ForwardingConfiguration(deleted.pdrs, deleted.fars, deleted.qers, p4.Update_DELETE, up4.p4client)
 
 	up4.resetMeters(deleted.qers)
 
@@ -1528,6 +1853,19 @@ func (up4 *UP4) sendDelete(deleted PacketForwardingRules) error {
 		up4.removeUeAddrAndFSEIDMappings(p)
 	}
 
+	return err
+}
+
+// checkQFIMatches rejects the PDRs matching a QFI. The sessions and terminations tables
+// of UP4 have no QFI match field, so these PDRs would match the packets of all the QoS
+// flows of their F-TEID or UE address.
+func checkQFIMatches(pdrs []pdr) error {
+	for _, p := range pdrs {
+		if p.matchesQFI() {
+			return ErrInvalidArgumentWithReason("PDR", p.pdrID, "QFI match is not supported by UP4")
+		}
+	}
+
 	return nil
 }
 
@@ -1545,11 +1883,18 @@ func (up4 *UP4) SendMsgToUPF(method upfMsgType, all PacketForwardingRules, updat
 	})
 	up4Log.Debug("Sending PFCP message to UP4..")
 
+	if method != upfMsgTypeDel {
+		if err := checkQFIMatches(updated.pdrs); err != nil {
+			up4Log.Errorln(err)
+			return ie.CauseRuleCreationModificationFailure
+		}
+	}
+
 	switch method {
 	case upfMsgTypeAdd:
-		err = up4.sendCreate(all, updated)
+		err = up4.sendCreate(all, updated, up4.p4client)
 	case upfMsgTypeMod:
-		err = up4.sendUpdate(all, updated)
+		err = up4.sendUpdate(all, updated, up4.p4client)
 	case upfMsgTypeDel:
 		err = up4.sendDelete(all)
 	default:
@@ -1559,6 +1904,15 @@ func (up4 *UP4) SendMsgToUPF(method upfMsgType, all PacketForwardingRules, updat
 
 	if err != nil {
 		up4Log.Errorf("failed to apply forwarding configuration to UP4: %v", err)
+
+		if method == upfMsgTypeAdd {
+			up4.releaseCreate(all, updated)
+		}
+
+		if errors.Is(err, errExhausted) {
+			return ie.CauseNoResourcesAvailable
+		}
+
 		return ie.CauseRequestRejected
 	}
 
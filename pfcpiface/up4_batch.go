@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+
+	p4 "github.com/p4lang/p4runtime/go/p4/v1"
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+
+	"github.com/omec-project/upf-epc/internal/p4constants"
+)
+
+// p4Writer writes P4Runtime updates to UP4, right away or queued in a batch.
+type p4Writer interface {
+	write(updates []*p4.Update) error
+}
+
+// p4Batch queues P4Runtime updates to write them in a single request.
+type p4Batch struct {
+	updates []*p4.Update
+}
+
+func (b *p4Batch) write(updates []*p4.Update) error {
+	b.updates = append(b.updates, updates...)
+	return nil
+}
+
+func (b *p4Batch) flush(c *P4rtClient) error {
+	if len(b.updates) == 0 {
+		return nil
+	}
+
+	return c.WriteBatchReq(b.updates)
+}
+
+// WriteSessionBatch writes the counter resets, meters, tunnel peers and table entries
+// of the rules added or modified in a session in a single P4Runtime write request.
+func (up4 *UP4) WriteSessionBatch(method upfMsgType, all PacketForwardingRules, updated PacketForwardingRules) error {
+	if method != upfMsgTypeAdd && method != upfMsgTypeMod {
+		return ErrUnsupported("batched method", method)
+	}
+
+	if err := up4.tryConnect(); err != nil {
+		return ErrOperationFailedWithReason("connect to UP4", err.Error())
+	}
+
+	if err := checkQFIMatches(updated.pdrs); err != nil {
+		return err
+	}
+
+	batch := &p4Batch{}
+
+	var err error
+
+	if method == upfMsgTypeAdd {
+		err = up4.sendCreate(all, updated, batch)
+	} else {
+		err = up4.sendUpdate(all, updated, batch)
+	}
+
+	if err != nil {
+		if method == upfMsgTypeAdd {
+			up4.releaseCreate(all, updated)
+		}
+
+		if errors.Is(err, errExhausted) {
+			return err
+		}
+
+		// wrapped as a failure, so that the rules are not retried one by one
+		return ErrOperationFailedWithReason("building batch for UP4", err.Error())
+	}
+
+	log.WithFields(log.Fields{
+		"method-type": method,
+		"updates":     len(batch.updates),
+	}).Debug("Writing batch of P4Runtime updates to UP4")
+
+	if err = ignoreAlreadyExists(batch.flush(up4.p4client)); err != nil {
+		if method == upfMsgTypeAdd {
+			up4.releaseCreate(all, updated)
+		}
+
+		return ErrOperationFailedWithReason("applying batch to UP4", err.Error())
+	}
+
+	return nil
+}
+
+// releaseCreate releases the IDs allocated to rules whose batch was not written.
+func (up4 *UP4) releaseCreate(all PacketForwardingRules, updated PacketForwardingRules) {
+	for i := range updated.pdrs {
+		up4.releaseCounterID(preQosCounterID, uint64(all.pdrs[i].ctrID))
+	}
+
+	for _, p := range all.pdrs {
+		if !p.IsAppFilterEmpty() {
+			up4.removeInternalApplicationIDAndGetP4rtEntry(p)
+		}
+	}
+
+	up4.resetMeters(updated.qers)
+
+	for _, f := range updated.fars {
+		if f.Forwards() && f.dstIntf == ie.DstInterfaceAccess && f.tunnelTEID != 0 {
+			up4.removeGTPTunnelPeer(f)
+		}
+	}
+
+	for _, p := range updated.pdrs {
+		up4.removeUeAddrAndFSEIDMappings(p)
+	}
+}
+
+// UpdateQERRates rewrites the meter cells of q with its rates. The cells are kept, so
+// the table entries pointing to them are left alone.
+func (up4 *UP4) UpdateQERRates(q qer, all PacketForwardingRules) error {
+	if err := up4.tryConnect(); err != nil {
+		return ErrOperationFailedWithReason("connect to UP4", err.Error())
+	}
+
+	m, ok := up4.meters[meterID{qerID: q.qerID, fseid: q.fseID}]
+	if !ok || m.uplinkCellID == 0 {
+		return ErrUnsupported("in-place update of QER without meter", q.qerID)
+	}
+
+	if err := up4.p4client.write(meterEntryUpdates(p4.Update_MODIFY, up4.meterEntries(q, m)...)); err != nil {
+		return ErrOperationFailedWithReason("updating meter of QER", err.Error())
+	}
+
+	return nil
+}
+
+// UpdateFARTunnel updates the tunnel peer of f and the table entries of the PDRs
+// pointing to f, in a single P4Runtime write request. The other entries are left alone.
+func (up4 *UP4) UpdateFARTunnel(f far, all PacketForwardingRules) error {
+	if err := up4.tryConnect(); err != nil {
+		return ErrOperationFailedWithReason("connect to UP4", err.Error())
+	}
+
+	var pdrs []pdr
+
+	for _, p := range all.pdrs {
+		if p.farID == f.farID {
+			pdrs = append(pdrs, p)
+		}
+	}
+
+	batch := &p4Batch{}
+
+	if err := up4.updateTunnelPeersBasedOnFARs([]far{f}, batch); err != nil {
+		return ErrOperationFailedWithReason("building batch for UP4", err.Error())
+	}
+
+	if err := up4.modifyUP4ForwardingConfiguration(pdrs, all.fars, all.qers, p4.Update_MODIFY, batch); err != nil {
+		return ErrOperationFailedWithReason("building batch for UP4", err.Error())
+	}
+
+	if err := batch.flush(up4.p4client); err != nil {
+		return ErrOperationFailedWithReason("applying batch to UP4", err.Error())
+	}
+
+	return nil
+}
+
+// meterEntries returns the entries of the cells of m, configured with the rates of q.
+func (up4 *UP4) meterEntries(q qer, m meter) []*p4.MeterEntry {
+	meterTable := p4constants.MeterPreQosPipeAppMeter
+	if m.meterType == meterTypeSession {
+		meterTable = p4constants.MeterPreQosPipeSessionMeter
+	}
+
+	qosVal := qosConfigOf(up4.qciQosMap, q.qfi)
+
+	entries := []*p4.MeterEntry{
+		up4.p4RtTranslator.BuildMeterEntry(meterTable, m.uplinkCellID, getMeterConfigurationFromQER(q.ulMbr, q.ulGbr, qosVal)),
+	}
+
+	if m.downlinkCellID != m.uplinkCellID {
+		entries = append(entries,
+			up4.p4RtTranslator.BuildMeterEntry(meterTable, m.downlinkCellID, getMeterConfigurationFromQER(q.dlMbr, q.dlGbr, qosVal)))
+	}
+
+	return entries
+}
+
+// updateMeters configures the meters of the QERs created in a session modification
+// and rewrites those of the updated ones with their rates, pdrs being the PDRs of
+// the session.
+func (up4 *UP4) updateMeters(qers []qer, pdrs []pdr, w p4Writer) error {
+	var created []qer
+
+	for _, q := range qers {
+		m, ok := up4.meters[meterID{qerID: q.qerID, fseid: q.fseID}]
+		if !ok {
+			created = append(created, q)
+			continue
+		}
+
+		if m.uplinkCellID == 0 {
+			continue
+		}
+
+		if err := w.write(meterEntryUpdates(p4.Update_MODIFY, up4.meterEntries(q, m)...)); err != nil {
+			return err
+		}
+	}
+
+	return up4.configureMeters(created, pdrs, w)
+}
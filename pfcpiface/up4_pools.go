@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	set "github.com/deckarep/golang-set"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// up4CellPool is the usage of the cells of a P4 counter or meter allocated to the
+// rules. Cell 0 is reserved, so size excludes it.
+type up4CellPool struct {
+	name      string
+	allocated uint64
+	size      uint64
+}
+
+func newUP4CellPool(name string, free set.Set, cells uint64) up4CellPool {
+	pool := up4CellPool{name: name}
+
+	if free == nil || cells < 2 {
+		return pool
+	}
+
+	pool.size = cells - 1
+
+	if n := uint64(free.Cardinality()); n < pool.size {
+		pool.allocated = pool.size - n
+	}
+
+	return pool
+}
+
+func (p up4CellPool) utilization() float64 {
+	if p.size == 0 {
+		return 0
+	}
+
+	return float64(p.allocated) / float64(p.size)
+}
+
+// cellPools returns the usage of the counter cells of the PDRs and the meter cells of
+// the application and session QERs, none before UP4 is initialized.
+func (up4 *UP4) cellPools() []up4CellPool {
+	if len(up4.counters) <= preQosCounterID || up4.counters[preQosCounterID].counterIDsPool == nil {
+		return nil
+	}
+
+	ctr := up4.counters[preQosCounterID]
+
+	return []up4CellPool{
+		newUP4CellPool("counter", ctr.counterIDsPool, ctr.maxSize),
+		newUP4CellPool("app_meter", up4.appMeterCellIDsPool, up4.appMeterSize),
+		newUP4CellPool("session_meter", up4.sessMeterCellIDsPool, up4.sessMeterSize),
+	}
+}
+
+func (up4 *UP4) cellPoolStats(uc *upfCollector, ch chan<- prometheus.Metric) {
+	for _, p := range up4.cellPools() {
+		ch <- prometheus.MustNewConstMetric(uc.up4CellsAllocated, prometheus.GaugeValue, float64(p.allocated), p.name)
+		ch <- prometheus.MustNewConstMetric(uc.up4CellsUtilization, prometheus.GaugeValue, p.utilization(), p.name)
+	}
+}
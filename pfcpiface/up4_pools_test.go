@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+	"testing"
+
+	set "github.com/deckarep/golang-set"
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func TestUP4_cellPools(t *testing.T) {
+	up4 := &UP4{counters: make([]counter, 2)}
+	require.Empty(t, up4.cellPools())
+
+	up4.initCounter(preQosCounterID, "PreQosPipe.pre_qos_counter", 4)
+	up4.appMeterCellIDsPool = set.NewSet(uint32(1))
+	up4.appMeterSize = 2
+	up4.sessMeterCellIDsPool = set.NewSet()
+	up4.sessMeterSize = 3
+
+	var allocated []uint64
+
+	for i := 0; i < 3; i++ {
+		id, err := up4.allocateCounterID(preQosCounterID)
+		require.NoError(t, err)
+		require.NotZero(t, id)
+
+		allocated = append(allocated, id)
+	}
+
+	_, err := up4.allocateCounterID(preQosCounterID)
+	require.True(t, errors.Is(err, errExhausted))
+
+	_, err = up4.allocateSessionMeterCellID()
+	require.True(t, errors.Is(err, errExhausted))
+
+	require.Equal(t, []up4CellPool{
+		{name: "counter", allocated: 3, size: 3},
+		{name: "app_meter", allocated: 0, size: 1},
+		{name: "session_meter", allocated: 2, size: 2},
+	}, up4.cellPools())
+
+	// Cell 0 is never allocated, so releasing it must not add it to the pool.
+	up4.releaseCounterID(preQosCounterID, 0)
+	up4.releaseCounterID(preQosCounterID, allocated[0])
+
+	pools := up4.cellPools()
+	require.Equal(t, uint64(2), pools[0].allocated)
+	require.InDelta(t, 2.0/3, pools[0].utilization(), 1e-9)
+
+	id, err := up4.allocateCounterID(preQosCounterID)
+	require.NoError(t, err)
+	require.Equal(t, allocated[0], id)
+}
+
+type exhaustedDatapath struct {
+	fakeDatapath
+}
+
+func (d *exhaustedDatapath) WriteSessionBatch(method upfMsgType, all PacketForwardingRules, updated PacketForwardingRules) error {
+	return ErrExhausted("Counter IDs")
+}
+
+func Test_upf_sendSessionRules_exhausted(t *testing.T) {
+	u := &upf{datapath: &exhaustedDatapath{}}
+
+	cause := u.sendSessionRules(upfMsgTypeAdd, PacketForwardingRules{}, PacketForwardingRules{})
+	require.Equal(t, uint8(ie.CauseNoResourcesAvailable), cause)
+}
+
+type qfiRejectingDatapath struct {
+	fakeDatapath
+}
+
+func (d *qfiRejectingDatapath) WriteSessionBatch(method upfMsgType, all PacketForwardingRules, updated PacketForwardingRules) error {
+	return checkQFIMatches(updated.pdrs)
+}
+
+func Test_upf_sendSessionRules_qfiMatch(t *testing.T) {
+	u := &upf{datapath: &qfiRejectingDatapath{}}
+
+	require.NoError(t, checkQFIMatches([]pdr{{pdrID: 1}}))
+
+	rules := PacketForwardingRules{pdrs: []pdr{{pdrID: 1}, {pdrID: 2, qfi: 5, qfiMask: 0x3f}}}
+
+	cause := u.sendSessionRules(upfMsgTypeAdd, rules, rules)
+	require.Equal(t, uint8(ie.CauseRuleCreationModificationFailure), cause)
+}
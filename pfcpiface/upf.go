@@ -4,12 +4,16 @@
 package pfcpiface
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/Showmax/go-fqdn"
 	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
 )
 
 // QosConfigVal : Qos configured value.
@@ -30,37 +34,133 @@ type SliceInfo struct {
 	ueResList    []UeResource
 }
 
+// sliceMeterCounters are the traffic admitted and dropped by a slice meter, in one
+// direction or in both for datapaths metering them together.
+type sliceMeterCounters struct {
+	bytes          uint64
+	droppedPackets uint64
+	droppedBytes   uint64
+}
+
+// Directions of slice meter counters.
+const (
+	sliceDirectionUplink   = "uplink"
+	sliceDirectionDownlink = "downlink"
+	sliceDirectionBoth     = "both"
+)
+
 type UeResource struct {
 	name string
 	dnn  string
 }
 
 type upf struct {
-	EnableUeIPAlloc    bool `json:"enableueipalloc"`
-	EnableEndMarker    bool `json:"enableendmarker"`
-	EnableFlowMeasure  bool
-	accessIface        string
-	coreIface          string
-	ippoolCidr         string
-	AccessIP           net.IP `json:"accessip"`
-	CoreIP             net.IP `json:"coreip"`
-	NodeID             string `json:"nodeid"`
-	gwIP               string
-	ippool             *IPPool
+	EnableUeIPAlloc   bool `json:"enableueipalloc"`
+	EnableEndMarker   bool `json:"enableendmarker"`
+	endMarkerCount    uint8
+	endMarkerInterval time.Duration
+	EnableFlowMeasure bool
+	accessIface       string
+	coreIface         string
+	ippoolCidr        string
+	ippool6Cidr       string
+	AccessIP          net.IP `json:"accessip"`
+	CoreIP            net.IP `json:"coreip"`
+	NodeID            string `json:"nodeid"`
+	nodeIP            net.IP
+	gwIP              string
+	ippools           *IPPools
+	ipam              ipamDriver
+	ueIPLeaseTTL      time.Duration
+	ippoolsByDNN      []UEIPPoolInfo
+	// dnns are the DNNs served, by Network Instance, nil to serve any.
+	dnns     dnnTable
+	dnnInfos []DNNInfo
+	// nis maps Network Instances to local interfaces, nil to use the access and core ones.
+	nis niTable
+	// duplication mirrors the traffic of the FARs with the DUPL action, nil unless
+	// enabled.
+	duplication *duplicator
+	// localSwitching is set if the traffic between the UEs of a 5G VN group is switched
+	// within the UPF.
+	localSwitching bool
+	// redirection redirects the traffic of the FARs with Redirect Information, nil
+	// unless enabled.
+	redirection *redirector
+	// enrichment inserts the headers of the FARs with Header Enrichment, nil unless
+	// enabled.
+	enrichment *enricher
+	// teidPool allocates the F-TEIDs chosen by the UPF, nil unless FTUP is enabled.
+	teidPool *teidPool
+	// role is rolePSA or roleIUPF, the latter advertising N9 resources on the core side.
+	role               string
 	peers              []string
+	peerACL            *peerACL
 	accessGwRegistered bool
 	coreGwRegistered   bool
 	Dnn                string `json:"dnn"`
-	reportNotifyChan   chan uint64
-	sliceInfo          *SliceInfo
-	readTimeout        time.Duration
-	Hostname           string `json:"hostname"`
+	reports            *reportPipeline
+	pathEventChan      chan gtpuPathEvent
+	errorIndChan       chan gtpuErrorIndication
+	resyncChan         chan struct{}
+	pathMonitor        *gtpuPathMonitor
+	auditor            *rulesAuditor
+	sessionGC          *sessionGC
+	loadMonitor        *loadMonitor
+	usageWheel         *timerWheel
+	// slices are the network slices configured through the REST API, and the one of
+	// slice_rate_limit_config, keyed by name.
+	slicesLock sync.RWMutex
+	slices     map[string]*SliceInfo
+	Hostname   string `json:"hostname"`
 	datapath
-	maxReqRetries uint8
-	respTimeout   time.Duration
+	// reloadLock guards the settings reloaded at runtime.
+	reloadLock    sync.RWMutex
+	timers        pfcpTimers
 	enableHBTimer bool
-	hbInterval    time.Duration
 	ueransim      bool
+
+	hbFailureAction      string
+	hbFailureGracePeriod time.Duration
+
+	asyncWrites       bool
+	asyncWriteFailure string
+
+	pfcpRateLimit PFCPRateLimitInfo
+	pfcpWorkers   int
+	// pfcpTraceSize is the number of messages traced per peer, none if 0.
+	pfcpTraceSize int
+	// auditLog records the session events, nil unless enabled.
+	auditLog *sessionAuditLog
+	// webhooks posts the association and session events, nil unless configured.
+	webhooks *webhookNotifier
+	// charging exports the charging records of the sessions, nil unless enabled.
+	charging *chargingExporter
+	// flowExport exports the traffic of each PDR to an IPFIX collector, nil unless
+	// enabled.
+	flowExport *flowExporter
+	// sessionEvents streams the session events to gRPC clients, nil unless enabled.
+	sessionEvents *sessionFeed
+	// associations tracks the association with each CP node for its gauges.
+	associations *associationStats
+	// recoveryTS is the Recovery Time Stamp advertised to the CP nodes.
+	recoveryTS time.Time
+	// recovery persists recoveryTS and the associated CP nodes, nil unless enabled.
+	recovery *recoveryState
+	// datapathMetrics are the latency and errors of the datapath calls.
+	datapathMetrics *datapathMetrics
+	// disabledCollectors are the collectors disabled by metrics.disabled_collectors.
+	disabledCollectors map[string]bool
+
+	gracefulReleasePeriod time.Duration
+	// ddnBatchWindow is how long the notifications of a session are batched into one
+	// Downlink Data Report.
+	ddnBatchWindow time.Duration
+
+	// draining is set while new sessions are rejected ahead of a scale-down.
+	draining int32
+	// sessionLimit rejects new sessions once their count reaches its maximum.
+	sessionLimit sessionLimit
 }
 
 // to be replaced with go-pfcp structs
@@ -83,17 +183,112 @@ func (u *upf) isConnected() bool {
 	return u.datapath.IsConnected(&u.AccessIP)
 }
 
+// sendSessionRules writes the rules of a session in a single batch if the datapath
+// supports it, or rule by rule otherwise.
+func (u *upf) sendSessionRules(method upfMsgType, all PacketForwardingRules, updated PacketForwardingRules) uint8 {
+	err := u.WriteSessionBatch(method, all, updated)
+	if err == nil {
+		return ie.CauseRequestAccepted
+	}
+
+	if errors.Is(err, errExhausted) {
+		log.Errorln("Failed to write batch of rules:", err)
+		return ie.CauseNoResourcesAvailable
+	}
+
+	if errors.Is(err, errInvalidArgument) {
+		log.Errorln("Failed to write batch of rules:", err)
+		return ie.CauseRuleCreationModificationFailure
+	}
+
+	if !errors.Is(err, errUnsupported) {
+		log.Errorln("Failed to write batch of rules:", err)
+		return ie.CauseRequestRejected
+	}
+
+	return u.SendMsgToUPF(method, all, updated)
+}
+
+// addSliceInfo adds a slice, or replaces the slice of the same name, and writes its
+// meters to the datapath.
 func (u *upf) addSliceInfo(sliceInfo *SliceInfo) error {
 	if sliceInfo == nil {
 		return ErrInvalidArgument("sliceInfo", sliceInfo)
 	}
 
-	u.sliceInfo = sliceInfo
+	if sliceInfo.name == "" {
+		return ErrInvalidArgument("sliceInfo.name", sliceInfo.name)
+	}
+
+	u.slicesLock.Lock()
+	if u.slices == nil {
+		u.slices = make(map[string]*SliceInfo)
+	}
+
+	u.slices[sliceInfo.name] = sliceInfo
+	u.slicesLock.Unlock()
 
 	return u.datapath.AddSliceInfo(sliceInfo)
 }
 
-func NewUPF(conf *Conf, fp datapath) *upf {
+// removeSliceInfo removes a slice and its meters from the datapath.
+func (u *upf) removeSliceInfo(name string) error {
+	u.slicesLock.Lock()
+
+	sliceInfo, ok := u.slices[name]
+	if !ok {
+		u.slicesLock.Unlock()
+		return ErrNotFoundWithParam("slice", "name", name)
+	}
+
+	delete(u.slices, name)
+	u.slicesLock.Unlock()
+
+	return u.datapath.RemoveSliceInfo(sliceInfo)
+}
+
+// getSliceInfo returns the slice of the given name, or nil.
+func (u *upf) getSliceInfo(name string) *SliceInfo {
+	u.slicesLock.RLock()
+	defer u.slicesLock.RUnlock()
+
+	return u.slices[name]
+}
+
+// getSliceInfos returns the configured slices, sorted by name.
+func (u *upf) getSliceInfos() []*SliceInfo {
+	u.slicesLock.RLock()
+	defer u.slicesLock.RUnlock()
+
+	slices := make([]*SliceInfo, 0, len(u.slices))
+	for _, sliceInfo := range u.slices {
+		slices = append(slices, sliceInfo)
+	}
+
+	sort.Slice(slices, func(i, j int) bool { return slices[i].name < slices[j].name })
+
+	return slices
+}
+
+// close closes the files and connections opened by NewUPF, when it fails.
+func (u *upf) close() {
+	u.auditLog.close()
+	u.charging.close()
+	u.flowExport.close()
+
+	if u.ippools != nil {
+		u.ippools.journal.close()
+	}
+
+	if u.teidPool != nil {
+		u.teidPool.journal.close()
+	}
+}
+
+// NewUPF creates the UPF of conf. Settings are not checked again, conf must have been
+// validated by validateConf, e.g. loaded with LoadConfigFile. An error is returned if
+// the UPF cannot be set up with the settings of conf on this host.
+func NewUPF(conf *Conf, fp datapath) (*upf, error) {
 	var (
 		err    error
 		nodeID string
@@ -103,7 +298,7 @@ func NewUPF(conf *Conf, fp datapath) *upf {
 	if conf.CPIface.UseFQDN && nodeID == "" {
 		nodeID, err = fqdn.FqdnHostname()
 		if err != nil {
-			log.Fatalln("Unable to get hostname", err)
+			return nil, fmt.Errorf("unable to get hostname: %w", err)
 		}
 	}
 
@@ -111,82 +306,208 @@ func NewUPF(conf *Conf, fp datapath) *upf {
 	if nodeID != "" {
 		hosts, err := net.LookupHost(nodeID)
 		if err != nil {
-			log.Fatalln("Unable to resolve hostname", nodeID, err)
+			return nil, fmt.Errorf("unable to resolve hostname %s: %w", nodeID, err)
 		}
 
 		nodeID = hosts[0]
 	}
 
+	// The Node ID of a UPF behind a PFCP load balancer is the advertised IP.
+	nodeIP := net.ParseIP(conf.CPIface.NodeIP)
+	if nodeID == "" && nodeIP != nil {
+		nodeID = nodeIP.String()
+	}
+
+	dpMetrics := newDatapathMetrics()
+
 	u := &upf{
 		EnableUeIPAlloc:   conf.CPIface.EnableUeIPAlloc,
 		EnableEndMarker:   conf.EnableEndMarker,
+		endMarkerCount:    conf.EndMarkerCount,
 		EnableFlowMeasure: conf.EnableFlowMeasure,
 		accessIface:       conf.AccessIface.IfName,
 		coreIface:         conf.CoreIface.IfName,
 		ippoolCidr:        conf.CPIface.UEIPPool,
+		ippool6Cidr:       conf.CPIface.UEIPv6Pool,
+		ippoolsByDNN:      conf.CPIface.ueIPPools(),
+		dnns:              newDNNTable(conf.CPIface.DNNs),
+		dnnInfos:          conf.CPIface.DNNs,
+		role:              conf.Role,
 		NodeID:            nodeID,
-		datapath:          fp,
+		nodeIP:            nodeIP,
+		datapath:          newInstrumentedDatapath(fp, datapathBackend(conf), dpMetrics),
+		datapathMetrics:   dpMetrics,
 		Dnn:               conf.CPIface.Dnn,
-		peers:             conf.CPIface.Peers,
-		reportNotifyChan:  make(chan uint64, 1024),
-		maxReqRetries:     conf.MaxReqRetries,
+		peers:             peerAddresses(conf.CPIface.Peers),
+		peerACL:           newPeerACL(conf.CPIface.AllowedPeers),
+		reports:           newReportPipeline(reportPipelineSize, reportPipelineBlockTimeout),
+		pathEventChan:     make(chan gtpuPathEvent, 64),
+		errorIndChan:      make(chan gtpuErrorIndication, 64),
+		resyncChan:        make(chan struct{}, 1),
+		usageWheel:        newTimerWheel(),
 		enableHBTimer:     conf.EnableHBTimer,
-		readTimeout:       time.Second * time.Duration(conf.ReadTimeout),
 		Hostname:          conf.CPIface.NodeID,
 		ueransim:          conf.Ueransim,
+		asyncWrites:       conf.EnableAsyncWrites,
+		asyncWriteFailure: conf.AsyncWriteFailure,
+		pfcpRateLimit:     conf.PFCPRateLimit,
+		associations:      newAssociationStats(),
+		recoveryTS:        time.Now(),
 	}
 
-	if len(conf.CPIface.Peers) > 0 {
-		u.peers = make([]string, len(conf.CPIface.Peers))
-		nc := copy(u.peers, conf.CPIface.Peers)
+	setUp := false
 
-		if nc == 0 {
-			log.Warnln("Failed to parse cpiface peers, PFCP Agent will not initiate connection to N4 peers.")
+	defer func() {
+		if !setUp {
+			u.close()
 		}
-	}
+	}()
 
 	if !conf.EnableP4rt {
 		u.AccessIP, err = GetUnicastAddressFromInterface(conf.AccessIface.IfName)
 
 		if err != nil {
-			log.Errorln(err)
-			return nil
+			return nil, fmt.Errorf("access interface %s: %w", conf.AccessIface.IfName, err)
 		}
 
 		u.CoreIP, err = GetUnicastAddressFromInterface(conf.CoreIface.IfName)
 		if err != nil {
-			log.Errorln(err)
-			return nil
+			return nil, fmt.Errorf("core interface %s: %w", conf.CoreIface.IfName, err)
 		}
 	}
 
-	u.respTimeout, err = time.ParseDuration(conf.RespTimeout)
+	u.nis = newNITable(conf.NetworkInstances)
+
+	if conf.FARDuplication.Enable {
+		u.duplication = newDuplicator(conf.FARDuplication)
+	}
+
+	u.localSwitching = conf.LocalSwitching.Enable
+
+	if conf.FARRedirect.Enable {
+		u.redirection = newRedirector(conf.FARRedirect)
+	}
+
+	if conf.HeaderEnrichment.Enable {
+		u.enrichment = newEnricher(conf.HeaderEnrichment)
+	}
+
+	u.timers, err = newPFCPTimers(conf)
 	if err != nil {
-		log.Fatalln("Unable to parse resp_timeout")
+		return nil, err
+	}
+
+	if conf.EnableGtpuPathMonitor {
+		u.pathMonitor = newGTPUPathMonitor(validDuration(conf.GtpuEchoInterval), conf.GtpuEchoMaxRetries, u.pathEventChan)
+	}
+
+	if conf.LoadControl.Enable || conf.OverloadControl.Enable {
+		u.loadMonitor = newLoadMonitor(*conf)
+	}
+
+	if conf.SessionGC.Enable {
+		u.sessionGC = newSessionGC(conf.SessionGC)
+	}
+
+	if conf.RulesAuditInterval != "" {
+		u.auditor = newRulesAuditor(validDuration(conf.RulesAuditInterval))
+	}
+
+	u.endMarkerInterval = validDuration(conf.EndMarkerInterval)
+	u.gracefulReleasePeriod = validDuration(conf.GracefulReleasePeriod)
+	u.ddnBatchWindow = validDuration(conf.DDNBatchWindow)
+
+	u.disabledCollectors = make(map[string]bool)
+	for _, c := range conf.Metrics.DisabledCollectors {
+		u.disabledCollectors[c] = true
+	}
+	u.pfcpWorkers = int(conf.PFCPWorkers)
+	u.sessionLimit.max = conf.MaxSessions
+	u.pfcpTraceSize = int(conf.PFCPTraceSize)
+	u.hbFailureAction = conf.HBFailureAction
+	u.hbFailureGracePeriod = validDuration(conf.HBFailureGracePeriod)
+
+	if conf.AuditLog.Enable {
+		u.auditLog, err = newSessionAuditLog(conf.AuditLog)
+		if err != nil {
+			return nil, fmt.Errorf("audit log init failed: %w", err)
+		}
+	}
+
+	if len(conf.Webhooks.URLs) > 0 {
+		u.webhooks = newWebhookNotifier(conf.Webhooks, nodeID)
+	}
+
+	if conf.Charging.Enable {
+		u.charging, err = newChargingExporter(conf.Charging, nodeID)
+		if err != nil {
+			return nil, fmt.Errorf("charging export init failed: %w", err)
+		}
+	}
+
+	if conf.FlowExport.Enable {
+		u.flowExport, err = newFlowExporter(conf.FlowExport)
+		if err != nil {
+			return nil, fmt.Errorf("flow export init failed: %w", err)
+		}
 	}
 
-	if u.enableHBTimer {
-		if conf.HeartBeatInterval != "" {
-			u.hbInterval, err = time.ParseDuration(conf.HeartBeatInterval)
-			if err != nil {
-				log.Fatalln("Unable to parse heart_beat_interval")
+	if conf.SessionEvents.Enable {
+		u.sessionEvents = newSessionFeed(conf.SessionEvents)
+	}
+
+	if u.EnableUeIPAlloc && conf.CPIface.IPAM.URL != "" {
+		u.ipam, err = newRESTIPAM(conf.CPIface.IPAM, nodeID)
+		if err != nil {
+			return nil, fmt.Errorf("IPAM init failed: %w", err)
+		}
+	} else if u.EnableUeIPAlloc {
+		u.ippools, err = NewIPPools(u.ippoolCidr, u.ippool6Cidr, u.ippoolsByDNN)
+		if err != nil {
+			return nil, fmt.Errorf("ip pool init failed: %w", err)
+		}
+
+		if conf.CPIface.UEIPAllocFile != "" {
+			if err := u.ippools.persist(conf.CPIface.UEIPAllocFile); err != nil {
+				return nil, fmt.Errorf("unable to restore UE IP allocations: %w", err)
 			}
 		}
+
+		u.ueIPLeaseTTL = validDuration(conf.CPIface.UEIPLeaseTTL)
+
+		u.ipam = u.ippools
 	}
 
-	if u.EnableUeIPAlloc {
-		u.ippool, err = NewIPPool(u.ippoolCidr)
+	if conf.CPIface.RecoveryStateFile != "" {
+		u.recovery, err = openRecoveryState(conf.CPIface.RecoveryStateFile, u.recoveryTS)
 		if err != nil {
-			log.Fatalln("ip pool init failed", err)
+			return nil, fmt.Errorf("unable to restore recovery state: %w", err)
+		}
+
+		u.recoveryTS = u.recovery.recoveryTimeStamp()
+	}
+
+	if conf.CPIface.EnableFTUP {
+		u.teidPool = newTEIDPool(conf.CPIface.TEIDRanges)
+
+		if conf.CPIface.TEIDAllocFile != "" {
+			if err := u.teidPool.persist(conf.CPIface.TEIDAllocFile); err != nil {
+				return nil, fmt.Errorf("unable to restore TEID allocations: %w", err)
+			}
 		}
 	}
 
-	u.datapath.SetUpfInfo(u, conf)
+	if err := u.datapath.SetUpfInfo(u, conf); err != nil {
+		return nil, fmt.Errorf("datapath setup failed: %w", err)
+	}
+
+	setUp = true
+
 	fmt.Println("upf info :")
 	fmt.Println("dnn = ", u.Dnn)
 	fmt.Println("AccessIP = ", u.AccessIP)
 	fmt.Println("CoreIP = ", u.CoreIP)
 	fmt.Println("nodeID = ", u.NodeID)
 
-	return u
+	return u, nil
 }
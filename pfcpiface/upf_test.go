@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpf_sliceInfos(t *testing.T) {
+	f := &fakeDatapath{}
+	u := &upf{datapath: f}
+
+	require.Error(t, u.addSliceInfo(&SliceInfo{}))
+
+	require.NoError(t, u.addSliceInfo(&SliceInfo{name: "slice2", uplinkMbr: 1000}))
+	require.NoError(t, u.addSliceInfo(&SliceInfo{name: "slice1", uplinkMbr: 2000}))
+	require.NoError(t, u.addSliceInfo(&SliceInfo{name: "slice2", uplinkMbr: 3000}))
+
+	slices := u.getSliceInfos()
+	require.Len(t, slices, 2)
+	require.Equal(t, "slice1", slices[0].name)
+	require.Equal(t, uint64(3000), slices[1].uplinkMbr)
+
+	require.NoError(t, u.removeSliceInfo("slice1"))
+	require.True(t, errors.Is(u.removeSliceInfo("slice1"), errNotFound))
+	require.Len(t, u.getSliceInfos(), 1)
+
+	var methods []string
+	for _, op := range f.state().Operations {
+		methods = append(methods, op.Method)
+	}
+
+	require.Equal(t, []string{"AddSliceInfo", "AddSliceInfo", "AddSliceInfo", "RemoveSliceInfo"}, methods)
+}
+
+func TestNewUPF(t *testing.T) {
+	validConf := func() Conf {
+		return Conf{
+			EnableP4rt:        true,
+			ReadTimeout:       15,
+			RespTimeout:       "2s",
+			HeartBeatInterval: "5s",
+			CPIface: CPIfaceInfo{
+				NodeIP:          "198.18.0.1",
+				EnableUeIPAlloc: true,
+				UEIPPool:        "10.250.0.0/16",
+			},
+		}
+	}
+
+	conf := validConf()
+	u, err := NewUPF(&conf, &fakeDatapath{})
+	require.NoError(t, err)
+	require.Equal(t, "198.18.0.1", u.NodeID)
+	require.Equal(t, 2*time.Second, u.getPFCPTimers().respTimeout)
+
+	for _, scenario := range []struct {
+		description string
+		modify      func(conf *Conf)
+	}{
+		{
+			description: "unresolvable node ID",
+			modify:      func(conf *Conf) { conf.CPIface.NodeID = "upf.invalid" },
+		},
+		{
+			description: "missing access interface",
+			modify: func(conf *Conf) {
+				conf.EnableP4rt = false
+				conf.AccessIface.IfName = "nonexistent0"
+			},
+		},
+		{
+			description: "invalid response timeout",
+			modify:      func(conf *Conf) { conf.RespTimeout = "soon" },
+		},
+		{
+			description: "UE IP pool too small",
+			modify:      func(conf *Conf) { conf.CPIface.UEIPPool = "10.250.0.1/32" },
+		},
+	} {
+		t.Run(scenario.description, func(t *testing.T) {
+			conf := validConf()
+			scenario.modify(&conf)
+
+			u, err := NewUPF(&conf, &fakeDatapath{})
+			require.Error(t, err)
+			require.Nil(t, u)
+		})
+	}
+}
+
+// failingDatapath fails to set up, keeping the UPF it was set up for.
+type failingDatapath struct {
+	fakeDatapath
+	u *upf
+}
+
+func (f *failingDatapath) SetUpfInfo(u *upf, conf *Conf) error {
+	f.u = u
+	return ErrOperationFailedWithReason("datapath setup", "no datapath")
+}
+
+func TestNewUPF_datapathFailure(t *testing.T) {
+	conf := Conf{
+		EnableP4rt:        true,
+		ReadTimeout:       15,
+		RespTimeout:       "2s",
+		HeartBeatInterval: "5s",
+		CPIface:           CPIfaceInfo{NodeIP: "198.18.0.1"},
+		AuditLog:          AuditLogInfo{Enable: true, Path: filepath.Join(t.TempDir(), "audit.log")},
+	}
+
+	f := &failingDatapath{}
+
+	u, err := NewUPF(&conf, f)
+	require.Error(t, err)
+	require.Nil(t, u)
+
+	// The audit log opened before the datapath setup is closed.
+	require.NotNil(t, f.u)
+	require.Empty(t, f.u.auditLog.closers)
+}
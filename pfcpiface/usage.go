@@ -0,0 +1,576 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+// usageCheckInterval is how often datapath counters are polled to evaluate URR thresholds.
+const usageCheckInterval = time.Second
+
+// trafficInactivityDefault is how long the traffic of a PDR must cease for before its
+// stop is reported, if its URR has no Inactivity Detection Time.
+const trafficInactivityDefault = 10 * time.Second
+
+// Usage Report Trigger flags (3GPP TS 29.244, clause 8.2.41), first octet.
+const (
+	usageTriggerPERIO = 0x01
+	usageTriggerVOLTH = 0x02
+	usageTriggerTIMTH = 0x04
+	usageTriggerSTART = 0x10
+	usageTriggerSTOPT = 0x20
+)
+
+// Usage Report Trigger flags (3GPP TS 29.244, clause 8.2.41), second octet.
+const (
+	usageTriggerTERMR = 0x08
+)
+
+// Volume Measurement flags (3GPP TS 29.244, clause 8.2.44): all volumes and packet counts.
+const volumeMeasurementAll = 0x3f
+
+// pdrCounterKey identifies a PDR across all sessions of a connection.
+type pdrCounterKey struct {
+	fseID uint64
+	pdrID uint32
+}
+
+// pdrCounters is a snapshot of the cumulative traffic forwarded by a PDR in the datapath.
+type pdrCounters struct {
+	packets uint64
+	bytes   uint64
+}
+
+// urrUsage is the traffic accounted to a URR since its last usage report.
+type urrUsage struct {
+	seqNum    uint32
+	start     time.Time
+	ulPackets uint64
+	dlPackets uint64
+	ulBytes   uint64
+	dlBytes   uint64
+}
+
+// trafficKey identifies the traffic of a PDR detected for a URR.
+type trafficKey struct {
+	urrID uint32
+	pdrID uint32
+}
+
+// trafficDetection tracks whether the traffic of a PDR started or stopped.
+type trafficDetection struct {
+	detected  bool
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+type sessionUsage struct {
+	// last counters read for each PDR, used to compute deltas
+	pdrs map[uint32]pdrCounters
+	urrs map[uint32]*urrUsage
+	// traffic is when the PDRs of each URR last forwarded packets.
+	traffic map[trafficKey]*trafficDetection
+	// charging is the traffic of the session since its last charging record.
+	charging urrUsage
+}
+
+// usageTracker accumulates datapath counters into URR measurements for all sessions of a
+// PFCP connection.
+type usageTracker struct {
+	mu       sync.Mutex
+	sessions map[uint64]*sessionUsage
+}
+
+func newUsageTracker() *usageTracker {
+	return &usageTracker{
+		sessions: make(map[uint64]*sessionUsage),
+	}
+}
+
+// forgetSession drops the measurements of a deleted session.
+func (t *usageTracker) forgetSession(seid uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.sessions, seid)
+}
+
+// forgetURR drops the measurement of a removed URR.
+func (t *usageTracker) forgetURR(seid uint64, urrID uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, ok := t.sessions[seid]; ok {
+		delete(s.urrs, urrID)
+
+		for key := range s.traffic {
+			if key.urrID == urrID {
+				delete(s.traffic, key)
+			}
+		}
+	}
+}
+
+// account adds the traffic counted since the previous call to the URRs of the session.
+// Must be called with t.mu held.
+func (t *usageTracker) account(session PFCPSession, counters map[pdrCounterKey]pdrCounters, now time.Time) *sessionUsage {
+	s, ok := t.sessions[session.localSEID]
+	if !ok {
+		s = &sessionUsage{
+			pdrs:     make(map[uint32]pdrCounters),
+			urrs:     make(map[uint32]*urrUsage),
+			traffic:  make(map[trafficKey]*trafficDetection),
+			charging: urrUsage{start: now},
+		}
+		t.sessions[session.localSEID] = s
+	}
+
+	for _, u := range session.urrs {
+		if _, ok := s.urrs[u.urrID]; !ok {
+			s.urrs[u.urrID] = &urrUsage{start: now}
+		}
+	}
+
+	for _, p := range session.pdrs {
+		cur, ok := counters[pdrCounterKey{fseID: p.fseID, pdrID: p.pdrID}]
+		if !ok {
+			continue
+		}
+
+		last := s.pdrs[p.pdrID]
+		s.pdrs[p.pdrID] = cur
+
+		// Counters going backwards were reset in the datapath (e.g. rule re-installed).
+		delta := cur
+		if cur.bytes >= last.bytes && cur.packets >= last.packets {
+			delta = pdrCounters{packets: cur.packets - last.packets, bytes: cur.bytes - last.bytes}
+		}
+
+		if p.IsUplink() {
+			s.charging.ulPackets += delta.packets
+			s.charging.ulBytes += delta.bytes
+		} else if p.IsDownlink() {
+			s.charging.dlPackets += delta.packets
+			s.charging.dlBytes += delta.bytes
+		}
+
+		for _, id := range p.urrIDList {
+			usage, ok := s.urrs[id]
+			if !ok {
+				continue
+			}
+
+			if p.IsUplink() {
+				usage.ulPackets += delta.packets
+				usage.ulBytes += delta.bytes
+			} else if p.IsDownlink() {
+				usage.dlPackets += delta.packets
+				usage.dlBytes += delta.bytes
+			}
+
+			if delta.packets > 0 {
+				s.sawTraffic(trafficKey{urrID: id, pdrID: p.pdrID}, now)
+			}
+		}
+	}
+
+	return s
+}
+
+// thresholdReports accounts the latest counters of the session and returns a Usage Report
+// for every URR that crossed its volume or time threshold. Reported URRs start a new
+// measurement.
+func (t *usageTracker) thresholdReports(session PFCPSession, counters map[pdrCounterKey]pdrCounters, now time.Time) []*ie.IE {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.account(session, counters, now)
+
+	var reports []*ie.IE
+
+	for _, u := range session.urrs {
+		usage := s.urrs[u.urrID]
+
+		var trigger uint8
+
+		if u.hasVolumeThreshold() && usage.exceeds(u.volThreshold) {
+			trigger |= usageTriggerVOLTH
+		}
+
+		if u.hasTimeThreshold() && now.Sub(usage.start) >= time.Duration(u.timeThreshold)*time.Second {
+			trigger |= usageTriggerTIMTH
+		}
+
+		if trigger == 0 {
+			continue
+		}
+
+		reports = append(reports, usage.reportAndRestart(u.urrID, ie.NewUsageReportTrigger(trigger, 0, 0), now))
+	}
+
+	return append(reports, s.trafficReports(session, now)...)
+}
+
+func (s *sessionUsage) sawTraffic(key trafficKey, now time.Time) {
+	d, ok := s.traffic[key]
+	if !ok {
+		d = &trafficDetection{}
+		s.traffic[key] = d
+	}
+
+	if !d.detected {
+		d.firstSeen = now
+	}
+
+	d.lastSeen = now
+}
+
+// trafficReports returns a Usage Report for every PDR whose traffic started since the
+// previous call, or stopped for the inactivity detection time of its URR, if the URR
+// has the START or STOPT reporting trigger. The measurements of the URRs go on.
+func (s *sessionUsage) trafficReports(session PFCPSession, now time.Time) []*ie.IE {
+	var reports []*ie.IE
+
+	for _, u := range session.urrs {
+		if !u.detectsTraffic() {
+			continue
+		}
+
+		inactivity := trafficInactivityDefault
+		if u.inactivityTime != 0 {
+			inactivity = time.Duration(u.inactivityTime) * time.Second
+		}
+
+		for _, p := range session.pdrs {
+			d, ok := s.traffic[trafficKey{urrID: u.urrID, pdrID: p.pdrID}]
+			if !ok {
+				continue
+			}
+
+			var trigger uint8
+
+			switch {
+			case !d.detected && now.Sub(d.lastSeen) < inactivity:
+				d.detected = true
+
+				if u.reportTriggers&reportStartOfTraffic != 0 {
+					trigger = usageTriggerSTART
+				}
+			case d.detected && now.Sub(d.lastSeen) >= inactivity:
+				d.detected = false
+
+				if u.reportTriggers&reportStopOfTraffic != 0 {
+					trigger = usageTriggerSTOPT
+				}
+			}
+
+			if trigger == 0 {
+				continue
+			}
+
+			usage := s.urrs[u.urrID]
+			reports = append(reports, trafficReport(u.urrID, usage.seqNum, trigger, p, d))
+			usage.seqNum++
+		}
+	}
+
+	return reports
+}
+
+// trafficReport is the Usage Report of the start or stop of the traffic of p, with the
+// application it was detected for.
+func trafficReport(urrID, seqNum uint32, trigger uint8, p pdr, d *trafficDetection) *ie.IE {
+	ies := []*ie.IE{
+		ie.NewURRID(urrID),
+		ie.NewURSEQN(seqNum),
+		ie.NewUsageReportTrigger(trigger, 0, 0),
+	}
+
+	if trigger == usageTriggerSTART {
+		ies = append(ies, ie.NewTimeOfFirstPacket(d.firstSeen))
+	} else {
+		ies = append(ies, ie.NewTimeOfLastPacket(d.lastSeen))
+	}
+
+	if p.appID != "" {
+		ies = append(ies, ie.NewApplicationDetectionInformation(ie.NewApplicationID(p.appID)))
+	}
+
+	if p.ueAddress != 0 {
+		ies = append(ies, ie.NewUEIPAddress(0x2, int2ip(p.ueAddress).String(), "", 0, 0))
+	}
+
+	return ie.NewUsageReportWithinSessionReportRequest(ies...)
+}
+
+// periodicReports accounts the latest counters of the session and returns a Usage Report
+// for each of urrIDs that still belongs to the session. Reported URRs start a new
+// measurement.
+func (t *usageTracker) periodicReports(session PFCPSession, urrIDs []uint32, counters map[pdrCounterKey]pdrCounters, now time.Time) []*ie.IE {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.account(session, counters, now)
+
+	var reports []*ie.IE
+
+	for _, id := range urrIDs {
+		usage, ok := s.urrs[id]
+		if !ok {
+			continue
+		}
+
+		reports = append(reports, usage.reportAndRestart(id, ie.NewUsageReportTrigger(usageTriggerPERIO, 0, 0), now))
+	}
+
+	return reports
+}
+
+// finalReports accounts the latest counters of the session and returns a Usage Report for
+// every URR of the session, as sent when the session is terminated.
+func (t *usageTracker) finalReports(session PFCPSession, counters map[pdrCounterKey]pdrCounters, now time.Time) []*ie.IE {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.account(session, counters, now)
+
+	reports := make([]*ie.IE, 0, len(session.urrs))
+
+	for _, u := range session.urrs {
+		reports = append(reports, s.urrs[u.urrID].report(ie.NewUsageReportWithinSessionDeletionResponse,
+			u.urrID, ie.NewUsageReportTrigger(0, usageTriggerTERMR, 0), now))
+	}
+
+	return reports
+}
+
+// takeCharging returns the traffic of the session since its last charging record, if
+// that started at least minAge ago, and starts a new record.
+func (t *usageTracker) takeCharging(seid uint64, now time.Time, minAge time.Duration) (urrUsage, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sessions[seid]
+	if !ok || now.Sub(s.charging.start) < minAge {
+		return urrUsage{}, false
+	}
+
+	usage := s.charging
+	s.charging = urrUsage{seqNum: usage.seqNum + 1, start: now}
+
+	return usage, true
+}
+
+func (u *urrUsage) exceeds(th volumeThreshold) bool {
+	return (th.flags&volumeTotal != 0 && u.ulBytes+u.dlBytes >= th.total) ||
+		(th.flags&volumeUplink != 0 && u.ulBytes >= th.uplink) ||
+		(th.flags&volumeDownlink != 0 && u.dlBytes >= th.downlink)
+}
+
+func (u *urrUsage) reportAndRestart(urrID uint32, trigger *ie.IE, now time.Time) *ie.IE {
+	report := u.report(ie.NewUsageReportWithinSessionReportRequest, urrID, trigger, now)
+	*u = urrUsage{seqNum: u.seqNum + 1, start: now}
+
+	return report
+}
+
+func (u *urrUsage) report(newReport func(...*ie.IE) *ie.IE, urrID uint32, trigger *ie.IE, now time.Time) *ie.IE {
+	return newReport(
+		ie.NewURRID(urrID),
+		ie.NewURSEQN(u.seqNum),
+		trigger,
+		ie.NewStartTime(u.start),
+		ie.NewEndTime(now),
+		ie.NewVolumeMeasurement(volumeMeasurementAll,
+			u.ulBytes+u.dlBytes, u.ulBytes, u.dlBytes,
+			u.ulPackets+u.dlPackets, u.ulPackets, u.dlPackets),
+		ie.NewDurationMeasurement(now.Sub(u.start)),
+	)
+}
+
+// readSessionCounters reads the datapath counters of the PDRs that are linked to URRs.
+func (pConn *PFCPConn) readSessionCounters(sessions []PFCPSession) (map[pdrCounterKey]pdrCounters, error) {
+	pdrs := make([]pdr, 0)
+
+	for _, s := range sessions {
+		for _, p := range s.pdrs {
+			if len(p.urrIDList) > 0 {
+				pdrs = append(pdrs, p)
+			}
+		}
+	}
+
+	if len(pdrs) == 0 {
+		return map[pdrCounterKey]pdrCounters{}, nil
+	}
+
+	return pConn.upf.ReadPDRCounters(pdrs)
+}
+
+// schedulePeriodicReports arms or disarms the periodic measurement reports of urrs.
+func (pConn *PFCPConn) schedulePeriodicReports(urrs []urr) {
+	for _, u := range urrs {
+		key := urrTimerKey{pConn: pConn, seid: u.fseID, urrID: u.urrID}
+
+		if u.reportTriggers&reportPeriodic != 0 {
+			pConn.upf.usageWheel.schedule(key, u.measurePeriod)
+		} else {
+			pConn.upf.usageWheel.cancel(key)
+		}
+	}
+}
+
+func (pConn *PFCPConn) cancelPeriodicReport(seid uint64, urrID uint32) {
+	pConn.upf.usageWheel.cancel(urrTimerKey{pConn: pConn, seid: seid, urrID: urrID})
+}
+
+// sendPeriodicReports reports the usage of the URRs whose measurement period expired,
+// reading the datapath counters of all involved sessions at once.
+func (pConn *PFCPConn) sendPeriodicReports(timers []*urrTimer) {
+	urrIDs := make(map[uint64][]uint32)
+	for _, t := range timers {
+		urrIDs[t.seid] = append(urrIDs[t.seid], t.urrID)
+	}
+
+	sessions := make([]PFCPSession, 0, len(urrIDs))
+
+	for seid := range urrIDs {
+		s, ok := pConn.store.GetSession(seid)
+		if !ok {
+			continue
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	counters, err := pConn.readSessionCounters(sessions)
+	if err != nil {
+		log.Warnln("Reading usage counters for periodic reports failed:", err)
+		return
+	}
+
+	now := time.Now()
+
+	for _, s := range sessions {
+		reports := pConn.usage.periodicReports(s, urrIDs[s.localSEID], counters, now)
+		if len(reports) == 0 {
+			continue
+		}
+
+		pConn.sendUsageReport(s, reports)
+	}
+
+	if rollover := pConn.upf.charging.rolloverInterval(); rollover > 0 {
+		for _, s := range sessions {
+			pConn.exportChargingRecord(s, chargingRecordInterim, now, rollover)
+		}
+	}
+}
+
+// finalUsageReports returns the usage reports to send upon deletion of session.
+func (pConn *PFCPConn) finalUsageReports(session PFCPSession) []*ie.IE {
+	if len(session.urrs) == 0 {
+		return nil
+	}
+
+	counters, err := pConn.readSessionCounters([]PFCPSession{session})
+	if err != nil {
+		log.Warnln("Reading final usage of session", session.localSEID, "failed:", err)
+
+		counters = map[pdrCounterKey]pdrCounters{}
+	}
+
+	now := time.Now()
+	reports := pConn.usage.finalReports(session, counters, now)
+
+	pConn.publishUsage(session, reports)
+
+	pConn.exportChargingRecord(session, chargingRecordFinal, now, 0)
+
+	return reports
+}
+
+// usageReportLoop periodically evaluates the URR thresholds, the QoS monitoring and the
+// inactivity of all sessions of the connection and reports them to the CP.
+func (pConn *PFCPConn) usageReportLoop() {
+	ticker := time.NewTicker(usageCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pConn.shutdown:
+			return
+		case <-pConn.ctx.Done():
+			return
+		case <-ticker.C:
+			pConn.checkUsageThresholds()
+			pConn.checkQoSMonitoring()
+			pConn.checkInactivity()
+		}
+	}
+}
+
+func (pConn *PFCPConn) checkUsageThresholds() {
+	sessions := make([]PFCPSession, 0)
+
+	for _, s := range pConn.store.GetAllSessions() {
+		if len(s.urrs) > 0 {
+			sessions = append(sessions, s)
+		}
+	}
+
+	if len(sessions) == 0 {
+		return
+	}
+
+	counters, err := pConn.readSessionCounters(sessions)
+	if err != nil {
+		log.Debugln("Reading usage counters from datapath failed:", err)
+		return
+	}
+
+	now := time.Now()
+
+	for _, s := range sessions {
+		reports := pConn.usage.thresholdReports(s, counters, now)
+		if len(reports) == 0 {
+			continue
+		}
+
+		pConn.sendUsageReport(s, reports)
+	}
+
+	if rollover := pConn.upf.charging.rolloverInterval(); rollover > 0 {
+		for _, s := range sessions {
+			pConn.exportChargingRecord(s, chargingRecordInterim, now, rollover)
+		}
+	}
+}
+
+// sendUsageReport sends a Session Report Request carrying usage reports of the session.
+func (pConn *PFCPConn) sendUsageReport(session PFCPSession, reports []*ie.IE) {
+	srreq := message.NewSessionReportRequest(0, /* MO?? <-- what's this */
+		0,                            /* FO <-- what's this? */
+		session.remoteSEID,           /* seid */
+		pConn.getSeqNum(),            /* seq # */
+		0,                            /* priority */
+		ie.NewReportType(0, 0, 1, 0), /*upir, erir, usar, dldr int*/
+	)
+	srreq.UsageReport = reports
+
+	log.WithFields(log.Fields{
+		"F-SEID":  session.localSEID,
+		"reports": len(reports),
+	}).Debug("Sending Usage Report")
+
+	pConn.publishUsage(session, reports)
+
+	pConn.SendPFCPMsg(srreq)
+}
@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func Test_usageTracker_thresholdReports(t *testing.T) {
+	const seid = uint64(1)
+
+	session := PFCPSession{
+		localSEID: seid,
+		PacketForwardingRules: PacketForwardingRules{
+			pdrs: []pdr{
+				{pdrID: 1, fseID: seid, srcIface: access, urrIDList: []uint32{10}},
+				{pdrID: 2, fseID: seid, srcIface: core, urrIDList: []uint32{10, 20}},
+			},
+			urrs: []urr{
+				{
+					urrID:          10,
+					measureMethod:  measureVolume,
+					reportTriggers: reportVolumeThreshold,
+					volThreshold:   volumeThreshold{flags: volumeTotal, total: 1000},
+				},
+				{
+					urrID:          20,
+					measureMethod:  measureDuration,
+					reportTriggers: reportTimeThreshold,
+					timeThreshold:  10,
+				},
+			},
+		},
+	}
+
+	counters := func(ul, dl uint64) map[pdrCounterKey]pdrCounters {
+		return map[pdrCounterKey]pdrCounters{
+			{fseID: seid, pdrID: 1}: {packets: ul / 100, bytes: ul},
+			{fseID: seid, pdrID: 2}: {packets: dl / 100, bytes: dl},
+		}
+	}
+
+	tracker := newUsageTracker()
+	start := time.Now()
+
+	reports := tracker.thresholdReports(session, counters(300, 600), start)
+	require.Empty(t, reports)
+
+	reports = tracker.thresholdReports(session, counters(400, 700), start.Add(time.Second))
+	require.Len(t, reports, 1)
+
+	id, err := reports[0].URRID()
+	require.NoError(t, err)
+	require.Equal(t, uint32(10), id)
+
+	vol, err := reports[0].VolumeMeasurement()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1100), vol.TotalVolume)
+	require.Equal(t, uint64(400), vol.UplinkVolume)
+	require.Equal(t, uint64(700), vol.DownlinkVolume)
+
+	trigger, err := reports[0].UsageReportTrigger()
+	require.NoError(t, err)
+	require.Equal(t, uint8(usageTriggerVOLTH), trigger[0])
+
+	// The volume measurement restarts after a report.
+	reports = tracker.thresholdReports(session, counters(500, 800), start.Add(2*time.Second))
+	require.Empty(t, reports)
+
+	reports = tracker.thresholdReports(session, counters(500, 800), start.Add(10*time.Second))
+	require.Len(t, reports, 1)
+
+	id, err = reports[0].URRID()
+	require.NoError(t, err)
+	require.Equal(t, uint32(20), id)
+
+	trigger, err = reports[0].UsageReportTrigger()
+	require.NoError(t, err)
+	require.Equal(t, uint8(usageTriggerTIMTH), trigger[0])
+
+	t.Run("final reports cover all URRs", func(t *testing.T) {
+		reports := tracker.finalReports(session, counters(500, 800), start.Add(11*time.Second))
+		require.Len(t, reports, 2)
+
+		for _, r := range reports {
+			require.Equal(t, uint16(ie.UsageReportWithinSessionDeletionResponse), r.Type)
+			require.True(t, r.HasTERMR())
+		}
+	})
+}
+
+func Test_usageTracker_trafficReports(t *testing.T) {
+	const seid = uint64(1)
+
+	session := PFCPSession{
+		localSEID: seid,
+		PacketForwardingRules: PacketForwardingRules{
+			pdrs: []pdr{
+				{pdrID: 1, fseID: seid, srcIface: core, ueAddress: 0x0afa0001, appID: "video", urrIDList: []uint32{10}},
+			},
+			urrs: []urr{
+				{
+					urrID:          10,
+					measureMethod:  measureEvent,
+					reportTriggers: reportStartOfTraffic | reportStopOfTraffic,
+					inactivityTime: 5,
+				},
+			},
+		},
+	}
+
+	counters := func(packets uint64) map[pdrCounterKey]pdrCounters {
+		return map[pdrCounterKey]pdrCounters{{fseID: seid, pdrID: 1}: {packets: packets, bytes: packets * 100}}
+	}
+
+	trigger := func(report *ie.IE) uint8 {
+		trigger, err := report.UsageReportTrigger()
+		require.NoError(t, err)
+
+		return trigger[0]
+	}
+
+	tracker := newUsageTracker()
+	start := time.Now()
+
+	require.Empty(t, tracker.thresholdReports(session, counters(0), start))
+
+	reports := tracker.thresholdReports(session, counters(10), start.Add(time.Second))
+	require.Len(t, reports, 1)
+	require.Equal(t, uint8(usageTriggerSTART), trigger(reports[0]))
+
+	app, err := reports[0].ApplicationID()
+	require.NoError(t, err)
+	require.Equal(t, "video", app)
+
+	ueIP, err := reports[0].UEIPAddress()
+	require.NoError(t, err)
+	require.Equal(t, "10.250.0.1", ueIP.IPv4Address.String())
+
+	// Traffic going on is not reported again.
+	require.Empty(t, tracker.thresholdReports(session, counters(20), start.Add(2*time.Second)))
+	require.Empty(t, tracker.thresholdReports(session, counters(20), start.Add(6*time.Second)))
+
+	reports = tracker.thresholdReports(session, counters(20), start.Add(7*time.Second))
+	require.Len(t, reports, 1)
+	require.Equal(t, uint8(usageTriggerSTOPT), trigger(reports[0]))
+
+	seq, err := reports[0].URSEQN()
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), seq)
+
+	reports = tracker.thresholdReports(session, counters(30), start.Add(8*time.Second))
+	require.Len(t, reports, 1)
+	require.Equal(t, uint8(usageTriggerSTART), trigger(reports[0]))
+}
@@ -31,12 +31,24 @@ func setUeipFeature(features ...uint8) {
 	}
 }
 
+func setFTUPFeature(features ...uint8) {
+	if len(features) >= 1 {
+		features[0] = features[0] | 0x10
+	}
+}
+
 func setEndMarkerFeature(features ...uint8) {
 	if len(features) >= 2 {
 		features[1] = features[1] | 0x01
 	}
 }
 
+func setQFQMFeature(features ...uint8) {
+	if len(features) >= 5 {
+		features[4] = features[4] | 0x02
+	}
+}
+
 func has2ndBit(f uint8) bool {
 	return (f&0x02)>>1 == 1
 }
@@ -47,6 +47,10 @@ type RegisterGw struct {
 func setupConfigHandler(mux *http.ServeMux, upf *upf) {
 	cfgHandler := ConfigHandler{upf: upf}
 	mux.Handle("/v1/config/network-slices", &cfgHandler)
+	sliceHandler := sliceConfigHandler{upf: upf}
+	mux.Handle("/v1/config/slices", &sliceHandler)
+	mux.Handle("/v1/config/slices/", &sliceHandler)
+	mux.Handle("/v1/ippool", &ipPoolHandler{upf: upf})
 	registerGw := RegisterGw{upf: upf}
 	mux.Handle("/registergw", &registerGw)
 }
@@ -232,9 +236,8 @@ func calculateBitRates(mbr uint64, rate string) uint64 {
 	}
 }
 
-func handleSliceConfig(nwSlice *NetworkSlice, upf *upf) {
-	log.Infoln("handle slice config : ", nwSlice.SliceName)
-
+// newSliceInfo converts the slice config received through the REST API.
+func newSliceInfo(nwSlice *NetworkSlice) *SliceInfo {
 	ulMbr := calculateBitRates(nwSlice.SliceQos.UplinkMbr,
 		nwSlice.SliceQos.BitrateUnit)
 	dlMbr := calculateBitRates(nwSlice.SliceQos.DownlinkMbr,
@@ -258,7 +261,13 @@ func handleSliceConfig(nwSlice *NetworkSlice, upf *upf) {
 		}
 	}
 
-	err := upf.addSliceInfo(&sliceInfo)
+	return &sliceInfo
+}
+
+func handleSliceConfig(nwSlice *NetworkSlice, upf *upf) {
+	log.Infoln("handle slice config : ", nwSlice.SliceName)
+
+	err := upf.addSliceInfo(newSliceInfo(nwSlice))
 	if err != nil {
 		log.Errorln("adding slice info to datapath failed : ", err)
 	}
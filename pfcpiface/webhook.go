@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	webhookTimeoutDefault       = 2 * time.Second
+	webhookRetryIntervalDefault = time.Second
+	webhookMaxRetriesDefault    = 3
+	webhookQueueSizeDefault     = 1024
+)
+
+// Events posted to the webhooks.
+const (
+	webhookAssociationUp   = "association_up"
+	webhookAssociationDown = "association_down"
+	webhookSessionCreated  = "session_created"
+	webhookSessionDeleted  = "session_deleted"
+	webhookHeartbeatFailed = "heartbeat_failure"
+)
+
+var webhookEvents = []string{
+	webhookAssociationUp, webhookAssociationDown, webhookSessionCreated, webhookSessionDeleted, webhookHeartbeatFailed,
+}
+
+// webhookEvent is the JSON body posted to the webhooks.
+type webhookEvent struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"timestamp"`
+	// NodeID is that of the UPF, Peer that of the SMF/SPGW-C.
+	NodeID      string `json:"node_id"`
+	Peer        string `json:"peer,omitempty"`
+	PeerAddress string `json:"peer_address"`
+	SEID        uint64 `json:"seid,omitempty"`
+	UEIP        string `json:"ue_ip,omitempty"`
+	// Sessions is the number of sessions purged by an association loss.
+	Sessions int `json:"sessions,omitempty"`
+}
+
+// webhookNotifier posts events to the webhooks in the background, so that PFCP
+// handling never waits for them. Events are dropped while the queue is full.
+type webhookNotifier struct {
+	urls   []string
+	events map[string]bool
+	nodeID string
+
+	client        *http.Client
+	maxRetries    int
+	retryInterval time.Duration
+
+	queue chan webhookEvent
+}
+
+func newWebhookNotifier(conf WebhookInfo, nodeID string) *webhookNotifier {
+	n := &webhookNotifier{
+		urls:          conf.URLs,
+		events:        make(map[string]bool),
+		nodeID:        nodeID,
+		client:        &http.Client{Timeout: validDuration(conf.Timeout)},
+		maxRetries:    conf.MaxRetries,
+		retryInterval: validDuration(conf.RetryInterval),
+		queue:         make(chan webhookEvent, conf.QueueSize),
+	}
+
+	events := conf.Events
+	if len(events) == 0 {
+		events = webhookEvents
+	}
+
+	for _, e := range events {
+		n.events[e] = true
+	}
+
+	return n
+}
+
+// notify queues e, if subscribed to. Nothing is posted by a nil notifier.
+func (n *webhookNotifier) notify(e webhookEvent) {
+	if n == nil || !n.events[e.Event] {
+		return
+	}
+
+	e.Time = time.Now()
+	e.NodeID = n.nodeID
+
+	select {
+	case n.queue <- e:
+	default:
+		log.Warnln("Webhook queue full, dropping event", e.Event)
+	}
+}
+
+// run posts the queued events until ctx is done.
+func (n *webhookNotifier) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-n.queue:
+			body, err := json.Marshal(e)
+			if err != nil {
+				log.Errorln("Failed to encode webhook event:", err)
+				continue
+			}
+
+			for _, url := range n.urls {
+				if err := n.post(ctx, url, "application/json", body); err != nil {
+					log.Errorln("Failed to post", e.Event, "event to webhook:", err)
+				}
+			}
+		}
+	}
+}
+
+// post sends body of contentType to url, retrying with an interval doubled after each
+// failure.
+func (n *webhookNotifier) post(ctx context.Context, url, contentType string, body []byte) error {
+	interval := n.retryInterval
+
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		if err = n.postOnce(ctx, url, contentType, body); err == nil || attempt == n.maxRetries {
+			return err
+		}
+
+		log.Debugln("Retrying webhook", url, "in", interval, "after", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(interval):
+		}
+
+		interval *= 2
+	}
+}
+
+func (n *webhookNotifier) postOnce(ctx context.Context, url, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return ErrOperationFailedWithReason("webhook request", err.Error())
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return ErrOperationFailedWithReason("webhook request", fmt.Sprintf("POST %s: %s", url, resp.Status))
+	}
+
+	return nil
+}
+
+// notifyWebhooks posts an event of the association of pConn.
+func (pConn *PFCPConn) notifyWebhooks(e webhookEvent) {
+	if pConn.upf.webhooks == nil {
+		return
+	}
+
+	e.Peer = pConn.nodeID.remote
+
+	if pConn.Conn != nil {
+		e.PeerAddress = pConn.RemoteAddr().String()
+	}
+
+	pConn.upf.webhooks.notify(e)
+}
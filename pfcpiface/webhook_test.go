@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+func Test_webhookNotifier(t *testing.T) {
+	var attempts int32
+
+	received := make(chan webhookEvent, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt fails, to be retried.
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var e webhookEvent
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&e))
+		received <- e
+	}))
+	defer srv.Close()
+
+	n := newWebhookNotifier(WebhookInfo{
+		URLs:          []string{srv.URL},
+		Events:        []string{webhookAssociationUp, webhookSessionCreated},
+		Timeout:       "1s",
+		MaxRetries:    2,
+		RetryInterval: "10ms",
+		QueueSize:     4,
+	}, "upf.example.org")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go n.run(ctx)
+
+	pConn := &PFCPConn{upf: &upf{webhooks: n}}
+	pConn.nodeID.remote = "smf.example.org"
+
+	pConn.notifyWebhooks(webhookEvent{Event: webhookAssociationDown})
+	pConn.notifyWebhooks(webhookEvent{Event: webhookAssociationUp})
+
+	select {
+	case e := <-received:
+		require.Equal(t, webhookAssociationUp, e.Event, "unsubscribed events are not posted")
+		require.Equal(t, "upf.example.org", e.NodeID)
+		require.Equal(t, "smf.example.org", e.Peer)
+		require.False(t, e.Time.IsZero())
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not posted")
+	}
+
+	require.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+
+	t.Run("nothing is posted when disabled", func(t *testing.T) {
+		var disabled *webhookNotifier
+		disabled.notify(webhookEvent{Event: webhookAssociationUp})
+	})
+}
+
+func Test_webhookNotifier_post(t *testing.T) {
+	var attempts int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	n := newWebhookNotifier(WebhookInfo{URLs: []string{srv.URL}, Timeout: "1s", MaxRetries: 2, RetryInterval: "1ms"}, "")
+
+	require.Error(t, n.post(context.Background(), srv.URL, "application/json", []byte("{}")))
+	require.Equal(t, int32(3), atomic.LoadInt32(&attempts), "first attempt and 2 retries")
+}
+
+func TestPFCPConn_sessionEvents_webhooks(t *testing.T) {
+	n := newWebhookNotifier(WebhookInfo{URLs: []string{"http://198.18.0.10"}, QueueSize: 4}, "upf")
+
+	pConn := &PFCPConn{upf: &upf{webhooks: n}, store: NewInMemoryStore()}
+	session := PFCPSession{localSEID: 5}
+	session.pdrs = []pdr{{srcIface: core, ueAddress: ip2int(net.ParseIP("10.250.0.1"))}}
+
+	upFSEID := ie.NewFSEID(5, net.ParseIP("198.18.0.1"), nil)
+
+	events := pConn.sessionEvents(message.NewSessionEstablishmentRequest(0, 0, 0, 1, 0))
+	require.NoError(t, pConn.store.PutSession(session, nil, false, 0))
+	events(message.NewSessionEstablishmentResponse(0, 0, 3, 1, 0, ie.NewCause(ie.CauseRequestAccepted), upFSEID))
+
+	events = pConn.sessionEvents(message.NewSessionModificationRequest(0, 0, 5, 2, 0))
+	events(message.NewSessionModificationResponse(0, 0, 3, 2, 0, ie.NewCause(ie.CauseRequestAccepted)))
+
+	events = pConn.sessionEvents(message.NewSessionDeletionRequest(0, 0, 6, 3, 0))
+	events(message.NewSessionDeletionResponse(0, 0, 3, 3, 0, ie.NewCause(ie.CauseSessionContextNotFound)))
+
+	events = pConn.sessionEvents(message.NewSessionDeletionRequest(0, 0, 5, 4, 0))
+	require.NoError(t, pConn.store.DeleteSession(5, nil))
+	events(message.NewSessionDeletionResponse(0, 0, 3, 4, 0, ie.NewCause(ie.CauseRequestAccepted)))
+
+	require.Len(t, n.queue, 2, "only accepted creations and deletions are posted")
+
+	for _, want := range []string{webhookSessionCreated, webhookSessionDeleted} {
+		e := <-n.queue
+		require.Equal(t, want, e.Event)
+		require.Equal(t, uint64(5), e.SEID)
+		require.Equal(t, "10.250.0.1", e.UEIP)
+	}
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"sync"
+
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+// pfcpWorkerQueueSize is the number of messages queued for each worker, reading
+// from the PFCP connection blocks once the queue of a worker is full.
+const pfcpWorkerQueueSize = 64
+
+// pfcpWorkers handle the session related messages of a PFCP connection concurrently,
+// so that a slow datapath write for one session does not delay the others. The
+// messages of a session always go to the same worker, which handles them in order.
+type pfcpWorkers struct {
+	handle func(message.Message)
+	queues []chan pfcpWork
+	// inflight counts the messages dispatched and not yet handled.
+	inflight sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// pfcpWork is a message queued for a worker, with its pooled buffer if any.
+type pfcpWork struct {
+	msg    message.Message
+	pooled *[]byte
+}
+
+func newPFCPWorkers(n int, handle func(message.Message)) *pfcpWorkers {
+	w := &pfcpWorkers{
+		handle: handle,
+		queues: make([]chan pfcpWork, n),
+		stop:   make(chan struct{}),
+	}
+
+	for i := range w.queues {
+		w.queues[i] = make(chan pfcpWork, pfcpWorkerQueueSize)
+	}
+
+	return w
+}
+
+func (w *pfcpWorkers) run() {
+	for _, q := range w.queues {
+		go w.work(q)
+	}
+}
+
+func (w *pfcpWorkers) work(q chan pfcpWork) {
+	for {
+		select {
+		case <-w.stop:
+			return
+		case work := <-q:
+			w.handle(work.msg)
+
+			if work.pooled != nil {
+				putPFCPBuf(work.pooled)
+			}
+
+			w.inflight.Done()
+		}
+	}
+}
+
+// close stops the workers, queued messages are dropped.
+func (w *pfcpWorkers) close() {
+	w.stopOnce.Do(func() { close(w.stop) })
+}
+
+// sessionKey returns the key spreading the messages of sessions over the workers,
+// false for the messages of the connection.
+func sessionKey(msg message.Message) (uint64, bool) {
+	switch req := msg.(type) {
+	case *message.SessionEstablishmentRequest:
+		// The local SEID of a session is that of the CP node, so the establishment
+		// goes to the same worker as the later requests of the session.
+		if fseid, err := req.CPFSEID.FSEID(); err == nil {
+			return fseid.SEID, true
+		}
+
+		return uint64(req.Sequence()), true
+	case *message.SessionModificationRequest, *message.SessionDeletionRequest,
+		*message.SessionReportResponse:
+		return msg.SEID(), true
+	default:
+		return 0, false
+	}
+}
+
+// dispatch queues the session related msg to its worker, which returns its pooled
+// buffer once handled. The messages of the connection are not queued, those changing
+// the association or several sessions are only handled once the queued messages are,
+// returns false for them.
+func (w *pfcpWorkers) dispatch(msg message.Message, pooled *[]byte) bool {
+	key, ok := sessionKey(msg)
+	if !ok {
+		switch msg.MessageType() {
+		case message.MsgTypeHeartbeatRequest, message.MsgTypeHeartbeatResponse,
+			message.MsgTypeAssociationSetupResponse, message.MsgTypeAssociationUpdateResponse,
+			message.MsgTypeNodeReportResponse:
+		default:
+			w.wait()
+		}
+
+		return false
+	}
+
+	w.inflight.Add(1)
+
+	select {
+	case <-w.stop:
+		w.inflight.Done()
+	case w.queues[key%uint64(len(w.queues))] <- pfcpWork{msg: msg, pooled: pooled}:
+	}
+
+	return true
+}
+
+// wait waits for the dispatched messages to be handled, or the workers to stop.
+func (w *pfcpWorkers) wait() {
+	done := make(chan struct{})
+
+	go func() {
+		w.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-w.stop:
+	}
+}
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+	"github.com/wmnsk/go-pfcp/message"
+)
+
+func Test_sessionKey(t *testing.T) {
+	sereq := message.NewSessionEstablishmentRequest(0, 0, 0, 1, 0,
+		ie.NewNodeID("198.18.0.2", "", ""), ie.NewFSEID(7, net.ParseIP("198.18.0.2"), nil))
+	smreq := message.NewSessionModificationRequest(0, 0, 7, 2, 0)
+	sdreq := message.NewSessionDeletionRequest(0, 0, 7, 3, 0)
+
+	for _, msg := range []message.Message{sereq, smreq, sdreq} {
+		key, ok := sessionKey(msg)
+		require.True(t, ok, msg.MessageTypeName())
+		require.Equal(t, uint64(7), key, msg.MessageTypeName())
+	}
+
+	_, ok := sessionKey(message.NewHeartbeatRequest(4, ie.NewRecoveryTimeStamp(time.Now()), nil))
+	require.False(t, ok)
+}
+
+func Test_pfcpWorkers(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		handled []uint32
+	)
+
+	// The first session is slow to handle.
+	release := make(chan struct{})
+	w := newPFCPWorkers(2, func(msg message.Message) {
+		if msg.SEID() == 2 && msg.Sequence() == 1 {
+			<-release
+		}
+
+		mu.Lock()
+		handled = append(handled, msg.Sequence())
+		mu.Unlock()
+	})
+	w.run()
+
+	defer w.close()
+
+	handledSeqs := func() []uint32 {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]uint32{}, handled...)
+	}
+
+	require.True(t, w.dispatch(message.NewSessionModificationRequest(0, 0, 2, 1, 0), nil))
+	require.True(t, w.dispatch(message.NewSessionModificationRequest(0, 0, 2, 2, 0), nil))
+	require.True(t, w.dispatch(message.NewSessionModificationRequest(0, 0, 3, 3, 0), nil))
+
+	t.Run("other sessions are not delayed", func(t *testing.T) {
+		require.Eventually(t, func() bool {
+			return len(handledSeqs()) == 1
+		}, time.Second, time.Millisecond)
+		require.Equal(t, []uint32{3}, handledSeqs())
+	})
+
+	t.Run("heartbeats are not delayed", func(t *testing.T) {
+		require.False(t, w.dispatch(message.NewHeartbeatRequest(4, ie.NewRecoveryTimeStamp(time.Now()), nil), nil))
+	})
+
+	t.Run("association messages wait for the sessions", func(t *testing.T) {
+		dispatched := make(chan bool)
+
+		go func() {
+			dispatched <- w.dispatch(message.NewAssociationReleaseRequest(5, ie.NewNodeID("198.18.0.2", "", "")), nil)
+		}()
+
+		select {
+		case <-dispatched:
+			t.Fatal("association message handled before the queued sessions")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+
+		require.False(t, <-dispatched)
+		require.Equal(t, []uint32{3, 1, 2}, handledSeqs(), "requests of a session are handled in order")
+	})
+}
@@ -0,0 +1,536 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+const (
+	// xdpPinPathDefault is where the loader of conf/xdp/upf_xdp.c pins the maps.
+	xdpPinPathDefault = "/sys/fs/bpf/upf"
+	// xdpMaxQERs is the number of QERs the XDP program applies per PDR.
+	xdpMaxQERs = 2
+	// xdpBurstDurationMs sizes the token buckets of QERs.
+	xdpBurstDurationMs = 100
+)
+
+// FAR actions of the XDP program.
+const (
+	xdpFARDrop    = 0
+	xdpFARForward = 1
+	xdpFARBuffer  = 2
+)
+
+// Sizes of the map keys and values, see conf/xdp/upf_xdp.c.
+const (
+	xdpPDRULKeyLen     = 8
+	xdpPDRDLKeyLen     = 4
+	xdpPDRInfoLen      = 24
+	xdpFARKeyLen       = 16
+	xdpFARInfoLen      = 16
+	xdpQERKeyLen       = 16
+	xdpBucketLen       = 40
+	xdpQERInfoLen      = 8 + 2*xdpBucketLen
+	xdpCounterKeyLen   = 16
+	xdpCounterLen      = 16
+	xdpNeighborKeyLen  = 4
+	xdpNeighborInfoLen = 12
+)
+
+// xdpHostEndian is the byte order of the hosts running the XDP datapath (x86-64, arm64).
+var xdpHostEndian = binary.LittleEndian
+
+// xdp programs the eBPF/XDP datapath of conf/xdp/upf_xdp.c through its pinned maps.
+// PDRs are matched exactly on the tunnel (uplink) or the UE address (downlink),
+// so SDF filters, QFI matches and N9 tunnels are not supported.
+type xdp struct {
+	mu      sync.Mutex
+	pdrsUL  *bpfMap
+	pdrsDL  *bpfMap
+	fars    *bpfMap
+	qers    *bpfMap
+	ctrs    *bpfMap
+	pinPath string
+	// neighbors are the UE addresses the program answers the ARP requests for, nil
+	// unless the neighbor proxy is enabled.
+	neighbors     *bpfMap
+	neighborProxy *neighborProxy
+}
+
+func (x *xdp) IsConnected(accessIP *net.IP) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	return x.pdrsUL != nil
+}
+
+func (x *xdp) SetUpfInfo(u *upf, conf *Conf) error {
+	log.Println("SetUpfInfo xdp")
+
+	x.pinPath = conf.XDPIface.PinPath
+	if x.pinPath == "" {
+		x.pinPath = xdpPinPathDefault
+	}
+
+	maps := map[string]**bpfMap{
+		"pdrs_ul":      &x.pdrsUL,
+		"pdrs_dl":      &x.pdrsDL,
+		"fars":         &x.fars,
+		"qers":         &x.qers,
+		"pdr_counters": &x.ctrs,
+	}
+
+	np, err := newNeighborProxy(conf)
+	if err != nil {
+		return err
+	}
+
+	if np != nil {
+		x.neighborProxy = np
+		maps["neighbor_proxy"] = &x.neighbors
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for name, m := range maps {
+		*m, err = openPinnedMap(filepath.Join(x.pinPath, name))
+		if err != nil {
+			x.unsafeCloseMaps()
+			return ErrOperationFailedWithReason("XDP datapath not loaded", err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (x *xdp) Exit() {
+	log.Println("Exit function xdp")
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.unsafeCloseMaps()
+}
+
+func (x *xdp) unsafeCloseMaps() {
+	for _, m := range []**bpfMap{&x.pdrsUL, &x.pdrsDL, &x.fars, &x.qers, &x.ctrs, &x.neighbors} {
+		if *m != nil {
+			(*m).close()
+			*m = nil
+		}
+	}
+}
+
+func (x *xdp) AddSliceInfo(sliceInfo *SliceInfo) error {
+	return ErrUnsupported("slice meter", "xdp")
+}
+
+func (x *xdp) RemoveSliceInfo(sliceInfo *SliceInfo) error {
+	return ErrUnsupported("slice meter", "xdp")
+}
+
+func (x *xdp) SendEndMarkers(endMarkerList *[][]byte) error {
+	return ErrUnsupported("end markers", "xdp")
+}
+
+// xdpCheckSupported returns an error if p cannot be matched by the XDP program.
+func xdpCheckSupported(p pdr) error {
+	switch {
+	case !p.IsAppFilterEmpty():
+		return ErrUnsupported("SDF filter", p.appFilter)
+	case p.matchesQFI():
+		return ErrUnsupported("QFI match", p.qfi)
+	case len(p.qerIDList) > xdpMaxQERs:
+		return ErrUnsupported("number of QERs", len(p.qerIDList))
+	case p.IsUplink() && p.tunnelTEIDMask == 0:
+		return ErrUnsupported("uplink PDR without F-TEID", p.pdrID)
+	case p.IsDownlink() && p.ueAddress == 0:
+		return ErrUnsupported("downlink PDR without UE address", p.pdrID)
+	case len(p.framedRoutes) > 0:
+		return ErrUnsupported("Framed-Route", p.framedRoutes)
+	}
+
+	return nil
+}
+
+func xdpCheckFARSupported(f far) error {
+	if f.dstIntf == ie.DstInterfaceCore && f.tunnelIP4Dst != 0 {
+		return ErrUnsupported("N9 tunnel", int2ip(f.tunnelIP4Dst))
+	}
+
+	return nil
+}
+
+func xdpPDRKey(p pdr) []byte {
+	if p.IsUplink() {
+		key := make([]byte, xdpPDRULKeyLen)
+		binary.BigEndian.PutUint32(key[0:], p.tunnelIP4Dst)
+		binary.BigEndian.PutUint32(key[4:], p.tunnelTEID)
+
+		return key
+	}
+
+	key := make([]byte, xdpPDRDLKeyLen)
+	binary.BigEndian.PutUint32(key, p.ueAddress)
+
+	return key
+}
+
+func xdpPDRInfo(p pdr) []byte {
+	b := make([]byte, xdpPDRInfoLen)
+	xdpHostEndian.PutUint64(b[0:], p.fseID)
+	xdpHostEndian.PutUint32(b[8:], p.pdrID)
+	xdpHostEndian.PutUint32(b[12:], p.farID)
+
+	for i, id := range p.qerIDList {
+		xdpHostEndian.PutUint32(b[16+4*i:], id)
+	}
+
+	return b
+}
+
+func xdpFARKey(f far) []byte {
+	key := make([]byte, xdpFARKeyLen)
+	xdpHostEndian.PutUint64(key[0:], f.fseID)
+	xdpHostEndian.PutUint32(key[8:], f.farID)
+
+	return key
+}
+
+func xdpNeighborInfo(n *neighborProxy) []byte {
+	b := make([]byte, xdpNeighborInfoLen)
+	xdpHostEndian.PutUint32(b[0:], uint32(n.ifindex))
+	copy(b[4:], n.mac)
+
+	return b
+}
+
+func xdpFARInfo(f far) []byte {
+	b := make([]byte, xdpFARInfoLen)
+
+	switch {
+	case f.Forwards():
+		b[0] = xdpFARForward
+	case f.Buffers():
+		b[0] = xdpFARBuffer
+	default:
+		b[0] = xdpFARDrop
+	}
+
+	if f.tunnelIP4Dst != 0 {
+		b[1] = 1
+	}
+
+	binary.BigEndian.PutUint16(b[2:], f.tunnelPort)
+	binary.BigEndian.PutUint32(b[4:], f.tunnelIP4Src)
+	binary.BigEndian.PutUint32(b[8:], f.tunnelIP4Dst)
+	binary.BigEndian.PutUint32(b[12:], f.tunnelTEID)
+
+	return b
+}
+
+func xdpQERKey(q qer) []byte {
+	key := make([]byte, xdpQERKeyLen)
+	xdpHostEndian.PutUint64(key[0:], q.fseID)
+	xdpHostEndian.PutUint32(key[8:], q.qerID)
+
+	return key
+}
+
+// putXDPBucket encodes the token bucket enforcing mbr (in kbps) on traffic of a gate.
+func putXDPBucket(b []byte, gateStatus uint8, mbr uint64) {
+	if gateStatus != ie.GateStatusOpen {
+		b[0] = 1
+	}
+
+	if mbr == 0 {
+		return
+	}
+
+	rate := mbr * 1000 / 8
+	burst := maxUint64(calcBurstSizeFromRate(mbr, xdpBurstDurationMs), DefaultBurstSize)
+
+	xdpHostEndian.PutUint64(b[8:], rate)
+	xdpHostEndian.PutUint64(b[16:], burst)
+	xdpHostEndian.PutUint64(b[24:], burst) // start with a full bucket
+}
+
+func xdpQERInfo(q qer) []byte {
+	b := make([]byte, xdpQERInfoLen)
+	putXDPBucket(b[8:8+xdpBucketLen], q.ulStatus, q.ulMbr)
+	putXDPBucket(b[8+xdpBucketLen:], q.dlStatus, q.dlMbr)
+
+	return b
+}
+
+func xdpCounterKey(fseID uint64, pdrID uint32) []byte {
+	key := make([]byte, xdpCounterKeyLen)
+	xdpHostEndian.PutUint64(key[0:], fseID)
+	xdpHostEndian.PutUint32(key[8:], pdrID)
+
+	return key
+}
+
+func (x *xdp) pdrMap(p pdr) *bpfMap {
+	if p.IsUplink() {
+		return x.pdrsUL
+	}
+
+	return x.pdrsDL
+}
+
+func (x *xdp) SendMsgToUPF(
+	method upfMsgType, rules PacketForwardingRules, updated PacketForwardingRules) uint8 {
+	pdrs := rules.pdrs
+	fars := rules.fars
+	qers := rules.qers
+
+	if method == upfMsgTypeMod {
+		pdrs = updated.pdrs
+		fars = updated.fars
+		qers = updated.qers
+	}
+
+	if method != upfMsgTypeDel {
+		for _, p := range pdrs {
+			if err := xdpCheckSupported(p); err != nil {
+				log.Errorln("Rejecting", p, ":", err)
+				return ie.CauseRequestRejected
+			}
+		}
+
+		for _, f := range fars {
+			if err := xdpCheckFARSupported(f); err != nil {
+				log.Errorln("Rejecting", f, ":", err)
+				return ie.CauseRequestRejected
+			}
+		}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.pdrsUL == nil {
+		log.Errorln("XDP datapath not loaded")
+		return ie.CauseRequestRejected
+	}
+
+	var err error
+
+	// Install FARs and QERs before the PDRs referencing them, remove them after.
+	if method == upfMsgTypeDel {
+		err = x.deletePDRs(pdrs)
+		if err == nil {
+			err = x.deleteFARsQERs(fars, qers)
+		}
+	} else {
+		err = x.writeFARsQERs(fars, qers)
+		if err == nil {
+			err = x.writePDRs(pdrs)
+		}
+	}
+
+	if err == nil {
+		err = x.proxyNeighbors(method, pdrs)
+	}
+
+	if err != nil {
+		log.Errorln("Failed to", method, "rules in XDP datapath:", err)
+		return ie.CauseRequestRejected
+	}
+
+	return ie.CauseRequestAccepted
+}
+
+func (x *xdp) WriteSessionBatch(method upfMsgType, all PacketForwardingRules, updated PacketForwardingRules) error {
+	return ErrUnsupported("batched rules", "xdp")
+}
+
+func (x *xdp) UpdateQERRates(q qer, all PacketForwardingRules) error {
+	return ErrUnsupported("in-place rule updates", "xdp")
+}
+
+func (x *xdp) UpdateFARTunnel(f far, all PacketForwardingRules) error {
+	return ErrUnsupported("in-place rule updates", "xdp")
+}
+
+func (x *xdp) writeFARsQERs(fars []far, qers []qer) error {
+	for _, f := range fars {
+		log.Traceln("xdp add", f)
+
+		if err := x.fars.update(xdpFARKey(f), xdpFARInfo(f)); err != nil {
+			return err
+		}
+	}
+
+	for _, q := range qers {
+		log.Traceln("xdp add", q)
+
+		if err := x.qers.update(xdpQERKey(q), xdpQERInfo(q)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (x *xdp) writePDRs(pdrs []pdr) error {
+	for _, p := range pdrs {
+		log.Traceln("xdp add", p)
+
+		if err := x.pdrMap(p).update(xdpPDRKey(p), xdpPDRInfo(p)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (x *xdp) deletePDRs(pdrs []pdr) error {
+	for _, p := range pdrs {
+		log.Traceln("xdp delete", p)
+
+		if err := x.pdrMap(p).delete(xdpPDRKey(p)); err != nil {
+			return err
+		}
+
+		if err := x.ctrs.delete(xdpCounterKey(p.fseID, p.pdrID)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// proxyNeighbors adds the UE addresses of the downlink PDRs installed to the neighbor
+// proxy, or removes those of the PDRs removed.
+func (x *xdp) proxyNeighbors(method upfMsgType, pdrs []pdr) error {
+	if x.neighbors == nil {
+		return nil
+	}
+
+	for _, ip := range x.neighborProxy.addresses(pdrs) {
+		key := make([]byte, xdpNeighborKeyLen)
+		binary.BigEndian.PutUint32(key, ip)
+
+		var err error
+		if method == upfMsgTypeDel {
+			err = x.neighbors.delete(key)
+		} else {
+			err = x.neighbors.update(key, xdpNeighborInfo(x.neighborProxy))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (x *xdp) deleteFARsQERs(fars []far, qers []qer) error {
+	for _, f := range fars {
+		log.Traceln("xdp delete", f)
+
+		if err := x.fars.delete(xdpFARKey(f)); err != nil {
+			return err
+		}
+	}
+
+	for _, q := range qers {
+		log.Traceln("xdp delete", q)
+
+		if err := x.qers.delete(xdpQERKey(q)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (x *xdp) ReadSliceMeterCounters(sliceInfo *SliceInfo) (map[string]sliceMeterCounters, error) {
+	return nil, ErrUnsupported("slice meter", "xdp")
+}
+
+// ReadPDRCounters reads the counters the XDP program keeps per PDR.
+func (x *xdp) ReadPDRCounters(pdrs []pdr) (map[pdrCounterKey]pdrCounters, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.ctrs == nil {
+		return nil, ErrOperationFailedWithReason("read counters", "XDP datapath not loaded")
+	}
+
+	counters := make(map[pdrCounterKey]pdrCounters, len(pdrs))
+	value := make([]byte, xdpCounterLen)
+
+	for _, p := range pdrs {
+		found, err := x.ctrs.lookup(xdpCounterKey(p.fseID, p.pdrID), value)
+		if err != nil {
+			return nil, err
+		}
+
+		key := pdrCounterKey{fseID: p.fseID, pdrID: p.pdrID}
+		if !found {
+			counters[key] = pdrCounters{}
+			continue
+		}
+
+		counters[key] = pdrCounters{
+			packets: xdpHostEndian.Uint64(value[0:]),
+			bytes:   xdpHostEndian.Uint64(value[8:]),
+		}
+	}
+
+	return counters, nil
+}
+
+// ReadInstalledPDRs looks the expected PDRs up in the PDR maps, which cannot be listed.
+func (x *xdp) ReadInstalledPDRs(expected []pdr) (map[pdrCounterKey]struct{}, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.pdrsUL == nil {
+		return nil, ErrOperationFailedWithReason("read installed PDRs", "XDP datapath not loaded")
+	}
+
+	installed := make(map[pdrCounterKey]struct{}, len(expected))
+	value := make([]byte, xdpPDRInfoLen)
+
+	for _, p := range expected {
+		found, err := x.pdrMap(p).lookup(xdpPDRKey(p), value)
+		if err != nil {
+			return nil, err
+		}
+
+		if found && xdpHostEndian.Uint64(value[0:]) == p.fseID && xdpHostEndian.Uint32(value[8:]) == p.pdrID {
+			installed[pdrCounterKey{fseID: p.fseID, pdrID: p.pdrID}] = struct{}{}
+		}
+	}
+
+	return installed, nil
+}
+
+func (x *xdp) DeleteInstalledPDRs(keys []pdrCounterKey) error {
+	return ErrUnsupported("deleting PDRs by ID", "xdp")
+}
+
+func (x *xdp) SummaryLatencyJitter(uc *upfCollector, ch chan<- prometheus.Metric) {
+}
+
+func (x *xdp) PortStats(uc *upfCollector, ch chan<- prometheus.Metric) {
+}
+
+func (x *xdp) SessionStats(*PfcpNodeCollector, chan<- prometheus.Metric) error {
+	return nil
+}
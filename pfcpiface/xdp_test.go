@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022-present Open Networking Foundation
+
+package pfcpiface
+
+import (
+	"math"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func Test_xdpCheckSupported(t *testing.T) {
+	ueAddress := ip2int(net.ParseIP("17.0.0.1"))
+
+	uplink := pdr{srcIface: access, tunnelIP4Dst: ip2int(net.ParseIP("198.18.0.1")),
+		tunnelTEID: 1, tunnelTEIDMask: math.MaxUint32, ueAddress: ueAddress}
+	uplink.resetAppFilter()
+	require.NoError(t, xdpCheckSupported(uplink))
+
+	downlink := pdr{srcIface: core, ueAddress: ueAddress}
+	downlink.resetAppFilter()
+	require.NoError(t, xdpCheckSupported(downlink))
+
+	sdf := downlink
+	sdf.appFilter.proto = 17
+	sdf.appFilter.protoMask = math.MaxUint8
+	require.Error(t, xdpCheckSupported(sdf))
+
+	qfi := uplink
+	qfi.qfi, qfi.qfiMask = 9, 0x3f
+	require.Error(t, xdpCheckSupported(qfi))
+
+	noTunnel := uplink
+	noTunnel.tunnelTEIDMask = 0
+	require.Error(t, xdpCheckSupported(noTunnel))
+
+	n9 := far{dstIntf: ie.DstInterfaceCore, tunnelIP4Dst: 1}
+	require.Error(t, xdpCheckFARSupported(n9))
+}
+
+func Test_xdpEncoding(t *testing.T) {
+	p := pdr{
+		srcIface: access, tunnelIP4Dst: ip2int(net.ParseIP("198.18.0.1")), tunnelTEID: 0x01020304,
+		fseID: 7, pdrID: 1, farID: 2, qerIDList: []uint32{3, 4},
+	}
+	require.Equal(t, []byte{198, 18, 0, 1, 1, 2, 3, 4}, xdpPDRKey(p))
+	require.Equal(t, []byte{
+		7, 0, 0, 0, 0, 0, 0, 0,
+		1, 0, 0, 0,
+		2, 0, 0, 0,
+		3, 0, 0, 0, 4, 0, 0, 0,
+	}, xdpPDRInfo(p))
+
+	f := far{
+		fseID: 7, farID: 2, applyAction: ActionForward, dstIntf: ie.DstInterfaceAccess,
+		tunnelIP4Src: ip2int(net.ParseIP("198.18.0.2")), tunnelIP4Dst: ip2int(net.ParseIP("198.18.0.1")),
+		tunnelTEID: 0x01020304, tunnelPort: tunnelGTPUPort,
+	}
+	require.Len(t, xdpFARKey(f), xdpFARKeyLen)
+	require.Equal(t, []byte{
+		xdpFARForward, 1, 0x08, 0x68,
+		198, 18, 0, 2,
+		198, 18, 0, 1,
+		1, 2, 3, 4,
+	}, xdpFARInfo(f))
+
+	q := qer{fseID: 7, qerID: 3, ulStatus: ie.GateStatusOpen, dlStatus: ie.GateStatusClosed, ulMbr: 8000}
+	info := xdpQERInfo(q)
+	require.Len(t, info, xdpQERInfoLen)
+
+	ul, dl := info[8:8+xdpBucketLen], info[8+xdpBucketLen:]
+	require.Zero(t, ul[0])
+	require.Equal(t, uint64(1000000), xdpHostEndian.Uint64(ul[8:]))
+	require.Equal(t, uint64(100000), xdpHostEndian.Uint64(ul[16:]))
+	require.Equal(t, uint8(1), dl[0])
+	require.Zero(t, xdpHostEndian.Uint64(dl[8:]))
+
+	np := &neighborProxy{ifindex: 3, mac: net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}}
+	require.Equal(t, []byte{3, 0, 0, 0, 0x02, 0, 0, 0, 0, 0x01, 0, 0}, xdpNeighborInfo(np))
+}
@@ -4,6 +4,7 @@
 package integration
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
@@ -81,6 +82,8 @@ var (
 	pfcpClient *pfcpsim.PFCPClient
 	// pfcpAgent instance is used only in the native mode
 	pfcpAgent *pfcpiface.PFCPIface
+	// pfcpAgentErr receives the error Run of pfcpAgent returned with.
+	pfcpAgentErr chan error
 
 	bessFake *fake_bess.FakeBESS
 )
@@ -355,8 +358,16 @@ func setup(t *testing.T, configType uint32) {
 		require.NoError(t, err)
 		MustStartPFCPAgent()
 	case ModeNative:
-		pfcpAgent = pfcpiface.NewPFCPIface(GetConfig(os.Getenv(EnvDatapath), configType))
-		go pfcpAgent.Run()
+		var err error
+
+		pfcpAgent, err = pfcpiface.NewPFCPIface(GetConfig(os.Getenv(EnvDatapath), configType))
+		require.NoError(t, err)
+
+		pfcpAgentErr = make(chan error, 1)
+
+		go func() {
+			pfcpAgentErr <- pfcpAgent.Run(context.Background())
+		}()
 	default:
 		t.Fatal("Unexpected test mode")
 	}
@@ -367,9 +378,20 @@ func setup(t *testing.T, configType uint32) {
 
 	// wait for PFCP Agent to initialize, blocking
 	err = waitForPFCPAssociationSetup(pfcpClient)
+	requirePFCPAgentRunning(t)
 	require.NoErrorf(t, err, "failed to start PFCP Agent: %v", err)
 }
 
+// requirePFCPAgentRunning fails the test if the native PFCP Agent already returned from Run.
+func requirePFCPAgentRunning(t *testing.T) {
+	select {
+	case err := <-pfcpAgentErr:
+		require.NoError(t, err, "PFCP Agent failed")
+		t.Fatal("PFCP Agent stopped unexpectedly")
+	default:
+	}
+}
+
 func teardown(t *testing.T) {
 	if pfcpClient.IsAssociationAlive() {
 		err := pfcpClient.TeardownAssociation()
@@ -392,6 +414,7 @@ func teardown(t *testing.T) {
 		}
 	case ModeNative:
 		pfcpAgent.Stop()
+		require.NoError(t, <-pfcpAgentErr, "PFCP Agent failed")
 	default:
 		t.Fatal("Unexpected test mode")
 	}